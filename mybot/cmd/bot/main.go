@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"runtime/debug"
 	"syscall"
+	_ "time/tzdata" // zone data for config.timezone on hosts without it
 
 	"github.com/rs/zerolog"
 
@@ -24,8 +25,29 @@ func initLogger() zerolog.Logger {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "rotate-key":
+			runRotateKey(os.Args[2:])
+			return
+		}
+	}
+
 	configPath := "config.json"
+	migrateOnly := false
+	convertTo := ""
 	flag.StringVar(&configPath, "config", configPath, "path to config file")
+	flag.BoolVar(&migrateOnly, "migrate-only", false, "upgrade the message database schema and exit")
+	flag.StringVar(&convertTo, "convert-to", "", "copy the message store into a new `backend:path` (sqlite or bolt) and exit")
 	flag.Parse()
 
 	log := initLogger()
@@ -35,6 +57,19 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed to load config")
 	}
 
+	if migrateOnly {
+		if err := app.MigrateStorage(cfg, configPath, log); err != nil {
+			log.Fatal().Err(err).Msg("Failed to migrate database")
+		}
+		return
+	}
+	if convertTo != "" {
+		if err := app.ConvertStorage(cfg, configPath, convertTo, log); err != nil {
+			log.Fatal().Err(err).Msg("Failed to convert message store")
+		}
+		return
+	}
+
 	// Apply memory tuning from config.
 	gcPercent := cfg.Performance.GCPercent
 	if gcPercent > 0 && os.Getenv("GOGC") == "" {
@@ -62,3 +97,86 @@ func main() {
 
 	bot.Run(ctx)
 }
+
+// runExport handles "bot export": it writes the stored history of a thread
+// to a file and exits.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "path to config file")
+	var opts app.ExportOptions
+	fs.Int64Var(&opts.ThreadID, "thread", 0, "ID of the thread to export (required)")
+	fs.StringVar(&opts.Format, "format", "jsonl", "file format: jsonl, html or csv")
+	fs.StringVar(&opts.Since, "since", "", "only messages from this `time` (7d, 2026-10-01, 01/10/2026 or RFC 3339)")
+	fs.StringVar(&opts.Until, "until", "", "only messages before this `time`")
+	fs.StringVar(&opts.Out, "out", "", "output `file` (default export-<thread>-<time>.<format>)")
+	fs.Parse(args)
+
+	log := initLogger()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load config")
+	}
+	if err := app.ExportThread(cfg, *configPath, opts, log); err != nil {
+		log.Fatal().Err(err).Msg("Failed to export thread")
+	}
+}
+
+// runBackup handles "bot backup": it writes one backup archive and exits.
+func runBackup(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "path to config file")
+	dir := fs.String("out", "", "`dir` to write the archive into (default backup.dir)")
+	fs.Parse(args)
+
+	log := initLogger()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load config")
+	}
+	if err := app.BackupNow(cfg, *configPath, *dir, log); err != nil {
+		log.Fatal().Err(err).Msg("Failed to back up")
+	}
+}
+
+// runRestore handles "bot restore": it checks a backup archive and, unless
+// -check is given, puts its contents in place of the live files. The bot
+// must be stopped first.
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "path to config file")
+	var opts app.RestoreOptions
+	fs.StringVar(&opts.Archive, "archive", "", "backup archive `file` to restore (required)")
+	fs.BoolVar(&opts.CheckOnly, "check", false, "only validate the archive")
+	fs.BoolVar(&opts.SkipConfig, "skip-config", false, "keep the current config file")
+	fs.Parse(args)
+
+	log := initLogger()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load config")
+	}
+	if err := app.RestoreBackup(cfg, *configPath, opts, log); err != nil {
+		log.Fatal().Err(err).Msg("Failed to restore backup")
+	}
+}
+
+// runRotateKey handles "bot rotate-key": it re-encrypts the message store
+// and config secrets with a new key, or as the flags say, and exits. The
+// bot must be stopped first.
+func runRotateKey(args []string) {
+	fs := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "path to config file")
+	var opts app.RotateKeyOptions
+	fs.BoolVar(&opts.Reencrypt, "reencrypt", false, "encrypt with the current key instead of a new one")
+	fs.BoolVar(&opts.Decrypt, "decrypt", false, "decrypt everything and turn encryption off")
+	fs.Parse(args)
+
+	log := initLogger()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load config")
+	}
+	if err := app.RotateKey(cfg, *configPath, opts, log); err != nil {
+		log.Fatal().Err(err).Msg("Failed to rotate encryption key")
+	}
+}
@@ -0,0 +1,242 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/backup"
+	"mybot/internal/config"
+	"mybot/internal/encryption"
+	"mybot/internal/messaging"
+)
+
+// spoolDirs are the media spool directories kept next to the sqlite
+// database; see enableSQLiteFeatures.
+var spoolDirs = []string{"outbox", "scheduled"}
+
+// backupSource describes what a backup of store, opened from dbPath, holds.
+func backupSource(cfg *config.Config, store messaging.Store, dbPath string) (backup.Source, error) {
+	snapshotter, ok := store.(messaging.Snapshotter)
+	if !ok {
+		return backup.Source{}, fmt.Errorf("storage backend %q can't be backed up", cfg.Storage.Backend)
+	}
+	src := backup.Source{Backend: cfg.Storage.Backend, Store: snapshotter, Config: cfg}
+	if _, ok := store.(*messaging.SQLiteStore); ok {
+		src.Dirs = make(map[string]string, len(spoolDirs))
+		for _, name := range spoolDirs {
+			src.Dirs[name] = filepath.Join(filepath.Dir(dbPath), name)
+		}
+	}
+	return src, nil
+}
+
+// startBackups starts the backup scheduler when backups are enabled.
+func (b *Bot) startBackups() {
+	if !b.Cfg.Backup.Enabled {
+		return
+	}
+	src, err := backupSource(b.Cfg, b.store, b.dbPath)
+	if err != nil {
+		b.Log.Warn().Err(err).Msg("Backups need storage.backend sqlite or bolt; they are disabled")
+		return
+	}
+	dir, err := config.ResolveBackupDir(b.ConfigPath, b.Cfg)
+	if err != nil {
+		b.Log.Error().Err(err).Msg("Failed to resolve backup dir; backups are disabled")
+		return
+	}
+	interval := time.Duration(b.Cfg.Backup.IntervalHours) * time.Hour
+	b.backups = backup.NewScheduler(b.Log, src, dir, interval, b.Cfg.Backup.Keep)
+}
+
+// BackupNow writes one backup archive into dir, or backup.dir when dir is
+// empty, without starting the bot. With the sqlite backend it may run while
+// the bot does; a bolt database is locked by a running bot.
+func BackupNow(cfg *config.Config, configPath, dir string, log zerolog.Logger) error {
+	if dir == "" {
+		var err error
+		if dir, err = config.ResolveBackupDir(configPath, cfg); err != nil {
+			return err
+		}
+	}
+	store, dbPath, err := openStore(cfg, configPath, log)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	src, err := backupSource(cfg, store, dbPath)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	path, m, err := backup.Create(context.Background(), src, dir, start)
+	if err != nil {
+		return err
+	}
+	log.Info().
+		Str("path", path).
+		Str("backend", m.Backend).
+		Int("files", len(m.Files)).
+		Dur("took", time.Since(start)).
+		Msg("Backup written")
+	return nil
+}
+
+// RestoreOptions are the arguments of "bot restore".
+type RestoreOptions struct {
+	Archive string
+	// CheckOnly validates the archive and changes nothing.
+	CheckOnly bool
+	// SkipConfig keeps the current config file.
+	SkipConfig bool
+}
+
+// RestoreBackup replaces the message database, spool directories and config
+// file with the contents of a backup archive. The archive is unpacked next
+// to the database and fully checked first; the files it replaces are kept
+// with a ".pre-restore-<time>" suffix. The bot must not be running: the
+// restore takes the lock a running bot holds on the data directory, and
+// refuses when it can't.
+func RestoreBackup(cfg *config.Config, configPath string, opts RestoreOptions, log zerolog.Logger) error {
+	if opts.Archive == "" {
+		return errors.New("restore: -archive is required")
+	}
+	backend := cfg.Storage.Backend
+	var dbPath string
+	var err error
+	switch backend {
+	case config.StorageSQLite, "":
+		backend = config.StorageSQLite
+		dbPath, err = config.ResolveMessageDBPath(configPath, cfg)
+	case config.StorageBolt:
+		dbPath, err = config.ResolveBoltDBPath(configPath, cfg)
+	default:
+		return fmt.Errorf("restore: storage backend %q has no database file", backend)
+	}
+	if err != nil {
+		return err
+	}
+	dataDir := filepath.Dir(dbPath)
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return err
+	}
+
+	// Unpack on the database's file system so the swap is a rename.
+	stage, err := os.MkdirTemp(dataDir, ".restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+	m, err := backup.Extract(opts.Archive, stage)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if m.Backend != backend {
+		return fmt.Errorf("restore: archive holds a %s database but storage.backend is %s; convert it after restoring with the matching backend", m.Backend, backend)
+	}
+	if opts.SkipConfig {
+		// Only what is restored has to open with our keys.
+		if err := os.Remove(filepath.Join(stage, backup.ConfigName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	keys := cfg.Keyring()
+	if keys == nil {
+		// Loaded only when the current config needs it; the archive may
+		// still be sealed.
+		if keys, _, err = cfg.LoadKeyring(configPath); err != nil && !errors.Is(err, encryption.ErrNoKey) {
+			return fmt.Errorf("restore: %w", err)
+		}
+	}
+	if err := backup.CheckExtracted(context.Background(), m, stage, keys); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	log.Info().
+		Str("archive", opts.Archive).
+		Time("created_at", m.CreatedAt).
+		Str("backend", m.Backend).
+		Int("schema_version", m.SchemaVersion).
+		Str("encryption_key_id", m.EncryptionKeyID).
+		Int("files", len(m.Files)).
+		Msg("Backup archive is valid")
+	if opts.CheckOnly {
+		return nil
+	}
+
+	lock, err := lockDataDir(dataDir)
+	if errors.Is(err, ErrBotRunning) {
+		return errors.New("restore: the bot is running on this data directory; stop it first")
+	} else if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	defer lock.Release()
+
+	suffix := ".pre-restore-" + time.Now().Format("20060102-150405")
+	// Each swap moves the live file at to aside and puts from in its place;
+	// an empty from only moves the live file.
+	type swap struct{ from, to string }
+	swaps := []swap{{filepath.Join(stage, m.Database), dbPath}}
+	if backend == config.StorageSQLite {
+		// The old WAL must not be replayed into the restored database.
+		swaps = append(swaps, swap{"", dbPath + "-wal"}, swap{"", dbPath + "-shm"})
+		for _, name := range spoolDirs {
+			swaps = append(swaps, swap{filepath.Join(stage, name), filepath.Join(dataDir, name)})
+		}
+	}
+	var moved []string
+	for _, s := range swaps {
+		if err := moveAside(s.to, suffix, &moved); err != nil {
+			return restoreFailed(err, moved)
+		}
+		if s.from == "" {
+			continue
+		}
+		if err := os.Rename(s.from, s.to); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return restoreFailed(err, moved)
+		}
+	}
+	if restored, err := os.ReadFile(filepath.Join(stage, backup.ConfigName)); err == nil && !opts.SkipConfig {
+		// The config may live on another file system; write it in place.
+		if err := moveAside(configPath, suffix, &moved); err != nil {
+			return restoreFailed(err, moved)
+		}
+		if err := os.WriteFile(configPath, restored, 0o600); err != nil {
+			return restoreFailed(err, moved)
+		}
+	}
+	log.Info().
+		Str("archive", opts.Archive).
+		Str("path", dbPath).
+		Strs("kept", moved).
+		Msg("Backup restored")
+	return nil
+}
+
+// moveAside renames path to path+suffix if it exists and records the new
+// name in moved.
+func moveAside(path, suffix string, moved *[]string) error {
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := os.Rename(path, path+suffix); err != nil {
+		return err
+	}
+	*moved = append(*moved, path+suffix)
+	return nil
+}
+
+func restoreFailed(err error, moved []string) error {
+	if len(moved) == 0 {
+		return fmt.Errorf("restore: %w", err)
+	}
+	return fmt.Errorf("restore stopped half way, the replaced files are kept as %v: %w", moved, err)
+}
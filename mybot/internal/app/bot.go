@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -13,11 +14,24 @@ import (
 	"github.com/rs/zerolog"
 	"go.mau.fi/mautrix-meta/pkg/messagix"
 
+	"mybot/internal/backup"
 	"mybot/internal/config"
+	"mybot/internal/core"
 	"mybot/internal/media"
 	"mybot/internal/messaging"
 	"mybot/internal/metrics"
+	"mybot/internal/modules/ban"
+	"mybot/internal/modules/broadcast"
+	"mybot/internal/modules/edits"
+	exportMod "mybot/internal/modules/export"
+	"mybot/internal/modules/group"
 	mediaMod "mybot/internal/modules/media"
+	"mybot/internal/modules/mod"
+	"mybot/internal/modules/poll"
+	"mybot/internal/modules/remind"
+	"mybot/internal/modules/schedule"
+	"mybot/internal/modules/search"
+	"mybot/internal/modules/stats"
 	"mybot/internal/registry"
 	"mybot/internal/scripting"
 	"mybot/internal/transport/facebook"
@@ -84,7 +98,12 @@ type Bot struct {
 	ConfigPath string
 
 	messageAPI   *messaging.Service
+	store        messaging.Store // unbatched, for backups
+	dbPath       string
+	dataLock     *dataLock
+	backups      *backup.Scheduler
 	sender       *messaging.LegacySender
+	pager        *messaging.Paginator
 	mediaService *mediaMod.Service
 	cmds         *registry.Registry
 	workerPool   *messaging.WorkerPool
@@ -97,6 +116,7 @@ type Bot struct {
 	botReady     atomic.Bool
 	connectTime  atomic.Int64
 	seenMessages *seenCache
+	busyNotices  sync.Map // thread ID → time of the last "busy" reply
 
 	fullReconnectCh    chan struct{}
 	stopPeriodicReconn atomic.Pointer[context.CancelFunc]
@@ -137,6 +157,7 @@ func New(cfg *config.Config, configPath string, log zerolog.Logger) (*Bot, error
 func (b *Bot) Run(ctx context.Context) {
 	b.metricStop = make(chan struct{})
 	b.startBackgroundTasks()
+	b.startBackups()
 
 	// Connection loop: reconnects automatically on errors.
 	go b.connectionLoop(ctx)
@@ -155,6 +176,9 @@ func (b *Bot) Stop() {
 	if b.workerPool != nil {
 		b.workerPool.Stop()
 	}
+	if b.backups != nil {
+		b.backups.Close()
+	}
 
 	b.clientMu.Lock()
 	if b.client != nil {
@@ -168,6 +192,7 @@ func (b *Bot) Stop() {
 			b.Log.Error().Err(err).Msg("Failed to close message DB")
 		}
 	}
+	b.dataLock.Release()
 
 	b.Log.Info().Msg("Bot stopped")
 }
@@ -175,14 +200,22 @@ func (b *Bot) Stop() {
 // ── Initialization ─────────────────────────────────────────────────────────────
 
 func (b *Bot) initStorage() error {
-	dbPath, err := config.ResolveMessageDBPath(b.ConfigPath, b.Cfg)
+	// Held while running so "bot restore" won't swap the database under us.
+	dir, err := dataDir(b.Cfg, b.ConfigPath)
 	if err != nil {
 		return err
 	}
-	store, err := messaging.OpenSQLiteStore(dbPath, b.Cfg.Performance.DBReadPoolSize)
+	if dir != "" {
+		if b.dataLock, err = lockDataDir(dir); err != nil {
+			return fmt.Errorf("lock %s: %w", dir, err)
+		}
+	}
+	store, dbPath, err := openStore(b.Cfg, b.ConfigPath, b.Log)
 	if err != nil {
+		b.dataLock.Release()
 		return err
 	}
+	b.store, b.dbPath = store, dbPath
 	batchedStore := messaging.NewBatchedStore(
 		store, b.Log,
 		b.Cfg.Performance.JobQueueSize,
@@ -209,17 +242,154 @@ func (b *Bot) initStorage() error {
 			return b.client
 		},
 		messaging.WithRateLimit(b.Cfg.Performance.SendRatePerSecond, b.Cfg.Performance.SendBurst),
+		messaging.WithThreadRateLimit(b.Cfg.Performance.ThreadSendPerMinute, b.Cfg.Performance.ThreadSendBurst),
+		messaging.WithUserRateLimit(b.Cfg.Performance.UserSendPerMinute, b.Cfg.Performance.UserSendBurst),
 	)
+	b.messageAPI.SetMaxTextLength(b.Cfg.Performance.MaxMessageLength)
+	b.messageAPI.SetThreadLocations(b.Cfg.ThreadLocation)
+	b.messageAPI.EnablePolls()
+	if sqliteStore, ok := store.(*messaging.SQLiteStore); ok {
+		if err := b.enableSQLiteFeatures(sqliteStore, dbPath); err != nil {
+			return err
+		}
+	} else {
+		b.Log.Warn().
+			Str("backend", b.Cfg.Storage.Backend).
+			Str("path", dbPath).
+			Msg("Outbox, schedules, reminders, broadcasts, moderation, bans, search and the attachment archive need storage.backend sqlite; they are disabled")
+	}
 	b.sender = messaging.NewLegacySender(b.messageAPI)
+	b.pager = messaging.NewPaginator(b.messageAPI, b.Cfg.Performance.MaxMessageLength)
+	return nil
+}
+
+// enableSQLiteFeatures turns on the features whose tables only the SQLite
+// store has. Spool files go next to the database at dbPath.
+func (b *Bot) enableSQLiteFeatures(store *messaging.SQLiteStore, dbPath string) error {
+	if err := b.messageAPI.EnableOutbox(store, filepath.Join(filepath.Dir(dbPath), "outbox")); err != nil {
+		return err
+	}
+	if err := b.messageAPI.EnableScheduler(store, filepath.Join(filepath.Dir(dbPath), "scheduled")); err != nil {
+		return err
+	}
+	b.messageAPI.EnableReminders(store)
+	b.messageAPI.EnableBroadcasts(store, time.Duration(b.Cfg.Performance.BroadcastDelayMs)*time.Millisecond)
+	if b.Cfg.Moderation.Enabled {
+		if err := b.messageAPI.EnableModeration(store, moderationPolicy(b.Cfg.Moderation), b.roleOf); err != nil {
+			return err
+		}
+	}
+	if err := b.messageAPI.EnableBans(store, b.roleOf); err != nil {
+		return err
+	}
+	if b.Cfg.Encryption.Enabled && !b.Cfg.Encryption.KeepSearchIndex {
+		b.Log.Info().Msg("Search is off: the index would keep message text in plaintext (encryption.keep_search_index)")
+	} else {
+		b.messageAPI.EnableSearch(store)
+	}
+	b.messageAPI.EnableStats(store)
+	if b.Cfg.Retention.Enabled {
+		b.messageAPI.EnableRetention(store, retentionPolicy(b.Cfg.Retention))
+	}
+	if b.Cfg.AttachmentArchive.Enabled {
+		dir, err := config.ResolveAttachmentDir(b.ConfigPath, b.Cfg)
+		if err != nil {
+			return err
+		}
+		if err := b.messageAPI.EnableAttachmentArchive(store, archivePolicy(b.Cfg.AttachmentArchive, dir)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// MigrateStorage upgrades the schema of the message database and closes it,
+// for running migrations without starting the bot. Only the sqlite backend
+// has migrations.
+func MigrateStorage(cfg *config.Config, configPath string, log zerolog.Logger) error {
+	if cfg.Storage.Backend != config.StorageSQLite {
+		log.Info().Str("backend", cfg.Storage.Backend).Msg("No schema migrations for this storage backend")
+		return nil
+	}
+	dbPath, err := config.ResolveMessageDBPath(configPath, cfg)
+	if err != nil {
+		return err
+	}
+	store, err := messaging.OpenSQLiteStore(dbPath, 1)
+	if err != nil {
+		return err
+	}
+	logMigration(log, dbPath, store.Migration())
+	return store.Close()
+}
+
+func logMigration(log zerolog.Logger, dbPath string, r messaging.MigrationReport) {
+	if len(r.Applied) == 0 {
+		log.Info().Str("path", dbPath).Int("schema_version", r.To).Msg("Database schema up to date")
+		return
+	}
+	log.Info().
+		Str("path", dbPath).
+		Int("from", r.From).
+		Int("to", r.To).
+		Strs("applied", r.Applied).
+		Str("backup", r.BackupPath).
+		Msg("Database schema migrated")
+}
+
+// moderationPolicy converts the moderation config into the rules the
+// messaging service applies.
+func moderationPolicy(cfg config.ModerationConfig) messaging.ModerationPolicy {
+	policy := messaging.ModerationPolicy{
+		FloodMessages:     cfg.FloodMessages,
+		FloodWindow:       time.Duration(cfg.FloodWindowSeconds) * time.Second,
+		DuplicateMessages: cfg.DuplicateMessages,
+		DuplicateWindow:   time.Duration(cfg.DuplicateWindowSeconds) * time.Second,
+		LinkCount:         cfg.LinkCount,
+		LinkWindow:        time.Duration(cfg.LinkWindowSeconds) * time.Second,
+		MaxMentions:       cfg.MaxMentions,
+		StrikeWindow:      time.Duration(cfg.StrikeWindowMinutes) * time.Minute,
+		MuteFor:           time.Duration(cfg.MuteMinutes) * time.Minute,
+	}
+	for _, action := range cfg.Actions {
+		policy.Actions = append(policy.Actions, core.ModerationAction(action))
+	}
+	return policy
+}
+
+// retentionPolicy converts the retention config into the limits the pruner
+// applies; the -1 (off) values become zero.
+func retentionPolicy(cfg config.RetentionConfig) messaging.RetentionPolicy {
+	day := 24 * time.Hour
+	return messaging.RetentionPolicy{
+		MaxAge:               time.Duration(max(cfg.MaxAgeDays, 0)) * day,
+		BotMaxAge:            time.Duration(max(cfg.BotMaxAgeDays, 0)) * day,
+		MaxMessagesPerThread: max(cfg.MaxMessagesPerThread, 0),
+		KeepPinned:           !cfg.PrunePinned,
+		SlimAfter:            time.Duration(max(cfg.SlimAfterDays, 0)) * day,
+		Interval:             time.Duration(cfg.IntervalMinutes) * time.Minute,
+		BatchSize:            cfg.BatchSize,
+		BatchPause:           time.Duration(cfg.BatchPauseMs) * time.Millisecond,
+		VacuumEvery:          time.Duration(max(cfg.VacuumIntervalHours, 0)) * time.Hour,
+	}
+}
+
+func archivePolicy(cfg config.AttachmentArchiveConfig, dir string) messaging.ArchivePolicy {
+	return messaging.ArchivePolicy{
+		Dir:              dir,
+		MaxFileBytes:     int64(max(cfg.MaxFileMB, 0)) << 20,
+		ThreadQuotaBytes: int64(max(cfg.ThreadQuotaMB, 0)) << 20,
+		IncludeBot:       cfg.IncludeBot,
+	}
+}
+
 func (b *Bot) initWorkerPool() {
-	b.workerPool = messaging.NewWorkerPool(
-		b.Log,
-		b.Cfg.Performance.WorkerCount,
-		b.Cfg.Performance.JobQueueSize,
-	)
+	perf := b.Cfg.Performance
+	b.workerPool = messaging.NewWorkerPool(b.Log, map[messaging.Lane]messaging.LaneConfig{
+		messaging.LaneInteractive: {Workers: perf.WorkerCount, QueueSize: perf.JobQueueSize},
+		messaging.LaneMedia:       {Workers: perf.MediaWorkerCount, QueueSize: perf.MediaQueueSize},
+		messaging.LaneBackground:  {Workers: perf.BackgroundWorkerCount, QueueSize: perf.BackgroundQueueSize},
+	})
 }
 
 func (b *Bot) registerModules() {
@@ -239,8 +409,63 @@ func (b *Bot) registerModules() {
 		b.Log.Info().Int("max_concurrent", pool.Capacity()).Msg("Media download pool initialized")
 	}
 
+	// Compiled module: edits (reads edit history from the message store).
+	if _, err := os.Stat(filepath.Join(modulesDir, "edits")); err == nil {
+		b.cmds.Register(&edits.Command{})
+	}
+
+	// Compiled module: schedule (stores messages for the scheduler).
+	if _, err := os.Stat(filepath.Join(modulesDir, "schedule")); err == nil {
+		b.cmds.Register(&schedule.Command{})
+	}
+
+	// Compiled module: remind (stores reminders that mention their target).
+	if _, err := os.Stat(filepath.Join(modulesDir, "remind")); err == nil {
+		b.cmds.Register(&remind.Command{})
+	}
+
+	// Compiled module: broadcast (owner-only announcements to many threads).
+	if _, err := os.Stat(filepath.Join(modulesDir, "broadcast")); err == nil {
+		b.cmds.Register(&broadcast.Command{})
+	}
+
+	// Compiled module: group (thread administration with the sender's role).
+	if _, err := os.Stat(filepath.Join(modulesDir, "group")); err == nil {
+		b.cmds.Register(&group.Command{})
+	}
+
+	// Compiled module: poll (native polls with live results and deadlines).
+	if _, err := os.Stat(filepath.Join(modulesDir, "poll")); err == nil {
+		b.cmds.Register(&poll.Command{})
+	}
+
+	// Compiled module: ban (global and per-thread ban lists).
+	if _, err := os.Stat(filepath.Join(modulesDir, "ban")); err == nil {
+		b.cmds.Register(&ban.Command{})
+	}
+
+	// Compiled module: mod (anti-spam audit trail, mute and pardon).
+	if _, err := os.Stat(filepath.Join(modulesDir, "mod")); err == nil {
+		b.cmds.Register(&mod.Command{})
+	}
+
+	// Compiled module: search (full-text search of stored messages).
+	if _, err := os.Stat(filepath.Join(modulesDir, "search")); err == nil {
+		b.cmds.Register(&search.Command{})
+	}
+
+	// Compiled module: export (thread history as an html, json or csv file).
+	if _, err := os.Stat(filepath.Join(modulesDir, "export")); err == nil {
+		b.cmds.Register(&exportMod.Command{})
+	}
+
+	// Compiled module: stats (message counts, peak hours and top words).
+	if _, err := os.Stat(filepath.Join(modulesDir, "stats")); err == nil {
+		b.cmds.Register(&stats.Command{})
+	}
+
 	// Script modules: auto-loaded from modules/ subdirectories via Yaegi.
-	compiledModules := map[string]bool{"media": true}
+	compiledModules := map[string]bool{"media": true, "edits": true, "schedule": true, "remind": true, "broadcast": true, "group": true, "poll": true, "mod": true, "ban": true, "search": true, "export": true, "stats": true}
 	scriptCmds, scriptErrs := scripting.LoadModules(modulesDir, compiledModules)
 	for _, err := range scriptErrs {
 		b.Log.Error().Err(err).Msg("Failed to load script module")
@@ -263,6 +488,7 @@ func (b *Bot) startBackgroundTasks() {
 			select {
 			case <-ticker.C:
 				b.cmds.CleanCooldowns()
+				b.pruneBusyNotices()
 				b.Log.Debug().Int("seen_cache_size", b.seenMessages.Len()).Msg("Periodic cleanup: cooldowns")
 			case <-b.metricStop:
 				return
@@ -285,7 +511,7 @@ func (b *Bot) startBackgroundTasks() {
 			}
 		}
 	}()
-	go metrics.StartPeriodicLog(b.Log, 60*time.Second, b.metricStop)
+	go metrics.StartPeriodicLog(b.Log, 60*time.Second, b.Cfg.Performance.SendWaitTopThreads, b.metricStop)
 }
 
 // triggerReconnect signals the connection loop to reconnect.
@@ -16,6 +16,7 @@ import (
 func (b *Bot) connectionLoop(ctx context.Context) {
 	for {
 		b.botReady.Store(false)
+		b.messageAPI.NotifyDisconnected()
 		b.connectOnce(ctx)
 
 		if ctx.Err() != nil {
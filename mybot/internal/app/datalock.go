@@ -0,0 +1,66 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"mybot/internal/config"
+)
+
+// dataLockName is the file in the data directory that a running bot keeps
+// locked, so "bot restore" can tell the database is in use.
+const dataLockName = "bot.lock"
+
+// ErrBotRunning is returned when another process holds the data directory.
+var ErrBotRunning = errors.New("the bot is running on this data directory")
+
+// dataLock is an exclusive lock on a data directory, held until Release.
+type dataLock struct {
+	f *os.File
+}
+
+// lockDataDir takes the lock of dir without waiting. It returns
+// ErrBotRunning when another process holds it.
+func lockDataDir(dir string) (*dataLock, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, dataLockName), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &dataLock{f: f}, nil
+}
+
+// Release unlocks the data directory. It does nothing on a nil lock.
+func (l *dataLock) Release() {
+	if l == nil {
+		return
+	}
+	unlockFile(l.f)
+	l.f.Close()
+}
+
+// dataDir returns the directory holding the message database, or "" for
+// the memory backend.
+func dataDir(cfg *config.Config, configPath string) (string, error) {
+	var dbPath string
+	var err error
+	switch cfg.Storage.Backend {
+	case config.StorageSQLite, "":
+		dbPath, err = config.ResolveMessageDBPath(configPath, cfg)
+	case config.StorageBolt:
+		dbPath, err = config.ResolveBoltDBPath(configPath, cfg)
+	default:
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(dbPath), nil
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/backup"
+	"mybot/internal/config"
+	"mybot/internal/encryption"
+	"mybot/internal/messaging"
+)
+
+// reencryptBatch is how many rows "bot rotate-key" rewrites per
+// transaction.
+const reencryptBatch = 500
+
+// applyEncryption turns encryption of store on or off as
+// encryption.enabled says. Turned off, it still fails on a database that is
+// encrypted.
+func applyEncryption(cfg *config.Config, configPath string, store *messaging.SQLiteStore) error {
+	keys := cfg.Keyring()
+	if !cfg.Encryption.Enabled {
+		return store.DisableEncryption(keys)
+	}
+	if keys == nil {
+		var err error
+		if keys, _, err = cfg.LoadKeyring(configPath); err != nil {
+			return err
+		}
+	}
+	return store.EnableEncryption(keys, cfg.Encryption.KeepSearchIndex)
+}
+
+// RotateKeyOptions are the arguments of "bot rotate-key".
+type RotateKeyOptions struct {
+	// Reencrypt seals everything with the current key instead of a new one:
+	// after turning encryption on, or after putting a new key first in
+	// BOT_ENCRYPTION_KEY.
+	Reencrypt bool
+	// Decrypt writes everything back in plaintext and turns encryption off.
+	Decrypt bool
+}
+
+// RotateKey seals the stored messages and the config secrets with a new
+// key and drops the old ones, except those the archives in backup.dir are
+// sealed with. The new key is added to the key file before anything is
+// rewritten, so an interrupted rotation can simply be run again. Keys read from BOT_ENCRYPTION_KEY can't be written: put the new
+// one first there and use opts.Reencrypt. The bot must not be running.
+func RotateKey(cfg *config.Config, configPath string, opts RotateKeyOptions, log zerolog.Logger) error {
+	if opts.Reencrypt && opts.Decrypt {
+		return errors.New("rotate-key: -reencrypt and -decrypt can't be used together")
+	}
+	if cfg.Storage.Backend != config.StorageSQLite {
+		return fmt.Errorf("rotate-key: encryption needs storage.backend sqlite, not %s", cfg.Storage.Backend)
+	}
+	if !cfg.Encryption.Enabled && !opts.Decrypt {
+		return errors.New("rotate-key: encryption.enabled is false; turn it on first")
+	}
+	keys, source, err := cfg.LoadKeyring(configPath)
+	if err != nil {
+		return err
+	}
+	keyPath, err := config.ResolveKeyFile(configPath, cfg)
+	if err != nil {
+		return err
+	}
+	if !opts.Reencrypt && !opts.Decrypt {
+		if source == encryption.SourceEnv {
+			return fmt.Errorf("rotate-key: the key comes from %s; put a new key (openssl rand -base64 32) first in it, keep the old ones after it, and run \"bot rotate-key -reencrypt\"", encryption.EnvKey)
+		}
+		if keys, err = keys.WithKey(encryption.GenerateKey()); err != nil {
+			return err
+		}
+		if err := encryption.WriteKeyFile(keyPath, keys); err != nil {
+			return fmt.Errorf("write key file: %w", err)
+		}
+		cfg.SetKeyring(keys)
+	}
+
+	dbPath, err := config.ResolveMessageDBPath(configPath, cfg)
+	if err != nil {
+		return err
+	}
+	store, err := messaging.OpenSQLiteStore(dbPath, 1)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	logMigration(log, dbPath, store.Migration())
+	if opts.Decrypt {
+		err = store.DisableEncryption(keys)
+	} else {
+		err = store.EnableEncryption(keys, cfg.Encryption.KeepSearchIndex)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	n, err := store.Reencrypt(ctx, reencryptBatch)
+	if err != nil {
+		return fmt.Errorf("rewrite messages after %d: %w; run rotate-key again to finish", n, err)
+	}
+	// The old values stay in free pages until the file is rebuilt.
+	if err := store.Vacuum(ctx); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+
+	if opts.Decrypt {
+		cfg.Encryption.Enabled = false
+		cfg.SetKeyring(nil)
+	} else {
+		cfg.SetKeyring(keys.Current())
+	}
+	if err := cfg.Save(configPath); err != nil {
+		return fmt.Errorf("save config: %w", err)
+	}
+	// Old keys still open the backups sealed with them; they stay until
+	// those backups are rotated out.
+	kept := keys.Current()
+	if !opts.Decrypt && keys.Len() > 1 {
+		backupDir, err := config.ResolveBackupDir(configPath, cfg)
+		if err != nil {
+			return err
+		}
+		needed, err := backup.KeyIDs(backupDir)
+		if err != nil {
+			return fmt.Errorf("read backups: %w", err)
+		}
+		kept = keys.Keep(needed)
+		if source == encryption.SourceFile {
+			if err := encryption.WriteKeyFile(keyPath, kept); err != nil {
+				return fmt.Errorf("drop old keys: %w", err)
+			}
+		}
+	}
+
+	event := log.Info().
+		Str("path", dbPath).
+		Int("messages", n).
+		Dur("took", time.Since(start))
+	if opts.Decrypt {
+		event.Str("key_file", keyPath).Msg("Message store and config decrypted; encryption is off and the key is no longer needed")
+		return nil
+	}
+	event.Str("key_id", keys.KeyID()).Str("source", source.String()).Msg("Message store and config encrypted with the current key")
+	if kept.Len() > 1 {
+		log.Warn().Int("keys", kept.Len()-1).Msg("Old keys are kept to open the backups sealed with them; run \"bot rotate-key -reencrypt\" once those backups are rotated out")
+	}
+	if source == encryption.SourceEnv && keys.Len() > kept.Len() {
+		log.Warn().Msgf("Remove the old keys from %s that no backup needs; only the first one is used now", encryption.EnvKey)
+	}
+	return nil
+}
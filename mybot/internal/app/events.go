@@ -2,9 +2,11 @@ package app
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"go.mau.fi/mautrix-meta/pkg/messagix"
+	"go.mau.fi/mautrix-meta/pkg/messagix/table"
 
 	"mybot/internal/messaging"
 	"mybot/internal/metrics"
@@ -18,17 +20,20 @@ func (b *Bot) handleEvent(ctx context.Context, evt any) {
 		b.connectTime.Store(time.Now().UnixMilli())
 		b.botReady.Store(true)
 		b.Log.Info().Msg("Bot is ready to process messages")
+		b.messageAPI.NotifyReady()
 
 	case *messagix.Event_Reconnected:
 		b.connectTime.Store(time.Now().UnixMilli())
 		b.botReady.Store(true)
 		b.Log.Info().Msg("Bot reconnected, ready to process messages")
+		b.messageAPI.NotifyReady()
 
 	case *messagix.Event_PublishResponse:
 		b.handlePublishResponse(ctx, e)
 
 	case *messagix.Event_SocketError:
 		b.Log.Error().Err(e.Err).Int("attempts", e.ConnectionAttempts).Msg("Socket error")
+		b.messageAPI.NotifyDisconnected()
 		if e.ConnectionAttempts >= 10 {
 			b.Log.Warn().Msg("Too many failed reconnect attempts, triggering full reconnect")
 			b.triggerReconnect()
@@ -37,6 +42,7 @@ func (b *Bot) handleEvent(ctx context.Context, evt any) {
 	case *messagix.Event_PermanentError:
 		b.Log.Error().Err(e.Err).Msg("Permanent connection error, triggering full reconnect in 30s")
 		b.botReady.Store(false)
+		b.messageAPI.NotifyDisconnected()
 		go func() {
 			time.Sleep(30 * time.Second)
 			b.triggerReconnect()
@@ -70,30 +76,70 @@ func (b *Bot) handlePublishResponse(ctx context.Context, e *messagix.Event_Publi
 
 	// Dispatch all upsert messages.
 	for _, m := range e.Table.LSUpsertMessage {
-		b.submitMessage(m.ThreadKey, m.Text, m.SenderId, m.MessageId, m.TimestampMs, m.TextHasLinks, xmaURLs)
+		b.submitMessage(m.ToInsert(), xmaURLs)
 	}
 
 	// Dispatch all insert messages.
 	for _, m := range e.Table.LSInsertMessage {
-		b.submitMessage(m.ThreadKey, m.Text, m.SenderId, m.MessageId, m.TimestampMs, m.TextHasLinks, xmaURLs)
+		b.submitMessage(m, xmaURLs)
+	}
+
+	// Reactions may navigate paginated responses.
+	for _, r := range e.Table.LSUpsertReaction {
+		b.submitReaction(r)
 	}
 }
 
+// submitReaction hands a reaction to the paginator via the worker pool.
+func (b *Bot) submitReaction(r *table.LSUpsertReaction) {
+	if r == nil || r.MessageId == "" || r.Reaction == "" {
+		return
+	}
+	if sid := b.selfID.Load(); sid != 0 && r.ActorId == sid {
+		return
+	}
+	if r.TimestampMs > 0 && r.TimestampMs < b.connectTime.Load() {
+		return
+	}
+	b.workerPool.Submit(messaging.LaneInteractive, func() {
+		timeout := time.Duration(b.Cfg.Performance.MessageHandlerTimeoutSeconds) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		b.pager.HandleReaction(ctx, r.MessageId, r.Reaction)
+	})
+}
+
 // submitMessage wraps a raw LS message and submits it to the worker pool.
-func (b *Bot) submitMessage(threadKey int64, text string, senderID int64, messageID string, timestampMs int64, textHasLinks bool, xmaURLs map[string]string) {
+func (b *Bot) submitMessage(m *table.LSInsertMessage, xmaURLs map[string]string) {
+	if m == nil {
+		return
+	}
 	msg := &WrappedMessage{
-		ThreadKey:    threadKey,
-		Text:         text,
-		SenderId:     senderID,
-		MessageId:    messageID,
-		TimestampMs:  timestampMs,
-		TextHasLinks: textHasLinks,
-		XMAUrl:       xmaURLs[messageID],
+		ThreadKey:     m.ThreadKey,
+		Text:          m.Text,
+		SenderId:      m.SenderId,
+		MessageId:     m.MessageId,
+		TimestampMs:   m.TimestampMs,
+		TextHasLinks:  m.TextHasLinks,
+		XMAUrl:        xmaURLs[m.MessageId],
+		ReplySourceId: m.ReplySourceId,
+		Mentions:      messaging.MentionsFromTable(m.MentionIds, m.MentionOffsets, m.MentionLengths, m.MentionTypes),
 	}
 	metrics.Global.MessagesReceived.Add(1)
-	b.workerPool.Submit(func() {
-		b.handleMessage(msg)
+	text, act, ok := b.screenMessage(msg)
+	if act != nil {
+		b.runModeration(act)
+	}
+	if !ok {
+		return
+	}
+	// One thread's messages stay in order within their lane.
+	err := b.workerPool.SubmitKeyed(b.laneFor(msg), msg.ThreadKey, func() {
+		b.handleMessage(msg, text)
 	})
+	if errors.Is(err, messaging.ErrPoolBusy) {
+		b.notifyBusy(msg)
+	}
 }
 
 // buildXMAMap extracts message ID → action URL from XMA attachments and CTAs.
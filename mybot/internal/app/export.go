@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/config"
+	"mybot/internal/core"
+	"mybot/internal/export"
+	"mybot/internal/messaging"
+)
+
+// ExportOptions are the arguments of "bot export".
+type ExportOptions struct {
+	ThreadID int64
+	Format   string
+	Since    string // date, RFC 3339 time or age such as "7d"; "" = all
+	Until    string
+	Out      string // file path; "" names one after the thread and time
+}
+
+// ExportThread writes the stored messages of a thread to a file without
+// starting the bot.
+func ExportThread(cfg *config.Config, configPath string, opts ExportOptions, log zerolog.Logger) error {
+	if opts.ThreadID == 0 {
+		return fmt.Errorf("export: -thread is required")
+	}
+	format, err := export.ParseFormat(opts.Format)
+	if err != nil {
+		return err
+	}
+	loc := cfg.ThreadLocation(opts.ThreadID)
+	now := time.Now().In(loc)
+	var since, until time.Time
+	if opts.Since != "" {
+		if since, err = core.ParseDateFilter(opts.Since, now, loc, false); err != nil {
+			return fmt.Errorf("export: -since: %w", err)
+		}
+	}
+	if opts.Until != "" {
+		if until, err = core.ParseDateFilter(opts.Until, now, loc, true); err != nil {
+			return fmt.Errorf("export: -until: %w", err)
+		}
+	}
+
+	store, _, err := openStore(cfg, configPath, log)
+	if err != nil {
+		return err
+	}
+	// The service only reads here; it never connects.
+	reader := messaging.NewService(log, store, func() int64 { return 0 }, func() messaging.Transport { return nil }, nil)
+	defer reader.Close()
+	reader.SetThreadLocations(cfg.ThreadLocation)
+
+	path := opts.Out
+	if path == "" {
+		path = fmt.Sprintf("export-%d-%s.%s", opts.ThreadID, now.Format("20060102-150405"), format.Ext())
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	stats, err := export.Export(context.Background(), f, reader, export.Options{
+		ThreadID: opts.ThreadID,
+		Format:   format,
+		Since:    since,
+		Until:    until,
+		Location: loc,
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("export to %s: %w", path, err)
+	}
+	log.Info().
+		Int64("thread", opts.ThreadID).
+		Str("format", string(format)).
+		Int("messages", stats.Messages).
+		Str("to", path).
+		Msg("Thread exported")
+	return nil
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"errors"
 	"net/url"
 	"regexp"
 	"runtime/debug"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"mybot/internal/core"
+	"mybot/internal/messaging"
 	"mybot/internal/metrics"
 )
 
@@ -16,24 +18,26 @@ var urlRegex = regexp.MustCompile(`https?://\S+`)
 
 // WrappedMessage holds the fields we care about from LSUpsertMessage / LSInsertMessage.
 type WrappedMessage struct {
-	ThreadKey    int64
-	Text         string
-	SenderId     int64
-	MessageId    string
-	TimestampMs  int64
-	TextHasLinks bool
-	XMAUrl       string
+	ThreadKey     int64
+	Text          string
+	SenderId      int64
+	MessageId     string
+	TimestampMs   int64
+	TextHasLinks  bool
+	XMAUrl        string
+	ReplySourceId string
+	Mentions      []core.Mention
 }
 
-// handleMessage processes a single incoming message: either as a command or
-// as auto-detect media.
-func (b *Bot) handleMessage(msg *WrappedMessage) {
-	if msg == nil {
-		return
-	}
-
+// screenMessage runs on the event loop, before msg is given to a worker, so
+// every message is checked even when the worker pool drops it. It reports
+// whether msg is left to handle, with the text to handle it by: messages of
+// the bot itself, from before the connection, already seen or from banned
+// senders are not. Messages of muted senders aren't either, nor spam, for
+// which act is the moderation action left to run.
+func (b *Bot) screenMessage(msg *WrappedMessage) (effectiveText string, act func(context.Context), ok bool) {
 	// Determine effective text: use Text, or fall back to XMA URL for shared links.
-	effectiveText := msg.Text
+	effectiveText = msg.Text
 	if effectiveText == "" && msg.XMAUrl != "" {
 		b.Log.Debug().
 			Int64("thread", msg.ThreadKey).
@@ -45,21 +49,44 @@ func (b *Bot) handleMessage(msg *WrappedMessage) {
 	}
 
 	if effectiveText == "" {
-		return
+		return "", nil, false
 	}
 
 	// Skip self messages.
 	if sid := b.selfID.Load(); sid != 0 && msg.SenderId == sid {
-		return
+		return "", nil, false
 	}
 
 	// Skip messages older than when the bot connected.
 	if msg.TimestampMs > 0 && msg.TimestampMs < b.connectTime.Load() {
-		return
+		return "", nil, false
 	}
 
 	// Deduplicate.
 	if b.seenMessages.LoadOrStore(msg.MessageId) {
+		return "", nil, false
+	}
+
+	// Banned users and threads are ignored; owners never are.
+	if b.isBanned(msg) {
+		metrics.Global.MessagesProcessed.Add(1)
+		return "", nil, false
+	}
+
+	// Spam and messages of muted users get no reaction from the bot.
+	if ignore, act := b.moderate(msg, effectiveText); ignore {
+		metrics.Global.MessagesProcessed.Add(1)
+		return "", act, false
+	}
+	return effectiveText, nil, true
+}
+
+// handleMessage processes a single incoming message that passed
+// screenMessage: either as a command or as auto-detect media.
+func (b *Bot) handleMessage(msg *WrappedMessage, effectiveText string) {
+	// Replies navigating a paginated response are not commands.
+	if msg.ReplySourceId != "" && b.handlePageReply(msg) {
+		metrics.Global.MessagesProcessed.Add(1)
 		return
 	}
 
@@ -85,6 +112,63 @@ func (b *Bot) handleMessage(msg *WrappedMessage) {
 	metrics.Global.MessagesProcessed.Add(1)
 }
 
+// handlePageReply lets the paginator consume a reply to one of its pages.
+func (b *Bot) handlePageReply(msg *WrappedMessage) bool {
+	timeout := time.Duration(b.Cfg.Performance.MessageHandlerTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return b.pager.HandleReply(ctx, msg.ReplySourceId, msg.Text)
+}
+
+// isBanned reports whether the sender of msg, or its whole thread, is banned.
+func (b *Bot) isBanned(msg *WrappedMessage) bool {
+	if b.Cfg.IsOwner(msg.SenderId) {
+		return false
+	}
+	ban := b.messageAPI.BannedFor(msg.ThreadKey, msg.SenderId)
+	if ban == nil {
+		return false
+	}
+	b.Log.Debug().
+		Int64("thread", msg.ThreadKey).
+		Int64("sender", msg.SenderId).
+		Int64("ban_thread", ban.ThreadID).
+		Int64("ban_user", ban.UserID).
+		Msg("[DEBUG] Ignoring message from banned sender")
+	return true
+}
+
+// moderate counts msg against the anti-spam rules and reports whether to
+// ignore it, with the moderation action to run when it broke one.
+func (b *Bot) moderate(msg *WrappedMessage, effectiveText string) (bool, func(context.Context)) {
+	timeout := time.Duration(b.Cfg.Performance.MessageHandlerTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return b.messageAPI.ObserveMessage(ctx, &core.MessageRecord{
+		MessageID:   msg.MessageId,
+		ThreadID:    msg.ThreadKey,
+		SenderID:    msg.SenderId,
+		Text:        effectiveText,
+		Mentions:    msg.Mentions,
+		TimestampMs: msg.TimestampMs,
+	})
+}
+
+// runModeration runs a moderation action off the event loop: in the
+// interactive lane, or on its own goroutine when that is full, as floods
+// are when the lanes fill up.
+func (b *Bot) runModeration(act func(context.Context)) {
+	run := func() {
+		timeout := time.Duration(b.Cfg.Performance.MessageHandlerTimeoutSeconds) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		act(ctx)
+	}
+	if err := b.workerPool.Submit(messaging.LaneInteractive, run); errors.Is(err, messaging.ErrPoolBusy) {
+		go run()
+	}
+}
+
 // dispatchCommand parses and executes a bot command.
 func (b *Bot) dispatchCommand(msg *WrappedMessage) {
 	fullCmd := strings.TrimPrefix(msg.Text, b.Cfg.CommandPrefix)
@@ -103,7 +187,7 @@ func (b *Bot) dispatchCommand(msg *WrappedMessage) {
 	if cmdName == "media" {
 		timeout = time.Duration(b.Cfg.Performance.MediaCommandTimeoutSeconds) * time.Second
 	}
-	cmdCtx, cmdCancel := context.WithTimeout(context.Background(), timeout)
+	cmdCtx, cmdCancel := context.WithTimeout(core.WithRequester(context.Background(), msg.SenderId), timeout)
 	defer cmdCancel()
 
 	ctx := &core.CommandContext{
@@ -111,22 +195,49 @@ func (b *Bot) dispatchCommand(msg *WrappedMessage) {
 		Sender:            b.sender,
 		Messages:          b.messageAPI,
 		Conversation:      b.messageAPI,
+		Pages:             b.pager,
+		Reminders:         b.messageAPI,
+		Broadcasts:        b.messageAPI,
+		Threads:           b.messageAPI.ThreadAdminFor(msg.SenderId, b.roleOf),
+		Polls:             b.messageAPI,
+		Moderation:        b.messageAPI,
+		Bans:              b.messageAPI,
 		ThreadID:          msg.ThreadKey,
 		SenderID:          msg.SenderId,
+		SenderRole:        b.roleOf(cmdCtx, msg.ThreadKey, msg.SenderId),
 		IncomingMessageID: msg.MessageId,
+		ReplyToMessageID:  msg.ReplySourceId,
+		Mentions:          msg.Mentions,
 		Args:              args,
 		RawText:           msg.Text,
 		StartTime:         b.startTime,
 	}
 
-	if err := b.cmds.Execute(cmdName, ctx); err != nil {
+	stopTyping := b.keepTyping(msg.ThreadKey, msg.SenderId)
+	err := b.cmds.Execute(cmdName, ctx)
+	stopTyping()
+	if err != nil {
 		b.Log.Error().Err(err).Msg("Command execution failed")
-		b.sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Lỗi: "+err.Error())
+		if !core.IsReported(err) {
+			b.sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Lỗi: "+err.Error())
+		}
 	}
 	metrics.Global.CommandsExecuted.Add(1)
 	metrics.Global.MessagesProcessed.Add(1)
 }
 
+// roleOf returns the role userID runs commands with in threadID: owners
+// everywhere, admins in groups where Messenger lists them as admin.
+func (b *Bot) roleOf(ctx context.Context, threadID, userID int64) core.Role {
+	if b.Cfg.IsOwner(userID) {
+		return core.RoleOwner
+	}
+	if b.messageAPI.IsThreadAdmin(ctx, threadID, userID) {
+		return core.RoleAdmin
+	}
+	return core.RoleMember
+}
+
 // autoDetectMedia tries to extract a URL from the message and download media.
 func (b *Bot) autoDetectMedia(msg *WrappedMessage, effectiveText string) {
 	if b.mediaService == nil {
@@ -155,8 +266,10 @@ func (b *Bot) autoDetectMedia(msg *WrappedMessage, effectiveText string) {
 	b.Log.Debug().Str("url", urlMatch).Msg("[DEBUG] URL detected, processing media")
 
 	timeout := time.Duration(b.Cfg.Performance.MediaCommandTimeoutSeconds) * time.Second
-	autoCtx, autoCancel := context.WithTimeout(context.Background(), timeout)
+	autoCtx, autoCancel := context.WithTimeout(core.WithRequester(context.Background(), msg.SenderId), timeout)
 	defer autoCancel()
+	stopTyping := b.keepTyping(msg.ThreadKey, msg.SenderId)
+	defer stopTyping()
 	b.processMediaAuto(autoCtx, msg.ThreadKey, urlMatch)
 }
 
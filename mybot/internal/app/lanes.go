@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"mybot/internal/messaging"
+)
+
+// busyNoticeInterval is the minimum gap between two "busy" replies in the
+// same thread, so a flood of commands during an overload gets one notice.
+const busyNoticeInterval = 30 * time.Second
+
+// laneFor picks the worker pool lane for an incoming message: commands and
+// page-navigation replies are interactive, !media and messages with links go
+// to the media lane, and plain chat runs in the background. Messages of a
+// thread keep their order within a lane, not across lanes: a command isn't
+// held up by a link still downloading before it.
+func (b *Bot) laneFor(msg *WrappedMessage) messaging.Lane {
+	text := msg.Text
+	if text == "" {
+		text = msg.XMAUrl
+	}
+	if strings.HasPrefix(text, b.Cfg.CommandPrefix) {
+		fields := strings.Fields(strings.TrimPrefix(text, b.Cfg.CommandPrefix))
+		if len(fields) > 0 && fields[0] == "media" {
+			return messaging.LaneMedia
+		}
+		return messaging.LaneInteractive
+	}
+	if msg.ReplySourceId != "" {
+		return messaging.LaneInteractive
+	}
+	if msg.XMAUrl != "" || msg.TextHasLinks || urlRegex.MatchString(text) {
+		return messaging.LaneMedia
+	}
+	return messaging.LaneBackground
+}
+
+// notifyBusy tells the sender of a rejected command to try again later. Only
+// commands get a reply; links and chat are dropped quietly, and so is
+// anything from a banned sender or thread.
+func (b *Bot) notifyBusy(msg *WrappedMessage) {
+	text := msg.Text
+	if !strings.HasPrefix(text, b.Cfg.CommandPrefix) {
+		return
+	}
+	if sid := b.selfID.Load(); sid != 0 && msg.SenderId == sid {
+		return
+	}
+	if b.isBanned(msg) {
+		return
+	}
+	if msg.TimestampMs > 0 && msg.TimestampMs < b.connectTime.Load() {
+		return
+	}
+	now := time.Now()
+	if last, ok := b.busyNotices.Load(msg.ThreadKey); ok && now.Sub(last.(time.Time)) < busyNoticeInterval {
+		return
+	}
+	b.busyNotices.Store(msg.ThreadKey, now)
+
+	// The event loop must not block on the send.
+	go func() {
+		timeout := time.Duration(b.Cfg.Performance.MessageHandlerTimeoutSeconds) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		b.sender.SendMessage(ctx, msg.ThreadKey, "⏳ Bot đang bận, vui lòng thử lại sau ít phút.")
+	}()
+}
+
+// pruneBusyNotices forgets throttle entries older than busyNoticeInterval.
+func (b *Bot) pruneBusyNotices() {
+	now := time.Now()
+	b.busyNotices.Range(func(key, value any) bool {
+		if now.Sub(value.(time.Time)) >= busyNoticeInterval {
+			b.busyNotices.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/config"
+	"mybot/internal/messaging"
+)
+
+// openStore opens the message store selected by storage.backend and
+// returns it with its database path ("" for the memory backend). The sqlite
+// store encrypts as encryption.enabled says; the others can't.
+func openStore(cfg *config.Config, configPath string, log zerolog.Logger) (messaging.Store, string, error) {
+	if cfg.Encryption.Enabled && cfg.Storage.Backend != config.StorageSQLite && cfg.Storage.Backend != "" {
+		return nil, "", fmt.Errorf("encryption.enabled needs storage.backend sqlite, not %s", cfg.Storage.Backend)
+	}
+	switch cfg.Storage.Backend {
+	case config.StorageSQLite, "":
+		dbPath, err := config.ResolveMessageDBPath(configPath, cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		store, err := messaging.OpenSQLiteStore(dbPath, cfg.Performance.DBReadPoolSize)
+		if err != nil {
+			return nil, "", err
+		}
+		logMigration(log, dbPath, store.Migration())
+		if err := applyEncryption(cfg, configPath, store); err != nil {
+			store.Close()
+			return nil, "", err
+		}
+		return store, dbPath, nil
+	case config.StorageBolt:
+		dbPath, err := config.ResolveBoltDBPath(configPath, cfg)
+		if err != nil {
+			return nil, "", err
+		}
+		store, err := messaging.OpenBoltStore(dbPath)
+		return store, dbPath, err
+	case config.StorageMemory:
+		return messaging.NewMemoryStore(), "", nil
+	default:
+		return nil, "", fmt.Errorf("unknown storage.backend %q (want sqlite, bolt or memory)", cfg.Storage.Backend)
+	}
+}
+
+// ConvertStorage copies every record of the configured message store into
+// a new store, for switching storage.backend offline. target is
+// "<backend>:<path>", e.g. "bolt:data/messages.bolt"; the file must not
+// exist yet. Only the tables shared by all backends are copied.
+func ConvertStorage(cfg *config.Config, configPath, target string, log zerolog.Logger) error {
+	backend, path, ok := strings.Cut(target, ":")
+	if !ok || path == "" {
+		return fmt.Errorf("convert target %q: want <backend>:<path>", target)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("convert target %s already exists", path)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if cfg.Storage.Backend == config.StorageMemory {
+		return fmt.Errorf("storage.backend is memory: there is nothing to convert")
+	}
+	if cfg.Encryption.Enabled && backend == config.StorageBolt {
+		return fmt.Errorf("encryption.enabled: a bolt store can't be encrypted; decrypt with \"bot rotate-key -decrypt\" first")
+	}
+
+	src, srcPath, err := openStore(cfg, configPath, log)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var dst messaging.Store
+	switch backend {
+	case config.StorageSQLite:
+		var sqliteDst *messaging.SQLiteStore
+		if sqliteDst, err = messaging.OpenSQLiteStore(path, 1); err == nil {
+			dst = sqliteDst
+			if err = applyEncryption(cfg, configPath, sqliteDst); err != nil {
+				dst.Close()
+			}
+		}
+	case config.StorageBolt:
+		dst, err = messaging.OpenBoltStore(path)
+	default:
+		return fmt.Errorf("convert target backend %q: want sqlite or bolt", backend)
+	}
+	if err != nil {
+		return err
+	}
+
+	dumper, ok := src.(messaging.Dumper)
+	if !ok {
+		dst.Close()
+		return fmt.Errorf("storage.backend %s cannot be read for conversion", cfg.Storage.Backend)
+	}
+	stats, err := messaging.CopyStore(context.Background(), dst, dumper)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("convert to %s: %w", path, err)
+	}
+	log.Info().
+		Str("from", srcPath).
+		Str("to", path).
+		Str("backend", backend).
+		Stringer("copied", stats).
+		Msg("Message store converted")
+	return nil
+}
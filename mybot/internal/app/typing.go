@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// typingStartDelay keeps quick commands (ping, help) from flashing the
+	// indicator at all.
+	typingStartDelay = time.Second
+	// typingRefreshInterval re-sends the indicator before Messenger lets it
+	// lapse on the recipients' side.
+	typingRefreshInterval = 5 * time.Second
+)
+
+// keepTyping shows the typing indicator in threadID until the returned stop
+// function is called. stop does not wait for the indicator to be cleared and
+// is safe to call more than once.
+func (b *Bot) keepTyping(threadID, senderID int64) (stop func()) {
+	if b.messageAPI == nil {
+		return func() {}
+	}
+	// One-to-one thread keys are the other participant's user ID.
+	isGroup := threadID != senderID
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		timer := time.NewTimer(typingStartDelay)
+		defer timer.Stop()
+		started := false
+		for {
+			select {
+			case <-ctx.Done():
+				if started {
+					offCtx, offCancel := context.WithTimeout(context.Background(), 5*time.Second)
+					_ = b.messageAPI.SetTyping(offCtx, threadID, false, isGroup)
+					offCancel()
+				}
+				return
+			case <-timer.C:
+				if err := b.messageAPI.SetTyping(ctx, threadID, true, isGroup); err != nil {
+					b.Log.Debug().Err(err).Int64("thread", threadID).Msg("Failed to send typing indicator")
+				}
+				started = true
+				timer.Reset(typingRefreshInterval)
+			}
+		}
+	}()
+	return cancel
+}
@@ -0,0 +1,502 @@
+// Package backup writes and reads backup archives of the bot: a snapshot of
+// the message database, the config file (which holds the session cookies and
+// tokens) and the media spool directories, in one tar.gz with a manifest of
+// checksums.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"mybot/internal/config"
+	"mybot/internal/encryption"
+	"mybot/internal/messaging"
+)
+
+const (
+	// FormatVersion is the archive layout this build writes and reads.
+	FormatVersion = 1
+
+	// ManifestName is the archive entry listing the other entries. It is
+	// written last, after every checksum is known.
+	ManifestName = "manifest.json"
+	// ConfigName is the archive entry holding the config file.
+	ConfigName = "config.json"
+
+	filePrefix = "bot-backup-"
+	fileSuffix = ".tar.gz"
+	timeLayout = "20060102-150405"
+)
+
+// File is one archive entry listed in the manifest.
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes an archive.
+type Manifest struct {
+	Format    int       `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+	// Backend is the storage.backend the database snapshot belongs to.
+	Backend string `json:"backend"`
+	// Database is the entry holding the database snapshot.
+	Database string `json:"database"`
+	// SchemaVersion is the sqlite schema version of the snapshot.
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// EncryptionKeyID names the key the messages in the snapshot are sealed
+	// with; empty when they are plaintext.
+	EncryptionKeyID string `json:"encryption_key_id,omitempty"`
+	Files           []File `json:"files"`
+}
+
+// Source is what Create backs up.
+type Source struct {
+	// Backend is config.StorageSQLite or config.StorageBolt.
+	Backend string
+	Store   messaging.Snapshotter
+	Config  *config.Config
+	// Dirs maps an archive directory name to a directory on disk whose
+	// files are archived too; missing directories are skipped.
+	Dirs map[string]string
+}
+
+// DatabaseName returns the archive entry of the database snapshot for a
+// storage backend.
+func DatabaseName(backend string) (string, error) {
+	switch backend {
+	case config.StorageSQLite, "":
+		return "messages.sqlite", nil
+	case config.StorageBolt:
+		return "messages.bolt", nil
+	default:
+		return "", fmt.Errorf("storage backend %q can't be backed up", backend)
+	}
+}
+
+// Create writes a new archive of src into dir and returns its path. The
+// database snapshot is checked before it is archived, and the archive only
+// gets its final name once complete.
+func Create(ctx context.Context, src Source, dir string, now time.Time) (string, *Manifest, error) {
+	if src.Backend == "" {
+		src.Backend = config.StorageSQLite
+	}
+	dbName, err := DatabaseName(src.Backend)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", nil, err
+	}
+	target := filepath.Join(dir, filePrefix+now.Format(timeLayout)+fileSuffix)
+	if _, err := os.Stat(target); err == nil {
+		return "", nil, fmt.Errorf("backup %s already exists", target)
+	}
+
+	stage, err := os.MkdirTemp(dir, ".staging-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(stage)
+
+	m := &Manifest{Format: FormatVersion, CreatedAt: now, Backend: src.Backend, Database: dbName}
+	dbPath := filepath.Join(stage, dbName)
+	if err := src.Store.Snapshot(ctx, dbPath); err != nil {
+		return "", nil, fmt.Errorf("snapshot database: %w", err)
+	}
+	if m.SchemaVersion, err = checkDatabase(ctx, src.Backend, dbPath); err != nil {
+		return "", nil, fmt.Errorf("check snapshot: %w", err)
+	}
+	if src.Backend == config.StorageSQLite {
+		if m.EncryptionKeyID, err = messaging.SQLiteFileKeyID(ctx, dbPath); err != nil {
+			return "", nil, fmt.Errorf("check snapshot: %w", err)
+		}
+	}
+	files := []archiveFile{{name: dbName, path: dbPath}}
+	if src.Config != nil {
+		cfgPath := filepath.Join(stage, ConfigName)
+		if err := src.Config.Save(cfgPath); err != nil {
+			return "", nil, fmt.Errorf("snapshot config: %w", err)
+		}
+		files = append(files, archiveFile{name: ConfigName, path: cfgPath})
+	}
+	names := make([]string, 0, len(src.Dirs))
+	for name := range src.Dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dirFiles, err := listDir(name, src.Dirs[name])
+		if err != nil {
+			return "", nil, err
+		}
+		files = append(files, dirFiles...)
+	}
+
+	tmp := target + ".tmp"
+	if err := writeArchive(ctx, tmp, m, files); err != nil {
+		os.Remove(tmp)
+		return "", nil, err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return "", nil, err
+	}
+	return target, m, nil
+}
+
+type archiveFile struct {
+	name, path string
+}
+
+// listDir returns the regular files under root as entries below name.
+func listDir(name, root string) ([]archiveFile, error) {
+	var files []archiveFile
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, archiveFile{name: path.Join(name, filepath.ToSlash(rel)), path: p})
+		return nil
+	})
+	return files, err
+}
+
+func writeArchive(ctx context.Context, target string, m *Manifest, files []archiveFile) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entry, err := addFile(tw, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			// A spool file sent and removed since the directory was listed.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("archive %s: %w", file.name, err)
+		}
+		m.Files = append(m.Files, entry)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0o600, Size: int64(len(data)), ModTime: m.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func addFile(tw *tar.Writer, file archiveFile) (File, error) {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return File{}, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0o600, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return File{}, err
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(tw, io.TeeReader(f, h), info.Size()); err != nil {
+		return File{}, err
+	}
+	return File{Name: file.name, Size: info.Size(), SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Verify reads the whole archive at path and checks every entry against
+// the manifest.
+func Verify(path string) (*Manifest, error) {
+	return readArchive(path, func(string, io.Reader) error { return nil })
+}
+
+// Extract verifies the archive at path while unpacking it into dir, which
+// must exist. On error dir may hold part of the archive.
+func Extract(path, dir string) (*Manifest, error) {
+	return readArchive(path, func(name string, r io.Reader) error {
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// readArchive passes every entry but the manifest to fn while hashing it,
+// then checks the hashes against the manifest.
+func readArchive(path string, fn func(name string, r io.Reader) error) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	tr := tar.NewReader(gz)
+
+	seen := make(map[string]File)
+	var m *Manifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s: unexpected entry %s", path, hdr.Name)
+		}
+		if hdr.Name == ManifestName {
+			m = new(Manifest)
+			if err := json.NewDecoder(tr).Decode(m); err != nil {
+				return nil, fmt.Errorf("%s: manifest: %w", path, err)
+			}
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(hdr.Name)) || strings.Contains(hdr.Name, `\`) {
+			return nil, fmt.Errorf("%s: unsafe entry name %q", path, hdr.Name)
+		}
+		if _, dup := seen[hdr.Name]; dup {
+			return nil, fmt.Errorf("%s: duplicate entry %s", path, hdr.Name)
+		}
+		h := sha256.New()
+		counter := &countingReader{r: io.TeeReader(tr, h)}
+		if err := fn(hdr.Name, counter); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, hdr.Name, err)
+		}
+		// Drain what fn left so the hash covers the whole entry.
+		if _, err := io.Copy(io.Discard, counter); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, hdr.Name, err)
+		}
+		seen[hdr.Name] = File{Name: hdr.Name, Size: counter.n, SHA256: hex.EncodeToString(h.Sum(nil))}
+	}
+	if m == nil {
+		return nil, fmt.Errorf("%s: no manifest, not a bot backup or truncated", path)
+	}
+	if err := m.check(seen); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+func (m *Manifest) check(seen map[string]File) error {
+	if m.Format != FormatVersion {
+		return fmt.Errorf("archive format %d, this build reads %d", m.Format, FormatVersion)
+	}
+	if len(seen) != len(m.Files) {
+		return fmt.Errorf("archive has %d files, manifest lists %d", len(seen), len(m.Files))
+	}
+	for _, want := range m.Files {
+		got, ok := seen[want.Name]
+		if !ok {
+			return fmt.Errorf("%s is missing", want.Name)
+		}
+		if got != want {
+			return fmt.Errorf("%s is damaged: checksum mismatch", want.Name)
+		}
+	}
+	if !slices.ContainsFunc(m.Files, func(f File) bool { return f.Name == m.Database }) {
+		return fmt.Errorf("database %q is not in the archive", m.Database)
+	}
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// CheckExtracted checks an archive unpacked into dir by Extract: the
+// database must open and pass an integrity check, keys must hold the key
+// its messages are sealed with, and the config file, if any, must parse and
+// its sealed secrets open with keys. keys may be nil.
+func CheckExtracted(ctx context.Context, m *Manifest, dir string, keys *encryption.Keyring) error {
+	dbPath := filepath.Join(dir, m.Database)
+	if _, err := checkDatabase(ctx, m.Backend, dbPath); err != nil {
+		return fmt.Errorf("database %s: %w", m.Database, err)
+	}
+	keyID := m.EncryptionKeyID
+	if keyID == "" && (m.Backend == config.StorageSQLite || m.Backend == "") {
+		// Archives written before the manifest recorded the key.
+		var err error
+		if keyID, err = messaging.SQLiteFileKeyID(ctx, dbPath); err != nil {
+			return fmt.Errorf("database %s: %w", m.Database, err)
+		}
+	}
+	if keyID != "" && (keys == nil || !keys.Has(keyID)) {
+		return fmt.Errorf("database %s is encrypted with key %s, which is in neither %s nor the key file", m.Database, keyID, encryption.EnvKey)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ConfigName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cfg config.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("%s: %w", ConfigName, err)
+	}
+	if err := cfg.OpenSecrets(keys); err != nil {
+		return fmt.Errorf("%s: %w", ConfigName, err)
+	}
+	return nil
+}
+
+func checkDatabase(ctx context.Context, backend, path string) (int, error) {
+	switch backend {
+	case config.StorageSQLite, "":
+		return messaging.CheckSQLiteFile(ctx, path)
+	case config.StorageBolt:
+		return 0, messaging.CheckBoltFile(path)
+	default:
+		return 0, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// Archive is a backup archive found by List.
+type Archive struct {
+	Path      string
+	CreatedAt time.Time
+	Size      int64
+}
+
+// List returns the archives in dir, newest first. Other files are ignored.
+func List(dir string) ([]Archive, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var archives []Archive
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), filePrefix)
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		stamp, ok = strings.CutSuffix(stamp, fileSuffix)
+		if !ok {
+			continue
+		}
+		created, err := time.ParseInLocation(timeLayout, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, Archive{Path: filepath.Join(dir, e.Name()), CreatedAt: created, Size: info.Size()})
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].CreatedAt.After(archives[j].CreatedAt) })
+	return archives, nil
+}
+
+// KeyIDs returns the IDs of the encryption keys the archives in dir are
+// sealed with. Archives that don't verify are skipped; they can't be
+// restored anyway.
+func KeyIDs(dir string) (map[string]bool, error) {
+	archives, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool)
+	for _, a := range archives {
+		m, err := Verify(a.Path)
+		if err != nil {
+			continue
+		}
+		if m.EncryptionKeyID != "" {
+			ids[m.EncryptionKeyID] = true
+		}
+	}
+	return ids, nil
+}
+
+// Rotate deletes all but the keep newest archives in dir and returns the
+// paths it removed. keep < 0 keeps everything.
+func Rotate(dir string, keep int) ([]string, error) {
+	if keep < 0 {
+		return nil, nil
+	}
+	archives, err := List(dir)
+	if err != nil || len(archives) <= keep {
+		return nil, err
+	}
+	var removed []string
+	for _, a := range archives[keep:] {
+		if err := os.Remove(a.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, a.Path)
+	}
+	return removed, nil
+}
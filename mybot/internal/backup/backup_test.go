@@ -0,0 +1,258 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mybot/internal/config"
+	"mybot/internal/core"
+	"mybot/internal/encryption"
+	"mybot/internal/messaging"
+)
+
+func newSource(t *testing.T) Source {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := messaging.OpenSQLiteStore(filepath.Join(dir, "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.UpsertMessage(context.Background(), &core.MessageRecord{MessageID: "m1", ThreadID: 1, SenderID: 2, Text: "chào", TimestampMs: 1000}); err != nil {
+		t.Fatalf("UpsertMessage() error = %v", err)
+	}
+	outbox := filepath.Join(dir, "outbox")
+	if err := os.MkdirAll(filepath.Join(outbox, "7"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outbox, "7", "photo.jpg"), []byte("jpeg"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New()
+	cfg.Cookies["c_user"] = "42"
+	return Source{
+		Backend: config.StorageSQLite,
+		Store:   store,
+		Config:  cfg,
+		Dirs:    map[string]string{"outbox": outbox, "scheduled": filepath.Join(dir, "scheduled")},
+	}
+}
+
+func TestCreateVerifyExtract(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 19, 3, 0, 0, 0, time.Local)
+	path, m, err := Create(ctx, newSource(t), dir, now)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if filepath.Base(path) != "bot-backup-20261019-030000.tar.gz" {
+		t.Errorf("Create() path = %s", path)
+	}
+	if m.Database != "messages.sqlite" || m.SchemaVersion != messaging.LatestSchemaVersion() || len(m.Files) != 3 {
+		t.Fatalf("Create() manifest = %+v", m)
+	}
+	if _, err := Verify(path); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	out := t.TempDir()
+	if _, err := Extract(path, out); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if err := CheckExtracted(ctx, m, out, nil); err != nil {
+		t.Fatalf("CheckExtracted() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(out, "outbox", "7", "photo.jpg")); err != nil || string(data) != "jpeg" {
+		t.Errorf("extracted spool file = %q, %v", data, err)
+	}
+	restored, err := config.Load(filepath.Join(out, ConfigName))
+	if err != nil || restored.Cookies["c_user"] != "42" {
+		t.Errorf("extracted config cookies = %v, %v", restored, err)
+	}
+
+	if _, _, err := Create(ctx, newSource(t), dir, now); err == nil {
+		t.Error("Create() over an existing archive error = nil")
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".*")); len(leftovers) != 0 {
+		t.Errorf("Create() left %v behind", leftovers)
+	}
+}
+
+// rewrite copies the archive at src to dst, passing each entry through edit.
+func rewrite(t *testing.T, src, dst string, edit func(name string, data []byte) []byte) {
+	t.Helper()
+	f, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		if data = edit(hdr.Name, data); data == nil {
+			continue
+		}
+		hdr.Size = int64(len(data))
+		tw.WriteHeader(hdr)
+		tw.Write(data)
+	}
+	tw.Close()
+	zw.Close()
+	if err := os.WriteFile(dst, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckExtractedNeedsEncryptionKey(t *testing.T) {
+	ctx := context.Background()
+	keys, _ := encryption.NewKeyring(encryption.GenerateKey())
+	other, _ := encryption.NewKeyring(encryption.GenerateKey())
+	src := newSource(t)
+	if err := src.Store.(*messaging.SQLiteStore).EnableEncryption(keys, false); err != nil {
+		t.Fatalf("EnableEncryption() error = %v", err)
+	}
+	src.Config.Encryption.Enabled = true
+	src.Config.CookieString = "c_user=42"
+	src.Config.SetKeyring(keys)
+
+	dir := t.TempDir()
+	path, m, err := Create(ctx, src, dir, time.Now())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if m.EncryptionKeyID != keys.KeyID() {
+		t.Fatalf("Create() EncryptionKeyID = %q, want %q", m.EncryptionKeyID, keys.KeyID())
+	}
+	if ids, err := KeyIDs(dir); err != nil || len(ids) != 1 || !ids[keys.KeyID()] {
+		t.Fatalf("KeyIDs() = %v, %v; want %s", ids, err, keys.KeyID())
+	}
+	out := t.TempDir()
+	if _, err := Extract(path, out); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	for name, ring := range map[string]*encryption.Keyring{"no keys": nil, "other key": other} {
+		if err := CheckExtracted(ctx, m, out, ring); err == nil {
+			t.Errorf("CheckExtracted(%s) error = nil", name)
+		}
+	}
+	if err := CheckExtracted(ctx, m, out, keys); err != nil {
+		t.Fatalf("CheckExtracted() error = %v", err)
+	}
+	// Archives from before the manifest named the key are checked against
+	// the database.
+	m.EncryptionKeyID = ""
+	if err := CheckExtracted(ctx, m, out, other); err == nil {
+		t.Error("CheckExtracted(other key, old manifest) error = nil")
+	}
+
+	// The config alone is sealed with a key we don't have.
+	src = newSource(t)
+	src.Config.Encryption.Enabled = true
+	src.Config.CookieString = "c_user=42"
+	src.Config.SetKeyring(other)
+	path, m, err = Create(ctx, src, t.TempDir(), time.Now())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	out = t.TempDir()
+	if _, err := Extract(path, out); err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if err := CheckExtracted(ctx, m, out, keys); err == nil {
+		t.Error("CheckExtracted(sealed config, other key) error = nil")
+	}
+}
+
+func TestVerifyRejectsDamage(t *testing.T) {
+	dir := t.TempDir()
+	path, _, err := Create(context.Background(), newSource(t), dir, time.Now())
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	bad := filepath.Join(t.TempDir(), "bad.tar.gz")
+	for name, edit := range map[string]func(string, []byte) []byte{
+		"changed config": func(name string, data []byte) []byte {
+			if name == ConfigName {
+				return bytes.Replace(data, []byte("42"), []byte("43"), 1)
+			}
+			return data
+		},
+		"no manifest": func(name string, data []byte) []byte {
+			if name == ManifestName {
+				return nil
+			}
+			return data
+		},
+		"dropped spool file": func(name string, data []byte) []byte {
+			if strings.HasPrefix(name, "outbox/") {
+				return nil
+			}
+			return data
+		},
+	} {
+		rewrite(t, path, bad, edit)
+		if _, err := Verify(bad); err == nil {
+			t.Errorf("Verify(%s) error = nil", name)
+		}
+	}
+
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(bad, data[:len(data)/2], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(bad); err == nil {
+		t.Error("Verify(truncated) error = nil")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+	for i := range 5 {
+		name := filePrefix + base.AddDate(0, 0, i).Format(timeLayout) + fileSuffix
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := Rotate(dir, 2)
+	if err != nil || len(removed) != 3 {
+		t.Fatalf("Rotate(2) = %v, %v; want 3 removed", removed, err)
+	}
+	archives, err := List(dir)
+	if err != nil || len(archives) != 2 || !archives[0].CreatedAt.Equal(base.AddDate(0, 0, 4)) {
+		t.Fatalf("List() = %+v, %v; want the 2 newest", archives, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("Rotate() touched other files: %v", err)
+	}
+	if removed, _ := Rotate(dir, -1); len(removed) != 0 {
+		t.Errorf("Rotate(-1) removed %v", removed)
+	}
+}
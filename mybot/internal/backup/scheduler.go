@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// startDelay is the least time the Scheduler waits after starting, so a
+// backup due at startup doesn't compete with connecting.
+const startDelay = time.Minute
+
+// Scheduler takes a backup every interval and rotates the archives in its
+// directory afterwards.
+type Scheduler struct {
+	log      zerolog.Logger
+	src      Source
+	dir      string
+	interval time.Duration
+	keep     int
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewScheduler starts a Scheduler writing archives of src into dir. The
+// first backup is due interval after the newest archive already in dir.
+func NewScheduler(log zerolog.Logger, src Source, dir string, interval time.Duration, keep int) *Scheduler {
+	s := &Scheduler{
+		log:      log.With().Str("component", "backup").Logger(),
+		src:      src,
+		dir:      dir,
+		interval: interval,
+		keep:     keep,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Close stops the Scheduler, cancelling a backup in progress, and waits for
+// it to exit.
+func (s *Scheduler) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	wait := s.interval
+	if archives, err := List(s.dir); err != nil {
+		s.log.Warn().Err(err).Str("dir", s.dir).Msg("Failed to list backups")
+	} else if len(archives) > 0 {
+		wait -= time.Since(archives[0].CreatedAt)
+	} else {
+		wait = 0
+	}
+	wait = max(wait, startDelay)
+	s.log.Info().Str("dir", s.dir).Time("next", time.Now().Add(wait)).Msg("Backup scheduler started")
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-timer.C:
+			s.backup(ctx)
+			timer.Reset(s.interval)
+		}
+	}
+}
+
+func (s *Scheduler) backup(ctx context.Context) {
+	start := time.Now()
+	path, m, err := Create(ctx, s.src, s.dir, start)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.Error().Err(err).Str("dir", s.dir).Msg("Backup failed")
+		}
+		return
+	}
+	ev := s.log.Info().
+		Str("path", path).
+		Int("files", len(m.Files)).
+		Dur("took", time.Since(start))
+	if len(m.Files) > 0 {
+		ev = ev.Int64("db_bytes", m.Files[0].Size)
+	}
+	ev.Msg("Backup written")
+
+	removed, err := Rotate(s.dir, s.keep)
+	if err != nil {
+		s.log.Error().Err(err).Str("dir", s.dir).Msg("Failed to remove old backups")
+	}
+	if len(removed) > 0 {
+		s.log.Info().Strs("removed", removed).Int("keep", s.keep).Msg("Old backups removed")
+	}
+}
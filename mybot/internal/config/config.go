@@ -2,26 +2,63 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"mybot/internal/encryption"
+)
+
+// Storage backends accepted in StorageConfig.Backend.
+const (
+	StorageSQLite = "sqlite"
+	StorageBolt   = "bolt"
+	StorageMemory = "memory"
 )
 
 type StorageConfig struct {
+	// Backend selects the message store: "sqlite" (default), "bolt" or
+	// "memory". The outbox, schedules, reminders, broadcasts, moderation,
+	// bans and search need sqlite; memory keeps nothing across restarts.
+	Backend       string `json:"backend"`
 	MessageDBPath string `json:"message_db_path"`
+	// BoltDBPath is the database file of the bolt backend.
+	BoltDBPath string `json:"bolt_db_path"`
 }
 
 // PerformanceConfig holds tuning knobs for throughput and resource usage.
 type PerformanceConfig struct {
-	// WorkerCount is the number of fixed message-handler goroutines.
-	// Default: 20.
+	// WorkerCount is the number of workers in the interactive lane, which
+	// runs commands and page navigation.  Default: 20.
 	WorkerCount int `json:"worker_count"`
 
-	// JobQueueSize is the buffered-channel capacity for incoming messages.
-	// Default: 500.
+	// JobQueueSize is the interactive lane's queue capacity.  When it is
+	// full, commands get a "busy" reply instead of running.  Default: 500.
 	JobQueueSize int `json:"job_queue_size"`
 
+	// MediaWorkerCount is the number of workers in the media lane, which
+	// runs !media and auto-detected media links.  Default: 4.
+	MediaWorkerCount int `json:"media_worker_count"`
+
+	// MediaQueueSize is the media lane's queue capacity.  Default: 50.
+	MediaQueueSize int `json:"media_queue_size"`
+
+	// BackgroundWorkerCount is the number of workers in the background
+	// lane, which handles plain chat messages and other work nobody is
+	// waiting on.  Default: 2.
+	BackgroundWorkerCount int `json:"background_worker_count"`
+
+	// BackgroundQueueSize is the background lane's queue capacity.
+	// Default: 200.
+	BackgroundQueueSize int `json:"background_queue_size"`
+
 	// DBBatchSize is the max number of write operations grouped in one
 	// SQLite transaction by the write-batcher.  Default: 100.
 	DBBatchSize int `json:"db_batch_size"`
@@ -42,6 +79,30 @@ type PerformanceConfig struct {
 	// Default: 10.
 	SendBurst int `json:"send_burst"`
 
+	// ThreadSendPerMinute limits messages sent to any one thread, so a busy
+	// group can't use up the global budget.  Threads waiting to send are
+	// served round-robin.  Default: 20.
+	ThreadSendPerMinute int `json:"thread_send_per_minute"`
+
+	// ThreadSendBurst is the per-thread burst bucket size.  Default: 6.
+	ThreadSendBurst int `json:"thread_send_burst"`
+
+	// UserSendPerMinute limits messages sent in response to one user's
+	// commands, across all threads.  Default: 12.
+	UserSendPerMinute int `json:"user_send_per_minute"`
+
+	// UserSendBurst is the per-user burst bucket size.  Default: 6.
+	UserSendBurst int `json:"user_send_burst"`
+
+	// BroadcastDelayMs is the pause between threads while a broadcast is
+	// delivered, so an announcement doesn't look like a spam burst.
+	// Default: 2000.
+	BroadcastDelayMs int `json:"broadcast_delay_ms"`
+
+	// SendWaitTopThreads is how many threads each metrics log line lists
+	// with their rate-limit wait, longest first.  Default: 5.
+	SendWaitTopThreads int `json:"send_wait_top_threads"`
+
 	// MessageHandlerTimeoutSeconds is the per-message context deadline.
 	// Default: 30.
 	MessageHandlerTimeoutSeconds int `json:"message_handler_timeout_seconds"`
@@ -60,6 +121,11 @@ type PerformanceConfig struct {
 	// Default: 8.
 	MaxConcurrentDownloads int `json:"max_concurrent_downloads"`
 
+	// MaxMessageLength is the longest text (in UTF-16 code units) sent as a
+	// single message; longer text is split on line/word boundaries into
+	// several messages.  Default: 2000.
+	MaxMessageLength int `json:"max_message_length"`
+
 	// SeenCacheMaxSize is the maximum number of message IDs kept in the
 	// deduplication cache.  When exceeded, the oldest 50% are evicted.
 	// Default: 30000.
@@ -83,20 +149,230 @@ func DefaultPerformanceConfig() PerformanceConfig {
 	return PerformanceConfig{
 		WorkerCount:                  20,
 		JobQueueSize:                 500,
+		MediaWorkerCount:             4,
+		MediaQueueSize:               50,
+		BackgroundWorkerCount:        2,
+		BackgroundQueueSize:          200,
 		DBBatchSize:                  100,
 		DBBatchFlushMs:               50,
 		DBReadPoolSize:               4,
 		SendRatePerSecond:            30,
 		SendBurst:                    10,
+		ThreadSendPerMinute:          20,
+		ThreadSendBurst:              6,
+		UserSendPerMinute:            12,
+		UserSendBurst:                6,
+		BroadcastDelayMs:             2000,
+		SendWaitTopThreads:           5,
 		MessageHandlerTimeoutSeconds: 30,
 		MediaCommandTimeoutSeconds:   180,
 		MaxConcurrentDownloads:       16,
+		MaxMessageLength:             2000,
 		SeenCacheMaxSize:             30000,
 		MemoryLimitMB:                0,
 		GCPercent:                    0,
 	}
 }
 
+// ModerationConfig controls anti-spam in group threads.  Admins and owners
+// are never moderated.  For each count, 0 uses the default and -1 turns the
+// rule off.
+type ModerationConfig struct {
+	// Enabled turns anti-spam on.  Default: false.
+	Enabled bool `json:"enabled"`
+
+	// FloodMessages is how many messages one user may send within
+	// FloodWindowSeconds.  Default: 8.
+	FloodMessages      int `json:"flood_messages"`
+	FloodWindowSeconds int `json:"flood_window_seconds"` // Default: 10.
+
+	// DuplicateMessages is how many times one user may send the same text
+	// within DuplicateWindowSeconds.  Default: 3.
+	DuplicateMessages      int `json:"duplicate_messages"`
+	DuplicateWindowSeconds int `json:"duplicate_window_seconds"` // Default: 60.
+
+	// LinkCount is how many links one user may post within
+	// LinkWindowSeconds.  Default: 5.
+	LinkCount         int `json:"link_count"`
+	LinkWindowSeconds int `json:"link_window_seconds"` // Default: 60.
+
+	// MaxMentions is how many people one message may @mention.  Default: 5.
+	MaxMentions int `json:"max_mentions"`
+
+	// Actions is the escalation ladder: the first violation within
+	// StrikeWindowMinutes gets the first action, the second the next one,
+	// and the last repeats.  Actions are "warn", "mute" (the bot ignores the
+	// user for MuteMinutes) and "remove" (kick from the group, only when the
+	// bot is an admin there; otherwise mute).
+	// Default: ["warn", "mute", "remove"].
+	Actions []string `json:"actions"`
+
+	// StrikeWindowMinutes is how long a violation counts towards the next
+	// action.  Default: 60.
+	StrikeWindowMinutes int `json:"strike_window_minutes"`
+
+	// MuteMinutes is how long a muted user is ignored.  Default: 10.
+	MuteMinutes int `json:"mute_minutes"`
+}
+
+// DefaultModerationConfig returns a ModerationConfig with the default rules,
+// turned off.
+func DefaultModerationConfig() ModerationConfig {
+	return ModerationConfig{
+		FloodMessages:          8,
+		FloodWindowSeconds:     10,
+		DuplicateMessages:      3,
+		DuplicateWindowSeconds: 60,
+		LinkCount:              5,
+		LinkWindowSeconds:      60,
+		MaxMentions:            5,
+		Actions:                []string{"warn", "mute", "remove"},
+		StrikeWindowMinutes:    60,
+		MuteMinutes:            10,
+	}
+}
+
+// RetentionConfig controls how long the sqlite message store keeps
+// messages.  For each limit, 0 uses the default and -1 turns it off.
+type RetentionConfig struct {
+	// Enabled turns pruning on.  Default: false.
+	Enabled bool `json:"enabled"`
+
+	// MaxAgeDays is how long messages are kept.  Default: 365.
+	MaxAgeDays int `json:"max_age_days"`
+
+	// BotMaxAgeDays is how long the bot's own messages are kept; they back
+	// edits, recalls and page navigation.  Default: 730.
+	BotMaxAgeDays int `json:"bot_max_age_days"`
+
+	// MaxMessagesPerThread is how many messages of each thread are kept,
+	// newest first.  The bot's messages and pinned ones are not counted.
+	// Default: 100000.
+	MaxMessagesPerThread int `json:"max_messages_per_thread"`
+
+	// PrunePinned lets messages pinned in Messenger be pruned too.
+	// Default: false, pinned messages are kept whatever their age.
+	PrunePinned bool `json:"prune_pinned"`
+
+	// SlimAfterDays empties the attachment list and sender name snapshot of
+	// older messages; the text stays and names come from the users table.
+	// Default: 30.
+	SlimAfterDays int `json:"slim_after_days"`
+
+	// IntervalMinutes is how often the pruner runs.  Default: 60.
+	IntervalMinutes int `json:"interval_minutes"`
+
+	// BatchSize is how many rows one pruning transaction touches, and
+	// BatchPauseMs the pause between two, so message writes are not held
+	// up.  Defaults: 500 rows, 100 ms.
+	BatchSize    int `json:"batch_size"`
+	BatchPauseMs int `json:"batch_pause_ms"`
+
+	// VacuumIntervalHours is how often the database file is rebuilt with
+	// VACUUM to give freed pages back to the disk.  Writes wait while it
+	// runs.  Default: 168 (weekly).
+	VacuumIntervalHours int `json:"vacuum_interval_hours"`
+}
+
+// DefaultRetentionConfig returns a RetentionConfig with the default limits,
+// turned off.
+func DefaultRetentionConfig() RetentionConfig {
+	return RetentionConfig{
+		MaxAgeDays:           365,
+		BotMaxAgeDays:        730,
+		MaxMessagesPerThread: 100000,
+		SlimAfterDays:        30,
+		IntervalMinutes:      60,
+		BatchSize:            500,
+		BatchPauseMs:         100,
+		VacuumIntervalHours:  168,
+	}
+}
+
+// BackupConfig controls the scheduled backups of the message database and
+// this config file.
+type BackupConfig struct {
+	// Enabled turns scheduled backups on.  Default: false.
+	Enabled bool `json:"enabled"`
+
+	// Dir is where backup archives are written, relative to the config
+	// file.  Default: "data/backups".
+	Dir string `json:"dir"`
+
+	// IntervalHours is how often a backup is taken.  Default: 24.
+	IntervalHours int `json:"interval_hours"`
+
+	// Keep is how many of the newest archives in Dir are kept; older ones
+	// are deleted after each scheduled backup.  -1 keeps all.  Default: 7.
+	Keep int `json:"keep"`
+}
+
+// DefaultBackupConfig returns a BackupConfig with the default schedule,
+// turned off.
+func DefaultBackupConfig() BackupConfig {
+	return BackupConfig{
+		Dir:           "data/backups",
+		IntervalHours: 24,
+		Keep:          7,
+	}
+}
+
+// AttachmentArchiveConfig controls the local copies of incoming
+// attachments, kept before Facebook's URLs expire.  For each limit, 0 uses
+// the default and -1 turns it off.
+type AttachmentArchiveConfig struct {
+	// Enabled turns the archive on (sqlite only).  Default: false.
+	Enabled bool `json:"enabled"`
+
+	// Dir is where files are stored, relative to the config file.
+	// Default: "data/attachments".
+	Dir string `json:"dir"`
+
+	// MaxFileMB is the largest file kept.  Default: 25.
+	MaxFileMB int `json:"max_file_mb"`
+
+	// ThreadQuotaMB is how much each thread may keep; a file sent several
+	// times counts once.  Default: 1024.
+	ThreadQuotaMB int `json:"thread_quota_mb"`
+
+	// IncludeBot keeps the attachments the bot sent too.  Default: false.
+	IncludeBot bool `json:"include_bot"`
+}
+
+// DefaultAttachmentArchiveConfig returns an AttachmentArchiveConfig with the
+// default limits, turned off.
+func DefaultAttachmentArchiveConfig() AttachmentArchiveConfig {
+	return AttachmentArchiveConfig{
+		Dir:           "data/attachments",
+		MaxFileMB:     25,
+		ThreadQuotaMB: 1024,
+	}
+}
+
+// EncryptionConfig controls encryption at rest of the message text and
+// attachments in the sqlite store and of the secrets in this file (cookies,
+// tokens, auto-login password and 2FA secret).  The key is read from
+// BOT_ENCRYPTION_KEY, else from KeyFile.
+type EncryptionConfig struct {
+	// Enabled turns encryption on (sqlite only).  Default: false.
+	Enabled bool `json:"enabled"`
+
+	// KeyFile holds the keys, base64, newest first, relative to the config
+	// file.  It is created with a new key when missing.
+	// Default: "data/encryption.key".
+	KeyFile string `json:"key_file"`
+
+	// KeepSearchIndex keeps the !search index, which stores message text
+	// in plaintext.  Without it, search is turned off.  Default: false.
+	KeepSearchIndex bool `json:"keep_search_index"`
+}
+
+// DefaultEncryptionConfig returns an EncryptionConfig with the default key
+// file, turned off.
+func DefaultEncryptionConfig() EncryptionConfig {
+	return EncryptionConfig{KeyFile: "data/encryption.key"}
+}
+
 // AutoLoginConfig holds credentials for automatic Facebook login
 // when cookies are expired or missing.
 type AutoLoginConfig struct {
@@ -128,11 +404,38 @@ type Config struct {
 	// Modules feature toggles
 	Modules map[string]bool `json:"modules"`
 
+	// OwnerIDs are the user IDs allowed to run owner-only commands such as
+	// !broadcast.
+	OwnerIDs []int64 `json:"owner_ids"`
+
 	Storage StorageConfig `json:"storage"`
 
 	// Performance tuning knobs.
 	Performance PerformanceConfig `json:"performance"`
 
+	// Moderation is the anti-spam policy for group threads.
+	Moderation ModerationConfig `json:"moderation"`
+
+	// Retention prunes old messages from the sqlite store.
+	Retention RetentionConfig `json:"retention"`
+
+	// Backup takes scheduled archives of the message database and config.
+	Backup BackupConfig `json:"backup"`
+
+	// AttachmentArchive keeps local copies of incoming attachments.
+	AttachmentArchive AttachmentArchiveConfig `json:"attachment_archive"`
+
+	// Encryption encrypts stored messages and the secrets of this file.
+	Encryption EncryptionConfig `json:"encryption"`
+
+	// Timezone is the IANA time zone commands read and show times in
+	// (e.g. "!schedule 21:00").  Default: "Asia/Ho_Chi_Minh".
+	Timezone string `json:"timezone"`
+
+	// ThreadTimezones overrides Timezone for individual threads
+	// (thread ID → IANA time zone).
+	ThreadTimezones map[string]string `json:"thread_timezones,omitempty"`
+
 	// ForceRefreshIntervalSeconds is the interval in seconds between periodic
 	// full reconnects (base value; actual delay is randomised between 1x–2x).
 	// Set to -1 to disable. 0 uses the default (10800 = 3 hours).
@@ -149,10 +452,17 @@ type Config struct {
 	// Tokens stores login tokens obtained from auto-login.
 	Tokens TokensConfig `json:"tokens"`
 
+	// keys seal the secrets on Save when Encryption is enabled; see
+	// LoadKeyring.
+	keys *encryption.Keyring
+
+	// zones caches the time zones of Timezone and ThreadTimezones by name.
+	zones map[string]*time.Location
 }
 
 const DefaultForceRefreshInterval = 10800 // 3 hours
 const DefaultTokenRefreshInterval = 3600  // 1 hour
+const DefaultTimezone = "Asia/Ho_Chi_Minh"
 
 func New() *Config {
 	return &Config{
@@ -161,10 +471,18 @@ func New() *Config {
 		Modules:                     make(map[string]bool),
 		ForceRefreshIntervalSeconds: DefaultForceRefreshInterval,
 		TokenRefreshIntervalSeconds: DefaultTokenRefreshInterval,
+		Timezone:                    DefaultTimezone,
 		Storage: StorageConfig{
+			Backend:       StorageSQLite,
 			MessageDBPath: "data/messages.sqlite",
+			BoltDBPath:    "data/messages.bolt",
 		},
-		Performance:   DefaultPerformanceConfig(),
+		Performance:       DefaultPerformanceConfig(),
+		Moderation:        DefaultModerationConfig(),
+		Retention:         DefaultRetentionConfig(),
+		Backup:            DefaultBackupConfig(),
+		AttachmentArchive: DefaultAttachmentArchiveConfig(),
+		Encryption:        DefaultEncryptionConfig(),
 	}
 }
 
@@ -227,9 +545,21 @@ func Load(path string) (*Config, error) {
 	if cfg.CommandPrefix == "" {
 		cfg.CommandPrefix = "!"
 	}
+	if cfg.Storage.Backend == "" {
+		cfg.Storage.Backend = StorageSQLite
+	}
 	if cfg.Storage.MessageDBPath == "" {
 		cfg.Storage.MessageDBPath = "data/messages.sqlite"
 	}
+	if cfg.Storage.BoltDBPath == "" {
+		cfg.Storage.BoltDBPath = "data/messages.bolt"
+	}
+	if cfg.Timezone == "" {
+		cfg.Timezone = DefaultTimezone
+	}
+	if err := cfg.loadTimezones(); err != nil {
+		return nil, err
+	}
 
 	// Apply defaults for zero-valued interval fields.
 	if cfg.ForceRefreshIntervalSeconds == 0 {
@@ -241,6 +571,16 @@ func Load(path string) (*Config, error) {
 
 	// Apply defaults for zero-valued performance fields.
 	cfg.applyPerformanceDefaults()
+	cfg.applyModerationDefaults()
+	cfg.applyRetentionDefaults()
+	cfg.applyBackupDefaults()
+	cfg.applyAttachmentArchiveDefaults()
+	cfg.applyEncryptionDefaults()
+
+	// Secrets are decrypted before the cookie string is parsed.
+	if err := cfg.openSecrets(path); err != nil {
+		return nil, err
+	}
 
 	// If cookie_string is provided, parse it and merge into cookies
 	cfg.mergeCookieString()
@@ -254,6 +594,71 @@ func Load(path string) (*Config, error) {
 	return &cfg, nil
 }
 
+// ThreadLocation returns the time zone for threadID: its ThreadTimezones
+// entry, else Timezone, else the local zone if neither can be loaded.
+func (c *Config) ThreadLocation(threadID int64) *time.Location {
+	c.mu.RLock()
+	name := c.ThreadTimezones[strconv.FormatInt(threadID, 10)]
+	if name == "" {
+		name = c.Timezone
+	}
+	if name == "" {
+		name = DefaultTimezone
+	}
+	loc := c.zones[name]
+	c.mu.RUnlock()
+	if loc != nil {
+		return loc
+	}
+
+	// Only zones set after Load get here.
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc = time.Local
+	}
+	c.mu.Lock()
+	if c.zones == nil {
+		c.zones = make(map[string]*time.Location)
+	}
+	c.zones[name] = loc
+	c.mu.Unlock()
+	return loc
+}
+
+// loadTimezones loads Timezone and every ThreadTimezones entry into the
+// cache ThreadLocation reads, failing on a name that isn't a time zone.
+func (c *Config) loadTimezones() error {
+	zones := make(map[string]*time.Location)
+	load := func(field, name string) error {
+		if name == "" || zones[name] != nil {
+			return nil
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		zones[name] = loc
+		return nil
+	}
+	if err := load("timezone", c.Timezone); err != nil {
+		return err
+	}
+	for thread, name := range c.ThreadTimezones {
+		if err := load("thread_timezones."+thread, name); err != nil {
+			return err
+		}
+	}
+	c.zones = zones
+	return nil
+}
+
+// IsOwner reports whether userID is listed in OwnerIDs.
+func (c *Config) IsOwner(userID int64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return userID != 0 && slices.Contains(c.OwnerIDs, userID)
+}
+
 // mergeCookieString parses CookieString and merges results into Cookies map.
 func (c *Config) mergeCookieString() {
 	if c.CookieString == "" {
@@ -267,10 +672,27 @@ func (c *Config) mergeCookieString() {
 	}
 }
 
+// Save writes the config to path. When Encryption is enabled and a keyring
+// is loaded, the secrets are written sealed.
 func (c *Config) Save(path string) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	var out any = c
+	if c.Encryption.Enabled && c.keys != nil {
+		// Seal a copy: c keeps the plaintext the bot logs in with.
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		sealed := &Config{}
+		if err := json.Unmarshal(data, sealed); err != nil {
+			return err
+		}
+		_ = sealed.mapSecrets(func(v string) (string, error) { return c.keys.Seal(v), nil })
+		out = sealed
+	}
+
 	f, err := os.Create(path)
 	if err != nil {
 		return err
@@ -279,7 +701,102 @@ func (c *Config) Save(path string) error {
 
 	enc := json.NewEncoder(f)
 	enc.SetIndent("", "  ")
-	return enc.Encode(c)
+	return enc.Encode(out)
+}
+
+// Keyring returns the keys the secrets are sealed with, or nil when none
+// were loaded.
+func (c *Config) Keyring() *encryption.Keyring {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.keys
+}
+
+// SetKeyring replaces the keys Save seals the secrets with, for rotating
+// the key.
+func (c *Config) SetKeyring(keys *encryption.Keyring) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = keys
+}
+
+// LoadKeyring reads the encryption keys from BOT_ENCRYPTION_KEY or
+// Encryption.KeyFile and keeps them for Save. When Encryption is enabled
+// and the key file doesn't exist, it is created with a new key.
+func (c *Config) LoadKeyring(configPath string) (*encryption.Keyring, encryption.Source, error) {
+	return c.loadKeyring(configPath, c.Encryption.Enabled)
+}
+
+func (c *Config) loadKeyring(configPath string, create bool) (*encryption.Keyring, encryption.Source, error) {
+	path, err := ResolveKeyFile(configPath, c)
+	if err != nil {
+		return nil, encryption.SourceFile, err
+	}
+	keys, source, err := encryption.Load(path)
+	if errors.Is(err, fs.ErrNotExist) && create {
+		if keys, err = encryption.NewKeyring(encryption.GenerateKey()); err == nil {
+			err = encryption.WriteKeyFile(path, keys)
+		}
+	}
+	if err != nil {
+		return nil, source, fmt.Errorf("encryption key: %w", err)
+	}
+	c.SetKeyring(keys)
+	return keys, source, nil
+}
+
+// openSecrets decrypts the secrets sealed by Save. The keyring is loaded
+// when Encryption is enabled or a secret is sealed; a new key is only made
+// while none is.
+func (c *Config) openSecrets(configPath string) error {
+	sealed := false
+	_ = c.mapSecrets(func(v string) (string, error) {
+		sealed = sealed || encryption.IsSealed(v)
+		return v, nil
+	})
+	if !sealed && !c.Encryption.Enabled {
+		return nil
+	}
+	keys, _, err := c.loadKeyring(configPath, !sealed)
+	if err != nil {
+		return err
+	}
+	return c.OpenSecrets(keys)
+}
+
+// OpenSecrets decrypts the secrets sealed by Save with keys. A sealed
+// secret fails with encryption.ErrNoKey when keys is nil.
+func (c *Config) OpenSecrets(keys *encryption.Keyring) error {
+	if err := c.mapSecrets(keys.Open); err != nil {
+		return fmt.Errorf("config secrets: %w", err)
+	}
+	return nil
+}
+
+// mapSecrets replaces each secret with fn of it: the cookies, the cookie
+// string, the login tokens and the auto-login password and 2FA secret.
+func (c *Config) mapSecrets(fn func(string) (string, error)) error {
+	for _, p := range []*string{
+		&c.CookieString,
+		&c.AutoLogin.Password,
+		&c.AutoLogin.TwoFASecret,
+		&c.Tokens.LoginToken,
+		&c.Tokens.AccessToken,
+	} {
+		v, err := fn(*p)
+		if err != nil {
+			return err
+		}
+		*p = v
+	}
+	for name, value := range c.Cookies {
+		v, err := fn(value)
+		if err != nil {
+			return fmt.Errorf("cookie %s: %w", name, err)
+		}
+		c.Cookies[name] = v
+	}
+	return nil
 }
 
 func (c *Config) Update(newCfg *Config) {
@@ -289,9 +806,13 @@ func (c *Config) Update(newCfg *Config) {
 	c.CookieString = newCfg.CookieString
 	c.Cookies = newCfg.Cookies
 	c.Modules = newCfg.Modules
+	c.OwnerIDs = newCfg.OwnerIDs
 	c.Storage = newCfg.Storage
 	c.Performance = newCfg.Performance
 	c.AutoLogin = newCfg.AutoLogin
+	c.Timezone = newCfg.Timezone
+	c.ThreadTimezones = newCfg.ThreadTimezones
+	c.zones = newCfg.zones
 	c.applyPerformanceDefaults()
 	c.mergeCookieString()
 }
@@ -322,6 +843,18 @@ func (c *Config) applyPerformanceDefaults() {
 	if p.JobQueueSize <= 0 {
 		p.JobQueueSize = def.JobQueueSize
 	}
+	if p.MediaWorkerCount <= 0 {
+		p.MediaWorkerCount = def.MediaWorkerCount
+	}
+	if p.MediaQueueSize <= 0 {
+		p.MediaQueueSize = def.MediaQueueSize
+	}
+	if p.BackgroundWorkerCount <= 0 {
+		p.BackgroundWorkerCount = def.BackgroundWorkerCount
+	}
+	if p.BackgroundQueueSize <= 0 {
+		p.BackgroundQueueSize = def.BackgroundQueueSize
+	}
 	if p.DBBatchSize <= 0 {
 		p.DBBatchSize = def.DBBatchSize
 	}
@@ -337,6 +870,24 @@ func (c *Config) applyPerformanceDefaults() {
 	if p.SendBurst <= 0 {
 		p.SendBurst = def.SendBurst
 	}
+	if p.ThreadSendPerMinute <= 0 {
+		p.ThreadSendPerMinute = def.ThreadSendPerMinute
+	}
+	if p.ThreadSendBurst <= 0 {
+		p.ThreadSendBurst = def.ThreadSendBurst
+	}
+	if p.UserSendPerMinute <= 0 {
+		p.UserSendPerMinute = def.UserSendPerMinute
+	}
+	if p.UserSendBurst <= 0 {
+		p.UserSendBurst = def.UserSendBurst
+	}
+	if p.BroadcastDelayMs <= 0 {
+		p.BroadcastDelayMs = def.BroadcastDelayMs
+	}
+	if p.SendWaitTopThreads <= 0 {
+		p.SendWaitTopThreads = def.SendWaitTopThreads
+	}
 	if p.MessageHandlerTimeoutSeconds <= 0 {
 		p.MessageHandlerTimeoutSeconds = def.MessageHandlerTimeoutSeconds
 	}
@@ -346,6 +897,9 @@ func (c *Config) applyPerformanceDefaults() {
 	if p.MaxConcurrentDownloads <= 0 {
 		p.MaxConcurrentDownloads = def.MaxConcurrentDownloads
 	}
+	if p.MaxMessageLength <= 0 {
+		p.MaxMessageLength = def.MaxMessageLength
+	}
 
 	// Clamp upper bounds to prevent unreasonable resource usage.
 	clamp := func(val *int, max int) {
@@ -355,9 +909,16 @@ func (c *Config) applyPerformanceDefaults() {
 	}
 	clamp(&p.WorkerCount, 100)
 	clamp(&p.JobQueueSize, 10000)
+	clamp(&p.MediaWorkerCount, 64)
+	clamp(&p.MediaQueueSize, 10000)
+	clamp(&p.BackgroundWorkerCount, 32)
+	clamp(&p.BackgroundQueueSize, 10000)
 	clamp(&p.DBBatchSize, 1000)
 	clamp(&p.DBReadPoolSize, 32)
 	clamp(&p.MaxConcurrentDownloads, 64)
+	clamp(&p.MaxMessageLength, 20000)
+	clamp(&p.BroadcastDelayMs, 60000)
+	clamp(&p.SendWaitTopThreads, 50)
 
 	// Ensure DBBatchSize does not exceed JobQueueSize.
 	if p.DBBatchSize > p.JobQueueSize {
@@ -365,6 +926,121 @@ func (c *Config) applyPerformanceDefaults() {
 	}
 }
 
+// applyRetentionDefaults fills zero-valued retention fields with defaults.
+// The pruning schedule and batches can't be turned off.
+func (c *Config) applyRetentionDefaults() {
+	def := DefaultRetentionConfig()
+	r := &c.Retention
+	for _, f := range []struct {
+		v   *int
+		def int
+	}{
+		{&r.MaxAgeDays, def.MaxAgeDays},
+		{&r.BotMaxAgeDays, def.BotMaxAgeDays},
+		{&r.MaxMessagesPerThread, def.MaxMessagesPerThread},
+		{&r.SlimAfterDays, def.SlimAfterDays},
+		{&r.VacuumIntervalHours, def.VacuumIntervalHours},
+	} {
+		if *f.v == 0 {
+			*f.v = f.def
+		}
+	}
+	if r.IntervalMinutes <= 0 {
+		r.IntervalMinutes = def.IntervalMinutes
+	}
+	if r.BatchSize <= 0 {
+		r.BatchSize = def.BatchSize
+	}
+	if r.BatchPauseMs <= 0 {
+		r.BatchPauseMs = def.BatchPauseMs
+	}
+}
+
+// applyBackupDefaults fills zero-valued backup fields with defaults.
+func (c *Config) applyBackupDefaults() {
+	def := DefaultBackupConfig()
+	b := &c.Backup
+	if b.Dir == "" {
+		b.Dir = def.Dir
+	}
+	if b.IntervalHours <= 0 {
+		b.IntervalHours = def.IntervalHours
+	}
+	if b.Keep == 0 {
+		b.Keep = def.Keep
+	}
+}
+
+// applyAttachmentArchiveDefaults fills zero-valued attachment archive
+// fields with defaults.
+func (c *Config) applyAttachmentArchiveDefaults() {
+	def := DefaultAttachmentArchiveConfig()
+	a := &c.AttachmentArchive
+	if a.Dir == "" {
+		a.Dir = def.Dir
+	}
+	if a.MaxFileMB == 0 {
+		a.MaxFileMB = def.MaxFileMB
+	}
+	if a.ThreadQuotaMB == 0 {
+		a.ThreadQuotaMB = def.ThreadQuotaMB
+	}
+}
+
+// applyEncryptionDefaults fills zero-valued encryption fields with
+// defaults.
+func (c *Config) applyEncryptionDefaults() {
+	if c.Encryption.KeyFile == "" {
+		c.Encryption.KeyFile = DefaultEncryptionConfig().KeyFile
+	}
+}
+
+// applyModerationDefaults fills zero-valued moderation fields with defaults
+// and drops unknown actions.  Windows and durations can't be turned off.
+func (c *Config) applyModerationDefaults() {
+	def := DefaultModerationConfig()
+	m := &c.Moderation
+	if m.FloodMessages == 0 {
+		m.FloodMessages = def.FloodMessages
+	}
+	if m.DuplicateMessages == 0 {
+		m.DuplicateMessages = def.DuplicateMessages
+	}
+	if m.LinkCount == 0 {
+		m.LinkCount = def.LinkCount
+	}
+	if m.MaxMentions == 0 {
+		m.MaxMentions = def.MaxMentions
+	}
+	if m.FloodWindowSeconds <= 0 {
+		m.FloodWindowSeconds = def.FloodWindowSeconds
+	}
+	if m.DuplicateWindowSeconds <= 0 {
+		m.DuplicateWindowSeconds = def.DuplicateWindowSeconds
+	}
+	if m.LinkWindowSeconds <= 0 {
+		m.LinkWindowSeconds = def.LinkWindowSeconds
+	}
+	if m.StrikeWindowMinutes <= 0 {
+		m.StrikeWindowMinutes = def.StrikeWindowMinutes
+	}
+	if m.MuteMinutes <= 0 {
+		m.MuteMinutes = def.MuteMinutes
+	}
+
+	var actions []string
+	for _, a := range m.Actions {
+		switch a = strings.ToLower(strings.TrimSpace(a)); a {
+		case "warn", "mute", "remove":
+			actions = append(actions, a)
+		}
+	}
+	if len(actions) == 0 {
+		actions = def.Actions
+	}
+	m.Actions = actions
+}
+
 // UpdateModules updates only the Modules map.
 func (c *Config) UpdateModules(modules map[string]bool) {
 	c.mu.Lock()
@@ -381,6 +1057,65 @@ func ResolveMessageDBPath(configPath string, cfg *Config) (string, error) {
 	if dbPath == "" {
 		dbPath = "data/messages.sqlite"
 	}
+	return resolveDataPath(configPath, dbPath)
+}
+
+// ResolveBoltDBPath resolves Storage.BoltDBPath like ResolveMessageDBPath.
+func ResolveBoltDBPath(configPath string, cfg *Config) (string, error) {
+	if cfg == nil {
+		cfg = New()
+	}
+
+	dbPath := cfg.Storage.BoltDBPath
+	if dbPath == "" {
+		dbPath = "data/messages.bolt"
+	}
+	return resolveDataPath(configPath, dbPath)
+}
+
+// ResolveBackupDir resolves Backup.Dir like ResolveMessageDBPath.
+func ResolveBackupDir(configPath string, cfg *Config) (string, error) {
+	if cfg == nil {
+		cfg = New()
+	}
+
+	dir := cfg.Backup.Dir
+	if dir == "" {
+		dir = DefaultBackupConfig().Dir
+	}
+	return resolveDataPath(configPath, dir)
+}
+
+// ResolveAttachmentDir resolves AttachmentArchive.Dir like
+// ResolveMessageDBPath.
+func ResolveAttachmentDir(configPath string, cfg *Config) (string, error) {
+	if cfg == nil {
+		cfg = New()
+	}
+
+	dir := cfg.AttachmentArchive.Dir
+	if dir == "" {
+		dir = DefaultAttachmentArchiveConfig().Dir
+	}
+	return resolveDataPath(configPath, dir)
+}
+
+// ResolveKeyFile resolves Encryption.KeyFile like ResolveMessageDBPath.
+func ResolveKeyFile(configPath string, cfg *Config) (string, error) {
+	if cfg == nil {
+		cfg = New()
+	}
+
+	path := cfg.Encryption.KeyFile
+	if path == "" {
+		path = DefaultEncryptionConfig().KeyFile
+	}
+	return resolveDataPath(configPath, path)
+}
+
+// resolveDataPath resolves a relative dbPath against the directory of the
+// config file, or of the executable when there is no config file.
+func resolveDataPath(configPath, dbPath string) (string, error) {
 	if filepath.IsAbs(dbPath) {
 		return filepath.Clean(dbPath), nil
 	}
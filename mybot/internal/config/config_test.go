@@ -1,7 +1,15 @@
 package config
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"mybot/internal/encryption"
 )
 
 func TestParseCookieString(t *testing.T) {
@@ -71,3 +79,179 @@ func TestParseCookieString(t *testing.T) {
 		})
 	}
 }
+
+func TestThreadLocation(t *testing.T) {
+	cfg := New()
+	cfg.ThreadTimezones = map[string]string{"42": "Europe/Berlin", "43": "Not/AZone"}
+
+	if got := cfg.ThreadLocation(1).String(); got != DefaultTimezone {
+		t.Errorf("ThreadLocation(1) = %s, want %s", got, DefaultTimezone)
+	}
+	if got := cfg.ThreadLocation(42).String(); got != "Europe/Berlin" {
+		t.Errorf("ThreadLocation(42) = %s, want Europe/Berlin", got)
+	}
+	if got := cfg.ThreadLocation(43); got != time.Local {
+		t.Errorf("ThreadLocation(43) = %s, want local fallback", got)
+	}
+}
+
+func TestLoadResolvesTimezones(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(zones string) {
+		t.Helper()
+		data := `{"timezone": "Asia/Tokyo", "thread_timezones": ` + zones + `}`
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"42": "Europe/Berlin"}`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.ThreadLocation(1).String(); got != "Asia/Tokyo" {
+		t.Errorf("ThreadLocation(1) = %s, want Asia/Tokyo", got)
+	}
+	if a, b := cfg.ThreadLocation(42), cfg.ThreadLocation(42); a != b || a.String() != "Europe/Berlin" {
+		t.Errorf("ThreadLocation(42) = %s, %s; want the same cached Europe/Berlin", a, b)
+	}
+
+	write(`{"42": "Not/AZone"}`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "thread_timezones.42") {
+		t.Errorf("Load() with an unknown time zone error = %v", err)
+	}
+}
+
+func TestIsOwner(t *testing.T) {
+	cfg := New()
+	cfg.OwnerIDs = []int64{100, 200}
+	if !cfg.IsOwner(200) {
+		t.Error("IsOwner(200) = false, want true")
+	}
+	if cfg.IsOwner(300) || cfg.IsOwner(0) {
+		t.Error("IsOwner() = true for a user not in owner_ids")
+	}
+}
+
+func TestApplyModerationDefaults(t *testing.T) {
+	cfg := &Config{Moderation: ModerationConfig{
+		FloodMessages:     -1,
+		DuplicateMessages: 2,
+		MuteMinutes:       -5,
+		Actions:           []string{" Mute ", "ban", "remove"},
+	}}
+	cfg.applyModerationDefaults()
+	m := cfg.Moderation
+	def := DefaultModerationConfig()
+	if m.FloodMessages != -1 {
+		t.Errorf("FloodMessages = %d, want -1 (off)", m.FloodMessages)
+	}
+	if m.DuplicateMessages != 2 || m.LinkCount != def.LinkCount || m.MuteMinutes != def.MuteMinutes {
+		t.Errorf("Moderation = %+v, want defaults filled in", m)
+	}
+	if !slices.Equal(m.Actions, []string{"mute", "remove"}) {
+		t.Errorf("Actions = %v, want [mute remove]", m.Actions)
+	}
+}
+
+func TestApplyRetentionDefaults(t *testing.T) {
+	cfg := &Config{Retention: RetentionConfig{
+		MaxAgeDays:    -1,
+		BotMaxAgeDays: 90,
+		BatchSize:     -3,
+	}}
+	cfg.applyRetentionDefaults()
+	r := cfg.Retention
+	def := DefaultRetentionConfig()
+	if r.MaxAgeDays != -1 {
+		t.Errorf("MaxAgeDays = %d, want -1 (off)", r.MaxAgeDays)
+	}
+	if r.BotMaxAgeDays != 90 || r.MaxMessagesPerThread != def.MaxMessagesPerThread || r.SlimAfterDays != def.SlimAfterDays {
+		t.Errorf("Retention = %+v, want defaults filled in", r)
+	}
+	if r.BatchSize != def.BatchSize || r.IntervalMinutes != def.IntervalMinutes {
+		t.Errorf("BatchSize = %d, IntervalMinutes = %d, want defaults", r.BatchSize, r.IntervalMinutes)
+	}
+}
+
+func TestApplyBackupDefaults(t *testing.T) {
+	cfg := &Config{Backup: BackupConfig{Keep: -1, IntervalHours: -5}}
+	cfg.applyBackupDefaults()
+	b := cfg.Backup
+	def := DefaultBackupConfig()
+	if b.Keep != -1 {
+		t.Errorf("Keep = %d, want -1 (keep all)", b.Keep)
+	}
+	if b.Dir != def.Dir || b.IntervalHours != def.IntervalHours {
+		t.Errorf("Backup = %+v, want defaults filled in", b)
+	}
+}
+
+func TestApplyAttachmentArchiveDefaults(t *testing.T) {
+	cfg := &Config{AttachmentArchive: AttachmentArchiveConfig{ThreadQuotaMB: -1, MaxFileMB: 8}}
+	cfg.applyAttachmentArchiveDefaults()
+	a := cfg.AttachmentArchive
+	if a.ThreadQuotaMB != -1 || a.MaxFileMB != 8 {
+		t.Errorf("AttachmentArchive = %+v, want the set limits kept", a)
+	}
+	if a.Dir != DefaultAttachmentArchiveConfig().Dir {
+		t.Errorf("Dir = %q, want the default", a.Dir)
+	}
+}
+
+func TestApplyEncryptionDefaults(t *testing.T) {
+	cfg := &Config{}
+	cfg.applyEncryptionDefaults()
+	if cfg.Encryption.KeyFile != DefaultEncryptionConfig().KeyFile || cfg.Encryption.Enabled {
+		t.Errorf("Encryption = %+v, want the default key file, off", cfg.Encryption)
+	}
+}
+
+func TestSecretsEncryptedAtRest(t *testing.T) {
+	t.Setenv(encryption.EnvKey, "")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	cfg := New()
+	cfg.Encryption.Enabled = true
+	cfg.Cookies["xs"] = "16:secret-xs"
+	cfg.AutoLogin.Password = "hunter2"
+	cfg.AutoLogin.TwoFASecret = "JBSWY3DPEHPK3PXP"
+	if err := cfg.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load creates the missing key file and writes the secrets back sealed.
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded.Cookies["xs"] != "16:secret-xs" || loaded.AutoLogin.Password != "hunter2" || loaded.Keyring() == nil {
+		t.Fatalf("Load() cookies = %v, password = %q", loaded.Cookies, loaded.AutoLogin.Password)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data", "encryption.key")); err != nil {
+		t.Errorf("key file not created: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-xs", "hunter2", "JBSWY3DPEHPK3PXP"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("config file holds %q in plaintext", secret)
+		}
+	}
+
+	again, err := Load(path)
+	if err != nil || again.AutoLogin.TwoFASecret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Load() again = %q, %v", again.AutoLogin.TwoFASecret, err)
+	}
+
+	// With the key file lost, no new key is made for the sealed secrets.
+	if err := os.Remove(filepath.Join(dir, "data", "encryption.key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); !errors.Is(err, encryption.ErrNoKey) {
+		t.Errorf("Load() of sealed secrets without their key error = %v, want ErrNoKey", err)
+	}
+}
@@ -45,3 +45,21 @@ func TestResolveMessageDBPathFallsBackToExecutableDir(t *testing.T) {
 		t.Fatalf("ResolveMessageDBPath() = %q, want %q", got, want)
 	}
 }
+
+func TestResolveBoltDBPathUsesConfigDir(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{}`), 0o600); err != nil {
+		t.Fatalf("failed to create config file: %v", err)
+	}
+
+	got, err := ResolveBoltDBPath(configPath, New())
+	if err != nil {
+		t.Fatalf("ResolveBoltDBPath() error = %v", err)
+	}
+
+	want := filepath.Join(tempDir, "data", "messages.bolt")
+	if got != want {
+		t.Fatalf("ResolveBoltDBPath() = %q, want %q", got, want)
+	}
+}
@@ -3,10 +3,13 @@ package core
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
+	"unicode"
 )
 
 // MessageSender abstracts the underlying transport (e.g., Facebook/Messagix).
@@ -75,20 +78,114 @@ func (m *MediaAttachment) Cleanup() {
 	}
 }
 
+// Paginator sends responses split into pages that users flip through by
+// replying "next"/"prev" to the page message or reacting ▶️/◀️.
+type Paginator interface {
+	SendPages(ctx context.Context, threadID int64, replyToMessageID string, pages []string) (*MessageRecord, error)
+	SendPagedText(ctx context.Context, threadID int64, replyToMessageID, text string) (*MessageRecord, error)
+}
+
+// Role is what the sender of a command is allowed to do. A higher role
+// includes everything a lower one may do.
+type Role int
+
+const (
+	RoleMember Role = iota
+	RoleAdmin       // admin of the group thread the command runs in
+	RoleOwner       // listed in the bot's owner_ids
+)
+
+// RoleError is the error shown to a user who lacks role.
+func RoleError(role Role) error {
+	if role == RoleAdmin {
+		return errors.New("lệnh này chỉ dành cho quản trị viên nhóm")
+	}
+	return errors.New("lệnh này chỉ dành cho chủ bot")
+}
+
 // CommandContext provides context for command execution.
 type CommandContext struct {
 	Ctx               context.Context
 	Sender            MessageSender
 	Messages          MessageController
 	Conversation      ConversationReader
+	Pages             Paginator
+	Reminders         ReminderController
+	Broadcasts        BroadcastController
+	Threads           ThreadAdmin // acts with the sender's permissions
+	Polls             PollController
+	Moderation        ModerationController
+	Bans              BanController
 	ThreadID          int64
 	SenderID          int64
+	SenderRole        Role
 	IncomingMessageID string
+	ReplyToMessageID  string    // message the command replied to, if any
+	Mentions          []Mention // users @mentioned in the command message
 	Args              []string
 	RawText           string
 	StartTime         time.Time
 }
 
+// MentionedUserIDs returns the distinct IDs of users mentioned in the command
+// message, in the order they appear.
+func (c *CommandContext) MentionedUserIDs() []int64 {
+	seen := make(map[int64]struct{}, len(c.Mentions))
+	ids := make([]int64, 0, len(c.Mentions))
+	for _, m := range c.Mentions {
+		if _, ok := seen[m.UserID]; ok {
+			continue
+		}
+		seen[m.UserID] = struct{}{}
+		ids = append(ids, m.UserID)
+	}
+	return ids
+}
+
+// TextAfter returns the raw command text without its first n words (the
+// command name counts as one), keeping the spacing and line breaks of the
+// rest.
+func (c *CommandContext) TextAfter(n int) string {
+	rest := strings.TrimSpace(c.RawText)
+	for i := 0; i < n && rest != ""; i++ {
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			return ""
+		}
+		rest = strings.TrimSpace(rest[end:])
+	}
+	return rest
+}
+
+// RequireRole returns an error for the user unless the sender has at least
+// role.
+func (c *CommandContext) RequireRole(role Role) error {
+	if c.SenderRole >= role {
+		return nil
+	}
+	return RoleError(role)
+}
+
+// SendPages sends pages as a navigable paginated response replying to the
+// command. Without a Paginator the pages are sent as one message.
+func (c *CommandContext) SendPages(pages []string) error {
+	if c.Pages == nil {
+		return c.Sender.SendMessage(c.Ctx, c.ThreadID, strings.Join(pages, "\n\n"))
+	}
+	_, err := c.Pages.SendPages(c.Ctx, c.ThreadID, c.IncomingMessageID, pages)
+	return err
+}
+
+// SendPagedText sends text, splitting it into navigable pages when it is too
+// long for one message.
+func (c *CommandContext) SendPagedText(text string) error {
+	if c.Pages == nil {
+		return c.Sender.SendMessage(c.Ctx, c.ThreadID, text)
+	}
+	_, err := c.Pages.SendPagedText(c.Ctx, c.ThreadID, c.IncomingMessageID, text)
+	return err
+}
+
 // CommandHandler handles the execution of a command.
 type CommandHandler interface {
 	Execute(ctx *CommandContext) error
@@ -0,0 +1,24 @@
+package core
+
+import "testing"
+
+func TestCommandContextTextAfter(t *testing.T) {
+	tests := []struct {
+		raw  string
+		n    int
+		want string
+	}{
+		{`!poll  "Đi đâu?" a b`, 1, `"Đi đâu?" a b`},
+		{"!group rename  Lớp 12A1 ", 2, "Lớp 12A1"},
+		{"!broadcast active 7  Thông báo:\nBot bảo trì lúc 22h.", 3, "Thông báo:\nBot bảo trì lúc 22h."},
+		{"!broadcast\tall\nXin chào", 2, "Xin chào"},
+		{"!broadcast all", 2, ""},
+		{"!group rename", 3, ""},
+	}
+	for _, tt := range tests {
+		ctx := &CommandContext{RawText: tt.raw}
+		if got := ctx.TextAfter(tt.n); got != tt.want {
+			t.Errorf("TextAfter(%q, %d) = %q, want %q", tt.raw, tt.n, got, tt.want)
+		}
+	}
+}
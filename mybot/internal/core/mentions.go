@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Mention tags a user inside a message's text. Offset and Length are counted
+// in UTF-16 code units, which is what Messenger uses on the wire.
+type Mention struct {
+	UserID int64 `json:"user_id"`
+	Offset int   `json:"offset"`
+	Length int   `json:"length"`
+}
+
+// MentionBuilder composes message text containing @mentions while keeping
+// track of the UTF-16 offsets Messenger expects.
+type MentionBuilder struct {
+	b        strings.Builder
+	units    int
+	mentions []Mention
+}
+
+// WriteText appends plain text.
+func (m *MentionBuilder) WriteText(s string) *MentionBuilder {
+	m.b.WriteString(s)
+	m.units += utf16Len(s)
+	return m
+}
+
+// WriteMention appends "@name" and records it as a mention of userID.
+func (m *MentionBuilder) WriteMention(userID int64, name string) *MentionBuilder {
+	tag := "@" + name
+	m.mentions = append(m.mentions, Mention{UserID: userID, Offset: m.units, Length: utf16Len(tag)})
+	return m.WriteText(tag)
+}
+
+// Text returns the composed message text.
+func (m *MentionBuilder) Text() string {
+	return m.b.String()
+}
+
+// Mentions returns the mentions recorded so far.
+func (m *MentionBuilder) Mentions() []Mention {
+	return append([]Mention(nil), m.mentions...)
+}
+
+// TextRequest builds a SendTextRequest for threadID from the composed text.
+func (m *MentionBuilder) TextRequest(threadID int64) SendTextRequest {
+	return SendTextRequest{ThreadID: threadID, Text: m.Text(), Mentions: m.Mentions()}
+}
+
+// MentionUsers writes "@Name" for every user ID into a new builder, separated
+// by ", ". Names are looked up through reader; unknown users fall back to
+// their numeric ID.
+func MentionUsers(ctx context.Context, reader ConversationReader, userIDs ...int64) (*MentionBuilder, error) {
+	m := &MentionBuilder{}
+	for i, userID := range userIDs {
+		if i > 0 {
+			m.WriteText(", ")
+		}
+		name := strconv.FormatInt(userID, 10)
+		if reader != nil {
+			user, err := reader.GetUser(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			if user != nil && user.Name != "" {
+				name = user.Name
+			}
+		}
+		m.WriteMention(userID, name)
+	}
+	return m, nil
+}
+
+// MentionedText returns the part of text covered by mention.
+func MentionedText(text string, mention Mention) string {
+	units := utf16.Encode([]rune(text))
+	if mention.Offset < 0 || mention.Offset >= len(units) {
+		return ""
+	}
+	end := min(mention.Offset+mention.Length, len(units))
+	return string(utf16.Decode(units[mention.Offset:end]))
+}
+
+// StripMentions blanks the mention spans out of text and returns the
+// remaining words, so "@Name" tags whose names contain spaces do not leak
+// into a command's arguments.
+func StripMentions(text string, mentions []Mention) []string {
+	units := utf16.Encode([]rune(text))
+	for _, m := range mentions {
+		for i := max(m.Offset, 0); i < m.Offset+m.Length && i < len(units); i++ {
+			units[i] = ' '
+		}
+	}
+	return strings.Fields(string(utf16.Decode(units)))
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMentionBuilderCountsUTF16(t *testing.T) {
+	b := &MentionBuilder{}
+	b.WriteText("👋 chào ").WriteMention(1, "Đức").WriteText(" và ").WriteMention(2, "An")
+
+	want := []Mention{
+		{UserID: 1, Offset: 8, Length: 4},
+		{UserID: 2, Offset: 16, Length: 3},
+	}
+	got := b.Mentions()
+	if len(got) != len(want) {
+		t.Fatalf("Mentions() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Mentions()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if name := MentionedText(b.Text(), got[0]); name != "@Đức" {
+		t.Fatalf("MentionedText() = %q, want @Đức", name)
+	}
+}
+
+func TestStripMentions(t *testing.T) {
+	tests := []struct {
+		text     string
+		mentions []Mention
+		want     []string
+	}{
+		{"!remind @Lan Nguyễn daily 8am uống thuốc", []Mention{{UserID: 9, Offset: 8, Length: 12}}, []string{"!remind", "daily", "8am", "uống", "thuốc"}},
+		{"!group nick @Nguyễn Văn A Anh Cả", []Mention{{UserID: 7, Offset: 12, Length: 13}}, []string{"!group", "nick", "Anh", "Cả"}},
+		// "😀" is two UTF-16 units, so "@An" starts at 6, not 5.
+		{"!x 😀 @An hi", []Mention{{UserID: 1, Offset: 6, Length: 3}}, []string{"!x", "😀", "hi"}},
+		{"!x @An", []Mention{{UserID: 1, Offset: 3, Length: 99}}, []string{"!x"}},
+		{"!x hi", nil, []string{"!x", "hi"}},
+	}
+	for _, tt := range tests {
+		if got := StripMentions(tt.text, tt.mentions); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("StripMentions(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
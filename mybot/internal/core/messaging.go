@@ -1,15 +1,30 @@
 package core
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
 type ThreadRecord struct {
 	ThreadID        int64  `json:"thread_id"`
 	Name            string `json:"name"`
+	ThreadType      int64  `json:"thread_type"` // Messenger thread type, 0 if unknown
+	IsGroup         bool   `json:"is_group"`
 	UpdatedAtUnixMs int64  `json:"updated_at_unix_ms"`
 	LastActivityMs  int64  `json:"last_activity_ms"`
 	Deleted         bool   `json:"deleted"`
 }
 
+// ThreadParticipant is a member of a group thread as last seen by the bot.
+type ThreadParticipant struct {
+	ThreadID        int64  `json:"thread_id"`
+	UserID          int64  `json:"user_id"`
+	Nickname        string `json:"nickname"`
+	IsAdmin         bool   `json:"is_admin"`
+	UpdatedAtUnixMs int64  `json:"updated_at_unix_ms"`
+}
+
 type UserRecord struct {
 	UserID          int64  `json:"user_id"`
 	Name            string `json:"name"`
@@ -23,6 +38,22 @@ type AttachmentMeta struct {
 	Filename     string `json:"filename"`
 	MimeType     string `json:"mime_type"`
 	SizeBytes    int64  `json:"size_bytes"`
+	URL          string `json:"url,omitempty"` // external media sent by URL
+}
+
+// AttachmentFile is a local copy of an attachment kept by the attachment
+// archive. Files are named by the SHA-256 of their content, so attachments
+// with the same content share one file.
+type AttachmentFile struct {
+	MessageID        string `json:"message_id"`
+	AttachmentID     string `json:"attachment_id"`
+	ThreadID         int64  `json:"thread_id"`
+	SHA256           string `json:"sha256"`
+	SizeBytes        int64  `json:"size_bytes"`
+	MimeType         string `json:"mime_type"`
+	ArchivedAtUnixMs int64  `json:"archived_at_unix_ms"`
+	// Path is the file on disk.
+	Path string `json:"-"`
 }
 
 type MessageRecord struct {
@@ -36,6 +67,7 @@ type MessageRecord struct {
 	IsFromBot          bool             `json:"is_from_bot"`
 	HasMedia           bool             `json:"has_media"`
 	Attachments        []AttachmentMeta `json:"attachments,omitempty"`
+	Mentions           []Mention        `json:"mentions,omitempty"`
 	TimestampMs        int64            `json:"timestamp_ms"`
 	EditCount          int64            `json:"edit_count"`
 	IsEdited           bool             `json:"is_edited"`
@@ -43,6 +75,27 @@ type MessageRecord struct {
 	CreatedAtUnixMs    int64            `json:"created_at_unix_ms"`
 	UpdatedAtUnixMs    int64            `json:"updated_at_unix_ms"`
 	RecalledAtUnixMs   int64            `json:"recalled_at_unix_ms"`
+	// OutboxID is set when the message was queued instead of sent; MessageID
+	// stays empty until the outbox delivers it (see GetDeliveryStatus).
+	OutboxID int64 `json:"outbox_id,omitempty"`
+}
+
+// MessageEdit is one recorded version of a message's text. TimestampMs is
+// when this version became current (the original send time for the first
+// version, the edit time for later ones).
+type MessageEdit struct {
+	MessageID        string `json:"message_id"`
+	ThreadID         int64  `json:"thread_id"`
+	Text             string `json:"text"`
+	TimestampMs      int64  `json:"timestamp_ms"`
+	RecordedAtUnixMs int64  `json:"recorded_at_unix_ms"`
+}
+
+// MessagePin records that a message is pinned in its thread.
+type MessagePin struct {
+	ThreadID       int64  `json:"thread_id"`
+	MessageID      string `json:"message_id"`
+	PinnedAtUnixMs int64  `json:"pinned_at_unix_ms"`
 }
 
 type ReplyTarget struct {
@@ -53,6 +106,8 @@ type SendTextRequest struct {
 	ThreadID int64
 	Text     string
 	ReplyTo  *ReplyTarget
+	Mentions []Mention
+	OTID     int64 // offline threading ID; 0 generates a new one
 }
 
 type SendMediaRequest struct {
@@ -60,6 +115,419 @@ type SendMediaRequest struct {
 	Items    []MediaAttachment
 	ReplyTo  *ReplyTarget
 	Text     string // caption cho media (nếu có)
+	OTID     int64  // offline threading ID; 0 generates a new one
+}
+
+// SendStickerRequest sends a Messenger sticker by its Facebook ID.
+type SendStickerRequest struct {
+	ThreadID  int64
+	StickerID int64
+	ReplyTo   *ReplyTarget
+	OTID      int64 // offline threading ID; 0 generates a new one
+}
+
+// SendExternalMediaRequest sends media hosted elsewhere (e.g. a GIF URL from
+// Giphy) without uploading it; Messenger fetches and renders the URL.
+type SendExternalMediaRequest struct {
+	ThreadID int64
+	URL      string
+	ReplyTo  *ReplyTarget
+	OTID     int64 // offline threading ID; 0 generates a new one
+}
+
+// ForwardRequest forwards the message MessageID into ThreadID.
+type ForwardRequest struct {
+	ThreadID  int64
+	MessageID string
+	OTID      int64 // offline threading ID; 0 generates a new one
+}
+
+// DeliveryStatus is the state of a queued outbound message.
+type DeliveryStatus string
+
+const (
+	DeliveryPending DeliveryStatus = "pending"
+	DeliveryQueued  DeliveryStatus = "queued" // broadcast delivery handed to the outbox
+	DeliverySent    DeliveryStatus = "sent"
+	DeliveryFailed  DeliveryStatus = "failed"
+)
+
+// OutboxEntry describes a message queued for delivery while the bot was
+// disconnected (or behind earlier queued messages in the same thread).
+type OutboxEntry struct {
+	ID                  int64          `json:"id"`
+	ThreadID            int64          `json:"thread_id"`
+	Kind                string         `json:"kind"` // "text", "media", "sticker", "external" or "forward"
+	Status              DeliveryStatus `json:"status"`
+	Attempts            int            `json:"attempts"`
+	LastError           string         `json:"last_error,omitempty"`
+	MessageID           string         `json:"message_id,omitempty"` // set once sent
+	CreatedAtUnixMs     int64          `json:"created_at_unix_ms"`
+	UpdatedAtUnixMs     int64          `json:"updated_at_unix_ms"`
+	NextAttemptAtUnixMs int64          `json:"next_attempt_at_unix_ms"`
+}
+
+// ScheduleStatus is the state of a scheduled message.
+type ScheduleStatus string
+
+const (
+	SchedulePending   ScheduleStatus = "pending"
+	ScheduleQueued    ScheduleStatus = "queued" // handed to the outbox, see OutboxID
+	ScheduleSent      ScheduleStatus = "sent"
+	ScheduleFailed    ScheduleStatus = "failed"
+	ScheduleCancelled ScheduleStatus = "cancelled"
+)
+
+// ScheduledMessage is a message set to be sent at a later time.
+type ScheduledMessage struct {
+	ID              int64          `json:"id"`
+	ThreadID        int64          `json:"thread_id"`
+	CreatorID       int64          `json:"creator_id"` // user who scheduled it, 0 if none
+	Kind            string         `json:"kind"`       // "text" or "media"
+	Text            string         `json:"text"`       // text or caption
+	Status          ScheduleStatus `json:"status"`
+	Attempts        int            `json:"attempts"`
+	LastError       string         `json:"last_error,omitempty"`
+	MessageID       string         `json:"message_id,omitempty"` // set once sent
+	OutboxID        int64          `json:"outbox_id,omitempty"`  // set once queued
+	SendAtUnixMs    int64          `json:"send_at_unix_ms"`
+	CreatedAtUnixMs int64          `json:"created_at_unix_ms"`
+	UpdatedAtUnixMs int64          `json:"updated_at_unix_ms"`
+}
+
+// ReminderStatus is the state of a reminder.
+type ReminderStatus string
+
+const (
+	ReminderActive  ReminderStatus = "active"
+	ReminderDone    ReminderStatus = "done"    // one-shot reminder that fired
+	ReminderFailed  ReminderStatus = "failed"  // gave up after repeated send errors
+	ReminderDeleted ReminderStatus = "deleted" // deleted by a user
+)
+
+// Reminder mentions TargetID in ThreadID with Text at NextAtUnixMs, and
+// again on every occurrence of Recurrence (see ParseRecurrence) if set.
+type Reminder struct {
+	ID                int64          `json:"id"`
+	ThreadID          int64          `json:"thread_id"`
+	CreatorID         int64          `json:"creator_id"`
+	TargetID          int64          `json:"target_id"` // user mentioned when it fires
+	Text              string         `json:"text"`
+	Recurrence        string         `json:"recurrence,omitempty"` // empty for one-shot
+	Status            ReminderStatus `json:"status"`
+	NextAtUnixMs      int64          `json:"next_at_unix_ms"`
+	AnchorAtUnixMs    int64          `json:"anchor_at_unix_ms"` // occurrence the recurrence steps from
+	FireCount         int            `json:"fire_count"`
+	Attempts          int            `json:"attempts"` // failed sends of the current occurrence
+	LastError         string         `json:"last_error,omitempty"`
+	LastFiredAtUnixMs int64          `json:"last_fired_at_unix_ms"`
+	CreatedAtUnixMs   int64          `json:"created_at_unix_ms"`
+	UpdatedAtUnixMs   int64          `json:"updated_at_unix_ms"`
+}
+
+// ReminderRequest describes a reminder to create.
+type ReminderRequest struct {
+	ThreadID   int64
+	TargetID   int64
+	Text       string
+	Recurrence string    // canonical rule from ParseRecurrence, or empty
+	At         time.Time // first occurrence
+}
+
+// ReminderController stores reminders that fire in their thread, surviving
+// restarts and reconnects.
+type ReminderController interface {
+	// AddReminder stores req. The user in ctx (RequesterFromContext) is
+	// recorded as the creator.
+	AddReminder(ctx context.Context, req ReminderRequest) (*Reminder, error)
+	// GetReminder returns reminder id of threadID, or nil if there is none.
+	GetReminder(ctx context.Context, threadID, id int64) (*Reminder, error)
+	// ListReminders returns the active reminders of a thread, soonest first.
+	ListReminders(ctx context.Context, threadID int64) ([]*Reminder, error)
+	// DeleteReminder deletes reminder id of threadID.
+	DeleteReminder(ctx context.Context, threadID, id int64) error
+	// SnoozeReminder makes reminder id of threadID fire at until. A one-shot
+	// reminder that already fired is re-activated; a recurring one keeps its
+	// schedule afterwards.
+	SnoozeReminder(ctx context.Context, threadID, id int64, until time.Time) (*Reminder, error)
+}
+
+// BroadcastStatus is the state of a broadcast.
+type BroadcastStatus string
+
+const (
+	BroadcastRunning   BroadcastStatus = "running"
+	BroadcastDone      BroadcastStatus = "done"
+	BroadcastCancelled BroadcastStatus = "cancelled"
+)
+
+// BroadcastTargetKind selects which threads a broadcast goes to.
+type BroadcastTargetKind string
+
+const (
+	BroadcastAll    BroadcastTargetKind = "all"    // every known thread
+	BroadcastGroups BroadcastTargetKind = "groups" // group threads only
+	BroadcastActive BroadcastTargetKind = "active" // threads active in the last ActiveDays days
+	BroadcastList   BroadcastTargetKind = "list"   // exactly ThreadIDs
+)
+
+// BroadcastTarget describes the threads a broadcast goes to.
+type BroadcastTarget struct {
+	Kind       BroadcastTargetKind
+	ActiveDays int
+	ThreadIDs  []int64
+}
+
+// String renders the target the way it is stored, e.g. "active 7d".
+func (t BroadcastTarget) String() string {
+	switch t.Kind {
+	case BroadcastActive:
+		return fmt.Sprintf("%s %dd", t.Kind, t.ActiveDays)
+	case BroadcastList:
+		return fmt.Sprintf("%s %d", t.Kind, len(t.ThreadIDs))
+	}
+	return string(t.Kind)
+}
+
+// Broadcast is one announcement sent to many threads. Sent and Failed count
+// the deliveries finished so far, Queued those waiting in the outbox.
+type Broadcast struct {
+	ID               int64           `json:"id"`
+	CreatorID        int64           `json:"creator_id"`
+	OriginThreadID   int64           `json:"origin_thread_id"` // where the final report goes
+	Text             string          `json:"text"`
+	Target           string          `json:"target"`
+	Status           BroadcastStatus `json:"status"`
+	Total            int             `json:"total"`
+	Sent             int             `json:"sent"`
+	Failed           int             `json:"failed"`
+	Queued           int             `json:"queued"`
+	CreatedAtUnixMs  int64           `json:"created_at_unix_ms"`
+	UpdatedAtUnixMs  int64           `json:"updated_at_unix_ms"`
+	FinishedAtUnixMs int64           `json:"finished_at_unix_ms,omitempty"`
+}
+
+// BroadcastDelivery is the progress of a broadcast in one thread.
+type BroadcastDelivery struct {
+	BroadcastID     int64          `json:"broadcast_id"`
+	ThreadID        int64          `json:"thread_id"`
+	Status          DeliveryStatus `json:"status"`
+	LastError       string         `json:"last_error,omitempty"`
+	MessageID       string         `json:"message_id,omitempty"`
+	OutboxID        int64          `json:"outbox_id,omitempty"` // set while queued
+	UpdatedAtUnixMs int64          `json:"updated_at_unix_ms"`
+}
+
+// BroadcastController sends announcements to many threads. Progress is
+// stored, so an interrupted broadcast resumes after a restart.
+type BroadcastController interface {
+	// BroadcastTargets resolves target to thread IDs without sending
+	// anything (a dry run).
+	BroadcastTargets(ctx context.Context, target BroadcastTarget) ([]int64, error)
+	// StartBroadcast queues text for every thread of target and reports
+	// to originThreadID when done. The user in ctx is the creator.
+	StartBroadcast(ctx context.Context, originThreadID int64, text string, target BroadcastTarget) (*Broadcast, error)
+	// GetBroadcast returns broadcast id, or nil if there is none.
+	GetBroadcast(ctx context.Context, id int64) (*Broadcast, error)
+	// ListBroadcasts returns the most recent broadcasts, newest first.
+	ListBroadcasts(ctx context.Context, limit int) ([]*Broadcast, error)
+	// CancelBroadcast stops a running broadcast; deliveries already made
+	// are kept.
+	CancelBroadcast(ctx context.Context, id int64) error
+	// BroadcastReport renders the delivery report of broadcast id.
+	BroadcastReport(ctx context.Context, id int64) (string, error)
+}
+
+// ThreadAdmin changes group threads through the bot account. Every call is
+// checked against the role the caller has in that thread: reading
+// participants, polls and one's own nickname need no role; everything else
+// needs RoleAdmin. Nobody may act on a user with a higher role than their
+// own, and the bot cannot remove itself.
+type ThreadAdmin interface {
+	// ListParticipants returns the known members of threadID, admins first.
+	ListParticipants(ctx context.Context, threadID int64) ([]*ThreadParticipant, error)
+	RenameThread(ctx context.Context, threadID int64, name string) error
+	AddParticipants(ctx context.Context, threadID int64, userIDs []int64) error
+	RemoveParticipant(ctx context.Context, threadID, userID int64) error
+	// SetAdmin promotes (admin=true) or demotes userID.
+	SetAdmin(ctx context.Context, threadID, userID int64, admin bool) error
+	// SetNickname sets the nickname of userID; an empty nickname clears it.
+	SetNickname(ctx context.Context, threadID, userID int64, nickname string) error
+	SetEmoji(ctx context.Context, threadID int64, emoji string) error
+	// SetColor applies a Messenger theme by its FBID.
+	SetColor(ctx context.Context, threadID int64, themeFBID string) error
+	// SetImage sets the group photo; image is read fully into memory.
+	SetImage(ctx context.Context, threadID int64, image *MediaAttachment) error
+	// Mute mutes notifications of threadID for the bot until until; the
+	// zero time unmutes.
+	Mute(ctx context.Context, threadID int64, until time.Time) error
+	CreatePoll(ctx context.Context, threadID int64, question string, options []string) error
+}
+
+// PollStatus is the state of a poll as tracked by the bot.
+type PollStatus string
+
+const (
+	PollOpen   PollStatus = "open"
+	PollClosed PollStatus = "closed" // closed by the bot; later votes are not stored
+)
+
+// Poll is a native Messenger poll. ID is Messenger's poll ID. Question and
+// CreatorID are only known for polls created through the bot.
+type Poll struct {
+	ID              int64      `json:"id"`
+	ThreadID        int64      `json:"thread_id"`
+	CreatorID       int64      `json:"creator_id"`
+	Question        string     `json:"question"`
+	MessageID       string     `json:"message_id,omitempty"` // message of the last poll update
+	Status          PollStatus `json:"status"`
+	ClosesAtUnixMs  int64      `json:"closes_at_unix_ms"` // 0 = no deadline
+	ClosedAtUnixMs  int64      `json:"closed_at_unix_ms"`
+	CreatedAtUnixMs int64      `json:"created_at_unix_ms"`
+	UpdatedAtUnixMs int64      `json:"updated_at_unix_ms"`
+}
+
+// PollOption is one choice of a poll.
+type PollOption struct {
+	PollID   int64  `json:"poll_id"`
+	OptionID int64  `json:"option_id"`
+	Text     string `json:"text"`
+	Position int64  `json:"position"` // creation order as sent by Messenger
+}
+
+// PollVote is one user's vote for one option.
+type PollVote struct {
+	PollID        int64 `json:"poll_id"`
+	OptionID      int64 `json:"option_id"`
+	UserID        int64 `json:"user_id"`
+	VotedAtUnixMs int64 `json:"voted_at_unix_ms"`
+}
+
+// PollOptionResult is an option with the users who voted for it.
+type PollOptionResult struct {
+	PollOption
+	VoterIDs []int64
+}
+
+// PollResults is the tally of a poll. The votes of a poll the bot closed are
+// frozen at closing time.
+type PollResults struct {
+	Poll    *Poll
+	Options []PollOptionResult // in option order
+	Voters  int                // distinct users who voted
+}
+
+// PollRequest describes a poll to create.
+type PollRequest struct {
+	ThreadID int64
+	Question string
+	Options  []string
+	ClosesAt time.Time // zero = stays open
+}
+
+// PollController creates native polls and reads their live results.
+type PollController interface {
+	// CreatePoll creates req in its thread and waits briefly for Messenger
+	// to report the new poll. The user in ctx (RequesterFromContext) is
+	// recorded as the creator.
+	CreatePoll(ctx context.Context, req PollRequest) (*Poll, error)
+	// GetPoll returns poll id of threadID, or nil if there is none.
+	GetPoll(ctx context.Context, threadID, id int64) (*Poll, error)
+	// ListPolls returns the latest polls of a thread, newest first.
+	ListPolls(ctx context.Context, threadID int64, limit int) ([]*Poll, error)
+	PollResults(ctx context.Context, threadID, id int64) (*PollResults, error)
+	// ClosePoll stops counting votes and posts the summary to the thread.
+	ClosePoll(ctx context.Context, threadID, id int64) (*PollResults, error)
+}
+
+// ModerationReason is the rule a moderation event was raised for.
+type ModerationReason string
+
+const (
+	ModerationFlood     ModerationReason = "flood"     // too many messages in a short time
+	ModerationDuplicate ModerationReason = "duplicate" // the same text over and over
+	ModerationLinks     ModerationReason = "links"     // too many links in a short time
+	ModerationMentions  ModerationReason = "mentions"  // too many @mentions in one message
+	ModerationManual    ModerationReason = "manual"    // an admin acted through the bot
+)
+
+// ModerationAction is what was done about a moderation event.
+type ModerationAction string
+
+const (
+	ModerationWarn   ModerationAction = "warn"   // warned in the thread
+	ModerationMute   ModerationAction = "mute"   // ignored by the bot until UntilUnixMs
+	ModerationRemove ModerationAction = "remove" // removed from the group
+	ModerationPardon ModerationAction = "pardon" // mute lifted and strikes cleared
+)
+
+// ModerationEvent is one entry of a thread's moderation audit trail.
+type ModerationEvent struct {
+	ID              int64            `json:"id"`
+	ThreadID        int64            `json:"thread_id"`
+	UserID          int64            `json:"user_id"`
+	MessageID       string           `json:"message_id,omitempty"` // message that broke the rule
+	Reason          ModerationReason `json:"reason"`
+	Action          ModerationAction `json:"action"`
+	Detail          string           `json:"detail,omitempty"`
+	ActorID         int64            `json:"actor_id"`      // admin who acted; 0 when automatic
+	UntilUnixMs     int64            `json:"until_unix_ms"` // end of a mute
+	CreatedAtUnixMs int64            `json:"created_at_unix_ms"`
+}
+
+// ModerationController reads a group's anti-spam audit trail and lets admins
+// mute and pardon members by hand. Callers check the admin role themselves.
+type ModerationController interface {
+	// ModerationEvents returns the latest events of a thread, newest first;
+	// userID 0 returns every member's.
+	ModerationEvents(ctx context.Context, threadID, userID int64, limit int) ([]*ModerationEvent, error)
+	// MutedUsers returns the members of a thread the bot ignores, with the
+	// end of their mute.
+	MutedUsers(ctx context.Context, threadID int64) (map[int64]time.Time, error)
+	// Mute makes the bot ignore userID in threadID for d. The user in ctx
+	// (RequesterFromContext) is recorded as the actor.
+	Mute(ctx context.Context, threadID, userID int64, d time.Duration) error
+	// Pardon lifts a mute of userID in threadID and clears their strikes.
+	Pardon(ctx context.Context, threadID, userID int64) error
+}
+
+// Ban makes the bot ignore a user or a whole thread. ThreadID 0 bans UserID
+// everywhere; UserID 0 bans every user of ThreadID except owners.
+type Ban struct {
+	ThreadID        int64  `json:"thread_id"`
+	UserID          int64  `json:"user_id"`
+	Reason          string `json:"reason,omitempty"`
+	CreatorID       int64  `json:"creator_id"`
+	ExpiresAtUnixMs int64  `json:"expires_at_unix_ms"` // 0 = permanent
+	CreatedAtUnixMs int64  `json:"created_at_unix_ms"`
+}
+
+// Global reports whether the ban applies in every thread.
+func (b *Ban) Global() bool { return b.ThreadID == 0 }
+
+// WholeThread reports whether the ban silences a whole thread.
+func (b *Ban) WholeThread() bool { return b.UserID == 0 }
+
+// BanRequest describes a ban to add; see Ban for the meaning of zero IDs.
+type BanRequest struct {
+	ThreadID  int64
+	UserID    int64
+	Reason    string
+	ExpiresAt time.Time // zero = permanent
+}
+
+// BanController manages the users and threads the bot ignores. Callers check
+// roles themselves: banning a user in one thread is for its admins, global
+// and whole-thread bans are for owners.
+type BanController interface {
+	// Ban adds req, replacing an existing ban of the same user and thread.
+	// The user in ctx (RequesterFromContext) is recorded as the creator.
+	Ban(ctx context.Context, req BanRequest) (*Ban, error)
+	// Unban lifts the ban of userID in threadID (zero IDs as in Ban).
+	Unban(ctx context.Context, threadID, userID int64) error
+	// ListBans returns the active bans of a thread, or every active ban for
+	// threadID 0, newest first.
+	ListBans(ctx context.Context, threadID int64) ([]*Ban, error)
 }
 
 type MessageController interface {
@@ -68,12 +536,172 @@ type MessageController interface {
 	ReplyText(ctx context.Context, threadID int64, replyToMessageID, text string) (*MessageRecord, error)
 	EditText(ctx context.Context, messageID, newText string) (*MessageRecord, error)
 	Recall(ctx context.Context, messageID string) error
+	// Forward forwards an existing message into req.ThreadID. The stored
+	// copy takes the text and attachments of the original when it is known.
+	Forward(ctx context.Context, req ForwardRequest) (*MessageRecord, error)
+	SendSticker(ctx context.Context, req SendStickerRequest) (*MessageRecord, error)
+	// SendExternalMedia sends media by URL (GIFs, images) without
+	// downloading it first.
+	SendExternalMedia(ctx context.Context, req SendExternalMediaRequest) (*MessageRecord, error)
 	GetMessage(ctx context.Context, messageID string) (*MessageRecord, error)
 	GetLastBotMessage(ctx context.Context, threadID int64) (*MessageRecord, error)
+	// GetDeliveryStatus reports the state of a queued message by the
+	// OutboxID of the record SendText/SendMedia returned.
+	GetDeliveryStatus(ctx context.Context, outboxID int64) (*OutboxEntry, error)
+	// ScheduleText stores req to be sent at at. The user in ctx
+	// (RequesterFromContext) is recorded as the creator.
+	ScheduleText(ctx context.Context, req SendTextRequest, at time.Time) (*ScheduledMessage, error)
+	// ScheduleMedia is ScheduleText for media; the files are copied, so the
+	// caller may clean up its attachments right away.
+	ScheduleMedia(ctx context.Context, req SendMediaRequest, at time.Time) (*ScheduledMessage, error)
+	// ListScheduled returns the pending scheduled messages of a thread,
+	// soonest first.
+	ListScheduled(ctx context.Context, threadID int64) ([]*ScheduledMessage, error)
+	// CancelScheduled cancels a pending scheduled message of threadID.
+	CancelScheduled(ctx context.Context, threadID, id int64) error
 }
 
 type ConversationReader interface {
 	GetThread(ctx context.Context, threadID int64) (*ThreadRecord, error)
 	GetUser(ctx context.Context, userID int64) (*UserRecord, error)
 	ListThreadMessages(ctx context.Context, threadID int64, limit int, beforeMessageID string) ([]*MessageRecord, error)
+	// GetEditHistory returns the prior versions of a message, oldest first.
+	// The current text (MessageRecord.Text) is not included.
+	GetEditHistory(ctx context.Context, messageID string) ([]*MessageEdit, error)
+	// ThreadLocation returns the time zone times in threadID are read and
+	// shown in.
+	ThreadLocation(threadID int64) *time.Location
+	// SearchMessages returns the messages of threadID (0 = every thread)
+	// containing every word of query, newest first. Accents are ignored, so
+	// "pho" finds "phở". The bot's own and recalled messages are not
+	// searched.
+	SearchMessages(ctx context.Context, threadID int64, query string, filters SearchFilters) ([]*MessageRecord, error)
+	// LocalAttachments returns the archived copies of a message's
+	// attachments, which outlive Facebook's expiring URLs. It returns none
+	// when the attachment archive is off.
+	LocalAttachments(ctx context.Context, messageID string) ([]*AttachmentFile, error)
+	// ThreadStats sums up who talks, when and about what in threadID. It
+	// reads rollups kept as messages are stored, so it stays fast on long
+	// histories and still counts messages retention has deleted.
+	ThreadStats(ctx context.Context, threadID int64, q StatsQuery) (*ThreadStats, error)
+	// QueryMessages returns the stored messages q selects, newest first
+	// unless q.Oldest is set. Pass the ID of the last message of a page as
+	// q.After to get the next one.
+	QueryMessages(ctx context.Context, q MessageQuery) ([]*MessageRecord, error)
+	// QueryThreads returns the threads q selects, most recently active
+	// first. LastActivityMs is the later of the thread's own activity time
+	// and its newest stored message.
+	QueryThreads(ctx context.Context, q ThreadQuery) ([]*ThreadRecord, error)
+	// QueryUsers returns the users q selects, by name.
+	QueryUsers(ctx context.Context, q UserQuery) ([]*UserRecord, error)
+}
+
+// SearchFilters narrows ConversationReader.SearchMessages.
+type SearchFilters struct {
+	SenderID int64     // 0 = anyone
+	Since    time.Time // zero = no lower bound
+	Until    time.Time // exclusive; zero = no upper bound
+	HasMedia bool      // only messages with attachments
+	Limit    int       // 0 = 20
+}
+
+// StatsQuery narrows ConversationReader.ThreadStats.
+type StatsQuery struct {
+	UserID int64     // 0 = everyone
+	Since  time.Time // zero = no lower bound
+	Until  time.Time // exclusive; zero = no upper bound
+	Top    int       // entries in each top list; 0 = 5
+}
+
+// MessageQuery selects messages for ConversationReader.QueryMessages. Zero
+// fields don't filter.
+type MessageQuery struct {
+	ThreadID         int64     // 0 = every thread
+	SenderID         int64     // 0 = anyone
+	ReplyToMessageID string    // only the replies to this message
+	Since            time.Time // zero = no lower bound
+	Until            time.Time // exclusive; zero = no upper bound
+	HasMedia         bool      // only messages with attachments
+	ExcludeBot       bool      // leave out the bot's own messages
+	ExcludeRecalled  bool      // leave out recalled messages
+	Oldest           bool      // oldest first instead of newest first
+	// After is the ID of the last message of the previous page; the
+	// results continue after it. The other fields must not change between
+	// pages.
+	After string
+	Limit int // 0 = 50; at most 500
+}
+
+// ThreadQuery selects threads for ConversationReader.QueryThreads.
+type ThreadQuery struct {
+	GroupsOnly     bool
+	ActiveSince    time.Time // zero = however long ago
+	IncludeDeleted bool
+	Limit          int // 0 = every match
+}
+
+// UserQuery selects users for ConversationReader.QueryUsers.
+type UserQuery struct {
+	// NamePrefix matches the start of the name, ignoring case; "" matches
+	// everyone.
+	NamePrefix     string
+	IncludeDeleted bool
+	Limit          int // 0 = 20; at most 500
+}
+
+// ThreadStats sums up the messages of a thread, or of one user in it. The
+// bot's own messages are not counted. Activity is counted by the hour and
+// words and links by the UTC day, so Since and Until are rounded out to
+// those.
+type ThreadStats struct {
+	Messages      int64
+	MediaMessages int64
+	Links         int64
+	// ActiveMembers is how many people sent at least one message, in the
+	// whole thread even when the query has a UserID.
+	ActiveMembers int
+	// TopSenders are the people sending the most messages, most first.
+	TopSenders []SenderStats
+	// Days holds the days with messages, in the thread's time zone, oldest
+	// first.
+	Days []DayActivity
+	// Hours counts the messages sent in each hour of the day, in the
+	// thread's time zone.
+	Hours [24]int64
+	// TopWords leaves out stop-words, numbers and links; each word counts
+	// once per message.
+	TopWords []TermCount
+	// TopDomains are the sites linked to most, without "www.".
+	TopDomains []TermCount
+	// Responses counts the messages answering someone else within an hour;
+	// AvgResponse is how long they took on average.
+	Responses   int64
+	AvgResponse time.Duration
+
+	// Rank is the user's place among the senders (1 = most messages) and
+	// ThreadMessages the thread's total, when the query has a UserID.
+	Rank           int
+	ThreadMessages int64
+}
+
+// SenderStats is one person's share of a ThreadStats.
+type SenderStats struct {
+	UserID        int64
+	Messages      int64
+	MediaMessages int64
+	Links         int64
+	Responses     int64
+	AvgResponse   time.Duration
+}
+
+// DayActivity counts the messages of one day.
+type DayActivity struct {
+	Day      time.Time // midnight
+	Messages int64
+}
+
+// TermCount is a word or domain and how many messages used it.
+type TermCount struct {
+	Term  string
+	Count int64
 }
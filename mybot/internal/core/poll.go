@@ -0,0 +1,53 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FormatPollResults renders res as a chat message: one line per option with
+// its votes and share of all votes, then the number of voters and the
+// deadline in loc (or that the poll is closed).
+func FormatPollResults(res *PollResults, loc *time.Location) string {
+	if loc == nil {
+		loc = time.Local
+	}
+	poll := res.Poll
+	question := poll.Question
+	if question == "" {
+		question = "(không rõ câu hỏi)"
+	}
+
+	var b strings.Builder
+	if poll.Status == PollClosed {
+		fmt.Fprintf(&b, "📊 Kết quả bình chọn #%d: %s", poll.ID, question)
+	} else {
+		fmt.Fprintf(&b, "📊 Bình chọn #%d: %s", poll.ID, question)
+	}
+
+	total := 0
+	for _, option := range res.Options {
+		total += len(option.VoterIDs)
+	}
+	for i, option := range res.Options {
+		votes := len(option.VoterIDs)
+		percent := 0
+		if total > 0 {
+			percent = (votes*100 + total/2) / total
+		}
+		fmt.Fprintf(&b, "\n%d. %s — %d phiếu (%d%%)", i+1, option.Text, votes, percent)
+	}
+	if len(res.Options) == 0 {
+		b.WriteString("\n(chưa đồng bộ được các lựa chọn)")
+	}
+
+	fmt.Fprintf(&b, "\n👥 %d người đã bình chọn", res.Voters)
+	switch {
+	case poll.Status == PollClosed:
+		b.WriteString(" · 🔒 đã đóng")
+	case poll.ClosesAtUnixMs > 0:
+		fmt.Fprintf(&b, " · ⏳ đóng lúc %s", time.UnixMilli(poll.ClosesAtUnixMs).In(loc).Format("15:04 02/01/2006"))
+	}
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatPollResults(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	res := &PollResults{
+		Poll: &Poll{ID: 500, Question: "Đi đâu?", Status: PollOpen,
+			ClosesAtUnixMs: time.Date(2026, 10, 19, 21, 0, 0, 0, loc).UnixMilli()},
+		Options: []PollOptionResult{
+			{PollOption: PollOption{OptionID: 1, Text: "Biển"}, VoterIDs: []int64{7, 8}},
+			{PollOption: PollOption{OptionID: 2, Text: "Núi"}, VoterIDs: []int64{8}},
+			{PollOption: PollOption{OptionID: 3, Text: "Ở nhà"}},
+		},
+		Voters: 2,
+	}
+	want := "📊 Bình chọn #500: Đi đâu?\n" +
+		"1. Biển — 2 phiếu (67%)\n" +
+		"2. Núi — 1 phiếu (33%)\n" +
+		"3. Ở nhà — 0 phiếu (0%)\n" +
+		"👥 2 người đã bình chọn · ⏳ đóng lúc 21:00 19/10/2026"
+	if got := FormatPollResults(res, loc); got != want {
+		t.Fatalf("FormatPollResults() =\n%s\nwant\n%s", got, want)
+	}
+
+	res.Poll.Status = PollClosed
+	got := FormatPollResults(res, loc)
+	if !strings.HasPrefix(got, "📊 Kết quả bình chọn #500") || !strings.HasSuffix(got, "🔒 đã đóng") {
+		t.Fatalf("FormatPollResults(closed) = %q", got)
+	}
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// progressMinEditInterval throttles intermediate updates so fast phases
+	// don't burn through Messenger's edit allowance.
+	progressMinEditInterval = 2 * time.Second
+	// progressMaxEdits mirrors Messenger's limit on edits per message. One
+	// edit is kept in reserve for Done/Fail.
+	progressMaxEdits = 5
+	// progressFinalTimeout bounds the final status send, which must still go
+	// out after the command's own context has expired.
+	progressFinalTimeout = 15 * time.Second
+)
+
+// ReportedError wraps an error whose message has already been shown to the
+// user (for example in a progress message), so the dispatcher only logs it.
+type ReportedError struct {
+	Err error
+}
+
+func (e *ReportedError) Error() string { return e.Err.Error() }
+func (e *ReportedError) Unwrap() error { return e.Err }
+
+// IsReported reports whether err was already shown to the user.
+func IsReported(err error) bool {
+	var reported *ReportedError
+	return errors.As(err, &reported)
+}
+
+// Progress is a status message that is edited in place as a long-running
+// command moves through its phases.
+type Progress struct {
+	ctx      context.Context
+	messages MessageController
+	sender   MessageSender
+	threadID int64
+	replyTo  string
+
+	mu        sync.Mutex
+	messageID string
+	text      string
+	edits     int
+	lastEdit  time.Time
+	done      bool
+}
+
+// StartProgress sends text as a status message replying to the command and
+// returns a handle for updating it. Send failures are not fatal: the command
+// keeps running and the final status is sent as a new message.
+func (c *CommandContext) StartProgress(text string) *Progress {
+	p := &Progress{
+		ctx:      c.Ctx,
+		messages: c.Messages,
+		sender:   c.Sender,
+		threadID: c.ThreadID,
+		replyTo:  c.IncomingMessageID,
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.send(p.ctx, text)
+	return p
+}
+
+// Update replaces the status text. Updates arriving faster than the edit
+// throttle, or after the edit budget is spent, are dropped; Done always shows
+// the final text.
+func (p *Progress) Update(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done || text == p.text {
+		return
+	}
+	if p.messageID == "" || p.edits >= progressMaxEdits-1 || time.Since(p.lastEdit) < progressMinEditInterval {
+		return
+	}
+	p.edit(p.ctx, text)
+}
+
+// Done sets the final status text. It always reaches the chat: when the
+// status message can't be edited any more, text is sent as a new message.
+func (p *Progress) Done(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done {
+		return
+	}
+	p.done = true
+	if text == p.text {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(p.ctx), progressFinalTimeout)
+	defer cancel()
+	if p.messageID != "" && p.edits < progressMaxEdits && p.edit(ctx, text) {
+		return
+	}
+	p.send(ctx, text)
+}
+
+// Fail shows "❌ " + err as the final status and returns err wrapped in a
+// ReportedError so the dispatcher doesn't repeat it.
+func (p *Progress) Fail(err error) error {
+	if err == nil {
+		return nil
+	}
+	p.Done("❌ " + err.Error())
+	return &ReportedError{Err: err}
+}
+
+// send posts text as a new status message. Caller holds p.mu.
+func (p *Progress) send(ctx context.Context, text string) {
+	p.text = text
+	if p.messages == nil {
+		if p.sender != nil {
+			_ = p.sender.SendMessage(ctx, p.threadID, text)
+		}
+		return
+	}
+	rec, err := p.messages.SendText(ctx, SendTextRequest{
+		ThreadID: p.threadID,
+		Text:     text,
+		ReplyTo:  p.replyToRef(),
+	})
+	if err == nil && rec != nil {
+		p.messageID = rec.MessageID
+		p.edits = 0
+		p.lastEdit = time.Now()
+	}
+}
+
+// edit rewrites the status message in place. Caller holds p.mu.
+func (p *Progress) edit(ctx context.Context, text string) bool {
+	if _, err := p.messages.EditText(ctx, p.messageID, text); err != nil {
+		return false
+	}
+	p.text = text
+	p.edits++
+	p.lastEdit = time.Now()
+	return true
+}
+
+func (p *Progress) replyToRef() *ReplyTarget {
+	if p.replyTo == "" {
+		return nil
+	}
+	return &ReplyTarget{MessageID: p.replyTo}
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type fakeMessages struct {
+	MessageController
+	sent  []string
+	edits []string
+}
+
+func (f *fakeMessages) SendText(_ context.Context, req SendTextRequest) (*MessageRecord, error) {
+	f.sent = append(f.sent, req.Text)
+	return &MessageRecord{MessageID: fmt.Sprintf("m%d", len(f.sent)), Text: req.Text}, nil
+}
+
+func (f *fakeMessages) EditText(_ context.Context, messageID, text string) (*MessageRecord, error) {
+	f.edits = append(f.edits, text)
+	return &MessageRecord{MessageID: messageID, Text: text}, nil
+}
+
+func TestProgressEditsInPlace(t *testing.T) {
+	msgs := &fakeMessages{}
+	ctx := &CommandContext{Ctx: context.Background(), Messages: msgs, ThreadID: 1}
+
+	p := ctx.StartProgress("start")
+	p.Update("too soon") // throttled
+	p.lastEdit = time.Now().Add(-progressMinEditInterval)
+	p.Update("phase 2")
+	p.Done("done")
+
+	if len(msgs.sent) != 1 || msgs.sent[0] != "start" {
+		t.Fatalf("sent = %v, want [start]", msgs.sent)
+	}
+	if want := []string{"phase 2", "done"}; fmt.Sprint(msgs.edits) != fmt.Sprint(want) {
+		t.Fatalf("edits = %v, want %v", msgs.edits, want)
+	}
+}
+
+func TestProgressDoneAfterEditBudgetSendsNewMessage(t *testing.T) {
+	msgs := &fakeMessages{}
+	ctx := &CommandContext{Ctx: context.Background(), Messages: msgs, ThreadID: 1}
+
+	p := ctx.StartProgress("start")
+	p.edits = progressMaxEdits
+
+	err := p.Fail(errors.New("boom"))
+	if !IsReported(err) {
+		t.Fatalf("Fail() = %v, want reported error", err)
+	}
+	if len(msgs.edits) != 0 {
+		t.Fatalf("edits = %v, want none", msgs.edits)
+	}
+	if len(msgs.sent) != 2 || msgs.sent[1] != "❌ boom" {
+		t.Fatalf("sent = %v, want final status as new message", msgs.sent)
+	}
+}
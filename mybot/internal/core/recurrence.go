@@ -0,0 +1,146 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MinRecurrenceInterval is the shortest "every <duration>" rule accepted, so
+// a typo can't make the bot post every few seconds.
+const MinRecurrenceInterval = 5 * time.Minute
+
+// Canonical recurrence rules. Interval rules are stored as "every <d>" with
+// d in time.Duration format, e.g. "every 30m0s".
+const (
+	RecurHourly   = "hourly"
+	RecurDaily    = "daily"
+	RecurWeekdays = "weekdays"
+	RecurWeekly   = "weekly"
+	RecurMonthly  = "monthly"
+)
+
+var recurrenceWords = map[string]string{
+	"hourly": RecurHourly, "daily": RecurDaily, "weekdays": RecurWeekdays, "weekly": RecurWeekly, "monthly": RecurMonthly,
+	// "every <unit>" / "mỗi <unit>" / "hàng <unit>"
+	"hour": RecurHourly, "giờ": RecurHourly, "tiếng": RecurHourly,
+	"day": RecurDaily, "ngày": RecurDaily, "weekday": RecurWeekdays,
+	"week": RecurWeekly, "tuần": RecurWeekly,
+	"month": RecurMonthly, "tháng": RecurMonthly,
+}
+
+// ParseRecurrence reads a recurrence rule from the start of args and returns
+// its canonical form with the number of args used. Accepted forms: daily,
+// weekly, weekdays, hourly, monthly, "every day|week|weekday|hour|month",
+// "every 30m", and the Vietnamese "mỗi/hàng/hằng ngày|tuần|giờ|tháng",
+// "mỗi 2h". ok is false when args don't start with a rule.
+func ParseRecurrence(args []string) (rule string, used int, ok bool, err error) {
+	if len(args) == 0 {
+		return "", 0, false, nil
+	}
+	first := strings.ToLower(args[0])
+	switch first {
+	case "hourly", "daily", "weekdays", "weekly", "monthly":
+		return recurrenceWords[first], 1, true, nil
+	case "every", "mỗi", "hàng", "hằng":
+	default:
+		return "", 0, false, nil
+	}
+	if len(args) < 2 {
+		return "", 0, false, fmt.Errorf("thiếu chu kỳ sau %q", args[0])
+	}
+	if rule, ok := recurrenceWords[strings.ToLower(args[1])]; ok {
+		return rule, 2, true, nil
+	}
+	d, n := parseDuration(args[1:])
+	if d <= 0 {
+		return "", 0, false, fmt.Errorf("không hiểu chu kỳ %q", strings.Join(args[:2], " "))
+	}
+	if d < MinRecurrenceInterval {
+		return "", 0, false, fmt.Errorf("chu kỳ tối thiểu là %s", MinRecurrenceInterval)
+	}
+	return "every " + d.String(), 1 + n, true, nil
+}
+
+// RecurrenceInterval returns the interval of an "every <d>" rule.
+func RecurrenceInterval(rule string) (time.Duration, bool) {
+	s, ok := strings.CutPrefix(rule, "every ")
+	if !ok {
+		return 0, false
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
+
+// NextOccurrence returns the first occurrence of rule strictly after now,
+// stepping from anchor in loc (so daily rules keep their wall-clock time
+// across DST changes). anchor itself is returned if it is still after now.
+// ok is false for an empty or unknown rule.
+func NextOccurrence(rule string, anchor, now time.Time, loc *time.Location) (time.Time, bool) {
+	if loc == nil {
+		loc = time.Local
+	}
+	t := anchor.In(loc)
+	step := func(t time.Time) time.Time { return t }
+	switch rule {
+	case RecurHourly:
+		step = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	case RecurDaily:
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case RecurWeekly:
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case RecurMonthly:
+		step = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	case RecurWeekdays:
+		step = func(t time.Time) time.Time {
+			t = t.AddDate(0, 0, 1)
+			for t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+				t = t.AddDate(0, 0, 1)
+			}
+			return t
+		}
+	default:
+		d, ok := RecurrenceInterval(rule)
+		if !ok {
+			return time.Time{}, false
+		}
+		if !t.After(now) {
+			// Jump straight past now instead of stepping through every
+			// missed interval.
+			missed := now.Sub(t)/d + 1
+			t = t.Add(missed * d)
+		}
+		return t, true
+	}
+	weekend := func(t time.Time) bool {
+		return rule == RecurWeekdays && (t.Weekday() == time.Saturday || t.Weekday() == time.Sunday)
+	}
+	for !t.After(now) || weekend(t) {
+		t = step(t)
+	}
+	return t, true
+}
+
+// DescribeRecurrence renders rule for users.
+func DescribeRecurrence(rule string) string {
+	switch rule {
+	case RecurHourly:
+		return "mỗi giờ"
+	case RecurDaily:
+		return "mỗi ngày"
+	case RecurWeekdays:
+		return "ngày thường (T2–T6)"
+	case RecurWeekly:
+		return "mỗi tuần"
+	case RecurMonthly:
+		return "mỗi tháng"
+	}
+	if d, ok := RecurrenceInterval(rule); ok {
+		s := strings.TrimSuffix(d.String(), "0s")
+		if strings.HasSuffix(s, "h0m") {
+			s = strings.TrimSuffix(s, "0m")
+		}
+		return "mỗi " + s
+	}
+	return rule
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		input string
+		rule  string
+		used  int
+		ok    bool
+	}{
+		{"daily 8am uống thuốc", RecurDaily, 1, true},
+		{"every week 9:00 họp", RecurWeekly, 2, true},
+		{"mỗi ngày 8h x", RecurDaily, 2, true},
+		{"hàng tuần 8h x", RecurWeekly, 2, true},
+		{"every 2h x", "every 2h0m0s", 2, true},
+		{"mỗi 1h30m x", "every 1h30m0s", 2, true},
+		{"every 45 minutes x", "every 45m0s", 3, true},
+		{"8am x", "", 0, false},
+	}
+	for _, tt := range tests {
+		rule, used, ok, err := ParseRecurrence(strings.Fields(tt.input))
+		if err != nil || rule != tt.rule || used != tt.used || ok != tt.ok {
+			t.Errorf("ParseRecurrence(%q) = %q, %d, %v, %v; want %q, %d, %v", tt.input, rule, used, ok, err, tt.rule, tt.used, tt.ok)
+		}
+	}
+	for _, input := range []string{"every 1m x", "every soon", "mỗi"} {
+		if _, _, _, err := ParseRecurrence(strings.Fields(input)); err == nil {
+			t.Errorf("ParseRecurrence(%q) error = nil, want error", input)
+		}
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	anchor := time.Date(2026, 10, 16, 8, 0, 0, 0, loc) // Friday
+	now := time.Date(2026, 10, 16, 8, 0, 1, 0, loc)
+
+	tests := []struct {
+		rule string
+		now  time.Time
+		want time.Time
+	}{
+		{RecurDaily, now, time.Date(2026, 10, 17, 8, 0, 0, 0, loc)},
+		{RecurWeekdays, now, time.Date(2026, 10, 19, 8, 0, 0, 0, loc)},
+		{RecurWeekly, now, time.Date(2026, 10, 23, 8, 0, 0, 0, loc)},
+		{RecurMonthly, now, time.Date(2026, 11, 16, 8, 0, 0, 0, loc)},
+		{RecurHourly, now, time.Date(2026, 10, 16, 9, 0, 0, 0, loc)},
+		{"every 30m0s", now, time.Date(2026, 10, 16, 8, 30, 0, 0, loc)},
+		// Missed occurrences while the bot was down are skipped.
+		{RecurDaily, time.Date(2026, 10, 20, 12, 0, 0, 0, loc), time.Date(2026, 10, 21, 8, 0, 0, 0, loc)},
+		{"every 30m0s", time.Date(2026, 10, 16, 10, 10, 0, 0, loc), time.Date(2026, 10, 16, 10, 30, 0, 0, loc)},
+		// An anchor still in the future is kept.
+		{RecurDaily, anchor.Add(-time.Hour), anchor},
+	}
+	for _, tt := range tests {
+		got, ok := NextOccurrence(tt.rule, anchor, tt.now, loc)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("NextOccurrence(%q, now=%v) = %v, %v; want %v", tt.rule, tt.now, got, ok, tt.want)
+		}
+	}
+	if _, ok := NextOccurrence("", anchor, now, loc); ok {
+		t.Error("NextOccurrence(\"\") ok = true, want false")
+	}
+}
+
+func TestDescribeRecurrence(t *testing.T) {
+	for rule, want := range map[string]string{
+		RecurDaily:      "mỗi ngày",
+		"every 30m0s":   "mỗi 30m",
+		"every 2h0m0s":  "mỗi 2h",
+		"every 1h30m0s": "mỗi 1h30m",
+	} {
+		if got := DescribeRecurrence(rule); got != want {
+			t.Errorf("DescribeRecurrence(%q) = %q, want %q", rule, got, want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package core
+
+import "context"
+
+type requesterKey struct{}
+
+// WithRequester tags ctx with the user whose command triggered the work, so
+// the send path can apply per-user limits.
+func WithRequester(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, requesterKey{}, userID)
+}
+
+// RequesterFromContext returns the user set by WithRequester, or 0.
+func RequesterFromContext(ctx context.Context) int64 {
+	userID, _ := ctx.Value(requesterKey{}).(int64)
+	return userID
+}
@@ -0,0 +1,299 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationPartRe = regexp.MustCompile(`(\d+)([^\d]+)`)
+	clockRe        = regexp.MustCompile(`^(\d{1,2})(?:(:|h)(\d{2})?)?(am|pm)?$`)
+	dayMonthRe     = regexp.MustCompile(`^(\d{1,2})/(\d{1,2})(?:/(\d{4}))?$`)
+	isoDateRe      = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})$`)
+)
+
+// ErrNoTime is returned by ParseWhen when its args don't start with a time.
+var ErrNoTime = errors.New("thiếu thời gian")
+
+// durationUnits maps the unit words accepted by ParseWhen to their length.
+var durationUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second, "giây": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute, "p": time.Minute, "ph": time.Minute, "phút": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour, "g": time.Hour, "giờ": time.Hour, "tiếng": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour, "ngày": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour, "tuần": 7 * 24 * time.Hour,
+}
+
+// ParseWhen reads a point in time from the start of args and returns it with
+// the number of args it used. Times are read in loc. Accepted forms:
+//
+//	in 2h, in 1h30m, in 10 minutes, +45m, sau 2 tiếng
+//	21:00, 9pm, 8:30am, 8h, 8h30, 8 giờ tối   (today, or tomorrow if past)
+//	tomorrow 8am, today 21:00, mai 8h, ngày mai 8h, hôm nay 21h
+//	25/12 9:00, 25/12/2026 9:00, 2026-12-25 09:00
+//	lúc 21:00, at 9pm, mai lúc 8h   ("lúc"/"at" before the clock time)
+//
+// It returns ErrNoTime when args don't start with anything like a time, and
+// another error for a time it can't read ("25:99", "mai").
+func ParseWhen(args []string, now time.Time, loc *time.Location) (time.Time, int, error) {
+	if len(args) == 0 {
+		return time.Time{}, 0, ErrNoTime
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	now = now.In(loc)
+	first := strings.ToLower(args[0])
+
+	// Relative: "in 2h", "sau 10 phút", "+45m".
+	if first == "in" || first == "sau" || strings.HasPrefix(first, "+") {
+		rest := args[1:]
+		used := 1
+		if strings.HasPrefix(first, "+") && len(first) > 1 {
+			rest = append([]string{first[1:]}, args[1:]...)
+			used = 0
+		}
+		d, n := parseDuration(rest)
+		if d <= 0 {
+			return time.Time{}, 0, fmt.Errorf("không hiểu khoảng thời gian %q", strings.Join(args, " "))
+		}
+		used += n
+		if used < len(args) && strings.ToLower(args[used]) == "nữa" {
+			used++
+		}
+		return now.Add(d), used, nil
+	}
+
+	// Absolute: optional day, then a clock time.
+	i := 0
+	var day time.Time
+	hasDay, explicitDate, hasYear := false, false, false
+	switch {
+	case first == "tomorrow" || first == "mai":
+		day, hasDay, i = now.AddDate(0, 0, 1), true, 1
+	case first == "ngày" && len(args) > 1 && strings.ToLower(args[1]) == "mai":
+		day, hasDay, i = now.AddDate(0, 0, 1), true, 2
+	case first == "today" || first == "nay":
+		day, hasDay, i = now, true, 1
+	case first == "hôm" && len(args) > 1 && strings.ToLower(args[1]) == "nay":
+		day, hasDay, i = now, true, 2
+	default:
+		if d, withYear, ok := parseDate(first, now, loc); ok {
+			day, hasDay, explicitDate, hasYear, i = d, true, true, withYear, 1
+		}
+	}
+
+	at := false
+	if i < len(args) {
+		if w := strings.ToLower(args[i]); w == "lúc" || w == "at" {
+			at = true
+			i++
+		}
+	}
+
+	hour, minute, n, ok := parseClock(args[i:])
+	if !ok {
+		switch {
+		case hasDay:
+			return time.Time{}, 0, errors.New("thiếu giờ, ví dụ: tomorrow 8am, mai 8h")
+		case at && i == len(args):
+			return time.Time{}, 0, errors.New("thiếu giờ, ví dụ: lúc 21:00")
+		case !at && !looksLikeTime(args[0]):
+			return time.Time{}, 0, ErrNoTime
+		}
+		return time.Time{}, 0, fmt.Errorf("không hiểu thời gian %q", args[i])
+	}
+	i += n
+	if !hasDay {
+		day = now
+	}
+	t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+	switch {
+	case t.After(now):
+	case !hasDay:
+		t = t.AddDate(0, 0, 1)
+	case explicitDate && !hasYear:
+		t = t.AddDate(1, 0, 0)
+	default:
+		return time.Time{}, 0, fmt.Errorf("thời điểm %s đã qua", t.Format("15:04 02/01/2006"))
+	}
+	return t, i, nil
+}
+
+// ParseDateFilter reads one bound of a date filter such as "!search sau:7d"
+// in loc: an age counted back from now ("30m", "12h", "7d", "2w"), a date
+// ("20/10", "20/10/2026", "2026-10-20") or an RFC 3339 time. With endOfDay a
+// date means the end of that day, so "trước:20/10" includes the 20th.
+func ParseDateFilter(value string, now time.Time, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	now = now.In(loc)
+	s := strings.ToLower(value)
+	if len(s) >= 2 {
+		if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n > 0 {
+			switch s[len(s)-1] {
+			case 'm':
+				return now.Add(-time.Duration(n) * time.Minute), nil
+			case 'h':
+				return now.Add(-time.Duration(n) * time.Hour), nil
+			case 'd':
+				return now.AddDate(0, 0, -n), nil
+			case 'w':
+				return now.AddDate(0, 0, -7*n), nil
+			}
+		}
+	}
+	if t, _, ok := parseDate(s, now, loc); ok {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("thời điểm không hợp lệ: %s (VD 7d, 20/10, 20/10/2026, 2026-10-20)", value)
+}
+
+// looksLikeTime reports whether tok is written like a clock time or a date,
+// valid or not: "21:00", "25:99", "8h", "9pm", "31/02".
+func looksLikeTime(tok string) bool {
+	tok = strings.ToLower(tok)
+	if m := clockRe.FindStringSubmatch(tok); m != nil {
+		return m[2] != "" || m[4] != ""
+	}
+	return dayMonthRe.MatchString(tok) || isoDateRe.MatchString(tok)
+}
+
+// parseDuration sums leading duration args: compact forms ("2h", "1h30m")
+// and number-unit pairs ("10 minutes"). It returns the total and how many
+// args it used.
+func parseDuration(args []string) (time.Duration, int) {
+	var total time.Duration
+	i := 0
+	for i < len(args) {
+		tok := strings.ToLower(args[i])
+		if d, ok := parseCompactDuration(tok); ok {
+			total += d
+			i++
+			continue
+		}
+		if n, err := strconv.Atoi(tok); err == nil && i+1 < len(args) {
+			if unit, ok := durationUnits[strings.ToLower(args[i+1])]; ok {
+				total += time.Duration(n) * unit
+				i += 2
+				continue
+			}
+		}
+		break
+	}
+	return total, i
+}
+
+func parseCompactDuration(tok string) (time.Duration, bool) {
+	parts := durationPartRe.FindAllStringSubmatch(tok, -1)
+	if len(parts) == 0 {
+		return 0, false
+	}
+	var total time.Duration
+	consumed := 0
+	for _, p := range parts {
+		unit, ok := durationUnits[p[2]]
+		if !ok {
+			return 0, false
+		}
+		n, _ := strconv.Atoi(p[1])
+		total += time.Duration(n) * unit
+		consumed += len(p[0])
+	}
+	return total, consumed == len(tok)
+}
+
+// parseDate reads "25/12", "25/12/2026" or "2026-12-25".
+func parseDate(tok string, now time.Time, loc *time.Location) (time.Time, bool, bool) {
+	var year, month, day int
+	withYear := false
+	if m := isoDateRe.FindStringSubmatch(tok); m != nil {
+		year, _ = strconv.Atoi(m[1])
+		month, _ = strconv.Atoi(m[2])
+		day, _ = strconv.Atoi(m[3])
+		withYear = true
+	} else if m := dayMonthRe.FindStringSubmatch(tok); m != nil {
+		day, _ = strconv.Atoi(m[1])
+		month, _ = strconv.Atoi(m[2])
+		year = now.Year()
+		if m[3] != "" {
+			year, _ = strconv.Atoi(m[3])
+			withYear = true
+		}
+	} else {
+		return time.Time{}, false, false
+	}
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc)
+	if t.Day() != day || int(t.Month()) != month {
+		return time.Time{}, false, false // e.g. 31/02
+	}
+	return t, withYear, true
+}
+
+// parseClock reads a clock time ("21:00", "9pm", "8h30", "8 giờ tối") from
+// the start of args and returns it with the number of args used.
+func parseClock(args []string) (hour, minute, used int, ok bool) {
+	if len(args) == 0 {
+		return 0, 0, 0, false
+	}
+	tok := strings.ToLower(args[0])
+	used = 1
+	m := clockRe.FindStringSubmatch(tok)
+	if m == nil {
+		return 0, 0, 0, false
+	}
+	hour, _ = strconv.Atoi(m[1])
+	minute, _ = strconv.Atoi(m[3])
+	suffix := m[4]
+	isClock := m[2] != "" || suffix != ""
+
+	// A bare number needs a following "giờ"/"h"/"am"/"pm" to be a time.
+	if !isClock && len(args) > 1 {
+		if next := strings.ToLower(args[1]); next == "giờ" || next == "h" {
+			isClock = true
+			used++
+		}
+	}
+	if used < len(args) && suffix == "" {
+		switch strings.ToLower(args[used]) {
+		case "am", "sáng":
+			suffix, isClock = "am", true
+			used++
+		case "pm", "chiều", "tối":
+			suffix, isClock = "pm", true
+			used++
+		case "trưa":
+			isClock = true
+			used++
+		}
+	}
+	if !isClock {
+		return 0, 0, 0, false
+	}
+
+	switch suffix {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, 0, false
+	}
+	return hour, minute, used, true
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWhen(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	now := time.Date(2026, 10, 18, 20, 15, 0, 0, loc)
+
+	tests := []struct {
+		input string
+		want  time.Time
+		used  int
+	}{
+		{"in 2h nhắc họp", now.Add(2 * time.Hour), 2},
+		{"in 1h30m x", now.Add(90 * time.Minute), 2},
+		{"in 10 minutes x", now.Add(10 * time.Minute), 3},
+		{"sau 2 tiếng nữa x", now.Add(2 * time.Hour), 4},
+		{"+45m x", now.Add(45 * time.Minute), 1},
+		{"21:00 x", time.Date(2026, 10, 18, 21, 0, 0, 0, loc), 1},
+		{"8:00 x", time.Date(2026, 10, 19, 8, 0, 0, 0, loc), 1},
+		{"9pm x", time.Date(2026, 10, 18, 21, 0, 0, 0, loc), 1},
+		{"8h30 x", time.Date(2026, 10, 19, 8, 30, 0, 0, loc), 1},
+		{"9 giờ tối x", time.Date(2026, 10, 18, 21, 0, 0, 0, loc), 3},
+		{"tomorrow 8am x", time.Date(2026, 10, 19, 8, 0, 0, 0, loc), 2},
+		{"ngày mai 8h x", time.Date(2026, 10, 19, 8, 0, 0, 0, loc), 3},
+		{"hôm nay 23h x", time.Date(2026, 10, 18, 23, 0, 0, 0, loc), 3},
+		{"25/12 9:00 x", time.Date(2026, 12, 25, 9, 0, 0, 0, loc), 2},
+		{"1/1 9:00 x", time.Date(2027, 1, 1, 9, 0, 0, 0, loc), 2},
+		{"2027-03-01 07:30 x", time.Date(2027, 3, 1, 7, 30, 0, 0, loc), 2},
+		{"lúc 21:00 x", time.Date(2026, 10, 18, 21, 0, 0, 0, loc), 2},
+		{"mai lúc 8h x", time.Date(2026, 10, 19, 8, 0, 0, 0, loc), 3},
+		{"at 9pm x", time.Date(2026, 10, 18, 21, 0, 0, 0, loc), 2},
+	}
+	for _, tt := range tests {
+		got, used, err := ParseWhen(strings.Fields(tt.input), now, loc)
+		if err != nil {
+			t.Errorf("ParseWhen(%q) error = %v", tt.input, err)
+			continue
+		}
+		if !got.Equal(tt.want) || used != tt.used {
+			t.Errorf("ParseWhen(%q) = %v, %d; want %v, %d", tt.input, got, used, tt.want, tt.used)
+		}
+	}
+}
+
+func TestParseWhenRejects(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	now := time.Date(2026, 10, 18, 20, 15, 0, 0, loc)
+	for _, input := range []string{"", "hello", "in", "in soon", "tomorrow", "today 8:00", "25:00", "31/02 8h", "5 x", "lúc", "lúc 25:99 x"} {
+		if got, _, err := ParseWhen(strings.Fields(input), now, loc); err == nil {
+			t.Errorf("ParseWhen(%q) = %v, want error", input, got)
+		}
+	}
+
+	// Only args that don't look like a time at all have no time.
+	for input, want := range map[string]bool{"": true, "hello": true, "5 x": true, "25:99 x": false, "31/02 8h": false, "lúc x": false, "mai x": false} {
+		if _, _, err := ParseWhen(strings.Fields(input), now, loc); errors.Is(err, ErrNoTime) != want {
+			t.Errorf("ParseWhen(%q) error = %v, want ErrNoTime: %v", input, err, want)
+		}
+	}
+}
+
+func TestParseDateFilter(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	now := time.Date(2026, 10, 18, 20, 15, 0, 0, loc)
+
+	tests := []struct {
+		input    string
+		endOfDay bool
+		want     time.Time
+	}{
+		{"30m", false, now.Add(-30 * time.Minute)},
+		{"12H", false, now.Add(-12 * time.Hour)},
+		{"7d", false, now.AddDate(0, 0, -7)},
+		{"2w", true, now.AddDate(0, 0, -14)},
+		{"20/10", false, time.Date(2026, 10, 20, 0, 0, 0, 0, loc)},
+		{"20/10", true, time.Date(2026, 10, 21, 0, 0, 0, 0, loc)},
+		{"1/2/2025", false, time.Date(2025, 2, 1, 0, 0, 0, 0, loc)},
+		{"2026-10-01", true, time.Date(2026, 10, 2, 0, 0, 0, 0, loc)},
+		{"2026-10-01T08:00:00Z", true, time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseDateFilter(tt.input, now, loc, tt.endOfDay)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseDateFilter(%q, %v) = %v, %v; want %v", tt.input, tt.endOfDay, got, err, tt.want)
+		}
+	}
+	for _, input := range []string{"", "0d", "7x", "31/02", "hôm qua"} {
+		if _, err := ParseDateFilter(input, now, loc, false); err == nil {
+			t.Errorf("ParseDateFilter(%q) error = nil, want error", input)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Package encryption seals the values the bot keeps at rest — message text
+// in the database, secrets in the config file — with AES-256-GCM. A sealed
+// value is a string of the form "enc:v1:<key id>:<base64 nonce+ciphertext>",
+// so it fits the TEXT columns and JSON strings it replaces; values without
+// the prefix are plaintext and pass through Open unchanged.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// EnvKey is the environment variable holding the keys, base64 and comma
+	// separated, newest first. It takes precedence over the key file.
+	EnvKey = "BOT_ENCRYPTION_KEY"
+
+	// KeySize is the length of a key in bytes.
+	KeySize = 32
+
+	prefix = "enc:v1:"
+	// escapePrefix marks plaintext that starts like a sealed value; see
+	// Escape.
+	escapePrefix = "enc:raw:"
+)
+
+var (
+	// ErrNoKey is returned by Load when neither EnvKey nor the key file
+	// holds a key.
+	ErrNoKey = errors.New("no encryption key")
+	// ErrUnknownKey is returned by Open for a value sealed with a key the
+	// keyring doesn't have.
+	ErrUnknownKey = errors.New("value was sealed with a key not in the keyring")
+	// ErrCorrupt is returned by Open for a sealed value that doesn't
+	// decrypt.
+	ErrCorrupt = errors.New("sealed value is corrupt")
+)
+
+// Source is where a keyring's keys were read from.
+type Source int
+
+const (
+	SourceFile Source = iota
+	SourceEnv
+)
+
+func (s Source) String() string {
+	if s == SourceEnv {
+		return EnvKey
+	}
+	return "key file"
+}
+
+type key struct {
+	id   string
+	raw  []byte
+	aead cipher.AEAD
+}
+
+// Keyring holds the keys that open sealed values. The first one, the
+// current key, seals new values; the others are kept so values sealed
+// before a rotation still open.
+type Keyring struct {
+	keys []key
+}
+
+// NewKeyring returns a keyring of keys, current key first.
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKey
+	}
+	k := &Keyring{}
+	seen := make(map[string]bool, len(keys))
+	for i, raw := range keys {
+		if len(raw) != KeySize {
+			return nil, fmt.Errorf("key %d is %d bytes, want %d", i+1, len(raw), KeySize)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		id := KeyID(raw)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		k.keys = append(k.keys, key{id: id, raw: append([]byte(nil), raw...), aead: aead})
+	}
+	return k, nil
+}
+
+// GenerateKey returns a new random key.
+func GenerateKey() []byte {
+	raw := make([]byte, KeySize)
+	rand.Read(raw)
+	return raw
+}
+
+// KeyID names a key in sealed values without giving it away: the first 4
+// bytes of its SHA-256, in hex.
+func KeyID(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:4])
+}
+
+// ParseKeys reads base64 keys separated by commas or newlines. Blank lines
+// and lines starting with "#" are skipped.
+func ParseKeys(text string) ([][]byte, error) {
+	var keys [][]byte
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, field := range strings.Split(line, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			raw, err := base64.StdEncoding.DecodeString(field)
+			if err != nil {
+				return nil, fmt.Errorf("key %d: %w", len(keys)+1, err)
+			}
+			keys = append(keys, raw)
+		}
+	}
+	return keys, nil
+}
+
+// Load reads the keyring from EnvKey when it is set, else from the key file
+// at path. It returns ErrNoKey, wrapping the file's error, when neither has
+// a key.
+func Load(path string) (*Keyring, Source, error) {
+	if env := os.Getenv(EnvKey); strings.TrimSpace(env) != "" {
+		keys, err := ParseKeys(env)
+		if err != nil {
+			return nil, SourceEnv, fmt.Errorf("%s: %w", EnvKey, err)
+		}
+		k, err := NewKeyring(keys...)
+		if err != nil {
+			return nil, SourceEnv, fmt.Errorf("%s: %w", EnvKey, err)
+		}
+		return k, SourceEnv, nil
+	}
+	if path == "" {
+		return nil, SourceFile, ErrNoKey
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, SourceFile, fmt.Errorf("%w: %w", ErrNoKey, err)
+	}
+	keys, err := ParseKeys(string(data))
+	if err != nil {
+		return nil, SourceFile, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(keys) == 0 {
+		return nil, SourceFile, fmt.Errorf("%w: %s is empty", ErrNoKey, path)
+	}
+	k, err := NewKeyring(keys...)
+	if err != nil {
+		return nil, SourceFile, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, SourceFile, nil
+}
+
+// WriteKeyFile writes the keys of k to path, current key first, readable by
+// the owner only. The file is replaced in one rename, so a crash leaves
+// either the old keys or the new ones.
+func WriteKeyFile(path string, k *Keyring) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("# Encryption keys of the bot, newest first. Keep a copy somewhere safe:\n")
+	b.WriteString("# without them the stored messages and config secrets can't be read.\n")
+	for _, key := range k.keys {
+		b.WriteString(base64.StdEncoding.EncodeToString(key.raw))
+		b.WriteByte('\n')
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".key-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// KeyID returns the ID of the current key.
+func (k *Keyring) KeyID() string {
+	return k.keys[0].id
+}
+
+// Has reports whether the keyring holds the key named id.
+func (k *Keyring) Has(id string) bool {
+	for _, key := range k.keys {
+		if key.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of keys.
+func (k *Keyring) Len() int {
+	return len(k.keys)
+}
+
+// WithKey returns a keyring with raw as its current key, followed by the
+// keys of k.
+func (k *Keyring) WithKey(raw []byte) (*Keyring, error) {
+	keys := [][]byte{raw}
+	for _, key := range k.keys {
+		keys = append(keys, key.raw)
+	}
+	return NewKeyring(keys...)
+}
+
+// Current returns a keyring holding only the current key.
+func (k *Keyring) Current() *Keyring {
+	return &Keyring{keys: k.keys[:1:1]}
+}
+
+// Keep returns a keyring of the current key and those old keys whose IDs
+// are in ids.
+func (k *Keyring) Keep(ids map[string]bool) *Keyring {
+	kept := &Keyring{keys: k.keys[:1:1]}
+	for _, key := range k.keys[1:] {
+		if ids[key.id] {
+			kept.keys = append(kept.keys, key)
+		}
+	}
+	return kept
+}
+
+// Seal encrypts plain with the current key. The empty string stays empty.
+func (k *Keyring) Seal(plain string) string {
+	if plain == "" {
+		return ""
+	}
+	key := k.keys[0]
+	nonce := make([]byte, key.aead.NonceSize(), key.aead.NonceSize()+len(plain)+key.aead.Overhead())
+	rand.Read(nonce)
+	sealed := key.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return prefix + key.id + ":" + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+// Open decrypts a value made by Seal. Values that aren't sealed are
+// returned as Unescape leaves them, also by a nil keyring.
+func (k *Keyring) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return Unescape(value), nil
+	}
+	if k == nil {
+		return "", ErrNoKey
+	}
+	id, data, ok := strings.Cut(value[len(prefix):], ":")
+	if !ok {
+		return "", ErrCorrupt
+	}
+	for _, key := range k.keys {
+		if key.id != id {
+			continue
+		}
+		sealed, err := base64.RawStdEncoding.DecodeString(data)
+		if err != nil || len(sealed) < key.aead.NonceSize() {
+			return "", ErrCorrupt
+		}
+		nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+		plain, err := key.aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return "", ErrCorrupt
+		}
+		return string(plain), nil
+	}
+	return "", fmt.Errorf("%w (key %s)", ErrUnknownKey, id)
+}
+
+// Escape returns plain in a form IsSealed never takes for a sealed value,
+// for storing plaintext next to sealed values: anything starting with
+// "enc:" gets a marker that Unescape and Open strip again.
+func Escape(plain string) string {
+	if strings.HasPrefix(plain, "enc:") {
+		return escapePrefix + plain
+	}
+	return plain
+}
+
+// Unescape undoes Escape.
+func Unescape(value string) string {
+	return strings.TrimPrefix(value, escapePrefix)
+}
+
+// IsSealed reports whether value was made by Seal.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
@@ -0,0 +1,124 @@
+package encryption
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	old, err := NewKeyring(GenerateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := old.Seal("tối nay ăn phở không?")
+	if !IsSealed(sealed) || strings.Contains(sealed, "phở") {
+		t.Fatalf("Seal() = %q, want a sealed value", sealed)
+	}
+	if again := old.Seal("tối nay ăn phở không?"); again == sealed {
+		t.Error("Seal() twice gave the same value, want a fresh nonce")
+	}
+	if got, err := old.Open(sealed); err != nil || got != "tối nay ăn phở không?" {
+		t.Errorf("Open() = %q, %v", got, err)
+	}
+	if got, err := old.Open("plain"); err != nil || got != "plain" {
+		t.Errorf("Open(plain) = %q, %v; want it passed through", got, err)
+	}
+	if old.Seal("") != "" {
+		t.Error("Seal(\"\") is not empty")
+	}
+
+	// After a rotation the old values still open; without the old key they
+	// don't.
+	rotated, err := old.WithKey(GenerateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.KeyID() == old.KeyID() || !rotated.Has(old.KeyID()) || rotated.Len() != 2 {
+		t.Fatalf("WithKey() = %d keys, current %s", rotated.Len(), rotated.KeyID())
+	}
+	if got, err := rotated.Open(sealed); err != nil || got != "tối nay ăn phở không?" {
+		t.Errorf("rotated Open() = %q, %v", got, err)
+	}
+	if _, err := rotated.Current().Open(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Current().Open(old value) error = %v, want ErrUnknownKey", err)
+	}
+	if kept := rotated.Keep(map[string]bool{old.KeyID(): true}); kept.Len() != 2 || kept.KeyID() != rotated.KeyID() {
+		t.Errorf("Keep(old) = %d keys, current %s", kept.Len(), kept.KeyID())
+	}
+	if kept := rotated.Keep(map[string]bool{"ffffffff": true}); kept.Len() != 1 {
+		t.Errorf("Keep(other) = %d keys, want only the current one", kept.Len())
+	}
+	if _, err := (*Keyring)(nil).Open(sealed); !errors.Is(err, ErrNoKey) {
+		t.Errorf("nil Open() error = %v, want ErrNoKey", err)
+	}
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err := old.Open(tampered); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Open(tampered) error = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for _, plain := range []string{"", "plain", "enc:v1:abc:def", "enc:raw:x", "enc:"} {
+		escaped := Escape(plain)
+		if IsSealed(escaped) {
+			t.Errorf("Escape(%q) = %q, which looks sealed", plain, escaped)
+		}
+		if got := Unescape(escaped); got != plain {
+			t.Errorf("Unescape(Escape(%q)) = %q", plain, got)
+		}
+		if got, err := (*Keyring)(nil).Open(escaped); err != nil || got != plain {
+			t.Errorf("Open(Escape(%q)) = %q, %v", plain, got, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "encryption.key")
+	t.Setenv(EnvKey, "")
+	if _, _, err := Load(path); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("Load(missing) error = %v, want ErrNoKey", err)
+	}
+
+	first, _ := NewKeyring(GenerateKey())
+	keys, _ := first.WithKey(GenerateKey())
+	if err := WriteKeyFile(path, keys); err != nil {
+		t.Fatalf("WriteKeyFile() error = %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, %v; want 0600", info.Mode(), err)
+	}
+	got, source, err := Load(path)
+	if err != nil || source != SourceFile || got.KeyID() != keys.KeyID() || got.Len() != 2 {
+		t.Fatalf("Load(file) = %v, %v, %v", got, source, err)
+	}
+
+	// The environment variable wins over the file.
+	t.Setenv(EnvKey, "  "+strings.TrimSpace(strings.Split(readKeys(t, path), "\n")[1])+" , ")
+	got, source, err = Load(path)
+	if err != nil || source != SourceEnv || got.Len() != 1 || got.KeyID() != first.KeyID() {
+		t.Errorf("Load(env) = %v, %v, %v; want the one key of %s", got, source, err, EnvKey)
+	}
+	t.Setenv(EnvKey, "c2hvcnQ=")
+	if _, _, err := Load(path); err == nil {
+		t.Error("Load(short key) error = nil")
+	}
+}
+
+// readKeys returns the key lines of the key file at path.
+func readKeys(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
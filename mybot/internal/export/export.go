@@ -0,0 +1,361 @@
+// Package export writes the stored history of a thread as JSON lines, a
+// self-contained HTML transcript or CSV.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mybot/internal/core"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl"
+	FormatHTML  Format = "html"
+	FormatCSV   Format = "csv"
+)
+
+// ParseFormat reads a format name; "json" is taken as JSON lines.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "jsonl", "json", "ndjson":
+		return FormatJSONL, nil
+	case "html", "htm":
+		return FormatHTML, nil
+	case "csv":
+		return FormatCSV, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (want jsonl, html or csv)", s)
+}
+
+// Ext returns the file extension of f, without the dot.
+func (f Format) Ext() string {
+	return string(f)
+}
+
+// MimeType returns the MIME type of files in format f.
+func (f Format) MimeType() string {
+	switch f {
+	case FormatHTML:
+		return "text/html"
+	case FormatCSV:
+		return "text/csv"
+	}
+	return "application/json"
+}
+
+// pageSize is how many messages are read from the store at a time.
+const pageSize = 200
+
+// Options selects what Export writes.
+type Options struct {
+	ThreadID int64
+	Format   Format
+	Since    time.Time // zero = from the first stored message
+	Until    time.Time // exclusive; zero = up to now
+	// MaxMessages keeps only the newest messages of the range; 0 = all.
+	MaxMessages int
+	// Location is the time zone times are written in; nil uses the
+	// thread's.
+	Location *time.Location
+}
+
+// Stats sums up an export.
+type Stats struct {
+	Messages int
+	// Truncated is set when MaxMessages left older messages out.
+	Truncated bool
+}
+
+// Export writes the messages of opts.ThreadID in the range, oldest first,
+// to w. Sender names, reply targets and edit history are looked up through
+// r.
+func Export(ctx context.Context, w io.Writer, r core.ConversationReader, opts Options) (Stats, error) {
+	if opts.ThreadID == 0 {
+		return Stats{}, errors.New("export: no thread")
+	}
+	if opts.Location == nil {
+		opts.Location = r.ThreadLocation(opts.ThreadID)
+	}
+	t, err := load(ctx, r, opts)
+	if err != nil {
+		return Stats{}, err
+	}
+	switch opts.Format {
+	case FormatJSONL, "":
+		err = writeJSONL(w, t)
+	case FormatHTML:
+		err = writeHTML(w, t)
+	case FormatCSV:
+		err = writeCSV(w, t)
+	default:
+		err = fmt.Errorf("unknown export format %q", opts.Format)
+	}
+	return Stats{Messages: len(t.Messages), Truncated: t.Truncated}, err
+}
+
+// transcript is what the writers render.
+type transcript struct {
+	Thread     *core.ThreadRecord
+	ThreadName string
+	Since      time.Time
+	Until      time.Time
+	ExportedAt time.Time
+	Location   *time.Location
+	Messages   []*entry
+	Truncated  bool
+}
+
+// Format formats the Unix milliseconds ms in the transcript's time zone.
+func (t *transcript) Format(ms int64, layout string) string {
+	return time.UnixMilli(ms).In(t.Location).Format(layout)
+}
+
+// entry is one message with what it refers to looked up.
+type entry struct {
+	*core.MessageRecord
+	SenderName string
+	ReplyTo    *entry // nil when the reply target is outside the export
+	Edits      []*core.MessageEdit
+	// Files are the archived copies of the attachments.
+	Files []*core.AttachmentFile
+}
+
+func load(ctx context.Context, r core.ConversationReader, opts Options) (*transcript, error) {
+	thread, err := r.GetThread(ctx, opts.ThreadID)
+	if err != nil {
+		return nil, fmt.Errorf("export: get thread: %w", err)
+	}
+	t := &transcript{
+		Thread:     thread,
+		ThreadName: strconv.FormatInt(opts.ThreadID, 10),
+		Since:      opts.Since,
+		Until:      opts.Until,
+		ExportedAt: time.Now().In(opts.Location),
+		Location:   opts.Location,
+	}
+	if thread != nil && thread.Name != "" {
+		t.ThreadName = thread.Name
+	}
+
+	// Paging newest first keeps the latest messages when MaxMessages cuts.
+	q := core.MessageQuery{ThreadID: opts.ThreadID, Since: opts.Since, Until: opts.Until, Limit: pageSize}
+	var msgs []*core.MessageRecord
+paging:
+	for {
+		page, err := r.QueryMessages(ctx, q)
+		if err != nil {
+			return nil, fmt.Errorf("export: list messages: %w", err)
+		}
+		for _, m := range page {
+			if opts.MaxMessages > 0 && len(msgs) == opts.MaxMessages {
+				t.Truncated = true
+				break paging
+			}
+			msgs = append(msgs, m)
+		}
+		if len(page) < pageSize {
+			break
+		}
+		q.After = page[len(page)-1].MessageID
+	}
+	slices.Reverse(msgs)
+
+	names := make(map[int64]string)
+	byID := make(map[string]*entry, len(msgs))
+	t.Messages = make([]*entry, len(msgs))
+	for i, m := range msgs {
+		e := &entry{MessageRecord: m, SenderName: senderName(ctx, r, names, m)}
+		if m.IsEdited || m.EditCount > 0 {
+			if e.Edits, err = r.GetEditHistory(ctx, m.MessageID); err != nil {
+				return nil, fmt.Errorf("export: edit history of %s: %w", m.MessageID, err)
+			}
+		}
+		if m.HasMedia || len(m.Attachments) > 0 {
+			if e.Files, err = r.LocalAttachments(ctx, m.MessageID); err != nil {
+				return nil, fmt.Errorf("export: archived attachments of %s: %w", m.MessageID, err)
+			}
+		}
+		e.ReplyTo = byID[m.ReplyToMessageID]
+		byID[m.MessageID] = e
+		t.Messages[i] = e
+	}
+	return t, nil
+}
+
+// senderName prefers the name stored with the message, then the user's
+// current name, then their ID.
+func senderName(ctx context.Context, r core.ConversationReader, names map[int64]string, m *core.MessageRecord) string {
+	if m.SenderNameSnapshot != "" {
+		return m.SenderNameSnapshot
+	}
+	if name, ok := names[m.SenderID]; ok {
+		return name
+	}
+	name := strconv.FormatInt(m.SenderID, 10)
+	if user, err := r.GetUser(ctx, m.SenderID); err == nil && user != nil && user.Name != "" {
+		name = user.Name
+	}
+	names[m.SenderID] = name
+	return name
+}
+
+// ── JSON lines ──────────────────────────────────────────────────────────────
+
+type jsonMessage struct {
+	MessageID        string                `json:"message_id"`
+	ThreadID         int64                 `json:"thread_id"`
+	SenderID         int64                 `json:"sender_id"`
+	SenderName       string                `json:"sender_name"`
+	Time             string                `json:"time"`
+	TimestampMs      int64                 `json:"timestamp_ms"`
+	Text             string                `json:"text"`
+	ReplyToMessageID string                `json:"reply_to_message_id,omitempty"`
+	IsFromBot        bool                  `json:"is_from_bot,omitempty"`
+	Edits            []jsonEdit            `json:"edits,omitempty"`
+	IsRecalled       bool                  `json:"is_recalled,omitempty"`
+	RecalledAtMs     int64                 `json:"recalled_at_ms,omitempty"`
+	Attachments      []core.AttachmentMeta `json:"attachments,omitempty"`
+	Mentions         []core.Mention        `json:"mentions,omitempty"`
+	LocalFiles       []jsonLocalFile       `json:"local_files,omitempty"`
+}
+
+// jsonLocalFile is an archived copy of an attachment, named by its hash in
+// the attachment archive.
+type jsonLocalFile struct {
+	AttachmentID string `json:"attachment_id"`
+	SHA256       string `json:"sha256"`
+	MimeType     string `json:"mime_type,omitempty"`
+	SizeBytes    int64  `json:"size_bytes"`
+}
+
+// jsonEdit is an earlier version of a message's text.
+type jsonEdit struct {
+	Text        string `json:"text"`
+	TimestampMs int64  `json:"timestamp_ms"`
+}
+
+func writeJSONL(w io.Writer, t *transcript) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, e := range t.Messages {
+		m := jsonMessage{
+			MessageID:        e.MessageID,
+			ThreadID:         e.ThreadID,
+			SenderID:         e.SenderID,
+			SenderName:       e.SenderName,
+			Time:             t.Format(e.TimestampMs, time.RFC3339),
+			TimestampMs:      e.TimestampMs,
+			Text:             e.Text,
+			ReplyToMessageID: e.ReplyToMessageID,
+			IsFromBot:        e.IsFromBot,
+			IsRecalled:       e.IsRecalled,
+			RecalledAtMs:     e.RecalledAtUnixMs,
+			Attachments:      e.Attachments,
+			Mentions:         e.Mentions,
+		}
+		for _, ed := range e.Edits {
+			m.Edits = append(m.Edits, jsonEdit{Text: ed.Text, TimestampMs: ed.TimestampMs})
+		}
+		for _, f := range e.Files {
+			m.LocalFiles = append(m.LocalFiles, jsonLocalFile{AttachmentID: f.AttachmentID, SHA256: f.SHA256, MimeType: f.MimeType, SizeBytes: f.SizeBytes})
+		}
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ── CSV ─────────────────────────────────────────────────────────────────────
+
+var csvHeader = []string{
+	"time", "message_id", "sender_id", "sender_name", "text", "reply_to_message_id",
+	"is_from_bot", "edit_count", "is_recalled", "attachments",
+}
+
+// writeCSV writes one row per message. The file starts with a UTF-8 byte
+// order mark so spreadsheet apps read Vietnamese text correctly.
+func writeCSV(w io.Writer, t *transcript) error {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range t.Messages {
+		attachments := make([]string, len(e.Attachments))
+		for i, a := range e.Attachments {
+			attachments[i] = attachmentLabel(a)
+		}
+		row := []string{
+			t.Format(e.TimestampMs, time.RFC3339),
+			e.MessageID,
+			strconv.FormatInt(e.SenderID, 10),
+			e.SenderName,
+			e.Text,
+			e.ReplyToMessageID,
+			strconv.FormatBool(e.IsFromBot),
+			strconv.Itoa(max(len(e.Edits), int(e.EditCount))),
+			strconv.FormatBool(e.IsRecalled),
+			strings.Join(attachments, "; "),
+		}
+		for i, cell := range row {
+			row[i] = csvCell(cell)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell keeps a spreadsheet from running cell as a formula: text starting
+// with =, +, - or @ gets a leading ', which spreadsheets hide.
+func csvCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// attachmentLabel describes a as "kind: filename (size)" or its URL.
+func attachmentLabel(a core.AttachmentMeta) string {
+	label := a.Kind
+	if label == "" {
+		label = "file"
+	}
+	switch {
+	case a.Filename != "":
+		label += ": " + a.Filename
+	case a.URL != "":
+		label += ": " + a.URL
+	}
+	if a.SizeBytes > 0 {
+		label += " (" + formatSize(a.SizeBytes) + ")"
+	}
+	return label
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,228 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"mybot/internal/core"
+)
+
+// fakeReader serves messages newest first, like the message store.
+type fakeReader struct {
+	msgs  []*core.MessageRecord // oldest first
+	edits map[string][]*core.MessageEdit
+	files map[string][]*core.AttachmentFile
+}
+
+func (f *fakeReader) GetThread(_ context.Context, threadID int64) (*core.ThreadRecord, error) {
+	return &core.ThreadRecord{ThreadID: threadID, Name: "Nhóm <Phở>"}, nil
+}
+
+func (f *fakeReader) GetUser(_ context.Context, userID int64) (*core.UserRecord, error) {
+	if userID == 7 {
+		return &core.UserRecord{UserID: 7, Name: "Lan"}, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeReader) ListThreadMessages(_ context.Context, _ int64, limit int, before string) ([]*core.MessageRecord, error) {
+	end := len(f.msgs)
+	if before != "" {
+		for i, m := range f.msgs {
+			if m.MessageID == before {
+				end = i
+			}
+		}
+	}
+	var page []*core.MessageRecord
+	for i := end - 1; i >= 0 && len(page) < limit; i-- {
+		page = append(page, f.msgs[i])
+	}
+	return page, nil
+}
+
+func (f *fakeReader) GetEditHistory(_ context.Context, messageID string) ([]*core.MessageEdit, error) {
+	return f.edits[messageID], nil
+}
+
+func (f *fakeReader) ThreadLocation(int64) *time.Location {
+	return time.FixedZone("ICT", 7*3600)
+}
+
+func (f *fakeReader) SearchMessages(context.Context, int64, string, core.SearchFilters) ([]*core.MessageRecord, error) {
+	return nil, nil
+}
+
+func (f *fakeReader) LocalAttachments(_ context.Context, messageID string) ([]*core.AttachmentFile, error) {
+	return f.files[messageID], nil
+}
+
+func (f *fakeReader) ThreadStats(context.Context, int64, core.StatsQuery) (*core.ThreadStats, error) {
+	return nil, nil
+}
+
+func (f *fakeReader) QueryMessages(_ context.Context, q core.MessageQuery) ([]*core.MessageRecord, error) {
+	end := len(f.msgs)
+	if q.After != "" {
+		end = slices.IndexFunc(f.msgs, func(m *core.MessageRecord) bool { return m.MessageID == q.After })
+	}
+	var page []*core.MessageRecord
+	for i := end - 1; i >= 0 && len(page) < q.Limit; i-- {
+		m := f.msgs[i]
+		if !q.Since.IsZero() && m.TimestampMs < q.Since.UnixMilli() || !q.Until.IsZero() && m.TimestampMs >= q.Until.UnixMilli() {
+			continue
+		}
+		page = append(page, m)
+	}
+	return page, nil
+}
+
+func (f *fakeReader) QueryThreads(context.Context, core.ThreadQuery) ([]*core.ThreadRecord, error) {
+	return nil, nil
+}
+
+func (f *fakeReader) QueryUsers(context.Context, core.UserQuery) ([]*core.UserRecord, error) {
+	return nil, nil
+}
+
+func newFakeReader() *fakeReader {
+	day := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC).UnixMilli()
+	r := &fakeReader{edits: map[string][]*core.MessageEdit{
+		"m2": {{MessageID: "m2", Text: "ăn bún", TimestampMs: day + 1000}},
+	}, files: map[string][]*core.AttachmentFile{
+		"m4": {{MessageID: "m4", AttachmentID: "#0", SHA256: "ab12", MimeType: "image/jpeg", SizeBytes: 2048}},
+	}}
+	r.msgs = []*core.MessageRecord{
+		{MessageID: "m1", ThreadID: 1, SenderID: 7, Text: "trưa nay ăn gì?", TimestampMs: day},
+		{MessageID: "m2", ThreadID: 1, SenderID: 8, SenderNameSnapshot: "Minh", Text: "ăn phở", ReplyToMessageID: "m1",
+			IsEdited: true, EditCount: 1, TimestampMs: day + 1000},
+		{MessageID: "m3", ThreadID: 1, SenderID: 7, Text: "spam <script>", IsRecalled: true, RecalledAtUnixMs: day + 5000, TimestampMs: day + 2000},
+		{MessageID: "m4", ThreadID: 1, SenderID: 9, HasMedia: true, TimestampMs: day + 86400000,
+			Attachments: []core.AttachmentMeta{{Kind: "image", Filename: "pho.jpg", MimeType: "image/jpeg", SizeBytes: 2048}}},
+	}
+	// Enough older messages to need several pages.
+	for i := range 450 {
+		r.msgs = append([]*core.MessageRecord{{MessageID: fmt.Sprintf("old%d", i), ThreadID: 1, SenderID: 7, Text: "cũ", TimestampMs: day - 86400000 - int64(i)}}, r.msgs...)
+	}
+	return r
+}
+
+func TestExportJSONLRange(t *testing.T) {
+	r := newFakeReader()
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	stats, err := Export(context.Background(), &buf, r, Options{ThreadID: 1, Format: FormatJSONL, Since: since})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if stats.Messages != 4 || stats.Truncated {
+		t.Fatalf("Export() stats = %+v, want 4 messages", stats)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var got []jsonMessage
+	for _, line := range lines {
+		var m jsonMessage
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		got = append(got, m)
+	}
+	if got[0].MessageID != "m1" || got[0].SenderName != "Lan" || got[0].Time != "2026-10-01T16:00:00+07:00" {
+		t.Errorf("first line = %+v", got[0])
+	}
+	if got[1].SenderName != "Minh" || got[1].ReplyToMessageID != "m1" || len(got[1].Edits) != 1 || got[1].Edits[0].Text != "ăn bún" {
+		t.Errorf("edited reply = %+v", got[1])
+	}
+	if !got[2].IsRecalled || got[3].SenderName != "9" || len(got[3].Attachments) != 1 || len(got[3].LocalFiles) != 1 || got[3].LocalFiles[0].SHA256 != "ab12" {
+		t.Errorf("recalled / attachment lines = %+v, %+v", got[2], got[3])
+	}
+
+	buf.Reset()
+	stats, err = Export(context.Background(), &buf, r, Options{ThreadID: 1, Until: since, MaxMessages: 300})
+	if err != nil || stats.Messages != 300 || !stats.Truncated {
+		t.Fatalf("Export(until, max 300) = %+v, %v", stats, err)
+	}
+	if first := strings.SplitN(buf.String(), "\n", 2)[0]; !strings.Contains(first, `"old299"`) {
+		t.Fatalf("Export(max 300) starts with %s, want the 300th newest message", first)
+	}
+}
+
+func TestExportHTMLAndCSV(t *testing.T) {
+	r := newFakeReader()
+	opts := Options{ThreadID: 1, Format: FormatHTML, Since: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)}
+	var buf bytes.Buffer
+	if _, err := Export(context.Background(), &buf, r, opts); err != nil {
+		t.Fatalf("Export(html) error = %v", err)
+	}
+	page := buf.String()
+	for _, want := range []string{
+		"<title>Nhóm &lt;Phở&gt;</title>",
+		`<a href="#m-m1">↩ Lan: trưa nay ăn gì?</a>`,
+		"Lịch sử sửa (1 bản trước)",
+		"Tin nhắn đã bị thu hồi lúc 16:00 01/10/2026",
+		"spam &lt;script&gt;",
+		"image: pho.jpg (2.0 KB)",
+		`<div class="day">02/10/2026</div>`,
+		"💾 1 tệp đã lưu trên máy chủ",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("HTML export lacks %q", want)
+		}
+	}
+
+	buf.Reset()
+	opts.Format = FormatCSV
+	if _, err := Export(context.Background(), &buf, r, opts); err != nil {
+		t.Fatalf("Export(csv) error = %v", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV: %v", err)
+	}
+	if len(rows) != 5 || rows[0][0] != "time" || rows[2][4] != "ăn phở" || rows[2][7] != "1" || rows[3][8] != "true" {
+		t.Fatalf("CSV rows = %q", rows)
+	}
+}
+
+func TestExportCSVEscapesFormulas(t *testing.T) {
+	r := newFakeReader()
+	day := time.Date(2026, 10, 3, 9, 0, 0, 0, time.UTC).UnixMilli()
+	for i, text := range []string{"=HYPERLINK(\"http://x\")", "+1", "-2", "@SUM(A1)", "a=b"} {
+		r.msgs = append(r.msgs, &core.MessageRecord{MessageID: fmt.Sprintf("f%d", i), ThreadID: 1, SenderID: 7, Text: text, TimestampMs: day + int64(i)})
+	}
+	opts := Options{ThreadID: 1, Format: FormatCSV, Since: time.UnixMilli(day)}
+	var buf bytes.Buffer
+	if _, err := Export(context.Background(), &buf, r, opts); err != nil {
+		t.Fatalf("Export(csv) error = %v", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV: %v", err)
+	}
+	var got []string
+	for _, row := range rows[1:] {
+		got = append(got, row[4])
+	}
+	want := []string{"'=HYPERLINK(\"http://x\")", "'+1", "'-2", "'@SUM(A1)", "a=b"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("CSV texts = %q, want %q", got, want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"json": FormatJSONL, ".HTML": FormatHTML, "csv": FormatCSV} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("pdf"); err == nil {
+		t.Error("ParseFormat(pdf) error = nil")
+	}
+}
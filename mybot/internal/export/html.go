@@ -0,0 +1,120 @@
+package export
+
+import (
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// htmlTemplate renders a transcript as one HTML file with inline styles,
+// readable offline. Attachments are listed, not embedded.
+var htmlTemplate = template.Must(template.New("transcript").Funcs(template.FuncMap{
+	"date":       func(t time.Time) string { return t.Format("02/01/2006") },
+	"newDay":     newDay,
+	"snippet":    snippet,
+	"attachment": attachmentLabel,
+}).Parse(`<!DOCTYPE html>
+<html lang="vi">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.ThreadName}}</title>
+<style>
+body { font-family: system-ui, -apple-system, "Segoe UI", Roboto, sans-serif; background: #f0f2f5; color: #1c1e21; margin: 0; }
+header { background: #fff; padding: 16px 24px; border-bottom: 1px solid #ddd; }
+header h1 { margin: 0 0 4px; font-size: 20px; }
+header p { margin: 0; color: #65676b; font-size: 13px; }
+main { max-width: 820px; margin: 0 auto; padding: 16px; }
+.day { text-align: center; color: #65676b; font-size: 12px; margin: 20px 0 8px; }
+.msg { background: #fff; border-radius: 12px; padding: 8px 12px; margin: 6px 0; }
+.msg.bot { background: #e7f3ff; }
+.msg.recalled { background: #f7f7f7; color: #8a8d91; }
+.meta { font-size: 12px; color: #65676b; }
+.meta b { color: #1c1e21; }
+.badge { background: #1877f2; color: #fff; border-radius: 4px; padding: 0 4px; font-size: 11px; }
+.text { white-space: pre-wrap; word-wrap: break-word; margin-top: 2px; }
+.reply { border-left: 3px solid #ccd0d5; padding-left: 8px; margin: 4px 0; font-size: 13px; color: #65676b; }
+.reply a { color: inherit; }
+details { font-size: 12px; color: #65676b; margin-top: 4px; }
+details ol { margin: 4px 0; padding-left: 20px; }
+ul.files { margin: 4px 0; padding-left: 20px; font-size: 13px; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.ThreadName}}</h1>
+<p>Thread {{if .Thread}}{{.Thread.ThreadID}}{{end}} · {{len .Messages}} tin nhắn
+{{- if not .Since.IsZero}} · từ {{date .Since}}{{end}}
+{{- if not .Until.IsZero}} · trước {{date .Until}}{{end}}
+{{- if .Truncated}} · chỉ gồm các tin mới nhất{{end}} · xuất lúc {{.ExportedAt.Format "15:04 02/01/2006"}}</p>
+</header>
+<main>
+{{- $t := . }}
+{{- range $i, $m := .Messages}}
+{{- if newDay $t $i}}
+<div class="day">{{$t.Format $m.TimestampMs "02/01/2006"}}</div>
+{{- end}}
+<div class="msg{{if $m.IsFromBot}} bot{{end}}{{if $m.IsRecalled}} recalled{{end}}" id="m-{{$m.MessageID}}">
+<div class="meta"><b>{{$m.SenderName}}</b>{{if $m.IsFromBot}} <span class="badge">bot</span>{{end}} · <span title="{{$t.Format $m.TimestampMs "15:04 02/01/2006"}}">{{$t.Format $m.TimestampMs "15:04"}}</span>{{if $m.IsEdited}} · đã sửa{{end}}</div>
+{{- if $m.ReplyTo}}
+<div class="reply"><a href="#m-{{$m.ReplyTo.MessageID}}">↩ {{$m.ReplyTo.SenderName}}: {{snippet $m.ReplyTo.Text}}</a></div>
+{{- else if $m.ReplyToMessageID}}
+<div class="reply">↩ trả lời một tin không có trong bản xuất</div>
+{{- end}}
+{{- if $m.IsRecalled}}
+<div class="text"><i>Tin nhắn đã bị thu hồi{{if $m.RecalledAtUnixMs}} lúc {{$t.Format $m.RecalledAtUnixMs "15:04 02/01/2006"}}{{end}}</i></div>
+{{- end}}
+{{- if $m.Text}}
+<div class="text">{{$m.Text}}</div>
+{{- end}}
+{{- if $m.Attachments}}
+<ul class="files">
+{{- range $m.Attachments}}
+<li>📎 {{if .URL}}<a href="{{.URL}}">{{attachment .}}</a>{{else}}{{attachment .}}{{end}}{{if .MimeType}} · {{.MimeType}}{{end}}</li>
+{{- end}}
+</ul>
+{{- else if $m.HasMedia}}
+<ul class="files"><li>📎 tệp đính kèm</li></ul>
+{{- end}}
+{{- if $m.Files}}
+<div class="meta">💾 {{len $m.Files}} tệp đã lưu trên máy chủ</div>
+{{- end}}
+{{- if $m.Edits}}
+<details><summary>Lịch sử sửa ({{len $m.Edits}} bản trước)</summary>
+<ol>
+{{- range $m.Edits}}
+<li>{{$t.Format .TimestampMs "15:04 02/01/2006"}}: {{.Text}}</li>
+{{- end}}
+</ol>
+</details>
+{{- end}}
+</div>
+{{- end}}
+</main>
+</body>
+</html>
+`))
+
+func writeHTML(w io.Writer, t *transcript) error {
+	return htmlTemplate.Execute(w, t)
+}
+
+// newDay reports whether message i starts a new day in the transcript.
+func newDay(t *transcript, i int) bool {
+	if i == 0 {
+		return true
+	}
+	return t.Format(t.Messages[i].TimestampMs, time.DateOnly) != t.Format(t.Messages[i-1].TimestampMs, time.DateOnly)
+}
+
+// snippetLength is how many characters of a reply target are quoted.
+const snippetLength = 80
+
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > snippetLength {
+		text = string(r[:snippetLength]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,324 @@
+package messaging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+	"mybot/internal/metrics"
+)
+
+// AttachmentSource is an attachment of a projected message, downloadable
+// while its URL lasts.
+type AttachmentSource struct {
+	MessageID    string
+	AttachmentID string // Facebook ID, or "#<position>" when it has none
+	ThreadID     int64
+	IsFromBot    bool
+	URL          string
+	MimeType     string
+	Filename     string
+	SizeBytes    int64 // as announced; 0 = unknown
+}
+
+// AttachmentArchiveStore records which archived file holds each attachment.
+// Files are keyed by the SHA-256 of their content.
+type AttachmentArchiveStore interface {
+	HasAttachmentFile(ctx context.Context, messageID, attachmentID string) (bool, error)
+	// ThreadAttachmentBytes returns the size of the distinct files linked
+	// from threadID's messages.
+	ThreadAttachmentBytes(ctx context.Context, threadID int64) (int64, error)
+	ThreadHasAttachmentBlob(ctx context.Context, threadID int64, sha256 string) (bool, error)
+	// LinkAttachmentFile records the file, if new, and links it from the
+	// attachment's message.
+	LinkAttachmentFile(ctx context.Context, f *core.AttachmentFile) error
+	ListAttachmentFiles(ctx context.Context, messageID string) ([]*core.AttachmentFile, error)
+	// DeleteOrphanAttachmentBlobs deletes up to limit files no message links
+	// to and returns their hashes.
+	DeleteOrphanAttachmentBlobs(ctx context.Context, limit int) ([]string, error)
+}
+
+// ArchivePolicy says what the attachment archive keeps.
+type ArchivePolicy struct {
+	Dir              string
+	MaxFileBytes     int64 // larger files are not kept; 0 = no limit
+	ThreadQuotaBytes int64 // files kept per thread, duplicates counted once; 0 = no quota
+	IncludeBot       bool  // keep the attachments the bot sent too
+	QueueSize        int   // attachments waiting for download; more are dropped
+	CleanupEvery     time.Duration
+}
+
+const (
+	archiveDownloadTimeout = 2 * time.Minute
+	archiveCleanupBatch    = 500
+)
+
+// errArchiveSkipped reports an attachment left out by the policy.
+var errArchiveSkipped = errors.New("attachment skipped")
+
+// AttachmentArchive downloads the attachments of incoming messages into a
+// content-addressed directory: each file is stored once, at
+// <dir>/<first 2 hex digits>/<sha256>, however many messages carry it.
+// Downloads run one at a time in the background, so projection never waits
+// on them.
+type AttachmentArchive struct {
+	log    zerolog.Logger
+	store  AttachmentArchiveStore
+	policy ArchivePolicy
+	client *http.Client
+
+	jobs     chan AttachmentSource
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// EnableAttachmentArchive starts downloading the attachments of projected
+// messages into policy.Dir.
+func (s *Service) EnableAttachmentArchive(store AttachmentArchiveStore, policy ArchivePolicy) error {
+	if policy.QueueSize <= 0 {
+		policy.QueueSize = 1000
+	}
+	if policy.CleanupEvery <= 0 {
+		policy.CleanupEvery = time.Hour
+	}
+	// Downloads cut short by the last shutdown.
+	if err := os.RemoveAll(filepath.Join(policy.Dir, "tmp")); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(policy.Dir, "tmp"), 0o755); err != nil {
+		return err
+	}
+	a := &AttachmentArchive{
+		log:    s.log.With().Str("component", "attachment_archive").Logger(),
+		store:  store,
+		policy: policy,
+		client: &http.Client{Timeout: archiveDownloadTimeout},
+		jobs:   make(chan AttachmentSource, policy.QueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	s.archive = a
+	go a.run()
+	return nil
+}
+
+// LocalAttachments returns the archived copies of messageID's attachments.
+func (s *Service) LocalAttachments(ctx context.Context, messageID string) ([]*core.AttachmentFile, error) {
+	if s.archive == nil {
+		return nil, nil
+	}
+	files, err := s.archive.store.ListAttachmentFiles(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		f.Path = s.archive.path(f.SHA256)
+	}
+	return files, nil
+}
+
+// Close stops the archive, abandoning the queued downloads.
+func (a *AttachmentArchive) Close() {
+	a.stopOnce.Do(func() { close(a.stop) })
+	<-a.done
+}
+
+// enqueue queues the attachments the policy may keep. It never blocks: when
+// the queue is full the attachment is dropped.
+func (a *AttachmentArchive) enqueue(items []AttachmentSource) {
+	for _, item := range items {
+		if item.IsFromBot && !a.policy.IncludeBot {
+			continue
+		}
+		select {
+		case a.jobs <- item:
+		default:
+			metrics.Global.AttachmentsSkipped.Add(1)
+			a.log.Debug().Str("message_id", item.MessageID).Msg("Attachment queue full, dropping")
+		}
+	}
+}
+
+func (a *AttachmentArchive) run() {
+	defer close(a.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-a.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	cleanup := time.NewTicker(a.policy.CleanupEvery)
+	defer cleanup.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case item := <-a.jobs:
+			err := a.archive(ctx, item)
+			switch {
+			case err == nil, ctx.Err() != nil:
+			case errors.Is(err, errArchiveSkipped):
+				metrics.Global.AttachmentsSkipped.Add(1)
+				a.log.Debug().Err(err).Str("message_id", item.MessageID).Int64("thread", item.ThreadID).Msg("Attachment not archived")
+			default:
+				metrics.Global.AttachmentsFailed.Add(1)
+				a.log.Warn().Err(err).Str("message_id", item.MessageID).Int64("thread", item.ThreadID).Msg("Failed to archive attachment")
+			}
+		case <-cleanup.C:
+			if err := a.cleanup(ctx); err != nil && ctx.Err() == nil {
+				a.log.Error().Err(err).Msg("Failed to remove orphan attachment files")
+			}
+		}
+	}
+}
+
+// archive downloads item unless it is already kept, then links it from its
+// message. The thread quota is checked before and after the download, since
+// the size Facebook announces may be missing.
+func (a *AttachmentArchive) archive(ctx context.Context, item AttachmentSource) error {
+	if ok, err := a.store.HasAttachmentFile(ctx, item.MessageID, item.AttachmentID); err != nil || ok {
+		return err
+	}
+	maxBytes := a.policy.MaxFileBytes
+	if maxBytes > 0 && item.SizeBytes > maxBytes {
+		return fmt.Errorf("%w: %d bytes, limit %d", errArchiveSkipped, item.SizeBytes, maxBytes)
+	}
+	var used int64
+	if quota := a.policy.ThreadQuotaBytes; quota > 0 {
+		var err error
+		if used, err = a.store.ThreadAttachmentBytes(ctx, item.ThreadID); err != nil {
+			return err
+		}
+		if used >= quota {
+			return fmt.Errorf("%w: thread quota of %d bytes used", errArchiveSkipped, quota)
+		}
+	}
+
+	tmp, sum, size, mimeType, err := a.download(ctx, item.URL)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if maxBytes > 0 && size > maxBytes {
+		return fmt.Errorf("%w: more than %d bytes", errArchiveSkipped, maxBytes)
+	}
+	if quota := a.policy.ThreadQuotaBytes; quota > 0 && used+size > quota {
+		// A file the thread already holds costs nothing more.
+		if shared, err := a.store.ThreadHasAttachmentBlob(ctx, item.ThreadID, sum); err != nil {
+			return err
+		} else if !shared {
+			return fmt.Errorf("%w: thread quota of %d bytes used", errArchiveSkipped, quota)
+		}
+	}
+
+	dst := a.path(sum)
+	if _, err := os.Stat(dst); err == nil {
+		metrics.Global.AttachmentsDeduped.Add(1)
+	} else if errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			return err
+		}
+		metrics.Global.RecordAttachmentArchived(size)
+	} else {
+		return err
+	}
+
+	if item.MimeType != "" {
+		mimeType = item.MimeType
+	}
+	return a.store.LinkAttachmentFile(ctx, &core.AttachmentFile{
+		MessageID:        item.MessageID,
+		AttachmentID:     item.AttachmentID,
+		ThreadID:         item.ThreadID,
+		SHA256:           sum,
+		SizeBytes:        size,
+		MimeType:         mimeType,
+		ArchivedAtUnixMs: time.Now().UnixMilli(),
+	})
+}
+
+// download fetches url into a temporary file, hashing it on the way. It
+// stops one byte past MaxFileBytes.
+func (a *AttachmentArchive) download(ctx context.Context, url string) (path, sum string, size int64, mimeType string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", 0, "", err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", "", 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Expired CDN URLs answer 403.
+		return "", "", 0, "", fmt.Errorf("download: HTTP %d", resp.StatusCode)
+	}
+
+	f, err := os.CreateTemp(filepath.Join(a.policy.Dir, "tmp"), "dl-")
+	if err != nil {
+		return "", "", 0, "", err
+	}
+	var body io.Reader = resp.Body
+	if a.policy.MaxFileBytes > 0 {
+		body = io.LimitReader(body, a.policy.MaxFileBytes+1)
+	}
+	h := sha256.New()
+	size, err = io.Copy(io.MultiWriter(f, h), body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", 0, "", fmt.Errorf("download: %w", err)
+	}
+	return f.Name(), hex.EncodeToString(h.Sum(nil)), size, resp.Header.Get("Content-Type"), nil
+}
+
+// cleanup removes the files no message links to any more, after retention
+// pruned their messages.
+func (a *AttachmentArchive) cleanup(ctx context.Context) error {
+	removed := 0
+	for {
+		hashes, err := a.store.DeleteOrphanAttachmentBlobs(ctx, archiveCleanupBatch)
+		if err != nil {
+			return err
+		}
+		for _, h := range hashes {
+			if err := os.Remove(a.path(h)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		removed += len(hashes)
+		if len(hashes) < archiveCleanupBatch {
+			break
+		}
+	}
+	if removed > 0 {
+		a.log.Info().Int("files", removed).Msg("Orphan attachment files removed")
+	}
+	return nil
+}
+
+func (a *AttachmentArchive) path(sha256 string) string {
+	return filepath.Join(a.policy.Dir, sha256[:2], sha256)
+}
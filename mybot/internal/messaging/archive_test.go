@@ -0,0 +1,104 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestAttachmentArchiveDedupeAndQuota(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenSQLiteStore(filepath.Join(dir, "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	s := NewService(zerolog.Nop(), store, func() int64 { return 0 }, func() Transport { return nil }, nil)
+	defer s.Close()
+
+	files := map[string]string{
+		"/pho.jpg":  "phở bò tái",
+		"/bun.jpg":  "bún chả Hà Nội, nhiều thịt nướng",
+		"/che.jpg":  "chè ba màu",
+		"/big.mp4":  strings.Repeat("x", 100),
+		"/gone.jpg": "",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok || body == "" {
+			http.Error(w, "URL signature expired", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	pho := files["/pho.jpg"]
+	policy := ArchivePolicy{Dir: filepath.Join(dir, "attachments"), MaxFileBytes: 64, ThreadQuotaBytes: int64(len(pho)) + 10}
+	if err := s.EnableAttachmentArchive(store, policy); err != nil {
+		t.Fatalf("EnableAttachmentArchive() error = %v", err)
+	}
+	a := s.archive
+	item := func(messageID, path string) AttachmentSource {
+		return AttachmentSource{MessageID: messageID, AttachmentID: "#0", ThreadID: 1, URL: srv.URL + path}
+	}
+
+	for _, id := range []string{"m1", "m2", "m1"} {
+		if err := a.archive(ctx, item(id, "/pho.jpg")); err != nil {
+			t.Fatalf("archive(%s) error = %v", id, err)
+		}
+	}
+	got, err := s.LocalAttachments(ctx, "m2")
+	if err != nil || len(got) != 1 {
+		t.Fatalf("LocalAttachments(m2) = %v, %v", got, err)
+	}
+	if data, err := os.ReadFile(got[0].Path); err != nil || string(data) != pho || got[0].MimeType != "image/jpeg" {
+		t.Fatalf("archived file = %q, %v (%+v)", data, err, got[0])
+	}
+	stored, _ := filepath.Glob(filepath.Join(policy.Dir, "*", "*"))
+	if len(stored) != 1 {
+		t.Fatalf("archive holds %v, want one file for the same content", stored)
+	}
+	if used, _ := store.ThreadAttachmentBytes(ctx, 1); used != int64(len(pho)) {
+		t.Errorf("ThreadAttachmentBytes() = %d, want %d", used, len(pho))
+	}
+
+	// Over the thread quota, over the size limit, expired.
+	for path, skipped := range map[string]bool{"/bun.jpg": true, "/big.mp4": true, "/gone.jpg": false} {
+		err := a.archive(ctx, item("m3", path))
+		if err == nil || errors.Is(err, errArchiveSkipped) != skipped {
+			t.Errorf("archive(%s) error = %v, want skipped = %v", path, err, skipped)
+		}
+	}
+	// Another thread has its own quota.
+	other := item("m4", "/che.jpg")
+	other.ThreadID = 2
+	if err := a.archive(ctx, other); err != nil {
+		t.Fatalf("archive(other thread) error = %v", err)
+	}
+	if leftovers, _ := os.ReadDir(filepath.Join(policy.Dir, "tmp")); len(leftovers) != 0 {
+		t.Errorf("tmp holds %d files after downloads", len(leftovers))
+	}
+
+	// Files stay while a message links them.
+	if err := store.deleteMessages([]string{"m1", "m4"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.cleanup(ctx); err != nil {
+		t.Fatalf("cleanup() error = %v", err)
+	}
+	if _, err := os.Stat(got[0].Path); err != nil {
+		t.Errorf("file still linked from m2 was removed: %v", err)
+	}
+	if stored, _ := filepath.Glob(filepath.Join(policy.Dir, "*", "*")); len(stored) != 1 {
+		t.Errorf("after cleanup the archive holds %v, want only the file m2 links", stored)
+	}
+}
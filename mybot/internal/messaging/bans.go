@@ -0,0 +1,187 @@
+package messaging
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+// ErrBanNotFound is returned when lifting a ban that does not exist.
+var ErrBanNotFound = errors.New("ban not found")
+
+// BanStore persists bans.
+type BanStore interface {
+	UpsertBan(ctx context.Context, b *core.Ban) error
+	// DeleteBan deletes the ban of userID in threadID and reports whether
+	// there was one.
+	DeleteBan(ctx context.Context, threadID, userID int64) (bool, error)
+	// DeleteExpiredBans deletes the bans that expired at or before nowMs.
+	DeleteExpiredBans(ctx context.Context, nowMs int64) (int64, error)
+	// ListBans returns every stored ban, newest first.
+	ListBans(ctx context.Context) ([]*core.Ban, error)
+}
+
+// Bans keeps the stored bans in memory, since every incoming message is
+// checked against them.
+type Bans struct {
+	log    zerolog.Logger
+	store  BanStore
+	roleOf RoleResolver
+
+	mu   sync.RWMutex
+	bans map[banKey]*core.Ban
+}
+
+type banKey struct {
+	threadID int64
+	userID   int64
+}
+
+// EnableBans loads the bans in store, dropping expired ones. roleOf keeps
+// admins from being banned in their group and owners from being banned at
+// all.
+func (s *Service) EnableBans(store BanStore, roleOf RoleResolver) error {
+	ctx := context.Background()
+	if _, err := store.DeleteExpiredBans(ctx, time.Now().UnixMilli()); err != nil {
+		return err
+	}
+	items, err := store.ListBans(ctx)
+	if err != nil {
+		return err
+	}
+	bn := &Bans{
+		log:    s.log.With().Str("component", "bans").Logger(),
+		store:  store,
+		roleOf: roleOf,
+		bans:   make(map[banKey]*core.Ban, len(items)),
+	}
+	for _, b := range items {
+		bn.bans[banKey{b.ThreadID, b.UserID}] = b
+	}
+	s.bans = bn
+	return nil
+}
+
+// BannedFor returns the ban that makes the bot ignore userID in threadID: a
+// global ban of the user, a ban in that thread, or a ban of the whole
+// thread. It returns nil when none is active.
+func (s *Service) BannedFor(threadID, userID int64) *core.Ban {
+	bn := s.bans
+	if bn == nil {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	bn.mu.RLock()
+	defer bn.mu.RUnlock()
+	for _, key := range []banKey{{0, userID}, {threadID, userID}, {threadID, 0}} {
+		if b := bn.bans[key]; b != nil && (b.ExpiresAtUnixMs == 0 || b.ExpiresAtUnixMs > now) {
+			return b
+		}
+	}
+	return nil
+}
+
+// Ban adds or replaces the ban of req.UserID in req.ThreadID.
+func (s *Service) Ban(ctx context.Context, req core.BanRequest) (*core.Ban, error) {
+	bn := s.bans
+	if bn == nil {
+		return nil, ErrBansDisabled
+	}
+	if req.ThreadID == 0 && req.UserID == 0 {
+		return nil, ErrInvalidRequest
+	}
+	if req.UserID != 0 && req.UserID == s.SelfID() {
+		return nil, ErrInvalidRequest
+	}
+	now := time.Now()
+	if !req.ExpiresAt.IsZero() && !req.ExpiresAt.After(now) {
+		return nil, ErrInvalidRequest
+	}
+	if req.UserID != 0 && bn.roleOf != nil {
+		// Admins are protected in their own group; a global ban only spares
+		// owners, as being an admin of one group says nothing of the rest.
+		protected := core.RoleAdmin
+		if req.ThreadID == 0 {
+			protected = core.RoleOwner
+		}
+		if bn.roleOf(ctx, req.ThreadID, req.UserID) >= protected {
+			return nil, ErrTargetOutranks
+		}
+	}
+
+	b := &core.Ban{
+		ThreadID:        req.ThreadID,
+		UserID:          req.UserID,
+		Reason:          strings.TrimSpace(req.Reason),
+		CreatorID:       core.RequesterFromContext(ctx),
+		CreatedAtUnixMs: now.UnixMilli(),
+	}
+	if !req.ExpiresAt.IsZero() {
+		b.ExpiresAtUnixMs = req.ExpiresAt.UnixMilli()
+	}
+	if err := bn.store.UpsertBan(ctx, b); err != nil {
+		return nil, err
+	}
+	bn.mu.Lock()
+	bn.bans[banKey{b.ThreadID, b.UserID}] = b
+	bn.mu.Unlock()
+	bn.log.Info().
+		Int64("thread", b.ThreadID).
+		Int64("user", b.UserID).
+		Int64("by", b.CreatorID).
+		Int64("expires_at_ms", b.ExpiresAtUnixMs).
+		Msg("Ban added")
+	return b, nil
+}
+
+// Unban lifts the ban of userID in threadID.
+func (s *Service) Unban(ctx context.Context, threadID, userID int64) error {
+	bn := s.bans
+	if bn == nil {
+		return ErrBansDisabled
+	}
+	existed, err := bn.store.DeleteBan(ctx, threadID, userID)
+	if err != nil {
+		return err
+	}
+	bn.mu.Lock()
+	delete(bn.bans, banKey{threadID, userID})
+	bn.mu.Unlock()
+	if !existed {
+		return ErrBanNotFound
+	}
+	bn.log.Info().Int64("thread", threadID).Int64("user", userID).Int64("by", core.RequesterFromContext(ctx)).Msg("Ban lifted")
+	return nil
+}
+
+// ListBans returns the active bans of threadID, or all of them for 0.
+func (s *Service) ListBans(_ context.Context, threadID int64) ([]*core.Ban, error) {
+	bn := s.bans
+	if bn == nil {
+		return nil, ErrBansDisabled
+	}
+	now := time.Now().UnixMilli()
+	var items []*core.Ban
+	bn.mu.RLock()
+	for key, b := range bn.bans {
+		if threadID != 0 && key.threadID != threadID {
+			continue
+		}
+		if b.ExpiresAtUnixMs == 0 || b.ExpiresAtUnixMs > now {
+			items = append(items, b)
+		}
+	}
+	bn.mu.RUnlock()
+	slices.SortFunc(items, func(a, b *core.Ban) int {
+		return cmp.Compare(b.CreatedAtUnixMs, a.CreatedAtUnixMs)
+	})
+	return items, nil
+}
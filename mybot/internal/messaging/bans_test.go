@@ -0,0 +1,115 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+func TestBansMatchScopesAndReload(t *testing.T) {
+	ctx := core.WithRequester(context.Background(), 1)
+	path := filepath.Join(t.TempDir(), "messages.sqlite")
+	store, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return &fakeTransport{selfID: 42} }, nil)
+
+	if _, err := service.Ban(ctx, core.BanRequest{ThreadID: 1001, UserID: 7}); !errors.Is(err, ErrBansDisabled) {
+		t.Fatalf("Ban() before EnableBans error = %v, want ErrBansDisabled", err)
+	}
+	roleOf := func(_ context.Context, threadID, userID int64) core.Role {
+		switch {
+		case userID == 1:
+			return core.RoleOwner
+		case userID == 9 && threadID == 1001:
+			return core.RoleAdmin
+		}
+		return core.RoleMember
+	}
+	if err := service.EnableBans(store, roleOf); err != nil {
+		t.Fatalf("EnableBans() error = %v", err)
+	}
+
+	for _, req := range []core.BanRequest{
+		{ThreadID: 1001, UserID: 7, Reason: " spam "},
+		{UserID: 8, ExpiresAt: time.Now().Add(time.Hour)},
+		{ThreadID: 3003},
+		{UserID: 9}, // an admin of 1001 only
+	} {
+		if _, err := service.Ban(ctx, req); err != nil {
+			t.Fatalf("Ban(%+v) error = %v", req, err)
+		}
+	}
+	for _, req := range []core.BanRequest{
+		{ThreadID: 1001, UserID: 9},
+		{UserID: 1},
+	} {
+		if _, err := service.Ban(ctx, req); !errors.Is(err, ErrTargetOutranks) {
+			t.Fatalf("Ban(%+v) error = %v, want ErrTargetOutranks", req, err)
+		}
+	}
+	for _, req := range []core.BanRequest{
+		{},
+		{ThreadID: 1001, UserID: 42},
+		{ThreadID: 1001, UserID: 5, ExpiresAt: time.Now().Add(-time.Minute)},
+	} {
+		if _, err := service.Ban(ctx, req); !errors.Is(err, ErrInvalidRequest) {
+			t.Fatalf("Ban(%+v) error = %v, want ErrInvalidRequest", req, err)
+		}
+	}
+
+	check := func(threadID, userID int64, want bool) {
+		t.Helper()
+		if got := service.BannedFor(threadID, userID) != nil; got != want {
+			t.Fatalf("BannedFor(%d, %d) = %v, want %v", threadID, userID, got, want)
+		}
+	}
+	check(1001, 7, true)
+	check(2002, 7, false)
+	check(2002, 8, true)
+	check(3003, 5, true)
+	check(1001, 9, true)
+	check(1001, 5, false)
+
+	bans, err := service.ListBans(ctx, 1001)
+	if err != nil || len(bans) != 1 || bans[0].Reason != "spam" || bans[0].CreatorID != 1 {
+		t.Fatalf("ListBans(1001) = %+v, %v", bans, err)
+	}
+
+	if err := service.Unban(ctx, 1001, 7); err != nil {
+		t.Fatalf("Unban() error = %v", err)
+	}
+	if err := service.Unban(ctx, 1001, 7); !errors.Is(err, ErrBanNotFound) {
+		t.Fatalf("second Unban() error = %v, want ErrBanNotFound", err)
+	}
+	check(1001, 7, false)
+
+	// An expired ban stops matching and is dropped on the next load.
+	if err := store.UpsertBan(ctx, &core.Ban{ThreadID: 1001, UserID: 6, ExpiresAtUnixMs: time.Now().Add(-time.Second).UnixMilli()}); err != nil {
+		t.Fatalf("UpsertBan() error = %v", err)
+	}
+	service.Close()
+
+	store, err = OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	service = NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return &fakeTransport{selfID: 42} }, nil)
+	defer service.Close()
+	if err := service.EnableBans(store, roleOf); err != nil {
+		t.Fatalf("EnableBans() after reopen error = %v", err)
+	}
+	check(1001, 6, false)
+	check(2002, 8, true)
+	check(3003, 5, true)
+	if bans, _ := store.ListBans(ctx); len(bans) != 3 {
+		t.Fatalf("stored bans after reload = %d, want 3", len(bans))
+	}
+}
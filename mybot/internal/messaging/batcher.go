@@ -23,6 +23,7 @@ const (
 	opSetLastBot
 	opClearLastBot
 	opClearLastBotByThread
+	opUpsertMessageEdit
 )
 
 type writeOp struct {
@@ -30,6 +31,7 @@ type writeOp struct {
 	thread *core.ThreadRecord
 	user   *core.UserRecord
 	msg    *core.MessageRecord
+	edit   *core.MessageEdit
 	// for SetLastBotMessage / ClearLastBotMessage
 	threadID  int64
 	messageID string
@@ -38,10 +40,16 @@ type writeOp struct {
 
 // ── WriteBatcher ────────────────────────────────────────────────────────────
 
-// WriteBatcher groups individual write operations into batched SQLite
+// batchWriter is implemented by stores that can commit a whole batch in one
+// transaction. Other stores get the operations applied one by one.
+type batchWriter interface {
+	writeBatch(ops []writeOp) error
+}
+
+// WriteBatcher groups individual write operations into batched
 // transactions for dramatically higher throughput.
 type WriteBatcher struct {
-	store    *SQLiteStore
+	store    Store
 	log      zerolog.Logger
 	queue    chan writeOp
 	maxBatch int
@@ -54,7 +62,7 @@ type WriteBatcher struct {
 
 // NewWriteBatcher creates a batcher that reads from an internal queue and
 // flushes to the underlying store in batched transactions.
-func NewWriteBatcher(store *SQLiteStore, log zerolog.Logger, queueSize, maxBatch int, flushMs int) *WriteBatcher {
+func NewWriteBatcher(store Store, log zerolog.Logger, queueSize, maxBatch int, flushMs int) *WriteBatcher {
 	if queueSize <= 0 {
 		queueSize = 500
 	}
@@ -169,23 +177,26 @@ func (b *WriteBatcher) flush(ops []writeOp) {
 	}
 
 	start := time.Now()
-	err := b.store.ExecBatch(func(tx txExecer) error {
+	var err error
+	if bw, ok := b.store.(batchWriter); ok {
+		err = bw.writeBatch(ops)
+		// Notify all waiters.
 		for i := range ops {
-			if opErr := b.execOp(tx, &ops[i]); opErr != nil {
-				return opErr
+			ops[i].err <- err
+		}
+	} else {
+		for i := range ops {
+			opErr := applyWriteOp(b.store, &ops[i])
+			ops[i].err <- opErr
+			if err == nil {
+				err = opErr
 			}
 		}
-		return nil
-	})
+	}
 	dur := time.Since(start)
 
 	metrics.Global.RecordDBWrite(len(ops), dur)
 
-	// Notify all waiters.
-	for i := range ops {
-		ops[i].err <- err
-	}
-
 	if err != nil {
 		b.log.Error().Err(err).Int("batch_size", len(ops)).Dur("dur", dur).Msg("Batch write failed")
 	} else if dur > 100*time.Millisecond {
@@ -193,20 +204,24 @@ func (b *WriteBatcher) flush(ops []writeOp) {
 	}
 }
 
-func (b *WriteBatcher) execOp(tx txExecer, op *writeOp) error {
+// applyWriteOp performs op through the plain Store methods.
+func applyWriteOp(store Store, op *writeOp) error {
+	ctx := context.Background()
 	switch op.kind {
 	case opUpsertThread:
-		return b.store.upsertThreadTx(tx, op.thread)
+		return store.UpsertThread(ctx, op.thread)
 	case opUpsertUser:
-		return b.store.upsertUserTx(tx, op.user)
+		return store.UpsertUser(ctx, op.user)
 	case opUpsertMessage:
-		return b.store.upsertMessageTx(tx, op.msg)
+		return store.UpsertMessage(ctx, op.msg)
 	case opSetLastBot:
-		return b.store.setLastBotMessageTx(tx, op.threadID, op.messageID)
+		return store.SetLastBotMessage(ctx, op.threadID, op.messageID)
 	case opClearLastBot:
-		return b.store.clearLastBotMessageTx(tx, op.threadID, op.messageID)
+		return store.ClearLastBotMessage(ctx, op.threadID, op.messageID)
 	case opClearLastBotByThread:
-		return b.store.clearLastBotMessageByThreadTx(tx, op.threadID)
+		return store.ClearLastBotMessage(ctx, op.threadID, "")
+	case opUpsertMessageEdit:
+		return store.UpsertMessageEdit(ctx, op.edit)
 	default:
 		return nil
 	}
@@ -1,11 +1,14 @@
 package messaging
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -19,7 +22,15 @@ var (
 	usersBucket        = []byte("users")
 	messagesBucket     = []byte("messages")
 	threadMessagesBuck = []byte("thread_messages")
+	senderMessagesBuck = []byte("sender_messages") // keyed like thread_messages, by sender
+	replyMessagesBuck  = []byte("reply_messages")  // replied-to ID|timestamp|ID
 	threadLastBotBuck  = []byte("thread_last_bot")
+	messageEditsBucket = []byte("message_edits")
+	messagePinsBucket  = []byte("message_pins")
+	participantsBucket = []byte("thread_participants")
+	pollsBucket        = []byte("polls")
+	pollOptionsBucket  = []byte("poll_options")
+	pollVotesBucket    = []byte("poll_votes")
 	metaBucket         = []byte("meta")
 )
 
@@ -42,18 +53,41 @@ func OpenBoltStore(path string) (*BoltStore, error) {
 
 	store := &BoltStore{db: db}
 	err = store.db.Update(func(tx *bolt.Tx) error {
+		// Stores written before the sender and reply indexes existed get
+		// them built once.
+		buildIndexes := tx.Bucket(messagesBucket) != nil && tx.Bucket(senderMessagesBuck) == nil
 		for _, bucket := range [][]byte{
 			threadsBucket,
 			usersBucket,
 			messagesBucket,
 			threadMessagesBuck,
+			senderMessagesBuck,
+			replyMessagesBuck,
 			threadLastBotBuck,
+			messageEditsBucket,
+			messagePinsBucket,
+			participantsBucket,
+			pollsBucket,
+			pollOptionsBucket,
+			pollVotesBucket,
 			metaBucket,
 		} {
 			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
 				return err
 			}
 		}
+		if buildIndexes {
+			err := tx.Bucket(messagesBucket).ForEach(func(_, v []byte) error {
+				rec := &core.MessageRecord{}
+				if err := json.Unmarshal(v, rec); err != nil {
+					return err
+				}
+				return putMessageQueryIndexes(tx, rec)
+			})
+			if err != nil {
+				return err
+			}
+		}
 		return tx.Bucket(metaBucket).Put([]byte("schema_version"), []byte("1"))
 	})
 	if err != nil {
@@ -75,9 +109,11 @@ func (s *BoltStore) UpsertThread(_ context.Context, rec *core.ThreadRecord) erro
 	if rec == nil || rec.ThreadID == 0 {
 		return nil
 	}
-	return s.db.Update(func(tx *bolt.Tx) error {
-		return putJSON(tx.Bucket(threadsBucket), int64Key(rec.ThreadID), rec)
-	})
+	return s.db.Update(func(tx *bolt.Tx) error { return upsertThreadTx(tx, rec) })
+}
+
+func upsertThreadTx(tx *bolt.Tx, rec *core.ThreadRecord) error {
+	return putJSON(tx.Bucket(threadsBucket), int64Key(rec.ThreadID), rec)
 }
 
 func (s *BoltStore) GetThread(_ context.Context, threadID int64) (*core.ThreadRecord, error) {
@@ -88,13 +124,71 @@ func (s *BoltStore) GetThread(_ context.Context, threadID int64) (*core.ThreadRe
 	return rec, err
 }
 
+func (s *BoltStore) ListThreads(_ context.Context) ([]*core.ThreadRecord, error) {
+	var threads []*core.ThreadRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(threadsBucket).ForEach(func(_, v []byte) error {
+			rec := &core.ThreadRecord{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return err
+			}
+			if !rec.Deleted {
+				threads = append(threads, rec)
+			}
+			return nil
+		})
+	})
+	return threads, err
+}
+
+// QueryThreads returns the threads q selects, most recently active first.
+// Each thread's newest message is the last key under its prefix in the
+// thread_messages index.
+func (s *BoltStore) QueryThreads(_ context.Context, q core.ThreadQuery) ([]*core.ThreadRecord, error) {
+	var threads []*core.ThreadRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		msgBucket := tx.Bucket(messagesBucket)
+		index := tx.Bucket(threadMessagesBuck).Cursor()
+		return tx.Bucket(threadsBucket).ForEach(func(_, v []byte) error {
+			rec := &core.ThreadRecord{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return err
+			}
+			prefix := threadPrefix(rec.ThreadID)
+			k, id := index.Seek([]byte(prefix + "\xff"))
+			if k == nil {
+				k, id = index.Last()
+			} else {
+				k, id = index.Prev()
+			}
+			if k != nil && strings.HasPrefix(string(k), prefix) {
+				var newest *core.MessageRecord
+				if err := getJSON(msgBucket, id, &newest); err != nil {
+					return err
+				}
+				if newest != nil {
+					rec.LastActivityMs = max(rec.LastActivityMs, newest.TimestampMs)
+				}
+			}
+			threads = append(threads, rec)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return selectThreads(threads, q), nil
+}
+
 func (s *BoltStore) UpsertUser(_ context.Context, rec *core.UserRecord) error {
 	if rec == nil || rec.UserID == 0 {
 		return nil
 	}
-	return s.db.Update(func(tx *bolt.Tx) error {
-		return putJSON(tx.Bucket(usersBucket), int64Key(rec.UserID), rec)
-	})
+	return s.db.Update(func(tx *bolt.Tx) error { return upsertUserTx(tx, rec) })
+}
+
+func upsertUserTx(tx *bolt.Tx, rec *core.UserRecord) error {
+	return putJSON(tx.Bucket(usersBucket), int64Key(rec.UserID), rec)
 }
 
 func (s *BoltStore) GetUser(_ context.Context, userID int64) (*core.UserRecord, error) {
@@ -105,29 +199,167 @@ func (s *BoltStore) GetUser(_ context.Context, userID int64) (*core.UserRecord,
 	return rec, err
 }
 
+// QueryUsers returns the users q selects, by name.
+func (s *BoltStore) QueryUsers(_ context.Context, q core.UserQuery) ([]*core.UserRecord, error) {
+	var users []*core.UserRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(_, v []byte) error {
+			rec := &core.UserRecord{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return err
+			}
+			users = append(users, rec)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return selectUsers(users, q), nil
+}
+
 func (s *BoltStore) UpsertMessage(_ context.Context, rec *core.MessageRecord) error {
 	if rec == nil || rec.MessageID == "" {
 		return nil
 	}
-	return s.db.Update(func(tx *bolt.Tx) error {
-		msgBucket := tx.Bucket(messagesBucket)
-		indexBucket := tx.Bucket(threadMessagesBuck)
+	return s.db.Update(func(tx *bolt.Tx) error { return upsertMessageTx(tx, rec) })
+}
 
-		var existing *core.MessageRecord
-		if err := getJSON(msgBucket, []byte(rec.MessageID), &existing); err != nil {
+func upsertMessageTx(tx *bolt.Tx, rec *core.MessageRecord) error {
+	msgBucket := tx.Bucket(messagesBucket)
+	indexBucket := tx.Bucket(threadMessagesBuck)
+
+	var existing *core.MessageRecord
+	if err := getJSON(msgBucket, []byte(rec.MessageID), &existing); err != nil {
+		return err
+	}
+	if existing != nil {
+		if err := indexBucket.Delete(messageIndexKey(existing.ThreadID, existing.TimestampMs, existing.MessageID)); err != nil {
 			return err
 		}
-		if existing != nil {
-			if err := indexBucket.Delete(messageIndexKey(existing.ThreadID, existing.TimestampMs, existing.MessageID)); err != nil {
-				return err
-			}
+		if err := tx.Bucket(senderMessagesBuck).Delete(messageIndexKey(existing.SenderID, existing.TimestampMs, existing.MessageID)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(replyMessagesBuck).Delete(replyIndexKey(existing.ReplyToMessageID, existing.TimestampMs, existing.MessageID)); err != nil {
+			return err
+		}
+	}
+
+	if err := putJSON(msgBucket, []byte(rec.MessageID), rec); err != nil {
+		return err
+	}
+	if err := indexBucket.Put(messageIndexKey(rec.ThreadID, rec.TimestampMs, rec.MessageID), []byte(rec.MessageID)); err != nil {
+		return err
+	}
+	return putMessageQueryIndexes(tx, rec)
+}
+
+// putMessageQueryIndexes indexes rec by sender and, for a reply, by the
+// message it replies to.
+func putMessageQueryIndexes(tx *bolt.Tx, rec *core.MessageRecord) error {
+	if err := tx.Bucket(senderMessagesBuck).Put(messageIndexKey(rec.SenderID, rec.TimestampMs, rec.MessageID), []byte(rec.MessageID)); err != nil {
+		return err
+	}
+	if rec.ReplyToMessageID == "" {
+		return nil
+	}
+	return tx.Bucket(replyMessagesBuck).Put(replyIndexKey(rec.ReplyToMessageID, rec.TimestampMs, rec.MessageID), []byte(rec.MessageID))
+}
+
+// QueryMessages returns the messages q selects. A thread, sender or
+// reply-to filter walks its index between the time bounds; a query with
+// none of them scans every message.
+func (s *BoltStore) QueryMessages(ctx context.Context, q core.MessageQuery) ([]*core.MessageRecord, error) {
+	var after *core.MessageRecord
+	if q.After != "" {
+		var err error
+		if after, err = s.GetMessage(ctx, q.After); err != nil {
+			return nil, err
+		}
+		if after == nil {
+			return nil, ErrMessageNotFound
 		}
+	}
+
+	var bucket []byte
+	var prefix string
+	switch {
+	case q.ThreadID != 0:
+		bucket, prefix = threadMessagesBuck, threadPrefix(q.ThreadID)
+	case q.SenderID != 0:
+		bucket, prefix = senderMessagesBuck, threadPrefix(q.SenderID)
+	case q.ReplyToMessageID != "":
+		bucket, prefix = replyMessagesBuck, replyPrefix(q.ReplyToMessageID)
+	}
 
-		if err := putJSON(msgBucket, []byte(rec.MessageID), rec); err != nil {
+	limit := queryLimit(q.Limit, defaultMessageQueryLimit)
+	var results []*core.MessageRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		msgBucket := tx.Bucket(messagesBucket)
+		if bucket == nil {
+			var all []*core.MessageRecord
+			err := msgBucket.ForEach(func(_, v []byte) error {
+				rec := &core.MessageRecord{}
+				if err := json.Unmarshal(v, rec); err != nil {
+					return err
+				}
+				all = append(all, rec)
+				return nil
+			})
+			results = selectMessages(all, q, after)
 			return err
 		}
-		return indexBucket.Put(messageIndexKey(rec.ThreadID, rec.TimestampMs, rec.MessageID), []byte(rec.MessageID))
+
+		// Keys in [lo, hi) are the candidates; the cursor narrows one end.
+		lo, hi := []byte(prefix), []byte(prefix+"\xff")
+		if !q.Since.IsZero() {
+			lo = indexKey(prefix, q.Since.UnixMilli(), "")
+		}
+		if !q.Until.IsZero() {
+			hi = indexKey(prefix, q.Until.UnixMilli(), "")
+		}
+		if after != nil {
+			key := indexKey(prefix, after.TimestampMs, after.MessageID)
+			if q.Oldest {
+				lo = slices.MaxFunc([][]byte{lo, append(key, 0)}, bytes.Compare)
+			} else {
+				hi = slices.MinFunc([][]byte{hi, key}, bytes.Compare)
+			}
+		}
+
+		keep := func(v []byte) error {
+			var rec *core.MessageRecord
+			if err := getJSON(msgBucket, v, &rec); err != nil {
+				return err
+			}
+			if rec != nil && messageMatches(rec, q) {
+				results = append(results, rec)
+			}
+			return nil
+		}
+		c := tx.Bucket(bucket).Cursor()
+		if q.Oldest {
+			for k, v := c.Seek(lo); k != nil && bytes.Compare(k, hi) < 0 && len(results) < limit; k, v = c.Next() {
+				if err := keep(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		k, v := c.Seek(hi)
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && bytes.Compare(k, lo) >= 0 && len(results) < limit; k, v = c.Prev() {
+			if err := keep(v); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
+	return results, err
 }
 
 func (s *BoltStore) GetMessage(_ context.Context, messageID string) (*core.MessageRecord, error) {
@@ -201,9 +433,11 @@ func (s *BoltStore) SetLastBotMessage(_ context.Context, threadID int64, message
 	if threadID == 0 || messageID == "" {
 		return nil
 	}
-	return s.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket(threadLastBotBuck).Put(int64Key(threadID), []byte(messageID))
-	})
+	return s.db.Update(func(tx *bolt.Tx) error { return setLastBotMessageTx(tx, threadID, messageID) })
+}
+
+func setLastBotMessageTx(tx *bolt.Tx, threadID int64, messageID string) error {
+	return tx.Bucket(threadLastBotBuck).Put(int64Key(threadID), []byte(messageID))
 }
 
 func (s *BoltStore) GetLastBotMessage(ctx context.Context, threadID int64) (*core.MessageRecord, error) {
@@ -225,15 +459,432 @@ func (s *BoltStore) ClearLastBotMessage(_ context.Context, threadID int64, messa
 	if threadID == 0 {
 		return nil
 	}
+	return s.db.Update(func(tx *bolt.Tx) error { return clearLastBotMessageTx(tx, threadID, messageID) })
+}
+
+// clearLastBotMessageTx forgets the last bot message of threadID if it is
+// messageID, or whatever it is when messageID is empty.
+func clearLastBotMessageTx(tx *bolt.Tx, threadID int64, messageID string) error {
+	bucket := tx.Bucket(threadLastBotBuck)
+	if messageID != "" {
+		current := bucket.Get(int64Key(threadID))
+		if string(current) != messageID {
+			return nil
+		}
+	}
+	return bucket.Delete(int64Key(threadID))
+}
+
+func (s *BoltStore) UpsertMessageEdit(_ context.Context, rec *core.MessageEdit) error {
+	if rec == nil || rec.MessageID == "" {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error { return upsertMessageEditTx(tx, rec) })
+}
+
+func upsertMessageEditTx(tx *bolt.Tx, rec *core.MessageEdit) error {
+	return putJSON(tx.Bucket(messageEditsBucket), messageEditKey(rec.MessageID, rec.TimestampMs), rec)
+}
+
+// writeBatch commits ops from the WriteBatcher in one transaction, with the
+// same checks as the single-write methods.
+func (s *BoltStore) writeBatch(ops []writeOp) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(threadLastBotBuck)
-		if messageID != "" {
-			current := bucket.Get(int64Key(threadID))
-			if string(current) != messageID {
-				return nil
+		for i := range ops {
+			if err := execWriteOpTx(tx, &ops[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func execWriteOpTx(tx *bolt.Tx, op *writeOp) error {
+	switch op.kind {
+	case opUpsertThread:
+		if op.thread == nil || op.thread.ThreadID == 0 {
+			return nil
+		}
+		return upsertThreadTx(tx, op.thread)
+	case opUpsertUser:
+		if op.user == nil || op.user.UserID == 0 {
+			return nil
+		}
+		return upsertUserTx(tx, op.user)
+	case opUpsertMessage:
+		if op.msg == nil || op.msg.MessageID == "" {
+			return nil
+		}
+		return upsertMessageTx(tx, op.msg)
+	case opSetLastBot:
+		if op.threadID == 0 || op.messageID == "" {
+			return nil
+		}
+		return setLastBotMessageTx(tx, op.threadID, op.messageID)
+	case opClearLastBot, opClearLastBotByThread:
+		if op.threadID == 0 {
+			return nil
+		}
+		return clearLastBotMessageTx(tx, op.threadID, op.messageID)
+	case opUpsertMessageEdit:
+		if op.edit == nil || op.edit.MessageID == "" {
+			return nil
+		}
+		return upsertMessageEditTx(tx, op.edit)
+	default:
+		return nil
+	}
+}
+
+func (s *BoltStore) ListMessageEdits(_ context.Context, messageID string) ([]*core.MessageEdit, error) {
+	if messageID == "" {
+		return nil, nil
+	}
+	var results []*core.MessageEdit
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(messageEditsBucket).Cursor()
+		prefix := []byte(messageID + "|")
+		for k, _ := cursor.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = cursor.Next() {
+			var rec *core.MessageEdit
+			if err := getJSON(tx.Bucket(messageEditsBucket), k, &rec); err != nil {
+				return err
+			}
+			if rec != nil {
+				results = append(results, rec)
+			}
+		}
+		return nil
+	})
+	return results, err
+}
+
+func (s *BoltStore) SetMessagePinned(_ context.Context, rec *core.MessagePin) error {
+	if rec == nil || rec.MessageID == "" {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(messagePinsBucket)
+		if rec.PinnedAtUnixMs == 0 {
+			return bucket.Delete(messagePinKey(rec.ThreadID, rec.MessageID))
+		}
+		return putJSON(bucket, messagePinKey(rec.ThreadID, rec.MessageID), rec)
+	})
+}
+
+func (s *BoltStore) ClearPinnedMessages(ctx context.Context, threadID int64) error {
+	// Collect first: bolt cursors may be invalidated by writes mid-scan.
+	pins, err := s.ListPinnedMessages(ctx, threadID)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(messagePinsBucket)
+		for _, p := range pins {
+			if err := bucket.Delete(messagePinKey(threadID, p.MessageID)); err != nil {
+				return err
 			}
 		}
-		return bucket.Delete(int64Key(threadID))
+		return nil
+	})
+}
+
+func (s *BoltStore) ListPinnedMessages(_ context.Context, threadID int64) ([]*core.MessagePin, error) {
+	var items []*core.MessagePin
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(messagePinsBucket).Cursor()
+		prefix := []byte(threadPrefix(threadID))
+		for k, v := cursor.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = cursor.Next() {
+			rec := &core.MessagePin{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return err
+			}
+			items = append(items, rec)
+		}
+		return nil
+	})
+	slices.SortStableFunc(items, func(a, b *core.MessagePin) int { return cmp.Compare(b.PinnedAtUnixMs, a.PinnedAtUnixMs) })
+	return items, err
+}
+
+func (s *BoltStore) UpsertParticipant(_ context.Context, rec *core.ThreadParticipant) error {
+	if rec == nil || rec.ThreadID == 0 || rec.UserID == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(participantsBucket), participantKey(rec.ThreadID, rec.UserID), rec)
+	})
+}
+
+func (s *BoltStore) GetParticipant(_ context.Context, threadID, userID int64) (*core.ThreadParticipant, error) {
+	var rec *core.ThreadParticipant
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(participantsBucket), participantKey(threadID, userID), &rec)
+	})
+	return rec, err
+}
+
+func (s *BoltStore) ListParticipants(_ context.Context, threadID int64) ([]*core.ThreadParticipant, error) {
+	var admins, members []*core.ThreadParticipant
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(participantsBucket).Cursor()
+		prefix := []byte(threadPrefix(threadID))
+		for k, v := cursor.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = cursor.Next() {
+			rec := &core.ThreadParticipant{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return err
+			}
+			if rec.IsAdmin {
+				admins = append(admins, rec)
+			} else {
+				members = append(members, rec)
+			}
+		}
+		return nil
+	})
+	return append(admins, members...), err
+}
+
+func (s *BoltStore) DeleteParticipant(_ context.Context, threadID, userID int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(participantsBucket).Delete(participantKey(threadID, userID))
+	})
+}
+
+func (s *BoltStore) SetParticipantsAdmin(ctx context.Context, threadID int64, isAdmin bool) error {
+	// Collect first: bolt cursors may be invalidated by writes mid-scan.
+	participants, err := s.ListParticipants(ctx, threadID)
+	if err != nil {
+		return err
+	}
+	nowMs := time.Now().UnixMilli()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(participantsBucket)
+		for _, rec := range participants {
+			rec.IsAdmin = isAdmin
+			rec.UpdatedAtUnixMs = nowMs
+			if err := putJSON(bucket, participantKey(rec.ThreadID, rec.UserID), rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) UpsertPoll(_ context.Context, rec *core.Poll) error {
+	if rec == nil || rec.ID == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(pollsBucket), int64Key(rec.ID), rec)
+	})
+}
+
+func (s *BoltStore) GetPoll(_ context.Context, pollID int64) (*core.Poll, error) {
+	var rec *core.Poll
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(pollsBucket), int64Key(pollID), &rec)
+	})
+	return rec, err
+}
+
+func (s *BoltStore) ListPolls(_ context.Context, threadID int64, limit int) ([]*core.Poll, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	items, err := s.scanPolls(func(p *core.Poll) bool { return p.ThreadID == threadID })
+	slices.SortFunc(items, func(a, b *core.Poll) int {
+		if a.CreatedAtUnixMs != b.CreatedAtUnixMs {
+			return cmp.Compare(b.CreatedAtUnixMs, a.CreatedAtUnixMs)
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return items[:min(limit, len(items))], err
+}
+
+func (s *BoltStore) ListDuePolls(_ context.Context, untilMs int64) ([]*core.Poll, error) {
+	items, err := s.scanPolls(func(p *core.Poll) bool {
+		return p.Status == core.PollOpen && p.ClosesAtUnixMs > 0 && p.ClosesAtUnixMs <= untilMs
+	})
+	slices.SortFunc(items, func(a, b *core.Poll) int { return cmp.Compare(a.ClosesAtUnixMs, b.ClosesAtUnixMs) })
+	return items, err
+}
+
+func (s *BoltStore) NextPollCloseAt(_ context.Context) (int64, error) {
+	items, err := s.scanPolls(func(p *core.Poll) bool { return p.Status == core.PollOpen && p.ClosesAtUnixMs > 0 })
+	var next int64
+	for _, p := range items {
+		if next == 0 || p.ClosesAtUnixMs < next {
+			next = p.ClosesAtUnixMs
+		}
+	}
+	return next, err
+}
+
+// scanPolls returns every stored poll that keep accepts.
+func (s *BoltStore) scanPolls(keep func(*core.Poll) bool) ([]*core.Poll, error) {
+	var items []*core.Poll
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pollsBucket).ForEach(func(_, v []byte) error {
+			rec := &core.Poll{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return err
+			}
+			if keep(rec) {
+				items = append(items, rec)
+			}
+			return nil
+		})
+	})
+	return items, err
+}
+
+func (s *BoltStore) UpsertPollOption(_ context.Context, rec *core.PollOption) error {
+	if rec == nil || rec.PollID == 0 || rec.OptionID == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(pollOptionsBucket), pollOptionKey(rec.PollID, rec.OptionID), rec)
+	})
+}
+
+func (s *BoltStore) ListPollOptions(_ context.Context, pollID int64) ([]*core.PollOption, error) {
+	var items []*core.PollOption
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(pollOptionsBucket).Cursor()
+		prefix := []byte(pollPrefix(pollID))
+		for k, v := cursor.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = cursor.Next() {
+			rec := &core.PollOption{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return err
+			}
+			items = append(items, rec)
+		}
+		return nil
+	})
+	slices.SortStableFunc(items, func(a, b *core.PollOption) int { return cmp.Compare(a.Position, b.Position) })
+	return items, err
+}
+
+func (s *BoltStore) UpsertPollVote(_ context.Context, rec *core.PollVote) error {
+	if rec == nil || rec.PollID == 0 || rec.OptionID == 0 || rec.UserID == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(pollVotesBucket), pollVoteKey(rec.PollID, rec.OptionID, rec.UserID), rec)
+	})
+}
+
+func (s *BoltStore) ReplacePollVotes(ctx context.Context, pollID int64, votes []*core.PollVote) error {
+	// Collect first: bolt cursors may be invalidated by writes mid-scan.
+	old, err := s.ListPollVotes(ctx, pollID)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pollVotesBucket)
+		for _, v := range old {
+			if err := bucket.Delete(pollVoteKey(pollID, v.OptionID, v.UserID)); err != nil {
+				return err
+			}
+		}
+		for _, v := range votes {
+			if v.OptionID == 0 || v.UserID == 0 {
+				continue
+			}
+			rec := *v
+			rec.PollID = pollID
+			if err := putJSON(bucket, pollVoteKey(pollID, v.OptionID, v.UserID), &rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) ListPollVotes(_ context.Context, pollID int64) ([]*core.PollVote, error) {
+	var items []*core.PollVote
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(pollVotesBucket).Cursor()
+		prefix := []byte(pollPrefix(pollID))
+		for k, v := cursor.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = cursor.Next() {
+			rec := &core.PollVote{}
+			if err := json.Unmarshal(v, rec); err != nil {
+				return err
+			}
+			items = append(items, rec)
+		}
+		return nil
+	})
+	slices.SortStableFunc(items, func(a, b *core.PollVote) int { return cmp.Compare(a.VotedAtUnixMs, b.VotedAtUnixMs) })
+	return items, err
+}
+
+// Snapshot writes a consistent copy of the database to path from one read
+// transaction; writes carry on meanwhile.
+func (s *BoltStore) Snapshot(_ context.Context, path string) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0o600)
+	})
+}
+
+// Dump reads every record from one read transaction, for CopyStore.
+func (s *BoltStore) Dump(_ context.Context, fn func(DumpRecord) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		steps := []func() error{
+			func() error {
+				return dumpBucket(tx, threadsBucket, func(r *core.ThreadRecord) DumpRecord { return DumpRecord{Thread: r} }, fn)
+			},
+			func() error {
+				return dumpBucket(tx, usersBucket, func(r *core.UserRecord) DumpRecord { return DumpRecord{User: r} }, fn)
+			},
+			func() error {
+				return dumpBucket(tx, messagesBucket, func(r *core.MessageRecord) DumpRecord { return DumpRecord{Message: r} }, fn)
+			},
+			func() error {
+				return dumpBucket(tx, messageEditsBucket, func(r *core.MessageEdit) DumpRecord { return DumpRecord{Edit: r} }, fn)
+			},
+			func() error {
+				return tx.Bucket(threadLastBotBuck).ForEach(func(k, v []byte) error {
+					var threadID int64
+					if _, err := fmt.Sscanf(string(k), "%d", &threadID); err != nil {
+						return fmt.Errorf("bad thread_last_bot key %q: %w", k, err)
+					}
+					return fn(DumpRecord{LastBot: &LastBotMessage{ThreadID: threadID, MessageID: string(v)}})
+				})
+			},
+			func() error {
+				return dumpBucket(tx, messagePinsBucket, func(r *core.MessagePin) DumpRecord { return DumpRecord{Pin: r} }, fn)
+			},
+			func() error {
+				return dumpBucket(tx, participantsBucket, func(r *core.ThreadParticipant) DumpRecord { return DumpRecord{Participant: r} }, fn)
+			},
+			func() error {
+				return dumpBucket(tx, pollsBucket, func(r *core.Poll) DumpRecord { return DumpRecord{Poll: r} }, fn)
+			},
+			func() error {
+				return dumpBucket(tx, pollOptionsBucket, func(r *core.PollOption) DumpRecord { return DumpRecord{PollOption: r} }, fn)
+			},
+			func() error {
+				return dumpBucket(tx, pollVotesBucket, func(r *core.PollVote) DumpRecord { return DumpRecord{PollVote: r} }, fn)
+			},
+		}
+		for _, step := range steps {
+			if err := step(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// dumpBucket decodes every value of bucket as a T and passes it to fn.
+func dumpBucket[T any](tx *bolt.Tx, bucket []byte, wrap func(*T) DumpRecord, fn func(DumpRecord) error) error {
+	return tx.Bucket(bucket).ForEach(func(_, v []byte) error {
+		rec := new(T)
+		if err := json.Unmarshal(v, rec); err != nil {
+			return err
+		}
+		return fn(wrap(rec))
 	})
 }
 
@@ -267,9 +918,53 @@ func threadPrefix(threadID int64) string {
 	return fmt.Sprintf("%020d|", threadID)
 }
 
+func participantKey(threadID, userID int64) []byte {
+	return []byte(fmt.Sprintf("%020d|%020d", threadID, userID))
+}
+
+func pollPrefix(pollID int64) string {
+	return fmt.Sprintf("%020d|", pollID)
+}
+
+func pollOptionKey(pollID, optionID int64) []byte {
+	return []byte(fmt.Sprintf("%020d|%020d", pollID, optionID))
+}
+
+func pollVoteKey(pollID, optionID, userID int64) []byte {
+	return []byte(fmt.Sprintf("%020d|%020d|%020d", pollID, optionID, userID))
+}
+
+func messageEditKey(messageID string, timestampMs int64) []byte {
+	if timestampMs < 0 {
+		timestampMs = 0
+	}
+	return []byte(fmt.Sprintf("%s|%020d", messageID, timestampMs))
+}
+
+func messagePinKey(threadID int64, messageID string) []byte {
+	return []byte(fmt.Sprintf("%020d|%s", threadID, messageID))
+}
+
 func messageIndexKey(threadID, timestampMs int64, messageID string) []byte {
+	return indexKey(threadPrefix(threadID), timestampMs, messageID)
+}
+
+func replyPrefix(messageID string) string {
+	return messageID + "|"
+}
+
+func replyIndexKey(replyToMessageID string, timestampMs int64, messageID string) []byte {
+	return indexKey(replyPrefix(replyToMessageID), timestampMs, messageID)
+}
+
+// indexKey is the key of a message under prefix in a time-ordered index.
+// An empty messageID gives the bound below every message at timestampMs.
+func indexKey(prefix string, timestampMs int64, messageID string) []byte {
 	if timestampMs < 0 {
 		timestampMs = 0
 	}
-	return []byte(fmt.Sprintf("%020d|%020d|%s", threadID, timestampMs, messageID))
+	if messageID == "" {
+		return []byte(fmt.Sprintf("%s%020d|", prefix, timestampMs))
+	}
+	return []byte(fmt.Sprintf("%s%020d|%s", prefix, timestampMs, messageID))
 }
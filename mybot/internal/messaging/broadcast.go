@@ -0,0 +1,404 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+const (
+	// broadcastSendTimeout bounds a single delivery of a broadcast.
+	broadcastSendTimeout = 2 * time.Minute
+	// broadcastIdleWait is how often the store is re-checked without a
+	// wake-up.
+	broadcastIdleWait = time.Minute
+	// broadcastReportFailures is how many failed threads a report lists.
+	broadcastReportFailures = 10
+)
+
+// BroadcastStore persists broadcasts and their per-thread progress.
+type BroadcastStore interface {
+	InsertBroadcast(ctx context.Context, b *core.Broadcast, threadIDs []int64) (int64, error)
+	UpdateBroadcast(ctx context.Context, b *core.Broadcast) error
+	GetBroadcast(ctx context.Context, id int64) (*core.Broadcast, error)
+	// ListBroadcasts returns up to limit broadcasts with status ("" for
+	// any), newest first.
+	ListBroadcasts(ctx context.Context, status core.BroadcastStatus, limit int) ([]*core.Broadcast, error)
+	// NextBroadcastDelivery returns the next pending delivery of broadcast
+	// id, or nil when none is left.
+	NextBroadcastDelivery(ctx context.Context, id int64) (*core.BroadcastDelivery, error)
+	ListBroadcastDeliveries(ctx context.Context, id int64, status core.DeliveryStatus) ([]*core.BroadcastDelivery, error)
+	UpdateBroadcastDelivery(ctx context.Context, d *core.BroadcastDelivery) error
+	// GetQueuedBroadcastDelivery returns the queued delivery handed to the
+	// outbox as outboxID, or nil.
+	GetQueuedBroadcastDelivery(ctx context.Context, outboxID int64) (*core.BroadcastDelivery, error)
+}
+
+// Broadcaster delivers broadcasts one thread at a time, pausing between
+// threads. Each delivery goes through the service's normal send path (rate
+// limited per thread, queued in the outbox while disconnected) and is
+// recorded, so a broadcast interrupted by a restart carries on where it
+// stopped. Broadcasts run one after another, oldest first.
+type Broadcaster struct {
+	log     zerolog.Logger
+	store   BroadcastStore
+	service *Service
+	delay   time.Duration
+
+	mu sync.Mutex // serialises status changes with deliveries
+
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// EnableBroadcasts stores broadcasts in store and starts delivering them,
+// waiting delay between threads. Broadcasts left running by a previous
+// process are resumed.
+func (s *Service) EnableBroadcasts(store BroadcastStore, delay time.Duration) {
+	bc := &Broadcaster{
+		log:     s.log.With().Str("component", "broadcast").Logger(),
+		store:   store,
+		service: s,
+		delay:   delay,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.broadcaster = bc
+	go bc.run()
+}
+
+// BroadcastTargets resolves target to the IDs of the threads it selects.
+func (s *Service) BroadcastTargets(ctx context.Context, target core.BroadcastTarget) ([]int64, error) {
+	if target.Kind == core.BroadcastList {
+		ids := slices.Clone(target.ThreadIDs)
+		slices.Sort(ids)
+		return slices.Compact(ids), nil
+	}
+	q := core.ThreadQuery{GroupsOnly: target.Kind == core.BroadcastGroups}
+	switch target.Kind {
+	case core.BroadcastAll, core.BroadcastGroups:
+	case core.BroadcastActive:
+		if target.ActiveDays <= 0 {
+			return nil, errors.New("active broadcast needs a positive number of days")
+		}
+		q.ActiveSince = time.Now().AddDate(0, 0, -target.ActiveDays)
+	default:
+		return nil, fmt.Errorf("unknown broadcast target %q", target.Kind)
+	}
+	threads, err := s.store.QueryThreads(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(threads))
+	for i, t := range threads {
+		ids[i] = t.ThreadID
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// StartBroadcast queues text for every thread of target.
+func (s *Service) StartBroadcast(ctx context.Context, originThreadID int64, text string, target core.BroadcastTarget) (*core.Broadcast, error) {
+	if s.broadcaster == nil {
+		return nil, ErrBroadcastDisabled
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("empty broadcast text")
+	}
+	threadIDs, err := s.BroadcastTargets(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(threadIDs) == 0 {
+		return nil, errors.New("no threads match the broadcast target")
+	}
+	nowMs := time.Now().UnixMilli()
+	b := &core.Broadcast{
+		CreatorID:       core.RequesterFromContext(ctx),
+		OriginThreadID:  originThreadID,
+		Text:            text,
+		Target:          target.String(),
+		Status:          core.BroadcastRunning,
+		Total:           len(threadIDs),
+		CreatedAtUnixMs: nowMs,
+		UpdatedAtUnixMs: nowMs,
+	}
+	id, err := s.broadcaster.store.InsertBroadcast(ctx, b, threadIDs)
+	if err != nil {
+		return nil, fmt.Errorf("start broadcast: %w", err)
+	}
+	b.ID = id
+	s.broadcaster.log.Info().Int64("broadcast_id", id).Str("target", b.Target).Int("threads", b.Total).
+		Int64("creator", b.CreatorID).Msg("Broadcast started")
+	s.broadcaster.Wake()
+	return b, nil
+}
+
+// GetBroadcast returns broadcast id, or nil if there is none.
+func (s *Service) GetBroadcast(ctx context.Context, id int64) (*core.Broadcast, error) {
+	if s.broadcaster == nil {
+		return nil, ErrBroadcastDisabled
+	}
+	return s.broadcaster.store.GetBroadcast(ctx, id)
+}
+
+// ListBroadcasts returns up to limit broadcasts, newest first.
+func (s *Service) ListBroadcasts(ctx context.Context, limit int) ([]*core.Broadcast, error) {
+	if s.broadcaster == nil {
+		return nil, ErrBroadcastDisabled
+	}
+	return s.broadcaster.store.ListBroadcasts(ctx, "", limit)
+}
+
+// CancelBroadcast stops running broadcast id.
+func (s *Service) CancelBroadcast(ctx context.Context, id int64) error {
+	if s.broadcaster == nil {
+		return ErrBroadcastDisabled
+	}
+	bc := s.broadcaster
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	b, err := bc.store.GetBroadcast(ctx, id)
+	if err != nil {
+		return err
+	}
+	if b == nil || b.Status != core.BroadcastRunning {
+		return ErrMessageNotFound
+	}
+	nowMs := time.Now().UnixMilli()
+	b.Status = core.BroadcastCancelled
+	b.UpdatedAtUnixMs = nowMs
+	b.FinishedAtUnixMs = nowMs
+	if err := bc.store.UpdateBroadcast(ctx, b); err != nil {
+		return err
+	}
+	bc.log.Info().Int64("broadcast_id", id).Int("sent", b.Sent).Int("failed", b.Failed).Msg("Broadcast cancelled")
+	return nil
+}
+
+// BroadcastReport renders the delivery report of broadcast id.
+func (s *Service) BroadcastReport(ctx context.Context, id int64) (string, error) {
+	if s.broadcaster == nil {
+		return "", ErrBroadcastDisabled
+	}
+	b, err := s.broadcaster.store.GetBroadcast(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if b == nil {
+		return "", ErrMessageNotFound
+	}
+	failed, err := s.broadcaster.store.ListBroadcastDeliveries(ctx, id, core.DeliveryFailed)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	switch b.Status {
+	case core.BroadcastDone:
+		fmt.Fprintf(&sb, "📣 Broadcast #%d hoàn tất", b.ID)
+	case core.BroadcastCancelled:
+		fmt.Fprintf(&sb, "📣 Broadcast #%d đã huỷ", b.ID)
+	default:
+		fmt.Fprintf(&sb, "📣 Broadcast #%d đang gửi", b.ID)
+	}
+	fmt.Fprintf(&sb, " (%s): %d/%d thread đã nhận, %d lỗi", b.Target, b.Sent, b.Total, b.Failed)
+	if b.Queued > 0 {
+		fmt.Fprintf(&sb, ", %d đang xếp hàng", b.Queued)
+	}
+	if pending := b.Total - b.Sent - b.Failed - b.Queued; pending > 0 {
+		fmt.Fprintf(&sb, ", %d chưa gửi", pending)
+	}
+	sb.WriteString(".")
+	for i, d := range failed {
+		if i == broadcastReportFailures {
+			fmt.Fprintf(&sb, "\n… và %d thread khác", len(failed)-i)
+			break
+		}
+		name := unknownThreadName
+		if t, err := s.store.GetThread(ctx, d.ThreadID); err == nil && t != nil && t.Name != "" {
+			name = t.Name
+		}
+		fmt.Fprintf(&sb, "\n❌ %s (%d): %s", name, d.ThreadID, d.LastError)
+	}
+	return sb.String(), nil
+}
+
+// Wake schedules a check for broadcasts to deliver.
+func (bc *Broadcaster) Wake() {
+	select {
+	case bc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops delivering. Running broadcasts resume on next start.
+func (bc *Broadcaster) Close() {
+	bc.stopOnce.Do(func() { close(bc.stop) })
+	<-bc.done
+}
+
+func (bc *Broadcaster) run() {
+	defer close(bc.done)
+	for {
+		if bc.step() {
+			// Pace deliveries; wake-ups only matter while idle.
+			timer := time.NewTimer(bc.delay)
+			select {
+			case <-bc.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+		timer := time.NewTimer(broadcastIdleWait)
+		select {
+		case <-bc.stop:
+			timer.Stop()
+			return
+		case <-bc.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// step makes the next delivery of the oldest running broadcast, finishing
+// broadcasts that have none left. It reports whether it sent anything.
+func (bc *Broadcaster) step() bool {
+	ctx := context.Background()
+	for {
+		running, err := bc.store.ListBroadcasts(ctx, core.BroadcastRunning, 0)
+		if err != nil {
+			bc.log.Warn().Err(err).Msg("Failed to list running broadcasts")
+			return false
+		}
+		if len(running) == 0 {
+			return false
+		}
+		b := running[len(running)-1] // newest first, so the last is the oldest
+
+		d, err := bc.store.NextBroadcastDelivery(ctx, b.ID)
+		if err != nil {
+			bc.log.Warn().Err(err).Int64("broadcast_id", b.ID).Msg("Failed to load broadcast delivery")
+			return false
+		}
+		if d == nil {
+			if !bc.finish(b.ID) {
+				return false
+			}
+			continue
+		}
+		bc.deliver(b, d)
+		return true
+	}
+}
+
+// deliver sends b to the thread of d and records the outcome.
+func (bc *Broadcaster) deliver(b *core.Broadcast, d *core.BroadcastDelivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), broadcastSendTimeout)
+	defer cancel()
+	rec, err := bc.service.SendText(ctx, core.SendTextRequest{ThreadID: d.ThreadID, Text: b.Text})
+
+	d.UpdatedAtUnixMs = time.Now().UnixMilli()
+	if err != nil {
+		d.Status = core.DeliveryFailed
+		d.LastError = err.Error()
+		bc.log.Warn().Err(err).Int64("broadcast_id", b.ID).Int64("thread", d.ThreadID).Msg("Broadcast delivery failed")
+	} else if rec != nil && rec.OutboxID != 0 {
+		// Sent once the outbox delivers it; see resolveQueued.
+		d.Status = core.DeliveryQueued
+		d.OutboxID = rec.OutboxID
+	} else {
+		d.Status = core.DeliverySent
+		if rec != nil {
+			d.MessageID = rec.MessageID
+		}
+	}
+	bc.record(d)
+}
+
+// record stores the outcome of d.
+func (bc *Broadcaster) record(d *core.BroadcastDelivery) {
+	bc.mu.Lock()
+	err := bc.store.UpdateBroadcastDelivery(context.Background(), d)
+	bc.mu.Unlock()
+	if err != nil {
+		bc.log.Warn().Err(err).Int64("broadcast_id", d.BroadcastID).Msg("Failed to record broadcast delivery")
+	}
+}
+
+// resolveQueued records the outcome of the outbox message entry on the
+// broadcast delivery that was queued as it, if any.
+func (bc *Broadcaster) resolveQueued(ctx context.Context, entry *core.OutboxEntry) {
+	d, err := bc.store.GetQueuedBroadcastDelivery(ctx, entry.ID)
+	if err != nil {
+		bc.log.Warn().Err(err).Int64("outbox_id", entry.ID).Msg("Failed to load queued broadcast delivery")
+		return
+	}
+	if d == nil {
+		return
+	}
+	d.Status = core.DeliverySent
+	if entry.Status == core.DeliveryFailed {
+		d.Status = core.DeliveryFailed
+	}
+	d.MessageID = entry.MessageID
+	d.LastError = entry.LastError
+	d.UpdatedAtUnixMs = time.Now().UnixMilli()
+	bc.record(d)
+}
+
+// finish marks broadcast id done and sends its report to the thread it was
+// started from. It reports whether the broadcast is no longer running.
+func (bc *Broadcaster) finish(id int64) bool {
+	ctx := context.Background()
+	bc.mu.Lock()
+	b, err := bc.store.GetBroadcast(ctx, id)
+	if err != nil {
+		bc.mu.Unlock()
+		return false
+	}
+	if b == nil || b.Status != core.BroadcastRunning {
+		bc.mu.Unlock()
+		return true // cancelled meanwhile
+	}
+	nowMs := time.Now().UnixMilli()
+	b.Status = core.BroadcastDone
+	b.UpdatedAtUnixMs = nowMs
+	b.FinishedAtUnixMs = nowMs
+	err = bc.store.UpdateBroadcast(ctx, b)
+	bc.mu.Unlock()
+	if err != nil {
+		bc.log.Warn().Err(err).Int64("broadcast_id", id).Msg("Failed to finish broadcast")
+		return false
+	}
+	bc.log.Info().Int64("broadcast_id", id).Int("sent", b.Sent).Int("failed", b.Failed).Int("total", b.Total).Msg("Broadcast finished")
+
+	if b.OriginThreadID == 0 {
+		return true
+	}
+	report, err := bc.service.BroadcastReport(ctx, id)
+	if err != nil {
+		bc.log.Warn().Err(err).Int64("broadcast_id", id).Msg("Failed to build broadcast report")
+		return true
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, broadcastSendTimeout)
+	defer cancel()
+	if _, err := bc.service.SendText(sendCtx, core.SendTextRequest{ThreadID: b.OriginThreadID, Text: report}); err != nil {
+		bc.log.Warn().Err(err).Int64("broadcast_id", id).Msg("Failed to send broadcast report")
+	}
+	return true
+}
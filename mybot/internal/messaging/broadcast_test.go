@@ -0,0 +1,168 @@
+package messaging
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+func TestBroadcastTargetsAndResume(t *testing.T) {
+	ctx := core.WithRequester(context.Background(), 7)
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	now := time.Now()
+	for _, th := range []*core.ThreadRecord{
+		{ThreadID: 1, Name: "Nhóm A", ThreadType: 2, IsGroup: true, LastActivityMs: now.Add(-time.Hour).UnixMilli()},
+		{ThreadID: 2, Name: "Bạn B", ThreadType: 1, LastActivityMs: now.Add(-time.Hour).UnixMilli()},
+		{ThreadID: 3, Name: "Nhóm C", ThreadType: 2, IsGroup: true, LastActivityMs: now.AddDate(0, 0, -30).UnixMilli()},
+		{ThreadID: 4, Name: "Đã xoá", ThreadType: 2, IsGroup: true, Deleted: true},
+	} {
+		if err := store.UpsertThread(ctx, th); err != nil {
+			t.Fatalf("UpsertThread() error = %v", err)
+		}
+	}
+
+	// A broadcast left running by a previous process, with one thread done.
+	resumed, err := store.InsertBroadcast(ctx, &core.Broadcast{Text: "cũ", Target: "list 2", Status: core.BroadcastRunning}, []int64{1, 2})
+	if err != nil {
+		t.Fatalf("InsertBroadcast() error = %v", err)
+	}
+	if err := store.UpdateBroadcastDelivery(ctx, &core.BroadcastDelivery{BroadcastID: resumed, ThreadID: 1, Status: core.DeliverySent}); err != nil {
+		t.Fatalf("UpdateBroadcastDelivery() error = %v", err)
+	}
+
+	transport := &fakeTransport{
+		selfID:       42,
+		nextTextResp: &core.MessageRecord{MessageID: "m1", ThreadID: 1, SenderID: 42},
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+
+	tests := []struct {
+		target core.BroadcastTarget
+		want   []int64
+	}{
+		{core.BroadcastTarget{Kind: core.BroadcastAll}, []int64{1, 2, 3}},
+		{core.BroadcastTarget{Kind: core.BroadcastGroups}, []int64{1, 3}},
+		{core.BroadcastTarget{Kind: core.BroadcastActive, ActiveDays: 7}, []int64{1, 2}},
+		{core.BroadcastTarget{Kind: core.BroadcastList, ThreadIDs: []int64{9, 3, 9}}, []int64{3, 9}},
+	}
+	for _, tt := range tests {
+		got, err := service.BroadcastTargets(ctx, tt.target)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("BroadcastTargets(%s) = %v, %v; want %v", tt.target, got, err, tt.want)
+		}
+	}
+
+	service.EnableBroadcasts(store, time.Millisecond)
+	b, err := service.StartBroadcast(ctx, 2, "Thông báo bảo trì", core.BroadcastTarget{Kind: core.BroadcastGroups})
+	if err != nil {
+		t.Fatalf("StartBroadcast() error = %v", err)
+	}
+	if b.Total != 2 || b.CreatorID != 7 || b.Target != "groups" {
+		t.Fatalf("StartBroadcast() = %+v", b)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := service.GetBroadcast(ctx, b.ID)
+		if err != nil {
+			t.Fatalf("GetBroadcast() error = %v", err)
+		}
+		if got.Status == core.BroadcastDone {
+			if got.Sent != 2 || got.Failed != 0 || got.FinishedAtUnixMs == 0 {
+				t.Fatalf("finished broadcast = %+v", got)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("broadcast not finished: %+v", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	old, err := service.GetBroadcast(ctx, resumed)
+	if err != nil || old.Status != core.BroadcastDone || old.Sent != 2 {
+		t.Fatalf("resumed broadcast = %+v, %v; want done with 2 sent", old, err)
+	}
+
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	// The resumed broadcast only sends to thread 2, then the new one goes to
+	// threads 1 and 3 and reports back to thread 2.
+	var sent []int64
+	for _, req := range transport.textReqs {
+		sent = append(sent, req.ThreadID)
+	}
+	if want := []int64{2, 1, 3, 2}; !reflect.DeepEqual(sent, want) {
+		t.Fatalf("sent to threads %v, want %v", sent, want)
+	}
+	report := transport.textReqs[len(transport.textReqs)-1].Text
+	if !strings.Contains(report, "Broadcast #2 hoàn tất (groups): 2/2") {
+		t.Fatalf("report = %q", report)
+	}
+}
+
+func TestBroadcastWaitsForQueuedDelivery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenSQLiteStore(filepath.Join(dir, "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	transport := &fakeTransport{
+		selfID:       42,
+		nextTextResp: &core.MessageRecord{MessageID: "m1", ThreadID: 1, SenderID: 42},
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	defer service.Close()
+	if err := service.EnableOutbox(store, filepath.Join(dir, "outbox")); err != nil {
+		t.Fatalf("EnableOutbox() error = %v", err)
+	}
+	service.EnableBroadcasts(store, time.Millisecond)
+
+	// Disconnected, the delivery only reaches the outbox.
+	b, err := service.StartBroadcast(ctx, 0, "Thông báo", core.BroadcastTarget{Kind: core.BroadcastList, ThreadIDs: []int64{1}})
+	if err != nil {
+		t.Fatalf("StartBroadcast() error = %v", err)
+	}
+	waitFor := func(done func(*core.Broadcast) bool) *core.Broadcast {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got, err := service.GetBroadcast(ctx, b.ID)
+			if err != nil {
+				t.Fatalf("GetBroadcast() error = %v", err)
+			}
+			if done(got) {
+				return got
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("broadcast = %+v", got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	got := waitFor(func(b *core.Broadcast) bool { return b.Status == core.BroadcastDone })
+	if got.Sent != 0 || got.Queued != 1 {
+		t.Fatalf("finished broadcast = %+v, want its delivery queued", got)
+	}
+	if report, _ := service.BroadcastReport(ctx, b.ID); !strings.Contains(report, "0/1 thread đã nhận, 0 lỗi, 1 đang xếp hàng") {
+		t.Fatalf("report = %q", report)
+	}
+
+	service.NotifyReady()
+	waitFor(func(b *core.Broadcast) bool { return b.Sent == 1 && b.Queued == 0 })
+	sent, err := store.ListBroadcastDeliveries(ctx, b.ID, core.DeliverySent)
+	if err != nil || len(sent) != 1 || sent[0].MessageID != "m1" {
+		t.Fatalf("sent deliveries = %+v, %v; want message m1", sent, err)
+	}
+}
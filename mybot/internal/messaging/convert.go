@@ -0,0 +1,136 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+
+	"mybot/internal/core"
+)
+
+// DumpRecord is one record read by Dumper.Dump; exactly one field is set.
+type DumpRecord struct {
+	Thread      *core.ThreadRecord
+	User        *core.UserRecord
+	Message     *core.MessageRecord
+	Edit        *core.MessageEdit
+	LastBot     *LastBotMessage
+	Pin         *core.MessagePin
+	Participant *core.ThreadParticipant
+	Poll        *core.Poll
+	PollOption  *core.PollOption
+	PollVote    *core.PollVote
+}
+
+// LastBotMessage is the last message the bot sent in a thread.
+type LastBotMessage struct {
+	ThreadID  int64
+	MessageID string
+}
+
+// Dumper is a Store that can list every record it holds, deleted threads
+// included. CopyStore reads from it.
+type Dumper interface {
+	Store
+	// Dump calls fn for each record: threads and users first, then
+	// messages before the edits, last-bot markers and pins that refer to
+	// them, then participants and polls with their options and votes.
+	Dump(ctx context.Context, fn func(DumpRecord) error) error
+}
+
+// CopyStats counts the records CopyStore wrote.
+type CopyStats struct {
+	Threads, Users, Messages, Edits, LastBot, Pins int
+	Participants, Polls, PollOptions, Votes        int
+}
+
+func (c CopyStats) String() string {
+	return fmt.Sprintf("threads=%d users=%d messages=%d edits=%d last_bot=%d pins=%d participants=%d polls=%d options=%d votes=%d",
+		c.Threads, c.Users, c.Messages, c.Edits, c.LastBot, c.Pins, c.Participants, c.Polls, c.PollOptions, c.Votes)
+}
+
+// copyBatchSize is how many message writes CopyStore commits together.
+const copyBatchSize = 500
+
+// CopyStore writes every record of src into dst. Only the tables in the
+// Store interface are copied: outbox, schedules, reminders, broadcasts,
+// moderation, bans and the search index are SQLite features and are left
+// behind (the search index is rebuilt when dst is SQLite).
+func CopyStore(ctx context.Context, dst Store, src Dumper) (CopyStats, error) {
+	var (
+		stats CopyStats
+		batch []writeOp
+	)
+	bw, batched := dst.(batchWriter)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var err error
+		if batched {
+			err = bw.writeBatch(batch)
+		} else {
+			for i := range batch {
+				if err = applyWriteOp(dst, &batch[i]); err != nil {
+					break
+				}
+			}
+		}
+		batch = batch[:0]
+		return err
+	}
+	queue := func(op writeOp) error {
+		if batch = append(batch, op); len(batch) >= copyBatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	err := src.Dump(ctx, func(r DumpRecord) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		switch {
+		case r.Thread != nil:
+			stats.Threads++
+			return queue(writeOp{kind: opUpsertThread, thread: r.Thread})
+		case r.User != nil:
+			stats.Users++
+			return queue(writeOp{kind: opUpsertUser, user: r.User})
+		case r.Message != nil:
+			stats.Messages++
+			return queue(writeOp{kind: opUpsertMessage, msg: r.Message})
+		case r.Edit != nil:
+			stats.Edits++
+			return queue(writeOp{kind: opUpsertMessageEdit, edit: r.Edit})
+		case r.LastBot != nil:
+			stats.LastBot++
+			return queue(writeOp{kind: opSetLastBot, threadID: r.LastBot.ThreadID, messageID: r.LastBot.MessageID})
+		}
+		// The remaining records have no batched form.
+		if err := flush(); err != nil {
+			return err
+		}
+		switch {
+		case r.Pin != nil:
+			stats.Pins++
+			return dst.SetMessagePinned(ctx, r.Pin)
+		case r.Participant != nil:
+			stats.Participants++
+			return dst.UpsertParticipant(ctx, r.Participant)
+		case r.Poll != nil:
+			stats.Polls++
+			return dst.UpsertPoll(ctx, r.Poll)
+		case r.PollOption != nil:
+			stats.PollOptions++
+			return dst.UpsertPollOption(ctx, r.PollOption)
+		case r.PollVote != nil:
+			stats.Votes++
+			return dst.UpsertPollVote(ctx, r.PollVote)
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	return stats, flush()
+}
@@ -0,0 +1,88 @@
+package messaging
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"mybot/internal/core"
+)
+
+func TestCopyStoreRoundTripsBetweenBackends(t *testing.T) {
+	ctx := context.Background()
+	src, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer src.Close()
+
+	src.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 1, Name: "General", ThreadType: 2, IsGroup: true})
+	src.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 2, Name: "Left", Deleted: true})
+	src.UpsertUser(ctx, &core.UserRecord{UserID: 7, Name: "Alice"})
+	src.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m1", ThreadID: 1, SenderID: 7, Text: "phở ngon", TimestampMs: 1000,
+		Mentions: []core.Mention{{UserID: 8, Offset: 0, Length: 3}}})
+	src.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m2", ThreadID: 2, SenderID: 7, Text: "bye", TimestampMs: 2000})
+	src.UpsertMessageEdit(ctx, &core.MessageEdit{MessageID: "m1", ThreadID: 1, Text: "pho", TimestampMs: 900})
+	src.SetLastBotMessage(ctx, 1, "m1")
+	src.SetMessagePinned(ctx, &core.MessagePin{ThreadID: 1, MessageID: "m1", PinnedAtUnixMs: 1200})
+	src.UpsertParticipant(ctx, &core.ThreadParticipant{ThreadID: 1, UserID: 7, IsAdmin: true})
+	src.UpsertPoll(ctx, &core.Poll{ID: 5, ThreadID: 1, Question: "Ăn gì?", Status: core.PollOpen, ClosesAtUnixMs: 5000})
+	src.UpsertPollOption(ctx, &core.PollOption{PollID: 5, OptionID: 1, Text: "Phở", Position: 0})
+	src.UpsertPollVote(ctx, &core.PollVote{PollID: 5, OptionID: 1, UserID: 7, VotedAtUnixMs: 1500})
+
+	bolt, err := OpenBoltStore(filepath.Join(t.TempDir(), "messages.bolt"))
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+	defer bolt.Close()
+	stats, err := CopyStore(ctx, bolt, src)
+	if err != nil {
+		t.Fatalf("CopyStore(sqlite → bolt) error = %v", err)
+	}
+	want := CopyStats{Threads: 2, Users: 1, Messages: 2, Edits: 1, LastBot: 1, Pins: 1, Participants: 1, Polls: 1, PollOptions: 1, Votes: 1}
+	if stats != want {
+		t.Fatalf("CopyStore() stats = %+v, want %+v", stats, want)
+	}
+
+	// Through memory and back into SQLite, which rebuilds the search index.
+	mem := NewMemoryStore()
+	if _, err := CopyStore(ctx, mem, bolt); err != nil {
+		t.Fatalf("CopyStore(bolt → memory) error = %v", err)
+	}
+	dst, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "copy.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore(copy) error = %v", err)
+	}
+	defer dst.Close()
+	if stats, err := CopyStore(ctx, dst, mem); err != nil || stats != want {
+		t.Fatalf("CopyStore(memory → sqlite) = %+v, %v", stats, err)
+	}
+
+	if got, _ := dst.GetThread(ctx, 2); got == nil || !got.Deleted {
+		t.Fatalf("deleted thread = %+v", got)
+	}
+	if got, _ := dst.GetMessage(ctx, "m1"); got == nil || len(got.Mentions) != 1 || got.Mentions[0].UserID != 8 {
+		t.Fatalf("GetMessage(m1) = %+v", got)
+	}
+	if edits, _ := dst.ListMessageEdits(ctx, "m1"); len(edits) != 1 || edits[0].Text != "pho" {
+		t.Fatalf("ListMessageEdits() = %+v", edits)
+	}
+	if got, _ := dst.GetLastBotMessage(ctx, 1); got == nil || got.MessageID != "m1" {
+		t.Fatalf("GetLastBotMessage() = %+v", got)
+	}
+	if pins, _ := dst.ListPinnedMessages(ctx, 1); len(pins) != 1 || pins[0].MessageID != "m1" || pins[0].PinnedAtUnixMs != 1200 {
+		t.Fatalf("ListPinnedMessages() = %+v", pins)
+	}
+	if p, _ := dst.GetParticipant(ctx, 1, 7); p == nil || !p.IsAdmin {
+		t.Fatalf("GetParticipant() = %+v", p)
+	}
+	if due, _ := dst.ListDuePolls(ctx, 6000); len(due) != 1 || due[0].Question != "Ăn gì?" {
+		t.Fatalf("ListDuePolls() = %+v", due)
+	}
+	if votes, _ := dst.ListPollVotes(ctx, 5); len(votes) != 1 || votes[0].UserID != 7 {
+		t.Fatalf("ListPollVotes() = %+v", votes)
+	}
+	if found, err := dst.SearchMessages(ctx, 1, "pho", core.SearchFilters{}); err != nil || len(found) != 1 {
+		t.Fatalf("SearchMessages() after copy = %v, %v", found, err)
+	}
+}
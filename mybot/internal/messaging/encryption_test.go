@@ -0,0 +1,169 @@
+package messaging
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mybot/internal/core"
+	"mybot/internal/encryption"
+)
+
+func TestSQLiteStoreEncryption(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "messages.sqlite")
+	open := func() *SQLiteStore {
+		t.Helper()
+		store, err := OpenSQLiteStore(path)
+		if err != nil {
+			t.Fatalf("OpenSQLiteStore() error = %v", err)
+		}
+		return store
+	}
+	rawText := func(store *SQLiteStore) (text, attachments, edit string) {
+		t.Helper()
+		if err := store.writeDB.QueryRow(`SELECT text, attachments_json FROM messages WHERE message_id = 'm1'`).Scan(&text, &attachments); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.writeDB.QueryRow(`SELECT text FROM message_edits WHERE message_id = 'm1'`).Scan(&edit); err != nil {
+			t.Fatal(err)
+		}
+		return text, attachments, edit
+	}
+
+	// A message stored before encryption was turned on.
+	store := open()
+	if err := store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m0", ThreadID: 1001, SenderID: 7, Text: "bún chả", TimestampMs: 1}); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := encryption.NewKeyring(encryption.GenerateKey())
+	if err := store.EnableEncryption(keys, false); err != nil {
+		t.Fatalf("EnableEncryption() error = %v", err)
+	}
+	rec := &core.MessageRecord{
+		MessageID: "m1", ThreadID: 1001, SenderID: 7, Text: "mật khẩu wifi là phở123", TimestampMs: 2,
+		HasMedia: true, Attachments: []core.AttachmentMeta{{AttachmentID: "a1", Kind: "image", Filename: "hoa-don.jpg"}},
+	}
+	if err := store.UpsertMessage(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpsertMessageEdit(ctx, &core.MessageEdit{MessageID: "m1", ThreadID: 1001, Text: "mật khẩu cũ", TimestampMs: 3}); err != nil {
+		t.Fatal(err)
+	}
+	text, attachments, edit := rawText(store)
+	if !encryption.IsSealed(text) || !encryption.IsSealed(attachments) || !encryption.IsSealed(edit) || strings.Contains(attachments, "hoa-don") {
+		t.Errorf("stored text = %q, attachments = %q, edit = %q; want them sealed", text, attachments, edit)
+	}
+	got, err := store.GetMessage(ctx, "m1")
+	if err != nil || got.Text != rec.Text || len(got.Attachments) != 1 || got.Attachments[0].Filename != "hoa-don.jpg" {
+		t.Fatalf("GetMessage() = %+v, %v", got, err)
+	}
+	if edits, err := store.ListMessageEdits(ctx, "m1"); err != nil || len(edits) != 1 || edits[0].Text != "mật khẩu cũ" {
+		t.Errorf("ListMessageEdits() = %+v, %v", edits, err)
+	}
+	if found, _ := store.SearchMessages(ctx, 0, "phở123", core.SearchFilters{}); len(found) != 0 {
+		t.Errorf("SearchMessages() = %d results, want the index dropped", len(found))
+	}
+	// The stats rollups keep counting messages, but no words or domains.
+	var terms, messages int
+	if err := store.writeDB.QueryRow(`SELECT COUNT(*) FROM stats_terms`).Scan(&terms); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.writeDB.QueryRow(`SELECT COALESCE(SUM(messages), 0) FROM stats_activity`).Scan(&messages); err != nil {
+		t.Fatal(err)
+	}
+	if terms != 0 || messages != 2 {
+		t.Errorf("stats_terms rows = %d, stats_activity messages = %d; want 0 and 2", terms, messages)
+	}
+	store.Close()
+
+	// Reopened, the database refuses to run unencrypted or with another key.
+	store = open()
+	if err := store.DisableEncryption(nil); err == nil {
+		t.Error("DisableEncryption(nil) on an encrypted database error = nil")
+	}
+	other, _ := encryption.NewKeyring(encryption.GenerateKey())
+	if err := store.EnableEncryption(other, false); err == nil {
+		t.Error("EnableEncryption(other key) error = nil")
+	}
+
+	// Rotation seals everything with the new key, old rows included.
+	rotated, _ := keys.WithKey(encryption.GenerateKey())
+	if err := store.EnableEncryption(rotated, false); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.Reencrypt(ctx, 1); err != nil || n != 2 {
+		t.Fatalf("Reencrypt() = %d, %v; want 2", n, err)
+	}
+	if id, _ := store.EncryptionKeyID(); id != rotated.KeyID() {
+		t.Errorf("EncryptionKeyID() = %s, want the new key %s", id, rotated.KeyID())
+	}
+	store.Close()
+	store = open()
+	if err := store.EnableEncryption(rotated.Current(), false); err != nil {
+		t.Fatalf("EnableEncryption(new key only) error = %v", err)
+	}
+	if got, err := store.GetMessage(ctx, "m0"); err != nil || got.Text != "bún chả" {
+		t.Errorf("GetMessage(m0) = %+v, %v", got, err)
+	}
+
+	// Decrypting writes plaintext back and rebuilds the search index.
+	if err := store.DisableEncryption(rotated.Current()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Reencrypt(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if text, attachments, edit := rawText(store); text != rec.Text || edit != "mật khẩu cũ" || !strings.Contains(attachments, "hoa-don") {
+		t.Errorf("decrypted text = %q, attachments = %q, edit = %q", text, attachments, edit)
+	}
+	if id, _ := store.EncryptionKeyID(); id != "" {
+		t.Errorf("EncryptionKeyID() = %s after decrypting, want none", id)
+	}
+	if found, _ := store.SearchMessages(ctx, 0, "phở123", core.SearchFilters{}); len(found) != 1 {
+		t.Errorf("SearchMessages() = %d results, want the index rebuilt", len(found))
+	}
+	store.Close()
+}
+
+func TestSQLiteStoreTextLookingSealed(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	// Any chat member can send text that looks sealed.
+	bait := "enc:v1:abc:def"
+	if err := store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m1", ThreadID: 1, SenderID: 7, Text: bait, TimestampMs: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// Written before values were escaped.
+	if _, err := store.writeDB.Exec(`INSERT INTO messages(message_id, thread_id, sender_id, text, timestamp_ms) VALUES('m0', 1, 7, ?, 0)`, bait); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"m0", "m1"} {
+		if got, err := store.GetMessage(ctx, id); err != nil || got.Text != bait {
+			t.Fatalf("GetMessage(%s) = %+v, %v; want text %q", id, got, err, bait)
+		}
+	}
+	if msgs, err := store.ListThreadMessages(ctx, 1, 10, ""); err != nil || len(msgs) != 2 {
+		t.Fatalf("ListThreadMessages() = %d messages, %v", len(msgs), err)
+	}
+
+	// Once encrypted, both still read as the text that was sent.
+	keys, _ := encryption.NewKeyring(encryption.GenerateKey())
+	if err := store.EnableEncryption(keys, false); err != nil {
+		t.Fatalf("EnableEncryption() error = %v", err)
+	}
+	if err := store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m2", ThreadID: 1, SenderID: 7, Text: "enc:raw:x", TimestampMs: 2}); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]string{"m0": bait, "m1": bait, "m2": "enc:raw:x"} {
+		if got, err := store.GetMessage(ctx, id); err != nil || got.Text != want {
+			t.Errorf("GetMessage(%s) after EnableEncryption = %+v, %v; want text %q", id, got, err, want)
+		}
+	}
+}
@@ -6,4 +6,14 @@ var (
 	ErrTransportUnavailable = errors.New("messaging transport unavailable")
 	ErrMessageNotFound      = errors.New("message not found")
 	ErrEditNotConfirmed     = errors.New("edit not confirmed")
+	ErrInvalidRequest       = errors.New("invalid send request")
+	ErrOutboxDisabled       = errors.New("outbox not enabled")
+	ErrSchedulerDisabled    = errors.New("scheduler not enabled")
+	ErrRemindersDisabled    = errors.New("reminders not enabled")
+	ErrBroadcastDisabled    = errors.New("broadcast not enabled")
+	ErrPollsDisabled        = errors.New("polls not enabled")
+	ErrModerationDisabled   = errors.New("moderation not enabled")
+	ErrBansDisabled         = errors.New("bans not enabled")
+	ErrSearchDisabled       = errors.New("search not enabled")
+	ErrStatsDisabled        = errors.New("stats not enabled")
 )
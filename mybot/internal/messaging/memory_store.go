@@ -0,0 +1,671 @@
+package messaging
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"mybot/internal/core"
+)
+
+// MemoryStore is a Store that keeps everything in process memory. Nothing
+// survives a restart; it suits tests and throwaway deployments. Records are
+// copied on the way in and out, like a database would.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	threads      map[int64]*core.ThreadRecord
+	users        map[int64]*core.UserRecord
+	messages     map[string]*core.MessageRecord
+	lastBot      map[int64]string
+	edits        map[string][]*core.MessageEdit
+	pins         map[int64]map[string]*core.MessagePin
+	participants map[int64]map[int64]*core.ThreadParticipant
+	polls        map[int64]*core.Poll
+	pollOptions  map[int64]map[int64]*core.PollOption
+	pollVotes    map[int64][]*core.PollVote
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		threads:      make(map[int64]*core.ThreadRecord),
+		users:        make(map[int64]*core.UserRecord),
+		messages:     make(map[string]*core.MessageRecord),
+		lastBot:      make(map[int64]string),
+		edits:        make(map[string][]*core.MessageEdit),
+		pins:         make(map[int64]map[string]*core.MessagePin),
+		participants: make(map[int64]map[int64]*core.ThreadParticipant),
+		polls:        make(map[int64]*core.Poll),
+		pollOptions:  make(map[int64]map[int64]*core.PollOption),
+		pollVotes:    make(map[int64][]*core.PollVote),
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// writeBatch applies ops from the WriteBatcher under one lock.
+func (s *MemoryStore) writeBatch(ops []writeOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range ops {
+		op := &ops[i]
+		switch op.kind {
+		case opUpsertThread:
+			s.upsertThreadLocked(op.thread)
+		case opUpsertUser:
+			s.upsertUserLocked(op.user)
+		case opUpsertMessage:
+			s.upsertMessageLocked(op.msg)
+		case opSetLastBot:
+			s.setLastBotLocked(op.threadID, op.messageID)
+		case opClearLastBot, opClearLastBotByThread:
+			s.clearLastBotLocked(op.threadID, op.messageID)
+		case opUpsertMessageEdit:
+			s.upsertMessageEditLocked(op.edit)
+		}
+	}
+	return nil
+}
+
+// ── Threads and users ───────────────────────────────────────────────────────
+
+func (s *MemoryStore) UpsertThread(_ context.Context, rec *core.ThreadRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upsertThreadLocked(rec)
+	return nil
+}
+
+// upsertThreadLocked merges rec like the SQLite upsert: an empty name, type
+// or activity time keeps the stored one.
+func (s *MemoryStore) upsertThreadLocked(rec *core.ThreadRecord) {
+	if rec == nil || rec.ThreadID == 0 {
+		return
+	}
+	next := *rec
+	if old := s.threads[rec.ThreadID]; old != nil {
+		if next.Name == "" {
+			next.Name = old.Name
+		}
+		if next.ThreadType == 0 {
+			next.ThreadType, next.IsGroup = old.ThreadType, old.IsGroup
+		}
+		if next.LastActivityMs <= 0 {
+			next.LastActivityMs = old.LastActivityMs
+		}
+	}
+	s.threads[rec.ThreadID] = &next
+}
+
+func (s *MemoryStore) GetThread(_ context.Context, threadID int64) (*core.ThreadRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return clonePtr(s.threads[threadID]), nil
+}
+
+// ListThreads returns every thread not marked deleted. LastActivityMs is
+// the later of the thread's own activity time and its newest stored message.
+func (s *MemoryStore) ListThreads(_ context.Context) ([]*core.ThreadRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	newest := make(map[int64]int64)
+	for _, m := range s.messages {
+		newest[m.ThreadID] = max(newest[m.ThreadID], m.TimestampMs)
+	}
+	var threads []*core.ThreadRecord
+	for _, t := range s.threads {
+		if t.Deleted {
+			continue
+		}
+		rec := *t
+		rec.LastActivityMs = max(rec.LastActivityMs, newest[t.ThreadID])
+		threads = append(threads, &rec)
+	}
+	slices.SortFunc(threads, func(a, b *core.ThreadRecord) int { return cmp.Compare(a.ThreadID, b.ThreadID) })
+	return threads, nil
+}
+
+// QueryThreads returns the threads q selects, most recently active first.
+func (s *MemoryStore) QueryThreads(_ context.Context, q core.ThreadQuery) ([]*core.ThreadRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	newest := make(map[int64]int64)
+	for _, m := range s.messages {
+		newest[m.ThreadID] = max(newest[m.ThreadID], m.TimestampMs)
+	}
+	threads := make([]*core.ThreadRecord, 0, len(s.threads))
+	for _, t := range s.threads {
+		rec := *t
+		rec.LastActivityMs = max(rec.LastActivityMs, newest[t.ThreadID])
+		threads = append(threads, &rec)
+	}
+	return selectThreads(threads, q), nil
+}
+
+func (s *MemoryStore) UpsertUser(_ context.Context, rec *core.UserRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upsertUserLocked(rec)
+	return nil
+}
+
+func (s *MemoryStore) upsertUserLocked(rec *core.UserRecord) {
+	if rec == nil || rec.UserID == 0 {
+		return
+	}
+	next := *rec
+	if old := s.users[rec.UserID]; old != nil && next.Name == "" {
+		next.Name = old.Name
+	}
+	s.users[rec.UserID] = &next
+}
+
+func (s *MemoryStore) GetUser(_ context.Context, userID int64) (*core.UserRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return clonePtr(s.users[userID]), nil
+}
+
+// QueryUsers returns the users q selects, by name.
+func (s *MemoryStore) QueryUsers(_ context.Context, q core.UserQuery) ([]*core.UserRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]*core.UserRecord, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	return cloneAll(selectUsers(users, q)), nil
+}
+
+// ── Messages ────────────────────────────────────────────────────────────────
+
+func (s *MemoryStore) UpsertMessage(_ context.Context, rec *core.MessageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upsertMessageLocked(rec)
+	return nil
+}
+
+func (s *MemoryStore) upsertMessageLocked(rec *core.MessageRecord) {
+	if rec == nil || rec.MessageID == "" {
+		return
+	}
+	next := cloneMessage(rec)
+	if old := s.messages[rec.MessageID]; old != nil && old.CreatedAtUnixMs > 0 {
+		next.CreatedAtUnixMs = old.CreatedAtUnixMs
+	}
+	s.messages[rec.MessageID] = next
+}
+
+func (s *MemoryStore) GetMessage(_ context.Context, messageID string) (*core.MessageRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if m := s.messages[messageID]; m != nil {
+		return cloneMessage(m), nil
+	}
+	return nil, nil
+}
+
+// ListThreadMessages returns up to limit messages of threadID older than
+// beforeMessageID, newest first.
+func (s *MemoryStore) ListThreadMessages(_ context.Context, threadID int64, limit int, beforeMessageID string) ([]*core.MessageRecord, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var before *core.MessageRecord
+	if beforeMessageID != "" {
+		if before = s.messages[beforeMessageID]; before == nil {
+			return nil, nil
+		}
+	}
+	var items []*core.MessageRecord
+	for _, m := range s.messages {
+		if m.ThreadID == threadID && (before == nil || compareMessages(m, before) < 0) {
+			items = append(items, m)
+		}
+	}
+	slices.SortFunc(items, func(a, b *core.MessageRecord) int { return compareMessages(b, a) })
+	items = items[:min(limit, len(items))]
+	results := make([]*core.MessageRecord, len(items))
+	for i, m := range items {
+		results[i] = cloneMessage(m)
+	}
+	return results, nil
+}
+
+// QueryMessages returns the messages q selects.
+func (s *MemoryStore) QueryMessages(_ context.Context, q core.MessageQuery) ([]*core.MessageRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var after *core.MessageRecord
+	if q.After != "" {
+		if after = s.messages[q.After]; after == nil {
+			return nil, ErrMessageNotFound
+		}
+	}
+	msgs := make([]*core.MessageRecord, 0, len(s.messages))
+	for _, m := range s.messages {
+		msgs = append(msgs, m)
+	}
+	items := selectMessages(msgs, q, after)
+	results := make([]*core.MessageRecord, len(items))
+	for i, m := range items {
+		results[i] = cloneMessage(m)
+	}
+	return results, nil
+}
+
+// compareMessages orders messages by (timestamp, ID), the order SQLite
+// pages them in.
+func compareMessages(a, b *core.MessageRecord) int {
+	if c := cmp.Compare(a.TimestampMs, b.TimestampMs); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.MessageID, b.MessageID)
+}
+
+func (s *MemoryStore) SetLastBotMessage(_ context.Context, threadID int64, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setLastBotLocked(threadID, messageID)
+	return nil
+}
+
+func (s *MemoryStore) setLastBotLocked(threadID int64, messageID string) {
+	if threadID != 0 && messageID != "" {
+		s.lastBot[threadID] = messageID
+	}
+}
+
+func (s *MemoryStore) GetLastBotMessage(ctx context.Context, threadID int64) (*core.MessageRecord, error) {
+	s.mu.RLock()
+	messageID := s.lastBot[threadID]
+	s.mu.RUnlock()
+	if messageID == "" {
+		return nil, nil
+	}
+	return s.GetMessage(ctx, messageID)
+}
+
+func (s *MemoryStore) ClearLastBotMessage(_ context.Context, threadID int64, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearLastBotLocked(threadID, messageID)
+	return nil
+}
+
+// clearLastBotLocked forgets the last bot message of threadID if it is
+// messageID, or whatever it is when messageID is empty.
+func (s *MemoryStore) clearLastBotLocked(threadID int64, messageID string) {
+	if messageID == "" || s.lastBot[threadID] == messageID {
+		delete(s.lastBot, threadID)
+	}
+}
+
+func (s *MemoryStore) UpsertMessageEdit(_ context.Context, rec *core.MessageEdit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upsertMessageEditLocked(rec)
+	return nil
+}
+
+func (s *MemoryStore) upsertMessageEditLocked(rec *core.MessageEdit) {
+	if rec == nil || rec.MessageID == "" {
+		return
+	}
+	edits := s.edits[rec.MessageID]
+	for _, e := range edits {
+		if e.TimestampMs == rec.TimestampMs {
+			if rec.ThreadID != 0 {
+				e.ThreadID = rec.ThreadID
+			}
+			e.Text = rec.Text
+			return
+		}
+	}
+	next := *rec
+	edits = append(edits, &next)
+	slices.SortFunc(edits, func(a, b *core.MessageEdit) int { return cmp.Compare(a.TimestampMs, b.TimestampMs) })
+	s.edits[rec.MessageID] = edits
+}
+
+// ListMessageEdits returns every recorded version of a message, oldest first.
+func (s *MemoryStore) ListMessageEdits(_ context.Context, messageID string) ([]*core.MessageEdit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cloneAll(s.edits[messageID]), nil
+}
+
+// ── Pins ────────────────────────────────────────────────────────────────────
+
+func (s *MemoryStore) SetMessagePinned(_ context.Context, rec *core.MessagePin) error {
+	if rec == nil || rec.MessageID == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec.PinnedAtUnixMs == 0 {
+		delete(s.pins[rec.ThreadID], rec.MessageID)
+		return nil
+	}
+	pins := s.pins[rec.ThreadID]
+	if pins == nil {
+		pins = make(map[string]*core.MessagePin)
+		s.pins[rec.ThreadID] = pins
+	}
+	pins[rec.MessageID] = clonePtr(rec)
+	return nil
+}
+
+func (s *MemoryStore) ClearPinnedMessages(_ context.Context, threadID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pins, threadID)
+	return nil
+}
+
+func (s *MemoryStore) ListPinnedMessages(_ context.Context, threadID int64) ([]*core.MessagePin, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var items []*core.MessagePin
+	for _, p := range s.pins[threadID] {
+		items = append(items, clonePtr(p))
+	}
+	slices.SortFunc(items, func(a, b *core.MessagePin) int {
+		if a.PinnedAtUnixMs != b.PinnedAtUnixMs {
+			return cmp.Compare(b.PinnedAtUnixMs, a.PinnedAtUnixMs)
+		}
+		return cmp.Compare(a.MessageID, b.MessageID)
+	})
+	return items, nil
+}
+
+// ── Thread participants ─────────────────────────────────────────────────────
+
+func (s *MemoryStore) UpsertParticipant(_ context.Context, rec *core.ThreadParticipant) error {
+	if rec == nil || rec.ThreadID == 0 || rec.UserID == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	members := s.participants[rec.ThreadID]
+	if members == nil {
+		members = make(map[int64]*core.ThreadParticipant)
+		s.participants[rec.ThreadID] = members
+	}
+	members[rec.UserID] = clonePtr(rec)
+	return nil
+}
+
+func (s *MemoryStore) GetParticipant(_ context.Context, threadID, userID int64) (*core.ThreadParticipant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return clonePtr(s.participants[threadID][userID]), nil
+}
+
+func (s *MemoryStore) ListParticipants(_ context.Context, threadID int64) ([]*core.ThreadParticipant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var items []*core.ThreadParticipant
+	for _, p := range s.participants[threadID] {
+		items = append(items, clonePtr(p))
+	}
+	slices.SortFunc(items, func(a, b *core.ThreadParticipant) int {
+		if a.IsAdmin != b.IsAdmin {
+			if a.IsAdmin {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.UserID, b.UserID)
+	})
+	return items, nil
+}
+
+func (s *MemoryStore) DeleteParticipant(_ context.Context, threadID, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.participants[threadID], userID)
+	return nil
+}
+
+func (s *MemoryStore) SetParticipantsAdmin(_ context.Context, threadID int64, isAdmin bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nowMs := time.Now().UnixMilli()
+	for _, p := range s.participants[threadID] {
+		p.IsAdmin = isAdmin
+		p.UpdatedAtUnixMs = nowMs
+	}
+	return nil
+}
+
+// ── Polls ───────────────────────────────────────────────────────────────────
+
+func (s *MemoryStore) UpsertPoll(_ context.Context, rec *core.Poll) error {
+	if rec == nil || rec.ID == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.polls[rec.ID] = clonePtr(rec)
+	return nil
+}
+
+func (s *MemoryStore) GetPoll(_ context.Context, pollID int64) (*core.Poll, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return clonePtr(s.polls[pollID]), nil
+}
+
+func (s *MemoryStore) ListPolls(_ context.Context, threadID int64, limit int) ([]*core.Poll, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	items := s.scanPolls(func(p *core.Poll) bool { return p.ThreadID == threadID })
+	slices.SortFunc(items, func(a, b *core.Poll) int {
+		if a.CreatedAtUnixMs != b.CreatedAtUnixMs {
+			return cmp.Compare(b.CreatedAtUnixMs, a.CreatedAtUnixMs)
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return items[:min(limit, len(items))], nil
+}
+
+func (s *MemoryStore) ListDuePolls(_ context.Context, untilMs int64) ([]*core.Poll, error) {
+	items := s.scanPolls(func(p *core.Poll) bool {
+		return p.Status == core.PollOpen && p.ClosesAtUnixMs > 0 && p.ClosesAtUnixMs <= untilMs
+	})
+	slices.SortFunc(items, func(a, b *core.Poll) int {
+		if a.ClosesAtUnixMs != b.ClosesAtUnixMs {
+			return cmp.Compare(a.ClosesAtUnixMs, b.ClosesAtUnixMs)
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return items, nil
+}
+
+func (s *MemoryStore) NextPollCloseAt(_ context.Context) (int64, error) {
+	var next int64
+	for _, p := range s.scanPolls(func(p *core.Poll) bool { return p.Status == core.PollOpen && p.ClosesAtUnixMs > 0 }) {
+		if next == 0 || p.ClosesAtUnixMs < next {
+			next = p.ClosesAtUnixMs
+		}
+	}
+	return next, nil
+}
+
+// scanPolls returns copies of every stored poll that keep accepts.
+func (s *MemoryStore) scanPolls(keep func(*core.Poll) bool) []*core.Poll {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var items []*core.Poll
+	for _, p := range s.polls {
+		if keep(p) {
+			items = append(items, clonePtr(p))
+		}
+	}
+	return items
+}
+
+func (s *MemoryStore) UpsertPollOption(_ context.Context, rec *core.PollOption) error {
+	if rec == nil || rec.PollID == 0 || rec.OptionID == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	options := s.pollOptions[rec.PollID]
+	if options == nil {
+		options = make(map[int64]*core.PollOption)
+		s.pollOptions[rec.PollID] = options
+	}
+	options[rec.OptionID] = clonePtr(rec)
+	return nil
+}
+
+func (s *MemoryStore) ListPollOptions(_ context.Context, pollID int64) ([]*core.PollOption, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var items []*core.PollOption
+	for _, o := range s.pollOptions[pollID] {
+		items = append(items, clonePtr(o))
+	}
+	slices.SortFunc(items, func(a, b *core.PollOption) int {
+		if a.Position != b.Position {
+			return cmp.Compare(a.Position, b.Position)
+		}
+		return cmp.Compare(a.OptionID, b.OptionID)
+	})
+	return items, nil
+}
+
+func (s *MemoryStore) UpsertPollVote(_ context.Context, rec *core.PollVote) error {
+	if rec == nil || rec.PollID == 0 || rec.OptionID == 0 || rec.UserID == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	votes := slices.DeleteFunc(s.pollVotes[rec.PollID], func(v *core.PollVote) bool {
+		return v.OptionID == rec.OptionID && v.UserID == rec.UserID
+	})
+	s.pollVotes[rec.PollID] = append(votes, clonePtr(rec))
+	return nil
+}
+
+func (s *MemoryStore) ReplacePollVotes(_ context.Context, pollID int64, votes []*core.PollVote) error {
+	var next []*core.PollVote
+	for _, v := range votes {
+		if v.OptionID == 0 || v.UserID == 0 {
+			continue
+		}
+		rec := *v
+		rec.PollID = pollID
+		next = slices.DeleteFunc(next, func(o *core.PollVote) bool {
+			return o.OptionID == rec.OptionID && o.UserID == rec.UserID
+		})
+		next = append(next, &rec)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pollVotes[pollID] = next
+	return nil
+}
+
+func (s *MemoryStore) ListPollVotes(_ context.Context, pollID int64) ([]*core.PollVote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := cloneAll(s.pollVotes[pollID])
+	slices.SortFunc(items, func(a, b *core.PollVote) int {
+		if a.VotedAtUnixMs != b.VotedAtUnixMs {
+			return cmp.Compare(a.VotedAtUnixMs, b.VotedAtUnixMs)
+		}
+		return cmp.Compare(a.UserID, b.UserID)
+	})
+	return items, nil
+}
+
+// Dump reads a snapshot of every record, for CopyStore.
+func (s *MemoryStore) Dump(_ context.Context, fn func(DumpRecord) error) error {
+	s.mu.RLock()
+	var records []DumpRecord
+	for _, r := range s.threads {
+		records = append(records, DumpRecord{Thread: clonePtr(r)})
+	}
+	for _, r := range s.users {
+		records = append(records, DumpRecord{User: clonePtr(r)})
+	}
+	for _, r := range s.messages {
+		records = append(records, DumpRecord{Message: cloneMessage(r)})
+	}
+	for _, edits := range s.edits {
+		for _, r := range edits {
+			records = append(records, DumpRecord{Edit: clonePtr(r)})
+		}
+	}
+	for threadID, messageID := range s.lastBot {
+		records = append(records, DumpRecord{LastBot: &LastBotMessage{ThreadID: threadID, MessageID: messageID}})
+	}
+	for _, pins := range s.pins {
+		for _, r := range pins {
+			records = append(records, DumpRecord{Pin: clonePtr(r)})
+		}
+	}
+	for _, members := range s.participants {
+		for _, r := range members {
+			records = append(records, DumpRecord{Participant: clonePtr(r)})
+		}
+	}
+	for _, r := range s.polls {
+		records = append(records, DumpRecord{Poll: clonePtr(r)})
+	}
+	for _, options := range s.pollOptions {
+		for _, r := range options {
+			records = append(records, DumpRecord{PollOption: clonePtr(r)})
+		}
+	}
+	for _, votes := range s.pollVotes {
+		for _, r := range votes {
+			records = append(records, DumpRecord{PollVote: clonePtr(r)})
+		}
+	}
+	s.mu.RUnlock()
+
+	// fn may write back into this store, so it runs without the lock.
+	for _, r := range records {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	return &c
+}
+
+func cloneAll[T any](items []*T) []*T {
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]*T, len(items))
+	for i, p := range items {
+		out[i] = clonePtr(p)
+	}
+	return out
+}
+
+func cloneMessage(m *core.MessageRecord) *core.MessageRecord {
+	c := *m
+	c.Attachments = slices.Clone(m.Attachments)
+	c.Mentions = slices.Clone(m.Mentions)
+	return &c
+}
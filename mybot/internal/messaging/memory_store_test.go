@@ -0,0 +1,106 @@
+package messaging
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+func TestMemoryStoreMergesLikeSQLite(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	store.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 1, Name: "General", ThreadType: 2, IsGroup: true})
+	store.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 1, UpdatedAtUnixMs: 50})
+	if got, _ := store.GetThread(ctx, 1); got.Name != "General" || !got.IsGroup || got.UpdatedAtUnixMs != 50 {
+		t.Fatalf("GetThread() after partial upsert = %+v", got)
+	}
+
+	store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m1", ThreadID: 1, Text: "a", TimestampMs: 10, CreatedAtUnixMs: 10})
+	store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m1", ThreadID: 1, Text: "b", TimestampMs: 10, CreatedAtUnixMs: 99})
+	got, _ := store.GetMessage(ctx, "m1")
+	if got.Text != "b" || got.CreatedAtUnixMs != 10 {
+		t.Fatalf("GetMessage() after re-upsert = %+v", got)
+	}
+	got.Text = "changed"
+	if again, _ := store.GetMessage(ctx, "m1"); again.Text != "b" {
+		t.Fatal("GetMessage() returned the stored record, not a copy")
+	}
+	threads, _ := store.ListThreads(ctx)
+	if len(threads) != 1 || threads[0].LastActivityMs != 10 {
+		t.Fatalf("ListThreads() = %+v, want activity from the newest message", threads)
+	}
+}
+
+func TestMemoryStorePagesThreadMessages(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for i, id := range []string{"a", "b", "c", "d"} {
+		store.UpsertMessage(ctx, &core.MessageRecord{MessageID: id, ThreadID: 1, TimestampMs: int64(i)})
+	}
+	store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "x", ThreadID: 2, TimestampMs: 9})
+
+	page, _ := store.ListThreadMessages(ctx, 1, 2, "")
+	if len(page) != 2 || page[0].MessageID != "d" || page[1].MessageID != "c" {
+		t.Fatalf("first page = %v", messageIDs(page))
+	}
+	page, _ = store.ListThreadMessages(ctx, 1, 2, "c")
+	if len(page) != 2 || page[0].MessageID != "b" || page[1].MessageID != "a" {
+		t.Fatalf("second page = %v", messageIDs(page))
+	}
+}
+
+func TestBatchedStoreOverEveryBackend(t *testing.T) {
+	ctx := context.Background()
+	bolt, err := OpenBoltStore(filepath.Join(t.TempDir(), "messages.bolt"))
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+	sqlite, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	for name, store := range map[string]Store{"sqlite": sqlite, "bolt": bolt, "memory": NewMemoryStore()} {
+		t.Run(name, func(t *testing.T) {
+			batched := NewBatchedStore(store, zerolog.Nop(), 10, 5, 5)
+			defer batched.Close()
+
+			if err := batched.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 1, Name: "General"}); err != nil {
+				t.Fatalf("UpsertThread() error = %v", err)
+			}
+			if err := batched.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m1", ThreadID: 1, Text: "hi"}); err != nil {
+				t.Fatalf("UpsertMessage() error = %v", err)
+			}
+			if err := batched.SetLastBotMessage(ctx, 1, "m1"); err != nil {
+				t.Fatalf("SetLastBotMessage() error = %v", err)
+			}
+			if got, _ := batched.GetLastBotMessage(ctx, 1); got == nil || got.Text != "hi" {
+				t.Fatalf("GetLastBotMessage() = %+v", got)
+			}
+			if err := batched.ClearLastBotMessage(ctx, 1, "other"); err != nil {
+				t.Fatalf("ClearLastBotMessage(other) error = %v", err)
+			}
+			if got, _ := batched.GetLastBotMessage(ctx, 1); got == nil {
+				t.Fatal("ClearLastBotMessage() cleared a different message")
+			}
+			if err := batched.ClearLastBotMessage(ctx, 1, ""); err != nil {
+				t.Fatalf("ClearLastBotMessage() error = %v", err)
+			}
+			if got, _ := batched.GetLastBotMessage(ctx, 1); got != nil {
+				t.Fatalf("GetLastBotMessage() after clear = %+v", got)
+			}
+		})
+	}
+}
+
+func messageIDs(items []*core.MessageRecord) []string {
+	ids := make([]string, len(items))
+	for i, m := range items {
+		ids[i] = m.MessageID
+	}
+	return ids
+}
@@ -0,0 +1,48 @@
+package messaging
+
+import (
+	"go.mau.fi/mautrix-meta/pkg/messagix/socket"
+
+	"mybot/internal/core"
+)
+
+// MentionsFromTable converts the comma-separated mention columns of an
+// LSInsertMessage/LSUpsertMessage row into person mentions. Thread-wide
+// mentions (@everyone) and malformed data are ignored.
+func MentionsFromTable(ids, offsets, lengths, types string) []core.Mention {
+	parsed, err := (&socket.MentionData{
+		MentionIDs:     ids,
+		MentionOffsets: offsets,
+		MentionLengths: lengths,
+		MentionTypes:   types,
+	}).Parse()
+	if err != nil || len(parsed) == 0 {
+		return nil
+	}
+	mentions := make([]core.Mention, 0, len(parsed))
+	for _, m := range parsed {
+		if m.Type == socket.MentionTypeThread || m.ID == 0 {
+			continue
+		}
+		mentions = append(mentions, core.Mention{UserID: m.ID, Offset: m.Offset, Length: m.Length})
+	}
+	return mentions
+}
+
+// MentionData converts mentions into the socket representation used by
+// SendMessageTask. Returns nil when there is nothing to send.
+func MentionData(mentions []core.Mention) *socket.MentionData {
+	if len(mentions) == 0 {
+		return nil
+	}
+	out := make(socket.Mentions, 0, len(mentions))
+	for _, m := range mentions {
+		out = append(out, socket.Mention{
+			ID:     m.UserID,
+			Offset: m.Offset,
+			Length: m.Length,
+			Type:   socket.MentionTypePerson,
+		})
+	}
+	return out.ToData()
+}
@@ -0,0 +1,35 @@
+package messaging
+
+import (
+	"testing"
+
+	"mybot/internal/core"
+)
+
+func TestMentionsTableRoundTrip(t *testing.T) {
+	in := []core.Mention{
+		{UserID: 100, Offset: 0, Length: 4},
+		{UserID: 200, Offset: 6, Length: 3},
+	}
+	data := MentionData(in)
+	if data == nil {
+		t.Fatal("MentionData() = nil")
+	}
+	got := MentionsFromTable(data.MentionIDs, data.MentionOffsets, data.MentionLengths, data.MentionTypes)
+	if len(got) != len(in) {
+		t.Fatalf("MentionsFromTable() = %+v, want %+v", got, in)
+	}
+	for i := range in {
+		if got[i] != in[i] {
+			t.Fatalf("MentionsFromTable()[%d] = %+v, want %+v", i, got[i], in[i])
+		}
+	}
+
+	// Thread-wide mentions (@everyone) carry no user and are dropped.
+	if got := MentionsFromTable("300", "0", "9", "t"); len(got) != 0 {
+		t.Fatalf("MentionsFromTable(thread) = %+v, want none", got)
+	}
+	if got := MentionsFromTable("", "", "", ""); got != nil {
+		t.Fatalf("MentionsFromTable(empty) = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,505 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when the database was written by a newer build
+// than this one.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+// migration upgrades the schema to version. Migrations must stay idempotent
+// (CREATE ... IF NOT EXISTS, ensureColumn): databases that predate the meta
+// table run all of them over whatever tables they already have.
+type migration struct {
+	version int
+	name    string
+	// columns are added to tables that already exist, before stmts run.
+	columns []columnDef
+	stmts   string
+	// fill runs last, for values SQL can't compute.
+	fill func(ctx context.Context, tx *sql.Tx) error
+}
+
+type columnDef struct{ table, column, decl string }
+
+// migrations lists every schema change in order. Never edit a released
+// migration; append a new one instead, along with the full resulting schema
+// in testdata/schema/v<version>.sql for the upgrade tests.
+var migrations = []migration{
+	{version: 3, name: "baseline", stmts: `
+CREATE TABLE IF NOT EXISTS threads (
+    thread_id        INTEGER PRIMARY KEY,
+    name             TEXT    NOT NULL DEFAULT '',
+    updated_at_ms    INTEGER NOT NULL DEFAULT 0,
+    last_activity_ms INTEGER NOT NULL DEFAULT 0,
+    deleted          INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    user_id       INTEGER PRIMARY KEY,
+    name          TEXT    NOT NULL DEFAULT '',
+    updated_at_ms INTEGER NOT NULL DEFAULT 0,
+    deleted       INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    message_id           TEXT PRIMARY KEY,
+    thread_id            INTEGER NOT NULL DEFAULT 0,
+    sender_id            INTEGER NOT NULL DEFAULT 0,
+    sender_name_snapshot TEXT    NOT NULL DEFAULT '',
+    text                 TEXT    NOT NULL DEFAULT '',
+    reply_to_message_id  TEXT    NOT NULL DEFAULT '',
+    offline_threading_id TEXT    NOT NULL DEFAULT '',
+    is_from_bot          INTEGER NOT NULL DEFAULT 0,
+    has_media            INTEGER NOT NULL DEFAULT 0,
+    attachments_json     TEXT    NOT NULL DEFAULT '[]',
+    timestamp_ms         INTEGER NOT NULL DEFAULT 0,
+    edit_count           INTEGER NOT NULL DEFAULT 0,
+    is_edited            INTEGER NOT NULL DEFAULT 0,
+    is_recalled          INTEGER NOT NULL DEFAULT 0,
+    created_at_ms        INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms        INTEGER NOT NULL DEFAULT 0,
+    recalled_at_ms       INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_thread_ts
+    ON messages(thread_id, timestamp_ms, message_id);
+
+CREATE TABLE IF NOT EXISTS thread_last_bot (
+    thread_id  INTEGER PRIMARY KEY,
+    message_id TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS meta (
+    key   TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+`},
+	{version: 4, name: "message edits", stmts: `
+CREATE TABLE IF NOT EXISTS message_edits (
+    message_id     TEXT    NOT NULL,
+    thread_id      INTEGER NOT NULL DEFAULT 0,
+    text           TEXT    NOT NULL DEFAULT '',
+    timestamp_ms   INTEGER NOT NULL DEFAULT 0,
+    recorded_at_ms INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (message_id, timestamp_ms)
+);
+`},
+	{version: 5, name: "message mentions", columns: []columnDef{
+		{"messages", "mentions_json", `TEXT NOT NULL DEFAULT '[]'`},
+	}},
+	{version: 6, name: "outbox", stmts: `
+CREATE TABLE IF NOT EXISTS outbox (
+    id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id          INTEGER NOT NULL,
+    kind               TEXT    NOT NULL,
+    payload_json       TEXT    NOT NULL DEFAULT '{}',
+    otid               INTEGER NOT NULL DEFAULT 0,
+    status             TEXT    NOT NULL DEFAULT 'pending',
+    attempts           INTEGER NOT NULL DEFAULT 0,
+    last_error         TEXT    NOT NULL DEFAULT '',
+    message_id         TEXT    NOT NULL DEFAULT '',
+    created_at_ms      INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms      INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_status_thread
+    ON outbox(status, thread_id, id);
+`},
+	{version: 7, name: "scheduled messages", stmts: `
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id     INTEGER NOT NULL,
+    creator_id    INTEGER NOT NULL DEFAULT 0,
+    kind          TEXT    NOT NULL,
+    text          TEXT    NOT NULL DEFAULT '',
+    payload_json  TEXT    NOT NULL DEFAULT '{}',
+    status        TEXT    NOT NULL DEFAULT 'pending',
+    attempts      INTEGER NOT NULL DEFAULT 0,
+    last_error    TEXT    NOT NULL DEFAULT '',
+    message_id    TEXT    NOT NULL DEFAULT '',
+    send_at_ms    INTEGER NOT NULL DEFAULT 0,
+    created_at_ms INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_status_send_at
+    ON scheduled_messages(status, send_at_ms);
+`},
+	{version: 8, name: "reminders", stmts: `
+CREATE TABLE IF NOT EXISTS reminders (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id        INTEGER NOT NULL,
+    creator_id       INTEGER NOT NULL DEFAULT 0,
+    target_id        INTEGER NOT NULL DEFAULT 0,
+    text             TEXT    NOT NULL DEFAULT '',
+    recurrence       TEXT    NOT NULL DEFAULT '',
+    status           TEXT    NOT NULL DEFAULT 'active',
+    next_at_ms       INTEGER NOT NULL DEFAULT 0,
+    anchor_at_ms     INTEGER NOT NULL DEFAULT 0,
+    fire_count       INTEGER NOT NULL DEFAULT 0,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    last_error       TEXT    NOT NULL DEFAULT '',
+    last_fired_at_ms INTEGER NOT NULL DEFAULT 0,
+    created_at_ms    INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms    INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_reminders_status_next_at
+    ON reminders(status, next_at_ms);
+`},
+	{version: 9, name: "thread types and broadcasts", columns: []columnDef{
+		{"threads", "thread_type", `INTEGER NOT NULL DEFAULT 0`},
+		{"threads", "is_group", `INTEGER NOT NULL DEFAULT 0`},
+	}, stmts: `
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    creator_id       INTEGER NOT NULL DEFAULT 0,
+    origin_thread_id INTEGER NOT NULL DEFAULT 0,
+    text             TEXT    NOT NULL DEFAULT '',
+    target           TEXT    NOT NULL DEFAULT '',
+    status           TEXT    NOT NULL DEFAULT 'running',
+    created_at_ms    INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms    INTEGER NOT NULL DEFAULT 0,
+    finished_at_ms   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS broadcast_deliveries (
+    broadcast_id  INTEGER NOT NULL,
+    thread_id     INTEGER NOT NULL,
+    status        TEXT    NOT NULL DEFAULT 'pending',
+    last_error    TEXT    NOT NULL DEFAULT '',
+    message_id    TEXT    NOT NULL DEFAULT '',
+    updated_at_ms INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (broadcast_id, thread_id)
+);
+`},
+	{version: 10, name: "thread participants", stmts: `
+CREATE TABLE IF NOT EXISTS thread_participants (
+    thread_id     INTEGER NOT NULL,
+    user_id       INTEGER NOT NULL,
+    nickname      TEXT    NOT NULL DEFAULT '',
+    is_admin      INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (thread_id, user_id)
+);
+`},
+	{version: 11, name: "polls", stmts: `
+CREATE TABLE IF NOT EXISTS polls (
+    poll_id       INTEGER PRIMARY KEY,
+    thread_id     INTEGER NOT NULL,
+    creator_id    INTEGER NOT NULL DEFAULT 0,
+    question      TEXT    NOT NULL DEFAULT '',
+    message_id    TEXT    NOT NULL DEFAULT '',
+    status        TEXT    NOT NULL DEFAULT 'open',
+    closes_at_ms  INTEGER NOT NULL DEFAULT 0,
+    closed_at_ms  INTEGER NOT NULL DEFAULT 0,
+    created_at_ms INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_polls_thread
+    ON polls(thread_id, created_at_ms);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    poll_id   INTEGER NOT NULL,
+    option_id INTEGER NOT NULL,
+    text      TEXT    NOT NULL DEFAULT '',
+    position  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (poll_id, option_id)
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    poll_id     INTEGER NOT NULL,
+    option_id   INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    voted_at_ms INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (poll_id, option_id, user_id)
+);
+`},
+	{version: 12, name: "moderation events", stmts: `
+CREATE TABLE IF NOT EXISTS moderation_events (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id     INTEGER NOT NULL,
+    user_id       INTEGER NOT NULL,
+    message_id    TEXT    NOT NULL DEFAULT '',
+    reason        TEXT    NOT NULL DEFAULT '',
+    action        TEXT    NOT NULL DEFAULT '',
+    detail        TEXT    NOT NULL DEFAULT '',
+    actor_id      INTEGER NOT NULL DEFAULT 0,
+    until_ms      INTEGER NOT NULL DEFAULT 0,
+    created_at_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_events_thread_user
+    ON moderation_events(thread_id, user_id, created_at_ms);
+`},
+	{version: 13, name: "bans", stmts: `
+CREATE TABLE IF NOT EXISTS bans (
+    thread_id     INTEGER NOT NULL,
+    user_id       INTEGER NOT NULL,
+    reason        TEXT    NOT NULL DEFAULT '',
+    creator_id    INTEGER NOT NULL DEFAULT 0,
+    expires_at_ms INTEGER NOT NULL DEFAULT 0,
+    created_at_ms INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (thread_id, user_id)
+);
+`},
+	{version: 14, name: "message search", stmts: `
+CREATE TABLE IF NOT EXISTS message_search_docs (
+    doc_id     INTEGER PRIMARY KEY,
+    message_id TEXT NOT NULL UNIQUE
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS message_search USING fts5(
+    text,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT OR IGNORE INTO message_search_docs(message_id)
+    SELECT message_id FROM messages
+    WHERE text != '' AND is_from_bot = 0 AND is_recalled = 0;
+
+INSERT INTO message_search(rowid, text)
+    SELECT d.doc_id, replace(replace(m.text, 'đ', 'd'), 'Đ', 'D')
+    FROM message_search_docs d JOIN messages m ON m.message_id = d.message_id
+    WHERE d.doc_id NOT IN (SELECT rowid FROM message_search);
+`},
+	{version: 15, name: "message pins and retention", stmts: `
+CREATE TABLE IF NOT EXISTS message_pins (
+    message_id   TEXT PRIMARY KEY,
+    thread_id    INTEGER NOT NULL,
+    pinned_at_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_pins_thread
+    ON message_pins(thread_id);
+
+CREATE INDEX IF NOT EXISTS idx_messages_ts
+    ON messages(timestamp_ms);
+`},
+	{version: 16, name: "attachment archive", stmts: `
+CREATE TABLE IF NOT EXISTS attachment_blobs (
+    sha256        TEXT PRIMARY KEY,
+    size_bytes    INTEGER NOT NULL,
+    mime_type     TEXT NOT NULL DEFAULT '',
+    created_at_ms INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS message_attachment_files (
+    message_id     TEXT NOT NULL,
+    attachment_id  TEXT NOT NULL,
+    thread_id      INTEGER NOT NULL,
+    sha256         TEXT NOT NULL,
+    archived_at_ms INTEGER NOT NULL,
+    PRIMARY KEY (message_id, attachment_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_files_thread
+    ON message_attachment_files(thread_id, sha256);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_files_sha
+    ON message_attachment_files(sha256);
+`},
+	// The messages already stored are counted in the background; see
+	// SQLiteStore.BackfillStats.
+	{version: 17, name: "stats rollups", stmts: `
+CREATE TABLE IF NOT EXISTS stats_activity (
+    thread_id   INTEGER NOT NULL,
+    hour        INTEGER NOT NULL,
+    sender_id   INTEGER NOT NULL,
+    messages    INTEGER NOT NULL DEFAULT 0,
+    media       INTEGER NOT NULL DEFAULT 0,
+    links       INTEGER NOT NULL DEFAULT 0,
+    responses   INTEGER NOT NULL DEFAULT 0,
+    response_ms INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (thread_id, hour, sender_id)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS stats_terms (
+    thread_id INTEGER NOT NULL,
+    kind      TEXT    NOT NULL,
+    day       INTEGER NOT NULL,
+    sender_id INTEGER NOT NULL,
+    term      TEXT    NOT NULL,
+    count     INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (thread_id, kind, day, sender_id, term)
+) WITHOUT ROWID;
+
+INSERT OR IGNORE INTO meta(key, value)
+    SELECT 'stats_backfill_rowid', CAST(COALESCE(MAX(rowid), 0) AS TEXT) FROM messages;
+`},
+	// Indexes for QueryMessages and QueryUsers. name_key is filled in Go:
+	// SQLite's lower() only folds ASCII letters.
+	{version: 18, name: "query indexes", columns: []columnDef{
+		{"users", "name_key", `TEXT NOT NULL DEFAULT ''`},
+	}, stmts: `
+CREATE INDEX IF NOT EXISTS idx_messages_sender_ts
+    ON messages(sender_id, timestamp_ms, message_id);
+
+CREATE INDEX IF NOT EXISTS idx_messages_reply_ts
+    ON messages(reply_to_message_id, timestamp_ms, message_id);
+
+CREATE INDEX IF NOT EXISTS idx_users_name_key
+    ON users(name_key, user_id);
+`, fill: fillUserNameKeys},
+	{version: 19, name: "queued scheduled messages", columns: []columnDef{
+		{"scheduled_messages", "outbox_id", `INTEGER NOT NULL DEFAULT 0`},
+	}, stmts: `
+CREATE INDEX IF NOT EXISTS idx_scheduled_outbox
+    ON scheduled_messages(outbox_id) WHERE outbox_id != 0;
+`},
+	{version: 20, name: "queued broadcast deliveries", columns: []columnDef{
+		{"broadcast_deliveries", "outbox_id", `INTEGER NOT NULL DEFAULT 0`},
+	}, stmts: `
+CREATE INDEX IF NOT EXISTS idx_broadcast_deliveries_outbox
+    ON broadcast_deliveries(outbox_id) WHERE outbox_id != 0;
+`},
+}
+
+// fillUserNameKeys sets users.name_key for the users stored before it
+// existed.
+func fillUserNameKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT user_id, name FROM users WHERE name != '' AND name_key = ''`)
+	if err != nil {
+		return err
+	}
+	names := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		names[id] = name
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, name := range names {
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET name_key = ? WHERE user_id = ?`, userNameKey(name), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LatestSchemaVersion is the schema version this build migrates to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// MigrationReport describes what OpenSQLiteStore did to the schema.
+type MigrationReport struct {
+	From, To int
+	// Applied names the migrations that ran, oldest first.
+	Applied []string
+	// BackupPath is the copy taken before upgrading an existing database;
+	// empty when nothing ran or the database was new.
+	BackupPath string
+}
+
+// migrate brings the database at path up to LatestSchemaVersion. An existing
+// database is copied next to path before the first migration runs; each
+// migration then commits together with its schema_version, so an
+// interrupted upgrade resumes where it stopped.
+func migrate(ctx context.Context, db *sql.DB, path string) (MigrationReport, error) {
+	from, fresh, err := readSchemaVersion(ctx, db)
+	if err != nil {
+		return MigrationReport{}, err
+	}
+	report := MigrationReport{From: from, To: from}
+	latest := LatestSchemaVersion()
+	if from > latest {
+		return report, fmt.Errorf("%w: v%d, this build knows v%d", ErrSchemaTooNew, from, latest)
+	}
+	if from == latest {
+		return report, nil
+	}
+
+	if !fresh {
+		report.BackupPath = fmt.Sprintf("%s.v%d-%s.bak", path, from, time.Now().Format("20060102-150405"))
+		if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, report.BackupPath); err != nil {
+			return report, fmt.Errorf("backup before migration: %w", err)
+		}
+	}
+	for _, m := range migrations {
+		if m.version <= from {
+			continue
+		}
+		if err := applyMigration(ctx, db, m); err != nil {
+			return report, fmt.Errorf("migrate to v%d (%s): %w", m.version, m.name, err)
+		}
+		report.To = m.version
+		report.Applied = append(report.Applied, m.name)
+	}
+	return report, nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, col := range m.columns {
+		if err := ensureColumn(ctx, tx, col.table, col.column, col.decl); err != nil {
+			return err
+		}
+	}
+	if m.stmts != "" {
+		if _, err := tx.ExecContext(ctx, m.stmts); err != nil {
+			return err
+		}
+	}
+	if m.fill != nil {
+		if err := m.fill(ctx, tx); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO meta(key, value) VALUES('schema_version', ?)`, strconv.Itoa(m.version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// readSchemaVersion returns the recorded schema version, 0 when there is
+// none, and whether the database has no tables at all.
+func readSchemaVersion(ctx context.Context, db *sql.DB) (int, bool, error) {
+	var tables int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables); err != nil {
+		return 0, false, fmt.Errorf("inspect schema: %w", err)
+	}
+	if tables == 0 {
+		return 0, true, nil
+	}
+	var hasMeta int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'meta'`).Scan(&hasMeta); err != nil {
+		return 0, false, fmt.Errorf("inspect schema: %w", err)
+	}
+	if hasMeta == 0 {
+		return 0, false, nil
+	}
+	var value string
+	err := db.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = 'schema_version'`).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("read schema version: %w", err)
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false, fmt.Errorf("bad schema version %q: %w", value, err)
+	}
+	return version, false, nil
+}
@@ -0,0 +1,214 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"mybot/internal/core"
+)
+
+// writeFixture creates a database at path from testdata/schema/v<version>.sql
+// with one thread, user and message, as a build of that version left it.
+// recorded is the schema_version stored in meta (0 = none).
+func writeFixture(t *testing.T, path string, version, recorded int) {
+	t.Helper()
+	schema, err := os.ReadFile(filepath.Join("testdata", "schema", fmt.Sprintf("v%d.sql", version)))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	defer db.Close()
+	stmts := []string{
+		string(schema),
+		`INSERT INTO threads(thread_id, name, updated_at_ms) VALUES(123, 'General', 100)`,
+		`INSERT INTO users(user_id, name, updated_at_ms) VALUES(456, 'Alice', 100)`,
+		`INSERT INTO messages(message_id, thread_id, sender_id, text, timestamp_ms) VALUES('m1', 123, 456, 'hello', 1000)`,
+	}
+	if version >= 14 {
+		// The store indexes messages as it writes them; do the same here.
+		stmts = append(stmts,
+			`INSERT INTO message_search_docs(message_id) VALUES('m1')`,
+			`INSERT INTO message_search(rowid, text) SELECT doc_id, 'hello' FROM message_search_docs`)
+	}
+	if version >= 17 {
+		// Likewise for the stats rollups.
+		stmts = append(stmts, `INSERT INTO stats_activity(thread_id, hour, sender_id, messages) VALUES(123, 0, 456, 1)`)
+	}
+	if version >= 18 {
+		// And for the name users are looked up by.
+		stmts = append(stmts, `UPDATE users SET name_key = 'alice' WHERE user_id = 456`)
+	}
+	if recorded > 0 {
+		stmts = append(stmts, fmt.Sprintf(`INSERT INTO meta(key, value) VALUES('schema_version', '%d')`, recorded))
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("fixture v%d: %v", version, err)
+		}
+	}
+}
+
+// schemaOf describes the tables and indexes of the database at path,
+// independent of column order.
+func schemaOf(t *testing.T, path string) map[string][]string {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT type, name, tbl_name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		t.Fatalf("sqlite_master: %v", err)
+	}
+	type object struct{ kind, name, table string }
+	var objects []object
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.kind, &o.name, &o.table); err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+
+	schema := make(map[string][]string)
+	for _, o := range objects {
+		if o.kind == "index" {
+			schema[o.table] = append(schema[o.table], "index "+o.name)
+			continue
+		}
+		cols, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", o.name))
+		if err != nil {
+			t.Fatalf("table_info(%s): %v", o.name, err)
+		}
+		for cols.Next() {
+			var (
+				cid, notNull, pk int
+				name, colType    string
+				dflt             sql.NullString
+			)
+			if err := cols.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+				t.Fatal(err)
+			}
+			schema[o.name] = append(schema[o.name], fmt.Sprintf("%s %s notnull=%d default=%s pk=%d", name, colType, notNull, dflt.String, pk))
+		}
+		cols.Close()
+	}
+	for _, items := range schema {
+		slices.Sort(items)
+	}
+	return schema
+}
+
+func TestMigrateUpgradesEveryHistoricalVersion(t *testing.T) {
+	ctx := context.Background()
+	freshPath := filepath.Join(t.TempDir(), "fresh.sqlite")
+	fresh, err := OpenSQLiteStore(freshPath)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore(fresh) error = %v", err)
+	}
+	if r := fresh.Migration(); r.From != 0 || r.To != LatestSchemaVersion() || r.BackupPath != "" {
+		t.Fatalf("fresh Migration() = %+v", r)
+	}
+	fresh.Close()
+	want := schemaOf(t, freshPath)
+
+	// The next migration is tested against the schema this build writes.
+	latestPath := filepath.Join(t.TempDir(), "latest.sqlite")
+	writeFixture(t, latestPath, LatestSchemaVersion(), LatestSchemaVersion())
+	if got := schemaOf(t, latestPath); !reflect.DeepEqual(got, want) {
+		t.Fatalf("testdata/schema/v%d.sql differs from a fresh database:\n got  %v\n want %v", LatestSchemaVersion(), got, want)
+	}
+
+	cases := []struct {
+		name              string
+		fixture, recorded int
+	}{
+		{"unversioned", 3, 0},
+	}
+	for v := 3; v < LatestSchemaVersion(); v++ {
+		cases = append(cases, struct {
+			name              string
+			fixture, recorded int
+		}{fmt.Sprintf("v%d", v), v, v})
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "messages.sqlite")
+			writeFixture(t, path, tc.fixture, tc.recorded)
+
+			store, err := OpenSQLiteStore(path)
+			if err != nil {
+				t.Fatalf("OpenSQLiteStore() error = %v", err)
+			}
+			r := store.Migration()
+			if r.From != tc.recorded || r.To != LatestSchemaVersion() || len(r.Applied) == 0 {
+				t.Fatalf("Migration() = %+v", r)
+			}
+			if _, err := os.Stat(r.BackupPath); err != nil {
+				t.Fatalf("backup %q: %v", r.BackupPath, err)
+			}
+			msg, err := store.GetMessage(ctx, "m1")
+			if err != nil || msg == nil || msg.Text != "hello" || len(msg.Mentions) != 0 {
+				t.Fatalf("GetMessage() after upgrade = %+v, %v", msg, err)
+			}
+			if found, err := store.SearchMessages(ctx, 123, "hello", core.SearchFilters{}); err != nil || len(found) != 1 {
+				t.Fatalf("SearchMessages() after upgrade = %v, %v", found, err)
+			}
+			// Messages stored before v17 are counted by the backfill.
+			wantBackfill := 0
+			if tc.fixture < 17 {
+				wantBackfill = 1
+			}
+			if n, err := store.BackfillStats(ctx, 10); err != nil || n != wantBackfill {
+				t.Fatalf("BackfillStats() after upgrade = %d, %v, want %d", n, err, wantBackfill)
+			}
+			if rows, err := store.StatsBySender(ctx, 123, core.StatsQuery{}); err != nil || len(rows) != 1 || rows[0].Messages != 1 {
+				t.Fatalf("StatsBySender() after upgrade = %+v, %v", rows, err)
+			}
+			if users, err := store.QueryUsers(ctx, core.UserQuery{NamePrefix: "al"}); err != nil || len(users) != 1 {
+				t.Fatalf("QueryUsers() after upgrade = %v, %v", users, err)
+			}
+			if err := store.UpsertBan(ctx, &core.Ban{ThreadID: 123, UserID: 456}); err != nil {
+				t.Fatalf("UpsertBan() after upgrade error = %v", err)
+			}
+			store.Close()
+
+			if got := schemaOf(t, path); !reflect.DeepEqual(got, want) {
+				t.Fatalf("upgraded schema differs from a fresh one:\n got  %v\n want %v", got, want)
+			}
+			// The backup keeps the old schema for a rollback.
+			if got := schemaOf(t, r.BackupPath); reflect.DeepEqual(got, want) {
+				t.Fatal("backup already has the new schema")
+			}
+
+			store, err = OpenSQLiteStore(path)
+			if err != nil {
+				t.Fatalf("reopen error = %v", err)
+			}
+			defer store.Close()
+			if r := store.Migration(); r.From != LatestSchemaVersion() || len(r.Applied) != 0 || r.BackupPath != "" {
+				t.Fatalf("Migration() on reopen = %+v", r)
+			}
+		})
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.sqlite")
+	writeFixture(t, path, 12, LatestSchemaVersion()+1)
+	if _, err := OpenSQLiteStore(path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("OpenSQLiteStore() error = %v, want ErrSchemaTooNew", err)
+	}
+}
@@ -0,0 +1,462 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+// moderationSweepEvery is how often activity of quiet users is dropped.
+const moderationSweepEvery = 5 * time.Minute
+
+var moderationLinkRegex = regexp.MustCompile(`(?i)https?://\S+|www\.\S+`)
+
+// ModerationStore persists the moderation audit trail.
+type ModerationStore interface {
+	InsertModerationEvent(ctx context.Context, e *core.ModerationEvent) (int64, error)
+	// ListModerationEvents returns the latest limit events of threadID,
+	// newest first; userID 0 returns every user's.
+	ListModerationEvents(ctx context.Context, threadID, userID int64, limit int) ([]*core.ModerationEvent, error)
+	// CountModerationStrikes returns the automatic events of userID in
+	// threadID since sinceMs that came after their last pardon.
+	CountModerationStrikes(ctx context.Context, threadID, userID, sinceMs int64) (int, error)
+	// ListActiveMutes returns the mutes still running at nowMs that no
+	// later pardon lifted, oldest first.
+	ListActiveMutes(ctx context.Context, nowMs int64) ([]*core.ModerationEvent, error)
+}
+
+// ModerationPolicy sets the anti-spam rules. A rule whose count is 0 or
+// less is off.
+type ModerationPolicy struct {
+	// FloodMessages is how many messages a user may send within FloodWindow.
+	FloodMessages int
+	FloodWindow   time.Duration
+	// DuplicateMessages is how many times the same text may be sent within
+	// DuplicateWindow before it counts as spam.
+	DuplicateMessages int
+	DuplicateWindow   time.Duration
+	// LinkCount is how many links a user may post within LinkWindow.
+	LinkCount  int
+	LinkWindow time.Duration
+	// MaxMentions is how many distinct users one message may @mention.
+	MaxMentions int
+	// Actions is the escalation ladder: the nth strike within StrikeWindow
+	// gets Actions[n-1], and the last action repeats after that.
+	Actions      []core.ModerationAction
+	StrikeWindow time.Duration
+	// MuteFor is how long a muted user is ignored.
+	MuteFor time.Duration
+}
+
+// Moderator watches group messages for flooding, repeated text, link spam
+// and mass mentions. A user who breaks a rule gets the next action of the
+// policy's ladder: a warning, being ignored by the bot for a while, or
+// removal from the group when the bot is an admin there. Admins and owners
+// are never moderated. Every action is recorded in the store, and running
+// mutes are read back from it on start.
+type Moderator struct {
+	log     zerolog.Logger
+	store   ModerationStore
+	service *Service
+	policy  ModerationPolicy
+	roleOf  RoleResolver
+	roles   *threadRoles
+
+	mu        sync.Mutex
+	activity  map[moderationKey]*userActivity
+	muted     map[moderationKey]time.Time
+	lastSweep time.Time
+}
+
+type moderationKey struct {
+	threadID int64
+	userID   int64
+}
+
+// userActivity is what a user sent recently in one thread.
+type userActivity struct {
+	messages []time.Time
+	links    []time.Time
+	texts    []recentText
+	lastSeen time.Time
+}
+
+type recentText struct {
+	text string
+	at   time.Time
+}
+
+// EnableModeration starts applying policy to group messages passed to
+// ModerateMessage, recording actions in store. roleOf tells admins and
+// owners apart, who are exempt. It loads the running mutes from store, and
+// the thread types and group admins from the message store so messages can
+// be checked without reading it.
+func (s *Service) EnableModeration(store ModerationStore, policy ModerationPolicy, roleOf RoleResolver) error {
+	if len(policy.Actions) == 0 {
+		policy.Actions = []core.ModerationAction{core.ModerationWarn}
+	}
+	ctx := context.Background()
+	roles, err := loadThreadRoles(ctx, s.store)
+	if err != nil {
+		return err
+	}
+	mutes, err := store.ListActiveMutes(ctx, time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	m := &Moderator{
+		log:      s.log.With().Str("component", "moderation").Logger(),
+		store:    store,
+		service:  s,
+		policy:   policy,
+		roleOf:   roleOf,
+		roles:    roles,
+		activity: make(map[moderationKey]*userActivity),
+		muted:    make(map[moderationKey]time.Time, len(mutes)),
+	}
+	for _, e := range mutes {
+		m.muted[moderationKey{e.ThreadID, e.UserID}] = time.UnixMilli(e.UntilUnixMs)
+	}
+	s.projector.roles = roles
+	s.moderator = m
+	return nil
+}
+
+// ModerateMessage checks msg against the anti-spam rules and acts on a
+// violation. It reports whether the bot should ignore msg: it broke a rule
+// or its sender is muted in the thread.
+func (s *Service) ModerateMessage(ctx context.Context, msg *core.MessageRecord) bool {
+	ignore, act := s.ObserveMessage(ctx, msg)
+	if act != nil {
+		act(ctx)
+	}
+	return ignore
+}
+
+// ObserveMessage counts msg against the anti-spam rules without acting on
+// it, so it can run for every message, even one the bot is too busy to
+// handle. It reads no store, as long as roleOf doesn't: IsThreadAdmin
+// answers from memory while moderation is on. It reports whether the bot
+// should ignore msg, like ModerateMessage, and when msg broke a rule
+// returns the action to take: it sends to the thread, so run it off the
+// event loop.
+func (s *Service) ObserveMessage(ctx context.Context, msg *core.MessageRecord) (ignore bool, act func(context.Context)) {
+	m := s.moderator
+	if m == nil || msg.SenderID == 0 || msg.SenderID == s.SelfID() {
+		return false, nil
+	}
+	if group, known := m.roles.isGroup(msg.ThreadID); known && !group {
+		return false, nil
+	}
+	if m.roleOf != nil && m.roleOf(ctx, msg.ThreadID, msg.SenderID) >= core.RoleAdmin {
+		return false, nil
+	}
+
+	now := time.Now()
+	key := moderationKey{msg.ThreadID, msg.SenderID}
+	m.mu.Lock()
+	m.sweep(now)
+	reason, detail := m.observe(key, msg, now)
+	muted := m.muted[key].After(now)
+	m.mu.Unlock()
+
+	if reason == "" {
+		return muted, nil
+	}
+	return true, func(ctx context.Context) { m.act(ctx, msg, reason, detail, now) }
+}
+
+// ModerationEvents returns the latest moderation events of threadID.
+func (s *Service) ModerationEvents(ctx context.Context, threadID, userID int64, limit int) ([]*core.ModerationEvent, error) {
+	if s.moderator == nil {
+		return nil, ErrModerationDisabled
+	}
+	return s.moderator.store.ListModerationEvents(ctx, threadID, userID, limit)
+}
+
+// MutedUsers returns the users ignored in threadID and when that ends.
+func (s *Service) MutedUsers(_ context.Context, threadID int64) (map[int64]time.Time, error) {
+	m := s.moderator
+	if m == nil {
+		return nil, ErrModerationDisabled
+	}
+	now := time.Now()
+	users := make(map[int64]time.Time)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, until := range m.muted {
+		if key.threadID == threadID && until.After(now) {
+			users[key.userID] = until
+		}
+	}
+	return users, nil
+}
+
+// Mute makes the bot ignore userID in threadID for d.
+func (s *Service) Mute(ctx context.Context, threadID, userID int64, d time.Duration) error {
+	m := s.moderator
+	if m == nil {
+		return ErrModerationDisabled
+	}
+	if userID == 0 || d <= 0 {
+		return ErrInvalidRequest
+	}
+	if m.roleOf != nil && m.roleOf(ctx, threadID, userID) >= core.RoleAdmin {
+		return ErrTargetOutranks
+	}
+	now := time.Now()
+	until := now.Add(d)
+	m.mu.Lock()
+	m.muted[moderationKey{threadID, userID}] = until
+	m.mu.Unlock()
+	return m.record(ctx, &core.ModerationEvent{
+		ThreadID:        threadID,
+		UserID:          userID,
+		Reason:          core.ModerationManual,
+		Action:          core.ModerationMute,
+		ActorID:         core.RequesterFromContext(ctx),
+		UntilUnixMs:     until.UnixMilli(),
+		CreatedAtUnixMs: now.UnixMilli(),
+	})
+}
+
+// Pardon lifts the mute of userID in threadID and clears their strikes, so
+// their next violation starts the ladder over.
+func (s *Service) Pardon(ctx context.Context, threadID, userID int64) error {
+	m := s.moderator
+	if m == nil {
+		return ErrModerationDisabled
+	}
+	key := moderationKey{threadID, userID}
+	m.mu.Lock()
+	delete(m.muted, key)
+	delete(m.activity, key)
+	m.mu.Unlock()
+	return m.record(ctx, &core.ModerationEvent{
+		ThreadID:        threadID,
+		UserID:          userID,
+		Reason:          core.ModerationManual,
+		Action:          core.ModerationPardon,
+		ActorID:         core.RequesterFromContext(ctx),
+		CreatedAtUnixMs: time.Now().UnixMilli(),
+	})
+}
+
+// observe adds msg to the sender's recent activity and returns the first
+// rule it breaks, with a short description for the audit trail. After a
+// violation the activity starts over, so one burst counts once.
+func (m *Moderator) observe(key moderationKey, msg *core.MessageRecord, now time.Time) (core.ModerationReason, string) {
+	p := m.policy
+	a := m.activity[key]
+	if a == nil {
+		a = &userActivity{}
+		m.activity[key] = a
+	}
+	a.lastSeen = now
+
+	reason, detail := func() (core.ModerationReason, string) {
+		if p.MaxMentions > 0 {
+			if n := distinctMentions(msg.Mentions); n > p.MaxMentions {
+				return core.ModerationMentions, fmt.Sprintf("nhắc %d người trong một tin", n)
+			}
+		}
+		if p.LinkCount > 0 {
+			for range moderationLinkRegex.FindAllString(msg.Text, -1) {
+				a.links = append(a.links, now)
+			}
+			a.links = pruneBefore(a.links, now.Add(-p.LinkWindow))
+			if len(a.links) > p.LinkCount {
+				return core.ModerationLinks, fmt.Sprintf("%d link trong %s", len(a.links), p.LinkWindow)
+			}
+		}
+		if p.DuplicateMessages > 0 {
+			if text := normalizeForDuplicate(msg.Text); text != "" {
+				cutoff := now.Add(-p.DuplicateWindow)
+				kept, same := a.texts[:0], 1
+				for _, t := range a.texts {
+					if t.at.Before(cutoff) {
+						continue
+					}
+					if t.text == text {
+						same++
+					}
+					kept = append(kept, t)
+				}
+				a.texts = append(kept, recentText{text: text, at: now})
+				if same > p.DuplicateMessages {
+					return core.ModerationDuplicate, fmt.Sprintf("lặp lại %d lần trong %s", same, p.DuplicateWindow)
+				}
+			}
+		}
+		if p.FloodMessages > 0 {
+			a.messages = pruneBefore(append(a.messages, now), now.Add(-p.FloodWindow))
+			if len(a.messages) > p.FloodMessages {
+				return core.ModerationFlood, fmt.Sprintf("%d tin trong %s", len(a.messages), p.FloodWindow)
+			}
+		}
+		return "", ""
+	}()
+	if reason != "" {
+		m.activity[key] = &userActivity{lastSeen: now}
+	}
+	return reason, detail
+}
+
+// act applies the next action of the ladder to the sender of msg, records it
+// and tells the thread.
+func (m *Moderator) act(ctx context.Context, msg *core.MessageRecord, reason core.ModerationReason, detail string, now time.Time) {
+	p := m.policy
+	strikes, err := m.store.CountModerationStrikes(ctx, msg.ThreadID, msg.SenderID, now.Add(-p.StrikeWindow).UnixMilli())
+	if err != nil {
+		m.log.Warn().Err(err).Int64("thread", msg.ThreadID).Int64("user", msg.SenderID).Msg("Failed to count strikes")
+	}
+	action := p.Actions[min(strikes, len(p.Actions)-1)]
+
+	event := &core.ModerationEvent{
+		ThreadID:        msg.ThreadID,
+		UserID:          msg.SenderID,
+		MessageID:       msg.MessageID,
+		Reason:          reason,
+		Action:          action,
+		Detail:          detail,
+		CreatedAtUnixMs: now.UnixMilli(),
+	}
+	if action == core.ModerationRemove {
+		if err := m.remove(ctx, msg.ThreadID, msg.SenderID); err != nil {
+			m.log.Warn().Err(err).Int64("thread", msg.ThreadID).Int64("user", msg.SenderID).Msg("Cannot remove spammer, muting instead")
+			event.Action = core.ModerationMute
+			event.Detail += "; không xoá được: " + err.Error()
+		}
+	}
+	if event.Action == core.ModerationMute {
+		until := now.Add(p.MuteFor)
+		event.UntilUnixMs = until.UnixMilli()
+		m.mu.Lock()
+		m.muted[moderationKey{msg.ThreadID, msg.SenderID}] = until
+		m.mu.Unlock()
+	}
+	m.log.Info().
+		Int64("thread", msg.ThreadID).
+		Int64("user", msg.SenderID).
+		Str("reason", string(reason)).
+		Str("action", string(event.Action)).
+		Int("strikes", strikes+1).
+		Msg("Moderation action")
+	if err := m.record(ctx, event); err != nil {
+		m.log.Warn().Err(err).Int64("thread", msg.ThreadID).Msg("Failed to record moderation event")
+	}
+	if _, err := m.service.SendText(ctx, m.notice(ctx, event)); err != nil {
+		m.log.Warn().Err(err).Int64("thread", msg.ThreadID).Msg("Failed to send moderation notice")
+	}
+}
+
+// remove removes userID from threadID when the bot is known to be an admin
+// there.
+func (m *Moderator) remove(ctx context.Context, threadID, userID int64) error {
+	if admin, known := m.service.BotIsAdmin(ctx, threadID); !admin || !known {
+		return ErrBotNotAdmin
+	}
+	transport, err := m.service.transport()
+	if err != nil {
+		return err
+	}
+	if err := transport.RemoveParticipant(ctx, threadID, userID); err != nil {
+		return err
+	}
+	return m.service.store.DeleteParticipant(ctx, threadID, userID)
+}
+
+func (m *Moderator) record(ctx context.Context, e *core.ModerationEvent) error {
+	id, err := m.store.InsertModerationEvent(ctx, e)
+	if err != nil {
+		return err
+	}
+	e.ID = id
+	return nil
+}
+
+// notice builds the message telling the thread what was done to whom.
+func (m *Moderator) notice(ctx context.Context, e *core.ModerationEvent) core.SendTextRequest {
+	name := strconv.FormatInt(e.UserID, 10)
+	if user, err := m.service.GetUser(ctx, e.UserID); err == nil && user != nil && user.Name != "" {
+		name = user.Name
+	}
+	b := &core.MentionBuilder{}
+	switch e.Action {
+	case core.ModerationRemove:
+		b.WriteText("👋 Đã xoá ").WriteMention(e.UserID, name).WriteText(" khỏi nhóm vì " + describeModerationReason(e.Reason) + ".")
+	case core.ModerationMute:
+		b.WriteText("🔇 ").WriteMention(e.UserID, name).
+			WriteText(fmt.Sprintf(" bị bot bỏ qua trong %d phút vì %s.", int(m.policy.MuteFor.Minutes()), describeModerationReason(e.Reason)))
+	default:
+		b.WriteText("⚠️ ").WriteMention(e.UserID, name).
+			WriteText(" ơi, đừng " + describeModerationReason(e.Reason) + " nhé. Lần sau bot sẽ mạnh tay hơn.")
+	}
+	return b.TextRequest(e.ThreadID)
+}
+
+// sweep drops the activity of users who have been quiet for longer than any
+// window, and mutes that ended.
+func (m *Moderator) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < moderationSweepEvery {
+		return
+	}
+	m.lastSweep = now
+	idle := max(m.policy.FloodWindow, m.policy.DuplicateWindow, m.policy.LinkWindow)
+	for key, a := range m.activity {
+		if now.Sub(a.lastSeen) > idle {
+			delete(m.activity, key)
+		}
+	}
+	for key, until := range m.muted {
+		if !until.After(now) {
+			delete(m.muted, key)
+		}
+	}
+}
+
+// describeModerationReason returns what a rule forbids, as in "đừng ...".
+func describeModerationReason(r core.ModerationReason) string {
+	switch r {
+	case core.ModerationFlood:
+		return "gửi tin dồn dập"
+	case core.ModerationDuplicate:
+		return "gửi đi gửi lại một nội dung"
+	case core.ModerationLinks:
+		return "gửi quá nhiều link"
+	case core.ModerationMentions:
+		return "nhắc quá nhiều người"
+	}
+	return "spam"
+}
+
+func distinctMentions(mentions []core.Mention) int {
+	seen := make(map[int64]struct{}, len(mentions))
+	for _, m := range mentions {
+		seen[m.UserID] = struct{}{}
+	}
+	return len(seen)
+}
+
+// normalizeForDuplicate folds case and whitespace so trivially altered
+// copies of a message compare equal.
+func normalizeForDuplicate(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// pruneBefore drops the times before cutoff from the sorted times.
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return append(times[:0], times[i:]...)
+}
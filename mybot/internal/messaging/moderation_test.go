@@ -0,0 +1,291 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/mautrix-meta/pkg/messagix/table"
+
+	"mybot/internal/core"
+)
+
+func TestModeratorEscalatesAndPardons(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	transport := &fakeTransport{
+		selfID:       42,
+		nextTextResp: &core.MessageRecord{MessageID: "m1", ThreadID: 1001, SenderID: 42},
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	defer service.Close()
+
+	if service.ModerateMessage(ctx, &core.MessageRecord{ThreadID: 1001, SenderID: 7, Text: "hi"}) {
+		t.Fatal("ModerateMessage() before EnableModeration = true")
+	}
+	roleOf := func(_ context.Context, _, userID int64) core.Role {
+		if userID == 9 {
+			return core.RoleAdmin
+		}
+		return core.RoleMember
+	}
+	store.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 1001, ThreadType: int64(table.GROUP_THREAD), IsGroup: true})
+	store.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 2002, ThreadType: int64(table.ONE_TO_ONE)})
+	store.UpsertParticipant(ctx, &core.ThreadParticipant{ThreadID: 1001, UserID: 42, IsAdmin: true})
+	if err := service.EnableModeration(store, ModerationPolicy{
+		FloodMessages:     3,
+		FloodWindow:       time.Minute,
+		DuplicateMessages: 2,
+		DuplicateWindow:   time.Minute,
+		LinkCount:         2,
+		LinkWindow:        time.Minute,
+		MaxMentions:       2,
+		Actions:           []core.ModerationAction{core.ModerationWarn, core.ModerationMute, core.ModerationRemove},
+		StrikeWindow:      time.Hour,
+		MuteFor:           time.Hour,
+	}, roleOf); err != nil {
+		t.Fatalf("EnableModeration() error = %v", err)
+	}
+
+	send := func(threadID, userID int64, text string, mentions ...int64) bool {
+		msg := &core.MessageRecord{ThreadID: threadID, SenderID: userID, Text: text}
+		for _, id := range mentions {
+			msg.Mentions = append(msg.Mentions, core.Mention{UserID: id})
+		}
+		return service.ModerateMessage(ctx, msg)
+	}
+
+	// Strike 1: flooding gets a warning.
+	for i, text := range []string{"a", "b", "c"} {
+		if send(1001, 7, text) {
+			t.Fatalf("message %d ignored before the flood limit", i+1)
+		}
+	}
+	if !send(1001, 7, "d") {
+		t.Fatal("4th message within the window not flagged")
+	}
+	if len(transport.textReqs) != 1 || !strings.HasPrefix(transport.textReqs[0].Text, "⚠️ @7") ||
+		len(transport.textReqs[0].Mentions) != 1 || transport.textReqs[0].Mentions[0].UserID != 7 {
+		t.Fatalf("warning = %+v", transport.textReqs)
+	}
+	if send(1001, 7, "e") {
+		t.Fatal("message after a warning ignored")
+	}
+
+	// Strike 2: mass mentions get a mute; the muted user is ignored.
+	if !send(1001, 7, "ê mọi người", 1, 2, 3) {
+		t.Fatal("mass mention not flagged")
+	}
+	if !send(1001, 7, "f") {
+		t.Fatal("muted user not ignored")
+	}
+	if muted, _ := service.MutedUsers(ctx, 1001); muted[7].IsZero() {
+		t.Fatalf("MutedUsers() = %v, want user 7", muted)
+	}
+
+	// Strike 3: link spam gets the user removed, as the bot is an admin.
+	if !send(1001, 7, "https://a.example https://b.example www.c.example") {
+		t.Fatal("link spam not flagged")
+	}
+	if !slices.Contains(transport.threadCalls, "remove 1001 7") {
+		t.Fatalf("threadCalls = %v, want removal", transport.threadCalls)
+	}
+
+	events, err := service.ModerationEvents(ctx, 1001, 7, 10)
+	if err != nil {
+		t.Fatalf("ModerationEvents() error = %v", err)
+	}
+	var got []string
+	for _, e := range events {
+		got = append(got, string(e.Reason)+"/"+string(e.Action))
+	}
+	if want := []string{"links/remove", "mentions/mute", "flood/warn"}; !slices.Equal(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+
+	// A pardon lifts the mute and starts the ladder over.
+	if err := service.Pardon(core.WithRequester(ctx, 9), 1001, 7); err != nil {
+		t.Fatalf("Pardon() error = %v", err)
+	}
+	if send(1001, 7, "xin lỗi") {
+		t.Fatal("pardoned user still ignored")
+	}
+	send(1001, 7, "mua hàng đi")
+	send(1001, 7, "Mua   HÀNG đi")
+	if !send(1001, 7, "mua hàng ĐI") {
+		t.Fatal("repeated text not flagged")
+	}
+	if events, _ := service.ModerationEvents(ctx, 1001, 0, 1); events[0].Reason != core.ModerationDuplicate || events[0].Action != core.ModerationWarn {
+		t.Fatalf("event after pardon = %+v, want duplicate/warn", events[0])
+	}
+
+	// Admins and 1:1 threads are left alone.
+	for i := 0; i < 10; i++ {
+		if send(1001, 9, "admin") || send(2002, 8, "dm") {
+			t.Fatal("admin or 1:1 message moderated")
+		}
+	}
+	if err := service.Mute(ctx, 1001, 9, time.Minute); !errors.Is(err, ErrTargetOutranks) {
+		t.Fatalf("Mute(admin) error = %v, want ErrTargetOutranks", err)
+	}
+}
+
+func TestModeratorMutesWhenBotIsNotAdmin(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	transport := &fakeTransport{selfID: 42}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	defer service.Close()
+	if err := service.EnableModeration(store, ModerationPolicy{
+		MaxMentions: 1,
+		Actions:     []core.ModerationAction{core.ModerationRemove},
+		MuteFor:     time.Hour,
+	}, nil); err != nil {
+		t.Fatalf("EnableModeration() error = %v", err)
+	}
+
+	if !service.ModerateMessage(ctx, &core.MessageRecord{ThreadID: 1001, SenderID: 7, Mentions: []core.Mention{{UserID: 1}, {UserID: 2}}}) {
+		t.Fatal("mass mention not flagged")
+	}
+	if len(transport.threadCalls) != 0 {
+		t.Fatalf("threadCalls = %v, want none without admin rights", transport.threadCalls)
+	}
+	events, _ := service.ModerationEvents(ctx, 1001, 7, 1)
+	if len(events) != 1 || events[0].Action != core.ModerationMute || events[0].UntilUnixMs == 0 {
+		t.Fatalf("events = %+v, want a mute instead of removal", events)
+	}
+}
+
+func TestObserveMessageDefersAction(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	transport := &fakeTransport{selfID: 42}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	defer service.Close()
+	if err := service.EnableModeration(store, ModerationPolicy{
+		FloodMessages: 2,
+		FloodWindow:   time.Minute,
+		Actions:       []core.ModerationAction{core.ModerationMute},
+		MuteFor:       time.Hour,
+	}, nil); err != nil {
+		t.Fatalf("EnableModeration() error = %v", err)
+	}
+
+	// Messages the bot never handles still count towards the limits.
+	for i := 0; i < 2; i++ {
+		if ignore, act := service.ObserveMessage(ctx, &core.MessageRecord{ThreadID: 1001, SenderID: 7, Text: "a"}); ignore || act != nil {
+			t.Fatalf("ObserveMessage(%d) = %v, %v before the flood limit", i+1, ignore, act != nil)
+		}
+	}
+	ignore, act := service.ObserveMessage(ctx, &core.MessageRecord{ThreadID: 1001, SenderID: 7, Text: "a"})
+	if !ignore || act == nil {
+		t.Fatalf("ObserveMessage(3) = %v, %v; want the flood flagged", ignore, act != nil)
+	}
+	if events, _ := service.ModerationEvents(ctx, 1001, 7, 1); len(events) != 0 || len(transport.textReqs) != 0 {
+		t.Fatalf("events = %+v, notices = %d before the action ran", events, len(transport.textReqs))
+	}
+	act(ctx)
+	if events, _ := service.ModerationEvents(ctx, 1001, 7, 1); len(events) != 1 || events[0].Action != core.ModerationMute {
+		t.Fatalf("events = %+v, want a mute", events)
+	}
+	if ignore, _ := service.ObserveMessage(ctx, &core.MessageRecord{ThreadID: 1001, SenderID: 7, Text: "b"}); !ignore {
+		t.Fatal("muted user not ignored")
+	}
+}
+
+func TestModerationKeepsRolesAndMutesInMemory(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "messages.sqlite")
+	store, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	transport := &fakeTransport{selfID: 42}
+	policy := ModerationPolicy{FloodMessages: 1, FloodWindow: time.Minute, MuteFor: time.Hour}
+	roleOf := func(service *Service) RoleResolver {
+		return func(ctx context.Context, threadID, userID int64) core.Role {
+			if service.IsThreadAdmin(ctx, threadID, userID) {
+				return core.RoleAdmin
+			}
+			return core.RoleMember
+		}
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	if err := service.EnableModeration(store, policy, roleOf(service)); err != nil {
+		t.Fatalf("EnableModeration() error = %v", err)
+	}
+
+	// Thread types and admins come from the projector, not the store.
+	if err := service.ObserveTable(ctx, &table.LSTable{
+		LSDeleteThenInsertThread: []*table.LSDeleteThenInsertThread{{ThreadKey: 2002, ThreadType: table.ONE_TO_ONE}},
+		LSAddParticipantIdToGroupThread: []*table.LSAddParticipantIdToGroupThread{
+			{ThreadKey: 1001, ContactId: 9, IsAdmin: true},
+		},
+	}, FullEvents); err != nil {
+		t.Fatalf("ObserveTable() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if ignore, _ := service.ObserveMessage(ctx, &core.MessageRecord{ThreadID: 1001, SenderID: 9, Text: "admin"}); ignore {
+			t.Fatal("admin moderated")
+		}
+		if ignore, _ := service.ObserveMessage(ctx, &core.MessageRecord{ThreadID: 2002, SenderID: 8, Text: "dm"}); ignore {
+			t.Fatal("1:1 message moderated")
+		}
+	}
+	if err := service.ObserveTable(ctx, &table.LSTable{
+		LSUpdateThreadParticipantAdminStatus: []*table.LSUpdateThreadParticipantAdminStatus{
+			{ThreadKey: 1001, ContactId: 9, IsAdmin: false},
+		},
+	}, FullEvents); err != nil {
+		t.Fatalf("ObserveTable() error = %v", err)
+	}
+	if service.IsThreadAdmin(ctx, 1001, 9) {
+		t.Fatal("IsThreadAdmin() after demotion = true")
+	}
+
+	if err := service.Mute(ctx, 1001, 7, time.Hour); err != nil {
+		t.Fatalf("Mute(7) error = %v", err)
+	}
+	if err := service.Mute(ctx, 1001, 8, time.Hour); err != nil {
+		t.Fatalf("Mute(8) error = %v", err)
+	}
+	if err := service.Pardon(ctx, 1001, 8); err != nil {
+		t.Fatalf("Pardon(8) error = %v", err)
+	}
+	service.Close()
+
+	// After a restart, running mutes still hold and the roles are reloaded.
+	store, err = OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore(reopen) error = %v", err)
+	}
+	service = NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	defer service.Close()
+	if err := service.EnableModeration(store, policy, roleOf(service)); err != nil {
+		t.Fatalf("EnableModeration(reopen) error = %v", err)
+	}
+	muted, err := service.MutedUsers(ctx, 1001)
+	if err != nil {
+		t.Fatalf("MutedUsers() error = %v", err)
+	}
+	if len(muted) != 1 || muted[7].IsZero() {
+		t.Fatalf("MutedUsers() after restart = %v, want user 7 only", muted)
+	}
+	if ignore, _ := service.ObserveMessage(ctx, &core.MessageRecord{ThreadID: 2002, SenderID: 8, Text: "dm"}); ignore {
+		t.Fatal("1:1 thread not known after restart")
+	}
+}
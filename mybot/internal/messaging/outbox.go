@@ -0,0 +1,493 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/mautrix-meta/pkg/messagix/methods"
+
+	"mybot/internal/core"
+)
+
+const (
+	// outboxMaxAttempts is how many delivery attempts a queued message gets
+	// before it is marked failed.
+	outboxMaxAttempts = 8
+	// outboxBaseBackoff doubles after every failed attempt, up to
+	// outboxMaxBackoff.
+	outboxBaseBackoff = 2 * time.Second
+	outboxMaxBackoff  = 5 * time.Minute
+	// outboxIdleWait is how often the queue is re-checked without a wake-up.
+	outboxIdleWait = time.Minute
+	// outboxSendTimeout bounds a single delivery attempt.
+	outboxSendTimeout = 3 * time.Minute
+)
+
+// OutboxItem is a queued outbound message as persisted by an OutboxStore.
+type OutboxItem struct {
+	core.OutboxEntry
+	OTID    int64
+	Payload []byte // JSON-encoded outboxPayload
+}
+
+// OutboxStore persists queued outbound messages.
+type OutboxStore interface {
+	EnqueueOutbox(ctx context.Context, item *OutboxItem) (int64, error)
+	UpdateOutbox(ctx context.Context, item *OutboxItem) error
+	GetOutbox(ctx context.Context, id int64) (*OutboxItem, error)
+	// ListPendingOutbox returns pending items ordered by thread, then ID.
+	ListPendingOutbox(ctx context.Context) ([]*OutboxItem, error)
+	HasPendingOutbox(ctx context.Context, threadID int64) (bool, error)
+}
+
+type outboxPayload struct {
+	Text      string         `json:"text,omitempty"`
+	ReplyTo   string         `json:"reply_to,omitempty"`
+	Mentions  []core.Mention `json:"mentions,omitempty"`
+	Files     []outboxFile   `json:"files,omitempty"`
+	StickerID int64          `json:"sticker_id,omitempty"`
+	URL       string         `json:"url,omitempty"`
+	ForwardID string         `json:"forward_id,omitempty"`
+}
+
+// outboxFile is a media item copied into a spool directory, since the
+// caller's temp files are gone by the time the message is delivered.
+type outboxFile struct {
+	Path     string `json:"path"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+}
+
+// Outbox holds sends that can't go out right away and delivers them in
+// per-thread FIFO order once a transport is available. Every attempt reuses
+// the message's OTID so Facebook drops duplicates of a send that actually
+// went through before the error.
+type Outbox struct {
+	log      zerolog.Logger
+	store    OutboxStore
+	service  *Service
+	spoolDir string
+	ready    atomic.Bool
+
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// EnableOutbox queues sends made while the transport is unavailable in store
+// and starts delivering them. Media is copied to spoolDir until delivered.
+func (s *Service) EnableOutbox(store OutboxStore, spoolDir string) error {
+	if err := os.MkdirAll(spoolDir, 0o755); err != nil {
+		return fmt.Errorf("create outbox spool: %w", err)
+	}
+	o := &Outbox{
+		log:      s.log.With().Str("component", "outbox").Logger(),
+		store:    store,
+		service:  s,
+		spoolDir: spoolDir,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	s.outbox = o
+	go o.run()
+	return nil
+}
+
+// NotifyReady tells the outbox the transport is connected, so new sends go
+// out directly again and queued messages are delivered right away.
+func (s *Service) NotifyReady() {
+	if s.outbox != nil {
+		s.outbox.ready.Store(true)
+		s.outbox.Wake()
+	}
+}
+
+// NotifyDisconnected makes new sends queue until the next NotifyReady.
+func (s *Service) NotifyDisconnected() {
+	if s.outbox != nil {
+		s.outbox.ready.Store(false)
+	}
+}
+
+// GetDeliveryStatus reports the state of a queued message.
+func (s *Service) GetDeliveryStatus(ctx context.Context, outboxID int64) (*core.OutboxEntry, error) {
+	if s.outbox == nil {
+		return nil, ErrOutboxDisabled
+	}
+	item, err := s.outbox.store.GetOutbox(ctx, outboxID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrMessageNotFound
+	}
+	entry := item.OutboxEntry
+	return &entry, nil
+}
+
+// shouldQueue reports whether a send to threadID must go through the outbox:
+// the transport is down, or earlier messages for the thread are still queued.
+func (s *Service) shouldQueue(ctx context.Context, threadID int64) bool {
+	if s.outbox == nil {
+		return false
+	}
+	if !s.outbox.connected() {
+		return true
+	}
+	pending, err := s.outbox.store.HasPendingOutbox(ctx, threadID)
+	return err == nil && pending
+}
+
+// sendFailure is an error of the transport itself, as opposed to one from
+// before the send, such as rate limiting. The message may have reached
+// Messenger anyway.
+type sendFailure struct {
+	err error
+}
+
+func (e *sendFailure) Error() string { return e.err.Error() }
+func (e *sendFailure) Unwrap() error { return e.err }
+
+// sendOTID returns otid, or a new one when it is 0 and a failed send may be
+// queued, so the queued copy is sent under the ID the send was tried with.
+func (s *Service) sendOTID(otid int64) int64 {
+	if otid != 0 || s.outbox == nil {
+		return otid
+	}
+	return methods.GenerateEpochID()
+}
+
+// shouldRequeue reports whether a direct send that failed with err should
+// be handed to the outbox: the transport went away or failed the send.
+func (s *Service) shouldRequeue(threadID int64, err error) bool {
+	if s.outbox == nil || err == nil {
+		return false
+	}
+	var failure *sendFailure
+	if !errors.Is(err, ErrTransportUnavailable) && !errors.As(err, &failure) {
+		return false
+	}
+	s.log.Warn().Err(err).Int64("thread", threadID).Msg("Send failed, queueing it for delivery")
+	return true
+}
+
+func (o *Outbox) connected() bool {
+	return o.ready.Load() && o.service.transportFactory() != nil
+}
+
+// Wake schedules a delivery pass.
+func (o *Outbox) Wake() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the delivery loop. Pending items stay queued for next start.
+func (o *Outbox) Close() {
+	o.stopOnce.Do(func() { close(o.stop) })
+	<-o.done
+}
+
+// QueueText persists req and returns a placeholder record carrying its
+// OutboxID.
+func (o *Outbox) QueueText(ctx context.Context, req core.SendTextRequest) (*core.MessageRecord, error) {
+	payload := outboxPayload{Text: req.Text, Mentions: req.Mentions}
+	if req.ReplyTo != nil {
+		payload.ReplyTo = req.ReplyTo.MessageID
+	}
+	rec, err := o.enqueue(ctx, req.ThreadID, "text", req.OTID, payload)
+	if rec != nil {
+		rec.Mentions = req.Mentions
+	}
+	return rec, err
+}
+
+// QueueMedia copies the media in req to the spool directory and persists it.
+func (o *Outbox) QueueMedia(ctx context.Context, req core.SendMediaRequest) (*core.MessageRecord, error) {
+	payload := outboxPayload{Text: req.Text}
+	if req.ReplyTo != nil {
+		payload.ReplyTo = req.ReplyTo.MessageID
+	}
+	prefix := fmt.Sprintf("%d", time.Now().UnixNano())
+	for i := range req.Items {
+		file, err := spoolMedia(o.spoolDir, &req.Items[i], fmt.Sprintf("%s-%d", prefix, i))
+		if err != nil {
+			removeSpooled(payload.Files)
+			return nil, err
+		}
+		payload.Files = append(payload.Files, file)
+	}
+	rec, err := o.enqueue(ctx, req.ThreadID, "media", req.OTID, payload)
+	if err != nil {
+		removeSpooled(payload.Files)
+		return nil, err
+	}
+	rec.HasMedia = true
+	return rec, nil
+}
+
+// QueueSticker persists a sticker send.
+func (o *Outbox) QueueSticker(ctx context.Context, req core.SendStickerRequest) (*core.MessageRecord, error) {
+	payload := outboxPayload{StickerID: req.StickerID}
+	if req.ReplyTo != nil {
+		payload.ReplyTo = req.ReplyTo.MessageID
+	}
+	rec, err := o.enqueue(ctx, req.ThreadID, "sticker", req.OTID, payload)
+	if rec != nil {
+		rec.HasMedia = true
+	}
+	return rec, err
+}
+
+// QueueExternalMedia persists a send of media by URL.
+func (o *Outbox) QueueExternalMedia(ctx context.Context, req core.SendExternalMediaRequest) (*core.MessageRecord, error) {
+	payload := outboxPayload{URL: req.URL}
+	if req.ReplyTo != nil {
+		payload.ReplyTo = req.ReplyTo.MessageID
+	}
+	rec, err := o.enqueue(ctx, req.ThreadID, "external", req.OTID, payload)
+	if rec != nil {
+		rec.HasMedia = true
+	}
+	return rec, err
+}
+
+// QueueForward persists a forward of req.MessageID.
+func (o *Outbox) QueueForward(ctx context.Context, req core.ForwardRequest) (*core.MessageRecord, error) {
+	return o.enqueue(ctx, req.ThreadID, "forward", req.OTID, outboxPayload{ForwardID: req.MessageID})
+}
+
+// enqueue persists a send of kind under otid, or a new OTID when it is 0.
+func (o *Outbox) enqueue(ctx context.Context, threadID int64, kind string, otid int64, payload outboxPayload) (*core.MessageRecord, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if otid == 0 {
+		otid = methods.GenerateEpochID()
+	}
+	nowMs := time.Now().UnixMilli()
+	item := &OutboxItem{
+		OutboxEntry: core.OutboxEntry{
+			ThreadID:        threadID,
+			Kind:            kind,
+			Status:          core.DeliveryPending,
+			CreatedAtUnixMs: nowMs,
+			UpdatedAtUnixMs: nowMs,
+		},
+		OTID:    otid,
+		Payload: data,
+	}
+	id, err := o.store.EnqueueOutbox(ctx, item)
+	if err != nil {
+		return nil, fmt.Errorf("queue message: %w", err)
+	}
+	o.log.Info().Int64("outbox_id", id).Int64("thread", threadID).Str("kind", kind).Msg("Message queued for delivery")
+	o.Wake()
+	return &core.MessageRecord{
+		ThreadID:           threadID,
+		SenderID:           o.service.SelfID(),
+		Text:               payload.Text,
+		ReplyToMessageID:   payload.ReplyTo,
+		OfflineThreadingID: fmt.Sprintf("%d", item.OTID),
+		IsFromBot:          true,
+		CreatedAtUnixMs:    nowMs,
+		UpdatedAtUnixMs:    nowMs,
+		OutboxID:           id,
+	}, nil
+}
+
+// spoolMedia copies item into dir under name (keeping its extension).
+func spoolMedia(dir string, item *core.MediaAttachment, name string) (outboxFile, error) {
+	src, err := item.OpenReader()
+	if err != nil {
+		return outboxFile{}, err
+	}
+	defer src.Close()
+
+	path := filepath.Join(dir, name+filepath.Ext(item.Filename))
+	dst, err := os.Create(path)
+	if err != nil {
+		return outboxFile{}, fmt.Errorf("spool media: %w", err)
+	}
+	size, err := io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return outboxFile{}, fmt.Errorf("spool media: %w", err)
+	}
+	return outboxFile{Path: path, Filename: item.Filename, MimeType: item.MimeType, Size: size}, nil
+}
+
+func removeSpooled(files []outboxFile) {
+	for _, f := range files {
+		os.Remove(f.Path)
+	}
+}
+
+func (o *Outbox) run() {
+	defer close(o.done)
+	for {
+		wait := o.deliverDue()
+		timer := time.NewTimer(wait)
+		select {
+		case <-o.stop:
+			timer.Stop()
+			return
+		case <-o.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// deliverDue sends every pending item whose retry time has come, one thread
+// head at a time, and returns how long to wait before the next pass.
+func (o *Outbox) deliverDue() time.Duration {
+	if !o.connected() {
+		return outboxIdleWait
+	}
+	items, err := o.store.ListPendingOutbox(context.Background())
+	if err != nil {
+		o.log.Warn().Err(err).Msg("Failed to list outbox")
+		return outboxIdleWait
+	}
+
+	wait := outboxIdleWait
+	blocked := make(map[int64]bool)
+	for _, item := range items {
+		select {
+		case <-o.stop:
+			return outboxIdleWait
+		default:
+		}
+		if blocked[item.ThreadID] {
+			continue
+		}
+		if delay := time.Until(time.UnixMilli(item.NextAttemptAtUnixMs)); delay > 0 {
+			blocked[item.ThreadID] = true
+			wait = min(wait, delay)
+			continue
+		}
+		finished, err := o.deliver(item)
+		if errors.Is(err, ErrTransportUnavailable) {
+			return outboxIdleWait
+		}
+		if !finished {
+			// Later messages in this thread wait for this one.
+			blocked[item.ThreadID] = true
+			wait = min(wait, max(time.Until(time.UnixMilli(item.NextAttemptAtUnixMs)), time.Second))
+		}
+	}
+	return wait
+}
+
+// deliver makes one attempt at item and records the outcome. It reports
+// whether the item is finished (sent or given up on).
+func (o *Outbox) deliver(item *OutboxItem) (bool, error) {
+	var payload outboxPayload
+	if err := json.Unmarshal(item.Payload, &payload); err != nil {
+		return true, o.finish(item, core.DeliveryFailed, "", fmt.Sprintf("corrupt payload: %v", err), nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), outboxSendTimeout)
+	defer cancel()
+	var replyTo *core.ReplyTarget
+	if payload.ReplyTo != "" {
+		replyTo = &core.ReplyTarget{MessageID: payload.ReplyTo}
+	}
+
+	var rec *core.MessageRecord
+	var err error
+	switch item.Kind {
+	case "media":
+		attachments := make([]core.MediaAttachment, len(payload.Files))
+		for i, f := range payload.Files {
+			attachments[i] = core.MediaAttachment{FilePath: f.Path, FileSize: f.Size, Filename: f.Filename, MimeType: f.MimeType}
+		}
+		rec, err = o.service.sendMedia(ctx, core.SendMediaRequest{
+			ThreadID: item.ThreadID, Items: attachments, ReplyTo: replyTo, Text: payload.Text, OTID: item.OTID,
+		})
+	case "sticker":
+		rec, err = o.service.sendSticker(ctx, core.SendStickerRequest{
+			ThreadID: item.ThreadID, StickerID: payload.StickerID, ReplyTo: replyTo, OTID: item.OTID,
+		})
+	case "external":
+		rec, err = o.service.sendExternalMedia(ctx, core.SendExternalMediaRequest{
+			ThreadID: item.ThreadID, URL: payload.URL, ReplyTo: replyTo, OTID: item.OTID,
+		})
+	case "forward":
+		rec, err = o.service.forward(ctx, core.ForwardRequest{
+			ThreadID: item.ThreadID, MessageID: payload.ForwardID, OTID: item.OTID,
+		})
+	default:
+		rec, err = o.service.sendText(ctx, core.SendTextRequest{
+			ThreadID: item.ThreadID, Text: payload.Text, ReplyTo: replyTo, Mentions: payload.Mentions, OTID: item.OTID,
+		})
+	}
+	if errors.Is(err, ErrTransportUnavailable) {
+		return false, err
+	}
+
+	item.Attempts++
+	if err == nil {
+		messageID := ""
+		if rec != nil {
+			messageID = rec.MessageID
+		}
+		o.log.Info().Int64("outbox_id", item.ID).Int64("thread", item.ThreadID).Str("msg_id", messageID).Msg("Queued message delivered")
+		return true, o.finish(item, core.DeliverySent, messageID, "", payload.Files)
+	}
+	if item.Attempts >= outboxMaxAttempts {
+		o.log.Error().Err(err).Int64("outbox_id", item.ID).Int("attempts", item.Attempts).Msg("Giving up on queued message")
+		return true, o.finish(item, core.DeliveryFailed, "", err.Error(), payload.Files)
+	}
+
+	backoff := min(outboxBaseBackoff<<(item.Attempts-1), outboxMaxBackoff)
+	item.LastError = err.Error()
+	item.UpdatedAtUnixMs = time.Now().UnixMilli()
+	item.NextAttemptAtUnixMs = time.Now().Add(backoff).UnixMilli()
+	o.log.Warn().Err(err).Int64("outbox_id", item.ID).Int("attempts", item.Attempts).Dur("retry_in", backoff).Msg("Queued message delivery failed")
+	return false, o.store.UpdateOutbox(context.Background(), item)
+}
+
+func (o *Outbox) finish(item *OutboxItem, status core.DeliveryStatus, messageID, lastError string, files []outboxFile) error {
+	removeSpooled(files)
+	item.Status = status
+	item.MessageID = messageID
+	item.LastError = strings.TrimSpace(lastError)
+	item.UpdatedAtUnixMs = time.Now().UnixMilli()
+	item.NextAttemptAtUnixMs = 0
+	if err := o.store.UpdateOutbox(context.Background(), item); err != nil {
+		return err
+	}
+	o.service.outboxFinished(&item.OutboxEntry)
+	return nil
+}
+
+// outboxFinished passes the outcome of a queued message on to the scheduled
+// message or broadcast delivery it was sent for.
+func (s *Service) outboxFinished(entry *core.OutboxEntry) {
+	if s.scheduler != nil {
+		s.scheduler.resolveQueued(context.Background(), entry)
+	}
+	if s.broadcaster != nil {
+		s.broadcaster.resolveQueued(context.Background(), entry)
+	}
+}
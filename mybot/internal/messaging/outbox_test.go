@@ -0,0 +1,166 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+func TestOutboxQueuesWhileDisconnectedAndDeliversInOrder(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenSQLiteStore(filepath.Join(dir, "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+
+	transport := &fakeTransport{
+		selfID:       42,
+		nextTextResp: &core.MessageRecord{MessageID: "m1", ThreadID: 1001, SenderID: 42},
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	if err := service.EnableOutbox(store, filepath.Join(dir, "outbox")); err != nil {
+		t.Fatalf("EnableOutbox() error = %v", err)
+	}
+
+	first, err := service.SendText(ctx, core.SendTextRequest{ThreadID: 1001, Text: "one"})
+	if err != nil {
+		t.Fatalf("SendText(one) error = %v", err)
+	}
+	second, err := service.SendText(ctx, core.SendTextRequest{ThreadID: 1001, Text: "two"})
+	if err != nil {
+		t.Fatalf("SendText(two) error = %v", err)
+	}
+	if first.OutboxID == 0 || first.MessageID != "" {
+		t.Fatalf("SendText() while disconnected = %+v, want queued record", first)
+	}
+	status, err := service.GetDeliveryStatus(ctx, first.OutboxID)
+	if err != nil || status.Status != core.DeliveryPending {
+		t.Fatalf("GetDeliveryStatus() = %+v, %v, want pending", status, err)
+	}
+
+	service.NotifyReady()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err = service.GetDeliveryStatus(ctx, second.OutboxID)
+		if err != nil {
+			t.Fatalf("GetDeliveryStatus() error = %v", err)
+		}
+		if status.Status == core.DeliverySent {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message not delivered: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.MessageID != "m1" || status.Attempts != 1 {
+		t.Fatalf("delivered status = %+v", status)
+	}
+
+	// Close joins the delivery goroutine before inspecting the transport.
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(transport.textReqs) != 2 || transport.textReqs[0].Text != "one" || transport.textReqs[1].Text != "two" {
+		t.Fatalf("delivered %+v, want one then two", transport.textReqs)
+	}
+	for _, req := range transport.textReqs {
+		if req.OTID == 0 {
+			t.Fatalf("queued send without OTID: %+v", req)
+		}
+	}
+}
+
+func TestOutboxTakesFailedDirectSends(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenSQLiteStore(filepath.Join(dir, "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+
+	transport := &fakeTransport{selfID: 42, textErr: errors.New("socket closed")}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	if err := service.EnableOutbox(store, filepath.Join(dir, "outbox")); err != nil {
+		t.Fatalf("EnableOutbox() error = %v", err)
+	}
+	service.NotifyReady()
+
+	rec, err := service.SendText(ctx, core.SendTextRequest{ThreadID: 1001, Text: "one"})
+	if err != nil {
+		t.Fatalf("SendText() error = %v, want the failed send queued", err)
+	}
+	if rec.OutboxID == 0 {
+		t.Fatalf("SendText() = %+v, want queued record", rec)
+	}
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	// The queued copy is retried under the OTID of the direct attempt.
+	if len(transport.textReqs) == 0 || fmt.Sprint(transport.textReqs[0].OTID) != rec.OfflineThreadingID {
+		t.Fatalf("direct attempt %+v, queued OTID %s", transport.textReqs, rec.OfflineThreadingID)
+	}
+	for _, req := range transport.textReqs[1:] {
+		if req.OTID != transport.textReqs[0].OTID {
+			t.Fatalf("retry OTID = %d, want %d", req.OTID, transport.textReqs[0].OTID)
+		}
+	}
+}
+
+func TestOutboxDeliversQueuedStickersAndForwards(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenSQLiteStore(filepath.Join(dir, "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+
+	transport := &fakeTransport{selfID: 42}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	if err := service.EnableOutbox(store, filepath.Join(dir, "outbox")); err != nil {
+		t.Fatalf("EnableOutbox() error = %v", err)
+	}
+
+	sticker, err := service.SendSticker(ctx, core.SendStickerRequest{ThreadID: 1001, StickerID: 5})
+	if err != nil || sticker.OutboxID == 0 {
+		t.Fatalf("SendSticker() while disconnected = %+v, %v, want queued record", sticker, err)
+	}
+	fwd, err := service.Forward(ctx, core.ForwardRequest{ThreadID: 1001, MessageID: "orig"})
+	if err != nil || fwd.OutboxID == 0 {
+		t.Fatalf("Forward() while disconnected = %+v, %v, want queued record", fwd, err)
+	}
+
+	service.NotifyReady()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := service.GetDeliveryStatus(ctx, fwd.OutboxID)
+		if err != nil {
+			t.Fatalf("GetDeliveryStatus() error = %v", err)
+		}
+		if status.Status == core.DeliverySent {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("forward not delivered: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(transport.stickerReqs) != 1 || transport.stickerReqs[0].StickerID != 5 || transport.stickerReqs[0].OTID == 0 {
+		t.Fatalf("sticker requests = %+v", transport.stickerReqs)
+	}
+	if len(transport.forwardReqs) != 1 || transport.forwardReqs[0].MessageID != "orig" {
+		t.Fatalf("forward requests = %+v", transport.forwardReqs)
+	}
+}
@@ -0,0 +1,213 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mybot/internal/core"
+)
+
+const (
+	// pageFooterReserve is the room, in UTF-16 code units, kept for the
+	// navigation footer so a page never exceeds the message length limit.
+	pageFooterReserve = 150
+	// pageSessionTTL is how long a paginated response stays navigable after
+	// it was last used.
+	pageSessionTTL = 30 * time.Minute
+)
+
+// pageMessenger is the subset of Service the paginator needs.
+type pageMessenger interface {
+	SendText(ctx context.Context, req core.SendTextRequest) (*core.MessageRecord, error)
+	EditText(ctx context.Context, messageID, newText string) (*core.MessageRecord, error)
+}
+
+// pageSession is one navigable paginated response, keyed by the ID of the
+// message currently showing it.
+type pageSession struct {
+	mu       sync.Mutex
+	threadID int64
+	pages    []string
+	index    int
+	expires  time.Time
+}
+
+// Paginator implements core.Paginator. Page messages are edited in place on
+// navigation; once Messenger refuses further edits the next page is sent as
+// a new message, which then becomes the one to navigate from.
+type Paginator struct {
+	messages   pageMessenger
+	pageLength int
+
+	mu       sync.Mutex
+	sessions map[string]*pageSession
+}
+
+// NewPaginator creates a Paginator whose pages, footer included, fit in
+// maxTextLength UTF-16 code units (DefaultMaxTextLength if <= 0).
+func NewPaginator(messages pageMessenger, maxTextLength int) *Paginator {
+	if maxTextLength <= 0 {
+		maxTextLength = DefaultMaxTextLength
+	}
+	return &Paginator{
+		messages:   messages,
+		pageLength: max(maxTextLength-pageFooterReserve, pageFooterReserve),
+		sessions:   make(map[string]*pageSession),
+	}
+}
+
+// SendPagedText splits text into pages on line/word boundaries and sends it
+// with SendPages.
+func (p *Paginator) SendPagedText(ctx context.Context, threadID int64, replyToMessageID, text string) (*core.MessageRecord, error) {
+	return p.SendPages(ctx, threadID, replyToMessageID, SplitText(text, p.pageLength))
+}
+
+// SendPages sends the first page and registers the response for navigation.
+// A single page is sent as a plain message.
+func (p *Paginator) SendPages(ctx context.Context, threadID int64, replyToMessageID string, pages []string) (*core.MessageRecord, error) {
+	if len(pages) == 0 {
+		return nil, nil
+	}
+	req := core.SendTextRequest{ThreadID: threadID, Text: renderPage(pages, 0)}
+	if replyToMessageID != "" {
+		req.ReplyTo = &core.ReplyTarget{MessageID: replyToMessageID}
+	}
+	rec, err := p.messages.SendText(ctx, req)
+	if err != nil || len(pages) == 1 || rec == nil || rec.MessageID == "" {
+		return rec, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pruneLocked(time.Now())
+	p.sessions[rec.MessageID] = &pageSession{
+		threadID: threadID,
+		pages:    pages,
+		expires:  time.Now().Add(pageSessionTTL),
+	}
+	return rec, nil
+}
+
+// HandleReply navigates the paginated response replyToMessageID if text is a
+// navigation keyword ("next", "prev", "sau", "trước", a page number...). It
+// reports whether the message was consumed.
+func (p *Paginator) HandleReply(ctx context.Context, replyToMessageID, text string) bool {
+	session := p.session(replyToMessageID)
+	if session == nil {
+		return false
+	}
+	target, ok := parsePageCommand(text, session)
+	if !ok {
+		return false
+	}
+	p.navigate(ctx, replyToMessageID, session, target)
+	return true
+}
+
+// HandleReaction navigates the paginated response messageID when reaction
+// is ▶️/◀️ (or a similar arrow). It reports whether the reaction was used.
+func (p *Paginator) HandleReaction(ctx context.Context, messageID, reaction string) bool {
+	session := p.session(messageID)
+	if session == nil {
+		return false
+	}
+	var delta int
+	switch strings.TrimSuffix(reaction, "️") {
+	case "▶", "➡", "👉", "⏩":
+		delta = 1
+	case "◀", "⬅", "👈", "⏪":
+		delta = -1
+	default:
+		return false
+	}
+	session.mu.Lock()
+	target := session.index + delta
+	session.mu.Unlock()
+	p.navigate(ctx, messageID, session, target)
+	return true
+}
+
+func (p *Paginator) session(messageID string) *pageSession {
+	if messageID == "" {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	session := p.sessions[messageID]
+	if session == nil || time.Now().After(session.expires) {
+		delete(p.sessions, messageID)
+		return nil
+	}
+	return session
+}
+
+// navigate shows page target (clamped) of session, currently displayed by
+// messageID.
+func (p *Paginator) navigate(ctx context.Context, messageID string, session *pageSession, target int) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	target = max(0, min(target, len(session.pages)-1))
+	session.expires = time.Now().Add(pageSessionTTL)
+	if target == session.index {
+		return
+	}
+	text := renderPage(session.pages, target)
+	if _, err := p.messages.EditText(ctx, messageID, text); err == nil {
+		session.index = target
+		return
+	}
+
+	rec, err := p.messages.SendText(ctx, core.SendTextRequest{ThreadID: session.threadID, Text: text})
+	if err != nil || rec == nil || rec.MessageID == "" {
+		return
+	}
+	session.index = target
+	p.mu.Lock()
+	delete(p.sessions, messageID)
+	p.sessions[rec.MessageID] = session
+	p.mu.Unlock()
+}
+
+// pruneLocked drops expired sessions. Caller holds p.mu.
+func (p *Paginator) pruneLocked(now time.Time) {
+	for id, session := range p.sessions {
+		if now.After(session.expires) {
+			delete(p.sessions, id)
+		}
+	}
+}
+
+func renderPage(pages []string, index int) string {
+	if len(pages) == 1 {
+		return pages[0]
+	}
+	return fmt.Sprintf("%s\n\n📄 Trang %d/%d — reply \"sau\"/\"trước\" hoặc số trang, hoặc thả ▶️/◀️",
+		pages[index], index+1, len(pages))
+}
+
+// parsePageCommand maps a navigation reply to a target page index.
+func parsePageCommand(text string, session *pageSession) (int, bool) {
+	session.mu.Lock()
+	current := session.index
+	session.mu.Unlock()
+
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "next", "n", "sau", "tiếp", ">", "▶", "▶️":
+		return current + 1, true
+	case "prev", "p", "trước", "truoc", "<", "◀", "◀️":
+		return current - 1, true
+	case "first", "đầu":
+		return 0, true
+	case "last", "cuối":
+		return len(session.pages) - 1, true
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(text)); err == nil && n >= 1 && n <= len(session.pages) {
+		return n - 1, true
+	}
+	return 0, false
+}
@@ -0,0 +1,97 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mybot/internal/core"
+)
+
+type fakePageMessenger struct {
+	sent      []core.SendTextRequest
+	edits     map[string]string
+	failEdits bool
+}
+
+func (f *fakePageMessenger) SendText(_ context.Context, req core.SendTextRequest) (*core.MessageRecord, error) {
+	f.sent = append(f.sent, req)
+	return &core.MessageRecord{MessageID: fmt.Sprintf("page%d", len(f.sent)), Text: req.Text}, nil
+}
+
+func (f *fakePageMessenger) EditText(_ context.Context, messageID, text string) (*core.MessageRecord, error) {
+	if f.failEdits {
+		return nil, errors.New("edit limit reached")
+	}
+	if f.edits == nil {
+		f.edits = make(map[string]string)
+	}
+	f.edits[messageID] = text
+	return &core.MessageRecord{MessageID: messageID, Text: text}, nil
+}
+
+func TestPaginatorNavigatesByReplyAndReaction(t *testing.T) {
+	ctx := context.Background()
+	msgs := &fakePageMessenger{}
+	p := NewPaginator(msgs, 0)
+
+	rec, err := p.SendPages(ctx, 1, "cmd", []string{"one", "two", "three"})
+	if err != nil {
+		t.Fatalf("SendPages() error = %v", err)
+	}
+	if !strings.HasPrefix(msgs.sent[0].Text, "one") || !strings.Contains(msgs.sent[0].Text, "Trang 1/3") {
+		t.Fatalf("first page = %q", msgs.sent[0].Text)
+	}
+	if msgs.sent[0].ReplyTo == nil || msgs.sent[0].ReplyTo.MessageID != "cmd" {
+		t.Fatalf("first page should reply to the command")
+	}
+
+	if p.HandleReply(ctx, rec.MessageID, "hello") {
+		t.Fatal("HandleReply() consumed a non-navigation reply")
+	}
+	if !p.HandleReply(ctx, rec.MessageID, "sau") {
+		t.Fatal("HandleReply(sau) = false")
+	}
+	if got := msgs.edits[rec.MessageID]; !strings.HasPrefix(got, "two") {
+		t.Fatalf("after next, page = %q", got)
+	}
+	if !p.HandleReaction(ctx, rec.MessageID, "◀️") {
+		t.Fatal("HandleReaction(◀️) = false")
+	}
+	if got := msgs.edits[rec.MessageID]; !strings.HasPrefix(got, "one") {
+		t.Fatalf("after prev, page = %q", got)
+	}
+
+	// Once edits are refused the page is re-sent and navigation follows it.
+	msgs.failEdits = true
+	if !p.HandleReply(ctx, rec.MessageID, "3") {
+		t.Fatal("HandleReply(3) = false")
+	}
+	last := msgs.sent[len(msgs.sent)-1]
+	if !strings.HasPrefix(last.Text, "three") {
+		t.Fatalf("re-sent page = %q", last.Text)
+	}
+	if p.HandleReply(ctx, rec.MessageID, "1") {
+		t.Fatal("old page message should no longer navigate")
+	}
+	if !p.HandleReply(ctx, fmt.Sprintf("page%d", len(msgs.sent)), "1") {
+		t.Fatal("new page message should navigate")
+	}
+}
+
+func TestPaginatorSinglePageIsPlain(t *testing.T) {
+	msgs := &fakePageMessenger{}
+	p := NewPaginator(msgs, 0)
+	rec, err := p.SendPagedText(context.Background(), 1, "", "hello")
+	if err != nil {
+		t.Fatalf("SendPagedText() error = %v", err)
+	}
+	if msgs.sent[0].Text != "hello" {
+		t.Fatalf("text = %q, want plain", msgs.sent[0].Text)
+	}
+	if p.HandleReply(context.Background(), rec.MessageID, "sau") {
+		t.Fatal("single page should not be navigable")
+	}
+}
@@ -0,0 +1,369 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+const (
+	// pollConfirmWait is how long CreatePoll waits for Messenger to report
+	// the poll it created.
+	pollConfirmWait = 15 * time.Second
+	// pollPendingTTL is how long a created poll can still be matched with
+	// the poll Messenger reports, after CreatePoll gave up waiting.
+	pollPendingTTL = 5 * time.Minute
+	// pollIdleWait is how often deadlines are re-checked without a wake-up.
+	pollIdleWait = time.Minute
+	// pollSendTimeout bounds sending the summary of a closed poll.
+	pollSendTimeout = 3 * time.Minute
+)
+
+var (
+	// ErrPollNotFound is returned for a poll ID unknown in the thread.
+	ErrPollNotFound = errors.New("poll not found")
+	// ErrPollClosed is returned when closing a poll twice.
+	ErrPollClosed = errors.New("poll already closed")
+	// ErrPollNotConfirmed is returned when Messenger accepted a new poll but
+	// has not reported it within pollConfirmWait. The question and deadline
+	// are still attached if it is reported later.
+	ErrPollNotConfirmed = errors.New("poll created but not reported by Messenger yet")
+)
+
+// Polls matches polls created through the bot with the polls Messenger
+// reports, and closes polls whose deadline passed, posting their results.
+type Polls struct {
+	log     zerolog.Logger
+	service *Service
+
+	mu      sync.Mutex
+	pending []*pendingPoll
+
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// pendingPoll is a poll the bot asked Messenger to create. Messenger's
+// reply carries no poll ID, so the next new poll seen in the thread is
+// taken to be this one.
+type pendingPoll struct {
+	threadID   int64
+	creatorID  int64
+	question   string
+	closesAtMs int64
+	createdAt  time.Time
+	claimed    chan int64
+}
+
+// EnablePolls starts tracking polls created through the bot and closing
+// them at their deadline. Polls are stored in the service's store.
+func (s *Service) EnablePolls() {
+	pl := &Polls{
+		log:     s.log.With().Str("component", "polls").Logger(),
+		service: s,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.polls = pl
+	go pl.run()
+}
+
+// CreatePoll creates req in a group thread and waits for Messenger to
+// report it. Options are trimmed and empty ones dropped; at least two must
+// remain.
+func (s *Service) CreatePoll(ctx context.Context, req core.PollRequest) (*core.Poll, error) {
+	if s.polls == nil {
+		return nil, ErrPollsDisabled
+	}
+	question := strings.TrimSpace(req.Question)
+	var options []string
+	for _, option := range req.Options {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+	if req.ThreadID == 0 || question == "" || len(options) < 2 {
+		return nil, ErrInvalidRequest
+	}
+	var closesAtMs int64
+	if !req.ClosesAt.IsZero() {
+		if !req.ClosesAt.After(time.Now()) {
+			return nil, ErrInvalidRequest
+		}
+		closesAtMs = req.ClosesAt.UnixMilli()
+	}
+	if err := s.checkGroupThread(ctx, req.ThreadID); err != nil {
+		return nil, err
+	}
+	if err := s.rateLimiter.Wait(ctx, req.ThreadID); err != nil {
+		return nil, err
+	}
+	transport, err := s.transport()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := s.polls.expect(req.ThreadID, core.RequesterFromContext(ctx), question, closesAtMs)
+	if err := transport.CreatePoll(ctx, req.ThreadID, question, options); err != nil {
+		s.polls.forget(pending)
+		return nil, err
+	}
+	timer := time.NewTimer(pollConfirmWait)
+	defer timer.Stop()
+	select {
+	case pollID := <-pending.claimed:
+		return s.store.GetPoll(ctx, pollID)
+	case <-timer.C:
+		return nil, ErrPollNotConfirmed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// GetPoll returns poll id of threadID, or nil if there is none.
+func (s *Service) GetPoll(ctx context.Context, threadID, id int64) (*core.Poll, error) {
+	if s.polls == nil {
+		return nil, ErrPollsDisabled
+	}
+	poll, err := s.store.GetPoll(ctx, id)
+	if err != nil || poll == nil || poll.ThreadID != threadID {
+		return nil, err
+	}
+	return poll, nil
+}
+
+// ListPolls returns the latest limit polls of threadID, newest first.
+func (s *Service) ListPolls(ctx context.Context, threadID int64, limit int) ([]*core.Poll, error) {
+	if s.polls == nil {
+		return nil, ErrPollsDisabled
+	}
+	return s.store.ListPolls(ctx, threadID, limit)
+}
+
+// PollResults tallies the stored votes of poll id of threadID.
+func (s *Service) PollResults(ctx context.Context, threadID, id int64) (*core.PollResults, error) {
+	poll, err := s.GetPoll(ctx, threadID, id)
+	if err != nil {
+		return nil, err
+	}
+	if poll == nil {
+		return nil, ErrPollNotFound
+	}
+	return s.tallyPoll(ctx, poll)
+}
+
+// ClosePoll closes poll id of threadID and posts its results there. Votes
+// arriving afterwards are no longer stored.
+func (s *Service) ClosePoll(ctx context.Context, threadID, id int64) (*core.PollResults, error) {
+	if s.polls == nil {
+		return nil, ErrPollsDisabled
+	}
+	return s.polls.close(ctx, threadID, id)
+}
+
+func (s *Service) tallyPoll(ctx context.Context, poll *core.Poll) (*core.PollResults, error) {
+	options, err := s.store.ListPollOptions(ctx, poll.ID)
+	if err != nil {
+		return nil, err
+	}
+	votes, err := s.store.ListPollVotes(ctx, poll.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := &core.PollResults{Poll: poll, Options: make([]core.PollOptionResult, 0, len(options))}
+	index := make(map[int64]int, len(options))
+	for _, option := range options {
+		index[option.OptionID] = len(res.Options)
+		res.Options = append(res.Options, core.PollOptionResult{PollOption: *option})
+	}
+	voters := make(map[int64]struct{})
+	for _, vote := range votes {
+		i, ok := index[vote.OptionID]
+		if !ok {
+			continue // option not synced yet
+		}
+		res.Options[i].VoterIDs = append(res.Options[i].VoterIDs, vote.UserID)
+		voters[vote.UserID] = struct{}{}
+	}
+	res.Voters = len(voters)
+	return res, nil
+}
+
+// expect records a poll about to be created in threadID.
+func (pl *Polls) expect(threadID, creatorID int64, question string, closesAtMs int64) *pendingPoll {
+	p := &pendingPoll{
+		threadID:   threadID,
+		creatorID:  creatorID,
+		question:   question,
+		closesAtMs: closesAtMs,
+		createdAt:  time.Now(),
+		claimed:    make(chan int64, 1),
+	}
+	pl.mu.Lock()
+	pl.pending = append(pl.pending, p)
+	pl.mu.Unlock()
+	return p
+}
+
+// forget drops p after Messenger rejected it.
+func (pl *Polls) forget(p *pendingPoll) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	for i, other := range pl.pending {
+		if other == p {
+			pl.pending = append(pl.pending[:i], pl.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// claim attaches the oldest pending poll of threadID to the newly reported
+// pollID, storing its question, creator and deadline.
+func (pl *Polls) claim(ctx context.Context, pollID, threadID int64) {
+	now := time.Now()
+	var match *pendingPoll
+	pl.mu.Lock()
+	kept := pl.pending[:0]
+	for _, p := range pl.pending {
+		if now.Sub(p.createdAt) > pollPendingTTL {
+			continue
+		}
+		if match == nil && p.threadID == threadID {
+			match = p
+			continue
+		}
+		kept = append(kept, p)
+	}
+	clear(pl.pending[len(kept):])
+	pl.pending = kept
+	pl.mu.Unlock()
+	if match == nil {
+		return
+	}
+
+	poll, err := pl.service.store.GetPoll(ctx, pollID)
+	if err != nil || poll == nil {
+		pl.log.Warn().Err(err).Int64("poll_id", pollID).Msg("Failed to load new poll")
+		return
+	}
+	poll.CreatorID = match.creatorID
+	poll.Question = match.question
+	poll.ClosesAtUnixMs = match.closesAtMs
+	poll.UpdatedAtUnixMs = now.UnixMilli()
+	if err := pl.service.store.UpsertPoll(ctx, poll); err != nil {
+		pl.log.Warn().Err(err).Int64("poll_id", pollID).Msg("Failed to store poll details")
+		return
+	}
+	pl.log.Info().Int64("poll_id", pollID).Int64("thread", threadID).Int64("closes_at_ms", poll.ClosesAtUnixMs).Msg("Poll created")
+	match.claimed <- pollID
+	if poll.ClosesAtUnixMs > 0 {
+		pl.Wake()
+	}
+}
+
+// close marks poll id of threadID closed and posts its results.
+func (pl *Polls) close(ctx context.Context, threadID, id int64) (*core.PollResults, error) {
+	pl.mu.Lock()
+	poll, err := pl.service.store.GetPoll(ctx, id)
+	if err != nil {
+		pl.mu.Unlock()
+		return nil, err
+	}
+	if poll == nil || poll.ThreadID != threadID {
+		pl.mu.Unlock()
+		return nil, ErrPollNotFound
+	}
+	if poll.Status == core.PollClosed {
+		pl.mu.Unlock()
+		return nil, ErrPollClosed
+	}
+	poll.Status = core.PollClosed
+	poll.ClosedAtUnixMs = time.Now().UnixMilli()
+	poll.UpdatedAtUnixMs = poll.ClosedAtUnixMs
+	err = pl.service.store.UpsertPoll(ctx, poll)
+	pl.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := pl.service.tallyPoll(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+	text := core.FormatPollResults(res, pl.service.ThreadLocation(threadID))
+	if _, err := pl.service.SendText(ctx, core.SendTextRequest{ThreadID: threadID, Text: text}); err != nil {
+		return res, fmt.Errorf("send poll summary: %w", err)
+	}
+	pl.log.Info().Int64("poll_id", id).Int64("thread", threadID).Int("voters", res.Voters).Msg("Poll closed")
+	return res, nil
+}
+
+// Wake schedules a check for polls past their deadline.
+func (pl *Polls) Wake() {
+	select {
+	case pl.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops closing polls. Deadlines stay stored for next start.
+func (pl *Polls) Close() {
+	pl.stopOnce.Do(func() { close(pl.stop) })
+	<-pl.done
+}
+
+func (pl *Polls) run() {
+	defer close(pl.done)
+	for {
+		wait := pl.closeDue()
+		timer := time.NewTimer(wait)
+		select {
+		case <-pl.stop:
+			timer.Stop()
+			return
+		case <-pl.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// closeDue closes every poll past its deadline and returns how long to wait
+// before the next deadline.
+func (pl *Polls) closeDue() time.Duration {
+	ctx := context.Background()
+	items, err := pl.service.store.ListDuePolls(ctx, time.Now().UnixMilli())
+	if err != nil {
+		pl.log.Warn().Err(err).Msg("Failed to list due polls")
+		return pollIdleWait
+	}
+	for _, poll := range items {
+		select {
+		case <-pl.stop:
+			return pollIdleWait
+		default:
+		}
+		sendCtx, cancel := context.WithTimeout(core.WithRequester(ctx, poll.CreatorID), pollSendTimeout)
+		_, err := pl.close(sendCtx, poll.ThreadID, poll.ID)
+		cancel()
+		if err != nil && !errors.Is(err, ErrPollClosed) {
+			pl.log.Warn().Err(err).Int64("poll_id", poll.ID).Msg("Failed to close poll")
+		}
+	}
+
+	next, err := pl.service.store.NextPollCloseAt(ctx)
+	if err != nil || next == 0 {
+		return pollIdleWait
+	}
+	return min(max(time.Until(time.UnixMilli(next)), 100*time.Millisecond), pollIdleWait)
+}
@@ -0,0 +1,182 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/mautrix-meta/pkg/messagix/table"
+
+	"mybot/internal/core"
+)
+
+func TestProjectorTracksPollsAndVotes(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	projector := NewProjector(store, func() int64 { return 42 })
+	result, err := projector.ProjectTable(ctx, &table.LSTable{
+		LSAddPollForThread: []*table.LSAddPollForThread{{PollID: 500, ThreadKey: 1001, LastUpdateMessageID: "mid.poll", LastUpdateMessageTimestampMS: 1000}},
+		LSAddPollOption: []*table.LSAddPollOption{
+			{OptionID: 2, PollID: 500, OptionText: "Núi", SortKeyCreationTimestamp: 2},
+			{OptionID: 1, PollID: 500, OptionText: "Biển", SortKeyCreationTimestamp: 1},
+		},
+		LSAddPollVote: []*table.LSAddPollVote{
+			{OptionID: 1, PollID: 500, ContactID: 7, TimestampMS: 1100},
+			{OptionID: 2, PollID: 500, ContactID: 8, TimestampMS: 1200},
+		},
+	}, MetadataOnly)
+	if err != nil {
+		t.Fatalf("ProjectTable() error = %v", err)
+	}
+	if result.NewPolls[500] != 1001 {
+		t.Fatalf("NewPolls = %v, want poll 500 in 1001", result.NewPolls)
+	}
+	poll, _ := store.GetPoll(ctx, 500)
+	if poll == nil || poll.ThreadID != 1001 || poll.Status != core.PollOpen || poll.MessageID != "mid.poll" || poll.CreatedAtUnixMs != 1000 {
+		t.Fatalf("poll = %+v", poll)
+	}
+	options, _ := store.ListPollOptions(ctx, 500)
+	if len(options) != 2 || options[0].Text != "Biển" || options[1].Text != "Núi" {
+		t.Fatalf("options = %+v, want Biển then Núi", options)
+	}
+
+	// A vote on its own is added; a snapshot with the poll row replaces all.
+	if _, err := projector.ProjectTable(ctx, &table.LSTable{
+		LSAddPollVoteV2: []*table.LSAddPollVote{{OptionID: 1, PollID: 500, ContactID: 9, TimestampMS: 1300}},
+	}, FullEvents); err != nil {
+		t.Fatalf("ProjectTable(vote) error = %v", err)
+	}
+	if votes, _ := store.ListPollVotes(ctx, 500); len(votes) != 3 {
+		t.Fatalf("votes after single vote = %+v, want 3", votes)
+	}
+	result, err = projector.ProjectTable(ctx, &table.LSTable{
+		LSAddPollForThread: []*table.LSAddPollForThread{{PollID: 500, ThreadKey: 1001}},
+		LSAddPollVote:      []*table.LSAddPollVote{{OptionID: 2, PollID: 500, ContactID: 7, TimestampMS: 1400}},
+	}, FullEvents)
+	if err != nil {
+		t.Fatalf("ProjectTable(snapshot) error = %v", err)
+	}
+	if len(result.NewPolls) != 0 {
+		t.Fatalf("NewPolls for a known poll = %v", result.NewPolls)
+	}
+	votes, _ := store.ListPollVotes(ctx, 500)
+	if len(votes) != 1 || votes[0].UserID != 7 || votes[0].OptionID != 2 {
+		t.Fatalf("votes after snapshot = %+v, want only 7 → Núi", votes)
+	}
+
+	// Votes of a closed poll are frozen.
+	poll, _ = store.GetPoll(ctx, 500)
+	poll.Status = core.PollClosed
+	store.UpsertPoll(ctx, poll)
+	if _, err := projector.ProjectTable(ctx, &table.LSTable{
+		LSAddPollVote: []*table.LSAddPollVote{{OptionID: 1, PollID: 500, ContactID: 10}},
+	}, FullEvents); err != nil {
+		t.Fatalf("ProjectTable(late vote) error = %v", err)
+	}
+	if votes, _ := store.ListPollVotes(ctx, 500); len(votes) != 1 {
+		t.Fatalf("votes after close = %+v, want unchanged", votes)
+	}
+}
+
+func TestServiceCreatesPollAndClosesItAtDeadline(t *testing.T) {
+	ctx := core.WithRequester(context.Background(), 7)
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	transport := &fakeTransport{
+		selfID:       42,
+		nextTextResp: &core.MessageRecord{MessageID: "m1", ThreadID: 1001, SenderID: 42},
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	defer service.Close()
+
+	if _, err := service.CreatePoll(ctx, core.PollRequest{ThreadID: 1001, Question: "Đi đâu?", Options: []string{"Biển", "Núi"}}); !errors.Is(err, ErrPollsDisabled) {
+		t.Fatalf("CreatePoll() before EnablePolls error = %v, want ErrPollsDisabled", err)
+	}
+	service.EnablePolls()
+
+	store.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 2002, ThreadType: int64(table.ONE_TO_ONE)})
+	if _, err := service.CreatePoll(ctx, core.PollRequest{ThreadID: 2002, Question: "Q", Options: []string{"a", "b"}}); !errors.Is(err, ErrNotGroupThread) {
+		t.Fatalf("CreatePoll(1:1) error = %v, want ErrNotGroupThread", err)
+	}
+	if _, err := service.CreatePoll(ctx, core.PollRequest{ThreadID: 1001, Question: "Q", Options: []string{"a", " "}}); !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("CreatePoll(one option) error = %v, want ErrInvalidRequest", err)
+	}
+
+	// Messenger reports the poll while the task is being sent.
+	transport.onCreatePoll = func(threadID int64) {
+		if err := service.ObserveTable(context.Background(), &table.LSTable{
+			LSAddPollForThread: []*table.LSAddPollForThread{{PollID: 500, ThreadKey: threadID}},
+			LSAddPollOption: []*table.LSAddPollOption{
+				{OptionID: 1, PollID: 500, OptionText: "Biển", SortKeyCreationTimestamp: 1},
+				{OptionID: 2, PollID: 500, OptionText: "Núi", SortKeyCreationTimestamp: 2},
+			},
+		}, FullEvents); err != nil {
+			t.Errorf("ObserveTable() error = %v", err)
+		}
+	}
+	poll, err := service.CreatePoll(ctx, core.PollRequest{
+		ThreadID: 1001,
+		Question: " Đi đâu? ",
+		Options:  []string{"Biển", "Núi"},
+		ClosesAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("CreatePoll() error = %v", err)
+	}
+	if poll.ID != 500 || poll.Question != "Đi đâu?" || poll.CreatorID != 7 || poll.ClosesAtUnixMs == 0 {
+		t.Fatalf("CreatePoll() = %+v", poll)
+	}
+
+	if err := service.ObserveTable(context.Background(), &table.LSTable{
+		LSAddPollVote: []*table.LSAddPollVote{
+			{OptionID: 1, PollID: 500, ContactID: 7},
+			{OptionID: 1, PollID: 500, ContactID: 8},
+			{OptionID: 2, PollID: 500, ContactID: 8},
+		},
+	}, FullEvents); err != nil {
+		t.Fatalf("ObserveTable(votes) error = %v", err)
+	}
+	res, err := service.PollResults(ctx, 1001, 500)
+	if err != nil {
+		t.Fatalf("PollResults() error = %v", err)
+	}
+	if res.Voters != 2 || len(res.Options[0].VoterIDs) != 2 || len(res.Options[1].VoterIDs) != 1 {
+		t.Fatalf("PollResults() = %+v", res)
+	}
+	if _, err := service.PollResults(ctx, 3003, 500); !errors.Is(err, ErrPollNotFound) {
+		t.Fatalf("PollResults(other thread) error = %v, want ErrPollNotFound", err)
+	}
+
+	// Move the deadline into the past; the closer posts the summary.
+	poll.ClosesAtUnixMs = time.Now().Add(-time.Second).UnixMilli()
+	store.UpsertPoll(ctx, poll)
+	service.polls.Wake()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(transport.textReqs) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("poll not closed at its deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p, _ := store.GetPoll(ctx, 500); p.Status != core.PollClosed || p.ClosedAtUnixMs == 0 {
+		t.Fatalf("poll after deadline = %+v, want closed", p)
+	}
+	if len(transport.textReqs) != 1 || !strings.Contains(transport.textReqs[0].Text, "Kết quả bình chọn #500: Đi đâu?") ||
+		!strings.Contains(transport.textReqs[0].Text, "Biển — 2 phiếu (67%)") {
+		t.Fatalf("summary = %+v", transport.textReqs)
+	}
+	if _, err := service.ClosePoll(ctx, 1001, 500); !errors.Is(err, ErrPollClosed) {
+		t.Fatalf("ClosePoll() twice error = %v, want ErrPollClosed", err)
+	}
+}
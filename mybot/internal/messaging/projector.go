@@ -3,6 +3,7 @@ package messaging
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -27,6 +28,11 @@ type ProjectionResult struct {
 	MissingThreadIDs map[int64]struct{}
 	MissingUserIDs   map[int64]struct{}
 	EditedMessageIDs map[string]struct{}
+	// NewPolls maps polls seen for the first time to their thread.
+	NewPolls map[int64]int64
+	// Attachments lists the downloadable attachments of the projected
+	// messages, for the attachment archive.
+	Attachments []AttachmentSource
 }
 
 // ── LRU existence cache ─────────────────────────────────────────────────────
@@ -114,6 +120,9 @@ type Projector struct {
 	selfIDProvider func() int64
 	now            func() time.Time
 	cache          *existenceCache
+	// roles mirrors thread types and admins for moderation; nil while it
+	// is off.
+	roles *threadRoles
 }
 
 func NewProjector(store Store, selfIDProvider func() int64) *Projector {
@@ -131,6 +140,7 @@ func (p *Projector) ProjectTable(ctx context.Context, tbl *table.LSTable, mode P
 			MissingThreadIDs: make(map[int64]struct{}),
 			MissingUserIDs:   make(map[int64]struct{}),
 			EditedMessageIDs: make(map[string]struct{}),
+			NewPolls:         make(map[int64]int64),
 		}, nil
 	}
 
@@ -138,16 +148,17 @@ func (p *Projector) ProjectTable(ctx context.Context, tbl *table.LSTable, mode P
 		MissingThreadIDs: make(map[int64]struct{}),
 		MissingUserIDs:   make(map[int64]struct{}),
 		EditedMessageIDs: make(map[string]struct{}),
+		NewPolls:         make(map[int64]int64),
 	}
 
 	// ── Metadata: threads ───────────────────────────────────────────────
 	for _, row := range tbl.LSUpdateOrInsertThread {
-		if err := p.upsertThread(ctx, row.ThreadKey, row.ThreadName, row.LastActivityTimestampMs, false); err != nil {
+		if err := p.upsertThread(ctx, row.ThreadKey, row.ThreadName, row.ThreadType, row.LastActivityTimestampMs, false); err != nil {
 			return nil, err
 		}
 	}
 	for _, row := range tbl.LSDeleteThenInsertThread {
-		if err := p.upsertThread(ctx, row.ThreadKey, row.ThreadName, row.LastActivityTimestampMs, false); err != nil {
+		if err := p.upsertThread(ctx, row.ThreadKey, row.ThreadName, row.ThreadType, row.LastActivityTimestampMs, false); err != nil {
 			return nil, err
 		}
 	}
@@ -156,17 +167,17 @@ func (p *Projector) ProjectTable(ctx context.Context, tbl *table.LSTable, mode P
 		if name == "" {
 			name = row.ThreadName1
 		}
-		if err := p.upsertThread(ctx, row.ThreadKey, name, 0, false); err != nil {
+		if err := p.upsertThread(ctx, row.ThreadKey, name, 0, 0, false); err != nil {
 			return nil, err
 		}
 	}
 	for _, row := range tbl.LSVerifyThreadExists {
-		if err := p.upsertThread(ctx, row.ThreadKey, "", 0, false); err != nil {
+		if err := p.upsertThread(ctx, row.ThreadKey, "", row.ThreadType, 0, false); err != nil {
 			return nil, err
 		}
 	}
 	for _, row := range tbl.LSDeleteThread {
-		if err := p.upsertThread(ctx, row.ThreadKey, "", 0, true); err != nil {
+		if err := p.upsertThread(ctx, row.ThreadKey, "", 0, 0, true); err != nil {
 			return nil, err
 		}
 	}
@@ -188,6 +199,16 @@ func (p *Projector) ProjectTable(ctx context.Context, tbl *table.LSTable, mode P
 		}
 	}
 
+	// ── Metadata: group participants ────────────────────────────────────
+	if err := p.projectParticipants(ctx, tbl); err != nil {
+		return nil, err
+	}
+
+	// ── Metadata: polls ─────────────────────────────────────────────────
+	if err := p.projectPolls(ctx, tbl, result); err != nil {
+		return nil, err
+	}
+
 	if mode == MetadataOnly {
 		return result, nil
 	}
@@ -251,6 +272,7 @@ func (p *Projector) ProjectTable(ctx context.Context, tbl *table.LSTable, mode P
 			IsFromBot:          wrapped.SenderId != 0 && wrapped.SenderId == selfID,
 			HasMedia:           len(wrapped.Attachments) > 0 || len(wrapped.BlobAttachments) > 0 || len(wrapped.XMAAttachments) > 0 || len(wrapped.Stickers) > 0,
 			Attachments:        attachmentMetaFromWrapped(wrapped),
+			Mentions:           MentionsFromTable(wrapped.MentionIds, wrapped.MentionOffsets, wrapped.MentionLengths, wrapped.MentionTypes),
 			TimestampMs:        wrapped.TimestampMs,
 			EditCount:          wrapped.EditCount,
 			IsEdited:           wrapped.EditCount > 0,
@@ -271,6 +293,7 @@ func (p *Projector) ProjectTable(ctx context.Context, tbl *table.LSTable, mode P
 		if err := p.store.UpsertMessage(ctx, rec); err != nil {
 			return nil, err
 		}
+		result.Attachments = append(result.Attachments, attachmentSources(wrapped, rec)...)
 		if rec.IsFromBot {
 			if err := p.store.SetLastBotMessage(ctx, rec.ThreadID, rec.MessageID); err != nil {
 				return nil, err
@@ -284,16 +307,35 @@ func (p *Projector) ProjectTable(ctx context.Context, tbl *table.LSTable, mode P
 			return nil, err
 		}
 	}
+	for _, hist := range tbl.LSUpdateOrInsertEditMessageHistory {
+		if err := p.applyEditHistory(ctx, hist); err != nil {
+			return nil, err
+		}
+	}
 	for _, deletion := range tbl.LSDeleteMessage {
 		if err := p.applyDelete(ctx, deletion); err != nil {
 			return nil, err
 		}
 	}
 
+	// ── Pins ────────────────────────────────────────────────────────────
+	// A full resync clears the thread's pins and sets them again.
+	for _, row := range tbl.LSClearPinnedMessages {
+		if err := p.store.ClearPinnedMessages(ctx, row.ThreadKey); err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range tbl.LSSetPinnedMessage {
+		pin := &core.MessagePin{ThreadID: row.ThreadKey, MessageID: row.MessageId, PinnedAtUnixMs: row.PinnedTimestampMs}
+		if err := p.store.SetMessagePinned(ctx, pin); err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
-func (p *Projector) upsertThread(ctx context.Context, threadID int64, name string, lastActivityMs int64, deleted bool) error {
+func (p *Projector) upsertThread(ctx context.Context, threadID int64, name string, threadType table.ThreadType, lastActivityMs int64, deleted bool) error {
 	if threadID == 0 {
 		return nil
 	}
@@ -314,6 +356,11 @@ func (p *Projector) upsertThread(ctx context.Context, threadID int64, name strin
 	if rec.Name == "" {
 		rec.Name = unknownThreadName
 	}
+	if threadType != table.UNKNOWN_THREAD_TYPE {
+		rec.ThreadType = int64(threadType)
+		rec.IsGroup = !threadType.IsOneToOne()
+		p.roles.setThread(threadID, rec.IsGroup)
+	}
 	if lastActivityMs > 0 {
 		rec.LastActivityMs = lastActivityMs
 	}
@@ -328,6 +375,161 @@ func (p *Projector) upsertThread(ctx context.Context, threadID int64, name strin
 	return nil
 }
 
+// projectParticipants keeps thread_participants in sync. A full resync
+// (removeAllParticipantsForThread) is applied before the rows that re-add
+// the members.
+func (p *Projector) projectParticipants(ctx context.Context, tbl *table.LSTable) error {
+	nowMs := p.now().UnixMilli()
+	for _, row := range tbl.LSRemoveAllParticipantsForThread {
+		participants, err := p.store.ListParticipants(ctx, row.ThreadKey)
+		if err != nil {
+			return err
+		}
+		for _, member := range participants {
+			if err := p.store.DeleteParticipant(ctx, row.ThreadKey, member.UserID); err != nil {
+				return err
+			}
+		}
+		p.roles.resetThread(row.ThreadKey, nil)
+	}
+	for _, row := range tbl.LSAddParticipantIdToGroupThread {
+		if err := p.store.UpsertParticipant(ctx, &core.ThreadParticipant{
+			ThreadID:        row.ThreadKey,
+			UserID:          row.ContactId,
+			Nickname:        row.Nickname,
+			IsAdmin:         row.IsAdmin || row.IsSuperAdmin,
+			UpdatedAtUnixMs: nowMs,
+		}); err != nil {
+			return err
+		}
+		p.roles.setAdmin(row.ThreadKey, row.ContactId, row.IsAdmin || row.IsSuperAdmin)
+	}
+	for _, row := range tbl.LSUpdateThreadParticipantAdminStatus {
+		member, err := p.store.GetParticipant(ctx, row.ThreadKey, row.ContactId)
+		if err != nil {
+			return err
+		}
+		if member == nil {
+			member = &core.ThreadParticipant{ThreadID: row.ThreadKey, UserID: row.ContactId}
+		}
+		member.IsAdmin = row.IsAdmin
+		member.UpdatedAtUnixMs = nowMs
+		if err := p.store.UpsertParticipant(ctx, member); err != nil {
+			return err
+		}
+		p.roles.setAdmin(row.ThreadKey, row.ContactId, row.IsAdmin)
+	}
+	for _, row := range tbl.LSOverwriteAllThreadParticipantsAdminStatus {
+		if err := p.store.SetParticipantsAdmin(ctx, row.ThreadKey, row.IsAdmin); err != nil {
+			return err
+		}
+		if p.roles != nil {
+			members, err := p.store.ListParticipants(ctx, row.ThreadKey)
+			if err != nil {
+				return err
+			}
+			p.roles.resetThread(row.ThreadKey, members)
+		}
+	}
+	for _, row := range tbl.LSRemoveParticipantFromThread {
+		if err := p.store.DeleteParticipant(ctx, row.ThreadKey, row.ParticipantId); err != nil {
+			return err
+		}
+		p.roles.setAdmin(row.ThreadKey, row.ParticipantId, false)
+	}
+	return nil
+}
+
+// projectPolls keeps polls, poll_options and poll_votes in sync. Votes that
+// arrive together with an addPollForThread row are treated as the poll's full
+// vote list and replace the stored ones, which is how retracted votes go
+// away; votes arriving on their own are added. Votes for polls the bot has
+// closed are ignored.
+func (p *Projector) projectPolls(ctx context.Context, tbl *table.LSTable, result *ProjectionResult) error {
+	nowMs := p.now().UnixMilli()
+	snapshots := make(map[int64]bool)
+	for _, row := range tbl.LSAddPollForThread {
+		if row.PollID == 0 {
+			continue
+		}
+		poll, err := p.store.GetPoll(ctx, row.PollID)
+		if err != nil {
+			return err
+		}
+		if poll == nil {
+			poll = &core.Poll{
+				ID:              row.PollID,
+				ThreadID:        row.ThreadKey,
+				Status:          core.PollOpen,
+				CreatedAtUnixMs: row.LastUpdateMessageTimestampMS,
+			}
+			if poll.CreatedAtUnixMs == 0 {
+				poll.CreatedAtUnixMs = nowMs
+			}
+			result.NewPolls[row.PollID] = row.ThreadKey
+		}
+		if row.LastUpdateMessageID != "" {
+			poll.MessageID = row.LastUpdateMessageID
+		}
+		poll.UpdatedAtUnixMs = nowMs
+		if err := p.store.UpsertPoll(ctx, poll); err != nil {
+			return err
+		}
+		snapshots[row.PollID] = true
+	}
+	for _, rows := range [][]*table.LSAddPollOption{tbl.LSAddPollOption, tbl.LSAddPollOptionV2} {
+		for _, row := range rows {
+			if err := p.store.UpsertPollOption(ctx, &core.PollOption{
+				PollID:   row.PollID,
+				OptionID: row.OptionID,
+				Text:     row.OptionText,
+				Position: row.SortKeyCreationTimestamp,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	votes := make(map[int64][]*core.PollVote)
+	var pollOrder []int64
+	for _, rows := range [][]*table.LSAddPollVote{tbl.LSAddPollVote, tbl.LSAddPollVoteV2} {
+		for _, row := range rows {
+			if row.PollID == 0 {
+				continue
+			}
+			if _, ok := votes[row.PollID]; !ok {
+				pollOrder = append(pollOrder, row.PollID)
+			}
+			votes[row.PollID] = append(votes[row.PollID], &core.PollVote{
+				PollID:        row.PollID,
+				OptionID:      row.OptionID,
+				UserID:        row.ContactID,
+				VotedAtUnixMs: row.TimestampMS,
+			})
+		}
+	}
+	for _, pollID := range pollOrder {
+		poll, err := p.store.GetPoll(ctx, pollID)
+		if err != nil {
+			return err
+		}
+		if poll != nil && poll.Status == core.PollClosed {
+			continue // results are frozen when the bot closes a poll
+		}
+		if snapshots[pollID] {
+			if err := p.store.ReplacePollVotes(ctx, pollID, votes[pollID]); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, vote := range votes[pollID] {
+			if err := p.store.UpsertPollVote(ctx, vote); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (p *Projector) upsertUser(ctx context.Context, userID int64, name string, deleted bool) error {
 	if userID == 0 {
 		return nil
@@ -371,10 +573,14 @@ func (p *Projector) applyEdit(ctx context.Context, edit *table.LSEditMessage, re
 	if rec == nil {
 		return nil
 	}
+	nowMs := p.now().UnixMilli()
+	if err := recordEditVersions(ctx, p.store, rec, edit.Text, nowMs); err != nil {
+		return err
+	}
 	rec.Text = edit.Text
 	rec.EditCount = edit.EditCount
 	rec.IsEdited = true
-	rec.UpdatedAtUnixMs = p.now().UnixMilli()
+	rec.UpdatedAtUnixMs = nowMs
 	if err := p.store.UpsertMessage(ctx, rec); err != nil {
 		return err
 	}
@@ -382,6 +588,73 @@ func (p *Projector) applyEdit(ctx context.Context, edit *table.LSEditMessage, re
 	return nil
 }
 
+// applyEditHistory stores a server-side edit history row. These carry the
+// authoritative edit timestamp, so they are kept alongside the versions
+// recorded locally by applyEdit; duplicates are dropped on read.
+func (p *Projector) applyEditHistory(ctx context.Context, hist *table.LSUpdateOrInsertEditMessageHistory) error {
+	if hist == nil || hist.OriginalMessageID == "" || hist.ServerAdjustedEditTimestampMS == 0 {
+		return nil
+	}
+	return p.store.UpsertMessageEdit(ctx, &core.MessageEdit{
+		MessageID:        hist.OriginalMessageID,
+		ThreadID:         hist.ThreadKey,
+		Text:             hist.MessageContent,
+		TimestampMs:      hist.ServerAdjustedEditTimestampMS,
+		RecordedAtUnixMs: p.now().UnixMilli(),
+	})
+}
+
+// recordEditVersions saves the version being replaced and the new text into
+// the edit history. The previous version is re-saved under its own start
+// time so messages edited before history tracking existed still get their
+// original text recorded.
+func recordEditVersions(ctx context.Context, store Store, prev *core.MessageRecord, newText string, nowMs int64) error {
+	if prev == nil || prev.MessageID == "" || prev.Text == newText {
+		return nil
+	}
+	prevTs := prev.TimestampMs
+	if prev.IsEdited || prevTs == 0 {
+		prevTs = prev.UpdatedAtUnixMs
+	}
+	if err := store.UpsertMessageEdit(ctx, &core.MessageEdit{
+		MessageID:        prev.MessageID,
+		ThreadID:         prev.ThreadID,
+		Text:             prev.Text,
+		TimestampMs:      prevTs,
+		RecordedAtUnixMs: nowMs,
+	}); err != nil {
+		return err
+	}
+	return store.UpsertMessageEdit(ctx, &core.MessageEdit{
+		MessageID:        prev.MessageID,
+		ThreadID:         prev.ThreadID,
+		Text:             newText,
+		TimestampMs:      nowMs,
+		RecordedAtUnixMs: nowMs,
+	})
+}
+
+// priorVersions keeps the first version of each text and drops the trailing
+// entries that match the message's current text. Local versions are stamped
+// with the bot's clock and server history rows with the server's, so the
+// same edit seen both ways can sort anywhere in the list, not just next to
+// its twin.
+func priorVersions(edits []*core.MessageEdit, currentText string) []*core.MessageEdit {
+	out := make([]*core.MessageEdit, 0, len(edits))
+	seen := make(map[string]bool, len(edits))
+	for _, e := range edits {
+		if e == nil || seen[e.Text] {
+			continue
+		}
+		seen[e.Text] = true
+		out = append(out, e)
+	}
+	for len(out) > 0 && out[len(out)-1].Text == currentText {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
 func (p *Projector) applyDelete(ctx context.Context, deletion *table.LSDeleteMessage) error {
 	if deletion == nil || deletion.MessageId == "" {
 		return nil
@@ -410,7 +683,7 @@ func (p *Projector) ensureThreadAndUser(ctx context.Context, threadID, userID in
 			return err
 		}
 		if threadRec == nil {
-			if err := p.upsertThread(ctx, threadID, "", 0, false); err != nil {
+			if err := p.upsertThread(ctx, threadID, "", 0, 0, false); err != nil {
 				return err
 			}
 			result.MissingThreadIDs[threadID] = struct{}{}
@@ -475,6 +748,48 @@ func attachmentMetaFromWrapped(wrapped *table.WrappedMessage) []core.AttachmentM
 	return items
 }
 
+// attachmentSources returns the files and media of wrapped that can be
+// downloaded, in the order of attachmentMetaFromWrapped. Link previews and
+// stickers are left out.
+func attachmentSources(wrapped *table.WrappedMessage, rec *core.MessageRecord) []AttachmentSource {
+	var items []AttachmentSource
+	add := func(i int, fbid, url, mimeType, filename string, size int64) {
+		if url == "" {
+			return
+		}
+		items = append(items, AttachmentSource{
+			MessageID:    rec.MessageID,
+			AttachmentID: attachmentKey(fbid, i),
+			ThreadID:     rec.ThreadID,
+			IsFromBot:    rec.IsFromBot,
+			URL:          url,
+			MimeType:     mimeType,
+			Filename:     filename,
+			SizeBytes:    size,
+		})
+	}
+	for i, att := range wrapped.Attachments {
+		add(i, att.AttachmentFbid, firstNonEmpty(att.PlayableUrl, att.ImageUrl, att.PreviewUrl),
+			firstNonEmpty(att.AttachmentMimeType, att.PlayableUrlMimeType, att.ImageUrlMimeType, att.PreviewUrlMimeType),
+			att.Filename, att.Filesize)
+	}
+	for i, att := range wrapped.BlobAttachments {
+		add(len(wrapped.Attachments)+i, att.AttachmentFbid, firstNonEmpty(att.PlayableUrl, att.PreviewUrl),
+			firstNonEmpty(att.AttachmentMimeType, att.PlayableUrlMimeType, att.PreviewUrlMimeType),
+			att.Filename, att.Filesize)
+	}
+	return items
+}
+
+// attachmentKey identifies an attachment within its message: its Facebook
+// ID, or its position when it has none.
+func attachmentKey(fbid string, index int) string {
+	if fbid != "" {
+		return fbid
+	}
+	return "#" + strconv.Itoa(index)
+}
+
 func nameOrDefault(rec *core.UserRecord, fallback string) string {
 	if rec != nil && rec.Name != "" {
 		return rec.Name
@@ -4,7 +4,9 @@ import (
 	"context"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/rs/zerolog"
 	"go.mau.fi/mautrix-meta/pkg/messagix/table"
 )
 
@@ -128,3 +130,143 @@ func TestProjectorProjectsThreadsUsersMessagesAndMutations(t *testing.T) {
 		t.Fatalf("expected last bot message to be cleared, got %+v", lastBot)
 	}
 }
+
+func TestProjectorReportsAttachmentSources(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	projector := NewProjector(store, func() int64 { return 42 })
+	tbl := &table.LSTable{
+		LSInsertMessage: []*table.LSInsertMessage{{
+			ThreadKey:   1001,
+			MessageId:   "m1",
+			SenderId:    42,
+			Text:        "hello",
+			TimestampMs: 999,
+		}},
+		LSInsertAttachment: []*table.LSInsertAttachment{{
+			MessageId:          "m1",
+			AttachmentFbid:     "att1",
+			Filename:           "photo.jpg",
+			AttachmentMimeType: "image/jpeg",
+			Filesize:           12,
+			PreviewUrl:         "https://cdn.example/photo.jpg",
+		}},
+	}
+	result, err := projector.ProjectTable(ctx, tbl, FullEvents)
+	if err != nil {
+		t.Fatalf("ProjectTable() error = %v", err)
+	}
+	if len(result.Attachments) != 1 || result.Attachments[0].AttachmentID != "att1" ||
+		result.Attachments[0].URL != "https://cdn.example/photo.jpg" || !result.Attachments[0].IsFromBot {
+		t.Fatalf("result attachments = %+v", result.Attachments)
+	}
+}
+
+func TestProjectorParsesMentions(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	projector := NewProjector(store, func() int64 { return 42 })
+	tbl := &table.LSTable{
+		LSInsertMessage: []*table.LSInsertMessage{{
+			ThreadKey:      1001,
+			MessageId:      "m1",
+			SenderId:       7,
+			Text:           "hello @Bob",
+			TimestampMs:    999,
+			MentionIds:     "77",
+			MentionOffsets: "6",
+			MentionLengths: "4",
+			MentionTypes:   "p",
+		}},
+	}
+	if _, err := projector.ProjectTable(ctx, tbl, FullEvents); err != nil {
+		t.Fatalf("ProjectTable() error = %v", err)
+	}
+
+	msgRec, err := store.GetMessage(ctx, "m1")
+	if err != nil {
+		t.Fatalf("GetMessage() error = %v", err)
+	}
+	if msgRec == nil || len(msgRec.Mentions) != 1 || msgRec.Mentions[0].UserID != 77 ||
+		msgRec.Mentions[0].Offset != 6 || msgRec.Mentions[0].Length != 4 {
+		t.Fatalf("message record = %+v", msgRec)
+	}
+}
+
+func TestProjectorRecordsEditHistory(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	nowMs := int64(5000)
+	projector := NewProjector(store, func() int64 { return 42 })
+	projector.now = func() time.Time { return time.UnixMilli(nowMs) }
+
+	insertTbl := &table.LSTable{
+		LSInsertMessage: []*table.LSInsertMessage{{
+			ThreadKey:   1001,
+			MessageId:   "m1",
+			SenderId:    7,
+			Text:        "v0",
+			TimestampMs: 1000,
+		}},
+	}
+	if _, err := projector.ProjectTable(ctx, insertTbl, FullEvents); err != nil {
+		t.Fatalf("ProjectTable(insert) error = %v", err)
+	}
+
+	for i, text := range []string{"v1", "v2"} {
+		nowMs = int64(6000 + i*1000)
+		editTbl := &table.LSTable{
+			LSEditMessage: []*table.LSEditMessage{{MessageID: "m1", Text: text, EditCount: int64(i + 1)}},
+		}
+		if _, err := projector.ProjectTable(ctx, editTbl, FullEvents); err != nil {
+			t.Fatalf("ProjectTable(edit %d) error = %v", i+1, err)
+		}
+	}
+
+	// Server history for the first edit duplicates a locally recorded
+	// version; the second row's server clock runs ahead of the bot's, so it
+	// sorts after the later local edit.
+	histTbl := &table.LSTable{
+		LSUpdateOrInsertEditMessageHistory: []*table.LSUpdateOrInsertEditMessageHistory{{
+			OriginalMessageID:             "m1",
+			ThreadKey:                     1001,
+			ServerAdjustedEditTimestampMS: 5990,
+			MessageContent:                "v1",
+		}, {
+			OriginalMessageID:             "m1",
+			ThreadKey:                     1001,
+			ServerAdjustedEditTimestampMS: 7500,
+			MessageContent:                "v1",
+		}},
+	}
+	if _, err := projector.ProjectTable(ctx, histTbl, FullEvents); err != nil {
+		t.Fatalf("ProjectTable(history) error = %v", err)
+	}
+
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return nil }, nil)
+	history, err := service.GetEditHistory(ctx, "m1")
+	if err != nil {
+		t.Fatalf("GetEditHistory() error = %v", err)
+	}
+	if len(history) != 2 || history[0].Text != "v0" || history[1].Text != "v1" {
+		t.Fatalf("GetEditHistory() = %+v, want [v0 v1]", history)
+	}
+	if history[0].TimestampMs != 1000 {
+		t.Fatalf("original version timestamp = %d, want 1000", history[0].TimestampMs)
+	}
+}
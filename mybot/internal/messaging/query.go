@@ -0,0 +1,141 @@
+package messaging
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"mybot/internal/core"
+)
+
+const (
+	defaultMessageQueryLimit = 50
+	defaultUserQueryLimit    = 20
+	maxQueryLimit            = 500
+)
+
+// QueryMessages returns the stored messages q selects. It returns
+// ErrMessageNotFound when q.After names a message that isn't stored.
+func (s *Service) QueryMessages(ctx context.Context, q core.MessageQuery) ([]*core.MessageRecord, error) {
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Until.After(q.Since) {
+		return nil, ErrInvalidRequest
+	}
+	return s.store.QueryMessages(ctx, q)
+}
+
+// QueryThreads returns the threads q selects, most recently active first.
+func (s *Service) QueryThreads(ctx context.Context, q core.ThreadQuery) ([]*core.ThreadRecord, error) {
+	return s.store.QueryThreads(ctx, q)
+}
+
+// QueryUsers returns the users q selects, by name.
+func (s *Service) QueryUsers(ctx context.Context, q core.UserQuery) ([]*core.UserRecord, error) {
+	return s.store.QueryUsers(ctx, q)
+}
+
+// queryLimit clamps a query's Limit: 0 or less is def, more than
+// maxQueryLimit is maxQueryLimit.
+func queryLimit(limit, def int) int {
+	if limit <= 0 {
+		return def
+	}
+	return min(limit, maxQueryLimit)
+}
+
+// userNameKey is the form names are matched by in QueryUsers.
+func userNameKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// messageMatches reports whether rec passes the filters of q. The cursor
+// (q.After) is left to the caller.
+func messageMatches(rec *core.MessageRecord, q core.MessageQuery) bool {
+	switch {
+	case q.ThreadID != 0 && rec.ThreadID != q.ThreadID,
+		q.SenderID != 0 && rec.SenderID != q.SenderID,
+		q.ReplyToMessageID != "" && rec.ReplyToMessageID != q.ReplyToMessageID,
+		!q.Since.IsZero() && rec.TimestampMs < q.Since.UnixMilli(),
+		!q.Until.IsZero() && rec.TimestampMs >= q.Until.UnixMilli(),
+		q.HasMedia && !rec.HasMedia,
+		q.ExcludeBot && rec.IsFromBot,
+		q.ExcludeRecalled && rec.IsRecalled:
+		return false
+	}
+	return true
+}
+
+// selectMessages applies q to msgs, in any order, for the stores that scan:
+// it filters, sorts, skips up to the cursor message after (nil for the
+// first page) and cuts the result to q's limit.
+func selectMessages(msgs []*core.MessageRecord, q core.MessageQuery, after *core.MessageRecord) []*core.MessageRecord {
+	var results []*core.MessageRecord
+	for _, m := range msgs {
+		if !messageMatches(m, q) {
+			continue
+		}
+		if after != nil {
+			c := compareMessages(m, after)
+			if q.Oldest && c <= 0 || !q.Oldest && c >= 0 {
+				continue
+			}
+		}
+		results = append(results, m)
+	}
+	slices.SortFunc(results, func(a, b *core.MessageRecord) int {
+		if q.Oldest {
+			return compareMessages(a, b)
+		}
+		return compareMessages(b, a)
+	})
+	if limit := queryLimit(q.Limit, defaultMessageQueryLimit); len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// selectThreads applies q to threads, whose LastActivityMs must already
+// account for their newest message.
+func selectThreads(threads []*core.ThreadRecord, q core.ThreadQuery) []*core.ThreadRecord {
+	var results []*core.ThreadRecord
+	for _, t := range threads {
+		if t.Deleted && !q.IncludeDeleted ||
+			q.GroupsOnly && !t.IsGroup ||
+			!q.ActiveSince.IsZero() && t.LastActivityMs < q.ActiveSince.UnixMilli() {
+			continue
+		}
+		results = append(results, t)
+	}
+	slices.SortFunc(results, func(a, b *core.ThreadRecord) int {
+		if c := cmp.Compare(b.LastActivityMs, a.LastActivityMs); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ThreadID, b.ThreadID)
+	})
+	if q.Limit > 0 && len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	return results
+}
+
+// selectUsers applies q to users.
+func selectUsers(users []*core.UserRecord, q core.UserQuery) []*core.UserRecord {
+	prefix := userNameKey(q.NamePrefix)
+	var results []*core.UserRecord
+	for _, u := range users {
+		if u.Deleted && !q.IncludeDeleted || !strings.HasPrefix(userNameKey(u.Name), prefix) {
+			continue
+		}
+		results = append(results, u)
+	}
+	slices.SortFunc(results, func(a, b *core.UserRecord) int {
+		if c := strings.Compare(userNameKey(a.Name), userNameKey(b.Name)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.UserID, b.UserID)
+	})
+	if limit := queryLimit(q.Limit, defaultUserQueryLimit); len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,231 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"mybot/internal/core"
+)
+
+func TestStoreQueries(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"sqlite": func(t *testing.T) Store {
+			s, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+			if err != nil {
+				t.Fatalf("OpenSQLiteStore() error = %v", err)
+			}
+			return s
+		},
+		"bolt": func(t *testing.T) Store {
+			s, err := OpenBoltStore(filepath.Join(t.TempDir(), "messages.bolt"))
+			if err != nil {
+				t.Fatalf("OpenBoltStore() error = %v", err)
+			}
+			return s
+		},
+		"memory": func(*testing.T) Store { return NewMemoryStore() },
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			defer store.Close()
+			testStoreQueries(t, store)
+		})
+	}
+}
+
+func testStoreQueries(t *testing.T, store Store) {
+	ctx := context.Background()
+	store.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 1, Name: "General", ThreadType: 2, IsGroup: true})
+	store.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 2, Name: "Bình", ThreadType: 1, LastActivityMs: 8000})
+	store.UpsertThread(ctx, &core.ThreadRecord{ThreadID: 3, Name: "Left", ThreadType: 2, IsGroup: true, Deleted: true})
+	store.UpsertUser(ctx, &core.UserRecord{UserID: 7, Name: "Đức Anh"})
+	store.UpsertUser(ctx, &core.UserRecord{UserID: 8, Name: "đức minh"})
+	store.UpsertUser(ctx, &core.UserRecord{UserID: 9, Name: "Lan"})
+	store.UpsertUser(ctx, &core.UserRecord{UserID: 10, Name: "Dũng", Deleted: true})
+	for _, m := range []*core.MessageRecord{
+		{MessageID: "m1", ThreadID: 1, SenderID: 7, Text: "ăn gì?", TimestampMs: 1000},
+		{MessageID: "m2", ThreadID: 1, SenderID: 8, Text: "phở", ReplyToMessageID: "m1", TimestampMs: 2000},
+		{MessageID: "m3", ThreadID: 2, SenderID: 7, ReplyToMessageID: "m1", HasMedia: true, TimestampMs: 3000},
+		{MessageID: "m6", ThreadID: 2, SenderID: 7, Text: "ảnh", TimestampMs: 3000},
+		{MessageID: "m4", ThreadID: 1, SenderID: 7, IsRecalled: true, TimestampMs: 4000},
+		{MessageID: "m5", ThreadID: 1, IsFromBot: true, Text: "bún", TimestampMs: 6000},
+	} {
+		if err := store.UpsertMessage(ctx, m); err != nil {
+			t.Fatalf("UpsertMessage(%s) error = %v", m.MessageID, err)
+		}
+	}
+	// A message moved to another sender leaves its old index entry.
+	store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m2", ThreadID: 1, SenderID: 9, Text: "phở", ReplyToMessageID: "m1", TimestampMs: 2000})
+	store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m2", ThreadID: 1, SenderID: 8, Text: "phở", ReplyToMessageID: "m1", TimestampMs: 2000})
+
+	at := func(ms int64) time.Time { return time.UnixMilli(ms) }
+	messages := []struct {
+		name string
+		q    core.MessageQuery
+		want []string
+	}{
+		{"by sender", core.MessageQuery{SenderID: 7}, []string{"m4", "m6", "m3", "m1"}},
+		{"by sender without recalled", core.MessageQuery{SenderID: 7, ExcludeRecalled: true}, []string{"m6", "m3", "m1"}},
+		{"replies oldest first", core.MessageQuery{ReplyToMessageID: "m1", Oldest: true}, []string{"m2", "m3"}},
+		{"thread time range", core.MessageQuery{ThreadID: 1, Since: at(2000), Until: at(6000)}, []string{"m4", "m2"}},
+		{"thread without bot", core.MessageQuery{ThreadID: 1, ExcludeBot: true, Oldest: true}, []string{"m1", "m2", "m4"}},
+		{"sender in thread", core.MessageQuery{ThreadID: 2, SenderID: 7, HasMedia: true}, []string{"m3"}},
+		{"media anywhere", core.MessageQuery{HasMedia: true}, []string{"m3"}},
+		{"time range anywhere", core.MessageQuery{Since: at(3000), Until: at(4000), Oldest: true}, []string{"m3", "m6"}},
+		{"no match", core.MessageQuery{SenderID: 8, ThreadID: 2}, nil},
+	}
+	for _, tc := range messages {
+		got, err := store.QueryMessages(ctx, tc.q)
+		if err != nil {
+			t.Fatalf("QueryMessages(%s) error = %v", tc.name, err)
+		}
+		if ids := messageIDs(got); !slices.Equal(ids, tc.want) {
+			t.Errorf("QueryMessages(%s) = %v, want %v", tc.name, ids, tc.want)
+		}
+	}
+
+	// Paging both ways, across messages with the same timestamp.
+	for _, tc := range []struct {
+		q    core.MessageQuery
+		want []string
+	}{
+		{core.MessageQuery{SenderID: 7, Limit: 2}, []string{"m4", "m6", "m3", "m1"}},
+		{core.MessageQuery{SenderID: 7, Limit: 2, Oldest: true}, []string{"m1", "m3", "m6", "m4"}},
+		{core.MessageQuery{Until: at(6000), Limit: 3}, []string{"m4", "m6", "m3", "m2", "m1"}},
+	} {
+		var ids []string
+		q := tc.q
+		for {
+			page, err := store.QueryMessages(ctx, q)
+			if err != nil {
+				t.Fatalf("QueryMessages(%+v) error = %v", q, err)
+			}
+			ids = append(ids, messageIDs(page)...)
+			if len(page) < q.Limit {
+				break
+			}
+			q.After = page[len(page)-1].MessageID
+		}
+		if !slices.Equal(ids, tc.want) {
+			t.Errorf("QueryMessages(%+v) pages = %v, want %v", tc.q, ids, tc.want)
+		}
+	}
+	if _, err := store.QueryMessages(ctx, core.MessageQuery{After: "nope"}); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("QueryMessages(unknown After) error = %v, want ErrMessageNotFound", err)
+	}
+
+	threads := []struct {
+		name string
+		q    core.ThreadQuery
+		want []int64
+	}{
+		{"all", core.ThreadQuery{}, []int64{2, 1}},
+		{"groups", core.ThreadQuery{GroupsOnly: true}, []int64{1}},
+		{"with deleted", core.ThreadQuery{IncludeDeleted: true}, []int64{2, 1, 3}},
+		{"active", core.ThreadQuery{ActiveSince: at(6000)}, []int64{2, 1}},
+		{"recently active", core.ThreadQuery{ActiveSince: at(7000)}, []int64{2}},
+		{"limit", core.ThreadQuery{Limit: 1}, []int64{2}},
+	}
+	for _, tc := range threads {
+		got, err := store.QueryThreads(ctx, tc.q)
+		if err != nil {
+			t.Fatalf("QueryThreads(%s) error = %v", tc.name, err)
+		}
+		var ids []int64
+		for _, th := range got {
+			ids = append(ids, th.ThreadID)
+		}
+		if !slices.Equal(ids, tc.want) {
+			t.Errorf("QueryThreads(%s) = %v, want %v", tc.name, ids, tc.want)
+		}
+	}
+	if got, _ := store.QueryThreads(ctx, core.ThreadQuery{GroupsOnly: true}); len(got) != 1 || got[0].LastActivityMs != 6000 {
+		t.Errorf("QueryThreads() = %+v, want activity from the newest message", got)
+	}
+
+	users := []struct {
+		name string
+		q    core.UserQuery
+		want []int64
+	}{
+		{"everyone", core.UserQuery{}, []int64{9, 7, 8}},
+		{"prefix", core.UserQuery{NamePrefix: "đức"}, []int64{7, 8}},
+		{"prefix ignoring case", core.UserQuery{NamePrefix: "ĐỨC M"}, []int64{8}},
+		{"deleted", core.UserQuery{NamePrefix: "d", IncludeDeleted: true}, []int64{10}},
+		{"no match", core.UserQuery{NamePrefix: "duc"}, nil},
+		{"limit", core.UserQuery{Limit: 1}, []int64{9}},
+	}
+	for _, tc := range users {
+		got, err := store.QueryUsers(ctx, tc.q)
+		if err != nil {
+			t.Fatalf("QueryUsers(%s) error = %v", tc.name, err)
+		}
+		var ids []int64
+		for _, u := range got {
+			ids = append(ids, u.UserID)
+		}
+		if !slices.Equal(ids, tc.want) {
+			t.Errorf("QueryUsers(%s) = %v, want %v", tc.name, ids, tc.want)
+		}
+	}
+}
+
+func TestSQLiteStoreUserNameKey(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+	store.UpsertUser(ctx, &core.UserRecord{UserID: 7, Name: "Đức"})
+	// An update without a name keeps the name, and the key it is found by.
+	store.UpsertUser(ctx, &core.UserRecord{UserID: 7, UpdatedAtUnixMs: 100})
+	if got, err := store.QueryUsers(ctx, core.UserQuery{NamePrefix: "đ"}); err != nil || len(got) != 1 || got[0].Name != "Đức" {
+		t.Fatalf("QueryUsers() after a nameless update = %+v, %v", got, err)
+	}
+	store.UpsertUser(ctx, &core.UserRecord{UserID: 7, Name: "Minh"})
+	if got, err := store.QueryUsers(ctx, core.UserQuery{NamePrefix: "đ"}); err != nil || len(got) != 0 {
+		t.Fatalf("QueryUsers() after a rename = %+v, %v", got, err)
+	}
+}
+
+func TestBoltStoreBuildsQueryIndexes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "messages.bolt")
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+	store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m1", ThreadID: 1, SenderID: 7, TimestampMs: 1000})
+	store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m2", ThreadID: 1, SenderID: 8, ReplyToMessageID: "m1", TimestampMs: 2000})
+	// Drop the indexes, as in a store written before they existed.
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(senderMessagesBuck); err != nil {
+			return err
+		}
+		return tx.DeleteBucket(replyMessagesBuck)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore(reopen) error = %v", err)
+	}
+	defer store.Close()
+	if got, err := store.QueryMessages(ctx, core.MessageQuery{SenderID: 7}); err != nil || !slices.Equal(messageIDs(got), []string{"m1"}) {
+		t.Fatalf("QueryMessages(sender) after reopen = %v, %v", messageIDs(got), err)
+	}
+	if got, err := store.QueryMessages(ctx, core.MessageQuery{ReplyToMessageID: "m1"}); err != nil || !slices.Equal(messageIDs(got), []string{"m2"}) {
+		t.Fatalf("QueryMessages(replies) after reopen = %v, %v", messageIDs(got), err)
+	}
+}
@@ -5,101 +5,318 @@ import (
 	"sync"
 	"time"
 
+	"mybot/internal/core"
 	"mybot/internal/metrics"
 )
 
-// RateLimiter implements a token-bucket rate limiter for outgoing messages.
-// It supports a global rate and optional per-thread rates.
-type RateLimiter struct {
-	globalRate  float64
-	globalBurst int
-	mu          sync.Mutex
-	tokens      float64
-	lastRefill  time.Time
+// SendLimits configures RateLimiter. Every send takes one token from the
+// global bucket, one from its thread's bucket and, when the send was
+// triggered by a user (core.WithRequester), one from that user's bucket.
+type SendLimits struct {
+	GlobalPerSecond int
+	GlobalBurst     int
+	ThreadPerMinute int
+	ThreadBurst     int
+	UserPerMinute   int
+	UserBurst       int
 }
 
-// NewRateLimiter creates a limiter that allows ratePerSecond messages per
-// second with the given burst bucket size.
-func NewRateLimiter(ratePerSecond, burst int) *RateLimiter {
-	if ratePerSecond <= 0 {
-		ratePerSecond = 30
-	}
-	if burst <= 0 {
-		burst = 10
+// DefaultSendLimits returns the limits used when none are configured.
+func DefaultSendLimits() SendLimits {
+	return SendLimits{
+		GlobalPerSecond: 30,
+		GlobalBurst:     10,
+		ThreadPerMinute: 20,
+		ThreadBurst:     6,
+		UserPerMinute:   12,
+		UserBurst:       6,
 	}
-	return &RateLimiter{
-		globalRate:  float64(ratePerSecond),
-		globalBurst: burst,
-		tokens:      float64(burst),
-		lastRefill:  time.Now(),
+}
+
+// bucket is a token bucket refilled continuously at rate tokens per second.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// delay returns how long until the bucket holds a whole token.
+func (b *bucket) delay(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
 	}
+	return time.Duration(float64(time.Second) * (1 - b.tokens) / b.rate)
 }
 
-// Wait reserves a token and blocks until its time slot arrives or ctx is
-// cancelled. Uses a reservation-based O(1) algorithm: each call reserves one
-// token immediately (tokens may go negative) and sleeps for exactly the
-// deficit duration. Concurrent callers receive progressively longer waits,
-// automatically spacing messages at the configured rate with zero polling.
-func (r *RateLimiter) Wait(ctx context.Context) error {
-	r.mu.Lock()
-	now := time.Now()
-	elapsed := now.Sub(r.lastRefill).Seconds()
-	r.lastRefill = now
+// full reports whether the bucket has refilled completely and can be dropped.
+func (b *bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+type sendWaiter struct {
+	threadID int64
+	userID   int64
+	queuedAt time.Time
+	ready    chan struct{}
+}
 
-	r.tokens += elapsed * r.globalRate
-	if r.tokens > float64(r.globalBurst) {
-		r.tokens = float64(r.globalBurst)
+// RateLimiter paces outgoing messages with hierarchical token buckets
+// (global, per thread, per user) and hands out send slots round-robin across
+// threads, so one busy thread can't starve the others. Sends within a thread
+// keep their FIFO order.
+type RateLimiter struct {
+	limits SendLimits
+
+	mu      sync.Mutex
+	global  *bucket
+	threads map[int64]*bucket
+	users   map[int64]*bucket
+	queues  map[int64][]*sendWaiter
+	ring    []int64 // threads with waiters, in round-robin order
+	next    int
+
+	kick     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRateLimiter creates a limiter and starts its scheduling goroutine.
+// Zero or negative fields in limits fall back to DefaultSendLimits.
+func NewRateLimiter(limits SendLimits) *RateLimiter {
+	def := DefaultSendLimits()
+	orDefault := func(v *int, d int) {
+		if *v <= 0 {
+			*v = d
+		}
 	}
+	orDefault(&limits.GlobalPerSecond, def.GlobalPerSecond)
+	orDefault(&limits.GlobalBurst, def.GlobalBurst)
+	orDefault(&limits.ThreadPerMinute, def.ThreadPerMinute)
+	orDefault(&limits.ThreadBurst, def.ThreadBurst)
+	orDefault(&limits.UserPerMinute, def.UserPerMinute)
+	orDefault(&limits.UserBurst, def.UserBurst)
 
-	// Reserve one token upfront (allow negative to schedule future callers).
-	r.tokens -= 1.0
-	if r.tokens >= 0 {
-		r.mu.Unlock()
-		return nil
+	r := &RateLimiter{
+		limits:  limits,
+		global:  newBucket(float64(limits.GlobalPerSecond), limits.GlobalBurst, time.Now()),
+		threads: make(map[int64]*bucket),
+		users:   make(map[int64]*bucket),
+		queues:  make(map[int64][]*sendWaiter),
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
 	}
+	go r.run()
+	return r
+}
 
-	// Exact wait: time for the deficit to be replenished at globalRate.
-	waitDur := time.Duration(float64(time.Second) * (-r.tokens) / r.globalRate)
+// Wait blocks until a send to threadID may go out or ctx is cancelled. The
+// requesting user is taken from ctx (core.RequesterFromContext).
+func (r *RateLimiter) Wait(ctx context.Context, threadID int64) error {
+	w := &sendWaiter{
+		threadID: threadID,
+		userID:   core.RequesterFromContext(ctx),
+		queuedAt: time.Now(),
+		ready:    make(chan struct{}),
+	}
+	r.mu.Lock()
+	if len(r.queues[threadID]) == 0 {
+		r.ring = append(r.ring, threadID)
+	}
+	r.queues[threadID] = append(r.queues[threadID], w)
 	r.mu.Unlock()
-
-	metrics.Global.SendRateLimited.Add(1)
-
-	timer := time.NewTimer(waitDur)
-	defer timer.Stop()
+	r.wake()
 
 	select {
+	case <-w.ready:
+		return nil
 	case <-ctx.Done():
-		// Return the reserved token on cancellation.
-		r.mu.Lock()
-		r.tokens += 1.0
-		r.mu.Unlock()
-		return ctx.Err()
-	case <-timer.C:
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-w.ready:
+		// Granted while we were giving up; the slot is used, not an error.
 		return nil
+	default:
+	}
+	r.removeLocked(w)
+	return ctx.Err()
+}
+
+// Close stops the scheduling goroutine. Pending waiters are released only by
+// their contexts.
+func (r *RateLimiter) Close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+func (r *RateLimiter) wake() {
+	select {
+	case r.kick <- struct{}{}:
+	default:
 	}
 }
 
-// TryAcquire attempts to consume one token without blocking.
-func (r *RateLimiter) TryAcquire() bool {
-	return r.tryAcquire()
+func (r *RateLimiter) run() {
+	var timer *time.Timer
+	for {
+		var timeout <-chan time.Time
+		if wait := r.grant(); wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-r.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-r.kick:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+	}
 }
 
-func (r *RateLimiter) tryAcquire() bool {
+// grant releases every waiter that may send now, visiting threads in
+// round-robin order. It returns how long until the next waiter could be
+// released, or 0 when nobody is waiting.
+func (r *RateLimiter) grant() time.Duration {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	now := time.Now()
-	elapsed := now.Sub(r.lastRefill).Seconds()
-	r.lastRefill = now
+	for len(r.ring) > 0 {
+		now := time.Now()
+		if d := r.global.delay(now); d > 0 {
+			metrics.Global.SendRateLimited.Add(1)
+			return d
+		}
 
-	r.tokens += elapsed * r.globalRate
-	if r.tokens > float64(r.globalBurst) {
-		r.tokens = float64(r.globalBurst)
+		granted := false
+		var soonest time.Duration
+		for i := 0; i < len(r.ring); i++ {
+			idx := (r.next + i) % len(r.ring)
+			w := r.queues[r.ring[idx]][0]
+			tb := r.threadBucket(w.threadID, now)
+			d := tb.delay(now)
+			var ub *bucket
+			if w.userID != 0 {
+				ub = r.userBucket(w.userID, now)
+				d = max(d, ub.delay(now))
+			}
+			if d > 0 {
+				if soonest == 0 || d < soonest {
+					soonest = d
+				}
+				continue
+			}
+
+			r.global.tokens--
+			tb.tokens--
+			if ub != nil {
+				ub.tokens--
+			}
+			waited := now.Sub(w.queuedAt)
+			metrics.Global.RecordSendWait(w.threadID, waited)
+			close(w.ready)
+			r.popLocked(idx)
+			granted = true
+			break
+		}
+		if !granted {
+			metrics.Global.SendRateLimited.Add(1)
+			return soonest
+		}
 	}
+	r.pruneLocked(time.Now())
+	return 0
+}
 
-	if r.tokens >= 1.0 {
-		r.tokens -= 1.0
-		return true
+// popLocked removes the head waiter of the thread at ring index idx and moves
+// the round-robin cursor past that thread.
+func (r *RateLimiter) popLocked(idx int) {
+	threadID := r.ring[idx]
+	queue := r.queues[threadID][1:]
+	if len(queue) > 0 {
+		r.queues[threadID] = queue
+		r.next = idx + 1
+		return
+	}
+	delete(r.queues, threadID)
+	r.ring = append(r.ring[:idx], r.ring[idx+1:]...)
+	r.next = idx
+	if len(r.ring) > 0 {
+		r.next %= len(r.ring)
+	} else {
+		r.next = 0
+	}
+}
+
+// removeLocked drops a cancelled waiter.
+func (r *RateLimiter) removeLocked(w *sendWaiter) {
+	queue := r.queues[w.threadID]
+	for i, q := range queue {
+		if q != w {
+			continue
+		}
+		if i == 0 {
+			for idx, threadID := range r.ring {
+				if threadID == w.threadID {
+					r.popLocked(idx)
+					break
+				}
+			}
+		} else {
+			r.queues[w.threadID] = append(queue[:i], queue[i+1:]...)
+		}
+		break
+	}
+	r.wake()
+}
+
+func (r *RateLimiter) threadBucket(threadID int64, now time.Time) *bucket {
+	b := r.threads[threadID]
+	if b == nil {
+		b = newBucket(float64(r.limits.ThreadPerMinute)/60, r.limits.ThreadBurst, now)
+		r.threads[threadID] = b
+	}
+	return b
+}
+
+func (r *RateLimiter) userBucket(userID int64, now time.Time) *bucket {
+	b := r.users[userID]
+	if b == nil {
+		b = newBucket(float64(r.limits.UserPerMinute)/60, r.limits.UserBurst, now)
+		r.users[userID] = b
+	}
+	return b
+}
+
+// pruneLocked forgets buckets that have refilled, keeping the maps small.
+func (r *RateLimiter) pruneLocked(now time.Time) {
+	for id, b := range r.threads {
+		if b.full(now) {
+			delete(r.threads, id)
+		}
+	}
+	for id, b := range r.users {
+		if b.full(now) {
+			delete(r.users, id)
+		}
 	}
-	return false
 }
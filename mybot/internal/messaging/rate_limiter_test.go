@@ -0,0 +1,167 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"mybot/internal/core"
+)
+
+// grantRecorder queues Wait calls on a limiter and records the order in which
+// they are granted.
+type grantRecorder struct {
+	t  *testing.T
+	rl *RateLimiter
+	wg sync.WaitGroup
+
+	mu    sync.Mutex
+	order []int64
+}
+
+// queue starts a Wait for threadID and returns once it is queued, so calls
+// are enqueued in a deterministic order.
+func (g *grantRecorder) queue(ctx context.Context, threadID int64) {
+	g.rl.mu.Lock()
+	before := len(g.rl.queues[threadID])
+	g.rl.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := g.rl.Wait(ctx, threadID); err != nil {
+			return
+		}
+		g.mu.Lock()
+		g.order = append(g.order, threadID)
+		g.mu.Unlock()
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		g.rl.mu.Lock()
+		n := len(g.rl.queues[threadID])
+		g.rl.mu.Unlock()
+		if n > before {
+			return
+		}
+		if time.Now().After(deadline) {
+			g.t.Fatalf("waiter for thread %d never queued", threadID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// pauseGlobal empties the global bucket and stops it refilling.
+func pauseGlobal(rl *RateLimiter) {
+	rl.mu.Lock()
+	rl.global.refill(time.Now())
+	rl.global.tokens = 0
+	rl.global.rate = 1e-9
+	rl.mu.Unlock()
+}
+
+func resumeGlobal(rl *RateLimiter, rate float64) {
+	rl.mu.Lock()
+	rl.global.last = time.Now()
+	rl.global.rate = rate
+	rl.mu.Unlock()
+	rl.wake()
+}
+
+func TestRateLimiterRoundRobinAcrossThreads(t *testing.T) {
+	rl := NewRateLimiter(SendLimits{
+		GlobalPerSecond: 200,
+		GlobalBurst:     1,
+		ThreadPerMinute: 60000,
+		ThreadBurst:     100,
+	})
+	defer rl.Close()
+	g := &grantRecorder{t: t, rl: rl}
+
+	pauseGlobal(rl)
+	// A busy thread queues five sends before a quiet thread queues one.
+	for i := 0; i < 5; i++ {
+		g.queue(context.Background(), 1)
+	}
+	g.queue(context.Background(), 2)
+	resumeGlobal(rl, 200)
+	g.wg.Wait()
+
+	if len(g.order) != 6 {
+		t.Fatalf("granted %d sends, want 6", len(g.order))
+	}
+	for i, id := range g.order {
+		if id == 2 && i > 1 {
+			t.Fatalf("quiet thread served at position %d, want within the first two (order %v)", i, g.order)
+		}
+	}
+}
+
+func TestRateLimiterPerThreadLimit(t *testing.T) {
+	rl := NewRateLimiter(SendLimits{
+		GlobalPerSecond: 1000,
+		GlobalBurst:     100,
+		ThreadPerMinute: 1, // effectively no refill during the test
+		ThreadBurst:     2,
+	})
+	defer rl.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := rl.Wait(ctx, 1); err != nil {
+			t.Fatalf("burst send %d: %v", i, err)
+		}
+	}
+
+	// Thread 1 is out of tokens; its next send must wait while thread 2
+	// is unaffected.
+	blocked, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := rl.Wait(blocked, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait over thread limit = %v, want deadline exceeded", err)
+	}
+	if err := rl.Wait(ctx, 2); err != nil {
+		t.Fatalf("other thread: %v", err)
+	}
+
+	rl.mu.Lock()
+	queued := len(rl.queues[1])
+	rl.mu.Unlock()
+	if queued != 0 {
+		t.Fatalf("cancelled waiter left in queue (%d)", queued)
+	}
+}
+
+func TestRateLimiterPerUserLimit(t *testing.T) {
+	rl := NewRateLimiter(SendLimits{
+		GlobalPerSecond: 1000,
+		GlobalBurst:     100,
+		ThreadPerMinute: 60000,
+		ThreadBurst:     100,
+		UserPerMinute:   1,
+		UserBurst:       1,
+	})
+	defer rl.Close()
+
+	ctx := context.Background()
+	alice := core.WithRequester(ctx, 42)
+	if err := rl.Wait(alice, 1); err != nil {
+		t.Fatalf("first send: %v", err)
+	}
+
+	// The same user is limited in a different thread too.
+	blocked, cancel := context.WithTimeout(alice, 50*time.Millisecond)
+	defer cancel()
+	if err := rl.Wait(blocked, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait over user limit = %v, want deadline exceeded", err)
+	}
+	if err := rl.Wait(core.WithRequester(ctx, 43), 2); err != nil {
+		t.Fatalf("other user: %v", err)
+	}
+	if err := rl.Wait(ctx, 3); err != nil {
+		t.Fatalf("send without requester: %v", err)
+	}
+}
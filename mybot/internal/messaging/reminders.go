@@ -0,0 +1,330 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+const (
+	// reminderMaxAttempts is how many times an occurrence is tried before a
+	// one-shot reminder is marked failed or a recurring one skips ahead.
+	reminderMaxAttempts = 5
+	// reminderRetryDelay is the wait between tries of a failed occurrence.
+	reminderRetryDelay = time.Minute
+	// reminderIdleWait is how often the store is re-checked without a wake-up.
+	reminderIdleWait = time.Minute
+	// reminderSendTimeout bounds a single send of a due reminder.
+	reminderSendTimeout = 3 * time.Minute
+)
+
+// ErrReminderBusy is returned when changing a reminder that is being sent.
+var ErrReminderBusy = errors.New("reminder is being sent")
+
+// ReminderStore persists reminders.
+type ReminderStore interface {
+	InsertReminder(ctx context.Context, r *core.Reminder) (int64, error)
+	UpdateReminder(ctx context.Context, r *core.Reminder) error
+	GetReminder(ctx context.Context, id int64) (*core.Reminder, error)
+	// ListReminders returns the active reminders of threadID, soonest first.
+	ListReminders(ctx context.Context, threadID int64) ([]*core.Reminder, error)
+	// ListDueReminders returns active reminders due at or before untilMs,
+	// soonest first.
+	ListDueReminders(ctx context.Context, untilMs int64) ([]*core.Reminder, error)
+	// NextReminderAt returns when the soonest active reminder is due, or 0.
+	NextReminderAt(ctx context.Context) (int64, error)
+}
+
+// Reminders fires stored reminders when due, mentioning their target through
+// the service's normal send path. Recurring reminders are then moved to their
+// next occurrence in the thread's time zone.
+type Reminders struct {
+	log     zerolog.Logger
+	store   ReminderStore
+	service *Service
+
+	mu     sync.Mutex
+	firing map[int64]bool
+
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// EnableReminders stores reminders in store and starts firing them when due.
+func (s *Service) EnableReminders(store ReminderStore) {
+	rm := &Reminders{
+		log:     s.log.With().Str("component", "reminders").Logger(),
+		store:   store,
+		service: s,
+		firing:  make(map[int64]bool),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.reminders = rm
+	go rm.run()
+}
+
+// AddReminder stores req. Without a TargetID the creator is reminded.
+func (s *Service) AddReminder(ctx context.Context, req core.ReminderRequest) (*core.Reminder, error) {
+	if s.reminders == nil {
+		return nil, ErrRemindersDisabled
+	}
+	if req.Text == "" {
+		return nil, errors.New("empty reminder text")
+	}
+	at := req.At
+	if req.Recurrence != "" {
+		// Validates the rule and moves e.g. a weekdays reminder set for a
+		// Saturday to the next Monday.
+		first, ok := core.NextOccurrence(req.Recurrence, at, at.Add(-time.Nanosecond), s.ThreadLocation(req.ThreadID))
+		if !ok {
+			return nil, fmt.Errorf("unknown recurrence %q", req.Recurrence)
+		}
+		at = first
+	}
+	nowMs := time.Now().UnixMilli()
+	r := &core.Reminder{
+		ThreadID:        req.ThreadID,
+		CreatorID:       core.RequesterFromContext(ctx),
+		TargetID:        req.TargetID,
+		Text:            req.Text,
+		Recurrence:      req.Recurrence,
+		Status:          core.ReminderActive,
+		NextAtUnixMs:    at.UnixMilli(),
+		AnchorAtUnixMs:  at.UnixMilli(),
+		CreatedAtUnixMs: nowMs,
+		UpdatedAtUnixMs: nowMs,
+	}
+	if r.TargetID == 0 {
+		r.TargetID = r.CreatorID
+	}
+	id, err := s.reminders.store.InsertReminder(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("add reminder: %w", err)
+	}
+	r.ID = id
+	s.reminders.log.Info().Int64("reminder_id", id).Int64("thread", r.ThreadID).Int64("target", r.TargetID).
+		Str("recurrence", r.Recurrence).Time("next_at", at).Msg("Reminder added")
+	s.reminders.Wake()
+	return r, nil
+}
+
+// GetReminder returns reminder id of threadID, or nil if there is none.
+func (s *Service) GetReminder(ctx context.Context, threadID, id int64) (*core.Reminder, error) {
+	if s.reminders == nil {
+		return nil, ErrRemindersDisabled
+	}
+	r, err := s.reminders.store.GetReminder(ctx, id)
+	if err != nil || r == nil || r.ThreadID != threadID || r.Status == core.ReminderDeleted {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ListReminders returns the active reminders of threadID.
+func (s *Service) ListReminders(ctx context.Context, threadID int64) ([]*core.Reminder, error) {
+	if s.reminders == nil {
+		return nil, ErrRemindersDisabled
+	}
+	return s.reminders.store.ListReminders(ctx, threadID)
+}
+
+// DeleteReminder deletes reminder id of threadID.
+func (s *Service) DeleteReminder(ctx context.Context, threadID, id int64) error {
+	if s.reminders == nil {
+		return ErrRemindersDisabled
+	}
+	_, err := s.reminders.update(ctx, threadID, id, func(r *core.Reminder) {
+		r.Status = core.ReminderDeleted
+	})
+	return err
+}
+
+// SnoozeReminder makes reminder id of threadID fire at until.
+func (s *Service) SnoozeReminder(ctx context.Context, threadID, id int64, until time.Time) (*core.Reminder, error) {
+	if s.reminders == nil {
+		return nil, ErrRemindersDisabled
+	}
+	r, err := s.reminders.update(ctx, threadID, id, func(r *core.Reminder) {
+		r.Status = core.ReminderActive
+		r.NextAtUnixMs = until.UnixMilli()
+		r.Attempts = 0
+		r.LastError = ""
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.reminders.log.Info().Int64("reminder_id", id).Time("next_at", until).Msg("Reminder snoozed")
+	s.reminders.Wake()
+	return r, nil
+}
+
+// update applies change to reminder id of threadID unless it is being sent.
+func (rm *Reminders) update(ctx context.Context, threadID, id int64, change func(r *core.Reminder)) (*core.Reminder, error) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.firing[id] {
+		return nil, ErrReminderBusy
+	}
+	r, err := rm.store.GetReminder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil || r.ThreadID != threadID || r.Status == core.ReminderDeleted {
+		return nil, ErrMessageNotFound
+	}
+	change(r)
+	r.UpdatedAtUnixMs = time.Now().UnixMilli()
+	if err := rm.store.UpdateReminder(ctx, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Wake schedules a check for due reminders.
+func (rm *Reminders) Wake() {
+	select {
+	case rm.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops firing reminders. Active reminders stay stored for next start.
+func (rm *Reminders) Close() {
+	rm.stopOnce.Do(func() { close(rm.stop) })
+	<-rm.done
+}
+
+func (rm *Reminders) run() {
+	defer close(rm.done)
+	for {
+		wait := rm.fireDue()
+		timer := time.NewTimer(wait)
+		select {
+		case <-rm.stop:
+			timer.Stop()
+			return
+		case <-rm.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// fireDue fires every due reminder and returns how long to wait before the
+// next one is due.
+func (rm *Reminders) fireDue() time.Duration {
+	ctx := context.Background()
+	items, err := rm.store.ListDueReminders(ctx, time.Now().UnixMilli())
+	if err != nil {
+		rm.log.Warn().Err(err).Msg("Failed to list due reminders")
+		return reminderIdleWait
+	}
+	for _, r := range items {
+		select {
+		case <-rm.stop:
+			return reminderIdleWait
+		default:
+		}
+		rm.fire(r.ID)
+	}
+
+	next, err := rm.store.NextReminderAt(ctx)
+	if err != nil || next == 0 {
+		return reminderIdleWait
+	}
+	return min(max(time.Until(time.UnixMilli(next)), 100*time.Millisecond), reminderIdleWait)
+}
+
+// fire sends one due reminder and moves it to its next occurrence.
+func (rm *Reminders) fire(id int64) {
+	rm.mu.Lock()
+	r, err := rm.store.GetReminder(context.Background(), id)
+	if err != nil || r == nil || r.Status != core.ReminderActive || r.NextAtUnixMs > time.Now().UnixMilli() {
+		rm.mu.Unlock()
+		return // deleted or snoozed meanwhile
+	}
+	rm.firing[id] = true
+	rm.mu.Unlock()
+	defer func() {
+		rm.mu.Lock()
+		delete(rm.firing, id)
+		rm.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(core.WithRequester(context.Background(), r.CreatorID), reminderSendTimeout)
+	defer cancel()
+	_, err = rm.service.SendText(ctx, rm.message(ctx, r))
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		r.FireCount++
+		r.Attempts = 0
+		r.LastError = ""
+		r.LastFiredAtUnixMs = now.UnixMilli()
+		rm.advance(r, now)
+		rm.log.Info().Int64("reminder_id", r.ID).Int64("thread", r.ThreadID).Str("status", string(r.Status)).Msg("Reminder fired")
+	case r.Attempts+1 >= reminderMaxAttempts:
+		r.Attempts = 0
+		r.LastError = err.Error()
+		rm.advance(r, now)
+		if r.Status == core.ReminderDone {
+			r.Status = core.ReminderFailed
+		}
+		rm.log.Error().Err(err).Int64("reminder_id", r.ID).Str("status", string(r.Status)).Msg("Giving up on reminder occurrence")
+	default:
+		r.Attempts++
+		r.LastError = err.Error()
+		r.NextAtUnixMs = now.Add(reminderRetryDelay).UnixMilli()
+		rm.log.Warn().Err(err).Int64("reminder_id", r.ID).Dur("retry_in", reminderRetryDelay).Msg("Reminder failed")
+	}
+	r.UpdatedAtUnixMs = now.UnixMilli()
+	if err := rm.store.UpdateReminder(context.Background(), r); err != nil {
+		rm.log.Warn().Err(err).Int64("reminder_id", r.ID).Msg("Failed to update reminder")
+	}
+}
+
+// advance moves a recurring reminder to its first occurrence after now
+// (skipping any missed while the bot was down) and marks a one-shot done.
+func (rm *Reminders) advance(r *core.Reminder, now time.Time) {
+	loc := rm.service.ThreadLocation(r.ThreadID)
+	next, ok := core.NextOccurrence(r.Recurrence, time.UnixMilli(r.AnchorAtUnixMs), now, loc)
+	if !ok {
+		r.Status = core.ReminderDone
+		return
+	}
+	r.AnchorAtUnixMs = next.UnixMilli()
+	r.NextAtUnixMs = next.UnixMilli()
+}
+
+// message builds "⏰ @Target: text" with the reminder's ID and recurrence.
+func (rm *Reminders) message(ctx context.Context, r *core.Reminder) core.SendTextRequest {
+	m := &core.MentionBuilder{}
+	m.WriteText("⏰ ")
+	if r.TargetID != 0 {
+		name := strconv.FormatInt(r.TargetID, 10)
+		if user, err := rm.service.GetUser(ctx, r.TargetID); err == nil && user != nil && user.Name != "" {
+			name = user.Name
+		}
+		m.WriteMention(r.TargetID, name)
+		m.WriteText(": ")
+	}
+	m.WriteText(r.Text)
+	if r.Recurrence != "" {
+		m.WriteText(fmt.Sprintf("\n(#%d · 🔁 %s)", r.ID, core.DescribeRecurrence(r.Recurrence)))
+	} else {
+		m.WriteText(fmt.Sprintf("\n(#%d)", r.ID))
+	}
+	return m.TextRequest(r.ThreadID)
+}
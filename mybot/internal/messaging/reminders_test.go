@@ -0,0 +1,122 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+func waitReminder(t *testing.T, store *SQLiteStore, id int64, done func(r *core.Reminder) bool) *core.Reminder {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r, err := store.GetReminder(context.Background(), id)
+		if err != nil {
+			t.Fatalf("GetReminder() error = %v", err)
+		}
+		if done(r) {
+			return r
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reminder #%d not fired: %+v", id, r)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRemindersFireWithMentionAndRecur(t *testing.T) {
+	ctx := core.WithRequester(context.Background(), 7)
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	if err := store.UpsertUser(ctx, &core.UserRecord{UserID: 9, Name: "Lan"}); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+
+	transport := &fakeTransport{
+		selfID:       42,
+		nextTextResp: &core.MessageRecord{MessageID: "m1", ThreadID: 1001, SenderID: 42},
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	service.EnableReminders(store)
+
+	later, err := service.AddReminder(ctx, core.ReminderRequest{ThreadID: 1001, Text: "later", At: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("AddReminder(later) error = %v", err)
+	}
+	if later.CreatorID != 7 || later.TargetID != 7 || later.Status != core.ReminderActive {
+		t.Fatalf("AddReminder() = %+v, want creator and target 7", later)
+	}
+
+	once, err := service.AddReminder(ctx, core.ReminderRequest{ThreadID: 1001, TargetID: 9, Text: "uống thuốc", At: time.Now()})
+	if err != nil {
+		t.Fatalf("AddReminder(once) error = %v", err)
+	}
+	fired := waitReminder(t, store, once.ID, func(r *core.Reminder) bool { return r.Status == core.ReminderDone })
+	if fired.FireCount != 1 || fired.LastFiredAtUnixMs == 0 {
+		t.Fatalf("fired one-shot = %+v", fired)
+	}
+
+	start := time.Now()
+	recurring, err := service.AddReminder(ctx, core.ReminderRequest{ThreadID: 1001, TargetID: 9, Text: "đứng dậy", Recurrence: "every 30m0s", At: start})
+	if err != nil {
+		t.Fatalf("AddReminder(recurring) error = %v", err)
+	}
+	recurred := waitReminder(t, store, recurring.ID, func(r *core.Reminder) bool { return r.FireCount == 1 })
+	if recurred.Status != core.ReminderActive || recurred.NextAtUnixMs != start.Add(30*time.Minute).UnixMilli() {
+		t.Fatalf("recurring after fire = %+v, want active at +30m", recurred)
+	}
+
+	active, err := service.ListReminders(ctx, 1001)
+	if err != nil {
+		t.Fatalf("ListReminders() error = %v", err)
+	}
+	if len(active) != 2 || active[0].ID != recurring.ID || active[1].ID != later.ID {
+		t.Fatalf("ListReminders() = %+v, want #%d then #%d", active, recurring.ID, later.ID)
+	}
+
+	// Snoozing a fired one-shot re-activates it.
+	until := time.Now().Add(10 * time.Minute)
+	snoozed, err := service.SnoozeReminder(ctx, 1001, once.ID, until)
+	if err != nil {
+		t.Fatalf("SnoozeReminder() error = %v", err)
+	}
+	if snoozed.Status != core.ReminderActive || snoozed.NextAtUnixMs != until.UnixMilli() {
+		t.Fatalf("SnoozeReminder() = %+v", snoozed)
+	}
+
+	if err := service.DeleteReminder(ctx, 2002, later.ID); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("DeleteReminder(other thread) = %v, want ErrMessageNotFound", err)
+	}
+	if err := service.DeleteReminder(ctx, 1001, later.ID); err != nil {
+		t.Fatalf("DeleteReminder() error = %v", err)
+	}
+	if r, err := service.GetReminder(ctx, 1001, later.ID); err != nil || r != nil {
+		t.Fatalf("GetReminder(deleted) = %+v, %v; want nil", r, err)
+	}
+
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(transport.textReqs) != 2 {
+		t.Fatalf("sent %d reminders, want 2", len(transport.textReqs))
+	}
+	req := transport.textReqs[0]
+	if !strings.HasPrefix(req.Text, "⏰ @Lan: uống thuốc") || len(req.Mentions) != 1 || req.Mentions[0].UserID != 9 {
+		t.Fatalf("reminder message = %q %+v", req.Text, req.Mentions)
+	}
+	if got := core.MentionedText(req.Text, req.Mentions[0]); got != "@Lan" {
+		t.Fatalf("mentioned text = %q, want @Lan", got)
+	}
+	if !strings.Contains(transport.textReqs[1].Text, "🔁 mỗi 30m") {
+		t.Fatalf("recurring message = %q, want recurrence note", transport.textReqs[1].Text)
+	}
+}
@@ -0,0 +1,261 @@
+package messaging
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/metrics"
+)
+
+// retentionFirstRun is how long after start the first pruning pass runs, so
+// it does not compete with the initial sync.
+const retentionFirstRun = time.Minute
+
+// PruneRule selects messages by age. A zero cutoff selects nothing.
+type PruneRule struct {
+	// BeforeMs selects messages not sent by the bot older than it.
+	BeforeMs int64
+	// BotBeforeMs selects the bot's messages older than it.
+	BotBeforeMs int64
+	// KeepPinned leaves out the messages pinned in Messenger.
+	KeepPinned bool
+}
+
+// RetentionStore deletes old messages. Every method that changes rows works
+// on at most limit of them, in one short write transaction, and returns
+// how many it changed. The last message the bot sent in a thread is never
+// deleted or slimmed.
+type RetentionStore interface {
+	// PruneMessages deletes messages older than rule, with their edits,
+	// pins, search entries and links to archived attachments.
+	PruneMessages(ctx context.Context, rule PruneRule, limit int) (int, error)
+	// ThreadsOverMessageLimit returns the threads holding more than
+	// maxMessages messages not sent by the bot.
+	ThreadsOverMessageLimit(ctx context.Context, maxMessages int) ([]int64, error)
+	// PruneThreadOverflow deletes the messages of threadID not sent by the
+	// bot past its keep newest ones.
+	PruneThreadOverflow(ctx context.Context, threadID int64, keep int, keepPinned bool, limit int) (int, error)
+	// SlimMessages empties the attachments and sender name snapshot of
+	// messages older than beforeMs.
+	SlimMessages(ctx context.Context, beforeMs int64, limit int) (int, error)
+	// CheckpointWAL moves the write-ahead log into the database file and
+	// truncates it.
+	CheckpointWAL(ctx context.Context) error
+	// Vacuum rebuilds the database file and records when it did.
+	Vacuum(ctx context.Context) error
+	// LastVacuumAt returns when Vacuum last ran, or the zero time.
+	LastVacuumAt(ctx context.Context) (time.Time, error)
+}
+
+// RetentionPolicy says what the pruner keeps. A zero age or count turns that
+// limit off.
+type RetentionPolicy struct {
+	MaxAge               time.Duration // messages not sent by the bot
+	BotMaxAge            time.Duration // the bot's own messages
+	MaxMessagesPerThread int           // newest messages kept per thread, the bot's not counted
+	KeepPinned           bool          // pinned messages are kept past every limit
+	SlimAfter            time.Duration // drop attachments and name snapshots past this age
+
+	Interval    time.Duration // between pruning passes
+	BatchSize   int           // rows per write transaction
+	BatchPause  time.Duration // between two batches, so queued writes get the writer
+	VacuumEvery time.Duration // 0 = never VACUUM
+}
+
+// PruneReport sums up one pruning pass.
+type PruneReport struct {
+	Aged     int // deleted for their age
+	Overflow int // deleted past MaxMessagesPerThread
+	Slimmed  int
+	Vacuumed bool
+	Took     time.Duration
+}
+
+// Pruned returns how many messages the pass deleted.
+func (r PruneReport) Pruned() int {
+	return r.Aged + r.Overflow
+}
+
+// Retention prunes the message store in the background. Each pass deletes
+// in small batches with a pause in between, so the write batcher is never
+// held up for more than one batch.
+type Retention struct {
+	log    zerolog.Logger
+	store  RetentionStore
+	policy RetentionPolicy
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// EnableRetention prunes store by policy every policy.Interval, starting a
+// minute from now.
+func (s *Service) EnableRetention(store RetentionStore, policy RetentionPolicy) {
+	if policy.Interval <= 0 {
+		policy.Interval = time.Hour
+	}
+	if policy.BatchSize <= 0 {
+		policy.BatchSize = 500
+	}
+	r := &Retention{
+		log:    s.log.With().Str("component", "retention").Logger(),
+		store:  store,
+		policy: policy,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	s.retention = r
+	go r.run()
+}
+
+// Close stops pruning, interrupting a pass between two batches.
+func (r *Retention) Close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+func (r *Retention) run() {
+	defer close(r.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	wait := retentionFirstRun
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-r.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		wait = r.policy.Interval
+
+		report, err := r.Prune(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		evt := r.log.Info()
+		if err != nil {
+			evt = r.log.Warn().Err(err)
+		} else if report.Pruned() == 0 && report.Slimmed == 0 && !report.Vacuumed {
+			evt = r.log.Debug()
+		}
+		evt.Int("aged", report.Aged).Int("overflow", report.Overflow).Int("slimmed", report.Slimmed).
+			Bool("vacuumed", report.Vacuumed).Dur("took", report.Took).Msg("Retention pass done")
+	}
+}
+
+// Prune runs one pass: it deletes messages past their age, then past the
+// per-thread limit, slims what is left, and checkpoints or vacuums the
+// database. It stops between batches when ctx is done.
+func (r *Retention) Prune(ctx context.Context) (PruneReport, error) {
+	start := time.Now()
+	var report PruneReport
+	defer func() { report.Took = time.Since(start) }()
+	p := r.policy
+
+	rule := PruneRule{KeepPinned: p.KeepPinned}
+	if p.MaxAge > 0 {
+		rule.BeforeMs = start.Add(-p.MaxAge).UnixMilli()
+	}
+	if p.BotMaxAge > 0 {
+		rule.BotBeforeMs = start.Add(-p.BotMaxAge).UnixMilli()
+	}
+	if rule.BeforeMs > 0 || rule.BotBeforeMs > 0 {
+		n, err := r.batches(ctx, func() (int, error) {
+			n, err := r.store.PruneMessages(ctx, rule, p.BatchSize)
+			metrics.Global.RecordPrune(n, 0)
+			return n, err
+		})
+		report.Aged = n
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if p.MaxMessagesPerThread > 0 {
+		threads, err := r.store.ThreadsOverMessageLimit(ctx, p.MaxMessagesPerThread)
+		if err != nil {
+			return report, err
+		}
+		for _, threadID := range threads {
+			n, err := r.batches(ctx, func() (int, error) {
+				n, err := r.store.PruneThreadOverflow(ctx, threadID, p.MaxMessagesPerThread, p.KeepPinned, p.BatchSize)
+				metrics.Global.RecordPrune(n, 0)
+				return n, err
+			})
+			report.Overflow += n
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if p.SlimAfter > 0 {
+		beforeMs := start.Add(-p.SlimAfter).UnixMilli()
+		n, err := r.batches(ctx, func() (int, error) {
+			n, err := r.store.SlimMessages(ctx, beforeMs, p.BatchSize)
+			metrics.Global.RecordPrune(0, n)
+			return n, err
+		})
+		report.Slimmed = n
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if p.VacuumEvery > 0 {
+		last, err := r.store.LastVacuumAt(ctx)
+		if err != nil {
+			return report, err
+		}
+		if last.IsZero() || time.Since(last) >= p.VacuumEvery {
+			if err := r.store.Vacuum(ctx); err != nil {
+				return report, err
+			}
+			metrics.Global.DBVacuums.Add(1)
+			report.Vacuumed = true
+			return report, nil
+		}
+	}
+	if report.Pruned() > 0 || report.Slimmed > 0 {
+		return report, r.store.CheckpointWAL(ctx)
+	}
+	return report, nil
+}
+
+// batches calls step until it changes fewer than a full batch of rows,
+// pausing between calls, and returns the rows changed in total.
+func (r *Retention) batches(ctx context.Context, step func() (int, error)) (int, error) {
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := step()
+		total += n
+		if err != nil || n < r.policy.BatchSize {
+			return total, err
+		}
+		if r.policy.BatchPause > 0 {
+			timer := time.NewTimer(r.policy.BatchPause)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return total, ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+func TestRetentionPrunesByAgeAndThreadLimit(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	daysAgo := func(d int) int64 { return now.Add(-time.Duration(d) * 24 * time.Hour).UnixMilli() }
+	for _, m := range []*core.MessageRecord{
+		{MessageID: "old", ThreadID: 1, Text: "phở cũ", TimestampMs: daysAgo(40)},
+		{MessageID: "old-pinned", ThreadID: 1, Text: "ghim", TimestampMs: daysAgo(40)},
+		{MessageID: "old-bot", ThreadID: 1, Text: "bot", IsFromBot: true, TimestampMs: daysAgo(40)},
+		{MessageID: "older-bot", ThreadID: 1, Text: "bot", IsFromBot: true, TimestampMs: daysAgo(80)},
+		{MessageID: "last-bot", ThreadID: 2, Text: "bot", IsFromBot: true, TimestampMs: daysAgo(80)},
+		{MessageID: "recent", ThreadID: 1, Text: "mới", TimestampMs: daysAgo(5),
+			SenderNameSnapshot: "Alice", HasMedia: true, Attachments: []core.AttachmentMeta{{Kind: "image"}}},
+	} {
+		if err := store.UpsertMessage(ctx, m); err != nil {
+			t.Fatalf("UpsertMessage(%s) error = %v", m.MessageID, err)
+		}
+	}
+	for i := range 5 {
+		store.UpsertMessage(ctx, &core.MessageRecord{MessageID: fmt.Sprintf("busy-%d", i), ThreadID: 3, Text: "x", TimestampMs: daysAgo(1) + int64(i)})
+	}
+	store.UpsertMessageEdit(ctx, &core.MessageEdit{MessageID: "old", ThreadID: 1, Text: "pho", TimestampMs: daysAgo(41)})
+	store.SetMessagePinned(ctx, &core.MessagePin{ThreadID: 1, MessageID: "old-pinned", PinnedAtUnixMs: daysAgo(40)})
+	store.SetLastBotMessage(ctx, 2, "last-bot")
+
+	r := &Retention{log: zerolog.Nop(), store: store, policy: RetentionPolicy{
+		MaxAge:               30 * 24 * time.Hour,
+		BotMaxAge:            60 * 24 * time.Hour,
+		MaxMessagesPerThread: 2,
+		KeepPinned:           true,
+		SlimAfter:            3 * 24 * time.Hour,
+		BatchSize:            1,
+		VacuumEvery:          time.Hour,
+	}}
+	report, err := r.Prune(ctx)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if report.Aged != 2 || report.Overflow != 3 || report.Slimmed != 1 || !report.Vacuumed {
+		t.Fatalf("Prune() report = %+v, want 2 aged, 3 overflow, 1 slimmed, vacuumed", report)
+	}
+
+	for id, kept := range map[string]bool{
+		"old": false, "older-bot": false,
+		"old-pinned": true, "old-bot": true, "last-bot": true, "recent": true,
+		"busy-0": false, "busy-2": false, "busy-3": true, "busy-4": true,
+	} {
+		if got, _ := store.GetMessage(ctx, id); (got != nil) != kept {
+			t.Errorf("GetMessage(%s) = %+v, want kept=%v", id, got, kept)
+		}
+	}
+	if edits, _ := store.ListMessageEdits(ctx, "old"); len(edits) != 0 {
+		t.Errorf("ListMessageEdits(old) = %+v, want the edits pruned too", edits)
+	}
+	if found, _ := store.SearchMessages(ctx, 1, "pho", core.SearchFilters{}); len(found) != 0 {
+		t.Errorf("SearchMessages(pho) = %v, want the pruned message unindexed", messageIDs(found))
+	}
+	if got, _ := store.GetMessage(ctx, "recent"); got == nil || len(got.Attachments) != 0 || got.SenderNameSnapshot != "" || !got.HasMedia || got.Text != "mới" {
+		t.Errorf("GetMessage(recent) = %+v, want attachments and name slimmed", got)
+	}
+	if last, _ := store.LastVacuumAt(ctx); last.IsZero() {
+		t.Error("LastVacuumAt() is zero after a vacuum")
+	}
+
+	// A second pass finds nothing to do and the vacuum is not due yet.
+	if report, err := r.Prune(ctx); err != nil || report.Pruned() != 0 || report.Slimmed != 0 || report.Vacuumed {
+		t.Fatalf("second Prune() = %+v, %v", report, err)
+	}
+}
+
+func TestRetentionStopsBetweenBatches(t *testing.T) {
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := range 3 {
+		store.UpsertMessage(ctx, &core.MessageRecord{MessageID: fmt.Sprintf("m%d", i), ThreadID: 1, TimestampMs: int64(i + 1)})
+	}
+
+	r := &Retention{log: zerolog.Nop(), store: store, policy: RetentionPolicy{
+		MaxAge:     time.Hour,
+		BatchSize:  1,
+		BatchPause: time.Hour,
+	}}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	report, err := r.Prune(ctx)
+	if err == nil || report.Aged != 1 {
+		t.Fatalf("Prune() = %+v, %v, want one batch then the context error", report, err)
+	}
+}
@@ -0,0 +1,383 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+const (
+	// scheduleMaxAttempts is how many times a due message is tried before it
+	// is marked failed.
+	scheduleMaxAttempts = 3
+	// scheduleRetryDelay is multiplied by the attempt count between tries.
+	scheduleRetryDelay = time.Minute
+	// scheduleIdleWait is how often the store is re-checked without a wake-up.
+	scheduleIdleWait = time.Minute
+	// scheduleSendTimeout bounds a single send of a due message.
+	scheduleSendTimeout = 3 * time.Minute
+)
+
+// ErrScheduleBusy is returned when cancelling a message that is being sent.
+var ErrScheduleBusy = errors.New("scheduled message is being sent")
+
+// ScheduledItem is a scheduled message as persisted by a ScheduleStore.
+type ScheduledItem struct {
+	core.ScheduledMessage
+	Payload []byte // JSON-encoded outboxPayload
+}
+
+// ScheduleStore persists scheduled messages.
+type ScheduleStore interface {
+	InsertScheduled(ctx context.Context, item *ScheduledItem) (int64, error)
+	UpdateScheduled(ctx context.Context, item *ScheduledItem) error
+	GetScheduled(ctx context.Context, id int64) (*ScheduledItem, error)
+	// ListScheduled returns the pending items of threadID, soonest first.
+	ListScheduled(ctx context.Context, threadID int64) ([]*ScheduledItem, error)
+	// ListDueScheduled returns pending items due at or before untilMs,
+	// soonest first.
+	ListDueScheduled(ctx context.Context, untilMs int64) ([]*ScheduledItem, error)
+	// NextScheduledAt returns when the soonest pending item is due, or 0.
+	NextScheduledAt(ctx context.Context) (int64, error)
+	// GetQueuedScheduled returns the queued item handed to the outbox as
+	// outboxID, or nil.
+	GetQueuedScheduled(ctx context.Context, outboxID int64) (*ScheduledItem, error)
+}
+
+// Scheduler sends stored messages when they come due, through the service's
+// normal send path (so they are rate limited, split and queued in the outbox
+// while disconnected like any other send).
+type Scheduler struct {
+	log      zerolog.Logger
+	store    ScheduleStore
+	service  *Service
+	spoolDir string
+
+	mu     sync.Mutex
+	firing map[int64]bool
+
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// EnableScheduler stores scheduled messages in store and starts sending them
+// when due. Scheduled media is copied to spoolDir until sent.
+func (s *Service) EnableScheduler(store ScheduleStore, spoolDir string) error {
+	if err := os.MkdirAll(spoolDir, 0o755); err != nil {
+		return fmt.Errorf("create schedule spool: %w", err)
+	}
+	sc := &Scheduler{
+		log:      s.log.With().Str("component", "scheduler").Logger(),
+		store:    store,
+		service:  s,
+		spoolDir: spoolDir,
+		firing:   make(map[int64]bool),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	s.scheduler = sc
+	go sc.run()
+	return nil
+}
+
+// ScheduleText stores req to be sent at at.
+func (s *Service) ScheduleText(ctx context.Context, req core.SendTextRequest, at time.Time) (*core.ScheduledMessage, error) {
+	if s.scheduler == nil {
+		return nil, ErrSchedulerDisabled
+	}
+	if req.Text == "" {
+		return nil, errors.New("empty scheduled text")
+	}
+	payload := outboxPayload{Text: req.Text, Mentions: req.Mentions}
+	if req.ReplyTo != nil {
+		payload.ReplyTo = req.ReplyTo.MessageID
+	}
+	return s.scheduler.add(ctx, req.ThreadID, "text", payload, at)
+}
+
+// ScheduleMedia copies the media in req and stores it to be sent at at.
+func (s *Service) ScheduleMedia(ctx context.Context, req core.SendMediaRequest, at time.Time) (*core.ScheduledMessage, error) {
+	if s.scheduler == nil {
+		return nil, ErrSchedulerDisabled
+	}
+	if len(req.Items) == 0 {
+		return nil, errors.New("no scheduled media")
+	}
+	payload := outboxPayload{Text: req.Text}
+	if req.ReplyTo != nil {
+		payload.ReplyTo = req.ReplyTo.MessageID
+	}
+	prefix := fmt.Sprintf("%d", time.Now().UnixNano())
+	for i := range req.Items {
+		file, err := spoolMedia(s.scheduler.spoolDir, &req.Items[i], fmt.Sprintf("%s-%d", prefix, i))
+		if err != nil {
+			removeSpooled(payload.Files)
+			return nil, err
+		}
+		payload.Files = append(payload.Files, file)
+	}
+	msg, err := s.scheduler.add(ctx, req.ThreadID, "media", payload, at)
+	if err != nil {
+		removeSpooled(payload.Files)
+	}
+	return msg, err
+}
+
+// ListScheduled returns the pending scheduled messages of threadID.
+func (s *Service) ListScheduled(ctx context.Context, threadID int64) ([]*core.ScheduledMessage, error) {
+	if s.scheduler == nil {
+		return nil, ErrSchedulerDisabled
+	}
+	items, err := s.scheduler.store.ListScheduled(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*core.ScheduledMessage, len(items))
+	for i, item := range items {
+		msg := item.ScheduledMessage
+		out[i] = &msg
+	}
+	return out, nil
+}
+
+// CancelScheduled cancels pending scheduled message id of threadID.
+func (s *Service) CancelScheduled(ctx context.Context, threadID, id int64) error {
+	if s.scheduler == nil {
+		return ErrSchedulerDisabled
+	}
+	return s.scheduler.cancel(ctx, threadID, id)
+}
+
+func (sc *Scheduler) add(ctx context.Context, threadID int64, kind string, payload outboxPayload, at time.Time) (*core.ScheduledMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	nowMs := time.Now().UnixMilli()
+	item := &ScheduledItem{
+		ScheduledMessage: core.ScheduledMessage{
+			ThreadID:        threadID,
+			CreatorID:       core.RequesterFromContext(ctx),
+			Kind:            kind,
+			Text:            payload.Text,
+			Status:          core.SchedulePending,
+			SendAtUnixMs:    at.UnixMilli(),
+			CreatedAtUnixMs: nowMs,
+			UpdatedAtUnixMs: nowMs,
+		},
+		Payload: data,
+	}
+	id, err := sc.store.InsertScheduled(ctx, item)
+	if err != nil {
+		return nil, fmt.Errorf("schedule message: %w", err)
+	}
+	item.ID = id
+	sc.log.Info().Int64("schedule_id", id).Int64("thread", threadID).Time("send_at", at).Msg("Message scheduled")
+	sc.Wake()
+	msg := item.ScheduledMessage
+	return &msg, nil
+}
+
+func (sc *Scheduler) cancel(ctx context.Context, threadID, id int64) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.firing[id] {
+		return ErrScheduleBusy
+	}
+	item, err := sc.store.GetScheduled(ctx, id)
+	if err != nil {
+		return err
+	}
+	if item == nil || item.ThreadID != threadID || item.Status != core.SchedulePending {
+		return ErrMessageNotFound
+	}
+	item.Status = core.ScheduleCancelled
+	item.UpdatedAtUnixMs = time.Now().UnixMilli()
+	if err := sc.store.UpdateScheduled(ctx, item); err != nil {
+		return err
+	}
+	var payload outboxPayload
+	if json.Unmarshal(item.Payload, &payload) == nil {
+		removeSpooled(payload.Files)
+	}
+	return nil
+}
+
+// Wake schedules a check for due messages.
+func (sc *Scheduler) Wake() {
+	select {
+	case sc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the scheduler. Pending messages stay stored for next start.
+func (sc *Scheduler) Close() {
+	sc.stopOnce.Do(func() { close(sc.stop) })
+	<-sc.done
+}
+
+func (sc *Scheduler) run() {
+	defer close(sc.done)
+	for {
+		wait := sc.fireDue()
+		timer := time.NewTimer(wait)
+		select {
+		case <-sc.stop:
+			timer.Stop()
+			return
+		case <-sc.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// fireDue sends every due message and returns how long to wait before the
+// next one is due.
+func (sc *Scheduler) fireDue() time.Duration {
+	ctx := context.Background()
+	items, err := sc.store.ListDueScheduled(ctx, time.Now().UnixMilli())
+	if err != nil {
+		sc.log.Warn().Err(err).Msg("Failed to list due scheduled messages")
+		return scheduleIdleWait
+	}
+	for _, item := range items {
+		select {
+		case <-sc.stop:
+			return scheduleIdleWait
+		default:
+		}
+		sc.fire(item)
+	}
+
+	next, err := sc.store.NextScheduledAt(ctx)
+	if err != nil || next == 0 {
+		return scheduleIdleWait
+	}
+	return min(max(time.Until(time.UnixMilli(next)), 100*time.Millisecond), scheduleIdleWait)
+}
+
+// fire sends one due message and records the outcome.
+func (sc *Scheduler) fire(item *ScheduledItem) {
+	sc.mu.Lock()
+	current, err := sc.store.GetScheduled(context.Background(), item.ID)
+	if err != nil || current == nil || current.Status != core.SchedulePending {
+		sc.mu.Unlock()
+		return // cancelled meanwhile
+	}
+	sc.firing[item.ID] = true
+	sc.mu.Unlock()
+	defer func() {
+		sc.mu.Lock()
+		delete(sc.firing, item.ID)
+		sc.mu.Unlock()
+	}()
+
+	var payload outboxPayload
+	if err := json.Unmarshal(item.Payload, &payload); err != nil {
+		sc.finish(item, core.ScheduleFailed, "", fmt.Sprintf("corrupt payload: %v", err), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(core.WithRequester(context.Background(), item.CreatorID), scheduleSendTimeout)
+	defer cancel()
+	var replyTo *core.ReplyTarget
+	if payload.ReplyTo != "" {
+		replyTo = &core.ReplyTarget{MessageID: payload.ReplyTo}
+	}
+
+	var rec *core.MessageRecord
+	switch item.Kind {
+	case "media":
+		attachments := make([]core.MediaAttachment, len(payload.Files))
+		for i, f := range payload.Files {
+			attachments[i] = core.MediaAttachment{FilePath: f.Path, FileSize: f.Size, Filename: f.Filename, MimeType: f.MimeType}
+		}
+		rec, err = sc.service.SendMedia(ctx, core.SendMediaRequest{
+			ThreadID: item.ThreadID, Items: attachments, ReplyTo: replyTo, Text: payload.Text,
+		})
+	default:
+		rec, err = sc.service.SendText(ctx, core.SendTextRequest{
+			ThreadID: item.ThreadID, Text: payload.Text, ReplyTo: replyTo, Mentions: payload.Mentions,
+		})
+	}
+
+	item.Attempts++
+	lastError := ""
+	if err != nil && rec != nil {
+		// The first parts of a split text went out and a retry would send
+		// them again, so the missing rest is only reported.
+		sc.log.Warn().Err(err).Int64("schedule_id", item.ID).Msg("Scheduled message sent in part")
+		lastError, err = err.Error(), nil
+	}
+	if err == nil && rec != nil && rec.OutboxID != 0 {
+		// Sent once the outbox delivers it; see resolveQueued.
+		item.OutboxID = rec.OutboxID
+		sc.log.Info().Int64("schedule_id", item.ID).Int64("thread", item.ThreadID).Int64("outbox_id", rec.OutboxID).Msg("Scheduled message queued")
+		sc.finish(item, core.ScheduleQueued, "", lastError, payload.Files)
+		return
+	}
+	if err == nil {
+		messageID := ""
+		if rec != nil {
+			messageID = rec.MessageID
+		}
+		sc.log.Info().Int64("schedule_id", item.ID).Int64("thread", item.ThreadID).Str("msg_id", messageID).Msg("Scheduled message sent")
+		sc.finish(item, core.ScheduleSent, messageID, lastError, payload.Files)
+		return
+	}
+	if item.Attempts >= scheduleMaxAttempts {
+		sc.log.Error().Err(err).Int64("schedule_id", item.ID).Msg("Giving up on scheduled message")
+		sc.finish(item, core.ScheduleFailed, "", err.Error(), payload.Files)
+		return
+	}
+	retry := scheduleRetryDelay * time.Duration(item.Attempts)
+	item.LastError = err.Error()
+	item.SendAtUnixMs = time.Now().Add(retry).UnixMilli()
+	item.UpdatedAtUnixMs = time.Now().UnixMilli()
+	sc.log.Warn().Err(err).Int64("schedule_id", item.ID).Dur("retry_in", retry).Msg("Scheduled message failed")
+	if err := sc.store.UpdateScheduled(context.Background(), item); err != nil {
+		sc.log.Warn().Err(err).Int64("schedule_id", item.ID).Msg("Failed to update scheduled message")
+	}
+}
+
+func (sc *Scheduler) finish(item *ScheduledItem, status core.ScheduleStatus, messageID, lastError string, files []outboxFile) {
+	removeSpooled(files)
+	item.Status = status
+	item.MessageID = messageID
+	item.LastError = lastError
+	item.UpdatedAtUnixMs = time.Now().UnixMilli()
+	if err := sc.store.UpdateScheduled(context.Background(), item); err != nil {
+		sc.log.Warn().Err(err).Int64("schedule_id", item.ID).Msg("Failed to update scheduled message")
+	}
+}
+
+// resolveQueued records the outcome of the outbox message entry on the
+// scheduled message that was queued as it, if any.
+func (sc *Scheduler) resolveQueued(ctx context.Context, entry *core.OutboxEntry) {
+	item, err := sc.store.GetQueuedScheduled(ctx, entry.ID)
+	if err != nil {
+		sc.log.Warn().Err(err).Int64("outbox_id", entry.ID).Msg("Failed to load queued scheduled message")
+		return
+	}
+	if item == nil {
+		return
+	}
+	status := core.ScheduleSent
+	if entry.Status == core.DeliveryFailed {
+		status = core.ScheduleFailed
+	}
+	sc.finish(item, status, entry.MessageID, entry.LastError, nil)
+}
@@ -0,0 +1,188 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+func TestSchedulerSendsDueMessagesAndSkipsCancelled(t *testing.T) {
+	ctx := core.WithRequester(context.Background(), 7)
+	dir := t.TempDir()
+	store, err := OpenSQLiteStore(filepath.Join(dir, "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+
+	transport := &fakeTransport{
+		selfID:       42,
+		nextTextResp: &core.MessageRecord{MessageID: "m1", ThreadID: 1001, SenderID: 42},
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	if err := service.EnableScheduler(store, filepath.Join(dir, "scheduled")); err != nil {
+		t.Fatalf("EnableScheduler() error = %v", err)
+	}
+
+	later, err := service.ScheduleText(ctx, core.SendTextRequest{ThreadID: 1001, Text: "later"}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ScheduleText(later) error = %v", err)
+	}
+	cancelled, err := service.ScheduleText(ctx, core.SendTextRequest{ThreadID: 1001, Text: "cancelled"}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ScheduleText(cancelled) error = %v", err)
+	}
+	if later.CreatorID != 7 || later.Status != core.SchedulePending {
+		t.Fatalf("ScheduleText() = %+v", later)
+	}
+	if err := service.CancelScheduled(ctx, 2002, cancelled.ID); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("CancelScheduled(other thread) = %v, want ErrMessageNotFound", err)
+	}
+	if err := service.CancelScheduled(ctx, 1001, cancelled.ID); err != nil {
+		t.Fatalf("CancelScheduled() error = %v", err)
+	}
+
+	due, err := service.ScheduleText(ctx, core.SendTextRequest{ThreadID: 1001, Text: "now"}, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("ScheduleText(now) error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		item, err := store.GetScheduled(ctx, due.ID)
+		if err != nil {
+			t.Fatalf("GetScheduled() error = %v", err)
+		}
+		if item.Status == core.ScheduleSent {
+			if item.MessageID != "m1" {
+				t.Fatalf("sent item = %+v, want message m1", item)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("due message not sent: %+v", item)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pending, err := service.ListScheduled(ctx, 1001)
+	if err != nil {
+		t.Fatalf("ListScheduled() error = %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != later.ID {
+		t.Fatalf("ListScheduled() = %+v, want only #%d", pending, later.ID)
+	}
+
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(transport.textReqs) != 1 || transport.textReqs[0].Text != "now" {
+		t.Fatalf("sent %+v, want only the due message", transport.textReqs)
+	}
+}
+
+func TestSchedulerWaitsForQueuedDelivery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenSQLiteStore(filepath.Join(dir, "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	transport := &fakeTransport{
+		selfID:       42,
+		nextTextResp: &core.MessageRecord{MessageID: "m1", ThreadID: 1001, SenderID: 42},
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	defer service.Close()
+	if err := service.EnableOutbox(store, filepath.Join(dir, "outbox")); err != nil {
+		t.Fatalf("EnableOutbox() error = %v", err)
+	}
+	if err := service.EnableScheduler(store, filepath.Join(dir, "scheduled")); err != nil {
+		t.Fatalf("EnableScheduler() error = %v", err)
+	}
+
+	// Disconnected, the due message only reaches the outbox.
+	due, err := service.ScheduleText(ctx, core.SendTextRequest{ThreadID: 1001, Text: "now"}, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("ScheduleText() error = %v", err)
+	}
+	waitFor := func(status core.ScheduleStatus) *ScheduledItem {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			item, err := store.GetScheduled(ctx, due.ID)
+			if err != nil {
+				t.Fatalf("GetScheduled() error = %v", err)
+			}
+			if item.Status == status {
+				return item
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("scheduled message = %+v, want %s", item, status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	queued := waitFor(core.ScheduleQueued)
+	if queued.OutboxID == 0 || queued.MessageID != "" {
+		t.Fatalf("queued item = %+v, want an outbox ID and no message", queued)
+	}
+
+	service.NotifyReady()
+	if sent := waitFor(core.ScheduleSent); sent.MessageID != "m1" || sent.OutboxID != queued.OutboxID {
+		t.Fatalf("sent item = %+v, want message m1", sent)
+	}
+}
+
+func TestSchedulerDoesNotResendDeliveredParts(t *testing.T) {
+	ctx := core.WithRequester(context.Background(), 7)
+	dir := t.TempDir()
+	store, err := OpenSQLiteStore(filepath.Join(dir, "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+
+	transport := &fakeTransport{
+		selfID:       42,
+		nextTextResp: &core.MessageRecord{MessageID: "m1", ThreadID: 1001, SenderID: 42},
+		textErr:      errors.New("socket closed"),
+		textErrAt:    2,
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	service.SetMaxTextLength(10)
+	if err := service.EnableScheduler(store, filepath.Join(dir, "scheduled")); err != nil {
+		t.Fatalf("EnableScheduler() error = %v", err)
+	}
+
+	due, err := service.ScheduleText(ctx, core.SendTextRequest{ThreadID: 1001, Text: "aaaa bbbb\ncccc dddd"}, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("ScheduleText() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		item, err := store.GetScheduled(ctx, due.ID)
+		if err != nil {
+			t.Fatalf("GetScheduled() error = %v", err)
+		}
+		if item.Status == core.ScheduleSent {
+			if item.MessageID != "m1" || item.LastError == "" || item.Attempts != 1 {
+				t.Fatalf("partly sent item = %+v, want sent as m1 with the error kept", item)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("partly sent message not settled: %+v", item)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := service.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(transport.textReqs) != 2 {
+		t.Fatalf("sent %d parts, want the 2 of one attempt: %+v", len(transport.textReqs), transport.textReqs)
+	}
+}
@@ -0,0 +1,40 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"mybot/internal/core"
+)
+
+// ErrEmptySearch is returned for a search query without any words.
+var ErrEmptySearch = errors.New("search query has no words")
+
+// SearchStore looks up messages in the full-text index.
+type SearchStore interface {
+	SearchMessages(ctx context.Context, threadID int64, query string, filters core.SearchFilters) ([]*core.MessageRecord, error)
+}
+
+// EnableSearch serves SearchMessages from store, whose index is kept up to
+// date as messages are written.
+func (s *Service) EnableSearch(store SearchStore) {
+	s.search = store
+}
+
+// SearchMessages returns the messages of threadID matching every word of
+// query, accents and case ignored, within filters. It returns
+// ErrEmptySearch for a query without words and ErrInvalidRequest for a time
+// range that ends before it starts.
+func (s *Service) SearchMessages(ctx context.Context, threadID int64, query string, filters core.SearchFilters) ([]*core.MessageRecord, error) {
+	if s.search == nil {
+		return nil, ErrSearchDisabled
+	}
+	if searchMatch(query) == "" {
+		return nil, ErrEmptySearch
+	}
+	if !filters.Since.IsZero() && !filters.Until.IsZero() && !filters.Until.After(filters.Since) {
+		return nil, ErrInvalidRequest
+	}
+	return s.search.SearchMessages(ctx, threadID, strings.TrimSpace(query), filters)
+}
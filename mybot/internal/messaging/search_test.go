@@ -0,0 +1,100 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+func TestSearchMessagesThroughWriteBatcher(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	batched := NewBatchedStore(store, zerolog.Nop(), 10, 10, 5)
+	service := NewService(zerolog.Nop(), batched, func() int64 { return 42 }, func() Transport { return nil }, nil)
+	defer service.Close()
+
+	if _, err := service.SearchMessages(ctx, 1001, "phở", core.SearchFilters{}); !errors.Is(err, ErrSearchDisabled) {
+		t.Fatalf("SearchMessages() before EnableSearch error = %v, want ErrSearchDisabled", err)
+	}
+	service.EnableSearch(store)
+
+	base := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, m := range []*core.MessageRecord{
+		{MessageID: "m1", ThreadID: 1001, SenderID: 7, Text: "Tối nay đi ăn phở không?"},
+		{MessageID: "m2", ThreadID: 1001, SenderID: 8, Text: "Phở Hà Nội ngon nhất", HasMedia: true},
+		{MessageID: "m3", ThreadID: 1001, SenderID: 42, Text: "phở bò", IsFromBot: true},
+		{MessageID: "m4", ThreadID: 2002, SenderID: 7, Text: "ĐI ĂN PHỞ"},
+		{MessageID: "m5", ThreadID: 1001, SenderID: 7, Text: "đang đợi phở"},
+		{MessageID: "m6", ThreadID: 1001, SenderID: 9, Text: "bún chả"},
+	} {
+		m.TimestampMs = base.Add(time.Duration(i) * time.Hour).UnixMilli()
+		if err := batched.UpsertMessage(ctx, m); err != nil {
+			t.Fatalf("UpsertMessage(%s) error = %v", m.MessageID, err)
+		}
+	}
+
+	search := func(threadID int64, query string, f core.SearchFilters) []string {
+		t.Helper()
+		results, err := service.SearchMessages(ctx, threadID, query, f)
+		if err != nil {
+			t.Fatalf("SearchMessages(%q) error = %v", query, err)
+		}
+		ids := make([]string, len(results))
+		for i, r := range results {
+			ids[i] = r.MessageID
+		}
+		return ids
+	}
+	tests := []struct {
+		threadID int64
+		query    string
+		filters  core.SearchFilters
+		want     []string
+	}{
+		{1001, "pho", core.SearchFilters{}, []string{"m5", "m2", "m1"}},
+		{1001, "PHỞ", core.SearchFilters{}, []string{"m5", "m2", "m1"}},
+		{1001, "di an", core.SearchFilters{}, []string{"m1"}},
+		{1001, "dang doi", core.SearchFilters{}, []string{"m5"}},
+		{1001, "đợi", core.SearchFilters{}, []string{"m5"}},
+		{1001, "ha no", core.SearchFilters{}, []string{"m2"}}, // prefixes
+		{0, "di an pho", core.SearchFilters{}, []string{"m4", "m1"}},
+		{1001, "pho", core.SearchFilters{SenderID: 7}, []string{"m5", "m1"}},
+		{1001, "pho", core.SearchFilters{HasMedia: true}, []string{"m2"}},
+		{1001, "pho", core.SearchFilters{Since: base.Add(time.Hour), Until: base.Add(4 * time.Hour)}, []string{"m2"}},
+		{1001, "pho", core.SearchFilters{Limit: 1}, []string{"m5"}},
+		{1001, "pizza", core.SearchFilters{}, nil},
+	}
+	for _, tt := range tests {
+		if got := search(tt.threadID, tt.query, tt.filters); !slices.Equal(got, tt.want) {
+			t.Errorf("SearchMessages(%d, %q, %+v) = %v, want %v", tt.threadID, tt.query, tt.filters, got, tt.want)
+		}
+	}
+
+	// Edits replace the indexed text; recalled messages drop out.
+	if err := batched.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m1", ThreadID: 1001, SenderID: 7, Text: "Tối nay ăn bún", IsEdited: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := batched.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m2", ThreadID: 1001, SenderID: 8, IsRecalled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(1001, "pho", core.SearchFilters{}); !slices.Equal(got, []string{"m5"}) {
+		t.Fatalf("after edit and recall = %v, want [m5]", got)
+	}
+	if got := search(1001, "bun", core.SearchFilters{}); !slices.Equal(got, []string{"m6", "m1"}) {
+		t.Fatalf("edited text search = %v, want [m6 m1]", got)
+	}
+
+	if _, err := service.SearchMessages(ctx, 1001, " ?! ", core.SearchFilters{}); !errors.Is(err, ErrEmptySearch) {
+		t.Fatalf("SearchMessages(punctuation) error = %v, want ErrEmptySearch", err)
+	}
+}
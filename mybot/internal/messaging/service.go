@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"sync"
 	"time"
 
@@ -23,6 +24,20 @@ type Service struct {
 	transportFactory func() Transport
 	clientFactory    func() *messagix.Client
 	rateLimiter      *RateLimiter
+	maxTextLength    int
+	outbox           *Outbox
+	scheduler        *Scheduler
+	reminders        *Reminders
+	broadcaster      *Broadcaster
+	polls            *Polls
+	moderator        *Moderator
+	bans             *Bans
+	search           SearchStore
+	stats            StatsStore
+	statsBackfill    *StatsBackfill
+	retention        *Retention
+	archive          *AttachmentArchive
+	locations        func(threadID int64) *time.Location
 
 	refreshMu            sync.Mutex
 	lastMetadataRefresh  time.Time
@@ -31,9 +46,9 @@ type Service struct {
 
 func NewService(log zerolog.Logger, store Store, selfIDProvider func() int64, transportFactory func() Transport, clientFactory func() *messagix.Client, rateLimiterOpts ...RateLimiterOpt) *Service {
 	tracker := NewTracker()
-	rl := NewRateLimiter(30, 10) // defaults
+	limits := DefaultSendLimits()
 	for _, opt := range rateLimiterOpts {
-		opt(rl)
+		opt(&limits)
 	}
 	return &Service{
 		log:                  log,
@@ -42,18 +57,37 @@ func NewService(log zerolog.Logger, store Store, selfIDProvider func() int64, tr
 		tracker:              tracker,
 		transportFactory:     transportFactory,
 		clientFactory:        clientFactory,
-		rateLimiter:          rl,
+		rateLimiter:          NewRateLimiter(limits),
 		metadataRefreshEvery: 60 * time.Second,
+		maxTextLength:        DefaultMaxTextLength,
 	}
 }
 
 // RateLimiterOpt configures the rate limiter on the service.
-type RateLimiterOpt func(*RateLimiter)
+type RateLimiterOpt func(*SendLimits)
 
-// WithRateLimit sets the rate limiter parameters.
+// WithRateLimit sets the global rate limit.
 func WithRateLimit(ratePerSec, burst int) RateLimiterOpt {
-	return func(rl *RateLimiter) {
-		*rl = *NewRateLimiter(ratePerSec, burst)
+	return func(l *SendLimits) {
+		l.GlobalPerSecond = ratePerSec
+		l.GlobalBurst = burst
+	}
+}
+
+// WithThreadRateLimit sets the per-thread rate limit.
+func WithThreadRateLimit(perMinute, burst int) RateLimiterOpt {
+	return func(l *SendLimits) {
+		l.ThreadPerMinute = perMinute
+		l.ThreadBurst = burst
+	}
+}
+
+// WithUserRateLimit sets the per-user rate limit, applied to sends made on
+// behalf of a command's sender.
+func WithUserRateLimit(perMinute, burst int) RateLimiterOpt {
+	return func(l *SendLimits) {
+		l.UserPerMinute = perMinute
+		l.UserBurst = burst
 	}
 }
 
@@ -62,6 +96,31 @@ func (s *Service) Tracker() *Tracker {
 }
 
 func (s *Service) Close() error {
+	if s.retention != nil {
+		s.retention.Close()
+	}
+	if s.archive != nil {
+		s.archive.Close()
+	}
+	if s.statsBackfill != nil {
+		s.statsBackfill.Close()
+	}
+	if s.scheduler != nil {
+		s.scheduler.Close()
+	}
+	if s.reminders != nil {
+		s.reminders.Close()
+	}
+	if s.broadcaster != nil {
+		s.broadcaster.Close()
+	}
+	if s.polls != nil {
+		s.polls.Close()
+	}
+	if s.outbox != nil {
+		s.outbox.Close()
+	}
+	s.rateLimiter.Close()
 	return s.store.Close()
 }
 
@@ -76,6 +135,14 @@ func (s *Service) ObserveTable(ctx context.Context, tbl *table.LSTable, mode Pro
 			s.tracker.NotifyEdit(rec)
 		}
 	}
+	if s.polls != nil {
+		for pollID, threadID := range result.NewPolls {
+			s.polls.claim(ctx, pollID, threadID)
+		}
+	}
+	if s.archive != nil {
+		s.archive.enqueue(result.Attachments)
+	}
 	if mode == FullEvents {
 		s.refreshMissingMetadata(result)
 	}
@@ -90,8 +157,75 @@ func (s *Service) SelfID() int64 {
 	return transport.GetSelfID()
 }
 
+// SetMaxTextLength sets the size, in UTF-16 code units, above which SendText
+// splits text into several messages. n <= 0 disables splitting.
+func (s *Service) SetMaxTextLength(n int) {
+	s.maxTextLength = n
+}
+
+// SetThreadLocations sets how ThreadLocation resolves a thread's time zone.
+func (s *Service) SetThreadLocations(locations func(threadID int64) *time.Location) {
+	s.locations = locations
+}
+
+// ThreadLocation returns the time zone of threadID, or time.Local when none
+// is configured.
+func (s *Service) ThreadLocation(threadID int64) *time.Location {
+	if s.locations != nil {
+		if loc := s.locations(threadID); loc != nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// SendText sends req.Text, splitting it into several ordered messages when it
+// is longer than the configured maximum. Only the first part replies to
+// req.ReplyTo; mentions go with the part that contains them. The record of the
+// first part is returned. A caller's OTID is shifted by one per part, so a
+// retried split send reuses the same ID for each part.
 func (s *Service) SendText(ctx context.Context, req core.SendTextRequest) (*core.MessageRecord, error) {
-	if err := s.rateLimiter.Wait(ctx); err != nil {
+	chunks := splitChunks(req.Text, req.Mentions, s.maxTextLength)
+	if len(chunks) == 1 {
+		return s.sendOrQueueText(ctx, req)
+	}
+	var first *core.MessageRecord
+	for i, chunk := range chunks {
+		part := core.SendTextRequest{ThreadID: req.ThreadID, Text: chunk.text, Mentions: chunk.mentions}
+		if req.OTID != 0 {
+			part.OTID = req.OTID + int64(i)
+		}
+		if i == 0 {
+			part.ReplyTo = req.ReplyTo
+		}
+		rec, err := s.sendOrQueueText(ctx, part)
+		if err != nil {
+			return first, fmt.Errorf("send part %d/%d: %w", i+1, len(chunks), err)
+		}
+		if i == 0 {
+			first = rec
+		}
+	}
+	return first, nil
+}
+
+// sendOrQueueText sends req now, or queues it in the outbox when the
+// transport is down or the thread already has queued messages. A send the
+// transport fails is queued too, under the OTID it was tried with.
+func (s *Service) sendOrQueueText(ctx context.Context, req core.SendTextRequest) (*core.MessageRecord, error) {
+	if s.shouldQueue(ctx, req.ThreadID) {
+		return s.outbox.QueueText(ctx, req)
+	}
+	req.OTID = s.sendOTID(req.OTID)
+	rec, err := s.sendText(ctx, req)
+	if s.shouldRequeue(req.ThreadID, err) {
+		return s.outbox.QueueText(context.WithoutCancel(ctx), req)
+	}
+	return rec, err
+}
+
+func (s *Service) sendText(ctx context.Context, req core.SendTextRequest) (*core.MessageRecord, error) {
+	if err := s.rateLimiter.Wait(ctx, req.ThreadID); err != nil {
 		return nil, fmt.Errorf("rate limited: %w", err)
 	}
 	transport, err := s.transport()
@@ -100,13 +234,28 @@ func (s *Service) SendText(ctx context.Context, req core.SendTextRequest) (*core
 	}
 	rec, err := transport.SendText(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, &sendFailure{err}
 	}
 	return s.persistSentMessage(ctx, rec, transport.GetSelfID())
 }
 
+// SendMedia sends req, or queues it in the outbox (copying the media) when
+// the transport is down, the thread already has queued messages or the
+// transport fails the send.
 func (s *Service) SendMedia(ctx context.Context, req core.SendMediaRequest) (*core.MessageRecord, error) {
-	if err := s.rateLimiter.Wait(ctx); err != nil {
+	if s.shouldQueue(ctx, req.ThreadID) {
+		return s.outbox.QueueMedia(ctx, req)
+	}
+	req.OTID = s.sendOTID(req.OTID)
+	rec, err := s.sendMedia(ctx, req)
+	if s.shouldRequeue(req.ThreadID, err) {
+		return s.outbox.QueueMedia(context.WithoutCancel(ctx), req)
+	}
+	return rec, err
+}
+
+func (s *Service) sendMedia(ctx context.Context, req core.SendMediaRequest) (*core.MessageRecord, error) {
+	if err := s.rateLimiter.Wait(ctx, req.ThreadID); err != nil {
 		return nil, fmt.Errorf("rate limited: %w", err)
 	}
 	transport, err := s.transport()
@@ -115,7 +264,7 @@ func (s *Service) SendMedia(ctx context.Context, req core.SendMediaRequest) (*co
 	}
 	rec, err := transport.SendMediaMessage(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, &sendFailure{err}
 	}
 	return s.persistSentMessage(ctx, rec, transport.GetSelfID())
 }
@@ -170,8 +319,12 @@ func (s *Service) EditText(ctx context.Context, messageID, newText string) (*cor
 	if existing.SenderID != 0 && rec.SenderID == 0 {
 		rec.SenderID = existing.SenderID
 	}
+	nowMs := time.Now().UnixMilli()
+	if err := recordEditVersions(ctx, s.store, existing, rec.Text, nowMs); err != nil {
+		return nil, err
+	}
 	rec.CreatedAtUnixMs = existing.CreatedAtUnixMs
-	rec.UpdatedAtUnixMs = time.Now().UnixMilli()
+	rec.UpdatedAtUnixMs = nowMs
 	rec.IsFromBot = existing.IsFromBot
 	if err := s.store.UpsertMessage(ctx, rec); err != nil {
 		return nil, err
@@ -205,6 +358,127 @@ func (s *Service) Recall(ctx context.Context, messageID string) error {
 	return s.store.ClearLastBotMessage(ctx, rec.ThreadID, rec.MessageID)
 }
 
+// Forward forwards req.MessageID into req.ThreadID, or queues it like
+// SendText. The stored copy takes the text and attachments of the original
+// when the original is in the store.
+func (s *Service) Forward(ctx context.Context, req core.ForwardRequest) (*core.MessageRecord, error) {
+	if req.ThreadID == 0 || req.MessageID == "" {
+		return nil, ErrInvalidRequest
+	}
+	if s.shouldQueue(ctx, req.ThreadID) {
+		return s.outbox.QueueForward(ctx, req)
+	}
+	req.OTID = s.sendOTID(req.OTID)
+	rec, err := s.forward(ctx, req)
+	if s.shouldRequeue(req.ThreadID, err) {
+		return s.outbox.QueueForward(context.WithoutCancel(ctx), req)
+	}
+	return rec, err
+}
+
+func (s *Service) forward(ctx context.Context, req core.ForwardRequest) (*core.MessageRecord, error) {
+	if err := s.rateLimiter.Wait(ctx, req.ThreadID); err != nil {
+		return nil, fmt.Errorf("rate limited: %w", err)
+	}
+	transport, err := s.transport()
+	if err != nil {
+		return nil, err
+	}
+	rec, err := transport.Forward(ctx, req)
+	if err != nil {
+		return nil, &sendFailure{err}
+	}
+	if rec != nil {
+		if original, err := s.store.GetMessage(ctx, req.MessageID); err == nil && original != nil {
+			if rec.Text == "" {
+				rec.Text = original.Text
+			}
+			if len(rec.Attachments) == 0 {
+				rec.Attachments = original.Attachments
+			}
+			rec.HasMedia = rec.HasMedia || original.HasMedia
+		}
+	}
+	return s.persistSentMessage(ctx, rec, transport.GetSelfID())
+}
+
+// SendSticker sends req, or queues it like SendText.
+func (s *Service) SendSticker(ctx context.Context, req core.SendStickerRequest) (*core.MessageRecord, error) {
+	if req.ThreadID == 0 || req.StickerID == 0 {
+		return nil, ErrInvalidRequest
+	}
+	if s.shouldQueue(ctx, req.ThreadID) {
+		return s.outbox.QueueSticker(ctx, req)
+	}
+	req.OTID = s.sendOTID(req.OTID)
+	rec, err := s.sendSticker(ctx, req)
+	if s.shouldRequeue(req.ThreadID, err) {
+		return s.outbox.QueueSticker(context.WithoutCancel(ctx), req)
+	}
+	return rec, err
+}
+
+func (s *Service) sendSticker(ctx context.Context, req core.SendStickerRequest) (*core.MessageRecord, error) {
+	if err := s.rateLimiter.Wait(ctx, req.ThreadID); err != nil {
+		return nil, fmt.Errorf("rate limited: %w", err)
+	}
+	transport, err := s.transport()
+	if err != nil {
+		return nil, err
+	}
+	rec, err := transport.SendSticker(ctx, req)
+	if err != nil {
+		return nil, &sendFailure{err}
+	}
+	return s.persistSentMessage(ctx, rec, transport.GetSelfID())
+}
+
+// SendExternalMedia sends req, or queues it like SendText. Only http(s)
+// URLs are accepted.
+func (s *Service) SendExternalMedia(ctx context.Context, req core.SendExternalMediaRequest) (*core.MessageRecord, error) {
+	if req.ThreadID == 0 || !isHTTPURL(req.URL) {
+		return nil, ErrInvalidRequest
+	}
+	if s.shouldQueue(ctx, req.ThreadID) {
+		return s.outbox.QueueExternalMedia(ctx, req)
+	}
+	req.OTID = s.sendOTID(req.OTID)
+	rec, err := s.sendExternalMedia(ctx, req)
+	if s.shouldRequeue(req.ThreadID, err) {
+		return s.outbox.QueueExternalMedia(context.WithoutCancel(ctx), req)
+	}
+	return rec, err
+}
+
+func (s *Service) sendExternalMedia(ctx context.Context, req core.SendExternalMediaRequest) (*core.MessageRecord, error) {
+	if err := s.rateLimiter.Wait(ctx, req.ThreadID); err != nil {
+		return nil, fmt.Errorf("rate limited: %w", err)
+	}
+	transport, err := s.transport()
+	if err != nil {
+		return nil, err
+	}
+	rec, err := transport.SendExternalMedia(ctx, req)
+	if err != nil {
+		return nil, &sendFailure{err}
+	}
+	return s.persistSentMessage(ctx, rec, transport.GetSelfID())
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// SetTyping starts or stops the typing indicator in a thread.
+func (s *Service) SetTyping(ctx context.Context, threadID int64, isTyping, isGroup bool) error {
+	transport, err := s.transport()
+	if err != nil {
+		return err
+	}
+	return transport.SendTypingIndicator(ctx, threadID, isTyping, isGroup)
+}
+
 func (s *Service) GetMessage(ctx context.Context, messageID string) (*core.MessageRecord, error) {
 	return s.store.GetMessage(ctx, messageID)
 }
@@ -235,6 +509,21 @@ func (s *Service) ListThreadMessages(ctx context.Context, threadID int64, limit
 	return s.store.ListThreadMessages(ctx, threadID, limit, beforeMessageID)
 }
 
+func (s *Service) GetEditHistory(ctx context.Context, messageID string) ([]*core.MessageEdit, error) {
+	rec, err := s.store.GetMessage(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, ErrMessageNotFound
+	}
+	edits, err := s.store.ListMessageEdits(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return priorVersions(edits, rec.Text), nil
+}
+
 func (s *Service) persistSentMessage(ctx context.Context, rec *core.MessageRecord, selfID int64) (*core.MessageRecord, error) {
 	if rec == nil {
 		return nil, nil
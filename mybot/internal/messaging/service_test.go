@@ -2,6 +2,8 @@ package messaging
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"path/filepath"
 	"testing"
 	"time"
@@ -14,15 +16,28 @@ import (
 type fakeTransport struct {
 	selfID        int64
 	nextTextResp  *core.MessageRecord
+	textErr       error
+	textErrAt     int // the one send, counting from 1, failing with textErr; 0 fails all
 	nextMediaResp *core.MessageRecord
 	nextEditResp  *core.MessageRecord
 	lastTextReq   core.SendTextRequest
+	textReqs      []core.SendTextRequest
 	lastMediaReq  core.SendMediaRequest
 	lastRecallID  string
+	typing        []bool
+	stickerReqs   []core.SendStickerRequest
+	externalReqs  []core.SendExternalMediaRequest
+	forwardReqs   []core.ForwardRequest
+	threadCalls   []string
+	onCreatePoll  func(threadID int64)
 }
 
 func (f *fakeTransport) SendText(_ context.Context, req core.SendTextRequest) (*core.MessageRecord, error) {
 	f.lastTextReq = req
+	f.textReqs = append(f.textReqs, req)
+	if f.textErr != nil && (f.textErrAt == 0 || f.textErrAt == len(f.textReqs)) {
+		return nil, f.textErr
+	}
 	return f.nextTextResp, nil
 }
 
@@ -40,10 +55,88 @@ func (f *fakeTransport) Recall(_ context.Context, messageID string) error {
 	return nil
 }
 
+func (f *fakeTransport) Forward(_ context.Context, req core.ForwardRequest) (*core.MessageRecord, error) {
+	f.forwardReqs = append(f.forwardReqs, req)
+	return &core.MessageRecord{MessageID: fmt.Sprintf("fwd%d", len(f.forwardReqs)), ThreadID: req.ThreadID}, nil
+}
+
+func (f *fakeTransport) SendSticker(_ context.Context, req core.SendStickerRequest) (*core.MessageRecord, error) {
+	f.stickerReqs = append(f.stickerReqs, req)
+	return &core.MessageRecord{
+		MessageID:   fmt.Sprintf("st%d", len(f.stickerReqs)),
+		ThreadID:    req.ThreadID,
+		HasMedia:    true,
+		Attachments: []core.AttachmentMeta{{AttachmentID: fmt.Sprintf("%d", req.StickerID), Kind: "sticker"}},
+	}, nil
+}
+
+func (f *fakeTransport) SendExternalMedia(_ context.Context, req core.SendExternalMediaRequest) (*core.MessageRecord, error) {
+	f.externalReqs = append(f.externalReqs, req)
+	return &core.MessageRecord{
+		MessageID:   fmt.Sprintf("ext%d", len(f.externalReqs)),
+		ThreadID:    req.ThreadID,
+		HasMedia:    true,
+		Attachments: []core.AttachmentMeta{{Kind: "external", URL: req.URL}},
+	}, nil
+}
+
+func (f *fakeTransport) SendTypingIndicator(_ context.Context, _ int64, isTyping, _ bool) error {
+	f.typing = append(f.typing, isTyping)
+	return nil
+}
+
 func (f *fakeTransport) GetSelfID() int64 {
 	return f.selfID
 }
 
+func (f *fakeTransport) threadCall(format string, args ...any) error {
+	f.threadCalls = append(f.threadCalls, fmt.Sprintf(format, args...))
+	return nil
+}
+
+func (f *fakeTransport) RenameThread(_ context.Context, threadID int64, name string) error {
+	return f.threadCall("rename %d %s", threadID, name)
+}
+
+func (f *fakeTransport) AddParticipants(_ context.Context, threadID int64, contactIDs []int64) error {
+	return f.threadCall("add %d %v", threadID, contactIDs)
+}
+
+func (f *fakeTransport) RemoveParticipant(_ context.Context, threadID, contactID int64) error {
+	return f.threadCall("remove %d %d", threadID, contactID)
+}
+
+func (f *fakeTransport) UpdateAdmin(_ context.Context, threadID, contactID int64, isAdmin int) error {
+	return f.threadCall("admin %d %d %d", threadID, contactID, isAdmin)
+}
+
+func (f *fakeTransport) ChangeNickname(_ context.Context, threadID, contactID int64, nickname string) error {
+	return f.threadCall("nick %d %d %s", threadID, contactID, nickname)
+}
+
+func (f *fakeTransport) ChangeThreadEmoji(_ context.Context, threadID int64, emoji string) error {
+	return f.threadCall("emoji %d %s", threadID, emoji)
+}
+
+func (f *fakeTransport) ChangeThreadColor(_ context.Context, threadID int64, themeFBID string) error {
+	return f.threadCall("color %d %s", threadID, themeFBID)
+}
+
+func (f *fakeTransport) SetThreadImage(_ context.Context, threadID int64, imageData []byte, filename, _ string) error {
+	return f.threadCall("image %d %s %d", threadID, filename, len(imageData))
+}
+
+func (f *fakeTransport) MuteThread(_ context.Context, threadID, muteExpireMs int64) error {
+	return f.threadCall("mute %d %d", threadID, muteExpireMs)
+}
+
+func (f *fakeTransport) CreatePoll(_ context.Context, threadID int64, question string, options []string) error {
+	if f.onCreatePoll != nil {
+		f.onCreatePoll(threadID)
+	}
+	return f.threadCall("poll %d %s %v", threadID, question, options)
+}
+
 func TestServicePersistsSentMessagesAndHistory(t *testing.T) {
 	ctx := context.Background()
 	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
@@ -130,6 +223,14 @@ func TestServicePersistsSentMessagesAndHistory(t *testing.T) {
 		t.Fatalf("EditText() = %+v", edited)
 	}
 
+	edits, err := service.GetEditHistory(ctx, "m2")
+	if err != nil {
+		t.Fatalf("GetEditHistory() error = %v", err)
+	}
+	if len(edits) != 1 || edits[0].Text != "reply" {
+		t.Fatalf("GetEditHistory() = %+v, want [reply]", edits)
+	}
+
 	if err := service.Recall(ctx, "m2"); err != nil {
 		t.Fatalf("Recall() error = %v", err)
 	}
@@ -172,3 +273,111 @@ func TestTrackerWaitForEdit(t *testing.T) {
 		t.Fatal("WaitForEdit() timed out")
 	}
 }
+
+func TestServiceSplitsLongText(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	transport := &fakeTransport{
+		selfID:       42,
+		nextTextResp: &core.MessageRecord{MessageID: "m1", ThreadID: 1001, SenderID: 42},
+	}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+	service.SetMaxTextLength(10)
+
+	_, err = service.SendText(ctx, core.SendTextRequest{
+		ThreadID: 1001,
+		Text:     "aaaa bbbb\ncccc dddd",
+		ReplyTo:  &core.ReplyTarget{MessageID: "cmd"},
+		OTID:     500,
+	})
+	if err != nil {
+		t.Fatalf("SendText() error = %v", err)
+	}
+	if len(transport.textReqs) != 2 {
+		t.Fatalf("sent %d parts, want 2: %+v", len(transport.textReqs), transport.textReqs)
+	}
+	if transport.textReqs[0].Text != "aaaa bbbb" || transport.textReqs[1].Text != "cccc dddd" {
+		t.Fatalf("parts = %q, %q", transport.textReqs[0].Text, transport.textReqs[1].Text)
+	}
+	if transport.textReqs[0].ReplyTo == nil || transport.textReqs[1].ReplyTo != nil {
+		t.Fatal("only the first part should reply")
+	}
+	if transport.textReqs[0].OTID != 500 || transport.textReqs[1].OTID != 501 {
+		t.Fatalf("part OTIDs = %d, %d, want 500, 501", transport.textReqs[0].OTID, transport.textReqs[1].OTID)
+	}
+}
+
+func TestServiceForwardsAndSendsStickersAndExternalMedia(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	transport := &fakeTransport{selfID: 42}
+	service := NewService(zerolog.Nop(), store, func() int64 { return 42 }, func() Transport { return transport }, nil)
+
+	original := &core.MessageRecord{
+		MessageID:   "orig",
+		ThreadID:    1001,
+		SenderID:    7,
+		Text:        "xem cái này",
+		HasMedia:    true,
+		Attachments: []core.AttachmentMeta{{AttachmentID: "99", Kind: "blob:2"}},
+	}
+	if err := store.UpsertMessage(ctx, original); err != nil {
+		t.Fatalf("UpsertMessage() error = %v", err)
+	}
+
+	fwd, err := service.Forward(ctx, core.ForwardRequest{ThreadID: 2002, MessageID: "orig"})
+	if err != nil {
+		t.Fatalf("Forward() error = %v", err)
+	}
+	stored, err := store.GetMessage(ctx, fwd.MessageID)
+	if err != nil || stored == nil {
+		t.Fatalf("GetMessage(%q) = %+v, %v", fwd.MessageID, stored, err)
+	}
+	if stored.ThreadID != 2002 || stored.Text != "xem cái này" || !stored.HasMedia || len(stored.Attachments) != 1 || !stored.IsFromBot {
+		t.Fatalf("forwarded record = %+v", stored)
+	}
+
+	sticker, err := service.SendSticker(ctx, core.SendStickerRequest{ThreadID: 1001, StickerID: 369239263222822, ReplyTo: &core.ReplyTarget{MessageID: "orig"}})
+	if err != nil {
+		t.Fatalf("SendSticker() error = %v", err)
+	}
+	if last, _ := service.GetLastBotMessage(ctx, 1001); last == nil || last.MessageID != sticker.MessageID {
+		t.Fatalf("GetLastBotMessage() = %+v, want sticker %q", last, sticker.MessageID)
+	}
+	if got := transport.stickerReqs[0]; got.StickerID != 369239263222822 || got.ReplyTo == nil || got.ReplyTo.MessageID != "orig" {
+		t.Fatalf("sticker request = %+v", got)
+	}
+
+	gif := "https://media.giphy.com/media/abc/giphy.gif"
+	ext, err := service.SendExternalMedia(ctx, core.SendExternalMediaRequest{ThreadID: 1001, URL: gif})
+	if err != nil {
+		t.Fatalf("SendExternalMedia() error = %v", err)
+	}
+	stored, err = store.GetMessage(ctx, ext.MessageID)
+	if err != nil || stored == nil || len(stored.Attachments) != 1 || stored.Attachments[0].URL != gif {
+		t.Fatalf("external media record = %+v, %v", stored, err)
+	}
+
+	invalid := []error{}
+	_, err = service.SendExternalMedia(ctx, core.SendExternalMediaRequest{ThreadID: 1001, URL: "file:///etc/passwd"})
+	invalid = append(invalid, err)
+	_, err = service.SendSticker(ctx, core.SendStickerRequest{ThreadID: 1001})
+	invalid = append(invalid, err)
+	_, err = service.Forward(ctx, core.ForwardRequest{ThreadID: 1001})
+	invalid = append(invalid, err)
+	for i, err := range invalid {
+		if !errors.Is(err, ErrInvalidRequest) {
+			t.Fatalf("invalid request %d error = %v, want ErrInvalidRequest", i, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Snapshotter is a Store that can copy its database file while in use.
+type Snapshotter interface {
+	Snapshot(ctx context.Context, path string) error
+}
+
+// CheckSQLiteFile opens the SQLite database at path read-only, runs an
+// integrity check and returns its schema version. A database written by a
+// newer build fails with ErrSchemaTooNew.
+func CheckSQLiteFile(ctx context.Context, path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, `PRAGMA integrity_check(1)`).Scan(&result); err != nil {
+		return 0, fmt.Errorf("integrity check: %w", err)
+	}
+	if result != "ok" {
+		return 0, fmt.Errorf("integrity check: %s", result)
+	}
+	version, fresh, err := readSchemaVersion(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	if fresh {
+		return 0, errors.New("database has no tables")
+	}
+	if latest := LatestSchemaVersion(); version > latest {
+		return version, fmt.Errorf("%w: v%d, this build knows v%d", ErrSchemaTooNew, version, latest)
+	}
+	return version, nil
+}
+
+// SQLiteFileKeyID returns the ID of the key the messages in the SQLite
+// database at path are sealed with, or "" when they aren't.
+func SQLiteFileKeyID(ctx context.Context, path string) (string, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var hasMeta int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'meta'`).Scan(&hasMeta); err != nil {
+		return "", fmt.Errorf("inspect schema: %w", err)
+	}
+	if hasMeta == 0 {
+		return "", nil
+	}
+	var id string
+	err = db.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = 'encryption_key_id'`).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return id, err
+}
+
+// CheckBoltFile opens the bolt database at path read-only and checks its
+// page structure.
+func CheckBoltFile(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{ReadOnly: true, Timeout: 2 * time.Second})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		var errs []error
+		for err := range tx.Check() {
+			errs = append(errs, err)
+		}
+		if tx.Bucket(messagesBucket) == nil {
+			errs = append(errs, errors.New("no messages bucket"))
+		}
+		return errors.Join(errs...)
+	})
+}
@@ -0,0 +1,88 @@
+package messaging
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mybot/internal/core"
+)
+
+func TestSQLiteSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenSQLiteStore(filepath.Join(dir, "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+	if err := store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m1", ThreadID: 1, SenderID: 2, Text: "chào", TimestampMs: 1000}); err != nil {
+		t.Fatalf("UpsertMessage() error = %v", err)
+	}
+
+	snap := filepath.Join(dir, "snap.sqlite")
+	if err := store.Snapshot(ctx, snap); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	version, err := CheckSQLiteFile(ctx, snap)
+	if err != nil || version != LatestSchemaVersion() {
+		t.Fatalf("CheckSQLiteFile() = %d, %v; want v%d", version, err, LatestSchemaVersion())
+	}
+	copied, err := OpenSQLiteStore(snap)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore(snapshot) error = %v", err)
+	}
+	defer copied.Close()
+	if m, err := copied.GetMessage(ctx, "m1"); err != nil || m == nil || m.Text != "chào" {
+		t.Fatalf("snapshot GetMessage() = %+v, %v", m, err)
+	}
+
+	if err := store.Snapshot(ctx, snap); err == nil {
+		t.Error("Snapshot() over an existing file error = nil")
+	}
+	junk := filepath.Join(dir, "junk.sqlite")
+	if err := os.WriteFile(junk, []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckSQLiteFile(ctx, junk); err == nil {
+		t.Error("CheckSQLiteFile(junk) error = nil")
+	}
+}
+
+func TestBoltSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := OpenBoltStore(filepath.Join(dir, "messages.bolt"))
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+	defer store.Close()
+	if err := store.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m1", ThreadID: 1, SenderID: 2, Text: "chào", TimestampMs: 1000}); err != nil {
+		t.Fatalf("UpsertMessage() error = %v", err)
+	}
+
+	snap := filepath.Join(dir, "snap.bolt")
+	if err := store.Snapshot(ctx, snap); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if err := CheckBoltFile(snap); err != nil {
+		t.Fatalf("CheckBoltFile() error = %v", err)
+	}
+	copied, err := OpenBoltStore(snap)
+	if err != nil {
+		t.Fatalf("OpenBoltStore(snapshot) error = %v", err)
+	}
+	defer copied.Close()
+	if m, err := copied.GetMessage(ctx, "m1"); err != nil || m == nil || m.Text != "chào" {
+		t.Fatalf("snapshot GetMessage() = %+v, %v", m, err)
+	}
+
+	junk := filepath.Join(dir, "junk.bolt")
+	if err := os.WriteFile(junk, make([]byte, 8192), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckBoltFile(junk); err == nil {
+		t.Error("CheckBoltFile(junk) error = nil")
+	}
+}
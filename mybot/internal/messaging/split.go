@@ -0,0 +1,103 @@
+package messaging
+
+import (
+	"unicode/utf16"
+
+	"mybot/internal/core"
+)
+
+// DefaultMaxTextLength is the largest text, in UTF-16 code units, sent as a
+// single message. Messenger accepts more, but collapses long messages behind
+// "See more" and starts rejecting them well before its documented limit.
+const DefaultMaxTextLength = 2000
+
+// textChunk is one piece of a split message. start is the chunk's offset in
+// the original text, in UTF-16 code units.
+type textChunk struct {
+	text     string
+	start    int
+	mentions []core.Mention
+}
+
+// SplitText splits text into pieces of at most limit UTF-16 code units,
+// preferring to break at line boundaries, then at spaces. The separator a
+// piece is broken at is dropped. Text that already fits is returned as is.
+func SplitText(text string, limit int) []string {
+	chunks := splitChunks(text, nil, limit)
+	out := make([]string, len(chunks))
+	for i, c := range chunks {
+		out[i] = c.text
+	}
+	return out
+}
+
+// splitChunks splits text like SplitText and assigns every mention to the
+// chunk containing it, rebased to that chunk's start. Breaks never fall
+// inside a mention unless the mention alone is longer than limit.
+func splitChunks(text string, mentions []core.Mention, limit int) []textChunk {
+	units := utf16.Encode([]rune(text))
+	if limit <= 0 || len(units) <= limit {
+		return []textChunk{{text: text, mentions: mentions}}
+	}
+
+	var chunks []textChunk
+	start := 0
+	for start < len(units) {
+		end := len(units)
+		next := end
+		if end-start > limit {
+			end, next = findBreak(units, start, start+limit, mentions)
+		}
+		chunk := textChunk{text: string(utf16.Decode(units[start:end])), start: start}
+		for _, m := range mentions {
+			if m.Offset >= start && m.Offset+m.Length <= end {
+				m.Offset -= start
+				chunk.mentions = append(chunk.mentions, m)
+			}
+		}
+		if chunk.text != "" {
+			chunks = append(chunks, chunk)
+		}
+		start = next
+	}
+	return chunks
+}
+
+// findBreak picks where to end the chunk that starts at start and may extend
+// up to limitEnd. It returns the chunk end and where the next chunk begins.
+func findBreak(units []uint16, start, limitEnd int, mentions []core.Mention) (end, next int) {
+	// Only break at separators in the second half of the window, so a
+	// newline near the start doesn't produce a tiny chunk.
+	floor := start + (limitEnd-start)/2
+	for _, sep := range []uint16{'\n', ' '} {
+		for i := min(limitEnd+1, len(units)); i > floor; i-- {
+			if units[i-1] == sep && !insideMention(i-1, mentions) {
+				return i - 1, i
+			}
+		}
+	}
+
+	// No separator: hard cut, moved back out of any mention or surrogate pair.
+	end = limitEnd
+	for _, m := range mentions {
+		if m.Offset > start && m.Offset < end && end < m.Offset+m.Length {
+			end = m.Offset
+		}
+	}
+	if end > start && utf16.IsSurrogate(rune(units[end-1])) && units[end-1] < 0xDC00 {
+		end--
+	}
+	if end <= start {
+		end = limitEnd
+	}
+	return end, end
+}
+
+func insideMention(pos int, mentions []core.Mention) bool {
+	for _, m := range mentions {
+		if pos >= m.Offset && pos < m.Offset+m.Length {
+			return true
+		}
+	}
+	return false
+}
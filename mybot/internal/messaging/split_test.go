@@ -0,0 +1,51 @@
+package messaging
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"mybot/internal/core"
+)
+
+func TestSplitTextPrefersLineThenWordBoundaries(t *testing.T) {
+	text := "line one\nline two is longer\nend"
+	got := SplitText(text, 20)
+	want := []string{"line one\nline two is", "longer\nend"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("SplitText() = %q, want %q", got, want)
+	}
+
+	got = SplitText("short", 20)
+	if len(got) != 1 || got[0] != "short" {
+		t.Fatalf("SplitText(short) = %q", got)
+	}
+}
+
+func TestSplitTextHardCutKeepsSurrogatePairs(t *testing.T) {
+	text := strings.Repeat("😀", 5) // 10 UTF-16 units, no separators
+	for _, part := range SplitText(text, 3) {
+		if n := len(utf16.Encode([]rune(part))); n > 3 || strings.ContainsRune(part, '�') {
+			t.Fatalf("part %q has %d units or a broken pair", part, n)
+		}
+	}
+}
+
+func TestSplitChunksRebasesMentions(t *testing.T) {
+	b := &core.MentionBuilder{}
+	b.WriteText(strings.Repeat("a ", 10)).WriteMention(7, "Nguyen Van A").WriteText(" xin chào")
+
+	chunks := splitChunks(b.Text(), b.Mentions(), 24)
+	var found bool
+	for _, c := range chunks {
+		for _, m := range c.mentions {
+			found = true
+			if name := core.MentionedText(c.text, m); name != "@Nguyen Van A" {
+				t.Fatalf("mention in chunk %q covers %q", c.text, name)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("mention lost: %+v", chunks)
+	}
+}
@@ -7,12 +7,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	_ "modernc.org/sqlite"
 
 	"mybot/internal/core"
+	"mybot/internal/encryption"
 )
 
 // txExecer is satisfied by both *sql.Tx and *sql.DB so that prepared-style
@@ -38,62 +41,23 @@ func (c connExecer) QueryRow(query string, args ...any) *sql.Row {
 }
 
 type SQLiteStore struct {
-	writeDB *sql.DB // single writer connection
-	readDB  *sql.DB // multiple reader connections (WAL)
-}
-
-const sqliteSchema = `
-CREATE TABLE IF NOT EXISTS threads (
-    thread_id        INTEGER PRIMARY KEY,
-    name             TEXT    NOT NULL DEFAULT '',
-    updated_at_ms    INTEGER NOT NULL DEFAULT 0,
-    last_activity_ms INTEGER NOT NULL DEFAULT 0,
-    deleted          INTEGER NOT NULL DEFAULT 0
-);
-
-CREATE TABLE IF NOT EXISTS users (
-    user_id       INTEGER PRIMARY KEY,
-    name          TEXT    NOT NULL DEFAULT '',
-    updated_at_ms INTEGER NOT NULL DEFAULT 0,
-    deleted       INTEGER NOT NULL DEFAULT 0
-);
-
-CREATE TABLE IF NOT EXISTS messages (
-    message_id           TEXT PRIMARY KEY,
-    thread_id            INTEGER NOT NULL DEFAULT 0,
-    sender_id            INTEGER NOT NULL DEFAULT 0,
-    sender_name_snapshot TEXT    NOT NULL DEFAULT '',
-    text                 TEXT    NOT NULL DEFAULT '',
-    reply_to_message_id  TEXT    NOT NULL DEFAULT '',
-    offline_threading_id TEXT    NOT NULL DEFAULT '',
-    is_from_bot          INTEGER NOT NULL DEFAULT 0,
-    has_media            INTEGER NOT NULL DEFAULT 0,
-    attachments_json     TEXT    NOT NULL DEFAULT '[]',
-    timestamp_ms         INTEGER NOT NULL DEFAULT 0,
-    edit_count           INTEGER NOT NULL DEFAULT 0,
-    is_edited            INTEGER NOT NULL DEFAULT 0,
-    is_recalled          INTEGER NOT NULL DEFAULT 0,
-    created_at_ms        INTEGER NOT NULL DEFAULT 0,
-    updated_at_ms        INTEGER NOT NULL DEFAULT 0,
-    recalled_at_ms       INTEGER NOT NULL DEFAULT 0
-);
-
-CREATE INDEX IF NOT EXISTS idx_messages_thread_ts
-    ON messages(thread_id, timestamp_ms, message_id);
-
-CREATE TABLE IF NOT EXISTS thread_last_bot (
-    thread_id  INTEGER PRIMARY KEY,
-    message_id TEXT NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS meta (
-    key   TEXT PRIMARY KEY,
-    value TEXT NOT NULL
-);
-`
+	writeDB   *sql.DB // single writer connection
+	readDB    *sql.DB // multiple reader connections (WAL)
+	migration MigrationReport
+
+	// keys open sealed message text; with seal, text written is sealed with
+	// their current key. See EnableEncryption. keyID mirrors the
+	// encryption_key_id in meta: only while it is set are stored values
+	// that look sealed opened, so plaintext can't pass for a sealed value.
+	keys          *encryption.Keyring
+	seal          bool
+	noSearchIndex bool
+	keyID         string
+}
 
 // OpenSQLiteStore opens a SQLite store with separate read and write connections.
 // readPoolSize controls the number of reader connections (WAL mode allows concurrent readers).
+// The schema is migrated to LatestSchemaVersion first; see Migration.
 func OpenSQLiteStore(path string, readPoolSize ...int) (*SQLiteStore, error) {
 	if path == "" {
 		return nil, fmt.Errorf("empty sqlite db path")
@@ -138,11 +102,8 @@ func OpenSQLiteStore(path string, readPoolSize ...int) (*SQLiteStore, error) {
 		}
 	}
 
-	if _, err := writeDB.ExecContext(ctx, sqliteSchema); err != nil {
-		_ = writeDB.Close()
-		return nil, fmt.Errorf("apply schema: %w", err)
-	}
-	if _, err := writeDB.ExecContext(ctx, `INSERT OR REPLACE INTO meta(key, value) VALUES('schema_version','3')`); err != nil {
+	report, err := migrate(ctx, writeDB, path)
+	if err != nil {
 		_ = writeDB.Close()
 		return nil, err
 	}
@@ -174,7 +135,18 @@ func OpenSQLiteStore(path string, readPoolSize ...int) (*SQLiteStore, error) {
 		_ = conn.Close()
 	}
 
-	return &SQLiteStore{writeDB: writeDB, readDB: readDB}, nil
+	s := &SQLiteStore{writeDB: writeDB, readDB: readDB, migration: report}
+	if s.keyID, err = s.EncryptionKeyID(); err != nil {
+		_ = readDB.Close()
+		_ = writeDB.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Migration reports the schema upgrade done when the store was opened.
+func (s *SQLiteStore) Migration() MigrationReport {
+	return s.migration
 }
 
 func (s *SQLiteStore) Close() error {
@@ -253,6 +225,82 @@ func (s *SQLiteStore) execBatchOnce(fn func(tx txExecer) error, setBusyTimeout b
 	return err
 }
 
+// writeBatch commits ops from the WriteBatcher in one transaction.
+func (s *SQLiteStore) writeBatch(ops []writeOp) error {
+	return s.ExecBatch(func(tx txExecer) error {
+		for i := range ops {
+			if err := s.execWriteOpTx(tx, &ops[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) execWriteOpTx(tx txExecer, op *writeOp) error {
+	switch op.kind {
+	case opUpsertThread:
+		return s.upsertThreadTx(tx, op.thread)
+	case opUpsertUser:
+		return s.upsertUserTx(tx, op.user)
+	case opUpsertMessage:
+		return s.upsertMessageTx(tx, op.msg)
+	case opSetLastBot:
+		return s.setLastBotMessageTx(tx, op.threadID, op.messageID)
+	case opClearLastBot:
+		return s.clearLastBotMessageTx(tx, op.threadID, op.messageID)
+	case opClearLastBotByThread:
+		return s.clearLastBotMessageByThreadTx(tx, op.threadID)
+	case opUpsertMessageEdit:
+		return s.upsertMessageEditTx(tx, op.edit)
+	default:
+		return nil
+	}
+}
+
+// schemaExecer is satisfied by *sql.DB and *sql.Tx.
+type schemaExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// ensureColumn adds column to table if an existing database predates it.
+func ensureColumn(ctx context.Context, db schemaExecer, table, column, decl string) error {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("inspect %s: %w", table, err)
+	}
+	found := false
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		if name == column {
+			found = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if found {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
 func isBusyError(err error) bool {
 	if err == nil {
 		return false
@@ -264,10 +312,12 @@ func isBusyError(err error) bool {
 // ── Threads ─────────────────────────────────────────────────────────────────
 
 const upsertThreadSQL = `
-	INSERT INTO threads(thread_id, name, updated_at_ms, last_activity_ms, deleted)
-	VALUES (?, ?, ?, ?, ?)
+	INSERT INTO threads(thread_id, name, thread_type, is_group, updated_at_ms, last_activity_ms, deleted)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(thread_id) DO UPDATE SET
 		name             = CASE WHEN excluded.name != '' THEN excluded.name ELSE threads.name END,
+		thread_type      = CASE WHEN excluded.thread_type != 0 THEN excluded.thread_type ELSE threads.thread_type END,
+		is_group         = CASE WHEN excluded.thread_type != 0 THEN excluded.is_group ELSE threads.is_group END,
 		updated_at_ms    = excluded.updated_at_ms,
 		last_activity_ms = CASE WHEN excluded.last_activity_ms > 0 THEN excluded.last_activity_ms ELSE threads.last_activity_ms END,
 		deleted          = excluded.deleted`
@@ -276,8 +326,8 @@ func (s *SQLiteStore) UpsertThread(_ context.Context, rec *core.ThreadRecord) er
 	if rec == nil || rec.ThreadID == 0 {
 		return nil
 	}
-	_, err := s.writeDB.Exec(upsertThreadSQL,
-		rec.ThreadID, rec.Name, rec.UpdatedAtUnixMs, rec.LastActivityMs, boolToInt(rec.Deleted))
+	_, err := s.writeDB.Exec(upsertThreadSQL, rec.ThreadID, rec.Name, rec.ThreadType, boolToInt(rec.IsGroup),
+		rec.UpdatedAtUnixMs, rec.LastActivityMs, boolToInt(rec.Deleted))
 	return err
 }
 
@@ -285,22 +335,83 @@ func (s *SQLiteStore) upsertThreadTx(tx txExecer, rec *core.ThreadRecord) error
 	if rec == nil || rec.ThreadID == 0 {
 		return nil
 	}
-	_, err := tx.Exec(upsertThreadSQL,
-		rec.ThreadID, rec.Name, rec.UpdatedAtUnixMs, rec.LastActivityMs, boolToInt(rec.Deleted))
+	_, err := tx.Exec(upsertThreadSQL, rec.ThreadID, rec.Name, rec.ThreadType, boolToInt(rec.IsGroup),
+		rec.UpdatedAtUnixMs, rec.LastActivityMs, boolToInt(rec.Deleted))
 	return err
 }
 
 func (s *SQLiteStore) GetThread(_ context.Context, threadID int64) (*core.ThreadRecord, error) {
-	row := s.readDB.QueryRow(`SELECT thread_id, name, updated_at_ms, last_activity_ms, deleted FROM threads WHERE thread_id = ?`, threadID)
-	rec := &core.ThreadRecord{}
-	var deleted int
-	err := row.Scan(&rec.ThreadID, &rec.Name, &rec.UpdatedAtUnixMs, &rec.LastActivityMs, &deleted)
+	row := s.readDB.QueryRow(`SELECT `+threadColumns+` FROM threads WHERE thread_id = ?`, threadID)
+	rec, err := scanThread(row)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
+	return rec, err
+}
+
+// ListThreads returns every thread not marked deleted. LastActivityMs is
+// the later of the thread's own activity time and its newest stored message.
+func (s *SQLiteStore) ListThreads(_ context.Context) ([]*core.ThreadRecord, error) {
+	return s.queryThreads(`SELECT ` + threadActivityColumns + ` FROM threads t WHERE deleted = 0 ORDER BY thread_id`)
+}
+
+// QueryThreads returns the threads q selects, most recently active first.
+// The newest message of each thread is found through idx_messages_thread_ts.
+func (s *SQLiteStore) QueryThreads(_ context.Context, q core.ThreadQuery) ([]*core.ThreadRecord, error) {
+	var where []string
+	var args []any
+	if !q.IncludeDeleted {
+		where = append(where, "deleted = 0")
+	}
+	if q.GroupsOnly {
+		where = append(where, "is_group = 1")
+	}
+	if !q.ActiveSince.IsZero() {
+		where, args = append(where, "last_activity_ms >= ?"), append(args, q.ActiveSince.UnixMilli())
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	return s.queryThreads(`SELECT `+threadColumns+`
+		FROM (SELECT `+threadActivityColumns+` FROM threads t)`+whereClause(where)+`
+		ORDER BY last_activity_ms DESC, thread_id
+		LIMIT ?`, append(args, limit)...)
+}
+
+func (s *SQLiteStore) queryThreads(query string, args ...any) ([]*core.ThreadRecord, error) {
+	rows, err := s.readDB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	var threads []*core.ThreadRecord
+	for rows.Next() {
+		rec, err := scanThread(rows)
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, rec)
+	}
+	return threads, rows.Err()
+}
+
+const threadColumns = `thread_id, name, thread_type, is_group, updated_at_ms, last_activity_ms, deleted`
+
+// threadActivityColumns is threadColumns with last_activity_ms raised to
+// the thread's newest stored message, for a query over "threads t".
+const threadActivityColumns = `thread_id, name, thread_type, is_group, updated_at_ms,
+		MAX(last_activity_ms, COALESCE((SELECT MAX(timestamp_ms) FROM messages m WHERE m.thread_id = t.thread_id), 0)) AS last_activity_ms,
+		deleted`
+
+func scanThread(row interface{ Scan(dest ...any) error }) (*core.ThreadRecord, error) {
+	rec := &core.ThreadRecord{}
+	var isGroup, deleted int
+	if err := row.Scan(&rec.ThreadID, &rec.Name, &rec.ThreadType, &isGroup, &rec.UpdatedAtUnixMs,
+		&rec.LastActivityMs, &deleted); err != nil {
+		return nil, err
+	}
+	rec.IsGroup = isGroup != 0
 	rec.Deleted = deleted != 0
 	return rec, nil
 }
@@ -308,10 +419,11 @@ func (s *SQLiteStore) GetThread(_ context.Context, threadID int64) (*core.Thread
 // ── Users ───────────────────────────────────────────────────────────────────
 
 const upsertUserSQL = `
-	INSERT INTO users(user_id, name, updated_at_ms, deleted)
-	VALUES (?, ?, ?, ?)
+	INSERT INTO users(user_id, name, name_key, updated_at_ms, deleted)
+	VALUES (?, ?, ?, ?, ?)
 	ON CONFLICT(user_id) DO UPDATE SET
 		name          = CASE WHEN excluded.name != '' THEN excluded.name ELSE users.name END,
+		name_key      = CASE WHEN excluded.name != '' THEN excluded.name_key ELSE users.name_key END,
 		updated_at_ms = excluded.updated_at_ms,
 		deleted       = excluded.deleted`
 
@@ -320,7 +432,7 @@ func (s *SQLiteStore) UpsertUser(_ context.Context, rec *core.UserRecord) error
 		return nil
 	}
 	_, err := s.writeDB.Exec(upsertUserSQL,
-		rec.UserID, rec.Name, rec.UpdatedAtUnixMs, boolToInt(rec.Deleted))
+		rec.UserID, rec.Name, userNameKey(rec.Name), rec.UpdatedAtUnixMs, boolToInt(rec.Deleted))
 	return err
 }
 
@@ -329,21 +441,56 @@ func (s *SQLiteStore) upsertUserTx(tx txExecer, rec *core.UserRecord) error {
 		return nil
 	}
 	_, err := tx.Exec(upsertUserSQL,
-		rec.UserID, rec.Name, rec.UpdatedAtUnixMs, boolToInt(rec.Deleted))
+		rec.UserID, rec.Name, userNameKey(rec.Name), rec.UpdatedAtUnixMs, boolToInt(rec.Deleted))
 	return err
 }
 
 func (s *SQLiteStore) GetUser(_ context.Context, userID int64) (*core.UserRecord, error) {
-	row := s.readDB.QueryRow(`SELECT user_id, name, updated_at_ms, deleted FROM users WHERE user_id = ?`, userID)
-	rec := &core.UserRecord{}
-	var deleted int
-	err := row.Scan(&rec.UserID, &rec.Name, &rec.UpdatedAtUnixMs, &deleted)
+	rec, err := scanUser(s.readDB.QueryRow(`SELECT `+userColumns+` FROM users WHERE user_id = ?`, userID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
+	return rec, err
+}
+
+// QueryUsers returns the users q selects, by name. The name prefix is
+// matched against name_key through idx_users_name_key.
+func (s *SQLiteStore) QueryUsers(_ context.Context, q core.UserQuery) ([]*core.UserRecord, error) {
+	var where []string
+	var args []any
+	if prefix := userNameKey(q.NamePrefix); prefix != "" {
+		// Every key starting with prefix sorts below prefix+U+10FFFF.
+		where, args = append(where, "name_key >= ? AND name_key < ?"), append(args, prefix, prefix+"\U0010FFFF")
+	}
+	if !q.IncludeDeleted {
+		where = append(where, "deleted = 0")
+	}
+	rows, err := s.readDB.Query(`SELECT `+userColumns+` FROM users`+whereClause(where)+`
+		ORDER BY name_key, user_id
+		LIMIT ?`, append(args, queryLimit(q.Limit, defaultUserQueryLimit))...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	var users []*core.UserRecord
+	for rows.Next() {
+		rec, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, rec)
+	}
+	return users, rows.Err()
+}
+
+const userColumns = `user_id, name, updated_at_ms, deleted`
+
+func scanUser(row interface{ Scan(dest ...any) error }) (*core.UserRecord, error) {
+	rec := &core.UserRecord{}
+	var deleted int
+	if err := row.Scan(&rec.UserID, &rec.Name, &rec.UpdatedAtUnixMs, &deleted); err != nil {
+		return nil, err
+	}
 	rec.Deleted = deleted != 0
 	return rec, nil
 }
@@ -354,9 +501,9 @@ const upsertMessageSQL = `
 	INSERT INTO messages(
 		message_id, thread_id, sender_id, sender_name_snapshot, text,
 		reply_to_message_id, offline_threading_id, is_from_bot, has_media,
-		attachments_json, timestamp_ms, edit_count, is_edited, is_recalled,
+		attachments_json, mentions_json, timestamp_ms, edit_count, is_edited, is_recalled,
 		created_at_ms, updated_at_ms, recalled_at_ms
-	) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+	) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
 	ON CONFLICT(message_id) DO UPDATE SET
 		thread_id            = excluded.thread_id,
 		sender_id            = excluded.sender_id,
@@ -367,6 +514,7 @@ const upsertMessageSQL = `
 		is_from_bot          = excluded.is_from_bot,
 		has_media            = excluded.has_media,
 		attachments_json     = excluded.attachments_json,
+		mentions_json        = excluded.mentions_json,
 		timestamp_ms         = excluded.timestamp_ms,
 		edit_count           = excluded.edit_count,
 		is_edited            = excluded.is_edited,
@@ -375,15 +523,29 @@ const upsertMessageSQL = `
 		updated_at_ms        = excluded.updated_at_ms,
 		recalled_at_ms       = excluded.recalled_at_ms`
 
-func messageArgs(rec *core.MessageRecord) []any {
+// messageColumns is the column list scanned by scanMessage/scanMessageRow.
+const messageColumns = `message_id, thread_id, sender_id, sender_name_snapshot, text,
+		       reply_to_message_id, offline_threading_id, is_from_bot, has_media,
+		       attachments_json, mentions_json, timestamp_ms, edit_count, is_edited, is_recalled,
+		       created_at_ms, updated_at_ms, recalled_at_ms`
+
+func (s *SQLiteStore) messageArgs(rec *core.MessageRecord) []any {
 	attachJSON, err := json.Marshal(rec.Attachments)
 	if err != nil {
 		attachJSON = []byte("[]")
 	}
+	attachments := string(attachJSON)
+	if len(rec.Attachments) > 0 {
+		attachments = s.sealText(attachments)
+	}
+	mentionsJSON, err := json.Marshal(rec.Mentions)
+	if err != nil || rec.Mentions == nil {
+		mentionsJSON = []byte("[]")
+	}
 	return []any{
-		rec.MessageID, rec.ThreadID, rec.SenderID, rec.SenderNameSnapshot, rec.Text,
+		rec.MessageID, rec.ThreadID, rec.SenderID, rec.SenderNameSnapshot, s.sealText(rec.Text),
 		rec.ReplyToMessageID, rec.OfflineThreadingID, boolToInt(rec.IsFromBot), boolToInt(rec.HasMedia),
-		string(attachJSON), rec.TimestampMs, rec.EditCount, boolToInt(rec.IsEdited), boolToInt(rec.IsRecalled),
+		attachments, string(mentionsJSON), rec.TimestampMs, rec.EditCount, boolToInt(rec.IsEdited), boolToInt(rec.IsRecalled),
 		rec.CreatedAtUnixMs, rec.UpdatedAtUnixMs, rec.RecalledAtUnixMs,
 	}
 }
@@ -392,16 +554,38 @@ func (s *SQLiteStore) UpsertMessage(_ context.Context, rec *core.MessageRecord)
 	if rec == nil || rec.MessageID == "" {
 		return nil
 	}
-	_, err := s.writeDB.Exec(upsertMessageSQL, messageArgs(rec)...)
-	return err
+	// The search index is written in the same transaction.
+	return s.ExecBatch(func(tx txExecer) error {
+		return s.upsertMessageTx(tx, rec)
+	})
 }
 
 func (s *SQLiteStore) upsertMessageTx(tx txExecer, rec *core.MessageRecord) error {
 	if rec == nil || rec.MessageID == "" {
 		return nil
 	}
-	_, err := tx.Exec(upsertMessageSQL, messageArgs(rec)...)
-	return err
+	// Stats count each message once, when it is first stored.
+	isNew := false
+	if countsInStats(rec) {
+		var one int
+		err := tx.QueryRow(`SELECT 1 FROM messages WHERE message_id = ?`, rec.MessageID).Scan(&one)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		isNew = err == sql.ErrNoRows
+	}
+	if _, err := tx.Exec(upsertMessageSQL, s.messageArgs(rec)...); err != nil {
+		return err
+	}
+	if !s.noSearchIndex {
+		if err := indexMessageTx(tx, rec); err != nil {
+			return err
+		}
+	}
+	if isNew {
+		return rollupMessageTx(tx, rec, !s.seal)
+	}
+	return nil
 }
 
 func (s *SQLiteStore) GetMessage(_ context.Context, messageID string) (*core.MessageRecord, error) {
@@ -409,10 +593,7 @@ func (s *SQLiteStore) GetMessage(_ context.Context, messageID string) (*core.Mes
 		return nil, nil
 	}
 	return s.scanMessage(s.readDB.QueryRow(`
-		SELECT message_id, thread_id, sender_id, sender_name_snapshot, text,
-		       reply_to_message_id, offline_threading_id, is_from_bot, has_media,
-		       attachments_json, timestamp_ms, edit_count, is_edited, is_recalled,
-		       created_at_ms, updated_at_ms, recalled_at_ms
+		SELECT `+messageColumns+`
 		FROM messages WHERE message_id = ?`, messageID))
 }
 
@@ -426,10 +607,7 @@ func (s *SQLiteStore) ListThreadMessages(_ context.Context, threadID int64, limi
 
 	if beforeMessageID != "" {
 		rows, err = s.readDB.Query(`
-			SELECT m.message_id, m.thread_id, m.sender_id, m.sender_name_snapshot, m.text,
-			       m.reply_to_message_id, m.offline_threading_id, m.is_from_bot, m.has_media,
-			       m.attachments_json, m.timestamp_ms, m.edit_count, m.is_edited, m.is_recalled,
-			       m.created_at_ms, m.updated_at_ms, m.recalled_at_ms
+			SELECT `+messageColumns+`
 			FROM messages m
 			WHERE m.thread_id = ?
 			  AND (m.timestamp_ms, m.message_id) < (
@@ -440,10 +618,7 @@ func (s *SQLiteStore) ListThreadMessages(_ context.Context, threadID int64, limi
 		`, threadID, beforeMessageID, limit)
 	} else {
 		rows, err = s.readDB.Query(`
-			SELECT message_id, thread_id, sender_id, sender_name_snapshot, text,
-			       reply_to_message_id, offline_threading_id, is_from_bot, has_media,
-			       attachments_json, timestamp_ms, edit_count, is_edited, is_recalled,
-			       created_at_ms, updated_at_ms, recalled_at_ms
+			SELECT `+messageColumns+`
 			FROM messages
 			WHERE thread_id = ?
 			ORDER BY timestamp_ms DESC, message_id DESC
@@ -466,6 +641,79 @@ func (s *SQLiteStore) ListThreadMessages(_ context.Context, threadID int64, limi
 	return results, rows.Err()
 }
 
+// QueryMessages returns the messages q selects. A thread, sender or
+// reply-to filter is served by its index; the others only narrow the rows
+// those indexes, or idx_messages_ts, return.
+func (s *SQLiteStore) QueryMessages(_ context.Context, q core.MessageQuery) ([]*core.MessageRecord, error) {
+	var where []string
+	var args []any
+	if q.ThreadID != 0 {
+		where, args = append(where, "thread_id = ?"), append(args, q.ThreadID)
+	}
+	if q.SenderID != 0 {
+		where, args = append(where, "sender_id = ?"), append(args, q.SenderID)
+	}
+	if q.ReplyToMessageID != "" {
+		where, args = append(where, "reply_to_message_id = ?"), append(args, q.ReplyToMessageID)
+	}
+	if !q.Since.IsZero() {
+		where, args = append(where, "timestamp_ms >= ?"), append(args, q.Since.UnixMilli())
+	}
+	if !q.Until.IsZero() {
+		where, args = append(where, "timestamp_ms < ?"), append(args, q.Until.UnixMilli())
+	}
+	if q.HasMedia {
+		where = append(where, "has_media = 1")
+	}
+	if q.ExcludeBot {
+		where = append(where, "is_from_bot = 0")
+	}
+	if q.ExcludeRecalled {
+		where = append(where, "is_recalled = 0")
+	}
+	order, after := "DESC", "<"
+	if q.Oldest {
+		order, after = "ASC", ">"
+	}
+	if q.After != "" {
+		var ts int64
+		err := s.readDB.QueryRow(`SELECT timestamp_ms FROM messages WHERE message_id = ?`, q.After).Scan(&ts)
+		if err == sql.ErrNoRows {
+			return nil, ErrMessageNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		where, args = append(where, "(timestamp_ms, message_id) "+after+" (?, ?)"), append(args, ts, q.After)
+	}
+	rows, err := s.readDB.Query(`
+		SELECT `+messageColumns+`
+		FROM messages`+whereClause(where)+`
+		ORDER BY timestamp_ms `+order+`, message_id `+order+`
+		LIMIT ?`, append(args, queryLimit(q.Limit, defaultMessageQueryLimit))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []*core.MessageRecord
+	for rows.Next() {
+		rec, err := s.scanMessageRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rec)
+	}
+	return results, rows.Err()
+}
+
+// whereClause joins conditions into a WHERE clause; none gives "".
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
 // ── Last bot message ────────────────────────────────────────────────────────
 
 const setLastBotSQL = `
@@ -528,51 +776,1790 @@ func (s *SQLiteStore) clearLastBotMessageByThreadTx(tx txExecer, threadID int64)
 	return err
 }
 
-// ── Helpers ─────────────────────────────────────────────────────────────────
+// ── Edit history ────────────────────────────────────────────────────────────
 
-func (s *SQLiteStore) scanMessage(row *sql.Row) (*core.MessageRecord, error) {
-	rec := &core.MessageRecord{}
-	var isFromBot, hasMedia, isEdited, isRecalled int
-	var attachJSON string
-	err := row.Scan(
-		&rec.MessageID, &rec.ThreadID, &rec.SenderID, &rec.SenderNameSnapshot, &rec.Text,
-		&rec.ReplyToMessageID, &rec.OfflineThreadingID, &isFromBot, &hasMedia,
-		&attachJSON, &rec.TimestampMs, &rec.EditCount, &isEdited, &isRecalled,
-		&rec.CreatedAtUnixMs, &rec.UpdatedAtUnixMs, &rec.RecalledAtUnixMs,
-	)
-	if err == sql.ErrNoRows {
+const upsertMessageEditSQL = `
+	INSERT INTO message_edits(message_id, thread_id, text, timestamp_ms, recorded_at_ms)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(message_id, timestamp_ms) DO UPDATE SET
+		thread_id = CASE WHEN excluded.thread_id != 0 THEN excluded.thread_id ELSE message_edits.thread_id END,
+		text      = excluded.text`
+
+func (s *SQLiteStore) UpsertMessageEdit(_ context.Context, rec *core.MessageEdit) error {
+	if rec == nil || rec.MessageID == "" {
+		return nil
+	}
+	_, err := s.writeDB.Exec(upsertMessageEditSQL,
+		rec.MessageID, rec.ThreadID, s.sealText(rec.Text), rec.TimestampMs, rec.RecordedAtUnixMs)
+	return err
+}
+
+func (s *SQLiteStore) upsertMessageEditTx(tx txExecer, rec *core.MessageEdit) error {
+	if rec == nil || rec.MessageID == "" {
+		return nil
+	}
+	_, err := tx.Exec(upsertMessageEditSQL,
+		rec.MessageID, rec.ThreadID, s.sealText(rec.Text), rec.TimestampMs, rec.RecordedAtUnixMs)
+	return err
+}
+
+// ListMessageEdits returns every recorded version of a message, oldest first.
+func (s *SQLiteStore) ListMessageEdits(_ context.Context, messageID string) ([]*core.MessageEdit, error) {
+	if messageID == "" {
 		return nil, nil
 	}
+	rows, err := s.readDB.Query(`
+		SELECT message_id, thread_id, text, timestamp_ms, recorded_at_ms
+		FROM message_edits
+		WHERE message_id = ?
+		ORDER BY timestamp_ms ASC`, messageID)
 	if err != nil {
 		return nil, err
 	}
-	rec.IsFromBot = isFromBot != 0
-	rec.HasMedia = hasMedia != 0
-	rec.IsEdited = isEdited != 0
-	rec.IsRecalled = isRecalled != 0
-	_ = json.Unmarshal([]byte(attachJSON), &rec.Attachments)
-	return rec, nil
+	defer rows.Close()
+
+	var results []*core.MessageEdit
+	for rows.Next() {
+		rec, err := s.scanEditRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rec)
+	}
+	return results, rows.Err()
 }
 
-func (s *SQLiteStore) scanMessageRow(rows *sql.Rows) (*core.MessageRecord, error) {
-	rec := &core.MessageRecord{}
-	var isFromBot, hasMedia, isEdited, isRecalled int
-	var attachJSON string
-	err := rows.Scan(
-		&rec.MessageID, &rec.ThreadID, &rec.SenderID, &rec.SenderNameSnapshot, &rec.Text,
-		&rec.ReplyToMessageID, &rec.OfflineThreadingID, &isFromBot, &hasMedia,
-		&attachJSON, &rec.TimestampMs, &rec.EditCount, &isEdited, &isRecalled,
-		&rec.CreatedAtUnixMs, &rec.UpdatedAtUnixMs, &rec.RecalledAtUnixMs,
-	)
+// ── Pins ────────────────────────────────────────────────────────────────────
+
+func (s *SQLiteStore) SetMessagePinned(_ context.Context, rec *core.MessagePin) error {
+	if rec == nil || rec.MessageID == "" {
+		return nil
+	}
+	if rec.PinnedAtUnixMs == 0 {
+		_, err := s.writeDB.Exec(`DELETE FROM message_pins WHERE message_id = ?`, rec.MessageID)
+		return err
+	}
+	_, err := s.writeDB.Exec(`INSERT OR REPLACE INTO message_pins(message_id, thread_id, pinned_at_ms) VALUES (?, ?, ?)`,
+		rec.MessageID, rec.ThreadID, rec.PinnedAtUnixMs)
+	return err
+}
+
+func (s *SQLiteStore) ClearPinnedMessages(_ context.Context, threadID int64) error {
+	_, err := s.writeDB.Exec(`DELETE FROM message_pins WHERE thread_id = ?`, threadID)
+	return err
+}
+
+func (s *SQLiteStore) ListPinnedMessages(_ context.Context, threadID int64) ([]*core.MessagePin, error) {
+	rows, err := s.readDB.Query(`SELECT thread_id, message_id, pinned_at_ms FROM message_pins
+		WHERE thread_id = ? ORDER BY pinned_at_ms DESC, message_id`, threadID)
 	if err != nil {
 		return nil, err
 	}
-	rec.IsFromBot = isFromBot != 0
-	rec.HasMedia = hasMedia != 0
-	rec.IsEdited = isEdited != 0
-	rec.IsRecalled = isRecalled != 0
-	_ = json.Unmarshal([]byte(attachJSON), &rec.Attachments)
-	return rec, nil
+	defer rows.Close()
+	var items []*core.MessagePin
+	for rows.Next() {
+		p := &core.MessagePin{}
+		if err := rows.Scan(&p.ThreadID, &p.MessageID, &p.PinnedAtUnixMs); err != nil {
+			return nil, err
+		}
+		items = append(items, p)
+	}
+	return items, rows.Err()
+}
+
+// ── Outbox ──────────────────────────────────────────────────────────────────
+
+const outboxColumns = `id, thread_id, kind, payload_json, otid, status, attempts,
+	last_error, message_id, created_at_ms, updated_at_ms, next_attempt_at_ms`
+
+// EnqueueOutbox inserts item and returns its ID.
+func (s *SQLiteStore) EnqueueOutbox(_ context.Context, item *OutboxItem) (int64, error) {
+	res, err := s.writeDB.Exec(`
+		INSERT INTO outbox(thread_id, kind, payload_json, otid, status, attempts,
+			last_error, message_id, created_at_ms, updated_at_ms, next_attempt_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		item.ThreadID, item.Kind, string(item.Payload), item.OTID, string(item.Status), item.Attempts,
+		item.LastError, item.MessageID, item.CreatedAtUnixMs, item.UpdatedAtUnixMs, item.NextAttemptAtUnixMs)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateOutbox stores the delivery state of item.
+func (s *SQLiteStore) UpdateOutbox(_ context.Context, item *OutboxItem) error {
+	_, err := s.writeDB.Exec(`
+		UPDATE outbox SET status = ?, attempts = ?, last_error = ?, message_id = ?,
+			updated_at_ms = ?, next_attempt_at_ms = ?
+		WHERE id = ?`,
+		string(item.Status), item.Attempts, item.LastError, item.MessageID,
+		item.UpdatedAtUnixMs, item.NextAttemptAtUnixMs, item.ID)
+	return err
+}
+
+func (s *SQLiteStore) GetOutbox(_ context.Context, id int64) (*OutboxItem, error) {
+	rows, err := s.readDB.Query(`SELECT `+outboxColumns+` FROM outbox WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanOutboxRows(rows)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// ListPendingOutbox returns every pending item, grouped by thread in FIFO order.
+func (s *SQLiteStore) ListPendingOutbox(_ context.Context) ([]*OutboxItem, error) {
+	rows, err := s.readDB.Query(`SELECT `+outboxColumns+` FROM outbox
+		WHERE status = ? ORDER BY thread_id, id`, string(core.DeliveryPending))
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxRows(rows)
+}
+
+func (s *SQLiteStore) HasPendingOutbox(_ context.Context, threadID int64) (bool, error) {
+	var n int
+	err := s.readDB.QueryRow(`SELECT COUNT(*) FROM outbox WHERE status = ? AND thread_id = ?`,
+		string(core.DeliveryPending), threadID).Scan(&n)
+	return n > 0, err
+}
+
+func scanOutboxRows(rows *sql.Rows) ([]*OutboxItem, error) {
+	defer rows.Close()
+	var items []*OutboxItem
+	for rows.Next() {
+		item := &OutboxItem{}
+		var status, payload string
+		if err := rows.Scan(&item.ID, &item.ThreadID, &item.Kind, &payload, &item.OTID, &status,
+			&item.Attempts, &item.LastError, &item.MessageID, &item.CreatedAtUnixMs,
+			&item.UpdatedAtUnixMs, &item.NextAttemptAtUnixMs); err != nil {
+			return nil, err
+		}
+		item.Status = core.DeliveryStatus(status)
+		item.Payload = []byte(payload)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// ── Scheduled messages ──────────────────────────────────────────────────────
+
+const scheduledColumns = `id, thread_id, creator_id, kind, text, payload_json, status,
+	attempts, last_error, message_id, outbox_id, send_at_ms, created_at_ms, updated_at_ms`
+
+// InsertScheduled inserts item and returns its ID.
+func (s *SQLiteStore) InsertScheduled(_ context.Context, item *ScheduledItem) (int64, error) {
+	res, err := s.writeDB.Exec(`
+		INSERT INTO scheduled_messages(thread_id, creator_id, kind, text, payload_json, status,
+			attempts, last_error, message_id, send_at_ms, created_at_ms, updated_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		item.ThreadID, item.CreatorID, item.Kind, item.Text, string(item.Payload), string(item.Status),
+		item.Attempts, item.LastError, item.MessageID, item.SendAtUnixMs, item.CreatedAtUnixMs, item.UpdatedAtUnixMs)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateScheduled stores the state of item.
+func (s *SQLiteStore) UpdateScheduled(_ context.Context, item *ScheduledItem) error {
+	_, err := s.writeDB.Exec(`
+		UPDATE scheduled_messages SET status = ?, attempts = ?, last_error = ?, message_id = ?,
+			outbox_id = ?, send_at_ms = ?, updated_at_ms = ?
+		WHERE id = ?`,
+		string(item.Status), item.Attempts, item.LastError, item.MessageID,
+		item.OutboxID, item.SendAtUnixMs, item.UpdatedAtUnixMs, item.ID)
+	return err
+}
+
+// GetQueuedScheduled returns the queued item handed to the outbox as
+// outboxID, or nil.
+func (s *SQLiteStore) GetQueuedScheduled(_ context.Context, outboxID int64) (*ScheduledItem, error) {
+	rows, err := s.readDB.Query(`SELECT `+scheduledColumns+` FROM scheduled_messages
+		WHERE outbox_id = ? AND status = ?`, outboxID, string(core.ScheduleQueued))
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanScheduledRows(rows)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func (s *SQLiteStore) GetScheduled(_ context.Context, id int64) (*ScheduledItem, error) {
+	rows, err := s.readDB.Query(`SELECT `+scheduledColumns+` FROM scheduled_messages WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanScheduledRows(rows)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func (s *SQLiteStore) ListScheduled(_ context.Context, threadID int64) ([]*ScheduledItem, error) {
+	rows, err := s.readDB.Query(`SELECT `+scheduledColumns+` FROM scheduled_messages
+		WHERE status = ? AND thread_id = ? ORDER BY send_at_ms, id`, string(core.SchedulePending), threadID)
+	if err != nil {
+		return nil, err
+	}
+	return scanScheduledRows(rows)
+}
+
+func (s *SQLiteStore) ListDueScheduled(_ context.Context, untilMs int64) ([]*ScheduledItem, error) {
+	rows, err := s.readDB.Query(`SELECT `+scheduledColumns+` FROM scheduled_messages
+		WHERE status = ? AND send_at_ms <= ? ORDER BY send_at_ms, id`, string(core.SchedulePending), untilMs)
+	if err != nil {
+		return nil, err
+	}
+	return scanScheduledRows(rows)
+}
+
+func (s *SQLiteStore) NextScheduledAt(_ context.Context) (int64, error) {
+	var next sql.NullInt64
+	err := s.readDB.QueryRow(`SELECT MIN(send_at_ms) FROM scheduled_messages WHERE status = ?`,
+		string(core.SchedulePending)).Scan(&next)
+	return next.Int64, err
+}
+
+func scanScheduledRows(rows *sql.Rows) ([]*ScheduledItem, error) {
+	defer rows.Close()
+	var items []*ScheduledItem
+	for rows.Next() {
+		item := &ScheduledItem{}
+		var status, payload string
+		if err := rows.Scan(&item.ID, &item.ThreadID, &item.CreatorID, &item.Kind, &item.Text, &payload,
+			&status, &item.Attempts, &item.LastError, &item.MessageID, &item.OutboxID, &item.SendAtUnixMs,
+			&item.CreatedAtUnixMs, &item.UpdatedAtUnixMs); err != nil {
+			return nil, err
+		}
+		item.Status = core.ScheduleStatus(status)
+		item.Payload = []byte(payload)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// ── Reminders ───────────────────────────────────────────────────────────────
+
+const reminderColumns = `id, thread_id, creator_id, target_id, text, recurrence, status, next_at_ms,
+	anchor_at_ms, fire_count, attempts, last_error, last_fired_at_ms, created_at_ms, updated_at_ms`
+
+// InsertReminder inserts r and returns its ID.
+func (s *SQLiteStore) InsertReminder(_ context.Context, r *core.Reminder) (int64, error) {
+	res, err := s.writeDB.Exec(`
+		INSERT INTO reminders(thread_id, creator_id, target_id, text, recurrence, status, next_at_ms,
+			anchor_at_ms, fire_count, attempts, last_error, last_fired_at_ms, created_at_ms, updated_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ThreadID, r.CreatorID, r.TargetID, r.Text, r.Recurrence, string(r.Status), r.NextAtUnixMs,
+		r.AnchorAtUnixMs, r.FireCount, r.Attempts, r.LastError, r.LastFiredAtUnixMs, r.CreatedAtUnixMs, r.UpdatedAtUnixMs)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateReminder stores the state of r.
+func (s *SQLiteStore) UpdateReminder(_ context.Context, r *core.Reminder) error {
+	_, err := s.writeDB.Exec(`
+		UPDATE reminders SET status = ?, next_at_ms = ?, anchor_at_ms = ?, fire_count = ?, attempts = ?,
+			last_error = ?, last_fired_at_ms = ?, updated_at_ms = ?
+		WHERE id = ?`,
+		string(r.Status), r.NextAtUnixMs, r.AnchorAtUnixMs, r.FireCount, r.Attempts,
+		r.LastError, r.LastFiredAtUnixMs, r.UpdatedAtUnixMs, r.ID)
+	return err
+}
+
+func (s *SQLiteStore) GetReminder(_ context.Context, id int64) (*core.Reminder, error) {
+	rows, err := s.readDB.Query(`SELECT `+reminderColumns+` FROM reminders WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanReminderRows(rows)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func (s *SQLiteStore) ListReminders(_ context.Context, threadID int64) ([]*core.Reminder, error) {
+	rows, err := s.readDB.Query(`SELECT `+reminderColumns+` FROM reminders
+		WHERE status = ? AND thread_id = ? ORDER BY next_at_ms, id`, string(core.ReminderActive), threadID)
+	if err != nil {
+		return nil, err
+	}
+	return scanReminderRows(rows)
+}
+
+func (s *SQLiteStore) ListDueReminders(_ context.Context, untilMs int64) ([]*core.Reminder, error) {
+	rows, err := s.readDB.Query(`SELECT `+reminderColumns+` FROM reminders
+		WHERE status = ? AND next_at_ms <= ? ORDER BY next_at_ms, id`, string(core.ReminderActive), untilMs)
+	if err != nil {
+		return nil, err
+	}
+	return scanReminderRows(rows)
+}
+
+func (s *SQLiteStore) NextReminderAt(_ context.Context) (int64, error) {
+	var next sql.NullInt64
+	err := s.readDB.QueryRow(`SELECT MIN(next_at_ms) FROM reminders WHERE status = ?`,
+		string(core.ReminderActive)).Scan(&next)
+	return next.Int64, err
+}
+
+func scanReminderRows(rows *sql.Rows) ([]*core.Reminder, error) {
+	defer rows.Close()
+	var items []*core.Reminder
+	for rows.Next() {
+		r := &core.Reminder{}
+		var status string
+		if err := rows.Scan(&r.ID, &r.ThreadID, &r.CreatorID, &r.TargetID, &r.Text, &r.Recurrence,
+			&status, &r.NextAtUnixMs, &r.AnchorAtUnixMs, &r.FireCount, &r.Attempts, &r.LastError,
+			&r.LastFiredAtUnixMs, &r.CreatedAtUnixMs, &r.UpdatedAtUnixMs); err != nil {
+			return nil, err
+		}
+		r.Status = core.ReminderStatus(status)
+		items = append(items, r)
+	}
+	return items, rows.Err()
+}
+
+// ── Broadcasts ──────────────────────────────────────────────────────────────
+
+const broadcastColumns = `id, creator_id, origin_thread_id, text, target, status,
+	(SELECT COUNT(*) FROM broadcast_deliveries d WHERE d.broadcast_id = b.id),
+	(SELECT COUNT(*) FROM broadcast_deliveries d WHERE d.broadcast_id = b.id AND d.status = 'sent'),
+	(SELECT COUNT(*) FROM broadcast_deliveries d WHERE d.broadcast_id = b.id AND d.status = 'failed'),
+	(SELECT COUNT(*) FROM broadcast_deliveries d WHERE d.broadcast_id = b.id AND d.status = 'queued'),
+	created_at_ms, updated_at_ms, finished_at_ms`
+
+// InsertBroadcast inserts b with a pending delivery for every thread in
+// threadIDs and returns its ID.
+func (s *SQLiteStore) InsertBroadcast(ctx context.Context, b *core.Broadcast, threadIDs []int64) (int64, error) {
+	tx, err := s.writeDB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`
+		INSERT INTO broadcasts(creator_id, origin_thread_id, text, target, status, created_at_ms, updated_at_ms, finished_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.CreatorID, b.OriginThreadID, b.Text, b.Target, string(b.Status), b.CreatedAtUnixMs, b.UpdatedAtUnixMs, b.FinishedAtUnixMs)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO broadcast_deliveries(broadcast_id, thread_id, status, updated_at_ms) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, threadID := range threadIDs {
+		if _, err := stmt.Exec(id, threadID, string(core.DeliveryPending), b.CreatedAtUnixMs); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// UpdateBroadcast stores the status of b.
+func (s *SQLiteStore) UpdateBroadcast(_ context.Context, b *core.Broadcast) error {
+	_, err := s.writeDB.Exec(`UPDATE broadcasts SET status = ?, updated_at_ms = ?, finished_at_ms = ? WHERE id = ?`,
+		string(b.Status), b.UpdatedAtUnixMs, b.FinishedAtUnixMs, b.ID)
+	return err
+}
+
+func (s *SQLiteStore) GetBroadcast(_ context.Context, id int64) (*core.Broadcast, error) {
+	rows, err := s.readDB.Query(`SELECT `+broadcastColumns+` FROM broadcasts b WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanBroadcastRows(rows)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// ListBroadcasts returns up to limit broadcasts, newest first. An empty
+// status matches every broadcast.
+func (s *SQLiteStore) ListBroadcasts(_ context.Context, status core.BroadcastStatus, limit int) ([]*core.Broadcast, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.readDB.Query(`SELECT `+broadcastColumns+` FROM broadcasts b
+		WHERE ? = '' OR status = ? ORDER BY id DESC LIMIT ?`, string(status), string(status), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanBroadcastRows(rows)
+}
+
+const deliveryColumns = `broadcast_id, thread_id, status, last_error, message_id, outbox_id, updated_at_ms`
+
+// NextBroadcastDelivery returns the first pending delivery of broadcast id
+// in the order they were queued, or nil if none is left.
+func (s *SQLiteStore) NextBroadcastDelivery(_ context.Context, id int64) (*core.BroadcastDelivery, error) {
+	rows, err := s.readDB.Query(`SELECT `+deliveryColumns+`
+		FROM broadcast_deliveries WHERE broadcast_id = ? AND status = ? ORDER BY rowid LIMIT 1`,
+		id, string(core.DeliveryPending))
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanDeliveryRows(rows)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// ListBroadcastDeliveries returns the deliveries of broadcast id with
+// status, in the order they were queued.
+func (s *SQLiteStore) ListBroadcastDeliveries(_ context.Context, id int64, status core.DeliveryStatus) ([]*core.BroadcastDelivery, error) {
+	rows, err := s.readDB.Query(`SELECT `+deliveryColumns+`
+		FROM broadcast_deliveries WHERE broadcast_id = ? AND status = ? ORDER BY rowid`, id, string(status))
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveryRows(rows)
+}
+
+// UpdateBroadcastDelivery stores the outcome of d.
+func (s *SQLiteStore) UpdateBroadcastDelivery(_ context.Context, d *core.BroadcastDelivery) error {
+	_, err := s.writeDB.Exec(`UPDATE broadcast_deliveries SET status = ?, last_error = ?, message_id = ?, outbox_id = ?,
+		updated_at_ms = ? WHERE broadcast_id = ? AND thread_id = ?`,
+		string(d.Status), d.LastError, d.MessageID, d.OutboxID, d.UpdatedAtUnixMs, d.BroadcastID, d.ThreadID)
+	return err
+}
+
+// GetQueuedBroadcastDelivery returns the queued delivery handed to the
+// outbox as outboxID, or nil.
+func (s *SQLiteStore) GetQueuedBroadcastDelivery(_ context.Context, outboxID int64) (*core.BroadcastDelivery, error) {
+	rows, err := s.readDB.Query(`SELECT `+deliveryColumns+`
+		FROM broadcast_deliveries WHERE outbox_id = ? AND status = ?`, outboxID, string(core.DeliveryQueued))
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanDeliveryRows(rows)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func scanBroadcastRows(rows *sql.Rows) ([]*core.Broadcast, error) {
+	defer rows.Close()
+	var items []*core.Broadcast
+	for rows.Next() {
+		b := &core.Broadcast{}
+		var status string
+		if err := rows.Scan(&b.ID, &b.CreatorID, &b.OriginThreadID, &b.Text, &b.Target, &status,
+			&b.Total, &b.Sent, &b.Failed, &b.Queued, &b.CreatedAtUnixMs, &b.UpdatedAtUnixMs, &b.FinishedAtUnixMs); err != nil {
+			return nil, err
+		}
+		b.Status = core.BroadcastStatus(status)
+		items = append(items, b)
+	}
+	return items, rows.Err()
+}
+
+func scanDeliveryRows(rows *sql.Rows) ([]*core.BroadcastDelivery, error) {
+	defer rows.Close()
+	var items []*core.BroadcastDelivery
+	for rows.Next() {
+		d := &core.BroadcastDelivery{}
+		var status string
+		if err := rows.Scan(&d.BroadcastID, &d.ThreadID, &status, &d.LastError, &d.MessageID, &d.OutboxID, &d.UpdatedAtUnixMs); err != nil {
+			return nil, err
+		}
+		d.Status = core.DeliveryStatus(status)
+		items = append(items, d)
+	}
+	return items, rows.Err()
+}
+
+// ── Thread participants ─────────────────────────────────────────────────────
+
+const participantColumns = `thread_id, user_id, nickname, is_admin, updated_at_ms`
+
+func (s *SQLiteStore) UpsertParticipant(_ context.Context, rec *core.ThreadParticipant) error {
+	if rec == nil || rec.ThreadID == 0 || rec.UserID == 0 {
+		return nil
+	}
+	_, err := s.writeDB.Exec(`INSERT OR REPLACE INTO thread_participants(`+participantColumns+`)
+		VALUES (?, ?, ?, ?, ?)`,
+		rec.ThreadID, rec.UserID, rec.Nickname, boolToInt(rec.IsAdmin), rec.UpdatedAtUnixMs)
+	return err
+}
+
+func (s *SQLiteStore) GetParticipant(_ context.Context, threadID, userID int64) (*core.ThreadParticipant, error) {
+	rows, err := s.readDB.Query(`SELECT `+participantColumns+` FROM thread_participants
+		WHERE thread_id = ? AND user_id = ?`, threadID, userID)
+	if err != nil {
+		return nil, err
+	}
+	participants, err := scanParticipantRows(rows)
+	if err != nil || len(participants) == 0 {
+		return nil, err
+	}
+	return participants[0], nil
+}
+
+func (s *SQLiteStore) ListParticipants(_ context.Context, threadID int64) ([]*core.ThreadParticipant, error) {
+	rows, err := s.readDB.Query(`SELECT `+participantColumns+` FROM thread_participants
+		WHERE thread_id = ? ORDER BY is_admin DESC, user_id`, threadID)
+	if err != nil {
+		return nil, err
+	}
+	return scanParticipantRows(rows)
+}
+
+func (s *SQLiteStore) DeleteParticipant(_ context.Context, threadID, userID int64) error {
+	_, err := s.writeDB.Exec(`DELETE FROM thread_participants WHERE thread_id = ? AND user_id = ?`, threadID, userID)
+	return err
+}
+
+func (s *SQLiteStore) SetParticipantsAdmin(_ context.Context, threadID int64, isAdmin bool) error {
+	_, err := s.writeDB.Exec(`UPDATE thread_participants SET is_admin = ?, updated_at_ms = ? WHERE thread_id = ?`,
+		boolToInt(isAdmin), time.Now().UnixMilli(), threadID)
+	return err
+}
+
+func scanParticipantRows(rows *sql.Rows) ([]*core.ThreadParticipant, error) {
+	defer rows.Close()
+	var items []*core.ThreadParticipant
+	for rows.Next() {
+		p := &core.ThreadParticipant{}
+		var isAdmin int
+		if err := rows.Scan(&p.ThreadID, &p.UserID, &p.Nickname, &isAdmin, &p.UpdatedAtUnixMs); err != nil {
+			return nil, err
+		}
+		p.IsAdmin = isAdmin != 0
+		items = append(items, p)
+	}
+	return items, rows.Err()
+}
+
+// ── Polls ───────────────────────────────────────────────────────────────────
+
+const pollColumns = `poll_id, thread_id, creator_id, question, message_id, status,
+	closes_at_ms, closed_at_ms, created_at_ms, updated_at_ms`
+
+func (s *SQLiteStore) UpsertPoll(_ context.Context, rec *core.Poll) error {
+	if rec == nil || rec.ID == 0 {
+		return nil
+	}
+	_, err := s.writeDB.Exec(`INSERT OR REPLACE INTO polls(`+pollColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.ID, rec.ThreadID, rec.CreatorID, rec.Question, rec.MessageID, string(rec.Status),
+		rec.ClosesAtUnixMs, rec.ClosedAtUnixMs, rec.CreatedAtUnixMs, rec.UpdatedAtUnixMs)
+	return err
+}
+
+func (s *SQLiteStore) GetPoll(_ context.Context, pollID int64) (*core.Poll, error) {
+	rows, err := s.readDB.Query(`SELECT `+pollColumns+` FROM polls WHERE poll_id = ?`, pollID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := scanPollRows(rows)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func (s *SQLiteStore) ListPolls(_ context.Context, threadID int64, limit int) ([]*core.Poll, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	rows, err := s.readDB.Query(`SELECT `+pollColumns+` FROM polls
+		WHERE thread_id = ? ORDER BY created_at_ms DESC, poll_id DESC LIMIT ?`, threadID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanPollRows(rows)
+}
+
+func (s *SQLiteStore) ListDuePolls(_ context.Context, untilMs int64) ([]*core.Poll, error) {
+	rows, err := s.readDB.Query(`SELECT `+pollColumns+` FROM polls
+		WHERE status = ? AND closes_at_ms > 0 AND closes_at_ms <= ? ORDER BY closes_at_ms, poll_id`,
+		string(core.PollOpen), untilMs)
+	if err != nil {
+		return nil, err
+	}
+	return scanPollRows(rows)
+}
+
+func (s *SQLiteStore) NextPollCloseAt(_ context.Context) (int64, error) {
+	var next sql.NullInt64
+	err := s.readDB.QueryRow(`SELECT MIN(closes_at_ms) FROM polls WHERE status = ? AND closes_at_ms > 0`,
+		string(core.PollOpen)).Scan(&next)
+	return next.Int64, err
+}
+
+func (s *SQLiteStore) UpsertPollOption(_ context.Context, rec *core.PollOption) error {
+	if rec == nil || rec.PollID == 0 || rec.OptionID == 0 {
+		return nil
+	}
+	_, err := s.writeDB.Exec(`INSERT OR REPLACE INTO poll_options(poll_id, option_id, text, position)
+		VALUES (?, ?, ?, ?)`, rec.PollID, rec.OptionID, rec.Text, rec.Position)
+	return err
+}
+
+func (s *SQLiteStore) ListPollOptions(_ context.Context, pollID int64) ([]*core.PollOption, error) {
+	rows, err := s.readDB.Query(`SELECT poll_id, option_id, text, position FROM poll_options
+		WHERE poll_id = ? ORDER BY position, option_id`, pollID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*core.PollOption
+	for rows.Next() {
+		o := &core.PollOption{}
+		if err := rows.Scan(&o.PollID, &o.OptionID, &o.Text, &o.Position); err != nil {
+			return nil, err
+		}
+		items = append(items, o)
+	}
+	return items, rows.Err()
+}
+
+func (s *SQLiteStore) UpsertPollVote(_ context.Context, rec *core.PollVote) error {
+	if rec == nil || rec.PollID == 0 || rec.OptionID == 0 || rec.UserID == 0 {
+		return nil
+	}
+	_, err := s.writeDB.Exec(`INSERT OR REPLACE INTO poll_votes(poll_id, option_id, user_id, voted_at_ms)
+		VALUES (?, ?, ?, ?)`, rec.PollID, rec.OptionID, rec.UserID, rec.VotedAtUnixMs)
+	return err
+}
+
+func (s *SQLiteStore) ReplacePollVotes(ctx context.Context, pollID int64, votes []*core.PollVote) error {
+	tx, err := s.writeDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM poll_votes WHERE poll_id = ?`, pollID); err != nil {
+		return err
+	}
+	for _, v := range votes {
+		if v.OptionID == 0 || v.UserID == 0 {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO poll_votes(poll_id, option_id, user_id, voted_at_ms)
+			VALUES (?, ?, ?, ?)`, pollID, v.OptionID, v.UserID, v.VotedAtUnixMs); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) ListPollVotes(_ context.Context, pollID int64) ([]*core.PollVote, error) {
+	rows, err := s.readDB.Query(`SELECT poll_id, option_id, user_id, voted_at_ms FROM poll_votes
+		WHERE poll_id = ? ORDER BY voted_at_ms, user_id`, pollID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*core.PollVote
+	for rows.Next() {
+		v := &core.PollVote{}
+		if err := rows.Scan(&v.PollID, &v.OptionID, &v.UserID, &v.VotedAtUnixMs); err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, rows.Err()
+}
+
+func scanPollRows(rows *sql.Rows) ([]*core.Poll, error) {
+	defer rows.Close()
+	var items []*core.Poll
+	for rows.Next() {
+		p := &core.Poll{}
+		var status string
+		if err := rows.Scan(&p.ID, &p.ThreadID, &p.CreatorID, &p.Question, &p.MessageID, &status,
+			&p.ClosesAtUnixMs, &p.ClosedAtUnixMs, &p.CreatedAtUnixMs, &p.UpdatedAtUnixMs); err != nil {
+			return nil, err
+		}
+		p.Status = core.PollStatus(status)
+		items = append(items, p)
+	}
+	return items, rows.Err()
+}
+
+// ── Moderation ──────────────────────────────────────────────────────────────
+
+const moderationEventColumns = `id, thread_id, user_id, message_id, reason, action, detail, actor_id,
+	until_ms, created_at_ms`
+
+// InsertModerationEvent appends e to the audit trail and returns its ID.
+func (s *SQLiteStore) InsertModerationEvent(_ context.Context, e *core.ModerationEvent) (int64, error) {
+	res, err := s.writeDB.Exec(`
+		INSERT INTO moderation_events(thread_id, user_id, message_id, reason, action, detail, actor_id,
+			until_ms, created_at_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ThreadID, e.UserID, e.MessageID, string(e.Reason), string(e.Action), e.Detail, e.ActorID,
+		e.UntilUnixMs, e.CreatedAtUnixMs)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *SQLiteStore) ListModerationEvents(_ context.Context, threadID, userID int64, limit int) ([]*core.ModerationEvent, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.readDB.Query(`SELECT `+moderationEventColumns+` FROM moderation_events
+		WHERE thread_id = ? AND (? = 0 OR user_id = ?)
+		ORDER BY created_at_ms DESC, id DESC LIMIT ?`, threadID, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanModerationEventRows(rows)
+}
+
+func (s *SQLiteStore) CountModerationStrikes(_ context.Context, threadID, userID, sinceMs int64) (int, error) {
+	var n int
+	err := s.readDB.QueryRow(`
+		SELECT COUNT(*) FROM moderation_events
+		WHERE thread_id = ? AND user_id = ? AND actor_id = 0 AND created_at_ms >= ?
+		  AND created_at_ms > COALESCE((SELECT MAX(created_at_ms) FROM moderation_events
+			WHERE thread_id = ? AND user_id = ? AND action = ?), 0)`,
+		threadID, userID, sinceMs, threadID, userID, string(core.ModerationPardon)).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteStore) ListActiveMutes(_ context.Context, nowMs int64) ([]*core.ModerationEvent, error) {
+	rows, err := s.readDB.Query(`SELECT `+moderationEventColumns+` FROM moderation_events e
+		WHERE action = ? AND until_ms > ?
+		  AND NOT EXISTS (SELECT 1 FROM moderation_events p
+			WHERE p.thread_id = e.thread_id AND p.user_id = e.user_id AND p.action = ? AND p.id > e.id)
+		ORDER BY id`, string(core.ModerationMute), nowMs, string(core.ModerationPardon))
+	if err != nil {
+		return nil, err
+	}
+	return scanModerationEventRows(rows)
+}
+
+func scanModerationEventRows(rows *sql.Rows) ([]*core.ModerationEvent, error) {
+	defer rows.Close()
+	var items []*core.ModerationEvent
+	for rows.Next() {
+		e := &core.ModerationEvent{}
+		var reason, action string
+		if err := rows.Scan(&e.ID, &e.ThreadID, &e.UserID, &e.MessageID, &reason, &action, &e.Detail,
+			&e.ActorID, &e.UntilUnixMs, &e.CreatedAtUnixMs); err != nil {
+			return nil, err
+		}
+		e.Reason = core.ModerationReason(reason)
+		e.Action = core.ModerationAction(action)
+		items = append(items, e)
+	}
+	return items, rows.Err()
+}
+
+// ── Bans ────────────────────────────────────────────────────────────────────
+
+const banColumns = `thread_id, user_id, reason, creator_id, expires_at_ms, created_at_ms`
+
+func (s *SQLiteStore) UpsertBan(_ context.Context, b *core.Ban) error {
+	_, err := s.writeDB.Exec(`INSERT OR REPLACE INTO bans(`+banColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		b.ThreadID, b.UserID, b.Reason, b.CreatorID, b.ExpiresAtUnixMs, b.CreatedAtUnixMs)
+	return err
+}
+
+// DeleteBan deletes the ban of userID in threadID and reports whether there
+// was one.
+func (s *SQLiteStore) DeleteBan(_ context.Context, threadID, userID int64) (bool, error) {
+	res, err := s.writeDB.Exec(`DELETE FROM bans WHERE thread_id = ? AND user_id = ?`, threadID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteExpiredBans deletes the bans that expired at or before nowMs.
+func (s *SQLiteStore) DeleteExpiredBans(_ context.Context, nowMs int64) (int64, error) {
+	res, err := s.writeDB.Exec(`DELETE FROM bans WHERE expires_at_ms > 0 AND expires_at_ms <= ?`, nowMs)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStore) ListBans(_ context.Context) ([]*core.Ban, error) {
+	rows, err := s.readDB.Query(`SELECT ` + banColumns + ` FROM bans ORDER BY created_at_ms DESC, thread_id, user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*core.Ban
+	for rows.Next() {
+		b := &core.Ban{}
+		if err := rows.Scan(&b.ThreadID, &b.UserID, &b.Reason, &b.CreatorID, &b.ExpiresAtUnixMs, &b.CreatedAtUnixMs); err != nil {
+			return nil, err
+		}
+		items = append(items, b)
+	}
+	return items, rows.Err()
+}
+
+// ── Search ──────────────────────────────────────────────────────────────────
+
+// searchFolder folds the letters the FTS5 tokenizer keeps apart from their
+// plain form: remove_diacritics strips marks but "đ" is a letter of its own.
+// Migration 14 folds the same letters in SQL when backfilling.
+var searchFolder = strings.NewReplacer("đ", "d", "Đ", "D")
+
+// indexMessageTx brings the search index in step with rec. The bot's own
+// and recalled messages are left out.
+func indexMessageTx(tx txExecer, rec *core.MessageRecord) error {
+	if strings.TrimSpace(rec.Text) == "" || rec.IsFromBot || rec.IsRecalled {
+		_, err := tx.Exec(`DELETE FROM message_search WHERE rowid = (SELECT doc_id FROM message_search_docs WHERE message_id = ?)`, rec.MessageID)
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO message_search_docs(message_id) VALUES (?) ON CONFLICT(message_id) DO NOTHING`, rec.MessageID); err != nil {
+		return err
+	}
+	var docID int64
+	if err := tx.QueryRow(`SELECT doc_id FROM message_search_docs WHERE message_id = ?`, rec.MessageID).Scan(&docID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM message_search WHERE rowid = ?`, docID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO message_search(rowid, text) VALUES (?, ?)`, docID, searchFolder.Replace(rec.Text))
+	return err
+}
+
+// searchMatch turns free text into an FTS5 query matching every word as a
+// prefix. It returns "" when query has no words.
+func searchMatch(query string) string {
+	words := strings.FieldsFunc(searchFolder.Replace(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, w := range words {
+		words[i] = `"` + w + `"*`
+	}
+	return strings.Join(words, " ")
+}
+
+// SearchMessages returns the messages of threadID (0 = every thread) that
+// contain every word of query, newest first.
+func (s *SQLiteStore) SearchMessages(_ context.Context, threadID int64, query string, f core.SearchFilters) ([]*core.MessageRecord, error) {
+	match := searchMatch(query)
+	if match == "" {
+		return nil, nil
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	where := []string{`message_id IN (
+		SELECT d.message_id FROM message_search
+		JOIN message_search_docs d ON d.doc_id = message_search.rowid
+		WHERE message_search MATCH ?)`}
+	args := []any{match}
+	if threadID != 0 {
+		where, args = append(where, "thread_id = ?"), append(args, threadID)
+	}
+	if f.SenderID != 0 {
+		where, args = append(where, "sender_id = ?"), append(args, f.SenderID)
+	}
+	if !f.Since.IsZero() {
+		where, args = append(where, "timestamp_ms >= ?"), append(args, f.Since.UnixMilli())
+	}
+	if !f.Until.IsZero() {
+		where, args = append(where, "timestamp_ms < ?"), append(args, f.Until.UnixMilli())
+	}
+	if f.HasMedia {
+		where = append(where, "has_media = 1")
+	}
+	rows, err := s.readDB.Query(`
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY timestamp_ms DESC, message_id DESC
+		LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []*core.MessageRecord
+	for rows.Next() {
+		rec, err := s.scanMessageRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rec)
+	}
+	return results, rows.Err()
+}
+
+// ── Attachment archive ──────────────────────────────────────────────────────
+
+const attachmentFileColumns = `f.message_id, f.attachment_id, f.thread_id, f.sha256, b.size_bytes, b.mime_type,
+	f.archived_at_ms`
+
+func (s *SQLiteStore) HasAttachmentFile(ctx context.Context, messageID, attachmentID string) (bool, error) {
+	var n int
+	err := s.readDB.QueryRowContext(ctx, `SELECT COUNT(*) FROM message_attachment_files
+		WHERE message_id = ? AND attachment_id = ?`, messageID, attachmentID).Scan(&n)
+	return n > 0, err
+}
+
+// ThreadAttachmentBytes returns the size of the distinct files linked from
+// threadID's messages.
+func (s *SQLiteStore) ThreadAttachmentBytes(ctx context.Context, threadID int64) (int64, error) {
+	var n int64
+	err := s.readDB.QueryRowContext(ctx, `SELECT COALESCE(SUM(size_bytes), 0) FROM attachment_blobs
+		WHERE sha256 IN (SELECT sha256 FROM message_attachment_files WHERE thread_id = ?)`, threadID).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteStore) ThreadHasAttachmentBlob(ctx context.Context, threadID int64, sha256 string) (bool, error) {
+	var n int
+	err := s.readDB.QueryRowContext(ctx, `SELECT COUNT(*) FROM message_attachment_files
+		WHERE thread_id = ? AND sha256 = ?`, threadID, sha256).Scan(&n)
+	return n > 0, err
+}
+
+// LinkAttachmentFile records the file f.SHA256, if new, and links it from
+// f's message.
+func (s *SQLiteStore) LinkAttachmentFile(_ context.Context, f *core.AttachmentFile) error {
+	return s.ExecBatch(func(tx txExecer) error {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO attachment_blobs(sha256, size_bytes, mime_type, created_at_ms)
+			VALUES (?, ?, ?, ?)`, f.SHA256, f.SizeBytes, f.MimeType, f.ArchivedAtUnixMs); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT OR REPLACE INTO message_attachment_files(message_id, attachment_id, thread_id, sha256, archived_at_ms)
+			VALUES (?, ?, ?, ?, ?)`, f.MessageID, f.AttachmentID, f.ThreadID, f.SHA256, f.ArchivedAtUnixMs)
+		return err
+	})
+}
+
+func (s *SQLiteStore) ListAttachmentFiles(ctx context.Context, messageID string) ([]*core.AttachmentFile, error) {
+	rows, err := s.readDB.QueryContext(ctx, `SELECT `+attachmentFileColumns+`
+		FROM message_attachment_files f JOIN attachment_blobs b ON b.sha256 = f.sha256
+		WHERE f.message_id = ? ORDER BY f.rowid`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*core.AttachmentFile
+	for rows.Next() {
+		f := &core.AttachmentFile{}
+		if err := rows.Scan(&f.MessageID, &f.AttachmentID, &f.ThreadID, &f.SHA256, &f.SizeBytes, &f.MimeType,
+			&f.ArchivedAtUnixMs); err != nil {
+			return nil, err
+		}
+		items = append(items, f)
+	}
+	return items, rows.Err()
+}
+
+// DeleteOrphanAttachmentBlobs deletes up to limit files no message links to
+// any more and returns their hashes, so their content can be removed.
+func (s *SQLiteStore) DeleteOrphanAttachmentBlobs(ctx context.Context, limit int) ([]string, error) {
+	rows, err := s.readDB.QueryContext(ctx, `SELECT sha256 FROM attachment_blobs b
+		WHERE NOT EXISTS (SELECT 1 FROM message_attachment_files f WHERE f.sha256 = b.sha256)
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(hashes) == 0 {
+		return nil, err
+	}
+	err = s.ExecBatch(func(tx txExecer) error {
+		for _, h := range hashes {
+			if _, err := tx.Exec(`DELETE FROM attachment_blobs WHERE sha256 = ?
+				AND NOT EXISTS (SELECT 1 FROM message_attachment_files WHERE sha256 = ?)`, h, h); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+// ── Stats ───────────────────────────────────────────────────────────────────
+
+const (
+	msPerHour = int64(time.Hour / time.Millisecond)
+	msPerDay  = 24 * msPerHour
+)
+
+// rollupMessageTx adds rec, which must be stored already, to the stats
+// rollups. It answers the message before it when that came from someone
+// else within statsResponseWindow. Words and domains are counted only with
+// terms: stats_terms holds them in plaintext.
+func rollupMessageTx(tx txExecer, rec *core.MessageRecord, terms bool) error {
+	var responses, responseMs int64
+	var prevSender, prevMs int64
+	err := tx.QueryRow(`
+		SELECT sender_id, timestamp_ms FROM messages
+		WHERE thread_id = ? AND timestamp_ms <= ? AND message_id != ? AND is_from_bot = 0
+		ORDER BY timestamp_ms DESC LIMIT 1`,
+		rec.ThreadID, rec.TimestampMs, rec.MessageID).Scan(&prevSender, &prevMs)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case prevSender != rec.SenderID && rec.TimestampMs-prevMs <= statsResponseWindow.Milliseconds():
+		responses, responseMs = 1, rec.TimestampMs-prevMs
+	}
+
+	words, domains, links := statsTerms(rec.Text, rec.Mentions)
+	if !terms {
+		words, domains = nil, nil
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO stats_activity(thread_id, hour, sender_id, messages, media, links, responses, response_ms)
+		VALUES (?, ?, ?, 1, ?, ?, ?, ?)
+		ON CONFLICT(thread_id, hour, sender_id) DO UPDATE SET
+			messages    = messages + 1,
+			media       = media + excluded.media,
+			links       = links + excluded.links,
+			responses   = responses + excluded.responses,
+			response_ms = response_ms + excluded.response_ms`,
+		rec.ThreadID, rec.TimestampMs/msPerHour, rec.SenderID, boolToInt(rec.HasMedia), links, responses, responseMs); err != nil {
+		return err
+	}
+	day := rec.TimestampMs / msPerDay
+	for kind, terms := range map[string][]string{StatsTermWord: words, StatsTermDomain: domains} {
+		for _, term := range terms {
+			if _, err := tx.Exec(`
+				INSERT INTO stats_terms(thread_id, kind, day, sender_id, term, count) VALUES (?, ?, ?, ?, ?, 1)
+				ON CONFLICT(thread_id, kind, day, sender_id, term) DO UPDATE SET count = count + 1`,
+				rec.ThreadID, kind, day, rec.SenderID, term); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// BackfillStats counts up to limit of the messages that were stored before
+// migration 17, newest first. meta.stats_backfill_rowid is the highest
+// rowid not yet counted; messages stored since are counted as they are
+// written.
+func (s *SQLiteStore) BackfillStats(ctx context.Context, limit int) (int, error) {
+	var value string
+	err := s.readDB.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = 'stats_backfill_rowid'`).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	cursor, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("meta stats_backfill_rowid %q: %w", value, err)
+	}
+	if cursor <= 0 {
+		return 0, nil
+	}
+
+	rows, err := s.readDB.QueryContext(ctx, `
+		SELECT `+messageColumns+`, rowid
+		FROM messages WHERE rowid <= ?
+		ORDER BY rowid DESC LIMIT ?`, cursor, limit)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var batch []*core.MessageRecord
+	next := int64(0)
+	for rows.Next() {
+		var rowid int64
+		rec, err := s.scanMessageRow(rows, &rowid)
+		if err != nil {
+			return 0, err
+		}
+		batch = append(batch, rec)
+		next = rowid - 1
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+	if len(batch) < limit {
+		next = 0
+	}
+
+	err = s.ExecBatch(func(tx txExecer) error {
+		for _, rec := range batch {
+			if !countsInStats(rec) {
+				continue
+			}
+			if err := rollupMessageTx(tx, rec, !s.seal); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`UPDATE meta SET value = ? WHERE key = 'stats_backfill_rowid'`, strconv.FormatInt(next, 10))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
+
+// statsWhere selects the rollup rows of threadID in q's range, counted in
+// buckets of unitMs; a partly covered bucket is included.
+func statsWhere(threadID int64, q core.StatsQuery, column string, unitMs int64, bySender bool) (string, []any) {
+	where := []string{"thread_id = ?"}
+	args := []any{threadID}
+	if bySender && q.UserID != 0 {
+		where, args = append(where, "sender_id = ?"), append(args, q.UserID)
+	}
+	if !q.Since.IsZero() {
+		where, args = append(where, column+" >= ?"), append(args, q.Since.UnixMilli()/unitMs)
+	}
+	if !q.Until.IsZero() {
+		where, args = append(where, column+" < ?"), append(args, (q.Until.UnixMilli()+unitMs-1)/unitMs)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+func (s *SQLiteStore) StatsByHour(ctx context.Context, threadID int64, q core.StatsQuery) ([]StatsRow, error) {
+	where, args := statsWhere(threadID, q, "hour", msPerHour, true)
+	return s.statsRows(ctx, `
+		SELECT hour, 0, SUM(messages), SUM(media), SUM(links), SUM(responses), SUM(response_ms)
+		FROM stats_activity WHERE `+where+`
+		GROUP BY hour ORDER BY hour`, args...)
+}
+
+func (s *SQLiteStore) StatsBySender(ctx context.Context, threadID int64, q core.StatsQuery) ([]StatsRow, error) {
+	where, args := statsWhere(threadID, q, "hour", msPerHour, false)
+	return s.statsRows(ctx, `
+		SELECT 0, sender_id, SUM(messages) AS n, SUM(media), SUM(links), SUM(responses), SUM(response_ms)
+		FROM stats_activity WHERE `+where+`
+		GROUP BY sender_id ORDER BY n DESC, sender_id`, args...)
+}
+
+func (s *SQLiteStore) statsRows(ctx context.Context, query string, args ...any) ([]StatsRow, error) {
+	rows, err := s.readDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []StatsRow
+	for rows.Next() {
+		var r StatsRow
+		if err := rows.Scan(&r.Hour, &r.SenderID, &r.Messages, &r.Media, &r.Links, &r.Responses, &r.ResponseMs); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) StatsTopTerms(ctx context.Context, threadID int64, kind string, q core.StatsQuery) ([]core.TermCount, error) {
+	where, args := statsWhere(threadID, q, "day", msPerDay, true)
+	limit := q.Top
+	if limit <= 0 {
+		limit = 5
+	}
+	rows, err := s.readDB.QueryContext(ctx, `
+		SELECT term, SUM(count) AS n FROM stats_terms
+		WHERE kind = ? AND `+where+`
+		GROUP BY term ORDER BY n DESC, term LIMIT ?`, append(append([]any{kind}, args...), limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []core.TermCount
+	for rows.Next() {
+		var t core.TermCount
+		if err := rows.Scan(&t.Term, &t.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// ── Retention ───────────────────────────────────────────────────────────────
+
+// pruneKeep leaves out the last message the bot sent in each thread, which
+// edits and page navigation look up.
+const pruneKeep = `message_id NOT IN (SELECT message_id FROM thread_last_bot)`
+
+// pruneKeepPinned also leaves out the messages pinned in Messenger.
+const pruneKeepPinned = ` AND message_id NOT IN (SELECT message_id FROM message_pins)`
+
+func pruneWhere(keepPinned bool) string {
+	if keepPinned {
+		return pruneKeep + pruneKeepPinned
+	}
+	return pruneKeep
+}
+
+// PruneMessages deletes up to limit messages older than rule and returns how
+// many it deleted.
+func (s *SQLiteStore) PruneMessages(ctx context.Context, rule PruneRule, limit int) (int, error) {
+	ids, err := s.queryMessageIDs(ctx, `
+		SELECT message_id FROM messages
+		WHERE timestamp_ms < max(?, ?)
+		  AND ((is_from_bot = 0 AND timestamp_ms < ?) OR (is_from_bot = 1 AND timestamp_ms < ?))
+		  AND `+pruneWhere(rule.KeepPinned)+`
+		LIMIT ?`,
+		rule.BeforeMs, rule.BotBeforeMs, rule.BeforeMs, rule.BotBeforeMs, limit)
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), s.deleteMessages(ids)
+}
+
+// ThreadsOverMessageLimit returns the threads holding more than maxMessages messages
+// not sent by the bot.
+func (s *SQLiteStore) ThreadsOverMessageLimit(_ context.Context, maxMessages int) ([]int64, error) {
+	rows, err := s.readDB.Query(`
+		SELECT thread_id FROM messages
+		WHERE is_from_bot = 0
+		GROUP BY thread_id
+		HAVING COUNT(*) > ?
+		ORDER BY thread_id`, maxMessages)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// PruneThreadOverflow deletes up to limit messages of threadID past its keep
+// newest ones not sent by the bot, and returns how many it deleted.
+func (s *SQLiteStore) PruneThreadOverflow(ctx context.Context, threadID int64, keep int, keepPinned bool, limit int) (int, error) {
+	ids, err := s.queryMessageIDs(ctx, `
+		SELECT message_id FROM (
+			SELECT message_id FROM messages
+			WHERE thread_id = ? AND is_from_bot = 0
+			ORDER BY timestamp_ms DESC, message_id DESC
+			LIMIT -1 OFFSET ?)
+		WHERE `+pruneWhere(keepPinned)+`
+		LIMIT ?`, threadID, keep, limit)
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), s.deleteMessages(ids)
+}
+
+// SlimMessages empties the attachments and sender name snapshot of up to
+// limit messages older than beforeMs, and returns how many it changed.
+func (s *SQLiteStore) SlimMessages(_ context.Context, beforeMs int64, limit int) (int, error) {
+	res, err := s.writeDB.Exec(`
+		UPDATE messages SET attachments_json = '[]', sender_name_snapshot = ''
+		WHERE rowid IN (
+			SELECT rowid FROM messages
+			WHERE timestamp_ms < ?
+			  AND (attachments_json NOT IN ('[]', 'null') OR sender_name_snapshot != '')
+			  AND `+pruneKeep+`
+			LIMIT ?)`, beforeMs, limit)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// CheckpointWAL copies the write-ahead log into the database and truncates
+// it.
+func (s *SQLiteStore) CheckpointWAL(ctx context.Context) error {
+	_, err := s.writeDB.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// Vacuum rebuilds the database file to give free pages back to the disk,
+// then checkpoints the WAL it grew. Writes wait until it is done.
+func (s *SQLiteStore) Vacuum(ctx context.Context) error {
+	if _, err := s.writeDB.ExecContext(ctx, `VACUUM`); err != nil {
+		return err
+	}
+	if _, err := s.writeDB.ExecContext(ctx, `INSERT OR REPLACE INTO meta(key, value) VALUES('last_vacuum_ms', ?)`,
+		strconv.FormatInt(time.Now().UnixMilli(), 10)); err != nil {
+		return err
+	}
+	return s.CheckpointWAL(ctx)
+}
+
+// LastVacuumAt returns when Vacuum last ran, or the zero time.
+func (s *SQLiteStore) LastVacuumAt(ctx context.Context) (time.Time, error) {
+	var value string
+	err := s.readDB.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = 'last_vacuum_ms'`).Scan(&value)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("meta last_vacuum_ms %q: %w", value, err)
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (s *SQLiteStore) queryMessageIDs(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := s.readDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// deleteMessages deletes ids with their edits, pins and search entries in
+// one transaction.
+func (s *SQLiteStore) deleteMessages(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.ExecBatch(func(tx txExecer) error {
+		for _, id := range ids {
+			for _, q := range []string{
+				`DELETE FROM message_search WHERE rowid = (SELECT doc_id FROM message_search_docs WHERE message_id = ?)`,
+				`DELETE FROM message_search_docs WHERE message_id = ?`,
+				`DELETE FROM message_edits WHERE message_id = ?`,
+				`DELETE FROM message_pins WHERE message_id = ?`,
+				`DELETE FROM message_attachment_files WHERE message_id = ?`,
+				`DELETE FROM messages WHERE message_id = ?`,
+			} {
+				if _, err := tx.Exec(q, id); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// ── Snapshots ───────────────────────────────────────────────────────────────
+
+// Snapshot writes a consistent copy of the database to path, which must not
+// exist. It runs on a read connection, so message writes carry on.
+func (s *SQLiteStore) Snapshot(ctx context.Context, path string) error {
+	_, err := s.readDB.ExecContext(ctx, `VACUUM INTO ?`, path)
+	return err
+}
+
+// ── Encryption ──────────────────────────────────────────────────────────────
+
+// EnableEncryption seals the text and attachments of the messages and edits
+// written from now on with the current key of keys, and opens the ones
+// sealed with any of its keys; call it before the store is used. The words
+// and domains of the stats rollups (stats_terms) and, unless
+// keepSearchIndex, the search index hold the text in plaintext: they are
+// emptied and no longer kept. It fails when the database was sealed with a
+// key keys doesn't have.
+func (s *SQLiteStore) EnableEncryption(keys *encryption.Keyring, keepSearchIndex bool) error {
+	id, err := s.EncryptionKeyID()
+	if err != nil {
+		return err
+	}
+	if id != "" && !keys.Has(id) {
+		return fmt.Errorf("message database is encrypted with key %s, which is not in the keyring", id)
+	}
+	if _, err := s.writeDB.Exec(`DELETE FROM stats_terms`); err != nil {
+		return err
+	}
+	if !keepSearchIndex {
+		if _, err := s.writeDB.Exec(`DELETE FROM message_search; DELETE FROM message_search_docs`); err != nil {
+			return err
+		}
+	}
+	if id == "" {
+		// Everything stored is plaintext: escape what would pass for a
+		// sealed value once the key is recorded (rows written before
+		// sealText escaped them).
+		err := s.ExecBatch(func(tx txExecer) error {
+			for _, col := range []struct{ table, column string }{
+				{"messages", "text"}, {"messages", "attachments_json"}, {"message_edits", "text"},
+			} {
+				if _, err := tx.Exec(fmt.Sprintf(`UPDATE %[1]s SET %[2]s = 'enc:raw:' || %[2]s
+					WHERE substr(%[2]s, 1, 4) = 'enc:' AND substr(%[2]s, 1, 8) != 'enc:raw:'`, col.table, col.column)); err != nil {
+					return err
+				}
+			}
+			return s.setEncryptionKeyID(tx, keys.KeyID())
+		})
+		if err != nil {
+			return err
+		}
+		id = keys.KeyID()
+	}
+	s.keys, s.seal, s.noSearchIndex, s.keyID = keys, true, !keepSearchIndex, id
+	return nil
+}
+
+// DisableEncryption writes plaintext from now on, opening the values
+// sealed before with keys, which may be nil when there are none. It fails
+// when the database is encrypted and keys can't open it; Reencrypt then
+// decrypts what is stored.
+func (s *SQLiteStore) DisableEncryption(keys *encryption.Keyring) error {
+	id, err := s.EncryptionKeyID()
+	if err != nil {
+		return err
+	}
+	if id != "" && (keys == nil || !keys.Has(id)) {
+		return fmt.Errorf("message database is encrypted with key %s: enable encryption with that key, or decrypt it with \"bot rotate-key -decrypt\"", id)
+	}
+	s.keys, s.seal, s.noSearchIndex, s.keyID = keys, false, false, id
+	return nil
+}
+
+// EncryptionKeyID returns the ID of the key the stored messages are sealed
+// with, or "" when they aren't.
+func (s *SQLiteStore) EncryptionKeyID() (string, error) {
+	var id string
+	err := s.writeDB.QueryRow(`SELECT value FROM meta WHERE key = 'encryption_key_id'`).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+func (s *SQLiteStore) setEncryptionKeyID(tx txExecer, id string) error {
+	if id == "" {
+		_, err := tx.Exec(`DELETE FROM meta WHERE key = 'encryption_key_id'`)
+		return err
+	}
+	_, err := tx.Exec(`INSERT OR REPLACE INTO meta(key, value) VALUES('encryption_key_id', ?)`, id)
+	return err
+}
+
+// Reencrypt rewrites the text and attachments of every stored message and
+// edit, batch rows per transaction, as EnableEncryption or
+// DisableEncryption set: sealed with the current key, or in plaintext. The
+// search index is rebuilt when it is kept; stats_terms is emptied when
+// sealing, and isn't rebuilt when decrypting. It returns how many messages it
+// rewrote. Run VACUUM afterwards to drop the old values from free pages.
+func (s *SQLiteStore) Reencrypt(ctx context.Context, batch int) (int, error) {
+	if s.seal {
+		if _, err := s.writeDB.ExecContext(ctx, `DELETE FROM stats_terms`); err != nil {
+			return 0, err
+		}
+	}
+	total := 0
+	for after := int64(0); ; {
+		rows, err := s.readDB.QueryContext(ctx, `
+			SELECT `+messageColumns+`, rowid
+			FROM messages WHERE rowid > ?
+			ORDER BY rowid LIMIT ?`, after, batch)
+		if err != nil {
+			return total, err
+		}
+		var recs []*core.MessageRecord
+		for rows.Next() {
+			rec, err := s.scanMessageRow(rows, &after)
+			if err != nil {
+				rows.Close()
+				return total, err
+			}
+			recs = append(recs, rec)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, err
+		}
+		if len(recs) == 0 {
+			break
+		}
+		err = s.ExecBatch(func(tx txExecer) error {
+			for _, rec := range recs {
+				if _, err := tx.Exec(upsertMessageSQL, s.messageArgs(rec)...); err != nil {
+					return err
+				}
+				if !s.noSearchIndex {
+					if err := indexMessageTx(tx, rec); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += len(recs)
+	}
+
+	for after := int64(0); ; {
+		rows, err := s.readDB.QueryContext(ctx, `
+			SELECT message_id, thread_id, text, timestamp_ms, recorded_at_ms, rowid
+			FROM message_edits WHERE rowid > ?
+			ORDER BY rowid LIMIT ?`, after, batch)
+		if err != nil {
+			return total, err
+		}
+		var edits []*core.MessageEdit
+		for rows.Next() {
+			rec, err := s.scanEditRow(rows, &after)
+			if err != nil {
+				rows.Close()
+				return total, err
+			}
+			edits = append(edits, rec)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, err
+		}
+		if len(edits) == 0 {
+			break
+		}
+		err = s.ExecBatch(func(tx txExecer) error {
+			for _, rec := range edits {
+				if _, err := tx.Exec(`UPDATE message_edits SET text = ? WHERE message_id = ? AND timestamp_ms = ?`,
+					s.sealText(rec.Text), rec.MessageID, rec.TimestampMs); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+	}
+
+	id := ""
+	if s.seal {
+		id = s.keys.KeyID()
+	}
+	if err := s.setEncryptionKeyID(s.writeDB, id); err != nil {
+		return total, err
+	}
+	s.keyID = id
+	return total, nil
+}
+
+// ── Dump ────────────────────────────────────────────────────────────────────
+
+// Dump reads every record of the Store tables, for CopyStore.
+func (s *SQLiteStore) Dump(ctx context.Context, fn func(DumpRecord) error) error {
+	tables := []struct {
+		query string
+		scan  func(*sql.Rows) (DumpRecord, error)
+	}{
+		{`SELECT ` + threadColumns + ` FROM threads ORDER BY thread_id`, func(rows *sql.Rows) (DumpRecord, error) {
+			rec, err := scanThread(rows)
+			return DumpRecord{Thread: rec}, err
+		}},
+		{`SELECT user_id, name, updated_at_ms, deleted FROM users ORDER BY user_id`, func(rows *sql.Rows) (DumpRecord, error) {
+			rec := &core.UserRecord{}
+			var deleted int
+			err := rows.Scan(&rec.UserID, &rec.Name, &rec.UpdatedAtUnixMs, &deleted)
+			rec.Deleted = deleted != 0
+			return DumpRecord{User: rec}, err
+		}},
+		{`SELECT ` + messageColumns + ` FROM messages ORDER BY thread_id, timestamp_ms, message_id`, func(rows *sql.Rows) (DumpRecord, error) {
+			rec, err := s.scanMessageRow(rows)
+			return DumpRecord{Message: rec}, err
+		}},
+		{`SELECT message_id, thread_id, text, timestamp_ms, recorded_at_ms FROM message_edits ORDER BY message_id, timestamp_ms`, func(rows *sql.Rows) (DumpRecord, error) {
+			rec, err := s.scanEditRow(rows)
+			return DumpRecord{Edit: rec}, err
+		}},
+		{`SELECT thread_id, message_id FROM thread_last_bot ORDER BY thread_id`, func(rows *sql.Rows) (DumpRecord, error) {
+			rec := &LastBotMessage{}
+			err := rows.Scan(&rec.ThreadID, &rec.MessageID)
+			return DumpRecord{LastBot: rec}, err
+		}},
+		{`SELECT thread_id, message_id, pinned_at_ms FROM message_pins ORDER BY thread_id, message_id`, func(rows *sql.Rows) (DumpRecord, error) {
+			rec := &core.MessagePin{}
+			err := rows.Scan(&rec.ThreadID, &rec.MessageID, &rec.PinnedAtUnixMs)
+			return DumpRecord{Pin: rec}, err
+		}},
+		{`SELECT ` + participantColumns + ` FROM thread_participants ORDER BY thread_id, user_id`, func(rows *sql.Rows) (DumpRecord, error) {
+			p := &core.ThreadParticipant{}
+			var isAdmin int
+			err := rows.Scan(&p.ThreadID, &p.UserID, &p.Nickname, &isAdmin, &p.UpdatedAtUnixMs)
+			p.IsAdmin = isAdmin != 0
+			return DumpRecord{Participant: p}, err
+		}},
+		{`SELECT ` + pollColumns + ` FROM polls ORDER BY poll_id`, func(rows *sql.Rows) (DumpRecord, error) {
+			p := &core.Poll{}
+			var status string
+			err := rows.Scan(&p.ID, &p.ThreadID, &p.CreatorID, &p.Question, &p.MessageID, &status,
+				&p.ClosesAtUnixMs, &p.ClosedAtUnixMs, &p.CreatedAtUnixMs, &p.UpdatedAtUnixMs)
+			p.Status = core.PollStatus(status)
+			return DumpRecord{Poll: p}, err
+		}},
+		{`SELECT poll_id, option_id, text, position FROM poll_options ORDER BY poll_id, position, option_id`, func(rows *sql.Rows) (DumpRecord, error) {
+			o := &core.PollOption{}
+			err := rows.Scan(&o.PollID, &o.OptionID, &o.Text, &o.Position)
+			return DumpRecord{PollOption: o}, err
+		}},
+		{`SELECT poll_id, option_id, user_id, voted_at_ms FROM poll_votes ORDER BY poll_id, voted_at_ms, user_id`, func(rows *sql.Rows) (DumpRecord, error) {
+			v := &core.PollVote{}
+			err := rows.Scan(&v.PollID, &v.OptionID, &v.UserID, &v.VotedAtUnixMs)
+			return DumpRecord{PollVote: v}, err
+		}},
+	}
+	for _, t := range tables {
+		if err := s.dumpTable(ctx, t.query, t.scan, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) dumpTable(ctx context.Context, query string, scan func(*sql.Rows) (DumpRecord, error), fn func(DumpRecord) error) error {
+	rows, err := s.readDB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rec, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ── Helpers ─────────────────────────────────────────────────────────────────
+
+func (s *SQLiteStore) scanMessage(row *sql.Row) (*core.MessageRecord, error) {
+	rec := &core.MessageRecord{}
+	var isFromBot, hasMedia, isEdited, isRecalled int
+	var attachJSON, mentionsJSON string
+	err := row.Scan(
+		&rec.MessageID, &rec.ThreadID, &rec.SenderID, &rec.SenderNameSnapshot, &rec.Text,
+		&rec.ReplyToMessageID, &rec.OfflineThreadingID, &isFromBot, &hasMedia,
+		&attachJSON, &mentionsJSON, &rec.TimestampMs, &rec.EditCount, &isEdited, &isRecalled,
+		&rec.CreatedAtUnixMs, &rec.UpdatedAtUnixMs, &rec.RecalledAtUnixMs,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec.IsFromBot = isFromBot != 0
+	rec.HasMedia = hasMedia != 0
+	rec.IsEdited = isEdited != 0
+	rec.IsRecalled = isRecalled != 0
+	if err := s.openMessage(rec, &attachJSON); err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(attachJSON), &rec.Attachments)
+	_ = json.Unmarshal([]byte(mentionsJSON), &rec.Mentions)
+	return rec, nil
+}
+
+// scanMessageRow scans messageColumns, followed by the columns of extra.
+func (s *SQLiteStore) scanMessageRow(rows *sql.Rows, extra ...any) (*core.MessageRecord, error) {
+	rec := &core.MessageRecord{}
+	var isFromBot, hasMedia, isEdited, isRecalled int
+	var attachJSON, mentionsJSON string
+	err := rows.Scan(append([]any{
+		&rec.MessageID, &rec.ThreadID, &rec.SenderID, &rec.SenderNameSnapshot, &rec.Text,
+		&rec.ReplyToMessageID, &rec.OfflineThreadingID, &isFromBot, &hasMedia,
+		&attachJSON, &mentionsJSON, &rec.TimestampMs, &rec.EditCount, &isEdited, &isRecalled,
+		&rec.CreatedAtUnixMs, &rec.UpdatedAtUnixMs, &rec.RecalledAtUnixMs,
+	}, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	rec.IsFromBot = isFromBot != 0
+	rec.HasMedia = hasMedia != 0
+	rec.IsEdited = isEdited != 0
+	rec.IsRecalled = isRecalled != 0
+	if err := s.openMessage(rec, &attachJSON); err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(attachJSON), &rec.Attachments)
+	_ = json.Unmarshal([]byte(mentionsJSON), &rec.Mentions)
+	return rec, nil
+}
+
+// scanEditRow scans the message_edits columns message_id, thread_id, text,
+// timestamp_ms and recorded_at_ms, followed by the columns of extra.
+func (s *SQLiteStore) scanEditRow(rows *sql.Rows, extra ...any) (*core.MessageEdit, error) {
+	rec := &core.MessageEdit{}
+	if err := rows.Scan(append([]any{&rec.MessageID, &rec.ThreadID, &rec.Text, &rec.TimestampMs, &rec.RecordedAtUnixMs}, extra...)...); err != nil {
+		return nil, err
+	}
+	text, err := s.openText(rec.Text)
+	if err != nil {
+		return nil, fmt.Errorf("edit of message %s: %w", rec.MessageID, err)
+	}
+	rec.Text = text
+	return rec, nil
+}
+
+// openMessage decrypts the text of rec and attachJSON when they are sealed.
+func (s *SQLiteStore) openMessage(rec *core.MessageRecord, attachJSON *string) error {
+	text, err := s.openText(rec.Text)
+	if err != nil {
+		return fmt.Errorf("message %s: %w", rec.MessageID, err)
+	}
+	attachments, err := s.openText(*attachJSON)
+	if err != nil {
+		return fmt.Errorf("message %s attachments: %w", rec.MessageID, err)
+	}
+	rec.Text, *attachJSON = text, attachments
+	return nil
+}
+
+// openText returns the plaintext of a stored value. Values that look
+// sealed are only opened while the database has an encryption key
+// recorded; before that they are plaintext a user wrote.
+func (s *SQLiteStore) openText(v string) (string, error) {
+	if s.keyID == "" {
+		return encryption.Unescape(v), nil
+	}
+	return s.keys.Open(v)
+}
+
+// sealText seals v when encryption is enabled, and otherwise escapes it so
+// it is never taken for a sealed value.
+func (s *SQLiteStore) sealText(v string) string {
+	if !s.seal {
+		return encryption.Escape(v)
+	}
+	return s.keys.Seal(v)
 }
 
 func boolToInt(b bool) int {
@@ -3,6 +3,7 @@ package messaging
 import (
 	"context"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"mybot/internal/core"
@@ -85,6 +86,44 @@ func TestSQLiteStorePersistsAcrossReopen(t *testing.T) {
 	}
 }
 
+func TestSQLiteStoreMentionsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	message := &core.MessageRecord{
+		MessageID:       "m1",
+		ThreadID:        123,
+		SenderID:        456,
+		Text:            "hello @Bob and @Đức",
+		Mentions:        []core.Mention{{UserID: 789, Offset: 6, Length: 4}, {UserID: 790, Offset: 15, Length: 4}},
+		TimestampMs:     1000,
+		CreatedAtUnixMs: 1000,
+		UpdatedAtUnixMs: 1000,
+	}
+	if err := store.UpsertMessage(ctx, message); err != nil {
+		t.Fatalf("UpsertMessage() error = %v", err)
+	}
+	got, err := store.GetMessage(ctx, message.MessageID)
+	if err != nil {
+		t.Fatalf("GetMessage() error = %v", err)
+	}
+	if got == nil || !reflect.DeepEqual(got.Mentions, message.Mentions) {
+		t.Fatalf("GetMessage() = %+v, want mentions %+v", got, message.Mentions)
+	}
+
+	plain := &core.MessageRecord{MessageID: "m2", ThreadID: 123, Text: "hello", TimestampMs: 2000}
+	if err := store.UpsertMessage(ctx, plain); err != nil {
+		t.Fatalf("UpsertMessage() error = %v", err)
+	}
+	if got, err := store.GetMessage(ctx, plain.MessageID); err != nil || got == nil || len(got.Mentions) != 0 {
+		t.Fatalf("GetMessage(no mentions) = %+v, %v", got, err)
+	}
+}
+
 func TestSQLiteStoreListThreadMessages(t *testing.T) {
 	ctx := context.Background()
 	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
@@ -0,0 +1,285 @@
+package messaging
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+// Kinds of term counted in the stats rollups.
+const (
+	StatsTermWord   = "word"
+	StatsTermDomain = "domain"
+)
+
+const (
+	// statsResponseWindow is the longest gap after someone else's message
+	// still counted as answering it.
+	statsResponseWindow = time.Hour
+	// statsMaxTerms caps the words counted for one message, so pasted text
+	// does not flood the rollups.
+	statsMaxTerms = 50
+	// statsBackfillDelay is how long after start the backfill begins, so it
+	// does not compete with the initial sync.
+	statsBackfillDelay = time.Minute
+	statsBackfillBatch = 500
+	statsBackfillPause = 100 * time.Millisecond
+)
+
+// StatsRow sums rows of the activity rollup.
+type StatsRow struct {
+	Hour       int64 // hours since the Unix epoch; set by StatsByHour
+	SenderID   int64 // set by StatsBySender
+	Messages   int64
+	Media      int64 // messages with attachments
+	Links      int64
+	Responses  int64
+	ResponseMs int64 // summed over Responses
+}
+
+// StatsStore reads the rollups the store updates as it writes messages.
+// Queries select the rows of q's time range and, except for StatsBySender,
+// of q.UserID.
+type StatsStore interface {
+	// StatsByHour sums the activity of threadID per hour, oldest first.
+	StatsByHour(ctx context.Context, threadID int64, q core.StatsQuery) ([]StatsRow, error)
+	// StatsBySender sums the activity of every sender in threadID, most
+	// messages first.
+	StatsBySender(ctx context.Context, threadID int64, q core.StatsQuery) ([]StatsRow, error)
+	// StatsTopTerms returns the q.Top terms of kind used in the most
+	// messages.
+	StatsTopTerms(ctx context.Context, threadID int64, kind string, q core.StatsQuery) ([]core.TermCount, error)
+	// BackfillStats counts up to limit of the messages stored before the
+	// rollups existed and returns how many it read; 0 once all are counted.
+	BackfillStats(ctx context.Context, limit int) (int, error)
+}
+
+// EnableStats serves ThreadStats from store and counts the messages stored
+// before its rollups existed in the background.
+func (s *Service) EnableStats(store StatsStore) {
+	s.stats = store
+	b := &StatsBackfill{
+		log:   s.log.With().Str("component", "stats").Logger(),
+		store: store,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	s.statsBackfill = b
+	go b.run()
+}
+
+// ThreadStats sums the activity of threadID over q's time range from the
+// rollups: totals, the q.Top most active senders (5 by default), messages
+// per hour and day in the thread's time zone, and the top words and link
+// domains. With q.UserID set the totals are that user's, ranked against
+// the thread's.
+func (s *Service) ThreadStats(ctx context.Context, threadID int64, q core.StatsQuery) (*core.ThreadStats, error) {
+	if s.stats == nil {
+		return nil, ErrStatsDisabled
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Until.After(q.Since) {
+		return nil, ErrInvalidRequest
+	}
+	if q.Top <= 0 {
+		q.Top = 5
+	}
+
+	senders, err := s.stats.StatsBySender(ctx, threadID, q)
+	if err != nil {
+		return nil, err
+	}
+	st := &core.ThreadStats{}
+	var responseMs int64
+	st.ActiveMembers = len(senders)
+	for i, row := range senders {
+		if q.UserID != 0 {
+			st.ThreadMessages += row.Messages
+			if row.SenderID != q.UserID {
+				continue
+			}
+			st.Rank = i + 1
+		}
+		st.Messages += row.Messages
+		st.MediaMessages += row.Media
+		st.Links += row.Links
+		st.Responses += row.Responses
+		responseMs += row.ResponseMs
+		if len(st.TopSenders) < q.Top {
+			st.TopSenders = append(st.TopSenders, senderStats(row))
+		}
+	}
+	if st.Responses > 0 {
+		st.AvgResponse = time.Duration(responseMs/st.Responses) * time.Millisecond
+	}
+
+	hours, err := s.stats.StatsByHour(ctx, threadID, q)
+	if err != nil {
+		return nil, err
+	}
+	loc := s.ThreadLocation(threadID)
+	for _, row := range hours {
+		t := time.Unix(row.Hour*3600, 0).In(loc)
+		st.Hours[t.Hour()] += row.Messages
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		if n := len(st.Days); n > 0 && st.Days[n-1].Day.Equal(day) {
+			st.Days[n-1].Messages += row.Messages
+		} else {
+			st.Days = append(st.Days, core.DayActivity{Day: day, Messages: row.Messages})
+		}
+	}
+
+	if st.TopWords, err = s.stats.StatsTopTerms(ctx, threadID, StatsTermWord, q); err != nil {
+		return nil, err
+	}
+	if st.TopDomains, err = s.stats.StatsTopTerms(ctx, threadID, StatsTermDomain, q); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func senderStats(row StatsRow) core.SenderStats {
+	out := core.SenderStats{
+		UserID:        row.SenderID,
+		Messages:      row.Messages,
+		MediaMessages: row.Media,
+		Links:         row.Links,
+		Responses:     row.Responses,
+	}
+	if row.Responses > 0 {
+		out.AvgResponse = time.Duration(row.ResponseMs/row.Responses) * time.Millisecond
+	}
+	return out
+}
+
+// StatsBackfill counts the messages stored before the stats rollups
+// existed, newest first, in small batches.
+type StatsBackfill struct {
+	log   zerolog.Logger
+	store StatsStore
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Close stops the backfill between two batches; it resumes on the next
+// start.
+func (b *StatsBackfill) Close() {
+	b.stopOnce.Do(func() { close(b.stop) })
+	<-b.done
+}
+
+func (b *StatsBackfill) run() {
+	defer close(b.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-b.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	start := time.Now()
+	wait := statsBackfillDelay
+	total := 0
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-b.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		wait = statsBackfillPause
+
+		n, err := b.store.BackfillStats(ctx, statsBackfillBatch)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			b.log.Warn().Err(err).Int("messages", total).Msg("Stats backfill failed; it resumes on the next start")
+			return
+		}
+		total += n
+		if n == 0 {
+			break
+		}
+	}
+	if total > 0 {
+		b.log.Info().Int("messages", total).Dur("took", time.Since(start)).Msg("Stats backfill done")
+	}
+}
+
+// countsInStats reports whether rec is counted in the stats rollups: the
+// bot's own and recalled messages are not, nor those without a time.
+func countsInStats(rec *core.MessageRecord) bool {
+	return rec.ThreadID != 0 && rec.SenderID != 0 && rec.TimestampMs > 0 && !rec.IsFromBot && !rec.IsRecalled
+}
+
+// linkPattern matches URLs, and bare domains with a common top-level domain
+// ("youtube.com/watch?v=…").
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+|\b(?:[a-z0-9-]+\.)+(?:com|net|org|vn|io|me|tv|gg|ly|co)\b(?:/[^\s<>"]*)?`)
+
+// statsTerms returns the distinct words and link domains of text and how
+// many links it has. Mentions, links, numbers, one-letter words and
+// stop-words are not words.
+func statsTerms(text string, mentions []core.Mention) (words, domains []string, links int) {
+	if len(mentions) > 0 {
+		units := utf16.Encode([]rune(text))
+		for _, m := range mentions {
+			for i := max(m.Offset, 0); i < m.Offset+m.Length && i < len(units); i++ {
+				units[i] = ' '
+			}
+		}
+		text = string(utf16.Decode(units))
+	}
+
+	seen := make(map[string]bool)
+	text = linkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		links++
+		if domain := linkDomain(link); domain != "" && !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+		return " "
+	})
+
+	clear(seen)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if n := utf8.RuneCountInString(w); n < 2 || n > 30 || seen[w] || isStopWord(w) || !strings.ContainsFunc(w, unicode.IsLetter) {
+			continue
+		}
+		seen[w] = true
+		if words = append(words, w); len(words) == statsMaxTerms {
+			break
+		}
+	}
+	return words, domains, links
+}
+
+// linkDomain returns the host of link without "www.", or "" when it has
+// none.
+func linkDomain(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(strings.TrimRight(link, ".,;:!?)]}'"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
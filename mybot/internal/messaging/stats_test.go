@@ -0,0 +1,167 @@
+package messaging
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"mybot/internal/core"
+)
+
+func TestStatsTerms(t *testing.T) {
+	words, domains, links := statsTerms(
+		"@Nam ơi tối nay đi ăn PHỞ không, phở Hà Nội 2026 nhé https://www.youtube.com/watch?v=1 và youtube.com/x, www.tiktok.com/@a.",
+		[]core.Mention{{UserID: 7, Offset: 0, Length: 4}})
+	if want := []string{"tối", "ăn", "phở", "hà", "nội"}; !slices.Equal(words, want) {
+		t.Errorf("words = %q, want %q", words, want)
+	}
+	if want := []string{"youtube.com", "tiktok.com"}; !slices.Equal(domains, want) || links != 3 {
+		t.Errorf("domains = %q, links = %d; want %q, 3", domains, links, want)
+	}
+	if words, _, _ := statsTerms("ko biết dc k, ok 👍", nil); !slices.Equal(words, []string{"biết"}) {
+		t.Errorf("words = %q, want only biết", words)
+	}
+}
+
+func TestThreadStatsRollups(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	batched := NewBatchedStore(store, zerolog.Nop(), 10, 10, 5)
+	service := NewService(zerolog.Nop(), batched, func() int64 { return 42 }, func() Transport { return nil }, nil)
+	defer service.Close()
+	loc := time.FixedZone("ICT", 7*3600)
+	service.SetThreadLocations(func(int64) *time.Location { return loc })
+
+	if _, err := service.ThreadStats(ctx, 1001, core.StatsQuery{}); err != ErrStatsDisabled {
+		t.Fatalf("ThreadStats() before EnableStats error = %v, want ErrStatsDisabled", err)
+	}
+	service.EnableStats(store)
+
+	// 20:00 on 18/10 and 09:00 on 19/10, thread time.
+	evening := time.Date(2026, 10, 18, 20, 0, 0, 0, loc)
+	morning := time.Date(2026, 10, 19, 9, 0, 0, 0, loc)
+	for _, m := range []*core.MessageRecord{
+		{MessageID: "m1", SenderID: 7, Text: "tối nay ăn phở không?", TimestampMs: evening.UnixMilli()},
+		{MessageID: "m2", SenderID: 8, Text: "phở Hà Nội nhé https://maps.google.com/x", TimestampMs: evening.Add(2 * time.Minute).UnixMilli()},
+		{MessageID: "m3", SenderID: 42, Text: "phở phở phở", IsFromBot: true, TimestampMs: evening.Add(3 * time.Minute).UnixMilli()},
+		{MessageID: "m4", SenderID: 7, Text: "ok phở", HasMedia: true, TimestampMs: evening.Add(6 * time.Minute).UnixMilli()},
+		{MessageID: "m5", SenderID: 9, Text: "bún chả", TimestampMs: morning.UnixMilli()},
+		{MessageID: "m6", SenderID: 7, Text: "ai đi không", ThreadID: 2002, TimestampMs: morning.UnixMilli()},
+	} {
+		if m.ThreadID == 0 {
+			m.ThreadID = 1001
+		}
+		if err := batched.UpsertMessage(ctx, m); err != nil {
+			t.Fatalf("UpsertMessage(%s) error = %v", m.MessageID, err)
+		}
+	}
+	// Storing a message again (an edit, a resync) doesn't count it twice.
+	if err := batched.UpsertMessage(ctx, &core.MessageRecord{MessageID: "m1", ThreadID: 1001, SenderID: 7, Text: "tối nay ăn phở không??", TimestampMs: evening.UnixMilli(), IsEdited: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := service.ThreadStats(ctx, 1001, core.StatsQuery{Top: 2})
+	if err != nil {
+		t.Fatalf("ThreadStats() error = %v", err)
+	}
+	if st.Messages != 4 || st.MediaMessages != 1 || st.Links != 1 || st.ActiveMembers != 3 {
+		t.Errorf("totals = %d messages, %d media, %d links, %d members; want 4, 1, 1, 3", st.Messages, st.MediaMessages, st.Links, st.ActiveMembers)
+	}
+	if len(st.TopSenders) != 2 || st.TopSenders[0].UserID != 7 || st.TopSenders[0].Messages != 2 {
+		t.Errorf("TopSenders = %+v", st.TopSenders)
+	}
+	// m2 answered m1 after 2 minutes and m4 answered m2 after 4; m5 came the
+	// next morning.
+	if st.Responses != 2 || st.AvgResponse != 3*time.Minute {
+		t.Errorf("responses = %d, avg %v; want 2, 3m", st.Responses, st.AvgResponse)
+	}
+	if st.Hours[20] != 3 || st.Hours[9] != 1 {
+		t.Errorf("Hours = %v", st.Hours)
+	}
+	wantDays := []core.DayActivity{
+		{Day: time.Date(2026, 10, 18, 0, 0, 0, 0, loc), Messages: 3},
+		{Day: time.Date(2026, 10, 19, 0, 0, 0, 0, loc), Messages: 1},
+	}
+	if len(st.Days) != 2 || !st.Days[0].Day.Equal(wantDays[0].Day) || st.Days[0].Messages != 3 || !st.Days[1].Day.Equal(wantDays[1].Day) {
+		t.Errorf("Days = %+v, want %+v", st.Days, wantDays)
+	}
+	if want := []core.TermCount{{Term: "phở", Count: 3}, {Term: "bún", Count: 1}}; !slices.Equal(st.TopWords, want) {
+		t.Errorf("TopWords = %+v, want %+v", st.TopWords, want)
+	}
+	if want := []core.TermCount{{Term: "maps.google.com", Count: 1}}; !slices.Equal(st.TopDomains, want) {
+		t.Errorf("TopDomains = %+v, want %+v", st.TopDomains, want)
+	}
+
+	st, err = service.ThreadStats(ctx, 1001, core.StatsQuery{UserID: 8, Since: morning.Add(-24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("ThreadStats(user) error = %v", err)
+	}
+	if st.Messages != 1 || st.Rank != 2 || st.ThreadMessages != 4 || st.ActiveMembers != 3 || st.Responses != 1 || st.AvgResponse != 2*time.Minute {
+		t.Errorf("user stats = %+v", st)
+	}
+	st, err = service.ThreadStats(ctx, 1001, core.StatsQuery{Since: morning})
+	if err != nil || st.Messages != 1 || st.ActiveMembers != 1 || st.Responses != 0 {
+		t.Errorf("ThreadStats(since morning) = %+v, %v", st, err)
+	}
+	if _, err := service.ThreadStats(ctx, 1001, core.StatsQuery{Since: morning, Until: evening}); err != ErrInvalidRequest {
+		t.Errorf("ThreadStats(empty range) error = %v, want ErrInvalidRequest", err)
+	}
+}
+
+func TestBackfillStats(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	base := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		rec := &core.MessageRecord{MessageID: string(rune('a' + i)), ThreadID: 1001, SenderID: int64(7 + i%2), Text: "phở", TimestampMs: base.Add(time.Duration(i) * time.Minute).UnixMilli()}
+		if err := store.UpsertMessage(ctx, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// As if the first three were stored before migration 17.
+	if _, err := store.writeDB.Exec(`DELETE FROM stats_activity; DELETE FROM stats_terms;
+		UPDATE meta SET value = '3' WHERE key = 'stats_backfill_rowid'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.writeDB.Exec(`INSERT INTO stats_activity(thread_id, hour, sender_id, messages) VALUES (1001, ?, 7, 1), (1001, ?, 8, 1)`,
+		base.UnixMilli()/msPerHour, base.UnixMilli()/msPerHour); err != nil {
+		t.Fatal(err)
+	}
+
+	var read []int
+	for {
+		n, err := store.BackfillStats(ctx, 2)
+		if err != nil {
+			t.Fatalf("BackfillStats() error = %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		read = append(read, n)
+	}
+	if !slices.Equal(read, []int{2, 1}) {
+		t.Errorf("BackfillStats() batches = %v, want [2 1]", read)
+	}
+	rows, err := store.StatsBySender(ctx, 1001, core.StatsQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].SenderID != 7 || rows[0].Messages != 3 || rows[1].Messages != 2 {
+		t.Errorf("StatsBySender() = %+v", rows)
+	}
+	if terms, _ := store.StatsTopTerms(ctx, 1001, StatsTermWord, core.StatsQuery{}); len(terms) != 1 || terms[0].Count != 3 {
+		t.Errorf("StatsTopTerms() = %+v, want phở counted for the 3 backfilled messages", terms)
+	}
+}
@@ -0,0 +1,40 @@
+package messaging
+
+import "strings"
+
+// stopWords are left out of the top words: Vietnamese function words,
+// pronouns and chat fillers, with the accentless and abbreviated forms
+// people type, and a few English ones. Vietnamese words are counted by
+// syllable, so the list holds syllables.
+var stopWords = func() map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(`
+		à á ạ ả ã ai anh ấy bà bạn bao bên bị bởi cả các cái cần càng cậu chỉ
+		chị cho chớ chứ chưa chuyện có cô còn của cùng cũng đã đang đâu đây để
+		đến đều đi đó đấy được em gì giờ hả hay hết hơn hở khi không kia là lại
+		làm lắm lên luôn mà mày mấy mình mới một nào này nên nếu ngay người nha
+		nhé nhỉ nhiều như những nó nữa ông ơi ở ra rằng rất rồi sao sau sẽ so
+		tại tao thà thấy thế thì thôi tôi tớ trên trong từ và vào vẫn vậy về vì
+		với vừa xong ừ ừm ờ ô ồ uh uhm ok oke okay haha hihi hehe huhu kaka
+
+		a ah ay ba ban bi boi ca cac cai can cau chi cho chu chua co con cua
+		cung da dang dau day de den deu di do duoc em gi gio ha hay het hon khi
+		khong kia la lai lam len luon ma may minh moi mot nao nay nen neu
+		nguoi nha nhe nhi nhieu nhu nhung no nua ong oi ra rang rat roi sao se
+		tai thay the thi thoi toi to tren trong tu va vao van vay ve vi voi
+		vua xong u um o
+
+		ko k hk hok khum kh dc đc đk j cx cg vs ns bik bít r ròi zậy zị z v
+		thik mk mik t m b e a ak ạk nhá nhen nè ne nhó hông hem
+
+		the an and or of to in on at is are was be it this that for with you
+		i me my we he she they not no yes so just what lol
+	`) {
+		set[w] = true
+	}
+	return set
+}()
+
+func isStopWord(w string) bool {
+	return stopWords[w]
+}
@@ -12,14 +12,53 @@ type Store interface {
 	Close() error
 	UpsertThread(ctx context.Context, rec *core.ThreadRecord) error
 	GetThread(ctx context.Context, threadID int64) (*core.ThreadRecord, error)
+	// ListThreads returns every thread not marked deleted.
+	ListThreads(ctx context.Context) ([]*core.ThreadRecord, error)
 	UpsertUser(ctx context.Context, rec *core.UserRecord) error
 	GetUser(ctx context.Context, userID int64) (*core.UserRecord, error)
 	UpsertMessage(ctx context.Context, rec *core.MessageRecord) error
 	GetMessage(ctx context.Context, messageID string) (*core.MessageRecord, error)
 	ListThreadMessages(ctx context.Context, threadID int64, limit int, beforeMessageID string) ([]*core.MessageRecord, error)
+	// QueryMessages, QueryThreads and QueryUsers implement the
+	// ConversationReader methods of the same name; see query.go.
+	QueryMessages(ctx context.Context, q core.MessageQuery) ([]*core.MessageRecord, error)
+	QueryThreads(ctx context.Context, q core.ThreadQuery) ([]*core.ThreadRecord, error)
+	QueryUsers(ctx context.Context, q core.UserQuery) ([]*core.UserRecord, error)
 	SetLastBotMessage(ctx context.Context, threadID int64, messageID string) error
 	GetLastBotMessage(ctx context.Context, threadID int64) (*core.MessageRecord, error)
 	ClearLastBotMessage(ctx context.Context, threadID int64, messageID string) error
+	UpsertMessageEdit(ctx context.Context, rec *core.MessageEdit) error
+	ListMessageEdits(ctx context.Context, messageID string) ([]*core.MessageEdit, error)
+	// SetMessagePinned records a pin; a zero PinnedAtUnixMs removes it.
+	SetMessagePinned(ctx context.Context, rec *core.MessagePin) error
+	// ClearPinnedMessages removes every pin of threadID.
+	ClearPinnedMessages(ctx context.Context, threadID int64) error
+	// ListPinnedMessages returns the pins of threadID, latest first.
+	ListPinnedMessages(ctx context.Context, threadID int64) ([]*core.MessagePin, error)
+	// UpsertParticipant records the current state of a group member.
+	UpsertParticipant(ctx context.Context, rec *core.ThreadParticipant) error
+	GetParticipant(ctx context.Context, threadID, userID int64) (*core.ThreadParticipant, error)
+	// ListParticipants returns the members of threadID, admins first.
+	ListParticipants(ctx context.Context, threadID int64) ([]*core.ThreadParticipant, error)
+	DeleteParticipant(ctx context.Context, threadID, userID int64) error
+	// SetParticipantsAdmin sets IsAdmin of every known member of threadID.
+	SetParticipantsAdmin(ctx context.Context, threadID int64, isAdmin bool) error
+	UpsertPoll(ctx context.Context, rec *core.Poll) error
+	GetPoll(ctx context.Context, pollID int64) (*core.Poll, error)
+	// ListPolls returns the latest limit polls of threadID, newest first.
+	ListPolls(ctx context.Context, threadID int64, limit int) ([]*core.Poll, error)
+	// ListDuePolls returns open polls whose deadline is at or before untilMs,
+	// soonest first.
+	ListDuePolls(ctx context.Context, untilMs int64) ([]*core.Poll, error)
+	// NextPollCloseAt returns the soonest deadline of an open poll, or 0.
+	NextPollCloseAt(ctx context.Context) (int64, error)
+	UpsertPollOption(ctx context.Context, rec *core.PollOption) error
+	// ListPollOptions returns the options of pollID in creation order.
+	ListPollOptions(ctx context.Context, pollID int64) ([]*core.PollOption, error)
+	UpsertPollVote(ctx context.Context, rec *core.PollVote) error
+	// ReplacePollVotes replaces every stored vote of pollID with votes.
+	ReplacePollVotes(ctx context.Context, pollID int64, votes []*core.PollVote) error
+	ListPollVotes(ctx context.Context, pollID int64) ([]*core.PollVote, error)
 }
 
 // BatchedStore wraps a Store with a WriteBatcher that groups writes into
@@ -31,7 +70,7 @@ type BatchedStore struct {
 
 // NewBatchedStore wraps store with batching. Caller must call Close() to
 // flush pending writes and shut down the batcher goroutine.
-func NewBatchedStore(store *SQLiteStore, log zerolog.Logger, queueSize, maxBatch, flushMs int) *BatchedStore {
+func NewBatchedStore(store Store, log zerolog.Logger, queueSize, maxBatch, flushMs int) *BatchedStore {
 	return &BatchedStore{
 		Store:   store,
 		batcher: NewWriteBatcher(store, log, queueSize, maxBatch, flushMs),
@@ -61,6 +100,10 @@ func (b *BatchedStore) ClearLastBotMessage(_ context.Context, threadID int64, me
 	return b.batcher.Submit(writeOp{kind: opClearLastBotByThread, threadID: threadID})
 }
 
+func (b *BatchedStore) UpsertMessageEdit(_ context.Context, rec *core.MessageEdit) error {
+	return b.batcher.Submit(writeOp{kind: opUpsertMessageEdit, edit: rec})
+}
+
 func (b *BatchedStore) Close() error {
 	b.batcher.Stop()
 	return b.Store.Close()
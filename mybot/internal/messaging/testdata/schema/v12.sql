@@ -0,0 +1,197 @@
+-- Schema written by builds at schema_version 12. Do not edit.
+CREATE TABLE IF NOT EXISTS threads (
+    thread_id        INTEGER PRIMARY KEY,
+    name             TEXT    NOT NULL DEFAULT '',
+    thread_type      INTEGER NOT NULL DEFAULT 0,
+    is_group         INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms    INTEGER NOT NULL DEFAULT 0,
+    last_activity_ms INTEGER NOT NULL DEFAULT 0,
+    deleted          INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    user_id       INTEGER PRIMARY KEY,
+    name          TEXT    NOT NULL DEFAULT '',
+    updated_at_ms INTEGER NOT NULL DEFAULT 0,
+    deleted       INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    message_id           TEXT PRIMARY KEY,
+    thread_id            INTEGER NOT NULL DEFAULT 0,
+    sender_id            INTEGER NOT NULL DEFAULT 0,
+    sender_name_snapshot TEXT    NOT NULL DEFAULT '',
+    text                 TEXT    NOT NULL DEFAULT '',
+    reply_to_message_id  TEXT    NOT NULL DEFAULT '',
+    offline_threading_id TEXT    NOT NULL DEFAULT '',
+    is_from_bot          INTEGER NOT NULL DEFAULT 0,
+    has_media            INTEGER NOT NULL DEFAULT 0,
+    attachments_json     TEXT    NOT NULL DEFAULT '[]',
+    mentions_json        TEXT    NOT NULL DEFAULT '[]',
+    timestamp_ms         INTEGER NOT NULL DEFAULT 0,
+    edit_count           INTEGER NOT NULL DEFAULT 0,
+    is_edited            INTEGER NOT NULL DEFAULT 0,
+    is_recalled          INTEGER NOT NULL DEFAULT 0,
+    created_at_ms        INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms        INTEGER NOT NULL DEFAULT 0,
+    recalled_at_ms       INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_thread_ts
+    ON messages(thread_id, timestamp_ms, message_id);
+
+CREATE TABLE IF NOT EXISTS thread_last_bot (
+    thread_id  INTEGER PRIMARY KEY,
+    message_id TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS message_edits (
+    message_id     TEXT    NOT NULL,
+    thread_id      INTEGER NOT NULL DEFAULT 0,
+    text           TEXT    NOT NULL DEFAULT '',
+    timestamp_ms   INTEGER NOT NULL DEFAULT 0,
+    recorded_at_ms INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (message_id, timestamp_ms)
+);
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id          INTEGER NOT NULL,
+    kind               TEXT    NOT NULL,
+    payload_json       TEXT    NOT NULL DEFAULT '{}',
+    otid               INTEGER NOT NULL DEFAULT 0,
+    status             TEXT    NOT NULL DEFAULT 'pending',
+    attempts           INTEGER NOT NULL DEFAULT 0,
+    last_error         TEXT    NOT NULL DEFAULT '',
+    message_id         TEXT    NOT NULL DEFAULT '',
+    created_at_ms      INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms      INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_status_thread
+    ON outbox(status, thread_id, id);
+
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id     INTEGER NOT NULL,
+    creator_id    INTEGER NOT NULL DEFAULT 0,
+    kind          TEXT    NOT NULL,
+    text          TEXT    NOT NULL DEFAULT '',
+    payload_json  TEXT    NOT NULL DEFAULT '{}',
+    status        TEXT    NOT NULL DEFAULT 'pending',
+    attempts      INTEGER NOT NULL DEFAULT 0,
+    last_error    TEXT    NOT NULL DEFAULT '',
+    message_id    TEXT    NOT NULL DEFAULT '',
+    send_at_ms    INTEGER NOT NULL DEFAULT 0,
+    created_at_ms INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_status_send_at
+    ON scheduled_messages(status, send_at_ms);
+
+CREATE TABLE IF NOT EXISTS reminders (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id        INTEGER NOT NULL,
+    creator_id       INTEGER NOT NULL DEFAULT 0,
+    target_id        INTEGER NOT NULL DEFAULT 0,
+    text             TEXT    NOT NULL DEFAULT '',
+    recurrence       TEXT    NOT NULL DEFAULT '',
+    status           TEXT    NOT NULL DEFAULT 'active',
+    next_at_ms       INTEGER NOT NULL DEFAULT 0,
+    anchor_at_ms     INTEGER NOT NULL DEFAULT 0,
+    fire_count       INTEGER NOT NULL DEFAULT 0,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    last_error       TEXT    NOT NULL DEFAULT '',
+    last_fired_at_ms INTEGER NOT NULL DEFAULT 0,
+    created_at_ms    INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms    INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_reminders_status_next_at
+    ON reminders(status, next_at_ms);
+
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    creator_id       INTEGER NOT NULL DEFAULT 0,
+    origin_thread_id INTEGER NOT NULL DEFAULT 0,
+    text             TEXT    NOT NULL DEFAULT '',
+    target           TEXT    NOT NULL DEFAULT '',
+    status           TEXT    NOT NULL DEFAULT 'running',
+    created_at_ms    INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms    INTEGER NOT NULL DEFAULT 0,
+    finished_at_ms   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS broadcast_deliveries (
+    broadcast_id  INTEGER NOT NULL,
+    thread_id     INTEGER NOT NULL,
+    status        TEXT    NOT NULL DEFAULT 'pending',
+    last_error    TEXT    NOT NULL DEFAULT '',
+    message_id    TEXT    NOT NULL DEFAULT '',
+    updated_at_ms INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (broadcast_id, thread_id)
+);
+
+CREATE TABLE IF NOT EXISTS thread_participants (
+    thread_id     INTEGER NOT NULL,
+    user_id       INTEGER NOT NULL,
+    nickname      TEXT    NOT NULL DEFAULT '',
+    is_admin      INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (thread_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS polls (
+    poll_id       INTEGER PRIMARY KEY,
+    thread_id     INTEGER NOT NULL,
+    creator_id    INTEGER NOT NULL DEFAULT 0,
+    question      TEXT    NOT NULL DEFAULT '',
+    message_id    TEXT    NOT NULL DEFAULT '',
+    status        TEXT    NOT NULL DEFAULT 'open',
+    closes_at_ms  INTEGER NOT NULL DEFAULT 0,
+    closed_at_ms  INTEGER NOT NULL DEFAULT 0,
+    created_at_ms INTEGER NOT NULL DEFAULT 0,
+    updated_at_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_polls_thread
+    ON polls(thread_id, created_at_ms);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    poll_id   INTEGER NOT NULL,
+    option_id INTEGER NOT NULL,
+    text      TEXT    NOT NULL DEFAULT '',
+    position  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (poll_id, option_id)
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    poll_id     INTEGER NOT NULL,
+    option_id   INTEGER NOT NULL,
+    user_id     INTEGER NOT NULL,
+    voted_at_ms INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (poll_id, option_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS moderation_events (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id     INTEGER NOT NULL,
+    user_id       INTEGER NOT NULL,
+    message_id    TEXT    NOT NULL DEFAULT '',
+    reason        TEXT    NOT NULL DEFAULT '',
+    action        TEXT    NOT NULL DEFAULT '',
+    detail        TEXT    NOT NULL DEFAULT '',
+    actor_id      INTEGER NOT NULL DEFAULT 0,
+    until_ms      INTEGER NOT NULL DEFAULT 0,
+    created_at_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_events_thread_user
+    ON moderation_events(thread_id, user_id, created_at_ms);
+
+CREATE TABLE IF NOT EXISTS meta (
+    key   TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
@@ -0,0 +1,281 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"mybot/internal/core"
+)
+
+var (
+	// ErrNotGroupThread is returned for group-only actions in a 1:1 thread.
+	ErrNotGroupThread = errors.New("not a group thread")
+	// ErrBotNotAdmin is returned when the bot is known not to be an admin
+	// of the group, so Messenger would reject the change.
+	ErrBotNotAdmin = errors.New("bot is not an admin of this group")
+	// ErrTargetOutranks is returned when acting on a user with a higher
+	// role than the caller.
+	ErrTargetOutranks = errors.New("target user has a higher role")
+	// ErrRemoveSelf is returned when asked to remove the bot itself.
+	ErrRemoveSelf = errors.New("bot cannot remove itself")
+)
+
+// RoleResolver returns the role userID has in threadID.
+type RoleResolver func(ctx context.Context, threadID, userID int64) core.Role
+
+// ThreadAdminFor returns a core.ThreadAdmin acting for userID. Each call
+// looks up the caller's role in the target thread with roleOf, so a thread
+// admin can't use the bot to change other threads.
+func (s *Service) ThreadAdminFor(userID int64, roleOf RoleResolver) core.ThreadAdmin {
+	return &threadAdmin{service: s, userID: userID, roleOf: roleOf}
+}
+
+// IsThreadAdmin reports whether userID is a known admin of threadID. While
+// moderation is on, which asks for every incoming message, it answers from
+// memory.
+func (s *Service) IsThreadAdmin(ctx context.Context, threadID, userID int64) bool {
+	if s.moderator != nil {
+		return s.moderator.roles.isAdmin(threadID, userID)
+	}
+	member, err := s.store.GetParticipant(ctx, threadID, userID)
+	return err == nil && member != nil && member.IsAdmin
+}
+
+// BotIsAdmin reports whether the bot is an admin of threadID. known is false
+// when the bot has not seen its own membership of the thread yet.
+func (s *Service) BotIsAdmin(ctx context.Context, threadID int64) (admin, known bool) {
+	member, err := s.store.GetParticipant(ctx, threadID, s.SelfID())
+	if err != nil || member == nil {
+		return false, false
+	}
+	return member.IsAdmin, true
+}
+
+type threadAdmin struct {
+	service *Service
+	userID  int64
+	roleOf  RoleResolver
+}
+
+var _ core.ThreadAdmin = (*threadAdmin)(nil)
+
+func (t *threadAdmin) ListParticipants(ctx context.Context, threadID int64) ([]*core.ThreadParticipant, error) {
+	return t.service.store.ListParticipants(ctx, threadID)
+}
+
+func (t *threadAdmin) RenameThread(ctx context.Context, threadID int64, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ErrInvalidRequest
+	}
+	transport, err := t.prepare(ctx, threadID, core.RoleAdmin, false)
+	if err != nil {
+		return err
+	}
+	if err := transport.RenameThread(ctx, threadID, name); err != nil {
+		return err
+	}
+	thread, err := t.service.store.GetThread(ctx, threadID)
+	if err != nil || thread == nil {
+		return err
+	}
+	thread.Name = name
+	thread.UpdatedAtUnixMs = time.Now().UnixMilli()
+	return t.service.store.UpsertThread(ctx, thread)
+}
+
+func (t *threadAdmin) AddParticipants(ctx context.Context, threadID int64, userIDs []int64) error {
+	if len(userIDs) == 0 {
+		return ErrInvalidRequest
+	}
+	transport, err := t.prepare(ctx, threadID, core.RoleAdmin, false)
+	if err != nil {
+		return err
+	}
+	return transport.AddParticipants(ctx, threadID, userIDs)
+}
+
+func (t *threadAdmin) RemoveParticipant(ctx context.Context, threadID, userID int64) error {
+	if userID == t.service.SelfID() {
+		return ErrRemoveSelf
+	}
+	transport, err := t.prepare(ctx, threadID, core.RoleAdmin, true)
+	if err != nil {
+		return err
+	}
+	if err := t.outrank(ctx, threadID, userID); err != nil {
+		return err
+	}
+	if err := transport.RemoveParticipant(ctx, threadID, userID); err != nil {
+		return err
+	}
+	t.service.projector.roles.setAdmin(threadID, userID, false)
+	return t.service.store.DeleteParticipant(ctx, threadID, userID)
+}
+
+func (t *threadAdmin) SetAdmin(ctx context.Context, threadID, userID int64, admin bool) error {
+	transport, err := t.prepare(ctx, threadID, core.RoleAdmin, true)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		if err := t.outrank(ctx, threadID, userID); err != nil {
+			return err
+		}
+	}
+	isAdmin := 0
+	if admin {
+		isAdmin = 1
+	}
+	if err := transport.UpdateAdmin(ctx, threadID, userID, isAdmin); err != nil {
+		return err
+	}
+	return t.updateParticipant(ctx, threadID, userID, func(p *core.ThreadParticipant) { p.IsAdmin = admin })
+}
+
+func (t *threadAdmin) SetNickname(ctx context.Context, threadID, userID int64, nickname string) error {
+	nickname = strings.TrimSpace(nickname)
+	required := core.RoleMember
+	if userID != t.userID {
+		required = core.RoleAdmin
+	}
+	transport, err := t.prepare(ctx, threadID, required, false)
+	if err != nil {
+		return err
+	}
+	if err := t.outrank(ctx, threadID, userID); err != nil {
+		return err
+	}
+	if err := transport.ChangeNickname(ctx, threadID, userID, nickname); err != nil {
+		return err
+	}
+	return t.updateParticipant(ctx, threadID, userID, func(p *core.ThreadParticipant) { p.Nickname = nickname })
+}
+
+func (t *threadAdmin) SetEmoji(ctx context.Context, threadID int64, emoji string) error {
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" {
+		return ErrInvalidRequest
+	}
+	transport, err := t.prepare(ctx, threadID, core.RoleAdmin, false)
+	if err != nil {
+		return err
+	}
+	return transport.ChangeThreadEmoji(ctx, threadID, emoji)
+}
+
+func (t *threadAdmin) SetColor(ctx context.Context, threadID int64, themeFBID string) error {
+	if themeFBID == "" {
+		return ErrInvalidRequest
+	}
+	transport, err := t.prepare(ctx, threadID, core.RoleAdmin, false)
+	if err != nil {
+		return err
+	}
+	return transport.ChangeThreadColor(ctx, threadID, themeFBID)
+}
+
+func (t *threadAdmin) SetImage(ctx context.Context, threadID int64, image *core.MediaAttachment) error {
+	if image == nil || !strings.HasPrefix(image.MimeType, "image/") {
+		return ErrInvalidRequest
+	}
+	transport, err := t.prepare(ctx, threadID, core.RoleAdmin, false)
+	if err != nil {
+		return err
+	}
+	data, err := image.GetData()
+	if err != nil {
+		return err
+	}
+	return transport.SetThreadImage(ctx, threadID, data, image.Filename, image.MimeType)
+}
+
+func (t *threadAdmin) Mute(ctx context.Context, threadID int64, until time.Time) error {
+	transport, err := t.prepare(ctx, threadID, core.RoleAdmin, false)
+	if err != nil {
+		return err
+	}
+	var expireMs int64
+	if !until.IsZero() {
+		expireMs = until.UnixMilli()
+	}
+	return transport.MuteThread(ctx, threadID, expireMs)
+}
+
+func (t *threadAdmin) CreatePoll(ctx context.Context, threadID int64, question string, options []string) error {
+	if strings.TrimSpace(question) == "" || len(options) < 2 {
+		return ErrInvalidRequest
+	}
+	transport, err := t.prepare(ctx, threadID, core.RoleMember, false)
+	if err != nil {
+		return err
+	}
+	if t.service.polls == nil {
+		return transport.CreatePoll(ctx, threadID, question, options)
+	}
+	// Let the poll tracker store the question once Messenger reports it.
+	pending := t.service.polls.expect(threadID, t.userID, strings.TrimSpace(question), 0)
+	if err := transport.CreatePoll(ctx, threadID, question, options); err != nil {
+		t.service.polls.forget(pending)
+		return err
+	}
+	return nil
+}
+
+// prepare checks that the thread is a group, that the caller has role in
+// it, and (when needsBotAdmin) that the bot is not known to lack admin rights
+// there. It returns the transport to act with.
+func (t *threadAdmin) prepare(ctx context.Context, threadID int64, role core.Role, needsBotAdmin bool) (Transport, error) {
+	if err := t.service.checkGroupThread(ctx, threadID); err != nil {
+		return nil, err
+	}
+	if t.roleOf(ctx, threadID, t.userID) < role {
+		return nil, core.RoleError(role)
+	}
+	if needsBotAdmin {
+		if admin, known := t.service.BotIsAdmin(ctx, threadID); known && !admin {
+			return nil, ErrBotNotAdmin
+		}
+	}
+	return t.service.transport()
+}
+
+// checkGroupThread returns ErrNotGroupThread when threadID is known to be a
+// 1:1 thread. Threads the bot has not classified yet are let through.
+func (s *Service) checkGroupThread(ctx context.Context, threadID int64) error {
+	thread, err := s.store.GetThread(ctx, threadID)
+	if err != nil {
+		return err
+	}
+	if thread != nil && thread.ThreadType != 0 && !thread.IsGroup {
+		return ErrNotGroupThread
+	}
+	return nil
+}
+
+// outrank rejects acting on userID when they have a higher role in threadID
+// than the caller.
+func (t *threadAdmin) outrank(ctx context.Context, threadID, userID int64) error {
+	if t.roleOf(ctx, threadID, userID) > t.roleOf(ctx, threadID, t.userID) {
+		return ErrTargetOutranks
+	}
+	return nil
+}
+
+// updateParticipant applies a change Messenger just accepted to the stored
+// member, so role checks see it before the sync event arrives.
+func (t *threadAdmin) updateParticipant(ctx context.Context, threadID, userID int64, change func(*core.ThreadParticipant)) error {
+	member, err := t.service.store.GetParticipant(ctx, threadID, userID)
+	if err != nil {
+		return err
+	}
+	if member == nil {
+		member = &core.ThreadParticipant{ThreadID: threadID, UserID: userID}
+	}
+	change(member)
+	member.UpdatedAtUnixMs = time.Now().UnixMilli()
+	t.service.projector.roles.setAdmin(threadID, userID, member.IsAdmin)
+	return t.service.store.UpsertParticipant(ctx, member)
+}
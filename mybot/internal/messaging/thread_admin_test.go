@@ -0,0 +1,161 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"go.mau.fi/mautrix-meta/pkg/messagix/table"
+
+	"mybot/internal/core"
+)
+
+func TestProjectorTracksParticipants(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	projector := NewProjector(store, func() int64 { return 42 })
+	if _, err := projector.ProjectTable(ctx, &table.LSTable{
+		LSAddParticipantIdToGroupThread: []*table.LSAddParticipantIdToGroupThread{
+			{ThreadKey: 1001, ContactId: 7, Nickname: "Bảy"},
+			{ThreadKey: 1001, ContactId: 8},
+			{ThreadKey: 1001, ContactId: 9},
+		},
+		LSUpdateThreadParticipantAdminStatus: []*table.LSUpdateThreadParticipantAdminStatus{
+			{ThreadKey: 1001, ContactId: 8, IsAdmin: true},
+		},
+		LSRemoveParticipantFromThread: []*table.LSRemoveParticipantFromThread{
+			{ThreadKey: 1001, ParticipantId: 9},
+		},
+	}, MetadataOnly); err != nil {
+		t.Fatalf("ProjectTable() error = %v", err)
+	}
+
+	members, err := store.ListParticipants(ctx, 1001)
+	if err != nil {
+		t.Fatalf("ListParticipants() error = %v", err)
+	}
+	if len(members) != 2 || members[0].UserID != 8 || !members[0].IsAdmin || members[1].Nickname != "Bảy" {
+		t.Fatalf("participants = %+v, want admin 8 then 7", members)
+	}
+
+	// A full resync replaces the member list.
+	if _, err := projector.ProjectTable(ctx, &table.LSTable{
+		LSRemoveAllParticipantsForThread: []*table.LSRemoveAllParticipantsForThread{{ThreadKey: 1001}},
+		LSAddParticipantIdToGroupThread: []*table.LSAddParticipantIdToGroupThread{
+			{ThreadKey: 1001, ContactId: 7, IsAdmin: true},
+		},
+	}, MetadataOnly); err != nil {
+		t.Fatalf("ProjectTable(resync) error = %v", err)
+	}
+	members, _ = store.ListParticipants(ctx, 1001)
+	if len(members) != 1 || members[0].UserID != 7 || !members[0].IsAdmin {
+		t.Fatalf("participants after resync = %+v", members)
+	}
+}
+
+func TestThreadAdminChecksRoles(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "messages.sqlite"))
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore() error = %v", err)
+	}
+	defer store.Close()
+
+	const (
+		group   = int64(1001)
+		direct  = int64(2002)
+		owner   = int64(1)
+		admin   = int64(7)
+		member  = int64(8)
+		botSelf = int64(42)
+	)
+	transport := &fakeTransport{selfID: botSelf}
+	service := NewService(zerolog.Nop(), store, func() int64 { return botSelf }, func() Transport { return transport }, nil)
+
+	store.UpsertThread(ctx, &core.ThreadRecord{ThreadID: group, Name: "Nhóm", ThreadType: int64(table.GROUP_THREAD), IsGroup: true})
+	store.UpsertThread(ctx, &core.ThreadRecord{ThreadID: direct, ThreadType: int64(table.ONE_TO_ONE)})
+	for _, p := range []*core.ThreadParticipant{
+		{ThreadID: group, UserID: botSelf, IsAdmin: true},
+		{ThreadID: group, UserID: admin, IsAdmin: true},
+		{ThreadID: group, UserID: member},
+		{ThreadID: group, UserID: owner},
+	} {
+		if err := store.UpsertParticipant(ctx, p); err != nil {
+			t.Fatalf("UpsertParticipant() error = %v", err)
+		}
+	}
+	roleOf := func(ctx context.Context, threadID, userID int64) core.Role {
+		if userID == owner {
+			return core.RoleOwner
+		}
+		if service.IsThreadAdmin(ctx, threadID, userID) {
+			return core.RoleAdmin
+		}
+		return core.RoleMember
+	}
+	asAdmin := service.ThreadAdminFor(admin, roleOf)
+	asMember := service.ThreadAdminFor(member, roleOf)
+
+	if err := asMember.RenameThread(ctx, group, "Tên mới"); err == nil || !strings.Contains(err.Error(), "quản trị viên") {
+		t.Fatalf("member RenameThread() error = %v, want admin-only error", err)
+	}
+	if err := asAdmin.RenameThread(ctx, group, "Tên mới"); err != nil {
+		t.Fatalf("admin RenameThread() error = %v", err)
+	}
+	if rec, _ := store.GetThread(ctx, group); rec.Name != "Tên mới" || !rec.IsGroup {
+		t.Fatalf("thread after rename = %+v", rec)
+	}
+	if err := asAdmin.RenameThread(ctx, direct, "x"); !errors.Is(err, ErrNotGroupThread) {
+		t.Fatalf("RenameThread(1:1) error = %v, want ErrNotGroupThread", err)
+	}
+
+	if err := asAdmin.RemoveParticipant(ctx, group, owner); !errors.Is(err, ErrTargetOutranks) {
+		t.Fatalf("admin kicking owner error = %v, want ErrTargetOutranks", err)
+	}
+	if err := asAdmin.RemoveParticipant(ctx, group, botSelf); !errors.Is(err, ErrRemoveSelf) {
+		t.Fatalf("kicking the bot error = %v, want ErrRemoveSelf", err)
+	}
+	if err := asAdmin.RemoveParticipant(ctx, group, member); err != nil {
+		t.Fatalf("admin RemoveParticipant() error = %v", err)
+	}
+	if p, _ := store.GetParticipant(ctx, group, member); p != nil {
+		t.Fatalf("removed member still stored: %+v", p)
+	}
+
+	if err := asMember.SetNickname(ctx, group, member, "Tám"); err != nil {
+		t.Fatalf("member SetNickname(self) error = %v", err)
+	}
+	if err := asMember.SetNickname(ctx, group, admin, "x"); err == nil {
+		t.Fatal("member SetNickname(other) succeeded, want admin-only error")
+	}
+
+	if err := asAdmin.SetAdmin(ctx, group, member, true); err != nil {
+		t.Fatalf("SetAdmin() error = %v", err)
+	}
+	if !service.IsThreadAdmin(ctx, group, member) {
+		t.Fatal("promoted member is not stored as admin")
+	}
+
+	store.UpsertParticipant(ctx, &core.ThreadParticipant{ThreadID: group, UserID: botSelf})
+	if err := asAdmin.RemoveParticipant(ctx, group, member); !errors.Is(err, ErrBotNotAdmin) {
+		t.Fatalf("RemoveParticipant() without bot admin error = %v, want ErrBotNotAdmin", err)
+	}
+
+	want := []string{
+		"rename 1001 Tên mới",
+		"remove 1001 8",
+		"nick 1001 8 Tám",
+		"admin 1001 8 1",
+	}
+	if strings.Join(transport.threadCalls, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("transport calls = %q, want %q", transport.threadCalls, want)
+	}
+}
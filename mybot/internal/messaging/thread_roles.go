@@ -0,0 +1,106 @@
+package messaging
+
+import (
+	"context"
+	"sync"
+
+	"mybot/internal/core"
+)
+
+// threadRoles keeps in memory which threads are groups and who administers
+// them. Moderation checks every incoming message on the event loop, so it
+// must not read the store there; the projector and the thread admin
+// commands update these alongside the rows they write.
+type threadRoles struct {
+	mu     sync.RWMutex
+	groups map[int64]bool // threads of known type; true for groups
+	admins map[moderationKey]struct{}
+}
+
+// loadThreadRoles reads the thread types and group admins from store.
+func loadThreadRoles(ctx context.Context, store Store) (*threadRoles, error) {
+	threads, err := store.ListThreads(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := &threadRoles{
+		groups: make(map[int64]bool, len(threads)),
+		admins: make(map[moderationKey]struct{}),
+	}
+	for _, thread := range threads {
+		if thread.ThreadType == 0 {
+			continue
+		}
+		r.groups[thread.ThreadID] = thread.IsGroup
+		if !thread.IsGroup {
+			continue
+		}
+		members, err := store.ListParticipants(ctx, thread.ThreadID)
+		if err != nil {
+			return nil, err
+		}
+		r.resetThread(thread.ThreadID, members)
+	}
+	return r, nil
+}
+
+// isGroup reports whether threadID is a group; known is false until its
+// type has been seen.
+func (r *threadRoles) isGroup(threadID int64) (group, known bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	group, known = r.groups[threadID]
+	return group, known
+}
+
+func (r *threadRoles) isAdmin(threadID, userID int64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.admins[moderationKey{threadID, userID}]
+	return ok
+}
+
+// The setters below do nothing on a nil *threadRoles, which is what the
+// projector holds while moderation is off.
+
+func (r *threadRoles) setThread(threadID int64, group bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.groups[threadID] = group
+	r.mu.Unlock()
+}
+
+func (r *threadRoles) setAdmin(threadID, userID int64, admin bool) {
+	if r == nil {
+		return
+	}
+	key := moderationKey{threadID, userID}
+	r.mu.Lock()
+	if admin {
+		r.admins[key] = struct{}{}
+	} else {
+		delete(r.admins, key)
+	}
+	r.mu.Unlock()
+}
+
+// resetThread replaces the admins of threadID with those among members.
+func (r *threadRoles) resetThread(threadID int64, members []*core.ThreadParticipant) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.admins {
+		if key.threadID == threadID {
+			delete(r.admins, key)
+		}
+	}
+	for _, m := range members {
+		if m.IsAdmin {
+			r.admins[moderationKey{threadID, m.UserID}] = struct{}{}
+		}
+	}
+}
@@ -11,5 +11,28 @@ type Transport interface {
 	SendMediaMessage(ctx context.Context, req core.SendMediaRequest) (*core.MessageRecord, error)
 	EditText(ctx context.Context, messageID, newText string) (*core.MessageRecord, error)
 	Recall(ctx context.Context, messageID string) error
+	Forward(ctx context.Context, req core.ForwardRequest) (*core.MessageRecord, error)
+	SendSticker(ctx context.Context, req core.SendStickerRequest) (*core.MessageRecord, error)
+	SendExternalMedia(ctx context.Context, req core.SendExternalMediaRequest) (*core.MessageRecord, error)
+	SendTypingIndicator(ctx context.Context, threadID int64, isTyping, isGroup bool) error
 	GetSelfID() int64
+	ThreadTransport
+}
+
+// ThreadTransport changes group threads as the bot account. Permission
+// checks happen above it, in the ThreadAdmin returned by
+// Service.ThreadAdminFor.
+type ThreadTransport interface {
+	RenameThread(ctx context.Context, threadID int64, name string) error
+	AddParticipants(ctx context.Context, threadID int64, contactIDs []int64) error
+	RemoveParticipant(ctx context.Context, threadID int64, contactID int64) error
+	// UpdateAdmin promotes (isAdmin=1) or demotes (isAdmin=0) contactID.
+	UpdateAdmin(ctx context.Context, threadID int64, contactID int64, isAdmin int) error
+	ChangeNickname(ctx context.Context, threadID, contactID int64, nickname string) error
+	ChangeThreadEmoji(ctx context.Context, threadID int64, emoji string) error
+	ChangeThreadColor(ctx context.Context, threadID int64, themeFBID string) error
+	SetThreadImage(ctx context.Context, threadID int64, imageData []byte, filename, mimeType string) error
+	// MuteThread mutes until muteExpireMs; 0 unmutes.
+	MuteThread(ctx context.Context, threadID int64, muteExpireMs int64) error
+	CreatePoll(ctx context.Context, threadID int64, question string, options []string) error
 }
@@ -1,6 +1,7 @@
 package messaging
 
 import (
+	"errors"
 	"sync"
 	"sync/atomic"
 
@@ -9,87 +10,280 @@ import (
 	"mybot/internal/metrics"
 )
 
+// Lane is a priority class in the WorkerPool. Each lane has its own workers
+// and queue, so slow jobs in one lane never delay another. Within a lane,
+// jobs submitted with the same key (SubmitKeyed) run one at a time in
+// order; across lanes there is no ordering.
+type Lane int
+
+const (
+	// LaneInteractive runs quick user-facing work: commands, page navigation.
+	LaneInteractive Lane = iota
+	// LaneMedia runs long media downloads and uploads.
+	LaneMedia
+	// LaneBackground runs work nobody is waiting on.
+	LaneBackground
+
+	laneCount
+)
+
+func (l Lane) String() string {
+	switch l {
+	case LaneInteractive:
+		return "interactive"
+	case LaneMedia:
+		return "media"
+	case LaneBackground:
+		return "background"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	// ErrPoolBusy is returned by Submit when the lane's queue is full.
+	ErrPoolBusy = errors.New("worker pool busy")
+	// ErrPoolStopped is returned by Submit after Stop.
+	ErrPoolStopped = errors.New("worker pool stopped")
+)
+
+// LaneConfig sizes one lane of the WorkerPool.
+type LaneConfig struct {
+	Workers   int
+	QueueSize int
+}
+
 // Job is a unit of work submitted to the WorkerPool.
 type Job struct {
 	Fn func()
 }
 
-// WorkerPool maintains a fixed number of goroutines that pull work from a
-// shared job queue.  This replaces the unbounded goroutine-per-message
+type lane struct {
+	name    string
+	size    int
+	queue   chan Job
+	waiting atomic.Int64 // jobs accepted and not started, keyed ones too
+	depth   *atomic.Int64
+
+	mu sync.Mutex
+	// keyed holds the jobs of each key not started yet, oldest first. A key
+	// is present while one of its jobs is queued or running; only that one
+	// is in queue, the rest wait here.
+	keyed map[int64][]func()
+}
+
+// len returns the number of jobs waiting in the lane.
+func (ln *lane) len() int {
+	return int(ln.waiting.Load())
+}
+
+// reserve counts one more waiting job, unless the lane is full.
+func (ln *lane) reserve() bool {
+	if ln.waiting.Add(1) > int64(ln.size) {
+		ln.waiting.Add(-1)
+		return false
+	}
+	return true
+}
+
+// WorkerPool maintains a fixed number of goroutines per lane that pull work
+// from the lane's queue. This replaces the unbounded goroutine-per-message
 // semaphore pattern with predictable resource usage.
 type WorkerPool struct {
-	log      zerolog.Logger
-	queue    chan Job
-	wg       sync.WaitGroup
-	workers  int
-	stopped  atomic.Bool
+	log     zerolog.Logger
+	lanes   [laneCount]*lane
+	wg      sync.WaitGroup
+	mu      sync.RWMutex // guards queue sends against close in Stop
+	stopped atomic.Bool
 }
 
-// NewWorkerPool creates a pool with the given number of workers and queue capacity.
-func NewWorkerPool(log zerolog.Logger, workers, queueSize int) *WorkerPool {
-	if workers <= 0 {
-		workers = 20
-	}
-	if queueSize <= 0 {
-		queueSize = 500
-	}
+// NewWorkerPool creates a pool with the given per-lane sizes. Lanes missing
+// from cfg, or with non-positive sizes, get DefaultLaneConfig values.
+func NewWorkerPool(log zerolog.Logger, cfg map[Lane]LaneConfig) *WorkerPool {
 	p := &WorkerPool{
-		log:     log.With().Str("component", "worker_pool").Logger(),
-		queue:   make(chan Job, queueSize),
-		workers: workers,
+		log: log.With().Str("component", "worker_pool").Logger(),
+	}
+	depths := [laneCount]*atomic.Int64{
+		LaneInteractive: &metrics.Global.InteractiveQueueDepth,
+		LaneMedia:       &metrics.Global.MediaQueueDepth,
+		LaneBackground:  &metrics.Global.BackgroundQueueDepth,
 	}
-	p.wg.Add(workers)
-	for i := 0; i < workers; i++ {
-		go p.worker(i)
+	for l := Lane(0); l < laneCount; l++ {
+		c := cfg[l]
+		def := DefaultLaneConfig(l)
+		if c.Workers <= 0 {
+			c.Workers = def.Workers
+		}
+		if c.QueueSize <= 0 {
+			c.QueueSize = def.QueueSize
+		}
+		ln := &lane{
+			name:  l.String(),
+			size:  c.QueueSize,
+			queue: make(chan Job, c.QueueSize),
+			depth: depths[l],
+			keyed: make(map[int64][]func()),
+		}
+		p.lanes[l] = ln
+		p.wg.Add(c.Workers)
+		for i := 0; i < c.Workers; i++ {
+			go p.worker(ln, i)
+		}
+		p.log.Info().Str("lane", ln.name).Int("workers", c.Workers).Int("queue_size", c.QueueSize).Msg("Worker pool lane started")
 	}
-	p.log.Info().Int("workers", workers).Int("queue_size", queueSize).Msg("Worker pool started")
 	return p
 }
 
-// Submit enqueues a job.  Returns false if the pool is stopped or the queue
-// is full (the job is dropped in both cases).
-func (p *WorkerPool) Submit(fn func()) bool {
+// DefaultLaneConfig returns the size used for l when none is configured.
+func DefaultLaneConfig(l Lane) LaneConfig {
+	switch l {
+	case LaneMedia:
+		return LaneConfig{Workers: 4, QueueSize: 50}
+	case LaneBackground:
+		return LaneConfig{Workers: 2, QueueSize: 200}
+	default:
+		return LaneConfig{Workers: 20, QueueSize: 500}
+	}
+}
+
+// Submit enqueues a job on lane l. It returns ErrPoolBusy when the lane's
+// queue is full and ErrPoolStopped after Stop; the job is dropped in both
+// cases, so callers with a user waiting should tell them.
+func (p *WorkerPool) Submit(l Lane, fn func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped.Load() {
+		metrics.Global.MessagesDropped.Add(1)
+		return ErrPoolStopped
+	}
+	ln := p.lanes[l]
+	if !ln.reserve() {
+		return p.reject(ln)
+	}
+	ln.queue <- Job{Fn: fn}
+	p.updateDepth(ln)
+	return nil
+}
+
+// SubmitKeyed enqueues a job on lane l like Submit, but jobs with the same
+// key run one at a time, in the order they were submitted. Each runs on
+// whichever worker is free, so a slow key holds up only its own jobs. The
+// job counts against the lane's queue like any other.
+func (p *WorkerPool) SubmitKeyed(l Lane, key int64, fn func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	if p.stopped.Load() {
 		metrics.Global.MessagesDropped.Add(1)
+		return ErrPoolStopped
+	}
+	ln := p.lanes[l]
+	if !ln.reserve() {
+		return p.reject(ln)
+	}
+	ln.mu.Lock()
+	jobs, active := ln.keyed[key]
+	ln.keyed[key] = append(jobs, fn)
+	ln.mu.Unlock()
+	if !active {
+		ln.queue <- Job{Fn: func() { p.runKeyed(ln, key) }}
+	}
+	p.updateDepth(ln)
+	return nil
+}
+
+// runKeyed runs the oldest job of key, then queues the next one behind the
+// lane's other work. When the lane can't take it, it runs it here.
+func (p *WorkerPool) runKeyed(ln *lane, key int64) {
+	for {
+		ln.mu.Lock()
+		jobs := ln.keyed[key]
+		fn := jobs[0]
+		jobs[0] = nil
+		ln.keyed[key] = jobs[1:]
+		ln.mu.Unlock()
+		p.run(ln, fn)
+
+		ln.mu.Lock()
+		if len(ln.keyed[key]) == 0 {
+			delete(ln.keyed, key)
+			ln.mu.Unlock()
+			return
+		}
+		ln.mu.Unlock()
+		if p.requeue(ln, Job{Fn: func() { p.runKeyed(ln, key) }}) {
+			return
+		}
+		ln.waiting.Add(-1)
+		p.updateDepth(ln)
+	}
+}
+
+// requeue puts job back on the lane's queue unless it is full or the pool
+// is stopping.
+func (p *WorkerPool) requeue(ln *lane, job Job) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped.Load() {
 		return false
 	}
 	select {
-	case p.queue <- Job{Fn: fn}:
-		metrics.Global.WorkerQueueDepth.Store(int64(len(p.queue)))
+	case ln.queue <- job:
 		return true
 	default:
-		metrics.Global.MessagesDropped.Add(1)
-		p.log.Warn().Int("queue_len", len(p.queue)).Msg("Worker queue full, dropping job")
 		return false
 	}
 }
 
-// QueueLen returns the current number of pending jobs.
-func (p *WorkerPool) QueueLen() int {
-	return len(p.queue)
+func (p *WorkerPool) reject(ln *lane) error {
+	metrics.Global.MessagesDropped.Add(1)
+	p.log.Warn().Str("lane", ln.name).Int("queue_len", ln.len()).Msg("Worker queue full, rejecting job")
+	return ErrPoolBusy
+}
+
+// QueueLen returns the current number of pending jobs in lane l.
+func (p *WorkerPool) QueueLen(l Lane) int {
+	return p.lanes[l].len()
 }
 
 // Stop signals all workers to finish and waits for them to drain.
 func (p *WorkerPool) Stop() {
+	p.mu.Lock()
 	if p.stopped.Swap(true) {
+		p.mu.Unlock()
 		return // already stopped
 	}
-	close(p.queue)
+	for _, ln := range p.lanes {
+		close(ln.queue)
+	}
+	p.mu.Unlock()
 	p.wg.Wait()
 	p.log.Info().Msg("Worker pool stopped")
 }
 
-func (p *WorkerPool) worker(id int) {
+func (p *WorkerPool) updateDepth(ln *lane) {
+	ln.depth.Store(int64(ln.len()))
+	var total int64
+	for _, other := range p.lanes {
+		total += int64(other.len())
+	}
+	metrics.Global.WorkerQueueDepth.Store(total)
+}
+
+func (p *WorkerPool) worker(ln *lane, id int) {
 	defer p.wg.Done()
-	for job := range p.queue {
-		metrics.Global.WorkerQueueDepth.Store(int64(len(p.queue)))
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					p.log.Error().Int("worker_id", id).Interface("panic", r).Msg("Worker recovered from panic")
-				}
-			}()
-			job.Fn()
-		}()
+	for job := range ln.queue {
+		ln.waiting.Add(-1)
+		p.updateDepth(ln)
+		p.run(ln, job.Fn)
 	}
 }
+
+// run calls fn, recovering from a panic so the worker survives it.
+func (p *WorkerPool) run(ln *lane, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.log.Error().Str("lane", ln.name).Interface("panic", r).Msg("Worker recovered from panic")
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,152 @@
+package messaging
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestWorkerPoolLaneBackpressure(t *testing.T) {
+	pool := NewWorkerPool(zerolog.Nop(), map[Lane]LaneConfig{
+		LaneInteractive: {Workers: 1, QueueSize: 4},
+		LaneMedia:       {Workers: 1, QueueSize: 1},
+	})
+	defer pool.Stop()
+
+	// Occupy the only media worker, then fill the media queue.
+	release := make(chan struct{})
+	started := make(chan struct{})
+	if err := pool.Submit(LaneMedia, func() { close(started); <-release }); err != nil {
+		t.Fatalf("submit media: %v", err)
+	}
+	<-started
+	if err := pool.Submit(LaneMedia, func() {}); err != nil {
+		t.Fatalf("queue media: %v", err)
+	}
+	if err := pool.Submit(LaneMedia, func() {}); !errors.Is(err, ErrPoolBusy) {
+		t.Fatalf("submit to full lane = %v, want ErrPoolBusy", err)
+	}
+
+	// A stuck media lane must not delay interactive jobs.
+	done := make(chan struct{})
+	if err := pool.Submit(LaneInteractive, func() { close(done) }); err != nil {
+		t.Fatalf("submit interactive: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("interactive job blocked behind media lane")
+	}
+	if got := pool.QueueLen(LaneMedia); got != 1 {
+		t.Fatalf("media queue length = %d, want 1", got)
+	}
+	close(release)
+}
+
+func TestWorkerPoolSubmitAfterStop(t *testing.T) {
+	pool := NewWorkerPool(zerolog.Nop(), nil)
+	pool.Stop()
+	if err := pool.Submit(LaneBackground, func() {}); !errors.Is(err, ErrPoolStopped) {
+		t.Fatalf("Submit after Stop = %v, want ErrPoolStopped", err)
+	}
+}
+
+func TestWorkerPoolKeyedOrder(t *testing.T) {
+	pool := NewWorkerPool(zerolog.Nop(), map[Lane]LaneConfig{
+		LaneBackground: {Workers: 4, QueueSize: 400},
+	})
+
+	// Jobs of one key run in order even with idle workers around; other
+	// keys run alongside.
+	var mu sync.Mutex
+	got := make(map[int64][]int)
+	for i := 0; i < 50; i++ {
+		for key := int64(1001); key <= 1003; key++ {
+			err := pool.SubmitKeyed(LaneBackground, key, func() {
+				time.Sleep(time.Duration(50-i) * time.Microsecond)
+				mu.Lock()
+				got[key] = append(got[key], i)
+				mu.Unlock()
+			})
+			if err != nil {
+				t.Fatalf("SubmitKeyed(%d, %d) error = %v", key, i, err)
+			}
+		}
+	}
+	pool.Stop()
+	for key, order := range got {
+		if len(order) != 50 || !slices.IsSorted(order) {
+			t.Errorf("jobs of key %d ran in order %v", key, order)
+		}
+	}
+}
+
+func TestWorkerPoolKeyedBackpressure(t *testing.T) {
+	pool := NewWorkerPool(zerolog.Nop(), map[Lane]LaneConfig{
+		LaneInteractive: {Workers: 2, QueueSize: 2},
+	})
+	defer pool.Stop()
+
+	// A stuck key holds up only its own jobs: another key still gets the
+	// free worker, and "busy" comes from the lane's total queue.
+	release := make(chan struct{})
+	started := make(chan struct{})
+	if err := pool.SubmitKeyed(LaneInteractive, 0, func() { close(started); <-release }); err != nil {
+		t.Fatalf("SubmitKeyed(0) error = %v", err)
+	}
+	<-started
+	var mu sync.Mutex
+	var order []int
+	behind := make(chan struct{})
+	for i := 1; i <= 2; i++ {
+		i := i
+		if err := pool.SubmitKeyed(LaneInteractive, 0, func() {
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			if i == 2 {
+				close(behind)
+			}
+		}); err != nil {
+			t.Fatalf("SubmitKeyed(0) #%d error = %v", i, err)
+		}
+	}
+	if err := pool.SubmitKeyed(LaneInteractive, 2, func() {}); !errors.Is(err, ErrPoolBusy) {
+		t.Fatalf("SubmitKeyed(2) to a full lane = %v, want ErrPoolBusy", err)
+	}
+	if got := pool.QueueLen(LaneInteractive); got != 2 {
+		t.Fatalf("QueueLen = %d, want 2", got)
+	}
+	close(release)
+	select {
+	case <-behind:
+	case <-time.After(2 * time.Second):
+		t.Fatal("jobs queued behind the stuck key never ran")
+	}
+	mu.Lock()
+	if len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Fatalf("order = %v, want [1 2]", order)
+	}
+	mu.Unlock()
+
+	release = make(chan struct{})
+	started = make(chan struct{})
+	if err := pool.SubmitKeyed(LaneInteractive, 0, func() { close(started); <-release }); err != nil {
+		t.Fatalf("SubmitKeyed(0) error = %v", err)
+	}
+	<-started
+	done := make(chan struct{})
+	if err := pool.SubmitKeyed(LaneInteractive, 2, func() { close(done) }); err != nil {
+		t.Fatalf("SubmitKeyed(2) error = %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("job of another key blocked behind the stuck one")
+	}
+	close(release)
+}
@@ -2,6 +2,8 @@ package metrics
 
 import (
 	"runtime"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -16,12 +18,38 @@ type Perf struct {
 	MessagesDropped   atomic.Int64
 	CommandsExecuted  atomic.Int64
 	SendRateLimited   atomic.Int64
+	SendWaitNs        atomic.Int64 // total nanoseconds sends spent in the rate limiter
 
-	DBWriteOps       atomic.Int64
-	DBWriteBatches   atomic.Int64
+	DBWriteOps        atomic.Int64
+	DBWriteBatches    atomic.Int64
 	DBWriteDurationNs atomic.Int64 // total nanoseconds spent writing
 
-	WorkerQueueDepth atomic.Int64
+	MessagesPruned  atomic.Int64 // rows deleted by the retention pruner
+	MessagesSlimmed atomic.Int64 // rows whose attachments were dropped
+	DBVacuums       atomic.Int64
+
+	AttachmentsArchived atomic.Int64 // files added to the attachment archive
+	AttachmentsDeduped  atomic.Int64 // attachments whose content was already kept
+	AttachmentsSkipped  atomic.Int64 // left out by size, quota or a full queue
+	AttachmentsFailed   atomic.Int64
+	AttachmentBytes     atomic.Int64 // bytes of the files added
+
+	WorkerQueueDepth      atomic.Int64 // all lanes
+	InteractiveQueueDepth atomic.Int64
+	MediaQueueDepth       atomic.Int64
+	BackgroundQueueDepth  atomic.Int64
+
+	sendWaitMu sync.Mutex
+	sendWaits  map[int64]*ThreadSendWait
+}
+
+// ThreadSendWait is the time sends to one thread spent waiting in the rate
+// limiter.
+type ThreadSendWait struct {
+	ThreadID int64
+	Sends    int64
+	TotalNs  int64
+	MaxNs    int64
 }
 
 // Global is the singleton metrics instance.
@@ -34,37 +62,116 @@ func (p *Perf) RecordDBWrite(ops int, dur time.Duration) {
 	p.DBWriteDurationNs.Add(dur.Nanoseconds())
 }
 
+// RecordPrune records one retention pass.
+func (p *Perf) RecordPrune(pruned, slimmed int) {
+	p.MessagesPruned.Add(int64(pruned))
+	p.MessagesSlimmed.Add(int64(slimmed))
+}
+
+// RecordSendWait records how long a send to threadID waited for its slot.
+func (p *Perf) RecordSendWait(threadID int64, dur time.Duration) {
+	ns := dur.Nanoseconds()
+	p.SendWaitNs.Add(ns)
+
+	p.sendWaitMu.Lock()
+	defer p.sendWaitMu.Unlock()
+	if p.sendWaits == nil {
+		p.sendWaits = make(map[int64]*ThreadSendWait)
+	}
+	w := p.sendWaits[threadID]
+	if w == nil {
+		w = &ThreadSendWait{ThreadID: threadID}
+		p.sendWaits[threadID] = w
+	}
+	w.Sends++
+	w.TotalNs += ns
+	w.MaxNs = max(w.MaxNs, ns)
+}
+
+// TakeSendWaits returns up to n threads with the most total send wait time
+// since the last call, longest first, and starts counting over, so only
+// threads that waited during one reporting interval are kept.
+func (p *Perf) TakeSendWaits(n int) []ThreadSendWait {
+	p.sendWaitMu.Lock()
+	waits := p.sendWaits
+	p.sendWaits = nil
+	p.sendWaitMu.Unlock()
+
+	out := make([]ThreadSendWait, 0, len(waits))
+	for _, w := range waits {
+		out = append(out, *w)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].TotalNs > out[j].TotalNs })
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// RecordAttachmentArchived records a new file of size bytes in the
+// attachment archive.
+func (p *Perf) RecordAttachmentArchived(size int64) {
+	p.AttachmentsArchived.Add(1)
+	p.AttachmentBytes.Add(size)
+}
+
 // Snapshot returns a point-in-time copy of all counters and resets
 // accumulating counters (write duration) so the next interval is clean.
 type Snapshot struct {
-	MessagesReceived  int64
-	MessagesProcessed int64
-	MessagesDropped   int64
-	CommandsExecuted  int64
-	SendRateLimited   int64
-	DBWriteOps        int64
-	DBWriteBatches    int64
-	DBWriteDurationMs int64
-	WorkerQueueDepth  int64
+	MessagesReceived      int64
+	MessagesProcessed     int64
+	MessagesDropped       int64
+	CommandsExecuted      int64
+	SendRateLimited       int64
+	SendWaitMs            int64
+	DBWriteOps            int64
+	DBWriteBatches        int64
+	DBWriteDurationMs     int64
+	MessagesPruned        int64
+	MessagesSlimmed       int64
+	DBVacuums             int64
+	AttachmentsArchived   int64
+	AttachmentsDeduped    int64
+	AttachmentsSkipped    int64
+	AttachmentsFailed     int64
+	AttachmentBytes       int64
+	WorkerQueueDepth      int64
+	InteractiveQueueDepth int64
+	MediaQueueDepth       int64
+	BackgroundQueueDepth  int64
 }
 
 // Snap takes a snapshot of all counters.
 func (p *Perf) Snap() Snapshot {
 	return Snapshot{
-		MessagesReceived:  p.MessagesReceived.Load(),
-		MessagesProcessed: p.MessagesProcessed.Load(),
-		MessagesDropped:   p.MessagesDropped.Load(),
-		CommandsExecuted:  p.CommandsExecuted.Load(),
-		SendRateLimited:   p.SendRateLimited.Load(),
-		DBWriteOps:        p.DBWriteOps.Load(),
-		DBWriteBatches:    p.DBWriteBatches.Load(),
-		DBWriteDurationMs: p.DBWriteDurationNs.Load() / int64(time.Millisecond),
-		WorkerQueueDepth:  p.WorkerQueueDepth.Load(),
+		MessagesReceived:      p.MessagesReceived.Load(),
+		MessagesProcessed:     p.MessagesProcessed.Load(),
+		MessagesDropped:       p.MessagesDropped.Load(),
+		CommandsExecuted:      p.CommandsExecuted.Load(),
+		SendRateLimited:       p.SendRateLimited.Load(),
+		SendWaitMs:            p.SendWaitNs.Load() / int64(time.Millisecond),
+		DBWriteOps:            p.DBWriteOps.Load(),
+		DBWriteBatches:        p.DBWriteBatches.Load(),
+		DBWriteDurationMs:     p.DBWriteDurationNs.Load() / int64(time.Millisecond),
+		MessagesPruned:        p.MessagesPruned.Load(),
+		MessagesSlimmed:       p.MessagesSlimmed.Load(),
+		DBVacuums:             p.DBVacuums.Load(),
+		AttachmentsArchived:   p.AttachmentsArchived.Load(),
+		AttachmentsDeduped:    p.AttachmentsDeduped.Load(),
+		AttachmentsSkipped:    p.AttachmentsSkipped.Load(),
+		AttachmentsFailed:     p.AttachmentsFailed.Load(),
+		AttachmentBytes:       p.AttachmentBytes.Load(),
+		WorkerQueueDepth:      p.WorkerQueueDepth.Load(),
+		InteractiveQueueDepth: p.InteractiveQueueDepth.Load(),
+		MediaQueueDepth:       p.MediaQueueDepth.Load(),
+		BackgroundQueueDepth:  p.BackgroundQueueDepth.Load(),
 	}
 }
 
-// StartPeriodicLog logs a snapshot every interval until ctx is done.
-func StartPeriodicLog(log zerolog.Logger, interval time.Duration, stop <-chan struct{}) {
+// StartPeriodicLog logs a snapshot every interval until ctx is done, with
+// the topSendWaits threads that waited longest for the rate limiter.
+func StartPeriodicLog(log zerolog.Logger, interval time.Duration, topSendWaits int, stop <-chan struct{}) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 	for {
@@ -77,16 +184,40 @@ func StartPeriodicLog(log zerolog.Logger, interval time.Duration, stop <-chan st
 			runtime.ReadMemStats(&memStats)
 			numGoroutines := runtime.NumGoroutine()
 
-			log.Info().
+			evt := log.Info()
+			if top := Global.TakeSendWaits(topSendWaits); len(top) > 0 {
+				arr := zerolog.Arr()
+				for _, w := range top {
+					arr = arr.Dict(zerolog.Dict().
+						Int64("thread", w.ThreadID).
+						Int64("sends", w.Sends).
+						Int64("total_ms", w.TotalNs/int64(time.Millisecond)).
+						Int64("max_ms", w.MaxNs/int64(time.Millisecond)))
+				}
+				evt = evt.Array("send_wait_top", arr)
+			}
+			evt.
 				Int64("msg_received", s.MessagesReceived).
 				Int64("msg_processed", s.MessagesProcessed).
 				Int64("msg_dropped", s.MessagesDropped).
 				Int64("cmds_executed", s.CommandsExecuted).
 				Int64("send_rate_limited", s.SendRateLimited).
+				Int64("send_wait_ms_total", s.SendWaitMs).
 				Int64("db_write_ops", s.DBWriteOps).
 				Int64("db_batches", s.DBWriteBatches).
 				Int64("db_write_ms_total", s.DBWriteDurationMs).
+				Int64("msg_pruned", s.MessagesPruned).
+				Int64("msg_slimmed", s.MessagesSlimmed).
+				Int64("db_vacuums", s.DBVacuums).
+				Int64("att_archived", s.AttachmentsArchived).
+				Int64("att_deduped", s.AttachmentsDeduped).
+				Int64("att_skipped", s.AttachmentsSkipped).
+				Int64("att_failed", s.AttachmentsFailed).
+				Int64("att_archived_mb", s.AttachmentBytes>>20).
 				Int64("worker_queue_depth", s.WorkerQueueDepth).
+				Int64("queue_interactive", s.InteractiveQueueDepth).
+				Int64("queue_media", s.MediaQueueDepth).
+				Int64("queue_background", s.BackgroundQueueDepth).
 				Int("goroutines", numGoroutines).
 				Uint64("heap_alloc_mb", memStats.HeapAlloc/1024/1024).
 				Uint64("heap_inuse_mb", memStats.HeapInuse/1024/1024).
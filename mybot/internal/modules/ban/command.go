@@ -0,0 +1,270 @@
+package ban
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mybot/internal/core"
+)
+
+const usage = "cách dùng: !ban <@người|id> [thời hạn] [lý do] — bot bỏ qua người đó trong nhóm này\n" +
+	"!ban global <@người|id> [thời hạn] [lý do] | !ban thread [id] [thời hạn] [lý do] (chủ bot)\n" +
+	"!ban list [all] | !ban remove [global|thread] <@người|id>\n" +
+	"thời hạn: 30m, 2h, 7d, 2w; bỏ trống = vĩnh viễn"
+
+type Command struct{}
+
+func (c *Command) Name() string {
+	return "ban"
+}
+
+func (c *Command) Description() string {
+	return "Danh sách chặn: bot bỏ qua người dùng hoặc cả nhóm"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	if ctx.Bans == nil {
+		return errors.New("danh sách chặn chưa được bật")
+	}
+	if len(ctx.Args) == 0 {
+		return errors.New(usage)
+	}
+	switch strings.ToLower(ctx.Args[0]) {
+	case "list", "ls", "dsach":
+		return c.list(ctx)
+	case "remove", "unban", "gỡ", "bỏ":
+		return c.remove(ctx)
+	case "global", "all", "toàncục":
+		if err := ctx.RequireRole(core.RoleOwner); err != nil {
+			return err
+		}
+		return c.banUser(ctx, 0, 2) // "!ban global"
+	case "thread", "group", "nhóm":
+		if err := ctx.RequireRole(core.RoleOwner); err != nil {
+			return err
+		}
+		return c.banThread(ctx)
+	}
+	if err := ctx.RequireRole(core.RoleAdmin); err != nil {
+		return err
+	}
+	return c.banUser(ctx, ctx.ThreadID, 1) // "!ban"
+}
+
+// banUser bans the target named after the first skip words in threadID
+// (0 = everywhere).
+func (c *Command) banUser(ctx *core.CommandContext, threadID int64, skip int) error {
+	words := core.StripMentions(ctx.RawText, ctx.Mentions)
+	words = words[min(skip, len(words)):]
+	userID, words, err := target(ctx, words)
+	if err != nil {
+		return err
+	}
+	expiresAt, reason := parseTail(words, time.Now())
+	b, err := ctx.Bans.Ban(ctx.Ctx, core.BanRequest{ThreadID: threadID, UserID: userID, Reason: reason, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+	where := "trong nhóm này"
+	if threadID == 0 {
+		where = "ở mọi nơi"
+	}
+	return c.reply(ctx, fmt.Sprintf("🚫 Bot sẽ bỏ qua %s %s%s.", c.userName(ctx, userID), where, c.suffix(ctx, b)))
+}
+
+func (c *Command) banThread(ctx *core.CommandContext) error {
+	words := strings.Fields(ctx.RawText)
+	words = words[min(2, len(words)):] // "!ban thread"
+	threadID := ctx.ThreadID
+	if len(words) > 0 {
+		if id, err := strconv.ParseInt(words[0], 10, 64); err == nil && id > 0 {
+			threadID, words = id, words[1:]
+		}
+	}
+	expiresAt, reason := parseTail(words, time.Now())
+	b, err := ctx.Bans.Ban(ctx.Ctx, core.BanRequest{ThreadID: threadID, Reason: reason, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+	what := fmt.Sprintf("nhóm %d", threadID)
+	if threadID == ctx.ThreadID {
+		what = "nhóm này"
+	}
+	return c.reply(ctx, fmt.Sprintf("🚫 Bot sẽ bỏ qua %s (trừ chủ bot)%s.", what, c.suffix(ctx, b)))
+}
+
+func (c *Command) remove(ctx *core.CommandContext) error {
+	words := core.StripMentions(ctx.RawText, ctx.Mentions)
+	words = words[min(2, len(words)):] // "!ban remove"
+	scope := ""
+	if len(words) > 0 {
+		switch strings.ToLower(words[0]) {
+		case "global", "all", "toàncục":
+			scope, words = "global", words[1:]
+		case "thread", "group", "nhóm":
+			scope, words = "thread", words[1:]
+		}
+	}
+
+	threadID, userID := ctx.ThreadID, int64(0)
+	switch scope {
+	case "thread":
+		if len(words) > 0 {
+			id, err := strconv.ParseInt(words[0], 10, 64)
+			if err != nil || id <= 0 {
+				return fmt.Errorf("id nhóm không hợp lệ: %s", words[0])
+			}
+			threadID = id
+		}
+	default:
+		var err error
+		if userID, _, err = target(ctx, words); err != nil {
+			return err
+		}
+		if scope == "global" {
+			threadID = 0
+		}
+	}
+	role := core.RoleAdmin
+	if scope != "" {
+		role = core.RoleOwner
+	}
+	if err := ctx.RequireRole(role); err != nil {
+		return err
+	}
+	if err := ctx.Bans.Unban(ctx.Ctx, threadID, userID); err != nil {
+		return err
+	}
+	if userID == 0 {
+		return c.reply(ctx, fmt.Sprintf("✅ Đã bỏ chặn nhóm %d.", threadID))
+	}
+	return c.reply(ctx, fmt.Sprintf("✅ Đã bỏ chặn %s.", c.userName(ctx, userID)))
+}
+
+func (c *Command) list(ctx *core.CommandContext) error {
+	threadID := ctx.ThreadID
+	if len(ctx.Args) > 1 && strings.EqualFold(ctx.Args[1], "all") {
+		if err := ctx.RequireRole(core.RoleOwner); err != nil {
+			return err
+		}
+		threadID = 0
+	} else if err := ctx.RequireRole(core.RoleAdmin); err != nil {
+		return err
+	}
+	bans, err := ctx.Bans.ListBans(ctx.Ctx, threadID)
+	if err != nil {
+		return err
+	}
+	if len(bans) == 0 {
+		return c.reply(ctx, "Danh sách chặn trống.")
+	}
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	var b strings.Builder
+	fmt.Fprintf(&b, "🚫 %d mục bị chặn:", len(bans))
+	for _, ban := range bans {
+		switch {
+		case ban.WholeThread():
+			fmt.Fprintf(&b, "\n• cả nhóm %d", ban.ThreadID)
+		case ban.Global():
+			fmt.Fprintf(&b, "\n• %s (mọi nơi)", c.userName(ctx, ban.UserID))
+		case threadID == 0:
+			fmt.Fprintf(&b, "\n• %s (nhóm %d)", c.userName(ctx, ban.UserID), ban.ThreadID)
+		default:
+			fmt.Fprintf(&b, "\n• %s", c.userName(ctx, ban.UserID))
+		}
+		if ban.ExpiresAtUnixMs > 0 {
+			fmt.Fprintf(&b, " — đến %s", formatTime(time.UnixMilli(ban.ExpiresAtUnixMs), loc))
+		} else {
+			b.WriteString(" — vĩnh viễn")
+		}
+		if ban.Reason != "" {
+			fmt.Fprintf(&b, " — %s", ban.Reason)
+		}
+	}
+	return ctx.SendPagedText(b.String())
+}
+
+// suffix describes the expiry and reason of b for a reply.
+func (c *Command) suffix(ctx *core.CommandContext, b *core.Ban) string {
+	var s string
+	if b.ExpiresAtUnixMs > 0 {
+		s = " đến " + formatTime(time.UnixMilli(b.ExpiresAtUnixMs), ctx.Conversation.ThreadLocation(ctx.ThreadID))
+	}
+	if b.Reason != "" {
+		s += ". Lý do: " + b.Reason
+	}
+	return s
+}
+
+func (c *Command) reply(ctx *core.CommandContext, text string) error {
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, text)
+}
+
+func (c *Command) userName(ctx *core.CommandContext, userID int64) string {
+	if user, err := ctx.Conversation.GetUser(ctx.Ctx, userID); err == nil && user != nil && user.Name != "" {
+		return user.Name
+	}
+	return strconv.FormatInt(userID, 10)
+}
+
+// target returns the mentioned user, or the user ID that words start with,
+// and the words after it.
+func target(ctx *core.CommandContext, words []string) (int64, []string, error) {
+	if ids := ctx.MentionedUserIDs(); len(ids) > 0 {
+		return ids[0], words, nil
+	}
+	if len(words) == 0 {
+		return 0, nil, errors.New("hãy @nhắc hoặc ghi id của người cần chặn")
+	}
+	id, err := strconv.ParseInt(words[0], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, nil, fmt.Errorf("id không hợp lệ: %s", words[0])
+	}
+	return id, words[1:], nil
+}
+
+// parseTail reads an optional duration ("30m", "2h", "7d", "2w") followed by
+// the reason. Without a duration the ban is permanent.
+func parseTail(words []string, now time.Time) (time.Time, string) {
+	var expiresAt time.Time
+	if len(words) > 0 {
+		if d, ok := parseDuration(words[0]); ok {
+			expiresAt, words = now.Add(d), words[1:]
+		}
+	}
+	return expiresAt, strings.Join(words, " ")
+}
+
+// parseDuration reads a number with an m/h/d/w suffix. Plain numbers are not
+// durations, so they can be read as IDs.
+func parseDuration(s string) (time.Duration, bool) {
+	s = strings.ToLower(s)
+	if len(s) < 2 {
+		return 0, false
+	}
+	var unit time.Duration
+	switch s[len(s)-1] {
+	case 'm':
+		unit = time.Minute
+	case 'h':
+		unit = time.Hour
+	case 'd':
+		unit = 24 * time.Hour
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	default:
+		return 0, false
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+func formatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("15:04 02/01/2006")
+}
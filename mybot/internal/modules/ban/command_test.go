@@ -0,0 +1,55 @@
+package ban
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"mybot/internal/core"
+)
+
+func TestParseTail(t *testing.T) {
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		words      []string
+		wantAt     time.Time
+		wantReason string
+	}{
+		{nil, time.Time{}, ""},
+		{[]string{"2h", "spam", "link"}, now.Add(2 * time.Hour), "spam link"},
+		{[]string{"7D"}, now.Add(7 * 24 * time.Hour), ""},
+		{[]string{"2w", "lừa", "đảo"}, now.Add(14 * 24 * time.Hour), "lừa đảo"},
+		{[]string{"30", "phút"}, time.Time{}, "30 phút"}, // plain numbers are not durations
+		{[]string{"chửi", "bậy"}, time.Time{}, "chửi bậy"},
+	}
+	for _, tt := range tests {
+		at, reason := parseTail(tt.words, now)
+		if !at.Equal(tt.wantAt) || reason != tt.wantReason {
+			t.Errorf("parseTail(%q) = %v, %q; want %v, %q", tt.words, at, reason, tt.wantAt, tt.wantReason)
+		}
+	}
+}
+
+func TestTargetAndStripMentions(t *testing.T) {
+	ctx := &core.CommandContext{
+		RawText:  "!ban global @Nam Lê 1d spam",
+		Mentions: []core.Mention{{UserID: 7, Offset: 12, Length: 7}},
+	}
+	words := core.StripMentions(ctx.RawText, ctx.Mentions)
+	if !reflect.DeepEqual(words, []string{"!ban", "global", "1d", "spam"}) {
+		t.Fatalf("StripMentions() = %q", words)
+	}
+	id, rest, err := target(ctx, words[2:])
+	if err != nil || id != 7 || !reflect.DeepEqual(rest, []string{"1d", "spam"}) {
+		t.Fatalf("target(mention) = %d, %q, %v", id, rest, err)
+	}
+
+	ctx.Mentions = nil
+	id, rest, err = target(ctx, []string{"100001111", "spam"})
+	if err != nil || id != 100001111 || !reflect.DeepEqual(rest, []string{"spam"}) {
+		t.Fatalf("target(id) = %d, %q, %v", id, rest, err)
+	}
+	if _, _, err := target(ctx, []string{"Nam"}); err == nil {
+		t.Fatal("target(name) error = nil, want error")
+	}
+}
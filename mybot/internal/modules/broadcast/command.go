@@ -0,0 +1,220 @@
+package broadcast
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"mybot/internal/core"
+)
+
+const usage = "cách dùng: !broadcast <all|groups|active <ngày>|to <id,id...>> <nội dung>\n" +
+	"!broadcast dry <đối tượng> | !broadcast status [id] | !broadcast list | !broadcast cancel <id>"
+
+// dryRunListed is how many thread names a dry run shows.
+const dryRunListed = 20
+
+type Command struct{}
+
+func (c *Command) Name() string {
+	return "broadcast"
+}
+
+func (c *Command) Description() string {
+	return "Gửi thông báo tới nhiều nhóm (chỉ chủ bot)"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	if err := ctx.RequireRole(core.RoleOwner); err != nil {
+		return err
+	}
+	if ctx.Broadcasts == nil {
+		return errors.New("broadcast chưa được bật")
+	}
+	if len(ctx.Args) == 0 {
+		return errors.New(usage)
+	}
+	switch strings.ToLower(ctx.Args[0]) {
+	case "dry", "dry-run", "preview":
+		return c.dryRun(ctx)
+	case "status":
+		return c.status(ctx)
+	case "list", "ls":
+		return c.list(ctx)
+	case "cancel", "huy", "huỷ", "hủy":
+		return c.cancel(ctx)
+	}
+
+	target, used, err := ParseTarget(ctx.Args)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, usage)
+	}
+	text := ctx.TextAfter(used + 1) // +1 for "!broadcast"
+	if text == "" {
+		return errors.New("thiếu nội dung thông báo\n" + usage)
+	}
+	b, err := ctx.Broadcasts.StartBroadcast(ctx.Ctx, ctx.ThreadID, text, target)
+	if err != nil {
+		return err
+	}
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID,
+		fmt.Sprintf("📣 Bắt đầu broadcast #%d tới %d thread (%s). Báo cáo sẽ gửi về đây khi xong.", b.ID, b.Total, b.Target))
+}
+
+// ParseTarget reads a broadcast target from the start of args: "all",
+// "groups", "active <days>" or "to <id,id...>". It returns the target and the
+// number of args used.
+func ParseTarget(args []string) (core.BroadcastTarget, int, error) {
+	if len(args) == 0 {
+		return core.BroadcastTarget{}, 0, errors.New("thiếu đối tượng gửi")
+	}
+	switch strings.ToLower(args[0]) {
+	case "all", "tất", "tatca":
+		return core.BroadcastTarget{Kind: core.BroadcastAll}, 1, nil
+	case "groups", "group", "nhóm":
+		return core.BroadcastTarget{Kind: core.BroadcastGroups}, 1, nil
+	case "active":
+		if len(args) < 2 {
+			return core.BroadcastTarget{}, 0, errors.New("cách dùng: active <số ngày>, ví dụ active 7")
+		}
+		days, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(args[1]), "d"))
+		if err != nil || days <= 0 {
+			return core.BroadcastTarget{}, 0, fmt.Errorf("số ngày không hợp lệ: %s", args[1])
+		}
+		return core.BroadcastTarget{Kind: core.BroadcastActive, ActiveDays: days}, 2, nil
+	case "to", "list":
+		target := core.BroadcastTarget{Kind: core.BroadcastList}
+		used := 1
+		for ; used < len(args) && isIDList(args[used]); used++ {
+			for _, part := range strings.Split(args[used], ",") {
+				if part == "" {
+					continue
+				}
+				id, err := strconv.ParseInt(part, 10, 64)
+				if err != nil {
+					return core.BroadcastTarget{}, 0, fmt.Errorf("id không hợp lệ: %s", part)
+				}
+				target.ThreadIDs = append(target.ThreadIDs, id)
+			}
+		}
+		if len(target.ThreadIDs) == 0 {
+			return core.BroadcastTarget{}, 0, errors.New("cách dùng: to <id,id...>")
+		}
+		return target, used, nil
+	}
+	return core.BroadcastTarget{}, 0, fmt.Errorf("không hiểu đối tượng %q", args[0])
+}
+
+func isIDList(s string) bool {
+	for _, r := range s {
+		if r != ',' && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func (c *Command) dryRun(ctx *core.CommandContext) error {
+	target, _, err := ParseTarget(ctx.Args[1:])
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, usage)
+	}
+	ids, err := ctx.Broadcasts.BroadcastTargets(ctx.Ctx, target)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔎 Broadcast %s sẽ gửi tới %d thread.", target, len(ids))
+	for i, id := range ids {
+		if i == dryRunListed {
+			fmt.Fprintf(&b, "\n… và %d thread khác", len(ids)-i)
+			break
+		}
+		name := strconv.FormatInt(id, 10)
+		if t, err := ctx.Conversation.GetThread(ctx.Ctx, id); err == nil && t != nil && t.Name != "" {
+			name = fmt.Sprintf("%s (%d)", t.Name, id)
+		}
+		b.WriteString("\n• " + name)
+	}
+	return ctx.SendPagedText(b.String())
+}
+
+func (c *Command) status(ctx *core.CommandContext) error {
+	var id int64
+	if len(ctx.Args) > 1 {
+		var err error
+		if id, err = parseID(ctx.Args[1]); err != nil {
+			return err
+		}
+	} else {
+		recent, err := ctx.Broadcasts.ListBroadcasts(ctx.Ctx, 1)
+		if err != nil {
+			return err
+		}
+		if len(recent) == 0 {
+			return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Chưa có broadcast nào.")
+		}
+		id = recent[0].ID
+	}
+	report, err := ctx.Broadcasts.BroadcastReport(ctx.Ctx, id)
+	if err != nil {
+		return fmt.Errorf("không tìm thấy broadcast #%d", id)
+	}
+	return ctx.SendPagedText(report)
+}
+
+func (c *Command) list(ctx *core.CommandContext) error {
+	recent, err := ctx.Broadcasts.ListBroadcasts(ctx.Ctx, 10)
+	if err != nil {
+		return err
+	}
+	if len(recent) == 0 {
+		return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Chưa có broadcast nào.")
+	}
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	var b strings.Builder
+	b.WriteString("📣 Broadcast gần đây:")
+	for _, bc := range recent {
+		fmt.Fprintf(&b, "\n#%d %s [%s] %s — %d/%d, %d lỗi — %s", bc.ID,
+			time.UnixMilli(bc.CreatedAtUnixMs).In(loc).Format("15:04 02/01/2006"),
+			bc.Status, bc.Target, bc.Sent, bc.Total, bc.Failed, truncate(bc.Text, 40))
+	}
+	return ctx.SendPagedText(b.String())
+}
+
+func (c *Command) cancel(ctx *core.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return errors.New("cách dùng: !broadcast cancel <id>")
+	}
+	id, err := parseID(ctx.Args[1])
+	if err != nil {
+		return err
+	}
+	if err := ctx.Broadcasts.CancelBroadcast(ctx.Ctx, id); err != nil {
+		return fmt.Errorf("không có broadcast #%d đang chạy", id)
+	}
+	report, err := ctx.Broadcasts.BroadcastReport(ctx.Ctx, id)
+	if err != nil {
+		return err
+	}
+	return ctx.SendPagedText(report)
+}
+
+func parseID(s string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(s, "#"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("id không hợp lệ: %s", s)
+	}
+	return id, nil
+}
+
+func truncate(s string, n int) string {
+	r := []rune(strings.ReplaceAll(s, "\n", " "))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n]) + "…"
+}
@@ -0,0 +1,33 @@
+package broadcast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"mybot/internal/core"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		input string
+		want  core.BroadcastTarget
+		used  int
+	}{
+		{"all Xin chào", core.BroadcastTarget{Kind: core.BroadcastAll}, 1},
+		{"groups Xin chào", core.BroadcastTarget{Kind: core.BroadcastGroups}, 1},
+		{"active 7d Xin chào", core.BroadcastTarget{Kind: core.BroadcastActive, ActiveDays: 7}, 2},
+		{"to 1,2 3 Xin chào", core.BroadcastTarget{Kind: core.BroadcastList, ThreadIDs: []int64{1, 2, 3}}, 3},
+	}
+	for _, tt := range tests {
+		got, used, err := ParseTarget(strings.Fields(tt.input))
+		if err != nil || used != tt.used || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTarget(%q) = %+v, %d, %v; want %+v, %d", tt.input, got, used, err, tt.want, tt.used)
+		}
+	}
+	for _, input := range []string{"", "active", "active x", "to hello", "everyone hi"} {
+		if _, _, err := ParseTarget(strings.Fields(input)); err == nil {
+			t.Errorf("ParseTarget(%q) error = nil, want error", input)
+		}
+	}
+}
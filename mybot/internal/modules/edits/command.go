@@ -0,0 +1,127 @@
+package edits
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mybot/internal/core"
+)
+
+type Command struct{}
+
+func (c *Command) Name() string {
+	return "edits"
+}
+
+func (c *Command) Description() string {
+	return "Xem lịch sử chỉnh sửa của tin nhắn được reply"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	if ctx.ReplyToMessageID == "" {
+		return fmt.Errorf("cách dùng: reply một tin nhắn rồi gửi !edits")
+	}
+
+	msg, err := ctx.Messages.GetMessage(ctx.Ctx, ctx.ReplyToMessageID)
+	if err != nil {
+		return err
+	}
+	if msg == nil {
+		return fmt.Errorf("không tìm thấy tin nhắn trong lịch sử")
+	}
+
+	history, err := ctx.Conversation.GetEditHistory(ctx.Ctx, msg.MessageID)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		if msg.IsEdited {
+			return errors.New("tin nhắn đã được sửa nhưng chưa có lịch sử được ghi lại")
+		}
+		return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Tin nhắn này chưa từng được chỉnh sửa.")
+	}
+
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, formatHistory(msg, history, ctx.Conversation.ThreadLocation(ctx.ThreadID)))
+}
+
+// formatHistory renders the original text followed by a word diff for every
+// later version, ending with the current text. Times are shown in loc.
+func formatHistory(msg *core.MessageRecord, history []*core.MessageEdit, loc *time.Location) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "✏️ Lịch sử chỉnh sửa (%d lần) — %s\n", len(history), msg.SenderNameSnapshot)
+	fmt.Fprintf(&b, "#0 [%s] %s\n", formatTime(history[0].TimestampMs, loc), history[0].Text)
+	for i := 1; i < len(history); i++ {
+		fmt.Fprintf(&b, "#%d [%s] %s\n", i, formatTime(history[i].TimestampMs, loc), WordDiff(history[i-1].Text, history[i].Text))
+	}
+	last := history[len(history)-1].Text
+	fmt.Fprintf(&b, "Hiện tại: %s", WordDiff(last, msg.Text))
+	if msg.IsRecalled {
+		b.WriteString("\n(tin nhắn đã bị thu hồi)")
+	}
+	return b.String()
+}
+
+func formatTime(ms int64, loc *time.Location) string {
+	if ms <= 0 {
+		return "?"
+	}
+	return time.UnixMilli(ms).In(loc).Format("15:04 02/01")
+}
+
+// WordDiff returns b annotated against a at word granularity: removed words
+// are wrapped in [-...-] and inserted words in {+...+}.
+func WordDiff(a, b string) string {
+	from := strings.Fields(a)
+	to := strings.Fields(b)
+
+	// Longest common subsequence table over words.
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	var removed, added []string
+	flush := func() {
+		if len(removed) > 0 {
+			out = append(out, "[-"+strings.Join(removed, " ")+"-]")
+			removed = removed[:0]
+		}
+		if len(added) > 0 {
+			out = append(out, "{+"+strings.Join(added, " ")+"+}")
+			added = added[:0]
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			flush()
+			out = append(out, from[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			removed = append(removed, from[i])
+			i++
+		default:
+			added = append(added, to[j])
+			j++
+		}
+	}
+	removed = append(removed, from[i:]...)
+	added = append(added, to[j:]...)
+	flush()
+	return strings.Join(out, " ")
+}
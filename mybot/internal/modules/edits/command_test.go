@@ -0,0 +1,40 @@
+package edits
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mybot/internal/core"
+)
+
+func TestWordDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "unchanged", a: "xin chào bạn", b: "xin chào bạn", want: "xin chào bạn"},
+		{name: "replace word", a: "hẹn gặp lúc 8h", b: "hẹn gặp lúc 9h", want: "hẹn gặp lúc [-8h-] {+9h+}"},
+		{name: "append", a: "ok", b: "ok nhé", want: "ok {+nhé+}"},
+		{name: "remove prefix", a: "à mà thôi", b: "thôi", want: "[-à mà-] thôi"},
+		{name: "from empty", a: "", b: "mới", want: "{+mới+}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WordDiff(tt.a, tt.b); got != tt.want {
+				t.Errorf("WordDiff(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatHistoryUsesThreadLocation(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	at := time.Date(2026, 3, 1, 23, 30, 0, 0, loc)
+	msg := &core.MessageRecord{Text: "mới", SenderNameSnapshot: "An"}
+	history := []*core.MessageEdit{{Text: "cũ", TimestampMs: at.UnixMilli()}}
+	if got := formatHistory(msg, history, loc); !strings.Contains(got, "#0 [23:30 01/03] cũ") {
+		t.Fatalf("formatHistory() = %q, want the time in the thread's zone", got)
+	}
+}
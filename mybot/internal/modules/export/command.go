@@ -0,0 +1,102 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mybot/internal/core"
+	"mybot/internal/export"
+)
+
+const usage = "cách dùng: !export [html|json|csv] [sau:7d|01/10/2026] [trước:20/10/2026]\n" +
+	"bot gửi file lịch sử nhóm vào đây; mặc định html, toàn bộ tin đã lưu"
+
+const (
+	// maxMessages is how many of the newest messages one export holds.
+	maxMessages = 20000
+	// maxFileSize is the largest file Messenger accepts.
+	maxFileSize = 25 << 20
+)
+
+type Command struct{}
+
+func (c *Command) Name() string {
+	return "export"
+}
+
+func (c *Command) Description() string {
+	return "Xuất lịch sử nhóm ra file html, json hoặc csv (quản trị viên)"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	if err := ctx.RequireRole(core.RoleAdmin); err != nil {
+		return err
+	}
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	now := time.Now().In(loc)
+	opts, err := parseArgs(ctx.Args, now)
+	if err != nil {
+		return err
+	}
+	opts.ThreadID = ctx.ThreadID
+	opts.MaxMessages = maxMessages
+	opts.Location = loc
+
+	var buf bytes.Buffer
+	stats, err := export.Export(ctx.Ctx, &buf, ctx.Conversation, opts)
+	if err != nil {
+		return err
+	}
+	if stats.Messages == 0 {
+		return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Không có tin nhắn nào đã lưu trong khoảng này.")
+	}
+	if buf.Len() > maxFileSize {
+		return fmt.Errorf("file xuất quá lớn (%d MB), hãy thu hẹp bằng sau:/trước: hoặc dùng `bot export` trên máy chủ", buf.Len()>>20)
+	}
+
+	caption := fmt.Sprintf("📦 Lịch sử nhóm: %d tin nhắn", stats.Messages)
+	if stats.Truncated {
+		caption += fmt.Sprintf(" (chỉ %d tin mới nhất)", maxMessages)
+	}
+	filename := fmt.Sprintf("%d-%s.%s", ctx.ThreadID, now.Format("20060102-1504"), opts.Format.Ext())
+	return ctx.Sender.SendMedia(ctx.Ctx, ctx.ThreadID, buf.Bytes(), filename, opts.Format.MimeType(), caption)
+}
+
+// parseArgs reads the format and the "sau:" / "trước:" bounds.
+func parseArgs(args []string, now time.Time) (export.Options, error) {
+	opts := export.Options{Format: export.FormatHTML}
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, ":")
+		if !ok {
+			format, err := export.ParseFormat(arg)
+			if err != nil {
+				return opts, fmt.Errorf("định dạng không hợp lệ: %s\n%s", arg, usage)
+			}
+			opts.Format = format
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "since", "sau":
+			t, err := core.ParseDateFilter(value, now, now.Location(), false)
+			if err != nil {
+				return opts, err
+			}
+			opts.Since = t
+		case "until", "trước", "truoc":
+			t, err := core.ParseDateFilter(value, now, now.Location(), true)
+			if err != nil {
+				return opts, err
+			}
+			opts.Until = t
+		default:
+			return opts, fmt.Errorf("bộ lọc không hợp lệ: %s\n%s", arg, usage)
+		}
+	}
+	if !opts.Since.IsZero() && !opts.Until.IsZero() && !opts.Since.Before(opts.Until) {
+		return opts, errors.New("mốc sau: phải trước mốc trước:")
+	}
+	return opts, nil
+}
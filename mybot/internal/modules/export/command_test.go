@@ -0,0 +1,37 @@
+package export
+
+import (
+	"testing"
+	"time"
+
+	"mybot/internal/export"
+)
+
+func TestParseArgs(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, loc)
+
+	opts, err := parseArgs(nil, now)
+	if err != nil || opts.Format != export.FormatHTML || !opts.Since.IsZero() || !opts.Until.IsZero() {
+		t.Fatalf("parseArgs() = %+v, %v; want html, no range", opts, err)
+	}
+
+	opts, err = parseArgs([]string{"csv", "sau:7d", "trước:18/10"}, now)
+	if err != nil {
+		t.Fatalf("parseArgs() error = %v", err)
+	}
+	if opts.Format != export.FormatCSV || !opts.Since.Equal(now.AddDate(0, 0, -7)) || !opts.Until.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, loc)) {
+		t.Fatalf("parseArgs() = %+v", opts)
+	}
+
+	for _, args := range [][]string{
+		{"pdf"},
+		{"từ:7"},
+		{"sau:hôm-qua"},
+		{"sau:20/10", "trước:10/10"},
+	} {
+		if _, err := parseArgs(args, now); err == nil {
+			t.Errorf("parseArgs(%q) error = nil", args)
+		}
+	}
+}
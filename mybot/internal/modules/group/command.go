@@ -0,0 +1,229 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mybot/internal/core"
+	"mybot/internal/media"
+)
+
+const usage = "cách dùng: !group kick|promote|demote <@người|id> | !group add <@người|id...>\n" +
+	"!group rename <tên> | !group nick [@người] [biệt danh] | !group emoji <emoji> | !group avatar <url ảnh>\n" +
+	"kick/promote/demote/nick cũng nhận reply vào tin nhắn của người đó"
+
+type Command struct{}
+
+func (c *Command) Name() string {
+	return "group"
+}
+
+func (c *Command) Description() string {
+	return "Quản lý nhóm: kick, add, promote, rename, nick, emoji, avatar"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	if ctx.Threads == nil {
+		return errors.New("quản lý nhóm chưa được bật")
+	}
+	if len(ctx.Args) == 0 {
+		return errors.New(usage)
+	}
+	switch strings.ToLower(ctx.Args[0]) {
+	case "kick", "remove", "đuổi":
+		return c.kick(ctx)
+	case "add", "thêm":
+		return c.add(ctx)
+	case "promote", "admin":
+		return c.setAdmin(ctx, true)
+	case "demote", "unadmin":
+		return c.setAdmin(ctx, false)
+	case "rename", "name", "đổitên":
+		return c.rename(ctx)
+	case "nick", "nickname", "biệtdanh":
+		return c.nick(ctx)
+	case "emoji":
+		return c.emoji(ctx)
+	case "avatar", "photo", "ảnh":
+		return c.avatar(ctx)
+	}
+	return fmt.Errorf("không có lệnh con %q\n%s", ctx.Args[0], usage)
+}
+
+func (c *Command) kick(ctx *core.CommandContext) error {
+	targets, err := c.targets(ctx)
+	if err != nil {
+		return err
+	}
+	var removed []string
+	for _, userID := range targets {
+		if err := ctx.Threads.RemoveParticipant(ctx.Ctx, ctx.ThreadID, userID); err != nil {
+			return c.partial(ctx, "Đã xoá", removed, fmt.Errorf("xoá %s: %w", c.userName(ctx, userID), err))
+		}
+		removed = append(removed, c.userName(ctx, userID))
+	}
+	return c.reply(ctx, "👋 Đã xoá %s khỏi nhóm.", strings.Join(removed, ", "))
+}
+
+func (c *Command) add(ctx *core.CommandContext) error {
+	ids := ctx.MentionedUserIDs()
+	if len(ids) == 0 {
+		var err error
+		if ids, err = parseUserIDs(ctx.Args[1:]); err != nil {
+			return err
+		}
+	}
+	if len(ids) == 0 {
+		return errors.New("cách dùng: !group add <@người|id...>")
+	}
+	if err := ctx.Threads.AddParticipants(ctx.Ctx, ctx.ThreadID, ids); err != nil {
+		return err
+	}
+	return c.reply(ctx, "✅ Đã thêm %d người vào nhóm.", len(ids))
+}
+
+func (c *Command) setAdmin(ctx *core.CommandContext, admin bool) error {
+	targets, err := c.targets(ctx)
+	if err != nil {
+		return err
+	}
+	verb := "Đã cho làm quản trị viên"
+	if !admin {
+		verb = "Đã gỡ quản trị viên"
+	}
+	var done []string
+	for _, userID := range targets {
+		if err := ctx.Threads.SetAdmin(ctx.Ctx, ctx.ThreadID, userID, admin); err != nil {
+			return c.partial(ctx, verb, done, fmt.Errorf("%s: %w", c.userName(ctx, userID), err))
+		}
+		done = append(done, c.userName(ctx, userID))
+	}
+	return c.reply(ctx, "⭐ %s: %s.", verb, strings.Join(done, ", "))
+}
+
+func (c *Command) rename(ctx *core.CommandContext) error {
+	name := ctx.TextAfter(2) // "!group rename"
+	if name == "" {
+		return errors.New("cách dùng: !group rename <tên nhóm>")
+	}
+	if err := ctx.Threads.RenameThread(ctx.Ctx, ctx.ThreadID, name); err != nil {
+		return err
+	}
+	return c.reply(ctx, "✏️ Đã đổi tên nhóm thành %q.", name)
+}
+
+func (c *Command) nick(ctx *core.CommandContext) error {
+	userID := ctx.SenderID
+	if ids := ctx.MentionedUserIDs(); len(ids) > 0 {
+		userID = ids[0]
+	} else if replied := c.repliedSender(ctx); replied != 0 {
+		userID = replied
+	}
+	words := core.StripMentions(ctx.RawText, ctx.Mentions)
+	nickname := strings.Join(words[min(len(words), 2):], " ") // "!group nick"
+	if err := ctx.Threads.SetNickname(ctx.Ctx, ctx.ThreadID, userID, nickname); err != nil {
+		return err
+	}
+	if nickname == "" {
+		return c.reply(ctx, "🏷️ Đã xoá biệt danh của %s.", c.userName(ctx, userID))
+	}
+	return c.reply(ctx, "🏷️ Đã đặt biệt danh của %s thành %q.", c.userName(ctx, userID), nickname)
+}
+
+func (c *Command) emoji(ctx *core.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return errors.New("cách dùng: !group emoji <emoji>")
+	}
+	if err := ctx.Threads.SetEmoji(ctx.Ctx, ctx.ThreadID, ctx.Args[1]); err != nil {
+		return err
+	}
+	return c.reply(ctx, "Đã đổi emoji nhóm thành %s.", ctx.Args[1])
+}
+
+func (c *Command) avatar(ctx *core.CommandContext) error {
+	if len(ctx.Args) < 2 || !strings.HasPrefix(ctx.Args[1], "http") {
+		return errors.New("cách dùng: !group avatar <url ảnh>")
+	}
+	data, mimeType, err := media.DownloadMedia(ctx.Ctx, ctx.Args[1])
+	if err != nil {
+		return fmt.Errorf("không tải được ảnh: %w", err)
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	if !strings.HasPrefix(mimeType, "image/") {
+		return fmt.Errorf("url không phải ảnh (%s)", mimeType)
+	}
+	image := &core.MediaAttachment{Data: data, Filename: media.FilenameFromMIME(mimeType), MimeType: mimeType}
+	if err := ctx.Threads.SetImage(ctx.Ctx, ctx.ThreadID, image); err != nil {
+		return err
+	}
+	return c.reply(ctx, "🖼️ Đã đổi ảnh nhóm.")
+}
+
+// targets returns the users a kick/promote/demote applies to: the mentioned
+// users, the IDs given as arguments, or the sender of the replied message.
+func (c *Command) targets(ctx *core.CommandContext) ([]int64, error) {
+	if ids := ctx.MentionedUserIDs(); len(ids) > 0 {
+		return ids, nil
+	}
+	ids, err := parseUserIDs(ctx.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		return ids, nil
+	}
+	if replied := c.repliedSender(ctx); replied != 0 {
+		return []int64{replied}, nil
+	}
+	return nil, fmt.Errorf("hãy @nhắc, ghi id hoặc reply tin nhắn của người cần %s", ctx.Args[0])
+}
+
+func (c *Command) repliedSender(ctx *core.CommandContext) int64 {
+	if ctx.ReplyToMessageID == "" {
+		return 0
+	}
+	msg, err := ctx.Messages.GetMessage(ctx.Ctx, ctx.ReplyToMessageID)
+	if err != nil || msg == nil {
+		return 0
+	}
+	return msg.SenderID
+}
+
+// partial reports what was done before err stopped a multi-user action.
+func (c *Command) partial(ctx *core.CommandContext, verb string, done []string, err error) error {
+	if len(done) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s %s; dừng lại vì %w", verb, strings.Join(done, ", "), err)
+}
+
+func (c *Command) reply(ctx *core.CommandContext, format string, args ...any) error {
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, fmt.Sprintf(format, args...))
+}
+
+func (c *Command) userName(ctx *core.CommandContext, userID int64) string {
+	if user, err := ctx.Conversation.GetUser(ctx.Ctx, userID); err == nil && user != nil && user.Name != "" {
+		return user.Name
+	}
+	return strconv.FormatInt(userID, 10)
+}
+
+// parseUserIDs reads user IDs from args, which may be comma separated.
+func parseUserIDs(args []string) ([]int64, error) {
+	var ids []int64
+	for _, arg := range args {
+		for _, part := range strings.Split(arg, ",") {
+			if part == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(part, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("id không hợp lệ: %s", part)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
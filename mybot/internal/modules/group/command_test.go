@@ -0,0 +1,21 @@
+package group
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUserIDs(t *testing.T) {
+	got, err := parseUserIDs([]string{"100,200", "300"})
+	if err != nil || !reflect.DeepEqual(got, []int64{100, 200, 300}) {
+		t.Fatalf("parseUserIDs() = %v, %v", got, err)
+	}
+	if got, err := parseUserIDs(nil); err != nil || got != nil {
+		t.Fatalf("parseUserIDs(nil) = %v, %v", got, err)
+	}
+	for _, arg := range []string{"abc", "-5", "0"} {
+		if _, err := parseUserIDs([]string{arg}); err == nil {
+			t.Errorf("parseUserIDs(%q) error = nil, want error", arg)
+		}
+	}
+}
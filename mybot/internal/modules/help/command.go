@@ -8,6 +8,9 @@ import (
 	"mybot/internal/core"
 )
 
+// pageSize is the number of commands listed per help page.
+const pageSize = 15
+
 type Lister interface {
 	List() map[string]string
 }
@@ -39,12 +42,17 @@ func (c *Command) Execute(ctx *core.CommandContext) error {
 	}
 	sort.Strings(names)
 
-	var b strings.Builder
-	b.WriteString("📋 Danh sách lệnh:\n")
-	for _, name := range names {
-		desc := list[name]
-		b.WriteString(fmt.Sprintf("- %s: %s\n", name, desc))
+	var pages []string
+	for start := 0; start < len(names); start += pageSize {
+		end := min(start+pageSize, len(names))
+		var b strings.Builder
+		b.WriteString("📋 Danh sách lệnh:\n")
+		for _, name := range names[start:end] {
+			desc := list[name]
+			b.WriteString(fmt.Sprintf("- %s: %s\n", name, desc))
+		}
+		pages = append(pages, strings.TrimSuffix(b.String(), "\n"))
 	}
 
-	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, b.String())
+	return ctx.SendPages(pages)
 }
@@ -43,13 +43,13 @@ func (c *Command) Execute(ctx *core.CommandContext) error {
 	}
 
 	phaseStart := time.Now()
+	progress := ctx.StartProgress("🔎 Đang phân tích liên kết...")
 
 	// Phase 1: Resolve URL and get media items
 	c.log.Info().Str("url", url).Msg("[media] Phase 1: Resolving URL")
 	result, err := c.Service.GetMediaItems(ctx.Ctx, url)
 	if err != nil {
-		ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, fmt.Sprintf("Lỗi: %v", err))
-		return err
+		return progress.Fail(err)
 	}
 	c.log.Info().
 		Int("items", len(result.Items)).
@@ -57,12 +57,13 @@ func (c *Command) Execute(ctx *core.CommandContext) error {
 		Msg("[media] Phase 1 complete: URL resolved")
 
 	if len(result.Items) == 0 {
-		ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Không tìm thấy media")
+		progress.Done("Không tìm thấy media")
 		return nil
 	}
 
 	// Phase 2: Download all media to temp files
 	phaseStart = time.Now()
+	progress.Update(fmt.Sprintf("⬇️ Đang tải %d media...", len(result.Items)))
 	c.log.Info().Int("count", len(result.Items)).Msg("[media] Phase 2: Downloading media")
 	results := c.Service.DownloadBatch(ctx.Ctx, result.Items)
 
@@ -92,11 +93,14 @@ func (c *Command) Execute(ctx *core.CommandContext) error {
 		debug.FreeOSMemory()
 	}()
 
-	// Phase 3: Collect successful downloads.
+	// Phase 3: Collect successful downloads; failures are summarized in the
+	// final status instead of one message per item.
 	var attachments []core.MediaAttachment
+	var failed []string
 	for _, r := range results {
 		if r.Err != nil {
-			ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, fmt.Sprintf("Tải xuống #%d thất bại: %v", r.Index+1, r.Err))
+			c.log.Warn().Err(r.Err).Int("index", r.Index).Msg("[media] Download failed")
+			failed = append(failed, fmt.Sprintf("#%d", r.Index+1))
 			continue
 		}
 		file := r.File
@@ -110,11 +114,11 @@ func (c *Command) Execute(ctx *core.CommandContext) error {
 
 	if len(attachments) == 0 && result.Message != "" {
 		// Chỉ có nội dung, không có media
-		ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, result.Message)
+		progress.Done(result.Message)
 		return nil
 	}
 	if len(attachments) == 0 {
-		return fmt.Errorf("tất cả media đều thất bại")
+		return progress.Fail(fmt.Errorf("tất cả media đều thất bại"))
 	}
 
 	// Phase 5: Upload and send media
@@ -123,6 +127,7 @@ func (c *Command) Execute(ctx *core.CommandContext) error {
 	for _, a := range attachments {
 		uploadBytes += a.FileSize
 	}
+	progress.Update(fmt.Sprintf("⬆️ Đang gửi %d media...", len(attachments)))
 	c.log.Info().
 		Int("count", len(attachments)).
 		Int64("total_bytes", uploadBytes).
@@ -142,11 +147,16 @@ func (c *Command) Execute(ctx *core.CommandContext) error {
 			Err(sendErr).
 			Dur("duration", time.Since(phaseStart)).
 			Msg("[media] Phase 5 failed: Upload error")
-	} else {
-		c.log.Info().
-			Dur("duration", time.Since(phaseStart)).
-			Msg("[media] Phase 5 complete: Upload successful")
+		return progress.Fail(sendErr)
 	}
+	c.log.Info().
+		Dur("duration", time.Since(phaseStart)).
+		Msg("[media] Phase 5 complete: Upload successful")
 
-	return sendErr
+	status := fmt.Sprintf("✅ Đã gửi %d/%d media", len(attachments), len(results))
+	if len(failed) > 0 {
+		status += " (lỗi: " + strings.Join(failed, ", ") + ")"
+	}
+	progress.Done(status)
+	return nil
 }
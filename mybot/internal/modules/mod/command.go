@@ -0,0 +1,213 @@
+package mod
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"mybot/internal/core"
+)
+
+const usage = "cách dùng: !mod log [@người] | !mod muted\n" +
+	"!mod mute <@người|id> [thời gian: 30, 30m, 2h] | !mod pardon <@người|id>\n" +
+	"bot tự cảnh cáo, bỏ qua hoặc xoá người spam theo cấu hình moderation"
+
+const (
+	// logLimit is how many events "!mod log" shows.
+	logLimit = 20
+	// defaultMute is how long "!mod mute" ignores a user without a duration.
+	defaultMute = 10 * time.Minute
+)
+
+type Command struct{}
+
+func (c *Command) Name() string {
+	return "mod"
+}
+
+func (c *Command) Description() string {
+	return "Chống spam: xem nhật ký, bỏ qua hoặc tha cho thành viên"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	if ctx.Moderation == nil {
+		return errors.New("chống spam chưa được bật (moderation.enabled trong config)")
+	}
+	if err := ctx.RequireRole(core.RoleAdmin); err != nil {
+		return err
+	}
+	if len(ctx.Args) == 0 {
+		return errors.New(usage)
+	}
+	switch strings.ToLower(ctx.Args[0]) {
+	case "log", "logs", "nhậtký":
+		return c.log(ctx)
+	case "muted", "list", "ls":
+		return c.muted(ctx)
+	case "mute", "im":
+		return c.mute(ctx)
+	case "pardon", "unmute", "tha":
+		return c.pardon(ctx)
+	}
+	return fmt.Errorf("không có lệnh con %q\n%s", ctx.Args[0], usage)
+}
+
+func (c *Command) log(ctx *core.CommandContext) error {
+	var userID int64
+	if len(ctx.Args) > 1 {
+		var err error
+		if userID, err = c.target(ctx); err != nil {
+			return err
+		}
+	}
+	events, err := ctx.Moderation.ModerationEvents(ctx.Ctx, ctx.ThreadID, userID, logLimit)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Chưa có ghi nhận chống spam nào.")
+	}
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	var b strings.Builder
+	fmt.Fprintf(&b, "🛡️ %d ghi nhận gần nhất:", len(events))
+	for _, e := range events {
+		fmt.Fprintf(&b, "\n%s · %s · %s", formatTime(time.UnixMilli(e.CreatedAtUnixMs), loc), c.userName(ctx, e.UserID), describeAction(e.Action))
+		if e.Reason != core.ModerationManual {
+			fmt.Fprintf(&b, " (%s", e.Reason)
+			if e.Detail != "" {
+				fmt.Fprintf(&b, ": %s", e.Detail)
+			}
+			b.WriteString(")")
+		} else if e.ActorID != 0 {
+			fmt.Fprintf(&b, " bởi %s", c.userName(ctx, e.ActorID))
+		}
+	}
+	return ctx.SendPagedText(b.String())
+}
+
+func (c *Command) muted(ctx *core.CommandContext) error {
+	users, err := ctx.Moderation.MutedUsers(ctx.Ctx, ctx.ThreadID)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Không ai đang bị bỏ qua.")
+	}
+	ids := make([]int64, 0, len(users))
+	for id := range users {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b int64) int { return users[a].Compare(users[b]) })
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔇 %d người đang bị bỏ qua:", len(ids))
+	for _, id := range ids {
+		fmt.Fprintf(&b, "\n%s — đến %s", c.userName(ctx, id), formatTime(users[id], loc))
+	}
+	return ctx.SendPagedText(b.String())
+}
+
+func (c *Command) mute(ctx *core.CommandContext) error {
+	userID, err := c.target(ctx)
+	if err != nil {
+		return err
+	}
+	// The duration is the last word, unless that is the target's ID or
+	// part of their name.
+	d := defaultMute
+	if len(ctx.Args) > 2 || len(ctx.Mentions) > 0 {
+		if parsed, err := parseDuration(ctx.Args[len(ctx.Args)-1]); err == nil {
+			d = parsed
+		}
+	}
+	if err := ctx.Moderation.Mute(ctx.Ctx, ctx.ThreadID, userID, d); err != nil {
+		return err
+	}
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID,
+		fmt.Sprintf("🔇 Bot sẽ bỏ qua %s trong %s.", c.userName(ctx, userID), formatDuration(d)))
+}
+
+func (c *Command) pardon(ctx *core.CommandContext) error {
+	userID, err := c.target(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Moderation.Pardon(ctx.Ctx, ctx.ThreadID, userID); err != nil {
+		return err
+	}
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID,
+		fmt.Sprintf("🕊️ Đã tha cho %s, số lần vi phạm được tính lại từ đầu.", c.userName(ctx, userID)))
+}
+
+// target returns the mentioned user, or the user ID given as the second
+// argument.
+func (c *Command) target(ctx *core.CommandContext) (int64, error) {
+	if ids := ctx.MentionedUserIDs(); len(ids) > 0 {
+		return ids[0], nil
+	}
+	if len(ctx.Args) > 1 {
+		if id, err := strconv.ParseInt(ctx.Args[1], 10, 64); err == nil && id > 0 {
+			return id, nil
+		}
+		return 0, fmt.Errorf("id không hợp lệ: %s", ctx.Args[1])
+	}
+	return 0, fmt.Errorf("hãy @nhắc hoặc ghi id của người cần %s", ctx.Args[0])
+}
+
+func (c *Command) userName(ctx *core.CommandContext, userID int64) string {
+	if user, err := ctx.Conversation.GetUser(ctx.Ctx, userID); err == nil && user != nil && user.Name != "" {
+		return user.Name
+	}
+	return strconv.FormatInt(userID, 10)
+}
+
+func describeAction(a core.ModerationAction) string {
+	switch a {
+	case core.ModerationWarn:
+		return "⚠️ cảnh cáo"
+	case core.ModerationMute:
+		return "🔇 bỏ qua"
+	case core.ModerationRemove:
+		return "👋 xoá khỏi nhóm"
+	case core.ModerationPardon:
+		return "🕊️ tha"
+	}
+	return string(a)
+}
+
+// parseDuration reads a mute length: plain minutes ("30") or a number with
+// an m/h/d suffix ("30m", "2h", "1d").
+func parseDuration(arg string) (time.Duration, error) {
+	s := strings.ToLower(strings.TrimSpace(arg))
+	unit := time.Minute
+	switch {
+	case strings.HasSuffix(s, "m"), strings.HasSuffix(s, "p"):
+		s = s[:len(s)-1]
+	case strings.HasSuffix(s, "h"), strings.HasSuffix(s, "g"):
+		unit, s = time.Hour, s[:len(s)-1]
+	case strings.HasSuffix(s, "d"):
+		unit, s = 24*time.Hour, s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("thời gian không hợp lệ: %s", arg)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d ngày", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d giờ", d/time.Hour)
+	}
+	return fmt.Sprintf("%d phút", d/time.Minute)
+}
+
+func formatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("15:04 02/01/2006")
+}
@@ -0,0 +1,44 @@
+package mod
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"30", 30 * time.Minute},
+		{"30m", 30 * time.Minute},
+		{"15p", 15 * time.Minute},
+		{"2h", 2 * time.Hour},
+		{"3g", 3 * time.Hour},
+		{"1d", 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "0", "-5", "abc", "@Nam", "h"} {
+		if _, err := parseDuration(in); err == nil {
+			t.Errorf("parseDuration(%q) error = nil, want error", in)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		10 * time.Minute: "10 phút",
+		90 * time.Minute: "90 phút",
+		2 * time.Hour:    "2 giờ",
+		48 * time.Hour:   "2 ngày",
+	} {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
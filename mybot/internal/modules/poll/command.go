@@ -0,0 +1,240 @@
+package poll
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mybot/internal/core"
+)
+
+const usage = "cách dùng: !poll [thời hạn] \"câu hỏi\" lựa chọn1 lựa chọn2 ...\n" +
+	"lựa chọn nhiều từ đặt trong ngoặc kép; thời hạn: in 2h, 21:00, mai 8h (tự đóng và gửi kết quả)\n" +
+	"!poll results [id] | !poll list | !poll close <id>"
+
+// listLimit is how many polls "!poll list" shows.
+const listLimit = 10
+
+type Command struct{}
+
+func (c *Command) Name() string {
+	return "poll"
+}
+
+func (c *Command) Description() string {
+	return "Tạo bình chọn, xem kết quả trực tiếp và tự đóng theo hạn"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	if ctx.Polls == nil {
+		return errors.New("bình chọn chưa được bật")
+	}
+	if len(ctx.Args) == 0 {
+		return errors.New(usage)
+	}
+	switch strings.ToLower(ctx.Args[0]) {
+	case "results", "result", "show", "kq", "kếtquả":
+		return c.results(ctx)
+	case "list", "ls":
+		return c.list(ctx)
+	case "close", "end", "đóng":
+		return c.close(ctx)
+	}
+
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	req, err := parsePoll(ctx.TextAfter(1), time.Now(), loc) // "!poll"
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, usage)
+	}
+	req.ThreadID = ctx.ThreadID
+	poll, err := ctx.Polls.CreatePoll(ctx.Ctx, req)
+	if err != nil {
+		return err
+	}
+	reply := fmt.Sprintf("📊 Đã tạo bình chọn #%d. Xem kết quả: !poll results %d", poll.ID, poll.ID)
+	if poll.ClosesAtUnixMs > 0 {
+		reply += fmt.Sprintf("\n⏳ Tự đóng lúc %s (%s).", formatTime(time.UnixMilli(poll.ClosesAtUnixMs), loc), loc)
+	}
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, reply)
+}
+
+func (c *Command) results(ctx *core.CommandContext) error {
+	id, err := c.pollID(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := ctx.Polls.PollResults(ctx.Ctx, ctx.ThreadID, id)
+	if err != nil {
+		return err
+	}
+	text := core.FormatPollResults(res, ctx.Conversation.ThreadLocation(ctx.ThreadID))
+	return ctx.SendPagedText(text)
+}
+
+func (c *Command) list(ctx *core.CommandContext) error {
+	polls, err := ctx.Polls.ListPolls(ctx.Ctx, ctx.ThreadID, listLimit)
+	if err != nil {
+		return err
+	}
+	if len(polls) == 0 {
+		return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Chưa có bình chọn nào.")
+	}
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 %d bình chọn gần nhất:", len(polls))
+	for _, p := range polls {
+		question := p.Question
+		if question == "" {
+			question = "(không rõ câu hỏi)"
+		}
+		fmt.Fprintf(&b, "\n#%d %s — %s", p.ID, formatTime(time.UnixMilli(p.CreatedAtUnixMs), loc), truncate(question, 60))
+		if p.Status == core.PollClosed {
+			b.WriteString(" 🔒")
+		}
+	}
+	return ctx.SendPagedText(b.String())
+}
+
+func (c *Command) close(ctx *core.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return errors.New("cách dùng: !poll close <id>")
+	}
+	id, err := strconv.ParseInt(ctx.Args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("id không hợp lệ: %s", ctx.Args[1])
+	}
+	poll, err := ctx.Polls.GetPoll(ctx.Ctx, ctx.ThreadID, id)
+	if err != nil {
+		return err
+	}
+	if poll == nil {
+		return fmt.Errorf("không có bình chọn #%d trong nhóm này", id)
+	}
+	if poll.CreatorID != ctx.SenderID {
+		if err := ctx.RequireRole(core.RoleAdmin); err != nil {
+			return errors.New("chỉ người tạo hoặc quản trị viên nhóm mới đóng được bình chọn")
+		}
+	}
+	// ClosePoll posts the results to the thread itself.
+	_, err = ctx.Polls.ClosePoll(ctx.Ctx, ctx.ThreadID, id)
+	return err
+}
+
+// pollID reads the poll ID argument, defaulting to the newest poll.
+func (c *Command) pollID(ctx *core.CommandContext) (int64, error) {
+	if len(ctx.Args) >= 2 {
+		id, err := strconv.ParseInt(strings.TrimPrefix(ctx.Args[1], "#"), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("id không hợp lệ: %s", ctx.Args[1])
+		}
+		return id, nil
+	}
+	polls, err := ctx.Polls.ListPolls(ctx.Ctx, ctx.ThreadID, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(polls) == 0 {
+		return 0, errors.New("chưa có bình chọn nào")
+	}
+	return polls[0].ID, nil
+}
+
+// parsePoll reads `[deadline] "question" option option ...`. The question
+// must be quoted; options with spaces must be quoted too.
+func parsePoll(text string, now time.Time, loc *time.Location) (core.PollRequest, error) {
+	var req core.PollRequest
+	tokens, err := splitQuoted(text)
+	if err != nil {
+		return req, err
+	}
+	q := -1
+	for i, tok := range tokens {
+		if tok.quoted {
+			q = i
+			break
+		}
+	}
+	if q < 0 {
+		return req, errors.New("câu hỏi phải đặt trong ngoặc kép")
+	}
+	if q > 0 {
+		words := make([]string, q)
+		for i, tok := range tokens[:q] {
+			words[i] = tok.text
+		}
+		at, used, err := core.ParseWhen(words, now, loc)
+		if err != nil {
+			return req, err
+		}
+		if used != len(words) {
+			return req, fmt.Errorf("không hiểu thời hạn %q", strings.Join(words, " "))
+		}
+		req.ClosesAt = at
+	}
+	req.Question = strings.TrimSpace(tokens[q].text)
+	if req.Question == "" {
+		return req, errors.New("thiếu câu hỏi")
+	}
+	for _, tok := range tokens[q+1:] {
+		if option := strings.TrimSpace(tok.text); option != "" {
+			req.Options = append(req.Options, option)
+		}
+	}
+	if len(req.Options) < 2 {
+		return req, errors.New("cần ít nhất 2 lựa chọn")
+	}
+	return req, nil
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// splitQuoted splits text into words, keeping "quoted phrases" (straight or
+// curly quotes, as phone keyboards type them) together.
+func splitQuoted(text string) ([]token, error) {
+	var tokens []token
+	var cur strings.Builder
+	inQuote := false
+	flush := func(quoted bool) {
+		if cur.Len() > 0 || quoted {
+			tokens = append(tokens, token{text: cur.String(), quoted: quoted})
+		}
+		cur.Reset()
+	}
+	for _, r := range text {
+		switch {
+		case r == '"' || r == '“' || r == '”':
+			if inQuote {
+				flush(true)
+			} else {
+				flush(false)
+			}
+			inQuote = !inQuote
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			flush(false)
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, errors.New("thiếu dấu ngoặc kép đóng")
+	}
+	flush(false)
+	return tokens, nil
+}
+
+func formatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("15:04 02/01/2006")
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
@@ -0,0 +1,40 @@
+package poll
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePoll(t *testing.T) {
+	loc := time.UTC
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, loc)
+
+	req, err := parsePoll(`"Đi đâu chơi?" "Vũng Tàu" Đà_Lạt Huế`, now, loc)
+	if err != nil {
+		t.Fatalf("parsePoll() error = %v", err)
+	}
+	if req.Question != "Đi đâu chơi?" || !reflect.DeepEqual(req.Options, []string{"Vũng Tàu", "Đà_Lạt", "Huế"}) || !req.ClosesAt.IsZero() {
+		t.Fatalf("parsePoll() = %+v", req)
+	}
+
+	req, err = parsePoll(`in 2h “Ăn gì?” Phở “Bún chả”`, now, loc)
+	if err != nil {
+		t.Fatalf("parsePoll(deadline, curly quotes) error = %v", err)
+	}
+	if req.Question != "Ăn gì?" || !reflect.DeepEqual(req.Options, []string{"Phở", "Bún chả"}) || !req.ClosesAt.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("parsePoll(deadline) = %+v", req)
+	}
+
+	for _, input := range []string{
+		`Đi đâu? Biển Núi`,    // question not quoted
+		`"Đi đâu?" Biển`,      // one option
+		`"Đi đâu? Biển Núi`,   // unclosed quote
+		`hello "Đi đâu?" a b`, // not a deadline
+		`"" Biển Núi`,         // empty question
+	} {
+		if _, err := parsePoll(input, now, loc); err == nil {
+			t.Errorf("parsePoll(%q) error = nil, want error", input)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package remind
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mybot/internal/core"
+)
+
+const usage = "cách dùng: !remind [me|@người] [daily|weekly|weekdays|every 2h|mỗi ngày] <thời gian> <nội dung>\n" +
+	"!remind list | !remind delete <id> | !remind snooze <id> [10m|in 1h|21:00]\n" +
+	"thời gian: in 2h, 21:00, 9pm, tomorrow 8am, mai 8h, 25/12 9:00"
+
+// defaultSnooze is used by "!remind snooze <id>" without a time.
+const defaultSnooze = 10 * time.Minute
+
+type Command struct{}
+
+func (c *Command) Name() string {
+	return "remind"
+}
+
+func (c *Command) Description() string {
+	return "Đặt lời nhắc (có thể lặp lại) cho bạn hoặc người khác"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	if ctx.Reminders == nil {
+		return errors.New("lời nhắc chưa được bật")
+	}
+	if len(ctx.Args) == 0 {
+		return errors.New(usage)
+	}
+	switch strings.ToLower(ctx.Args[0]) {
+	case "list", "ls":
+		return c.list(ctx)
+	case "delete", "del", "rm", "xoa", "xoá", "xóa":
+		return c.delete(ctx)
+	case "snooze", "hoãn":
+		return c.snooze(ctx)
+	}
+
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	words := core.StripMentions(ctx.RawText, ctx.Mentions)
+	if len(words) > 0 {
+		words = words[1:] // "!remind"
+	}
+	req, err := parseReminder(words, ctx.SenderID, ctx.MentionedUserIDs(), time.Now(), loc)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, usage)
+	}
+	req.ThreadID = ctx.ThreadID
+
+	r, err := ctx.Reminders.AddReminder(ctx.Ctx, req)
+	if err != nil {
+		return err
+	}
+	reply := fmt.Sprintf("⏰ Đã đặt nhắc #%d cho %s lúc %s (%s)", r.ID, c.targetName(ctx, r.TargetID),
+		formatTime(time.UnixMilli(r.NextAtUnixMs), loc), loc)
+	if r.Recurrence != "" {
+		reply += ", lặp " + core.DescribeRecurrence(r.Recurrence)
+	}
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, reply+".")
+}
+
+// parseReminder reads "[me] [rule] [time] text" from the words of the command
+// message, with the mentions already stripped. The first mentioned user is
+// the target; otherwise the sender is. A recurring reminder without a time
+// first fires one period from now; a time that can't be read is an error.
+func parseReminder(words []string, senderID int64, mentioned []int64, now time.Time, loc *time.Location) (core.ReminderRequest, error) {
+	req := core.ReminderRequest{TargetID: senderID}
+	if len(mentioned) > 0 {
+		req.TargetID = mentioned[0]
+	}
+	if len(words) > 0 {
+		switch strings.ToLower(words[0]) {
+		case "me", "tôi", "tao", "mình":
+			words = words[1:]
+			req.TargetID = senderID
+		}
+	}
+
+	rule, used, _, err := core.ParseRecurrence(words)
+	if err != nil {
+		return req, err
+	}
+	req.Recurrence = rule
+	words = words[used:]
+
+	at, used, err := core.ParseWhen(words, now, loc)
+	if errors.Is(err, core.ErrNoTime) && rule != "" {
+		at, _ = core.NextOccurrence(rule, now, now, loc)
+		used, err = 0, nil
+	}
+	if err != nil {
+		return req, err
+	}
+	req.At = at
+	req.Text = strings.Join(words[used:], " ")
+	if req.Text == "" {
+		return req, errors.New("thiếu nội dung lời nhắc")
+	}
+	return req, nil
+}
+
+func (c *Command) list(ctx *core.CommandContext) error {
+	active, err := ctx.Reminders.ListReminders(ctx.Ctx, ctx.ThreadID)
+	if err != nil {
+		return err
+	}
+	if len(active) == 0 {
+		return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Không có lời nhắc nào.")
+	}
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	var b strings.Builder
+	fmt.Fprintf(&b, "⏰ %d lời nhắc (%s):", len(active), loc)
+	for _, r := range active {
+		fmt.Fprintf(&b, "\n#%d %s", r.ID, formatTime(time.UnixMilli(r.NextAtUnixMs), loc))
+		if r.Recurrence != "" {
+			fmt.Fprintf(&b, " 🔁 %s", core.DescribeRecurrence(r.Recurrence))
+		}
+		fmt.Fprintf(&b, " → %s — %s", c.targetName(ctx, r.TargetID), truncate(r.Text, 60))
+	}
+	return ctx.SendPagedText(b.String())
+}
+
+func (c *Command) delete(ctx *core.CommandContext) error {
+	r, err := c.owned(ctx, "cách dùng: !remind delete <id>")
+	if err != nil {
+		return err
+	}
+	if err := ctx.Reminders.DeleteReminder(ctx.Ctx, ctx.ThreadID, r.ID); err != nil {
+		return err
+	}
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, fmt.Sprintf("🗑️ Đã xoá lời nhắc #%d.", r.ID))
+}
+
+func (c *Command) snooze(ctx *core.CommandContext) error {
+	r, err := c.owned(ctx, "cách dùng: !remind snooze <id> [10m|in 1h|21:00]")
+	if err != nil {
+		return err
+	}
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	now := time.Now()
+	until := now.Add(defaultSnooze)
+	if when := ctx.Args[2:]; len(when) > 0 {
+		until, _, err = core.ParseWhen(when, now, loc)
+		if err != nil {
+			// Bare durations: "!remind snooze 3 15m".
+			until, _, err = core.ParseWhen(append([]string{"in"}, when...), now, loc)
+		}
+		if err != nil {
+			return fmt.Errorf("không hiểu thời gian %q", strings.Join(when, " "))
+		}
+	}
+	if _, err := ctx.Reminders.SnoozeReminder(ctx.Ctx, ctx.ThreadID, r.ID, until); err != nil {
+		return err
+	}
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID,
+		fmt.Sprintf("😴 Đã hoãn lời nhắc #%d đến %s.", r.ID, formatTime(until, loc)))
+}
+
+// owned returns the reminder whose ID is Args[1], if the sender created it
+// or is its target.
+func (c *Command) owned(ctx *core.CommandContext, cmdUsage string) (*core.Reminder, error) {
+	if len(ctx.Args) < 2 {
+		return nil, errors.New(cmdUsage)
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(ctx.Args[1], "#"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("id không hợp lệ: %s", ctx.Args[1])
+	}
+	r, err := ctx.Reminders.GetReminder(ctx.Ctx, ctx.ThreadID, id)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, fmt.Errorf("không có lời nhắc #%d trong nhóm này", id)
+	}
+	if r.CreatorID != 0 && r.CreatorID != ctx.SenderID && r.TargetID != ctx.SenderID {
+		return nil, errors.New("chỉ người đặt hoặc người được nhắc mới thay đổi được lời nhắc này")
+	}
+	return r, nil
+}
+
+func (c *Command) targetName(ctx *core.CommandContext, userID int64) string {
+	if userID == ctx.SenderID {
+		return "bạn"
+	}
+	if user, err := ctx.Conversation.GetUser(ctx.Ctx, userID); err == nil && user != nil && user.Name != "" {
+		return user.Name
+	}
+	return strconv.FormatInt(userID, 10)
+}
+
+func formatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("15:04 02/01/2006")
+}
+
+func truncate(s string, n int) string {
+	r := []rune(strings.ReplaceAll(s, "\n", " "))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n]) + "…"
+}
@@ -0,0 +1,62 @@
+package remind
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mybot/internal/core"
+)
+
+func TestParseReminder(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, loc)
+
+	tests := []struct {
+		name      string
+		words     []string
+		mentioned []int64
+		want      core.ReminderRequest
+	}{
+		{
+			name:  "self one-shot",
+			words: []string{"me", "in", "2h", "gọi", "mẹ"},
+			want:  core.ReminderRequest{TargetID: 7, Text: "gọi mẹ", At: now.Add(2 * time.Hour)},
+		},
+		{
+			name:      "mention daily",
+			words:     []string{"daily", "8am", "uống", "thuốc"},
+			mentioned: []int64{9},
+			want: core.ReminderRequest{TargetID: 9, Text: "uống thuốc", Recurrence: core.RecurDaily,
+				At: time.Date(2026, 10, 17, 8, 0, 0, 0, loc)},
+		},
+		{
+			name:  "daily at a time",
+			words: []string{"mỗi", "ngày", "lúc", "8h", "uống", "thuốc"},
+			want: core.ReminderRequest{TargetID: 7, Text: "uống thuốc", Recurrence: core.RecurDaily,
+				At: time.Date(2026, 10, 17, 8, 0, 0, 0, loc)},
+		},
+		{
+			name:  "interval without time",
+			words: []string{"mỗi", "45", "phút", "đứng", "dậy"},
+			want:  core.ReminderRequest{TargetID: 7, Text: "đứng dậy", Recurrence: "every 45m0s", At: now.Add(45 * time.Minute)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseReminder(tt.words, 7, tt.mentioned, now, loc)
+			if err != nil {
+				t.Fatalf("parseReminder() error = %v", err)
+			}
+			if got.TargetID != tt.want.TargetID || got.Text != tt.want.Text || got.Recurrence != tt.want.Recurrence || !got.At.Equal(tt.want.At) {
+				t.Fatalf("parseReminder() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	for _, words := range [][]string{{"in", "2h"}, {"uống", "thuốc"}, {"every", "1m", "x"}, strings.Fields("mỗi ngày lúc 25:99 uống thuốc"), strings.Fields("daily 8:75 uống thuốc")} {
+		if _, err := parseReminder(words, 7, nil, now, loc); err == nil {
+			t.Errorf("parseReminder(%q) error = nil, want error", words)
+		}
+	}
+}
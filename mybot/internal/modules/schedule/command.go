@@ -0,0 +1,118 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mybot/internal/core"
+)
+
+const usage = "cách dùng: !schedule <thời gian> <nội dung> | !schedule list | !schedule cancel <id>\n" +
+	"thời gian: in 2h, 21:00, 9pm, tomorrow 8am, mai 8h, 25/12 9:00"
+
+type Command struct{}
+
+func (c *Command) Name() string {
+	return "schedule"
+}
+
+func (c *Command) Description() string {
+	return "Hẹn giờ gửi tin nhắn vào nhóm"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	if len(ctx.Args) == 0 {
+		return errors.New(usage)
+	}
+	switch strings.ToLower(ctx.Args[0]) {
+	case "list", "ls":
+		return c.list(ctx)
+	case "cancel", "huy", "huỷ", "hủy":
+		return c.cancel(ctx)
+	}
+
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	at, used, err := core.ParseWhen(ctx.Args, time.Now(), loc)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, usage)
+	}
+	text := strings.Join(ctx.Args[used:], " ")
+	if text == "" {
+		return errors.New("thiếu nội dung tin nhắn\n" + usage)
+	}
+
+	msg, err := ctx.Messages.ScheduleText(ctx.Ctx, core.SendTextRequest{ThreadID: ctx.ThreadID, Text: text}, at)
+	if err != nil {
+		return err
+	}
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID,
+		fmt.Sprintf("🕒 Đã hẹn #%d lúc %s (%s).", msg.ID, FormatTime(at, loc), loc))
+}
+
+func (c *Command) list(ctx *core.CommandContext) error {
+	pending, err := ctx.Messages.ListScheduled(ctx.Ctx, ctx.ThreadID)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "Không có tin nhắn nào đang hẹn giờ.")
+	}
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	var b strings.Builder
+	fmt.Fprintf(&b, "🕒 %d tin nhắn đang hẹn giờ (%s):", len(pending), loc)
+	for _, m := range pending {
+		text := m.Text
+		if m.Kind == "media" {
+			text = "[media] " + text
+		}
+		fmt.Fprintf(&b, "\n#%d %s — %s", m.ID, FormatTime(time.UnixMilli(m.SendAtUnixMs), loc), truncate(text, 60))
+	}
+	return ctx.SendPagedText(b.String())
+}
+
+func (c *Command) cancel(ctx *core.CommandContext) error {
+	if len(ctx.Args) < 2 {
+		return errors.New("cách dùng: !schedule cancel <id>")
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(ctx.Args[1], "#"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("id không hợp lệ: %s", ctx.Args[1])
+	}
+
+	pending, err := ctx.Messages.ListScheduled(ctx.Ctx, ctx.ThreadID)
+	if err != nil {
+		return err
+	}
+	var target *core.ScheduledMessage
+	for _, m := range pending {
+		if m.ID == id {
+			target = m
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("không có tin hẹn giờ #%d trong nhóm này", id)
+	}
+	if target.CreatorID != 0 && target.CreatorID != ctx.SenderID {
+		return errors.New("chỉ người hẹn mới huỷ được tin này")
+	}
+	if err := ctx.Messages.CancelScheduled(ctx.Ctx, ctx.ThreadID, id); err != nil {
+		return err
+	}
+	return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, fmt.Sprintf("🗑️ Đã huỷ tin hẹn giờ #%d.", id))
+}
+
+// FormatTime renders t in loc the way schedule replies show it.
+func FormatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("15:04 02/01/2006")
+}
+
+func truncate(s string, n int) string {
+	r := []rune(strings.ReplaceAll(s, "\n", " "))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n]) + "…"
+}
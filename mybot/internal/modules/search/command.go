@@ -0,0 +1,240 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mybot/internal/core"
+)
+
+const usage = "cách dùng: !search <từ khoá> [từ:@người|id|tôi] [sau:7d|01/10/2026] [trước:20/10/2026] [has:media]\n" +
+	"!search #<số> — bot trả lời vào tin nhắn tìm được, bấm vào để nhảy tới\n" +
+	"không phân biệt dấu: \"pho\" tìm được \"phở\""
+
+const (
+	// resultLimit is how many results one search shows.
+	resultLimit = 15
+	// snippetLength is how many characters of each result are shown.
+	snippetLength = 80
+	// resultsTTL is how long "!search #<số>" can refer to a search.
+	resultsTTL = 30 * time.Minute
+)
+
+// Command keeps the last results of each user in each thread, so they can
+// jump to one by its number.
+type Command struct {
+	mu   sync.Mutex
+	last map[resultsKey]results
+}
+
+type resultsKey struct{ threadID, userID int64 }
+
+type results struct {
+	messageIDs []string
+	expires    time.Time
+}
+
+func (c *Command) Name() string {
+	return "search"
+}
+
+func (c *Command) Description() string {
+	return "Tìm tin nhắn cũ trong nhóm theo từ khoá"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	if len(ctx.Args) == 0 {
+		return errors.New(usage)
+	}
+	if n, ok := parseJump(ctx.Args); ok {
+		return c.jump(ctx, n)
+	}
+
+	words := core.StripMentions(ctx.RawText, ctx.Mentions)
+	command := ""
+	if len(words) > 0 {
+		command, words = words[0], words[1:]
+	}
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	query, filters, err := parseQuery(ctx, words, time.Now().In(loc))
+	if err != nil {
+		return err
+	}
+	// Over-fetch: earlier searches match their own query and are dropped.
+	filters.Limit = resultLimit * 2
+	found, err := ctx.Conversation.SearchMessages(ctx.Ctx, ctx.ThreadID, query, filters)
+	if err != nil {
+		return err
+	}
+	var shown []*core.MessageRecord
+	for _, m := range found {
+		if m.MessageID == ctx.IncomingMessageID || isCommand(m.Text, command) {
+			continue
+		}
+		if shown = append(shown, m); len(shown) == resultLimit {
+			break
+		}
+	}
+	if len(shown) == 0 {
+		return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, fmt.Sprintf("🔎 Không tìm thấy tin nhắn nào chứa \"%s\".", query))
+	}
+
+	ids := make([]string, len(shown))
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔎 %d kết quả cho \"%s\" (mới nhất trước):", len(shown), query)
+	for i, m := range shown {
+		ids[i] = m.MessageID
+		fmt.Fprintf(&b, "\n#%d · %s · %s: %s", i+1, formatTime(time.UnixMilli(m.TimestampMs), loc), c.senderName(ctx, m), snippet(m))
+	}
+	fmt.Fprintf(&b, "\n\nGửi %s #<số> để bot trả lời vào tin đó.", command)
+	c.remember(resultsKey{ctx.ThreadID, ctx.SenderID}, ids)
+	return ctx.SendPagedText(b.String())
+}
+
+// jump replies to the nth result of the sender's last search; tapping the
+// quote in Messenger scrolls to the original message.
+func (c *Command) jump(ctx *core.CommandContext, n int) error {
+	c.mu.Lock()
+	r, ok := c.last[resultsKey{ctx.ThreadID, ctx.SenderID}]
+	c.mu.Unlock()
+	if !ok || time.Now().After(r.expires) {
+		return errors.New("chưa có kết quả tìm kiếm nào, hãy tìm lại")
+	}
+	if n < 1 || n > len(r.messageIDs) {
+		return fmt.Errorf("chỉ có kết quả từ #1 đến #%d", len(r.messageIDs))
+	}
+	_, err := ctx.Messages.ReplyText(ctx.Ctx, ctx.ThreadID, r.messageIDs[n-1], fmt.Sprintf("⬆️ Kết quả #%d", n))
+	return err
+}
+
+func (c *Command) remember(key resultsKey, ids []string) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last == nil {
+		c.last = make(map[resultsKey]results)
+	}
+	for k, r := range c.last {
+		if now.After(r.expires) {
+			delete(c.last, k)
+		}
+	}
+	c.last[key] = results{messageIDs: ids, expires: now.Add(resultsTTL)}
+}
+
+func (c *Command) senderName(ctx *core.CommandContext, m *core.MessageRecord) string {
+	if m.SenderNameSnapshot != "" {
+		return m.SenderNameSnapshot
+	}
+	if user, err := ctx.Conversation.GetUser(ctx.Ctx, m.SenderID); err == nil && user != nil && user.Name != "" {
+		return user.Name
+	}
+	return strconv.FormatInt(m.SenderID, 10)
+}
+
+// parseJump recognises "#3" and "go 3".
+func parseJump(args []string) (int, bool) {
+	arg := args[0]
+	if len(args) == 2 && (strings.EqualFold(arg, "go") || strings.EqualFold(arg, "tới")) {
+		arg = "#" + args[1]
+	} else if len(args) != 1 {
+		return 0, false
+	}
+	if !strings.HasPrefix(arg, "#") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(arg[1:])
+	return n, err == nil
+}
+
+// parseQuery splits the filter words ("từ:", "sau:", "trước:", "has:media")
+// from the search words.
+func parseQuery(ctx *core.CommandContext, words []string, now time.Time) (string, core.SearchFilters, error) {
+	var (
+		f     core.SearchFilters
+		terms []string
+	)
+	for _, w := range words {
+		key, value, ok := strings.Cut(w, ":")
+		if !ok {
+			terms = append(terms, w)
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "from", "từ", "tu":
+			id, err := parseSender(ctx, value)
+			if err != nil {
+				return "", f, err
+			}
+			f.SenderID = id
+		case "since", "sau":
+			t, err := core.ParseDateFilter(value, now, now.Location(), false)
+			if err != nil {
+				return "", f, err
+			}
+			f.Since = t
+		case "until", "trước", "truoc":
+			t, err := core.ParseDateFilter(value, now, now.Location(), true)
+			if err != nil {
+				return "", f, err
+			}
+			f.Until = t
+		case "has", "có", "co":
+			if !strings.EqualFold(value, "media") {
+				return "", f, fmt.Errorf("bộ lọc không hợp lệ: %s (dùng has:media)", w)
+			}
+			f.HasMedia = true
+		default:
+			terms = append(terms, w)
+		}
+	}
+	if len(terms) == 0 {
+		return "", f, errors.New("hãy nhập từ khoá cần tìm\n" + usage)
+	}
+	return strings.Join(terms, " "), f, nil
+}
+
+// parseSender reads the value of "từ:": empty when the user is @mentioned
+// (the mention is cut out of the words), "tôi"/"me", or a user ID.
+func parseSender(ctx *core.CommandContext, value string) (int64, error) {
+	switch strings.ToLower(value) {
+	case "":
+		if ids := ctx.MentionedUserIDs(); len(ids) > 0 {
+			return ids[0], nil
+		}
+		return 0, errors.New("hãy @nhắc hoặc ghi id sau từ:")
+	case "me", "tôi", "toi":
+		return ctx.SenderID, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("id không hợp lệ: %s", value)
+	}
+	return id, nil
+}
+
+// isCommand reports whether text is a use of command, such as an earlier
+// search for the same words.
+func isCommand(text, command string) bool {
+	first, _, _ := strings.Cut(strings.TrimSpace(text), " ")
+	return command != "" && strings.EqualFold(first, command)
+}
+
+func snippet(m *core.MessageRecord) string {
+	text := strings.Join(strings.Fields(m.Text), " ")
+	if r := []rune(text); len(r) > snippetLength {
+		text = string(r[:snippetLength]) + "…"
+	}
+	if m.HasMedia {
+		text = "📎 " + text
+	}
+	return text
+}
+
+func formatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("15:04 02/01/2006")
+}
@@ -0,0 +1,71 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"mybot/internal/core"
+)
+
+func TestParseQuery(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, loc)
+	ctx := &core.CommandContext{SenderID: 5, Mentions: []core.Mention{{UserID: 7}}}
+
+	query, f, err := parseQuery(ctx, []string{"ăn", "phở", "từ:", "sau:7d", "trước:20/10", "has:media"}, now)
+	if err != nil {
+		t.Fatalf("parseQuery() error = %v", err)
+	}
+	want := core.SearchFilters{
+		SenderID: 7,
+		Since:    now.AddDate(0, 0, -7),
+		Until:    time.Date(2026, 10, 21, 0, 0, 0, 0, loc),
+		HasMedia: true,
+	}
+	if query != "ăn phở" || f != want {
+		t.Fatalf("parseQuery() = %q, %+v; want %q, %+v", query, f, "ăn phở", want)
+	}
+
+	query, f, err = parseQuery(ctx, []string{"tu:toi", "http://x.vn", "sau:2026-10-01"}, now)
+	if err != nil || query != "http://x.vn" || f.SenderID != 5 || !f.Since.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, loc)) {
+		t.Fatalf("parseQuery() = %q, %+v, %v", query, f, err)
+	}
+
+	for _, words := range [][]string{
+		{"từ:"}, // filters only
+		{"pho", "sau:hôm-qua"},
+		{"pho", "has:link"},
+		{"pho", "từ:Nam"},
+	} {
+		if _, _, err := parseQuery(&core.CommandContext{}, words, now); err == nil {
+			t.Errorf("parseQuery(%q) error = nil", words)
+		}
+	}
+}
+
+func TestParseJump(t *testing.T) {
+	tests := []struct {
+		args   []string
+		want   int
+		wantOK bool
+	}{
+		{[]string{"#3"}, 3, true},
+		{[]string{"go", "12"}, 12, true},
+		{[]string{"tới", "2"}, 2, true},
+		{[]string{"#abc"}, 0, false},
+		{[]string{"phở"}, 0, false},
+		{[]string{"#3", "phở"}, 0, false},
+	}
+	for _, tt := range tests {
+		n, ok := parseJump(tt.args)
+		if n != tt.want || ok != tt.wantOK {
+			t.Errorf("parseJump(%q) = %d, %v; want %d, %v", tt.args, n, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestIsCommand(t *testing.T) {
+	if !isCommand("!SEARCH phở", "!search") || isCommand("tìm phở", "!search") || isCommand("!search", "") {
+		t.Fatal("isCommand() mismatch")
+	}
+}
@@ -0,0 +1,200 @@
+package stats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mybot/internal/core"
+)
+
+const usage = "cách dùng: !stats [@người|id|tôi] [tuần|tháng|hôm-nay|tất-cả]\n" +
+	"mặc định: cả nhóm, từ khi bot bắt đầu lưu tin"
+
+// topSenders is how many people the group summary ranks.
+const topSenders = 5
+
+// sparkLevels draw the messages per hour of the day.
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+type Command struct{}
+
+func (c *Command) Name() string {
+	return "stats"
+}
+
+func (c *Command) Description() string {
+	return "Thống kê nhóm: ai nhắn nhiều nhất, giờ cao điểm, từ hay dùng"
+}
+
+func (c *Command) Execute(ctx *core.CommandContext) error {
+	loc := ctx.Conversation.ThreadLocation(ctx.ThreadID)
+	words := core.StripMentions(ctx.RawText, ctx.Mentions)
+	if len(words) > 0 {
+		words = words[1:] // "!stats"
+	}
+	q, period, err := parseArgs(ctx, words, time.Now().In(loc))
+	if err != nil {
+		return err
+	}
+	q.Top = topSenders
+	st, err := ctx.Conversation.ThreadStats(ctx.Ctx, ctx.ThreadID, q)
+	if err != nil {
+		return err
+	}
+	if st.Messages == 0 {
+		return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, "📊 Chưa có tin nhắn nào được thống kê trong khoảng này.")
+	}
+	if q.UserID != 0 {
+		return ctx.SendPagedText(c.userSummary(ctx, st, q.UserID, period))
+	}
+	return ctx.SendPagedText(c.threadSummary(ctx, st, q, period, time.Now().In(loc)))
+}
+
+func (c *Command) threadSummary(ctx *core.CommandContext, st *core.ThreadStats, q core.StatsQuery, period string, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 Thống kê nhóm · %s\n", period)
+	fmt.Fprintf(&b, "💬 %d tin · 👥 %d người · 🖼 %d tin có tệp · 🔗 %d link", st.Messages, st.ActiveMembers, st.MediaMessages, st.Links)
+
+	b.WriteString("\n\n🏆 Nhắn nhiều nhất:")
+	for i, s := range st.TopSenders {
+		fmt.Fprintf(&b, "\n%d. %s — %d tin (%s)", i+1, c.userName(ctx, s.UserID), s.Messages, percent(s.Messages, st.Messages))
+	}
+
+	if busiest, ok := busiestDay(st.Days); ok {
+		first := q.Since
+		if first.IsZero() {
+			first = st.Days[0].Day
+		}
+		days := max(int64(now.Sub(first).Hours()/24)+1, 1)
+		fmt.Fprintf(&b, "\n\n📅 Ngày sôi nổi nhất: %s (%d tin) · trung bình %d tin/ngày",
+			busiest.Day.Format("02/01/2006"), busiest.Messages, st.Messages/days)
+	}
+	hour := busiestHour(st.Hours)
+	fmt.Fprintf(&b, "\n🕒 Giờ cao điểm: %dh–%dh (%s)\n0h %s 23h", hour, (hour+1)%24, percent(st.Hours[hour], st.Messages), sparkline(st.Hours))
+	if st.Responses > 0 {
+		fmt.Fprintf(&b, "\n⏱ Trả lời nhau trung bình sau %s (%d lần)", formatDuration(st.AvgResponse), st.Responses)
+	}
+	writeTerms(&b, "\n🔤 Từ hay dùng: ", st.TopWords)
+	writeTerms(&b, "\n🌐 Trang hay gửi: ", st.TopDomains)
+	return b.String()
+}
+
+func (c *Command) userSummary(ctx *core.CommandContext, st *core.ThreadStats, userID int64, period string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 Thống kê của %s · %s\n", c.userName(ctx, userID), period)
+	fmt.Fprintf(&b, "💬 %d tin (%s của nhóm) · hạng %d/%d", st.Messages, percent(st.Messages, st.ThreadMessages), st.Rank, st.ActiveMembers)
+	fmt.Fprintf(&b, "\n🖼 %d tin có tệp · 🔗 %d link", st.MediaMessages, st.Links)
+	hour := busiestHour(st.Hours)
+	fmt.Fprintf(&b, "\n🕒 Hay nhắn lúc %dh–%dh\n0h %s 23h", hour, (hour+1)%24, sparkline(st.Hours))
+	if st.Responses > 0 {
+		fmt.Fprintf(&b, "\n⏱ Trả lời trung bình sau %s (%d lần)", formatDuration(st.AvgResponse), st.Responses)
+	}
+	writeTerms(&b, "\n🔤 Từ hay dùng: ", st.TopWords)
+	writeTerms(&b, "\n🌐 Trang hay gửi: ", st.TopDomains)
+	return b.String()
+}
+
+func (c *Command) userName(ctx *core.CommandContext, userID int64) string {
+	if user, err := ctx.Conversation.GetUser(ctx.Ctx, userID); err == nil && user != nil && user.Name != "" {
+		return user.Name
+	}
+	return strconv.FormatInt(userID, 10)
+}
+
+// parseArgs reads the optional user ("@Nam", "tôi", an ID) and period
+// ("tuần", "tháng", "hôm-nay", "tất-cả") and returns the period's label.
+func parseArgs(ctx *core.CommandContext, words []string, now time.Time) (core.StatsQuery, string, error) {
+	var q core.StatsQuery
+	if ids := ctx.MentionedUserIDs(); len(ids) > 0 {
+		q.UserID = ids[0]
+	}
+	period := "từ trước tới nay"
+	for _, w := range words {
+		switch strings.ToLower(w) {
+		case "week", "tuần", "tuan", "7d":
+			q.Since, period = now.AddDate(0, 0, -7), "7 ngày qua"
+		case "month", "tháng", "thang", "30d":
+			q.Since, period = now.AddDate(0, 0, -30), "30 ngày qua"
+		case "today", "hôm-nay", "homnay":
+			q.Since, period = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), "hôm nay"
+		case "all", "tất-cả", "tatca":
+			q.Since, period = time.Time{}, "từ trước tới nay"
+		case "me", "tôi", "toi":
+			q.UserID = ctx.SenderID
+		default:
+			id, err := strconv.ParseInt(w, 10, 64)
+			if err != nil || id <= 0 {
+				return q, "", fmt.Errorf("không hiểu %q\n%s", w, usage)
+			}
+			q.UserID = id
+		}
+	}
+	return q, period, nil
+}
+
+func busiestDay(days []core.DayActivity) (core.DayActivity, bool) {
+	var best core.DayActivity
+	for _, d := range days {
+		if d.Messages > best.Messages {
+			best = d
+		}
+	}
+	return best, best.Messages > 0
+}
+
+func busiestHour(hours [24]int64) int {
+	best := 0
+	for h, n := range hours {
+		if n > hours[best] {
+			best = h
+		}
+	}
+	return best
+}
+
+// sparkline draws one bar per hour, scaled to the busiest.
+func sparkline(hours [24]int64) string {
+	peak := hours[busiestHour(hours)]
+	bars := make([]rune, len(hours))
+	for h, n := range hours {
+		level := 0
+		if peak > 0 {
+			level = int(n * int64(len(sparkLevels)-1) / peak)
+		}
+		bars[h] = sparkLevels[level]
+	}
+	return string(bars)
+}
+
+func writeTerms(b *strings.Builder, title string, terms []core.TermCount) {
+	if len(terms) == 0 {
+		return
+	}
+	b.WriteString(title)
+	for i, t := range terms {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(b, "%s (%d)", t.Term, t.Count)
+	}
+}
+
+func percent(n, total int64) string {
+	if total <= 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%d%%", (n*100+total/2)/total)
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%d giây", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%d phút", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%d giờ %d phút", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
@@ -0,0 +1,50 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"mybot/internal/core"
+)
+
+func TestParseArgs(t *testing.T) {
+	loc := time.FixedZone("ICT", 7*3600)
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, loc)
+
+	q, period, err := parseArgs(&core.CommandContext{}, nil, now)
+	if err != nil || q != (core.StatsQuery{}) || period != "từ trước tới nay" {
+		t.Fatalf("parseArgs() = %+v, %q, %v; want the whole group, all time", q, period, err)
+	}
+
+	ctx := &core.CommandContext{SenderID: 5, Mentions: []core.Mention{{UserID: 7}}}
+	q, period, err = parseArgs(ctx, []string{"tuần"}, now)
+	if err != nil || q.UserID != 7 || !q.Since.Equal(now.AddDate(0, 0, -7)) || period != "7 ngày qua" {
+		t.Fatalf("parseArgs(@, tuần) = %+v, %q, %v", q, period, err)
+	}
+	q, _, err = parseArgs(&core.CommandContext{SenderID: 5}, []string{"tôi", "hôm-nay"}, now)
+	if err != nil || q.UserID != 5 || !q.Since.Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, loc)) {
+		t.Fatalf("parseArgs(tôi, hôm-nay) = %+v, %v", q, err)
+	}
+	q, _, err = parseArgs(&core.CommandContext{}, []string{"100001111", "month"}, now)
+	if err != nil || q.UserID != 100001111 || !q.Since.Equal(now.AddDate(0, 0, -30)) {
+		t.Fatalf("parseArgs(id, month) = %+v, %v", q, err)
+	}
+	if _, _, err := parseArgs(&core.CommandContext{}, []string{"năm"}, now); err == nil {
+		t.Error("parseArgs(năm) error = nil")
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	var hours [24]int64
+	hours[9], hours[21] = 4, 8
+	got := []rune(sparkline(hours))
+	if len(got) != 24 || got[0] != '▁' || got[9] != '▄' || got[21] != '█' || busiestHour(hours) != 21 {
+		t.Fatalf("sparkline() = %s", string(got))
+	}
+	if got := percent(1, 3); got != "33%" {
+		t.Errorf("percent(1, 3) = %s", got)
+	}
+	if got := formatDuration(95 * time.Minute); got != "1 giờ 35 phút" {
+		t.Errorf("formatDuration() = %s", got)
+	}
+}
@@ -44,6 +44,7 @@ func (s *ScriptCommand) Execute(ctx *core.CommandContext) error {
 		"message_id": ctx.IncomingMessageID,
 		"args":       ctx.Args,
 		"raw_text":   ctx.RawText,
+		"mentions":   ctx.MentionedUserIDs(),
 		"start_time": ctx.StartTime.Format(time.RFC3339),
 		"uptime_sec": int64(time.Since(ctx.StartTime).Seconds()),
 	}
@@ -55,7 +56,7 @@ func (s *ScriptCommand) Execute(ctx *core.CommandContext) error {
 	if len(results) > 0 {
 		text := results[0].String()
 		if text != "" {
-			return ctx.Sender.SendMessage(ctx.Ctx, ctx.ThreadID, text)
+			return ctx.SendPagedText(text)
 		}
 	}
 	return nil
@@ -88,7 +88,11 @@ func (c *Client) GetSelfID() int64 {
 
 func (c *Client) SendText(ctx context.Context, req core.SendTextRequest) (*core.MessageRecord, error) {
 	// Generate OTID once so retries reuse the same ID (Facebook deduplicates by OTID).
-	otid := methods.GenerateEpochID()
+	// Queued sends pass their own so redelivery after a reconnect dedupes too.
+	otid := req.OTID
+	if otid == 0 {
+		otid = methods.GenerateEpochID()
+	}
 
 	var lastErr error
 	for i := 0; i < maxRetries; i++ {
@@ -108,6 +112,9 @@ func (c *Client) SendText(ctx context.Context, req core.SendTextRequest) (*core.
 			SyncGroup: 1,
 			Otid:      otid,
 		}
+		if len(req.Mentions) > 0 {
+			task.MentionData = messaging.MentionData(req.Mentions)
+		}
 		if req.ReplyTo != nil && req.ReplyTo.MessageID != "" {
 			task.ReplyMetaData = &socket.ReplyMetaData{
 				ReplyMessageId:  req.ReplyTo.MessageID,
@@ -132,6 +139,7 @@ func (c *Client) SendText(ctx context.Context, req core.SendTextRequest) (*core.
 			}
 		}
 		rec.Text = req.Text
+		rec.Mentions = req.Mentions
 		if req.ReplyTo != nil {
 			rec.ReplyToMessageID = req.ReplyTo.MessageID
 		}
@@ -151,7 +159,10 @@ func (c *Client) SendMediaRich(ctx context.Context, req core.SendMediaRequest) (
        }
 
        // Generate OTID once so retries reuse the same ID (Facebook deduplicates by OTID).
-       otid := methods.GenerateEpochID()
+       otid := req.OTID
+       if otid == 0 {
+	       otid = methods.GenerateEpochID()
+       }
 
        var lastErr error
        for i := 0; i < maxRetries; i++ {
@@ -372,6 +383,7 @@ func messageRecordFromInsert(msg *table.LSInsertMessage, senderID int64) *core.M
 		IsEdited:           msg.EditCount > 0,
 		IsRecalled:         msg.IsUnsent,
 		HasMedia:           msg.StickerId != 0,
+		Mentions:           messaging.MentionsFromTable(msg.MentionIds, msg.MentionOffsets, msg.MentionLengths, msg.MentionTypes),
 	}
 }
 
@@ -429,21 +441,123 @@ func firstNonZero(values ...int64) int64 {
 
 // ForwardMessage forwards an existing message to another thread.
 func (c *Client) ForwardMessage(ctx context.Context, threadID int64, forwardedMsgID string) error {
-	otid := methods.GenerateEpochID()
-	task := &socket.SendMessageTask{
-		ThreadId:                 threadID,
-		Otid:                     otid,
-		Source:                   65544,
-		SendType:                 5, // forward
-		SyncGroup:                1,
-		ForwardedMsgId:           forwardedMsgID,
-		StripForwardedMsgCaption: 0,
-		InitiatingSource:         1,
-	}
-	_, err := c.client.ExecuteTask(ctx, task)
+	_, err := c.Forward(ctx, core.ForwardRequest{ThreadID: threadID, MessageID: forwardedMsgID})
 	return err
 }
 
+// Forward forwards req.MessageID into req.ThreadID. The returned record has
+// no text; the service fills it in from the stored original.
+func (c *Client) Forward(ctx context.Context, req core.ForwardRequest) (*core.MessageRecord, error) {
+	return c.sendTask(ctx, req.ThreadID, req.OTID, func(otid int64) *socket.SendMessageTask {
+		return &socket.SendMessageTask{
+			ThreadId:                 req.ThreadID,
+			Otid:                     otid,
+			Source:                   65544,
+			SendType:                 table.FORWARD,
+			SyncGroup:                1,
+			ForwardedMsgId:           req.MessageID,
+			StripForwardedMsgCaption: 0,
+			InitiatingSource:         1,
+		}
+	})
+}
+
+// SendSticker sends the sticker req.StickerID.
+func (c *Client) SendSticker(ctx context.Context, req core.SendStickerRequest) (*core.MessageRecord, error) {
+	rec, err := c.sendTask(ctx, req.ThreadID, req.OTID, func(otid int64) *socket.SendMessageTask {
+		task := &socket.SendMessageTask{
+			ThreadId:  req.ThreadID,
+			Otid:      otid,
+			Source:    table.MESSENGER_INBOX_IN_THREAD,
+			SendType:  table.STICKER,
+			SyncGroup: 1,
+			StickerId: req.StickerID,
+		}
+		task.ReplyMetaData = replyMetaData(req.ReplyTo)
+		return task
+	})
+	if err != nil {
+		return nil, err
+	}
+	rec.HasMedia = true
+	rec.Attachments = []core.AttachmentMeta{{AttachmentID: fmt.Sprintf("%d", req.StickerID), Kind: "sticker"}}
+	if req.ReplyTo != nil {
+		rec.ReplyToMessageID = req.ReplyTo.MessageID
+	}
+	return rec, nil
+}
+
+// SendExternalMedia sends media by URL; Messenger fetches it server-side.
+func (c *Client) SendExternalMedia(ctx context.Context, req core.SendExternalMediaRequest) (*core.MessageRecord, error) {
+	rec, err := c.sendTask(ctx, req.ThreadID, req.OTID, func(otid int64) *socket.SendMessageTask {
+		task := &socket.SendMessageTask{
+			ThreadId:  req.ThreadID,
+			Otid:      otid,
+			Source:    table.MESSENGER_INBOX_IN_THREAD,
+			SendType:  table.EXTERNAL_MEDIA,
+			SyncGroup: 1,
+			Url:       req.URL,
+		}
+		task.ReplyMetaData = replyMetaData(req.ReplyTo)
+		return task
+	})
+	if err != nil {
+		return nil, err
+	}
+	rec.HasMedia = true
+	rec.Attachments = []core.AttachmentMeta{{Kind: "external", URL: req.URL}}
+	if req.ReplyTo != nil {
+		rec.ReplyToMessageID = req.ReplyTo.MessageID
+	}
+	return rec, nil
+}
+
+// sendTask executes the task built by build with the same retry policy as
+// SendText, reusing one OTID across attempts.
+func (c *Client) sendTask(ctx context.Context, threadID, otid int64, build func(otid int64) *socket.SendMessageTask) (*core.MessageRecord, error) {
+	if otid == 0 {
+		otid = methods.GenerateEpochID()
+	}
+	var lastErr error
+	for i := 0; i < maxRetries; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(time.Duration(i) * 500 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		resp, err := c.client.ExecuteTask(ctx, build(otid))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		rec := messageRecordFromSendResponse(resp, threadID, c.selfID)
+		if rec == nil {
+			rec = &core.MessageRecord{
+				ThreadID: threadID,
+				SenderID: c.selfID,
+			}
+		}
+		if rec.OfflineThreadingID == "" {
+			rec.OfflineThreadingID = fmt.Sprintf("%d", otid)
+		}
+		return rec, nil
+	}
+	return nil, lastErr
+}
+
+func replyMetaData(replyTo *core.ReplyTarget) *socket.ReplyMetaData {
+	if replyTo == nil || replyTo.MessageID == "" {
+		return nil
+	}
+	return &socket.ReplyMetaData{
+		ReplyMessageId:  replyTo.MessageID,
+		ReplySourceType: 1,
+		ReplyType:       0,
+	}
+}
+
 // SendReaction sets a reaction emoji on a message.
 func (c *Client) SendReaction(ctx context.Context, threadID int64, messageID string, reaction string) error {
 	task := &socket.SendReactionTask{
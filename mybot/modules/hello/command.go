@@ -14,7 +14,7 @@ func Description() string {
 }
 
 // Execute receives a context map with keys:
-//   thread_id, sender_id, message_id, args, raw_text, start_time, uptime_sec
+//   thread_id, sender_id, message_id, args, raw_text, mentions, start_time, uptime_sec
 func Execute(ctx map[string]interface{}) string {
 	args, _ := ctx["args"].([]string)
 	if len(args) > 0 {